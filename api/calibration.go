@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// calibrate replaces the confidence of an invoice with the share of reviewed
+// invoices of its provider and raw confidence that needed no correction, so
+// webhooks.review_threshold is an observed error rate. The invoice is left as
+// is until enough invoices were reviewed.
+func (h *Handler) calibrate(invoice *models.Invoice) {
+	if h.calibrator == nil {
+		return
+	}
+	model := h.calibrator.Model()
+	if model == nil {
+		return
+	}
+	confidence, fields, ok := model.Calibrate(invoice.Provider, invoice.Confidence)
+	if !ok {
+		return
+	}
+	invoice.RawConfidence = invoice.Confidence
+	invoice.Confidence = confidence
+	invoice.FieldConfidence = fields
+}
+
+// GetCalibration returns the fitted calibration curves, by provider and field
+func (h *Handler) GetCalibration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.calibrator == nil {
+		h.sendError(w, http.StatusNotFound, "Confidence calibration is not enabled")
+		return
+	}
+	if len(h.authn) > 0 {
+		identity, ok := auth.IdentityFromContext(r.Context())
+		if !ok || !identity.Admin {
+			h.sendError(w, http.StatusForbidden, "Admin credentials required to view the calibration")
+			return
+		}
+	}
+
+	model := h.calibrator.Model()
+	if model == nil {
+		h.sendError(w, http.StatusServiceUnavailable, "Confidence calibration has not been fitted yet")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(model)
+}
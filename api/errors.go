@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// Error codes returned in the "code" field of error responses. They are
+// stable: clients may branch on them.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeFileTooLarge         = "file_too_large"
+	CodeUnsupportedType      = "unsupported_type"
+	CodeInvalidImage         = "invalid_image"
+	CodeOCRFailed            = "ocr_failed"
+	CodeLanguageNotInstalled = "language_not_installed"
+	CodeProviderUnavailable  = "provider_unavailable"
+	CodeProviderNotAllowed   = "provider_not_allowed"
+	CodeParseError           = "parse_error"
+	CodeRejected             = "rejected"
+	CodeNotAnInvoice         = "not_an_invoice"
+	CodeTimeout              = "timeout"
+	CodeCanceled             = "canceled"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeGone                 = "gone"
+	CodeRateLimited          = "rate_limited"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeOverloaded           = "overloaded"
+	CodeInternal             = "internal_error"
+)
+
+// classifyError maps a processing error to an HTTP status and error code
+func classifyError(err error) (int, string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable, CodeCanceled
+	case errors.Is(err, pipeline.ErrUnsupportedProvider), errors.Is(err, pipeline.ErrUnknownProfile):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.Is(err, pipeline.ErrProviderNotAllowed):
+		return http.StatusForbidden, CodeProviderNotAllowed
+	case errors.Is(err, pipeline.ErrParseResponse):
+		return http.StatusBadGateway, CodeParseError
+	case errors.Is(err, pipeline.ErrRejected):
+		return http.StatusUnprocessableEntity, CodeRejected
+	case errors.Is(err, pipeline.ErrNotAnInvoice):
+		return http.StatusUnprocessableEntity, CodeNotAnInvoice
+	}
+
+	var le *pipeline.LanguageError
+	if errors.As(err, &le) {
+		return http.StatusBadRequest, CodeLanguageNotInstalled
+	}
+
+	var se *pipeline.StageError
+	if errors.As(err, &se) {
+		switch se.Stage {
+		case pipeline.StagePreprocess:
+			return http.StatusUnprocessableEntity, CodeInvalidImage
+		case pipeline.StageOCR:
+			return http.StatusUnprocessableEntity, CodeOCRFailed
+		case pipeline.StageAI:
+			return http.StatusBadGateway, CodeProviderUnavailable
+		}
+	}
+
+	return http.StatusInternalServerError, CodeInternal
+}
+
+// codeForStatus returns the default error code of an HTTP status
+func codeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusRequestEntityTooLarge:
+		return CodeFileTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedType
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeOverloaded
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if statusCode >= 400 && statusCode < 500 {
+		return CodeInvalidRequest
+	}
+	return CodeInternal
+}
+
+// sendError sends an error response with the default code of the status
+func (h *Handler) sendError(w http.ResponseWriter, statusCode int, message string) {
+	h.sendErrorCode(w, statusCode, codeForStatus(statusCode), message)
+}
+
+// sendErrorCode sends an error response with an explicit error code
+func (h *Handler) sendErrorCode(w http.ResponseWriter, statusCode int, code, message string) {
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: w.Header().Get(requestid.Header),
+	})
+}
+
+// sendFormError reports a multipart parsing failure, telling oversized uploads apart
+func (h *Handler) sendFormError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		h.sendUploadError(w, h.tooLarge())
+		return
+	}
+	h.sendError(w, http.StatusBadRequest, "Invalid form data")
+}
+
+// sendFailure sends the response of a failed processing run. With
+// legacy_errors set the status stays 200, as before the error taxonomy.
+func (h *Handler) sendFailure(w http.ResponseWriter, r *http.Request, err error, result *processResult, redactPII bool, fields responseFields, totalDuration float64) {
+	response := h.failureResponse(err, result, redactPII, totalDuration)
+	response.RequestID = w.Header().Get(requestid.Header)
+	h.logFailure(r, err, response, totalDuration)
+
+	statusCode, _ := classifyError(err)
+	if h.cfg().LegacyErrors {
+		statusCode = http.StatusOK
+	}
+
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(fields.apply(response))
+}
+
+// logFailure logs a failed processing run
+func (h *Handler) logFailure(r *http.Request, err error, response models.ProcessResponse, totalDuration float64) {
+	logging.FromContext(r.Context()).Warn("processing failed",
+		"code", response.Code,
+		"stage", response.Stage,
+		"total_duration", totalDuration,
+		"error", err,
+	)
+}
@@ -0,0 +1,381 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+	"github.com/shopspring/decimal"
+)
+
+// maxReportInvoices caps the invoices of one expense report
+const maxReportInvoices = 1000
+
+// Expense policy rules reported in violations
+const (
+	ruleMaxAmount       = "max_amount"
+	ruleCategoryLimit   = "category_limit"
+	ruleMonthlyLimit    = "monthly_limit"
+	ruleBlockedCategory = "blocked_category"
+	rulePerDiem         = "per_diem"
+	ruleLate            = "late"
+	ruleUnapproved      = "unapproved"
+	ruleDuplicate       = "duplicate"
+)
+
+// ExpenseReportRequest selects the stored invoices of an expense report
+type ExpenseReportRequest struct {
+	Title      string            `json:"title,omitempty"`
+	InvoiceIDs []string          `json:"invoiceIds"`
+	Currencies map[string]string `json:"currencies,omitempty"` // ISO 4217 code by invoice ID, for invoices not in the export currency
+}
+
+// ExpenseReport summarizes a batch of stored invoices and checks them
+// against the tenant's expense policy
+type ExpenseReport struct {
+	Title      string            `json:"title,omitempty"`
+	Currency   string            `json:"currency"`       // Export currency, which policy limits are in
+	From       string            `json:"from,omitempty"` // Earliest invoice date
+	To         string            `json:"to,omitempty"`   // Latest invoice date
+	Count      int               `json:"count"`
+	Compliant  bool              `json:"compliant"`  // No policy violations
+	Totals     []ExpenseTotal    `json:"totals"`     // By currency
+	ByCategory []ExpenseTotal    `json:"byCategory"` // By category and currency; an invoice counts in its first category
+	PerDiem    []PerDiemDay      `json:"perDiem,omitempty"`
+	Violations []PolicyViolation `json:"violations"`
+	Invoices   []ExpenseLine     `json:"invoices"` // Oldest first
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// ExpenseTotal aggregates the invoices of a report sharing a currency and, in byCategory, a category
+type ExpenseTotal struct {
+	Category string          `json:"category,omitempty"`
+	Currency string          `json:"currency"`
+	Count    int             `json:"count"`
+	Total    decimal.Decimal `json:"total"`
+	Tax      decimal.Decimal `json:"tax"`
+}
+
+// PerDiemDay is the per-diem spend of one day of a report
+type PerDiemDay struct {
+	Date     string          `json:"date"`
+	Spent    decimal.Decimal `json:"spent"`
+	Limit    decimal.Decimal `json:"limit"`
+	Over     bool            `json:"over"`
+	Invoices []string        `json:"invoices"`
+}
+
+// PolicyViolation is a breach of the expense policy by an invoice, or by a day for per_diem
+type PolicyViolation struct {
+	Rule      string `json:"rule"`
+	InvoiceID string `json:"invoiceId,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Message   string `json:"message"`
+}
+
+// ExpenseLine is one invoice of a report
+type ExpenseLine struct {
+	ID       string          `json:"id"`
+	Vendor   string          `json:"vendor"`
+	Date     string          `json:"date"`
+	Category string          `json:"category"`
+	Currency string          `json:"currency"`
+	Total    decimal.Decimal `json:"total"`
+	Tax      decimal.Decimal `json:"tax"`
+	Approved bool            `json:"approved"`
+}
+
+// CreateExpenseReport summarizes a batch of the caller's stored invoices:
+// totals per currency and category, per-diem spend and expense policy
+// violations. Nothing is stored; the report is computed on each request.
+func (h *Handler) CreateExpenseReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	var req ExpenseReportRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil || len(req.InvoiceIDs) == 0 {
+		h.sendError(w, http.StatusBadRequest, "Request body must be JSON with invoiceIds")
+		return
+	}
+	if len(req.InvoiceIDs) > maxReportInvoices {
+		h.sendError(w, http.StatusBadRequest, fmt.Sprintf("At most %d invoices per report", maxReportInvoices))
+		return
+	}
+	currencies := make(map[string]string, len(req.Currencies))
+	for id, currency := range req.Currencies {
+		currency = strings.ToUpper(currency)
+		if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+			h.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid currency %q, expected an ISO 4217 code like EUR", req.Currencies[id]))
+			return
+		}
+		currencies[id] = currency
+	}
+
+	tenant := h.resolveTenant(r)
+	records := make([]*models.StoredInvoice, 0, len(req.InvoiceIDs))
+	seen := make(map[string]bool, len(req.InvoiceIDs))
+	var missing []string
+	for _, id := range req.InvoiceIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		record, err := h.store.Get(id)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && (record.TenantID != tenant.ID || record.Invoice == nil)) {
+			// Invoices of other tenants are reported as missing
+			missing = append(missing, id)
+			continue
+		}
+		if err != nil {
+			h.sendError(w, http.StatusInternalServerError, "Failed to load invoice")
+			return
+		}
+		records = append(records, record)
+	}
+	if len(missing) > 0 {
+		h.sendError(w, http.StatusNotFound, "Invoices not found: "+strings.Join(missing, ", "))
+		return
+	}
+
+	report := expenseReport(records, currencies, tenant.Export.Currency, tenant.Expenses, time.Now().UTC())
+	report.Title = req.Title
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+// expenseReport builds the report of records, whose amounts are in currency
+// unless overridden in currencies, checking them against policy as of now
+func expenseReport(records []*models.StoredInvoice, currencies map[string]string, currency string, policy models.ExpensesConfig, now time.Time) ExpenseReport {
+	sort.SliceStable(records, func(i, j int) bool {
+		return invoiceDate(records[i]).Before(invoiceDate(records[j]))
+	})
+
+	report := ExpenseReport{
+		Currency:   currency,
+		Count:      len(records),
+		Totals:     []ExpenseTotal{},
+		ByCategory: []ExpenseTotal{},
+		Violations: []PolicyViolation{},
+		Invoices:   make([]ExpenseLine, 0, len(records)),
+		CreatedAt:  now,
+	}
+	if len(records) > 0 {
+		report.From = invoiceDate(records[0]).Format(time.DateOnly)
+		report.To = invoiceDate(records[len(records)-1]).Format(time.DateOnly)
+	}
+
+	totals := map[string]*ExpenseTotal{}
+	byCategory := map[[2]string]*ExpenseTotal{}
+	add := func(total *ExpenseTotal, invoice *models.Invoice) {
+		total.Count++
+		total.Total = total.Total.Add(invoice.Total)
+		total.Tax = total.Tax.Add(invoice.Tax)
+	}
+	violate := func(rule, id, date, format string, args ...interface{}) {
+		report.Violations = append(report.Violations, PolicyViolation{Rule: rule, InvoiceID: id, Date: date, Message: fmt.Sprintf(format, args...)})
+	}
+
+	limited := make([]string, 0, len(policy.CategoryLimits))
+	for category := range policy.CategoryLimits {
+		limited = append(limited, category)
+	}
+	sort.Strings(limited)
+
+	perDiem := map[string]*PerDiemDay{}
+	var days []string
+	duplicates := map[string]string{}
+	for _, record := range records {
+		invoice := record.Invoice
+		date := invoiceDate(record).Format(time.DateOnly)
+		lineCurrency := currency
+		if c, ok := currencies[record.ID]; ok {
+			lineCurrency = c
+		}
+		category := uncategorized
+		if len(invoice.Categories) > 0 {
+			category = invoice.Categories[0]
+		}
+		report.Invoices = append(report.Invoices, ExpenseLine{
+			ID:       record.ID,
+			Vendor:   invoice.Vendor,
+			Date:     date,
+			Category: category,
+			Currency: lineCurrency,
+			Total:    invoice.Total,
+			Tax:      invoice.Tax,
+			Approved: record.ApprovedAt != nil,
+		})
+
+		if totals[lineCurrency] == nil {
+			totals[lineCurrency] = &ExpenseTotal{Currency: lineCurrency}
+		}
+		add(totals[lineCurrency], invoice)
+		key := [2]string{category, lineCurrency}
+		if byCategory[key] == nil {
+			byCategory[key] = &ExpenseTotal{Category: category, Currency: lineCurrency}
+		}
+		add(byCategory[key], invoice)
+
+		// The same receipt submitted twice, e.g. photographed and scanned
+		fingerprint := strings.ToLower(strings.TrimSpace(invoice.Vendor)) + "|" + date + "|" + invoice.Total.String()
+		if first, ok := duplicates[fingerprint]; ok {
+			violate(ruleDuplicate, record.ID, date, "Same vendor, date and total as invoice %s", first)
+		} else {
+			duplicates[fingerprint] = record.ID
+		}
+
+		if policy.RequireApproval && record.ApprovedAt == nil {
+			violate(ruleUnapproved, record.ID, date, "Invoice is not approved")
+		}
+		if policy.MaxAgeDays > 0 && invoiceDate(record).Before(now.AddDate(0, 0, -policy.MaxAgeDays)) {
+			violate(ruleLate, record.ID, date, "Invoice is older than %d days", policy.MaxAgeDays)
+		}
+		for _, blocked := range policy.BlockedCategories {
+			if hasCategory(invoice, blocked) {
+				violate(ruleBlockedCategory, record.ID, date, "Category %s is not reimbursed", blocked)
+			}
+		}
+
+		// Limits are in the export currency
+		if lineCurrency != currency {
+			continue
+		}
+		if policy.MaxAmount > 0 && invoice.Total.GreaterThan(decimal.NewFromFloat(policy.MaxAmount)) {
+			violate(ruleMaxAmount, record.ID, date, "Total %s %s exceeds the limit of %s", invoice.Total, currency, decimal.NewFromFloat(policy.MaxAmount))
+		}
+		for _, category := range limited {
+			limit := policy.CategoryLimits[category]
+			if hasCategory(invoice, category) && invoice.Total.GreaterThan(decimal.NewFromFloat(limit)) {
+				violate(ruleCategoryLimit, record.ID, date, "Total %s %s exceeds the %s limit of %s", invoice.Total, currency, category, decimal.NewFromFloat(limit))
+			}
+		}
+		if policy.PerDiem > 0 && countsPerDiem(invoice, policy.PerDiemCategories) {
+			day, ok := perDiem[date]
+			if !ok {
+				day = &PerDiemDay{Date: date, Limit: decimal.NewFromFloat(policy.PerDiem)}
+				perDiem[date] = day
+				days = append(days, date)
+			}
+			day.Spent = day.Spent.Add(invoice.Total)
+			day.Invoices = append(day.Invoices, record.ID)
+		}
+	}
+
+	for _, date := range days {
+		day := perDiem[date]
+		day.Over = day.Spent.GreaterThan(day.Limit)
+		if day.Over {
+			violate(rulePerDiem, "", date, "Spent %s %s, over the per diem of %s", day.Spent, currency, day.Limit)
+		}
+		report.PerDiem = append(report.PerDiem, *day)
+	}
+	for _, total := range totals {
+		report.Totals = append(report.Totals, *total)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+	for _, total := range byCategory {
+		report.ByCategory = append(report.ByCategory, *total)
+	}
+	sort.Slice(report.ByCategory, func(i, j int) bool {
+		a, b := report.ByCategory[i], report.ByCategory[j]
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Currency < b.Currency
+	})
+	report.Compliant = len(report.Violations) == 0
+	return report
+}
+
+// checkMonthlyLimits sets the policy violations of a stored invoice: the
+// monthly limits of its categories that the tenant's stored invoices of the
+// same month, itself included, add up to more than. A failure to list the
+// stored invoices is logged and leaves the invoice without violations.
+// Proformas are not spend and are left out on both sides.
+func (h *Handler) checkMonthlyLimits(ctx context.Context, tenant *tenantSettings, record *models.StoredInvoice) {
+	invoice := record.Invoice
+	invoice.PolicyViolations = nil
+	limits := tenant.Expenses.MonthlyLimits
+	if len(limits) == 0 || h.store == nil || invoice.DocumentSubtype == classify.SubtypeProforma {
+		return
+	}
+	var limited []string
+	for category := range limits {
+		if hasCategory(invoice, category) {
+			limited = append(limited, category)
+		}
+	}
+	if len(limited) == 0 {
+		return
+	}
+	sort.Strings(limited)
+
+	records, err := h.store.List()
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to check monthly limits", "error", err)
+		return
+	}
+	month := invoiceDate(record).Format("2006-01")
+	for _, category := range limited {
+		spent := invoice.Total
+		for _, other := range records {
+			if other.ID == record.ID || other.TenantID != record.TenantID || other.Invoice == nil ||
+				other.Invoice.DocumentSubtype == classify.SubtypeProforma {
+				continue
+			}
+			if hasCategory(other.Invoice, category) && invoiceDate(other).Format("2006-01") == month {
+				spent = spent.Add(other.Invoice.Total)
+			}
+		}
+		limit := decimal.NewFromFloat(limits[category])
+		if spent.GreaterThan(limit) {
+			invoice.PolicyViolations = append(invoice.PolicyViolations, models.PolicyViolation{
+				Rule:     ruleMonthlyLimit,
+				Category: category,
+				Month:    month,
+				Limit:    limit,
+				Spent:    spent,
+				Message:  fmt.Sprintf("%s spend of %s is %s %s, over the monthly limit of %s", category, month, spent, tenant.Export.Currency, limit),
+			})
+		}
+	}
+}
+
+// hasCategory reports whether an invoice has a category, ignoring case
+func hasCategory(invoice *models.Invoice, category string) bool {
+	for _, c := range invoice.Categories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// countsPerDiem reports whether an invoice counts against the per diem
+func countsPerDiem(invoice *models.Invoice, categories []string) bool {
+	if len(categories) == 0 {
+		return true
+	}
+	for _, category := range categories {
+		if hasCategory(invoice, category) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/export"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// ExportInvoices downloads the caller's stored invoices as a flat file for
+// bookkeeping: ?format=csv|xlsx, ?rows=invoices|items, and the ?from= and
+// ?to= dates of GetStats. ?format=ubl downloads a zip of UBL documents.
+func (h *Handler) ExportInvoices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	format := export.Format(strings.ToLower(query.Get("format")))
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX && format != export.FormatUBL {
+		h.sendError(w, http.StatusBadRequest, "Invalid format, expected csv, xlsx or ubl")
+		return
+	}
+	layout := export.Layout(query.Get("rows"))
+	if layout == "" {
+		layout = export.LayoutInvoices
+	}
+	if layout != export.LayoutInvoices && layout != export.LayoutItems {
+		h.sendError(w, http.StatusBadRequest, "Invalid rows, expected invoices or items")
+		return
+	}
+
+	from, to, ok := h.dateRange(w, r)
+	if !ok {
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	records, err := h.tenantInvoices(tenant, from, to)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to list invoices")
+		return
+	}
+
+	// Buffer the file so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	contentType, extension := format.ContentType(), string(format)
+	if format == export.FormatUBL {
+		contentType, extension = "application/zip", "zip"
+		err = export.WriteUBLArchive(&buf, records, tenant.Export)
+	} else {
+		err = export.Write(&buf, format, layout, records)
+	}
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to export invoices")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFilename(query.Get("from"), query.Get("to"), extension)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// ExportInvoice downloads one stored invoice as an e-invoice document:
+// ?format=ubl (default), facturae, signed when a sign command is configured,
+// or facturx, a PDF with the original upload attached when it is still stored
+func (h *Handler) ExportInvoice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	format := export.Format(strings.ToLower(r.URL.Query().Get("format")))
+	if format == "" {
+		format = export.FormatUBL
+	}
+	if format != export.FormatUBL && format != export.FormatFacturae && format != export.FormatFacturX {
+		h.sendError(w, http.StatusBadRequest, "Invalid format, expected ubl, facturae or facturx")
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	record, ok := h.loadInvoice(w, tenant, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if record.Invoice == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice not found")
+		return
+	}
+
+	var buf bytes.Buffer
+	extension := "xml"
+	if format == export.FormatFacturX {
+		if tenant.Export.Buyer.Name == "" {
+			h.sendError(w, http.StatusUnprocessableEntity, "Factur-X export requires export.buyer.name")
+			return
+		}
+		// A purged original leaves the XML as the only attachment
+		original, err := h.store.GetOriginal(record.ID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			h.sendError(w, http.StatusInternalServerError, "Failed to load original image")
+			return
+		}
+		if err := export.WriteFacturX(&buf, record, tenant.Export, original); err != nil {
+			h.sendError(w, http.StatusInternalServerError, "Failed to export invoice")
+			return
+		}
+		extension = "pdf"
+	} else if format == export.FormatFacturae {
+		facturae := tenant.Export.Facturae
+		var signer export.Signer
+		if s := export.NewCommandSigner(facturae.SignCommand, facturae.SignTimeout); s != nil {
+			signer = s
+		}
+		err := export.WriteFacturae(r.Context(), &buf, record, tenant.Export, signer)
+		switch {
+		case errors.Is(err, export.ErrMissingTaxID):
+			h.sendError(w, http.StatusUnprocessableEntity, "Facturae export requires export.buyer.tax_id and export.facturae.seller.tax_id")
+			return
+		case err != nil:
+			logging.FromContext(r.Context()).Warn("facturae export failed", "invoice_id", record.ID, "error", err)
+			h.sendError(w, http.StatusInternalServerError, "Failed to export invoice")
+			return
+		}
+	} else if err := export.WriteUBL(&buf, record, tenant.Export); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to export invoice")
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, record.ID, extension))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// exportFilename names an export after its date range, e.g. invoices_2024-01-01_2024-01-31.xlsx
+func exportFilename(from, to, extension string) string {
+	name := "invoices"
+	if from != "" {
+		name += "_" + from
+	}
+	if to != "" {
+		name += "_" + to
+	}
+	return name + "." + extension
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+)
+
+const (
+	MaxTextSize = 1024 * 1024 // 1MB
+
+	// textContentType marks stored invoices whose original is text from /extract-text
+	textContentType = "text/plain; charset=utf-8"
+)
+
+// ExtractText runs only the AI extraction stage on text sent as JSON, for
+// documents already OCR'd elsewhere
+func (h *Handler) ExtractText(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	startTime := time.Now()
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxTextSize)
+	var req models.ExtractTextRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.sendError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Text too large (max %d bytes)", MaxTextSize))
+			return
+		}
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		h.sendError(w, http.StatusBadRequest, "No text provided")
+		return
+	}
+
+	fields, err := parseResponseFields(r)
+	if err != nil {
+		h.sendResponseFieldsError(w, err)
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	params := h.withDefaults(models.ProcessRequest{
+		AIProvider: req.AIProvider,
+		Model:      req.Model,
+		RedactPII:  req.RedactPII,
+		Profile:    req.Profile,
+	}, tenant)
+	if g := req.GenerationParams; g.Temperature != nil || g.MaxTokens != nil || g.TopP != nil || len(g.Options) > 0 {
+		params.Generation = &g
+	}
+	if err := checkGeneration(params); err != nil {
+		h.sendGenerationError(w, err)
+		return
+	}
+
+	result, err := h.extractText(r.Context(), tenant, req.Text, params)
+	h.recordUsage(r, result.Usage)
+
+	totalDuration := time.Since(startTime).Seconds()
+
+	if err != nil {
+		h.sendFailure(w, r, err, result, params.RedactPII, fields, totalDuration)
+		return
+	}
+	invoice := result.Invoice
+
+	if params.RedactPII {
+		invoice.RawText = redact.Text(invoice.RawText)
+	}
+
+	// The text is archived as the original, so the invoice can be reprocessed
+	err = h.archiveInvoice(r.Context(), tenant, params, "", textContentType, result, totalDuration, []byte(req.Text))
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to store invoice")
+		return
+	}
+
+	response := models.ProcessResponse{
+		Success:       true,
+		Invoice:       invoice,
+		AIDuration:    result.AIDuration,
+		TotalDuration: totalDuration,
+		Usage:         &result.Usage,
+		Diagnostics:   result.Diagnostics,
+		RequestID:     requestid.FromContext(r.Context()),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(fields.apply(response))
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// invoiceFields are the JSON names of the invoice fields ?fields= can select
+var invoiceFields = jsonFields(reflect.TypeOf(models.Invoice{}))
+
+// responseFields selects the parts of a processing response sent to the client
+type responseFields struct {
+	invoice map[string]bool // Invoice fields to keep; nil keeps all
+	rawText bool
+	version int // Invoice schema version, models.SchemaV1 or SchemaV2
+}
+
+// shapedResponse is a processing response with a subset of the invoice
+// fields or another invoice schema version
+type shapedResponse struct {
+	models.ProcessResponse
+	Invoice interface{} `json:"invoice,omitempty"` // Shadows ProcessResponse.Invoice
+}
+
+// parseResponseFields reads the fields= and includeRawText= parameters and
+// the Accept-Version header. fields is a comma-separated list of invoice
+// fields, e.g. "vendor,date,total".
+func parseResponseFields(r *http.Request) (responseFields, error) {
+	fields := responseFields{rawText: r.FormValue("includeRawText") != "false"}
+	version, err := parseSchemaVersion(r.Header.Get("Accept-Version"))
+	if err != nil {
+		return fields, err
+	}
+	fields.version = version
+
+	list := r.FormValue("fields")
+	if list == "" {
+		return fields, nil
+	}
+	fields.invoice = make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !invoiceFields[name] {
+			return fields, fmt.Errorf("unknown invoice field %q", name)
+		}
+		fields.invoice[name] = true
+	}
+	return fields, nil
+}
+
+// sendResponseFieldsError rejects a request with invalid field selection parameters
+func (h *Handler) sendResponseFieldsError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errSchemaVersion) {
+		h.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid Accept-Version header: %v", err))
+		return
+	}
+	h.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid fields parameter: %v", err))
+}
+
+// apply returns the response to encode. The invoice is copied, never modified,
+// since it may already be stored. The id is always kept so the invoice can be
+// fetched in full later.
+func (f responseFields) apply(response models.ProcessResponse) interface{} {
+	response.SchemaVersion = max(f.version, models.SchemaV1)
+	if !f.rawText {
+		response.RawText = ""
+	}
+	if response.Invoice == nil {
+		return response
+	}
+	if f.invoice == nil && f.version != models.SchemaV2 {
+		response.Invoice = f.withRawText(response.Invoice)
+		return response
+	}
+	return shapedResponse{ProcessResponse: response, Invoice: f.shapeInvoice(response.Invoice)}
+}
+
+// shapeInvoice returns an invoice to encode outside a ProcessResponse, e.g.
+// in the documents of a split upload
+func (f responseFields) shapeInvoice(invoice *models.Invoice) interface{} {
+	invoice = f.withRawText(invoice)
+	var shaped interface{} = invoice
+	if f.version == models.SchemaV2 {
+		shaped = toInvoiceV2(invoice)
+	}
+	if selected := f.selected(shaped); selected != nil {
+		return selected
+	}
+	return shaped
+}
+
+// withRawText returns invoice, or a copy without the OCR text when it is left out
+func (f responseFields) withRawText(invoice *models.Invoice) *models.Invoice {
+	if f.rawText {
+		return invoice
+	}
+	stripped := *invoice
+	stripped.RawText = ""
+	return &stripped
+}
+
+// selected returns the selected fields of invoice and its id, or nil when all
+// fields are kept. invoice is an invoice of any schema version; fields are
+// selected by their name in it.
+func (f responseFields) selected(invoice interface{}) map[string]json.RawMessage {
+	if f.invoice == nil {
+		return nil
+	}
+	data, err := json.Marshal(invoice)
+	if err != nil {
+		return nil
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil
+	}
+
+	selected := make(map[string]json.RawMessage, len(f.invoice)+1)
+	for name, value := range all {
+		if f.invoice[name] || name == "id" {
+			selected[name] = value
+		}
+	}
+	return selected
+}
+
+// jsonFields returns the JSON names of the fields of a struct type
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
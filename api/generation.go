@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ai"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// generationParams reads the temperature, maxTokens, topP, options,
+// imageDetail and maxImageTokens form fields. options is a JSON object of provider-specific options. It returns
+// nil when none is set, so provider defaults apply.
+func generationParams(r *http.Request) (*models.GenerationParams, error) {
+	var params models.GenerationParams
+	set := false
+
+	if v := r.FormValue("temperature"); v != "" {
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return nil, fmt.Errorf("temperature must be a number")
+		}
+		t := float32(f)
+		params.Temperature = &t
+		set = true
+	}
+	if v := r.FormValue("maxTokens"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("maxTokens must be an integer")
+		}
+		params.MaxTokens = &n
+		set = true
+	}
+	if v := r.FormValue("topP"); v != "" {
+		f, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			return nil, fmt.Errorf("topP must be a number")
+		}
+		p := float32(f)
+		params.TopP = &p
+		set = true
+	}
+	if v := r.FormValue("options"); v != "" {
+		if err := json.Unmarshal([]byte(v), &params.Options); err != nil {
+			return nil, fmt.Errorf("options must be a JSON object")
+		}
+		set = true
+	}
+
+	if v := r.FormValue("imageDetail"); v != "" {
+		params.ImageDetail = v
+		set = true
+	}
+	if v := r.FormValue("maxImageTokens"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("maxImageTokens must be an integer")
+		}
+		params.MaxImageTokens = &n
+		set = true
+	}
+
+	if !set {
+		return nil, nil
+	}
+	return &params, nil
+}
+
+// checkGeneration validates the generation overrides of a request for its provider
+func checkGeneration(params models.ProcessRequest) error {
+	if params.Generation == nil {
+		return nil
+	}
+	return ai.ValidateGeneration(params.AIProvider, *params.Generation)
+}
+
+// sendGenerationError rejects a request with invalid generation parameters
+func (h *Handler) sendGenerationError(w http.ResponseWriter, err error) {
+	h.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid generation parameters: %v", err))
+}
@@ -0,0 +1,521 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/queue"
+	"github.com/facturaIA/invoice-ocr-service/internal/ratelimit"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	invoiceocrv1 "github.com/facturaIA/invoice-ocr-service/proto/invoiceocr/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultBatchConcurrency = 4
+	defaultPageSize         = 50
+	maxPageSize             = 500
+)
+
+// grpcService implements the InvoiceOCR gRPC service on top of the handler
+type grpcService struct {
+	invoiceocrv1.UnimplementedInvoiceOCRServer
+	h *Handler
+}
+
+// NewGRPCServer creates a gRPC server exposing the InvoiceOCR service. Calls
+// go through the same authentication, rate limits, quotas and processing
+// slots as the HTTP API.
+func (h *Handler) NewGRPCServer(options ...grpc.ServerOption) *grpc.Server {
+	options = append(options,
+		// Leave room for the other request fields next to the image
+		grpc.MaxRecvMsgSize(int(h.maxUploadSize())+64*1024),
+		grpc.ChainUnaryInterceptor(h.unaryInterceptor),
+		grpc.ChainStreamInterceptor(h.streamInterceptor),
+	)
+	server := grpc.NewServer(options...)
+	invoiceocrv1.RegisterInvoiceOCRServer(server, &grpcService{h: h})
+	return server
+}
+
+// unaryInterceptor prepares the call context and logs each completed call
+func (h *Handler) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	startTime := time.Now()
+	ctx, span := tracing.Start(ctx, strings.TrimPrefix(info.FullMethod, "/"), attribute.String("rpc.system", "grpc"))
+
+	ctx, err := h.callContext(ctx, info.FullMethod)
+	grpc.SetHeader(ctx, metadata.Pairs(strings.ToLower(requestid.Header), requestid.FromContext(ctx)))
+	var resp interface{}
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+
+	tracing.End(span, err)
+	logCall(ctx, info.FullMethod, startTime, err)
+	return resp, err
+}
+
+// streamInterceptor prepares the call context of a stream and logs it once closed
+func (h *Handler) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	startTime := time.Now()
+	ctx, span := tracing.Start(ss.Context(), strings.TrimPrefix(info.FullMethod, "/"), attribute.String("rpc.system", "grpc"))
+
+	ctx, err := h.callContext(ctx, info.FullMethod)
+	ss.SetHeader(metadata.Pairs(strings.ToLower(requestid.Header), requestid.FromContext(ctx)))
+	if err == nil {
+		err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+
+	tracing.End(span, err)
+	logCall(ctx, info.FullMethod, startTime, err)
+	return err
+}
+
+// serverStream overrides the context of a stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// callContext does for a call what the HTTP middleware does for a request:
+// it assigns the request ID and logger, takes a per-IP rate limit token,
+// authenticates the caller from the metadata and takes a per-key token. The
+// metadata is presented to the authenticators and the limiter as the headers
+// of a request.
+func (h *Handler) callContext(ctx context.Context, method string) (context.Context, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, nil)
+	if err != nil {
+		return ctx, status.Error(codes.Internal, "invalid method")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range md {
+		r.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	id := requestid.Resolve(r.Header.Get(requestid.Header))
+	ctx = requestid.WithID(ctx, id)
+	ctx = logging.With(ctx, "request_id", id)
+
+	// Batch streams yield processing slots to single calls unless told otherwise
+	fallback := ratelimit.PriorityInteractive
+	if method == invoiceocrv1.InvoiceOCR_ProcessInvoices_FullMethodName {
+		fallback = ratelimit.PriorityBatch
+	}
+	priority, err := requestPriority(r, fallback)
+	if err != nil {
+		return ctx, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ctx = ratelimit.WithPriority(ctx, priority)
+
+	if h.limiter != nil {
+		if result, limited := h.limiter.CheckIP(r); limited && !result.Allowed {
+			return ctx, rateLimited(result)
+		}
+	}
+
+	if len(h.authn) > 0 {
+		identity, err := auth.Authenticate(r, h.authn...)
+		if err != nil {
+			logging.FromContext(ctx).Warn("authentication rejected", "remote_addr", r.RemoteAddr, "error", err)
+			return ctx, status.Error(codes.Unauthenticated, "Missing or invalid credentials")
+		}
+		ctx = auth.WithCaller(ctx, identity)
+	}
+	ctx, ok := h.withTenant(ctx)
+	if !ok {
+		logging.FromContext(ctx).Warn("unknown tenant rejected", "remote_addr", r.RemoteAddr)
+		return ctx, status.Error(codes.PermissionDenied, "Unknown tenant")
+	}
+
+	if h.limiter != nil {
+		if result, limited := h.limiter.CheckKey(r.WithContext(ctx)); limited && !result.Allowed {
+			return ctx, rateLimited(result)
+		}
+	}
+
+	return ctx, nil
+}
+
+// rateLimited is the error of a call rejected by the rate limiter
+func rateLimited(result ratelimit.Result) error {
+	return status.Errorf(codes.ResourceExhausted, "Rate limit exceeded, retry in %s", result.RetryAfter.Round(time.Second))
+}
+
+// logCall logs a completed call with its status code
+func logCall(ctx context.Context, method string, startTime time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		level = slog.LevelError
+	}
+	logging.FromContext(ctx).Log(ctx, level, "rpc completed",
+		"method", method,
+		"code", code.String(),
+		"duration_ms", time.Since(startTime).Milliseconds(),
+	)
+}
+
+// ProcessInvoice extracts the data of one invoice
+func (s *grpcService) ProcessInvoice(ctx context.Context, req *invoiceocrv1.ProcessInvoiceRequest) (*invoiceocrv1.ProcessInvoiceResponse, error) {
+	response, err := s.process(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ProcessInvoices processes a stream of invoices, up to grpc.batch_concurrency
+// at a time, streaming one response per request as each finishes
+func (s *grpcService) ProcessInvoices(stream invoiceocrv1.InvoiceOCR_ProcessInvoicesServer) error {
+	ctx := stream.Context()
+	concurrency := s.h.cfg().GRPC.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex // Serializes Send, which is not safe for concurrent use
+		sendErr error
+	)
+	slots := make(chan struct{}, concurrency)
+	send := func(response *invoiceocrv1.ProcessInvoiceResponse) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sendErr == nil {
+			sendErr = stream.Send(response)
+		}
+	}
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			wg.Wait()
+			return err
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		wg.Add(1)
+		go func(req *invoiceocrv1.ProcessInvoiceRequest) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// Failures are reported in the response, keeping the stream open
+			response, _ := s.process(ctx, req)
+			send(response)
+		}(req)
+	}
+
+	wg.Wait()
+	return sendErr
+}
+
+// process runs one invoice through the pipeline. On failure it returns both
+// the failure response, used by batch streams, and a status error.
+func (s *grpcService) process(ctx context.Context, req *invoiceocrv1.ProcessInvoiceRequest) (*invoiceocrv1.ProcessInvoiceResponse, error) {
+	h := s.h
+	startTime := time.Now()
+	key := callerKeyFrom(ctx)
+	ctx = logging.With(ctx, "correlation_id", req.GetCorrelationId())
+
+	if len(req.GetImage()) == 0 {
+		return rejected(ctx, req, codes.InvalidArgument, CodeInvalidRequest, "No image provided")
+	}
+	image := req.GetImage()
+	if e := h.checkUpload(image[:min(len(image), sniffLen)], int64(len(image)), req.GetContentType()); e != nil {
+		return rejected(ctx, req, grpcCode(e.status), e.code, e.message)
+	}
+	if h.usage != nil {
+		if exceeded, reason := h.usage.QuotaExceeded(key, h.quotaFor(key)); exceeded {
+			return rejected(ctx, req, codes.ResourceExhausted, CodeQuotaExceeded, fmt.Sprintf("Quota exceeded: %s", reason))
+		}
+	}
+	if h.slots != nil {
+		release, err := h.slots.Acquire(ctx)
+		if err != nil {
+			return rejected(ctx, req, codes.Unavailable, CodeOverloaded, "Server is busy, retry later")
+		}
+		defer release()
+	}
+
+	tenant := h.tenantFrom(ctx)
+	params := h.withDefaults(models.ProcessRequest{
+		UseVisionModel: req.GetUseVisionModel(),
+		AIProvider:     req.GetAiProvider(),
+		Model:          req.GetModel(),
+		Language:       req.GetLanguage(),
+		RedactPII:      req.GetRedactPii(),
+	}, tenant)
+
+	result, err := h.processInvoice(ctx, tenant, req.GetImage(), params, nil)
+	h.recordUsageFor(key, result.Usage)
+
+	totalDuration := time.Since(startTime).Seconds()
+
+	if err != nil {
+		response := h.failureResponse(err, result, params.RedactPII, totalDuration)
+		response.RequestID = requestid.FromContext(ctx)
+		logging.FromContext(ctx).Warn("processing failed",
+			"code", response.Code,
+			"stage", response.Stage,
+			"total_duration", totalDuration,
+			"error", err,
+		)
+
+		statusCode, _ := classifyError(err)
+		return toProtoResponse(&response, req.GetCorrelationId()), status.Error(grpcCode(statusCode), response.Error)
+	}
+	invoice := result.Invoice
+
+	if params.RedactPII {
+		invoice.RawText = redact.Text(invoice.RawText)
+	}
+
+	err = h.archiveInvoice(ctx, tenant, params, req.GetFilename(), req.GetContentType(), result, totalDuration, req.GetImage())
+	if err != nil {
+		return rejected(ctx, req, codes.Internal, CodeInternal, "Failed to store invoice")
+	}
+
+	return toProtoResponse(&models.ProcessResponse{
+		Success:       true,
+		Invoice:       invoice,
+		OCRDuration:   result.OCRDuration,
+		AIDuration:    result.AIDuration,
+		TotalDuration: totalDuration,
+		Usage:         &result.Usage,
+		RequestID:     requestid.FromContext(ctx),
+	}, req.GetCorrelationId()), nil
+}
+
+// rejected returns the failure response and status error of a request refused before processing
+func rejected(ctx context.Context, req *invoiceocrv1.ProcessInvoiceRequest, code codes.Code, errorCode, message string) (*invoiceocrv1.ProcessInvoiceResponse, error) {
+	return &invoiceocrv1.ProcessInvoiceResponse{
+		Success:       false,
+		Error:         message,
+		Code:          errorCode,
+		RequestId:     requestid.FromContext(ctx),
+		CorrelationId: req.GetCorrelationId(),
+	}, status.Error(code, message)
+}
+
+// GetJob returns an async job of the caller's tenant
+func (s *grpcService) GetJob(ctx context.Context, req *invoiceocrv1.GetJobRequest) (*invoiceocrv1.Job, error) {
+	h := s.h
+	if h.queue == nil {
+		return nil, status.Error(codes.Unimplemented, "Async jobs are not enabled")
+	}
+
+	job, err := h.queue.Get(ctx, req.GetId())
+	if err != nil || job.TenantID != h.tenantFrom(ctx).ID {
+		if err == nil || errors.Is(err, queue.ErrNotFound) {
+			return nil, status.Error(codes.NotFound, "Job not found")
+		}
+		return nil, status.Error(codes.Internal, "Failed to load job")
+	}
+
+	return toProtoJob(job), nil
+}
+
+// ListInvoices pages through the stored invoices of the caller's tenant, newest
+// first. The page token is the offset of the next page.
+func (s *grpcService) ListInvoices(ctx context.Context, req *invoiceocrv1.ListInvoicesRequest) (*invoiceocrv1.ListInvoicesResponse, error) {
+	h := s.h
+	if h.store == nil {
+		return nil, status.Error(codes.Unimplemented, "Invoice storage is not enabled")
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	offset := 0
+	if token := req.GetPageToken(); token != "" {
+		value, err := strconv.Atoi(token)
+		if err != nil || value < 0 {
+			return nil, status.Error(codes.InvalidArgument, "Invalid page token")
+		}
+		offset = value
+	}
+
+	records, err := h.store.List()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to list invoices")
+	}
+
+	tenantID := h.tenantFrom(ctx).ID
+	visible := make([]*models.StoredInvoice, 0, len(records))
+	for _, record := range records {
+		if record.TenantID == tenantID {
+			visible = append(visible, record)
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		return visible[i].CreatedAt.After(visible[j].CreatedAt)
+	})
+
+	response := &invoiceocrv1.ListInvoicesResponse{}
+	if offset >= len(visible) {
+		return response, nil
+	}
+	end := offset + pageSize
+	if end < len(visible) {
+		response.NextPageToken = strconv.Itoa(end)
+	} else {
+		end = len(visible)
+	}
+	for _, record := range visible[offset:end] {
+		response.Invoices = append(response.Invoices, &invoiceocrv1.StoredInvoice{
+			Id:         record.ID,
+			Filename:   record.Filename,
+			AiProvider: record.AIProvider,
+			Model:      record.Model,
+			Invoice:    toProtoInvoice(record.Invoice),
+			CreatedAt:  formatTime(record.CreatedAt),
+			UpdatedAt:  formatTime(record.UpdatedAt),
+		})
+	}
+
+	return response, nil
+}
+
+// grpcCode maps the HTTP status of an error to the closest gRPC code
+func grpcCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Internal
+}
+
+// toProtoResponse converts a processing response
+func toProtoResponse(response *models.ProcessResponse, correlationID string) *invoiceocrv1.ProcessInvoiceResponse {
+	p := &invoiceocrv1.ProcessInvoiceResponse{
+		Success:       response.Success,
+		Invoice:       toProtoInvoice(response.Invoice),
+		Error:         response.Error,
+		Code:          response.Code,
+		Stage:         response.Stage,
+		RawText:       response.RawText,
+		OcrDuration:   response.OCRDuration,
+		AiDuration:    response.AIDuration,
+		TotalDuration: response.TotalDuration,
+		RequestId:     response.RequestID,
+		CorrelationId: correlationID,
+	}
+	if u := response.Usage; u != nil {
+		p.Usage = &invoiceocrv1.Usage{
+			Pages:            int32(u.Pages),
+			PromptTokens:     int32(u.PromptTokens),
+			CompletionTokens: int32(u.CompletionTokens),
+			EstimatedCost:    u.EstimatedCost,
+		}
+	}
+	return p
+}
+
+// toProtoInvoice converts an invoice; amounts are sent as decimal strings
+func toProtoInvoice(invoice *models.Invoice) *invoiceocrv1.Invoice {
+	if invoice == nil {
+		return nil
+	}
+
+	p := &invoiceocrv1.Invoice{
+		Id:          invoice.ID,
+		TenantId:    invoice.TenantID,
+		Vendor:      invoice.Vendor,
+		Date:        formatTime(invoice.Date),
+		Total:       invoice.Total.String(),
+		Categories:  invoice.Categories,
+		RawText:     invoice.RawText,
+		Confidence:  invoice.Confidence,
+		ProcessedAt: formatTime(invoice.ProcessedAt),
+	}
+	if !invoice.Tax.IsZero() {
+		p.Tax = invoice.Tax.String()
+	}
+	for _, item := range invoice.Items {
+		p.Items = append(p.Items, &invoiceocrv1.InvoiceItem{
+			Name:     item.Name,
+			Amount:   item.Amount.String(),
+			IsTaxed:  item.IsTaxed,
+			Quantity: int32(item.Quantity),
+		})
+	}
+	return p
+}
+
+// toProtoJob converts an async job
+func toProtoJob(job *queue.Job) *invoiceocrv1.Job {
+	p := &invoiceocrv1.Job{
+		Id:          job.ID,
+		State:       job.State,
+		Attempts:    int32(job.Attempts),
+		MaxAttempts: int32(job.MaxAttempts),
+		LastError:   job.LastError,
+		CreatedAt:   formatTime(job.CreatedAt),
+		UpdatedAt:   formatTime(job.UpdatedAt),
+	}
+	if job.Result != nil {
+		p.Result = toProtoResponse(job.Result, "")
+	}
+	return p
+}
+
+// formatTime formats t as RFC 3339, leaving unset times empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -1,62 +1,456 @@
 package api
 
 import (
-	"encoding/base64"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/facturaIA/invoice-ocr-service/internal/ai"
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/buildinfo"
+	"github.com/facturaIA/invoice-ocr-service/internal/calibration"
+	"github.com/facturaIA/invoice-ocr-service/internal/catalog"
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/compress"
+	"github.com/facturaIA/invoice-ocr-service/internal/correct"
+	"github.com/facturaIA/invoice-ocr-service/internal/cors"
+	"github.com/facturaIA/invoice-ocr-service/internal/hooks"
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+	"github.com/facturaIA/invoice-ocr-service/internal/learning"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
 	"github.com/facturaIA/invoice-ocr-service/internal/models"
 	"github.com/facturaIA/invoice-ocr-service/internal/ocr"
+	"github.com/facturaIA/invoice-ocr-service/internal/offline"
+	"github.com/facturaIA/invoice-ocr-service/internal/queue"
+	"github.com/facturaIA/invoice-ocr-service/internal/ratelimit"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
+	"github.com/facturaIA/invoice-ocr-service/internal/registry"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+	"github.com/facturaIA/invoice-ocr-service/internal/residency"
+	"github.com/facturaIA/invoice-ocr-service/internal/rules"
+	"github.com/facturaIA/invoice-ocr-service/internal/scripts"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"github.com/facturaIA/invoice-ocr-service/internal/usage"
+	"github.com/facturaIA/invoice-ocr-service/internal/vies"
+	"github.com/facturaIA/invoice-ocr-service/internal/webhook"
+	"github.com/facturaIA/invoice-ocr-service/internal/webui"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
 	"github.com/gorilla/mux"
 )
 
-const (
-	MaxUploadSize = 10 * 1024 * 1024 // 10MB
-	Version       = "1.0.0"
-)
-
 // Handler handles HTTP requests for invoice processing
 type Handler struct {
-	config *models.Config
+	config     atomic.Pointer[models.Config]       // Swapped as a whole on reload
+	rules      atomic.Pointer[rules.Set]           // Compiled vendor rules of config, nil when there are none
+	scripts    atomic.Pointer[scripts.Set]         // Compiled script rules of config, nil when there are none
+	corrector  atomic.Pointer[correct.Corrector]   // OCR text correction of config, nil when disabled
+	residency  atomic.Pointer[residency.Policy]    // Data residency policy of config, nil when any provider is allowed
+	classifier atomic.Pointer[classify.Classifier] // Document classifier of config, nil when disabled
+	profiles   atomic.Pointer[classify.Profiles]   // Built-in and configured prompt profiles
+	catalog    atomic.Pointer[catalog.Catalog]     // Product catalog of config, nil when there is none
+	store      storage.Store                       // nil when storage is disabled
+	purger     *storage.Purger
+	calibrator *calibration.Calibrator // nil unless confidence calibration is enabled
+	learning   *learning.Store         // nil unless category learning is enabled
+	keys       *auth.KeyStore          // nil unless API key authentication is enabled
+	authn      []auth.Authenticator
+	cors       *cors.Policy                  // nil when CORS is disabled
+	offline    *offline.Guard                // nil unless offline mode is enabled
+	compress   *compress.Middleware          // nil when response compression is disabled
+	limiter    *ratelimit.Middleware         // nil when rate limiting is disabled
+	usage      *usage.Tracker                // nil when usage accounting is disabled
+	budget     *usage.Budget                 // nil when usage accounting is disabled
+	slots      *ratelimit.ConcurrencyLimiter // nil when processing concurrency is unlimited
+	memory     *ratelimit.MemoryLimiter      // nil when processing memory is unlimited
+	queue      queue.Queue                   // nil when async jobs are disabled
+	pool       *queue.Pool
+
+	tools     dependencyCache               // /health tool checks
+	readiness dependencyCache               // /ready dependency checks
+	providers providerHealth                // AI provider checks and last successes
+	models    modelCache                    // Provider model lists
+	selfTest  atomic.Pointer[ServiceStatus] // Last self-test result, nil when none was run or scheduled
+
+	webhooks *webhook.Dispatcher
+	vies     *vies.Client     // Used when vies.enabled, reloadable
+	registry *registry.Client // Used when registry.enabled, reloadable
+
+	shadowSlots chan struct{} // Bounds background shadow extractions
+	shadowRuns  sync.WaitGroup
 }
 
 // NewHandler creates a new API handler
-func NewHandler(config *models.Config) *Handler {
-	return &Handler{
-		config: config,
+func NewHandler(config *models.Config) (*Handler, error) {
+	err := validateTenants(config)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Handler{
+		webhooks:    webhook.NewDispatcher(),
+		vies:        vies.NewClient(),
+		registry:    registry.NewClient(),
+		shadowSlots: make(chan struct{}, max(config.AI.Shadow.MaxConcurrent, 1)),
+	}
+	h.config.Store(config)
+	if config.Health.SelfTest {
+		h.selfTest.Store(&ServiceStatus{Error: selfTestPending})
+	}
+
+	ruleSet, err := rules.Compile(config.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vendor rules: %w", err)
+	}
+	h.rules.Store(ruleSet)
+
+	scriptSet, err := scripts.Compile(config.Scripts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scripts: %w", err)
+	}
+	h.scripts.Store(scriptSet)
+
+	corrector, err := correct.Compile(config.OCR.Correction)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ocr.correction: %w", err)
+	}
+	h.corrector.Store(corrector)
+
+	policy, err := residency.ForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid residency: %w", err)
+	}
+	h.residency.Store(policy)
+
+	classifier, err := classify.Compile(config.Classifier)
+	if err != nil {
+		return nil, fmt.Errorf("invalid classifier: %w", err)
+	}
+	h.classifier.Store(classifier)
+
+	profiles, err := classify.CompileProfiles(config.Profiles)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profiles: %w", err)
+	}
+	h.profiles.Store(profiles)
+
+	products, err := catalog.Load(config.Catalog)
+	if err != nil {
+		return nil, fmt.Errorf("invalid catalog: %w", err)
+	}
+	h.catalog.Store(products)
+
+	h.offline, err = offline.Compile(config.Offline)
+	if err != nil {
+		return nil, fmt.Errorf("invalid offline: %w", err)
+	}
+
+	if config.Auth.Enabled {
+		mode := config.Auth.Mode
+		if mode == "" {
+			mode = "api_key"
+		}
+		if mode != "api_key" && mode != "jwt" && mode != "both" {
+			return nil, fmt.Errorf("unsupported auth mode: %s", mode)
+		}
+
+		if mode == "api_key" || mode == "both" {
+			keys, err := auth.NewKeyStore(config.Auth.APIKeys)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize authentication: %w", err)
+			}
+			h.keys = keys
+			h.authn = append(h.authn, keys)
+		}
+
+		if mode == "jwt" || mode == "both" {
+			validator, err := auth.NewJWTValidator(config.Auth.JWT)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize authentication: %w", err)
+			}
+			h.authn = append(h.authn, validator)
+		}
+	}
+
+	if config.CORS.Enabled {
+		h.cors = cors.New(config.CORS)
+	}
+
+	if config.Compression.Enabled {
+		h.compress = compress.New(config.Compression)
+	}
+
+	if config.RateLimit.Enabled {
+		h.limiter = ratelimit.NewMiddleware(config.RateLimit)
+	}
+
+	if config.Concurrency.MaxInFlight > 0 {
+		h.slots = ratelimit.NewConcurrencyLimiter(
+			config.Concurrency.MaxInFlight,
+			config.Concurrency.BatchMaxInFlight,
+			config.Concurrency.MaxQueue,
+			config.Concurrency.QueueTimeout,
+		)
+	}
+	if config.Concurrency.MemoryLimitMB > 0 {
+		h.memory = ratelimit.NewMemoryLimiter(int64(config.Concurrency.MemoryLimitMB)<<20, config.Concurrency.QueueTimeout)
+	}
+
+	if config.Usage.Enabled {
+		tracker, err := usage.NewTracker(config.Usage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize usage accounting: %w", err)
+		}
+		h.usage = tracker
+
+		budget, err := usage.NewBudget(config.Usage.Budget.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize budget: %w", err)
+		}
+		h.budget = budget
+	}
+
+	if config.Storage.Enabled {
+		var key []byte
+		if config.Storage.EncryptionKey != "" {
+			parsed, err := storage.ParseKey(config.Storage.EncryptionKey)
+			if err != nil {
+				return nil, err
+			}
+			key = parsed
+		}
+
+		store, err := storage.NewFileStore(config.Storage.Path, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		h.store = store
+
+		if config.Storage.ArtifactTTL > 0 {
+			h.purger = storage.NewPurger(h.store, config.Storage.ArtifactTTL, config.Storage.PurgeInterval)
+			h.purger.Start()
+		}
+		if config.Calibration.Enabled {
+			h.calibrator = calibration.NewCalibrator(h.store, config.Calibration)
+			h.calibrator.Start()
+		}
+		if config.CategoryLearning.Enabled {
+			h.learning, err = learning.NewStore(config.CategoryLearning)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize category learning: %w", err)
+			}
+		}
+	}
+
+	if config.Jobs.Enabled {
+		q, err := newQueue(config.Jobs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize job queue: %w", err)
+		}
+		h.queue = q
+		h.pool = queue.NewPool(q, h.runJob, config.Jobs.Workers, queue.RetryPolicy{
+			MaxAttempts: config.Jobs.MaxAttempts,
+			Backoff:     config.Jobs.RetryBackoff,
+			MaxBackoff:  config.Jobs.MaxBackoff,
+		}, config.Jobs.LeaseDuration)
+		h.pool.Start()
+	}
+
+	return h, nil
+}
+
+// Close stops background work started by the handler, waiting for running
+// jobs, webhook deliveries and shadow extractions until ctx expires, and
+// flushes the job queue
+func (h *Handler) Close(ctx context.Context) error {
+	if h.purger != nil {
+		h.purger.Stop()
+	}
+	if h.calibrator != nil {
+		h.calibrator.Stop()
+	}
+	if h.pool == nil {
+		return h.closeWebhooks(ctx)
+	}
+
+	stopErr := h.pool.Stop(ctx)
+	if stopErr != nil {
+		stopErr = fmt.Errorf("job workers did not stop in time: %w", stopErr)
+	}
+	err := h.queue.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close job queue: %w", err)
+	}
+	if stopErr != nil {
+		return stopErr
+	}
+	return h.closeWebhooks(ctx)
+}
+
+// closeWebhooks waits for pending webhook deliveries and shadow extractions
+// until ctx expires
+func (h *Handler) closeWebhooks(ctx context.Context) error {
+	err := h.webhooks.Close(ctx)
+	if err != nil {
+		return fmt.Errorf("webhook deliveries did not finish in time: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.shadowRuns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shadow extractions did not finish in time: %w", ctx.Err())
 	}
 }
 
 // SetupRoutes configures the HTTP routes
 func (h *Handler) SetupRoutes() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(tracing.Middleware(routeName))
+	router.Use(requestid.Middleware)
+	router.Use(logging.Middleware)
 
-	// Main endpoint
-	router.HandleFunc("/api/process-invoice", h.ProcessInvoice).Methods("POST")
+	// Browser preflights carry no credentials, so they are answered before
+	// authentication; registered first so OPTIONS never reaches the /api routes
+	if h.cors != nil {
+		router.Use(h.cors.Handler)
+		router.Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	if h.compress != nil {
+		router.Use(h.compress.Handler)
+	}
+
+	// Each API version registers its routes on its own subrouter. A breaking
+	// change ships as registerV2 on /api/v2 while /api/v1 keeps working.
+	h.registerV1(h.apiRouter(router, "/api/v1"))
+
+	// Unversioned paths are aliases of /api/v1 that announce their deprecation
+	if !h.cfg().API.DisableLegacyRoutes {
+		legacy := h.apiRouter(router, "/api")
+		legacy.Use(deprecated("/api", "/api/v1", h.cfg().API.LegacySunset))
+		h.registerV1(legacy)
+	}
 
 	// Health check
 	router.HandleFunc("/health", h.Health).Methods("GET")
+	router.HandleFunc("/live", h.Live).Methods("GET")
+	router.HandleFunc("/ready", h.Ready).Methods("GET")
+
+	// Review UI; its assets are public and it authenticates API calls itself
+	if h.cfg().UI.Enabled {
+		router.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently))
+		router.PathPrefix("/ui/").Handler(http.StripPrefix("/ui/", webui.Handler()))
+	}
 
 	return router
 }
 
+// apiRouter creates the subrouter of an API version. All its routes require
+// credentials when authentication is enabled.
+func (h *Handler) apiRouter(router *mux.Router, prefix string) *mux.Router {
+	api := router.PathPrefix(prefix).Subrouter()
+	if h.limiter != nil {
+		api.Use(h.limiter.IPHandler)
+	}
+	if len(h.authn) > 0 {
+		api.Use(auth.Middleware(h.authn...))
+	}
+	api.Use(h.requireTenant)
+	if h.limiter != nil {
+		api.Use(h.limiter.KeyHandler)
+	}
+	api.Use(h.withTimeout)
+	return api
+}
+
+// registerV1 registers the routes of API version 1
+func (h *Handler) registerV1(api *mux.Router) {
+	// Main endpoint
+	api.HandleFunc("/process-invoice", h.enforceQuota(h.limitConcurrency(h.ProcessInvoice))).Methods("POST")
+	api.HandleFunc("/process-invoice/stream", h.enforceQuota(h.limitConcurrency(h.ProcessInvoiceStream))).Methods("POST")
+	api.HandleFunc("/extract-text", h.enforceQuota(h.limitConcurrency(h.ExtractText))).Methods("POST")
+
+	// Stored invoices
+	api.HandleFunc("/stats", h.GetStats).Methods("GET")
+	api.HandleFunc("/expense-reports", h.CreateExpenseReport).Methods("POST")
+	api.HandleFunc("/reconcile", h.Reconcile).Methods("POST")
+	api.HandleFunc("/invoices/export", h.ExportInvoices).Methods("GET")
+	api.HandleFunc("/invoices/{id}/export", h.ExportInvoice).Methods("GET")
+	api.HandleFunc("/invoices", h.ListInvoices).Methods("GET")
+	api.HandleFunc("/invoices/{id}", h.GetInvoice).Methods("GET")
+	api.HandleFunc("/invoices/{id}", h.UpdateInvoice).Methods("PATCH")
+	api.HandleFunc("/invoices/{id}", h.DeleteInvoice).Methods("DELETE")
+	api.HandleFunc("/invoices/{id}/original", h.GetOriginal).Methods("GET")
+	api.HandleFunc("/invoices/{id}/push/{integration}", h.PushInvoice).Methods("POST")
+	api.HandleFunc("/invoices/{id}/approve", h.ApproveInvoice).Methods("POST")
+	api.HandleFunc("/invoices/{id}/reprocess", h.enforceQuota(h.limitConcurrency(h.ReprocessInvoice))).Methods("POST")
+
+	// Async jobs
+	api.HandleFunc("/jobs", h.enforceQuota(h.SubmitJob)).Methods("POST")
+	api.HandleFunc("/jobs", h.ListJobs).Methods("GET")
+	api.HandleFunc("/jobs/{id}", h.GetJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}/retry", h.enforceQuota(h.RetryJob)).Methods("POST")
+
+	// AI providers and models
+	api.HandleFunc("/providers", h.ListProviders).Methods("GET")
+
+	// Usage accounting
+	api.HandleFunc("/usage", h.GetUsage).Methods("GET")
+	api.HandleFunc("/budget", h.GetBudget).Methods("GET")
+
+	// Confidence calibration
+	api.HandleFunc("/calibration", h.GetCalibration).Methods("GET")
+
+	// Learned vendor categories
+	api.HandleFunc("/category-mappings", h.ListCategoryMappings).Methods("GET")
+	api.HandleFunc("/category-mappings/{vendor}", h.SetCategoryMapping).Methods("PUT")
+	api.HandleFunc("/category-mappings/{vendor}", h.DeleteCategoryMapping).Methods("DELETE")
+
+	// Build and feature information
+	api.HandleFunc("/version", h.GetVersion).Methods("GET")
+
+	// API key management
+	api.HandleFunc("/keys", h.ListKeys).Methods("GET")
+	api.HandleFunc("/keys", h.CreateKey).Methods("POST")
+	api.HandleFunc("/keys/{name}", h.RevokeKey).Methods("DELETE")
+}
+
 // HealthResponse represents the health check response structure
 type HealthResponse struct {
 	Status      string            `json:"status"`
 	Version     string            `json:"version"`
 	Timestamp   string            `json:"timestamp"`
+	CheckedAt   string            `json:"checkedAt"` // When the dependency checks last ran
 	Uptime      string            `json:"uptime"`
 	Memory      MemoryStats       `json:"memory"`
 	Tesseract   ServiceStatus     `json:"tesseract"`
 	ImageMagick ServiceStatus     `json:"imageMagick"`
 	AI          map[string]string `json:"ai"`
+
+	Providers map[string]ProviderStatus `json:"providers"`
+	Offline   *OfflineStatus            `json:"offline,omitempty"` // Only in offline mode
+
+	Build    buildinfo.Info `json:"build"`
+	Features []string       `json:"features"`
 }
 
 // MemoryStats represents memory usage statistics
@@ -66,6 +460,12 @@ type MemoryStats struct {
 	System    string `json:"system"`
 }
 
+// OfflineStatus reports whether the config keeps to offline mode
+type OfflineStatus struct {
+	Compliant  bool     `json:"compliant"`
+	Violations []string `json:"violations,omitempty"` // Settings needing a cloud service or a host that is not allowed
+}
+
 // ServiceStatus represents the status of a service dependency
 type ServiceStatus struct {
 	Available bool   `json:"available"`
@@ -78,22 +478,23 @@ var startTime = time.Now()
 // Health endpoint - enhanced for Railway monitoring
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	config := h.cfg()
 
 	// Memory statistics
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
-	// Check Tesseract
-	tesseractStatus := h.checkTesseract()
-
-	// Check ImageMagick
-	imageMagickStatus := h.checkImageMagick()
+	// Check Tesseract and ImageMagick, reusing recent results unless ?deep=true
+	tools, checkedAt := h.tools.get(h.checkTTL(), deepCheck(r), h.checkTools)
+	tesseractStatus := tools["tesseract"]
+	imageMagickStatus := tools["imageMagick"]
 
 	// Build response
 	response := HealthResponse{
 		Status:    "healthy",
-		Version:   Version,
+		Version:   buildinfo.Version,
 		Timestamp: time.Now().Format(time.RFC3339),
+		CheckedAt: checkedAt.Format(time.RFC3339),
 		Uptime:    time.Since(startTime).String(),
 		Memory: MemoryStats{
 			Allocated: fmt.Sprintf("%.2f MB", float64(m.Alloc)/1024/1024),
@@ -103,16 +504,28 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 		Tesseract:   tesseractStatus,
 		ImageMagick: imageMagickStatus,
 		AI: map[string]string{
-			"defaultProvider": h.config.AI.DefaultProvider,
-			"ocrEngine":       h.config.OCR.Engine,
+			"defaultProvider": config.AI.DefaultProvider,
+			"ocrEngine":       config.OCR.Engine,
 		},
+		Providers: h.providerStatuses(deepCheck(r)),
+		Build:     buildinfo.Get(),
+		Features:  enabledFeatures(config),
+	}
+	if h.offline != nil {
+		violations := h.offline.Violations(config)
+		response.Offline = &OfflineStatus{Compliant: len(violations) == 0, Violations: violations}
 	}
 
-	// If critical dependencies are down, mark as unhealthy
-	if !tesseractStatus.Available || !imageMagickStatus.Available {
+	// If critical dependencies are down, or cloud services are configured
+	// in offline mode, mark as unhealthy
+	if !tesseractStatus.Available || !imageMagickStatus.Available || (response.Offline != nil && !response.Offline.Compliant) {
 		response.Status = "degraded"
 		w.WriteHeader(http.StatusServiceUnavailable)
 	} else {
+		// A provider outage degrades extraction but must not fail the probe
+		if !response.Providers[config.AI.DefaultProvider].Available {
+			response.Status = "degraded"
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 
@@ -144,23 +557,22 @@ func (h *Handler) checkTesseract() ServiceStatus {
 	}
 }
 
-// checkImageMagick verifies ImageMagick is available
+// checkImageMagick verifies ImageMagick can read uploads: the linked library,
+// or with the magickcli build tag the magick (IM7) or convert (IM6) program
 func (h *Handler) checkImageMagick() ServiceStatus {
-	cmd := exec.Command("convert", "-version")
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
+	version := ocr.MagickVersion()
+	if version == "" {
 		return ServiceStatus{
 			Available: false,
-			Error:     "imagemagick not found or not executable",
+			Error:     "imagemagick not found",
 		}
 	}
-
-	// Parse version from output
-	version := "unknown"
-	lines := strings.Split(string(output), "\n")
-	if len(lines) > 0 {
-		version = strings.TrimSpace(lines[0])
+	if missing := ocr.MissingFormats(); len(missing) > 0 {
+		return ServiceStatus{
+			Available: false,
+			Version:   version,
+			Error:     "imagemagick cannot read " + strings.Join(missing, ", "),
+		}
 	}
 
 	return ServiceStatus{
@@ -175,170 +587,778 @@ func (h *Handler) ProcessInvoice(w http.ResponseWriter, r *http.Request) {
 
 	startTime := time.Now()
 
-	// Parse multipart form
-	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize)
-	err := r.ParseMultipartForm(MaxUploadSize)
+	imageData, header, ok := h.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+
+	// Get optional parameters
+	params, err := h.processParams(r, tenant)
+	if err != nil {
+		h.sendGenerationError(w, err)
+		return
+	}
+	fields, err := parseResponseFields(r)
+	if err != nil {
+		h.sendResponseFieldsError(w, err)
+		return
+	}
+	switch split, segment := r.FormValue("split") == "true", r.FormValue("segment") == "true"; {
+	case split && segment:
+		h.sendError(w, http.StatusBadRequest, "split and segment cannot be combined")
+		return
+	case split:
+		h.processSplit(w, r, pipeline.ProcessDocuments, tenant, imageData, header, params, fields, startTime)
+		return
+	case segment:
+		h.processSplit(w, r, pipeline.ProcessReceipts, tenant, imageData, header, params, fields, startTime)
+		return
+	}
+
+	// Process invoice
+	result, err := h.processInvoice(r.Context(), tenant, imageData, params, nil)
+	h.recordUsage(r, result.Usage)
+
+	totalDuration := time.Since(startTime).Seconds()
+
+	if err != nil {
+		h.sendFailure(w, r, err, result, params.RedactPII, fields, totalDuration)
+		return
+	}
+	invoice := result.Invoice
+
+	if params.RedactPII {
+		invoice.RawText = redact.Text(invoice.RawText)
+	}
+
+	// Archive invoice and original image for later reprocessing
+	err = h.archiveInvoice(r.Context(), tenant, params, header.Filename, header.Header.Get("Content-Type"), result, totalDuration, imageData)
 	if err != nil {
-		h.sendError(w, http.StatusBadRequest, "File too large or invalid form data")
+		h.sendError(w, http.StatusInternalServerError, "Failed to store invoice")
 		return
 	}
 
-	// Get file
+	// Success response
+	response := models.ProcessResponse{
+		Success:       true,
+		Invoice:       invoice,
+		OCRDuration:   result.OCRDuration,
+		AIDuration:    result.AIDuration,
+		TotalDuration: totalDuration,
+		Usage:         &result.Usage,
+		Diagnostics:   result.Diagnostics,
+		RequestID:     requestid.FromContext(r.Context()),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(fields.apply(response))
+}
+
+// readUpload parses the multipart form and reads the uploaded "file",
+// writing an error response on failure. JSON bodies are read by readJSONUpload.
+func (h *Handler) readUpload(w http.ResponseWriter, r *http.Request) ([]byte, *multipart.FileHeader, bool) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		return h.readJSONUpload(w, r)
+	}
+
+	// Files above the spool threshold go to a temp file while the body is
+	// read, so slow clients do not hold memory; the server removes it
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize())
+	err := r.ParseMultipartForm(int64(h.cfg().Uploads.SpoolThresholdKB) << 10)
+	if err != nil {
+		h.sendFormError(w, err)
+		return nil, nil, false
+	}
+
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		h.sendError(w, http.StatusBadRequest, "No file provided")
-		return
+		return nil, nil, false
 	}
 	defer file.Close()
 
-	// Read file bytes
-	imageData, err := io.ReadAll(file)
-	if err != nil {
+	head := make([]byte, min(header.Size, sniffLen))
+	if _, err := io.ReadFull(file, head); err != nil {
 		h.sendError(w, http.StatusInternalServerError, "Failed to read file")
+		return nil, nil, false
+	}
+	if e := h.checkUpload(head, header.Size, header.Header.Get("Content-Type")); e != nil {
+		h.sendUploadError(w, e)
+		return nil, nil, false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to read file")
+		return nil, nil, false
+	}
+	if !h.reserveMemory(w, r, imagedata.EstimateMemory(file, header.Size)) {
+		return nil, nil, false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to read file")
+		return nil, nil, false
+	}
+	imageData := make([]byte, header.Size)
+	if _, err := io.ReadFull(file, imageData); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to read file")
+		return nil, nil, false
+	}
+
+	return imageData, header, true
+}
+
+// readJSONUpload reads an upload sent as a JSON object, for clients that
+// cannot build multipart requests. "image" holds the image as base64 or a data
+// URI and "filename" optionally names it; the other fields are the form
+// parameters, e.g. "aiProvider" or "temperature", and are read as such.
+func (h *Handler) readJSONUpload(w http.ResponseWriter, r *http.Request) ([]byte, *multipart.FileHeader, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxJSONUploadSize())
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.sendFormError(w, err)
+			return nil, nil, false
+		}
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body")
+		return nil, nil, false
+	}
+
+	var image, filename string
+	if err := json.Unmarshal(body["image"], &image); err != nil || image == "" {
+		h.sendError(w, http.StatusBadRequest, "No image provided")
+		return nil, nil, false
+	}
+	if raw, ok := body["filename"]; ok {
+		if err := json.Unmarshal(raw, &filename); err != nil {
+			h.sendError(w, http.StatusBadRequest, "filename must be a string")
+			return nil, nil, false
+		}
+	}
+	imageData, mimeType, err := imagedata.Decode(image)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid image: "+err.Error())
+		return nil, nil, false
+	}
+	var declared string
+	if uri, ok := strings.CutPrefix(image, "data:"); ok {
+		declared, _, _ = strings.Cut(uri, ",")
+		declared, _, _ = strings.Cut(declared, ";")
+	}
+	if e := h.checkUpload(imageData[:min(len(imageData), sniffLen)], int64(len(imageData)), declared); e != nil {
+		h.sendUploadError(w, e)
+		return nil, nil, false
+	}
+	if !h.reserveMemory(w, r, imagedata.EstimateMemory(bytes.NewReader(imageData), int64(len(imageData)))) {
+		return nil, nil, false
+	}
+
+	// Parameters go where r.FormValue finds them; query parameters still apply
+	form := r.URL.Query()
+	for name, raw := range body {
+		if name == "image" || name == "filename" {
+			continue
+		}
+		var value string
+		if json.Unmarshal(raw, &value) != nil {
+			value = string(raw) // Numbers, booleans and the options object
+		}
+		form.Set(name, value)
+	}
+	r.Form = form
+
+	header := &multipart.FileHeader{
+		Filename: filename,
+		Size:     int64(len(imageData)),
+		Header:   textproto.MIMEHeader{"Content-Type": {mimeType}},
+	}
+	return imageData, header, true
+}
+
+// processParams reads the optional processing parameters of a request. It
+// fails only on invalid generation parameters.
+func (h *Handler) processParams(r *http.Request, tenant *tenantSettings) (models.ProcessRequest, error) {
+	generation, err := generationParams(r)
+	if err != nil {
+		return models.ProcessRequest{}, err
+	}
+
+	params := h.withDefaults(models.ProcessRequest{
+		UseVisionModel: r.FormValue("useVisionModel") == "true",
+		AIProvider:     r.FormValue("aiProvider"),
+		Model:          r.FormValue("model"),
+		Language:       r.FormValue("language"),
+		RedactPII:      r.FormValue("redactPII") == "true",
+		Profile:        r.FormValue("profile"),
+		Generation:     generation,
+	}, tenant)
+	return params, checkGeneration(params)
+}
+
+// withDefaults fills in the provider and language a request left empty
+func (h *Handler) withDefaults(params models.ProcessRequest, tenant *tenantSettings) models.ProcessRequest {
+	if params.AIProvider == "" {
+		params.AIProvider = tenant.AI.DefaultProvider
+	}
+	if params.Language == "" {
+		params.Language = h.cfg().OCR.Language
+	}
+	return params
+}
+
+// archiveInvoice stores a processed invoice with its original image when
+// storage is enabled, and announces it by email, to auto-push integrations and
+// to webhooks
+func (h *Handler) archiveInvoice(
+	ctx context.Context,
+	tenant *tenantSettings,
+	params models.ProcessRequest,
+	filename string,
+	contentType string,
+	result *processResult,
+	totalDuration float64,
+	imageData []byte,
+) error {
+	if h.cfg().EXIF.Strip {
+		// Text from /extract-text and PDFs are kept as they are
+		stripped, err := ocr.StripMetadata(imageData)
+		if err != nil {
+			return fmt.Errorf("failed to strip image metadata: %w", err)
+		}
+		imageData = stripped
+	}
+
+	now := time.Now()
+	record := &models.StoredInvoice{
+		TenantID:        tenant.ID,
+		Filename:        filename,
+		ContentType:     contentType,
+		AIProvider:      params.AIProvider,
+		Model:           params.Model,
+		Language:        params.Language,
+		UseVisionModel:  params.UseVisionModel,
+		RedactPII:       params.RedactPII,
+		Profile:         params.Profile,
+		Generation:      params.Generation,
+		RequestID:       requestid.FromContext(ctx),
+		OCRDuration:     result.OCRDuration,
+		AIDuration:      result.AIDuration,
+		TotalDuration:   totalDuration,
+		Invoice:         result.Invoice,
+		Pages:           result.Pages,
+		Region:          result.Region,
+		OriginalTrimmed: len(result.Pages) > 0 || result.Region != nil,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if h.store == nil {
+		h.mailResult(ctx, tenant, record, imageData)
+		h.notify(tenant, nil, result.Invoice)
+		return nil
+	}
+
+	record.ID = storage.NewID()
+	result.Invoice.ID = record.ID
+	h.checkMonthlyLimits(ctx, tenant, record)
+
+	err := h.store.Save(record, imageData)
+	if err != nil {
+		return err
+	}
+	h.mailResult(ctx, tenant, record, imageData)
+	h.autoPush(ctx, tenant, record.ID)
+	h.notify(tenant, record, record.Invoice)
+	return nil
+}
+
+// ReprocessInvoice re-runs extraction on the archived original image of a stored invoice
+func (h *Handler) ReprocessInvoice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	startTime := time.Now()
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
 		return
 	}
 
-	// Get optional parameters
-	useVisionModel := r.FormValue("useVisionModel") == "true"
+	tenant := h.resolveTenant(r)
+
+	id := mux.Vars(r)["id"]
+	record, ok := h.loadInvoice(w, tenant, id)
+	if !ok {
+		return
+	}
+
+	imageData, err := h.store.GetOriginal(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendError(w, http.StatusGone, "Original image has been purged by the retention policy")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to load original image")
+		return
+	}
+	if !h.reserveMemory(w, r, imagedata.EstimateMemory(bytes.NewReader(imageData), int64(len(imageData)))) {
+		return
+	}
+
+	// Overrides default to the parameters of the previous extraction
 	aiProvider := r.FormValue("aiProvider")
 	if aiProvider == "" {
-		aiProvider = h.config.AI.DefaultProvider
+		aiProvider = record.AIProvider
 	}
-
 	model := r.FormValue("model")
+	if model == "" && aiProvider == record.AIProvider {
+		model = record.Model
+	}
 	language := r.FormValue("language")
 	if language == "" {
-		language = h.config.OCR.Language
+		language = record.Language
+	}
+	useVisionModel := record.UseVisionModel
+	if v := r.FormValue("useVisionModel"); v != "" {
+		useVisionModel = v == "true"
+	}
+	redactPII := record.RedactPII
+	if v := r.FormValue("redactPII"); v != "" {
+		redactPII = v == "true"
+	}
+	profile := r.FormValue("profile")
+	if profile == "" {
+		profile = record.Profile
+	}
+	generation, err := generationParams(r)
+	if err != nil {
+		h.sendGenerationError(w, err)
+		return
+	}
+	if generation == nil && aiProvider == record.AIProvider {
+		generation = record.Generation
+	}
+	params := models.ProcessRequest{
+		UseVisionModel: useVisionModel,
+		AIProvider:     aiProvider,
+		Model:          model,
+		Language:       language,
+		RedactPII:      redactPII,
+		Profile:        profile,
+		Generation:     generation,
+	}
+	if err := checkGeneration(params); err != nil {
+		h.sendGenerationError(w, err)
+		return
+	}
+	fields, err := parseResponseFields(r)
+	if err != nil {
+		h.sendResponseFieldsError(w, err)
+		return
 	}
 
-	// Process invoice
-	invoice, ocrDuration, aiDuration, err := h.processInvoice(
-		imageData,
-		useVisionModel,
-		aiProvider,
-		model,
-		language,
-	)
+	var result *processResult
+	if record.ContentType == textContentType {
+		// Submitted through /extract-text: the original is the text
+		result, err = h.extractText(r.Context(), tenant, string(imageData), params)
+	} else if len(record.Pages) > 0 && !record.OriginalTrimmed {
+		// Found in a split upload stored whole: only its pages are extracted again
+		result, err = h.processPages(r.Context(), tenant, imageData, record.Pages, params)
+	} else if record.Region != nil && !record.OriginalTrimmed {
+		// Found in a segmented photo stored whole: only its area is extracted again
+		result, err = h.processRegion(r.Context(), tenant, imageData, *record.Region, params)
+	} else {
+		result, err = h.processInvoice(r.Context(), tenant, imageData, params, nil)
+	}
+	h.recordUsage(r, result.Usage)
 
 	totalDuration := time.Since(startTime).Seconds()
 
 	if err != nil {
-		response := models.ProcessResponse{
-			Success:       false,
-			Error:         err.Error(),
-			TotalDuration: totalDuration,
-		}
-		w.WriteHeader(http.StatusOK) // Still return 200 with error in body
-		json.NewEncoder(w).Encode(response)
+		h.sendFailure(w, r, err, result, redactPII, fields, totalDuration)
 		return
 	}
+	invoice := result.Invoice
+
+	if redactPII {
+		invoice.RawText = redact.Text(invoice.RawText)
+	}
+
+	// Replace the stored extraction, keeping the original upload
+	invoice.ID = record.ID
+	invoice.TenantID = record.TenantID
+	if invoice.Photo == nil && record.Invoice != nil {
+		// Captured from the upload, before exif.strip removed it from the original
+		invoice.Photo = record.Invoice.Photo
+	}
+	record.Invoice = invoice
+	record.AIProvider = aiProvider
+	record.Model = model
+	record.Language = language
+	record.UseVisionModel = useVisionModel
+	record.RedactPII = redactPII
+	record.Profile = profile
+	record.Generation = generation
+	record.OCRDuration = result.OCRDuration
+	record.AIDuration = result.AIDuration
+	record.TotalDuration = totalDuration
+	record.RequestID = requestid.FromContext(r.Context())
+	record.UpdatedAt = time.Now()
+	record.Reprocessed++
+	record.CorrectedAt = nil // The corrections were replaced
+	record.CorrectedFields = nil
+	h.checkMonthlyLimits(r.Context(), tenant, record)
+
+	err = h.store.Update(record)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to store invoice")
+		return
+	}
+	h.notify(tenant, record, invoice)
 
-	// Success response
 	response := models.ProcessResponse{
 		Success:       true,
 		Invoice:       invoice,
-		OCRDuration:   ocrDuration,
-		AIDuration:    aiDuration,
+		OCRDuration:   result.OCRDuration,
+		AIDuration:    result.AIDuration,
 		TotalDuration: totalDuration,
+		Usage:         &result.Usage,
+		Diagnostics:   result.Diagnostics,
+		RequestID:     requestid.FromContext(r.Context()),
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(fields.apply(response))
 }
 
-// processInvoice performs the actual processing
-func (h *Handler) processInvoice(
-	imageData []byte,
-	useVisionModel bool,
-	providerName string,
-	modelName string,
-	language string,
-) (*models.Invoice, float64, float64, error) {
-	var ocrText string
-	var ocrDuration float64
-	var imageBase64 string
-
-	// Step 1: Preprocess image
-	preprocessor := ocr.NewPreprocessor(h.config.OCR.Engine == "easyocr")
-	processedImage, err := preprocessor.PreprocessImageFromBytes(imageData)
-	if err != nil {
-		return nil, 0, 0, fmt.Errorf("image preprocessing failed: %w", err)
+// DeleteInvoice hard-deletes a stored invoice and all of its artifacts
+func (h *Handler) DeleteInvoice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
 	}
 
-	// Step 2: OCR or prepare image for vision model
-	if useVisionModel {
-		// Convert to base64 for vision models
-		imageBase64 = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(processedImage)
-	} else {
-		// Perform OCR
-		tesseract := ocr.NewTesseractOCR(language)
-		text, duration, err := tesseract.ExtractText(processedImage)
-		if err != nil {
-			return nil, 0, 0, fmt.Errorf("OCR failed: %w", err)
+	id := mux.Vars(r)["id"]
+	if _, ok := h.loadInvoice(w, h.resolveTenant(r), id); !ok {
+		return
+	}
+
+	err := h.store.Delete(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendError(w, http.StatusNotFound, "Invoice not found")
+			return
 		}
-		ocrText = text
-		ocrDuration = duration
+		h.sendError(w, http.StatusInternalServerError, "Failed to delete invoice")
+		return
 	}
 
-	// Step 3: Create AI provider
-	provider, err := h.createProvider(providerName, modelName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadInvoice fetches a stored invoice visible to the tenant, writing an error response on failure
+func (h *Handler) loadInvoice(w http.ResponseWriter, tenant *tenantSettings, id string) (*models.StoredInvoice, bool) {
+	record, err := h.store.Get(id)
 	if err != nil {
-		return nil, ocrDuration, 0, err
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendError(w, http.StatusNotFound, "Invoice not found")
+			return nil, false
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to load invoice")
+		return nil, false
+	}
+
+	// Invoices of other tenants are reported as missing
+	if record.TenantID != tenant.ID {
+		h.sendError(w, http.StatusNotFound, "Invoice not found")
+		return nil, false
+	}
+
+	return record, true
+}
+
+// processResult holds the outcome of a processing run
+type processResult struct {
+	Invoice     *models.Invoice
+	RawText     string // OCR text, kept for partial results
+	OCRDuration float64
+	AIDuration  float64
+	Usage       models.Usage
+	Pages       []int          // Pages of a split upload, nil for whole uploads
+	Region      *models.Region // Area of a segmented photo, nil for whole uploads
+	Diagnostics *models.Diagnostics
+}
+
+// processInvoice runs the pipeline with the tenant's settings. progress, if
+// not nil, receives the stage events of the run.
+func (h *Handler) processInvoice(
+	ctx context.Context,
+	tenant *tenantSettings,
+	imageData []byte,
+	params models.ProcessRequest,
+	progress func(pipeline.Event),
+) (*processResult, error) {
+	options := h.pipelineOptions(tenant, params)
+	options.Language = params.Language
+	options.UseVisionModel = params.UseVisionModel
+	options.Progress = progress
+
+	invoice, stats, err := pipeline.Process(ctx, imageData, options)
+	if err == nil {
+		h.shadow(ctx, options, stats, invoice, imageData)
+	}
+	return h.runResult(ctx, tenant, invoice, stats, err, params.UseVisionModel)
+}
+
+// extractText runs only the AI stage on text that was OCR'd elsewhere
+func (h *Handler) extractText(ctx context.Context, tenant *tenantSettings, text string, params models.ProcessRequest) (*processResult, error) {
+	options := h.pipelineOptions(tenant, params)
+	invoice, stats, err := pipeline.ExtractText(ctx, text, options)
+	if err == nil {
+		h.shadow(ctx, options, stats, invoice, nil)
 	}
+	return h.runResult(ctx, tenant, invoice, stats, err, false)
+}
+
+// pipelineOptions returns the pipeline options of a run with the tenant's settings
+func (h *Handler) pipelineOptions(tenant *tenantSettings, params models.ProcessRequest) pipeline.Options {
+	config := h.cfg()
+	options := pipeline.Options{
+		AI:         tenant.AI,
+		Provider:   params.AIProvider,
+		Model:      params.Model,
+		OCREngine:  config.OCR.Engine,
+		Categories: tenant.Categories,
+		Prompt:     tenant.Prompt,
+		AITimeout:  config.Timeouts.AI,
+		Rules:      h.rules.Load(),
+		Correction: h.corrector.Load(),
+		Residency:  h.residency.Load(),
+		Classifier: h.classifier.Load(),
+		Profiles:   h.profiles.Load(),
+		Profile:    params.Profile,
+		Catalog:    h.catalog.Load(),
+		Hooks:      append(pipeline.RegisteredHooks(), hooks.FromConfig(config.Hooks)...),
+
+		PageParallelism:  config.OCR.PageParallelism,
+		LanguageFallback: config.OCR.LanguageFallback,
+		OCRRetry:         config.OCR.Retry,
+		Handwriting:      config.OCR.Handwriting,
+		CapturePhoto:     config.EXIF.Capture,
+		StripMetadata:    config.EXIF.Strip,
+	}
+	if scriptSet := h.scripts.Load(); scriptSet != nil {
+		options.Hooks = append(options.Hooks, scriptSet)
+	}
+	if params.Generation != nil {
+		options.Generation = *params.Generation
+	}
+	h.applyBudgetFallback(&options)
+	return options
+}
 
-	// Step 4: Extract data with AI
-	extractor := ai.NewExtractor(provider, h.config.Categories)
-	invoice, aiDuration, err := extractor.Extract(ocrText, imageBase64)
+// runResult converts the outcome of a pipeline run, pricing its tokens and
+// recording a successful provider call
+func (h *Handler) runResult(ctx context.Context, tenant *tenantSettings, invoice *models.Invoice, stats pipeline.Stats, err error, vision bool) (*processResult, error) {
+	result := &processResult{
+		Invoice:     invoice,
+		RawText:     stats.RawText,
+		OCRDuration: stats.OCRDuration,
+		AIDuration:  stats.AIDuration,
+		Usage:       stats.Usage,
+		Diagnostics: diagnostics(stats),
+	}
+	if h.usage != nil {
+		result.Usage.EstimatedCost = h.usage.EstimateCost(stats.Provider, stats.Model, stats.Usage.PromptTokens, stats.Usage.CompletionTokens)
+		h.recordSpend(result.Usage.EstimatedCost)
+	}
 	if err != nil {
-		return nil, ocrDuration, 0, fmt.Errorf("AI extraction failed: %w", err)
+		return result, err
+	}
+	invoice.TenantID = tenant.ID
+	h.checkVendor(ctx, tenant, invoice, stats.RawText)
+	logger := logging.FromContext(ctx)
+	if stats.RuleBypass {
+		logger.Info("invoice processed by vendor rule", "rule", stats.Rule, "ocr_duration", result.OCRDuration)
+		return result, nil
+	}
+	h.providers.recordSuccess(stats.Provider)
+	invoice.Provider = stats.Provider
+	h.applyLearning(tenant, invoice)
+	h.calibrate(invoice)
+	if len(stats.RuleMismatch) > 0 {
+		logger.Warn("extraction disagrees with vendor rule", "rule", stats.Rule, "fields", stats.RuleMismatch)
+	}
+
+	logger.Info("invoice processed",
+		"provider", stats.Provider,
+		"model", stats.Model,
+		"vision", vision,
+		"language", stats.Language,
+		"ocr_confidence", stats.OCRConfidence,
+		"ocr_attempts", stats.OCRAttempts,
+		"ocr_strategy", stats.OCRStrategy,
+		"handwriting", stats.Handwriting,
+		"rule", stats.Rule,
+		"ocr_duration", result.OCRDuration,
+		"ai_duration", result.AIDuration,
+		"prompt_tokens", result.Usage.PromptTokens,
+		"completion_tokens", result.Usage.CompletionTokens,
+	)
+
+	return result, nil
+}
+
+// diagnostics returns the diagnostics of a pipeline run
+func diagnostics(stats pipeline.Stats) *models.Diagnostics {
+	d := &models.Diagnostics{
+		PreprocessDuration: stats.PreprocessDuration,
+		OCRLanguage:        stats.Language,
+		OCRConfidence:      stats.OCRConfidence,
+		OCRStrategy:        stats.OCRStrategy,
+		Handwriting:        stats.Handwriting,
+		Provider:           stats.Provider,
+		Model:              stats.Model,
+		PromptTokens:       stats.Usage.PromptTokens,
+		CompletionTokens:   stats.Usage.CompletionTokens,
+		Rule:               stats.Rule,
+		RuleBypass:         stats.RuleBypass,
+	}
+	if stats.ImageSize != (pipeline.ImageSize{}) {
+		d.ImageSize = &stats.ImageSize
+	}
+	if stats.ProcessedSize != (pipeline.ImageSize{}) {
+		d.ProcessedImageSize = &stats.ProcessedSize
+	}
+	if stats.OCRAttempts > 0 {
+		// Preprocessing only serves Tesseract; ocr.engine easyocr scales the image for it
+		d.OCREngine = "tesseract"
+		d.OCRRetries = stats.OCRAttempts - stats.Usage.Pages
+	}
+	return d
+}
+
+// providerResponseLength is the number of characters of an unparseable AI
+// response included in failure responses
+const providerResponseLength = 500
+
+// failureResponse builds the response of a failed processing run. The stage
+// and the OCR text are included so clients can retry only the AI step.
+func (h *Handler) failureResponse(err error, result *processResult, redactPII bool, totalDuration float64) models.ProcessResponse {
+	response := models.ProcessResponse{
+		SchemaVersion: models.SchemaV1,
+		Success:       false,
+		Error:         err.Error(),
+		RawText:       result.RawText,
+		OCRDuration:   result.OCRDuration,
+		TotalDuration: totalDuration,
+		Diagnostics:   result.Diagnostics,
+	}
+
+	var se *pipeline.StageError
+	if errors.As(err, &se) {
+		response.Stage = se.Stage
+	}
+	var pe *pipeline.ParseError
+	if errors.As(err, &pe) {
+		response.ProviderResponse = preview(pe.Response, providerResponseLength)
 	}
+	var le *pipeline.LanguageError
+	if errors.As(err, &le) {
+		response.InstalledLanguages = le.Installed
+	}
+	_, response.Code = classifyError(err)
+	if response.Code == CodeTimeout {
+		response.Error = "timeout"
+	}
+	if redactPII {
+		response.RawText = redact.Text(response.RawText)
+		response.ProviderResponse = redact.Text(response.ProviderResponse)
+	}
+
+	return response
+}
+
+// withTimeout bounds each /api request by the timeout configured for its
+// route, falling back to the default timeout. Legacy and /api/v1 paths of a
+// route share its timeout.
+func (h *Handler) withTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts := h.cfg().Timeouts
+		timeout := timeouts.Default
+		route := canonicalRoute(routeName(r))
+		for pattern, t := range timeouts.Endpoints {
+			if canonicalRoute(pattern) == route {
+				timeout = t
+				break
+			}
+		}
+
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-	return invoice, ocrDuration, aiDuration, nil
+// routeName returns the path template of the matched route, keeping span
+// names low-cardinality
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
 }
 
-// createProvider creates the appropriate AI provider
-func (h *Handler) createProvider(providerName, modelName string) (ai.Provider, error) {
-	switch providerName {
-	case "openai":
-		model := modelName
-		if model == "" {
-			model = h.config.AI.OpenAI.Model
+// limitConcurrency holds a processing slot for the duration of the request,
+// returning 503 with Retry-After when the server is saturated. Requests wait
+// in the interactive lane unless X-Priority says batch. Memory the request
+// reserves with reserveMemory is released when it ends.
+func (h *Handler) limitConcurrency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		priority, err := requestPriority(r, ratelimit.PriorityInteractive)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			h.sendError(w, http.StatusBadRequest, err.Error())
+			return
 		}
-		return ai.NewOpenAIProvider(
-			h.config.AI.OpenAI.APIKey,
-			h.config.AI.OpenAI.BaseURL,
-			model,
-		), nil
-
-	case "gemini":
-		model := modelName
-		if model == "" {
-			model = h.config.AI.Gemini.Model
+		r = r.WithContext(ratelimit.WithPriority(r.Context(), priority))
+
+		if h.memory != nil {
+			account := &memoryAccount{}
+			defer account.release()
+			r = r.WithContext(context.WithValue(r.Context(), memoryAccountKey{}, account))
 		}
-		return ai.NewGeminiProvider(
-			h.config.AI.Gemini.APIKey,
-			model,
-		), nil
-
-	case "ollama":
-		model := modelName
-		if model == "" {
-			model = h.config.AI.Ollama.Model
+		if h.slots == nil {
+			next(w, r)
+			return
 		}
-		return ai.NewOllamaProvider(
-			h.config.AI.Ollama.BaseURL,
-			model,
-		), nil
 
-	default:
-		return nil, fmt.Errorf("unsupported AI provider: %s", providerName)
+		release, err := h.slots.Acquire(r.Context())
+		if err != nil {
+			h.sendBusy(w)
+			return
+		}
+		defer release()
+
+		next(w, r)
 	}
 }
 
-// sendError sends an error response
-func (h *Handler) sendError(w http.ResponseWriter, statusCode int, message string) {
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(map[string]string{
-		"error": message,
-	})
+// sendBusy answers 503 with Retry-After
+func (h *Handler) sendBusy(w http.ResponseWriter) {
+	retryAfter := h.cfg().Concurrency.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = 5 * time.Second
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+	h.sendError(w, http.StatusServiceUnavailable, "Server is busy, retry later")
 }
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ai"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// defaultCheckTTL is how long dependency checks are reused between probes
+const defaultCheckTTL = 30 * time.Second
+
+// ReadyResponse represents the readiness probe response
+type ReadyResponse struct {
+	Status    string                   `json:"status"`
+	CheckedAt string                   `json:"checkedAt"`
+	Checks    map[string]ServiceStatus `json:"checks"`
+}
+
+// dependencyCache reuses dependency check results until they expire
+type dependencyCache struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	checks    map[string]ServiceStatus
+}
+
+// get returns the cached checks, running check when they are older than ttl
+// or force is set
+func (c *dependencyCache) get(ttl time.Duration, force bool, check func() map[string]ServiceStatus) (map[string]ServiceStatus, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if force || c.checks == nil || time.Since(c.checkedAt) >= ttl {
+		c.checks = check()
+		c.checkedAt = time.Now()
+	}
+	return c.checks, c.checkedAt
+}
+
+// invalidate forces the next get to re-run the checks
+func (c *dependencyCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = nil
+}
+
+// Live reports that the process is up. It checks no dependencies, so an
+// orchestrator never restarts the service because of an external outage.
+func (h *Handler) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "alive",
+		"uptime": time.Since(startTime).String(),
+	})
+}
+
+// Ready reports whether the service can process invoices: Tesseract,
+// ImageMagick, the default AI provider and the job queue must be reachable,
+// the startup self-test, if any, must have passed, and in offline mode no
+// cloud service may be configured
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	deep := deepCheck(r)
+	checks, checkedAt := h.readiness.get(h.checkTTL(), deep, func() map[string]ServiceStatus {
+		return h.checkDependencies(deep)
+	})
+
+	response := ReadyResponse{
+		Status:    "ready",
+		CheckedAt: checkedAt.Format(time.RFC3339),
+		Checks:    checks,
+	}
+	statusCode := http.StatusOK
+	for _, check := range checks {
+		if !check.Available {
+			response.Status = "not_ready"
+			statusCode = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkTTL returns how long dependency check results are cached
+func (h *Handler) checkTTL() time.Duration {
+	if ttl := h.cfg().Health.CacheTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultCheckTTL
+}
+
+// deepCheck reports whether the probe asked to bypass cached results with ?deep=true
+func deepCheck(r *http.Request) bool {
+	return r.URL.Query().Get("deep") == "true"
+}
+
+// checkTools runs the local tool checks reported by /health
+func (h *Handler) checkTools() map[string]ServiceStatus {
+	return map[string]ServiceStatus{
+		"tesseract":   h.checkTesseract(),
+		"imageMagick": h.checkImageMagick(),
+	}
+}
+
+// checkDependencies runs the deep readiness checks
+func (h *Handler) checkDependencies(force bool) map[string]ServiceStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	checks := h.checkTools()
+
+	name := h.cfg().AI.DefaultProvider
+	provider := h.providerStatuses(force)[name]
+	checks["provider:"+name] = ServiceStatus{Available: provider.Available, Error: provider.Error}
+
+	if h.queue != nil {
+		status := ServiceStatus{Available: true}
+		if err := h.queue.Ping(ctx); err != nil {
+			status = ServiceStatus{Available: false, Error: err.Error()}
+		}
+		checks["queue"] = status
+	}
+
+	if status := h.selfTest.Load(); status != nil {
+		checks["selftest"] = *status
+	}
+
+	if h.offline != nil {
+		status := ServiceStatus{Available: true}
+		if violations := h.offline.Violations(h.cfg()); len(violations) > 0 {
+			status = ServiceStatus{Available: false, Error: strings.Join(violations, "; ")}
+		}
+		checks["offline"] = status
+	}
+
+	return checks
+}
+
+// ProviderStatus represents the health of an AI provider
+type ProviderStatus struct {
+	Available   bool           `json:"available"`
+	Default     bool           `json:"default,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	CheckedAt   *time.Time     `json:"checkedAt,omitempty"`
+	LastSuccess *time.Time     `json:"lastSuccess,omitempty"` // Last successful check or extraction
+	Model       *ai.ModelState `json:"model,omitempty"`       // Configured model, for providers serving their own (Ollama)
+}
+
+// providerHealth tracks provider check results and the last success of each provider
+type providerHealth struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	statuses  map[string]*ProviderStatus
+}
+
+// status returns the tracked status of a provider, creating it if needed.
+// Callers must hold p.mu.
+func (p *providerHealth) status(name string) *ProviderStatus {
+	if p.statuses == nil {
+		p.statuses = make(map[string]*ProviderStatus)
+	}
+	status, ok := p.statuses[name]
+	if !ok {
+		status = &ProviderStatus{}
+		p.statuses[name] = status
+	}
+	return status
+}
+
+// recordSuccess marks a provider as working, e.g. after a successful extraction
+func (p *providerHealth) recordSuccess(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	status := p.status(name)
+	status.Available = true
+	status.Error = ""
+	status.LastSuccess = &now
+}
+
+// invalidate forces the next get to re-run the provider checks
+func (p *providerHealth) invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checkedAt = time.Time{}
+}
+
+// get returns the status of the named providers, re-running check when the
+// results are older than ttl or force is set. check may return the state of
+// the provider's model along with its error. Checks run in parallel and
+// outside the lock, so recording successes never waits on the network.
+func (p *providerHealth) get(ttl time.Duration, force bool, names []string, check func(name string) (*ai.ModelState, error)) map[string]ProviderStatus {
+	p.mu.Lock()
+	stale := force || p.checkedAt.IsZero() || time.Since(p.checkedAt) >= ttl
+	p.mu.Unlock()
+
+	if stale {
+		errs := make([]error, len(names))
+		states := make([]*ai.ModelState, len(names))
+		var wg sync.WaitGroup
+		for i, name := range names {
+			wg.Add(1)
+			go func(i int, name string) {
+				defer wg.Done()
+				states[i], errs[i] = check(name)
+			}(i, name)
+		}
+		wg.Wait()
+
+		now := time.Now()
+		p.mu.Lock()
+		p.checkedAt = now
+		for i, name := range names {
+			status := p.status(name)
+			checkedAt := now
+			status.CheckedAt = &checkedAt
+			status.Model = states[i]
+			if errs[i] != nil {
+				status.Available = false
+				status.Error = errs[i].Error()
+				continue
+			}
+			status.Available = true
+			status.Error = ""
+			status.LastSuccess = &checkedAt
+		}
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make(map[string]ProviderStatus, len(names))
+	for _, name := range names {
+		result[name] = *p.status(name)
+	}
+	return result
+}
+
+// configuredProviders returns the default provider and every provider with credentials
+func configuredProviders(config models.AIConfig) []string {
+	names := []string{config.DefaultProvider}
+	if config.OpenAI.APIKey != "" && config.DefaultProvider != "openai" {
+		names = append(names, "openai")
+	}
+	if config.Gemini.APIKey != "" && config.DefaultProvider != "gemini" {
+		names = append(names, "gemini")
+	}
+	if config.Ollama.BaseURL != "" && config.DefaultProvider != "ollama" {
+		names = append(names, "ollama")
+	}
+	if (len(config.External.Command) > 0 || config.External.URL != "") && config.DefaultProvider != "external" {
+		names = append(names, "external")
+	}
+	return names
+}
+
+// providerStatuses checks the configured AI providers with a cheap model list call
+func (h *Handler) providerStatuses(force bool) map[string]ProviderStatus {
+	config := h.cfg().AI
+	statuses := h.providers.get(h.checkTTL(), force, configuredProviders(config), func(name string) (*ai.ModelState, error) {
+		return h.checkProvider(config, name)
+	})
+	if status, ok := statuses[config.DefaultProvider]; ok {
+		status.Default = true
+		statuses[config.DefaultProvider] = status
+	}
+	return statuses
+}
+
+// checkProvider verifies one provider can be used with the global credentials.
+// Providers serving their own models also need the configured model installed.
+func (h *Handler) checkProvider(config models.AIConfig, name string) (*ai.ModelState, error) {
+	provider, err := pipeline.NewProvider(config, name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if pinger, ok := provider.(ai.Pinger); ok {
+		if err := pinger.Ping(ctx); err != nil {
+			return nil, err
+		}
+	}
+	stater, ok := provider.(ai.ModelStater)
+	if !ok {
+		return nil, nil
+	}
+	state, err := stater.ModelState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !state.Installed {
+		return state, fmt.Errorf("model %s is not installed", state.Name)
+	}
+	return state, nil
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/integrations"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// autoPushTimeout bounds the background push of a freshly archived invoice
+const autoPushTimeout = 2 * time.Minute
+
+// PushResponse is the response of PushInvoice
+type PushResponse struct {
+	ID          string `json:"id"`
+	Integration string `json:"integration"`
+	ExternalID  string `json:"externalId"` // ID of the invoice in the external system
+}
+
+// PushInvoice creates a stored invoice in an external accounting system, e.g.
+// POST /invoices/{id}/push/odoo. An invoice is pushed once per integration;
+// ?force=true pushes it again, and pushes proformas, which are not payable.
+func (h *Handler) PushInvoice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	vars := mux.Vars(r)
+	name := vars["integration"]
+	pusher, err := integrations.New(name, tenant.Integrations)
+	if errors.Is(err, integrations.ErrNotConfigured) {
+		h.sendError(w, http.StatusNotFound, "Integration is not configured: "+name)
+		return
+	}
+	if err != nil {
+		h.sendError(w, http.StatusNotFound, "Unknown integration: "+name)
+		return
+	}
+
+	record, ok := h.loadInvoice(w, tenant, vars["id"])
+	if !ok {
+		return
+	}
+	if record.Invoice == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice not found")
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	if id := record.ExternalIDs[name]; id != "" && !force {
+		h.sendError(w, http.StatusConflict, "Invoice was already pushed as "+id+", use force=true to push it again")
+		return
+	}
+	if record.Invoice.DocumentSubtype == classify.SubtypeProforma && !force {
+		h.sendError(w, http.StatusConflict, "Invoice is a proforma and not payable, use force=true to push it anyway")
+		return
+	}
+
+	externalID, err := h.push(r.Context(), pusher, name, record)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("push failed", "integration", name, "invoice_id", record.ID, "error", err)
+		h.sendError(w, http.StatusBadGateway, "Failed to push invoice: "+err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(PushResponse{ID: record.ID, Integration: name, ExternalID: externalID})
+}
+
+// push pushes a record with its original, when still stored, and records the external ID
+func (h *Handler) push(ctx context.Context, pusher integrations.Pusher, name string, record *models.StoredInvoice) (string, error) {
+	original, err := h.store.GetOriginal(record.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return "", err
+	}
+
+	externalID, err := pusher.Push(ctx, record, original)
+	if err != nil {
+		return "", err
+	}
+
+	if record.ExternalIDs == nil {
+		record.ExternalIDs = make(map[string]string)
+	}
+	record.ExternalIDs[name] = externalID
+	if err := h.store.Update(record); err != nil {
+		logging.FromContext(ctx).Warn("failed to record external id", "integration", name, "invoice_id", record.ID, "external_id", externalID, "error", err)
+	}
+	return externalID, nil
+}
+
+// autoPush pushes a freshly archived invoice to the tenant's auto_push
+// integrations in the background; failures are logged. Proformas are not
+// pushed.
+func (h *Handler) autoPush(ctx context.Context, tenant *tenantSettings, id string) {
+	names := integrations.AutoPush(tenant.Integrations)
+	if len(names) == 0 {
+		return
+	}
+
+	logger := logging.FromContext(ctx)
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, autoPushTimeout)
+		defer cancel()
+
+		for _, name := range names {
+			pusher, err := integrations.New(name, tenant.Integrations)
+			if err != nil {
+				continue
+			}
+			// Reload, so each push sees the external IDs of the previous one
+			record, err := h.store.Get(id)
+			if err != nil {
+				logger.Warn("auto push failed", "integration", name, "invoice_id", id, "error", err)
+				return
+			}
+			if record.Invoice != nil && record.Invoice.DocumentSubtype == classify.SubtypeProforma {
+				logger.Info("auto push skipped", "invoice_id", id, "reason", "proforma")
+				return
+			}
+			externalID, err := h.push(ctx, pusher, name, record)
+			if err != nil {
+				logger.Warn("auto push failed", "integration", name, "invoice_id", id, "error", err)
+				continue
+			}
+			logger.Info("invoice pushed", "integration", name, "invoice_id", id, "external_id", externalID)
+		}
+	}()
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/consistency"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+	"github.com/facturaIA/invoice-ocr-service/internal/warranty"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// maxListLimit caps the page size of ListInvoices
+const maxListLimit = 500
+
+// InvoiceList is the response of ListInvoices
+type InvoiceList struct {
+	Invoices []InvoiceSummary `json:"invoices"`
+	Total    int              `json:"total"` // Matching invoices across all pages
+}
+
+// InvoiceSummary is a stored invoice in a list
+type InvoiceSummary struct {
+	ID          string          `json:"id"`
+	Filename    string          `json:"filename,omitempty"`
+	Vendor      string          `json:"vendor"`
+	Date        time.Time       `json:"date"`
+	Total       decimal.Decimal `json:"total"`
+	Confidence  float64         `json:"confidence"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	CorrectedAt *time.Time      `json:"correctedAt,omitempty"`
+	ApprovedAt  *time.Time      `json:"approvedAt,omitempty"`
+}
+
+// InvoiceCorrection holds the fields of UpdateInvoice; omitted fields are kept
+type InvoiceCorrection struct {
+	Vendor     *string               `json:"vendor"`
+	Date       *string               `json:"date"` // YYYY-MM-DD or RFC 3339; "" clears it
+	Total      *decimal.Decimal      `json:"total"`
+	Tax        *decimal.Decimal      `json:"tax"`
+	Categories *[]string             `json:"categories"`
+	Items      *[]models.InvoiceItem `json:"items"`
+}
+
+// ListInvoices lists the caller's stored invoices, newest first, with
+// ?limit= (default 50), ?offset= and the ?from= and ?to= dates of GetStats
+func (h *Handler) ListInvoices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	limit, offset := 50, 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			h.sendError(w, http.StatusBadRequest, "Invalid limit, expected 1 to "+strconv.Itoa(maxListLimit))
+			return
+		}
+		limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			h.sendError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+		offset = n
+	}
+
+	from, to, ok := h.dateRange(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := h.tenantInvoices(h.resolveTenant(r), from, to)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to list invoices")
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+
+	response := InvoiceList{Invoices: []InvoiceSummary{}, Total: len(records)}
+	for i := offset; i < len(records) && i < offset+limit; i++ {
+		record := records[i]
+		response.Invoices = append(response.Invoices, InvoiceSummary{
+			ID:          record.ID,
+			Filename:    record.Filename,
+			Vendor:      record.Invoice.Vendor,
+			Date:        record.Invoice.Date,
+			Total:       record.Invoice.Total,
+			Confidence:  record.Invoice.Confidence,
+			CreatedAt:   record.CreatedAt,
+			CorrectedAt: record.CorrectedAt,
+			ApprovedAt:  record.ApprovedAt,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetInvoice returns a stored invoice with its processing metadata
+func (h *Handler) GetInvoice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	record, ok := h.loadInvoice(w, h.resolveTenant(r), mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(record)
+}
+
+// GetOriginal downloads the original upload of a stored invoice
+func (h *Handler) GetOriginal(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	record, ok := h.loadInvoice(w, h.resolveTenant(r), mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	data, err := h.store.GetOriginal(record.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.sendError(w, http.StatusGone, "Original image has been purged by the retention policy")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to load original image")
+		return
+	}
+
+	contentType := record.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// UpdateInvoice applies manual corrections to the extracted fields of a
+// stored invoice and records when it was corrected
+func (h *Handler) UpdateInvoice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	var correction InvoiceCorrection
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&correction); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	record, ok := h.loadInvoice(w, tenant, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if record.Invoice == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice not found")
+		return
+	}
+
+	invoice := *record.Invoice
+	if correction.Vendor != nil {
+		invoice.Vendor = strings.TrimSpace(*correction.Vendor)
+	}
+	if correction.Date != nil {
+		date, err := parseInvoiceDate(*correction.Date)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		invoice.Date = date
+	}
+	if correction.Total != nil {
+		if correction.Total.IsNegative() {
+			h.sendError(w, http.StatusBadRequest, "Invalid total, must not be negative")
+			return
+		}
+		invoice.Total = *correction.Total
+	}
+	if correction.Tax != nil {
+		if correction.Tax.IsNegative() {
+			h.sendError(w, http.StatusBadRequest, "Invalid tax, must not be negative")
+			return
+		}
+		invoice.Tax = *correction.Tax
+	}
+	if correction.Categories != nil {
+		invoice.Categories = *correction.Categories
+	}
+	if correction.Items != nil {
+		invoice.Items = *correction.Items
+	}
+
+	now := time.Now()
+	corrected := models.Provenance{Source: models.SourceHumanCorrection, At: &now}
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		corrected.By = identity.Name
+	}
+	changed := changedFields(record.Invoice, &invoice)
+	invoice.Provenance = maps.Clone(invoice.Provenance)
+	invoice.SetProvenance(corrected, changed...)
+	for _, field := range changed {
+		if !slices.Contains(record.CorrectedFields, field) {
+			record.CorrectedFields = append(record.CorrectedFields, field)
+		}
+	}
+	record.Invoice = &invoice
+	record.CorrectedAt = &now
+	record.UpdatedAt = now
+	if slices.Contains(changed, "total") || slices.Contains(changed, "date") || slices.Contains(changed, "categories") {
+		h.checkMonthlyLimits(r.Context(), tenant, record)
+	}
+	if slices.Contains(changed, "total") || slices.Contains(changed, "tax") || slices.Contains(changed, "items") {
+		consistency.CheckTotal(record.Invoice)
+	}
+	if slices.Contains(changed, "items") {
+		record.Invoice.WarrantyCandidates = warranty.Candidates(record.Invoice.Items)
+	}
+	if err := h.store.Update(record); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to store invoice")
+		return
+	}
+	if slices.Contains(changed, "categories") {
+		h.learnCategories(r, record)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(record)
+}
+
+// changedFields lists the correctable fields whose value differs between two
+// versions of an invoice, for confidence calibration
+func changedFields(before, after *models.Invoice) []string {
+	var changed []string
+	add := func(field string, equal bool) {
+		if !equal {
+			changed = append(changed, field)
+		}
+	}
+	add("vendor", before.Vendor == after.Vendor)
+	add("date", before.Date.Equal(after.Date))
+	add("total", before.Total.Equal(after.Total))
+	add("tax", before.Tax.Equal(after.Tax))
+	add("categories", slices.Equal(before.Categories, after.Categories))
+	itemsBefore, _ := json.Marshal(before.Items)
+	itemsAfter, _ := json.Marshal(after.Items)
+	add("items", string(itemsBefore) == string(itemsAfter))
+	return changed
+}
+
+// parseInvoiceDate parses a corrected date; an empty string is the zero time
+func parseInvoiceDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
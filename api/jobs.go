@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/queue"
+	"github.com/facturaIA/invoice-ocr-service/internal/ratelimit"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// newQueue creates the configured job queue backend
+func newQueue(config models.JobsConfig) (queue.Queue, error) {
+	switch config.Backend {
+	case "", "memory":
+		return queue.NewMemoryQueue(config.QueueCapacity), nil
+	case "redis":
+		return queue.NewRedisQueue(config.Redis.Addr, config.Redis.Password, config.Redis.DB, config.Redis.Prefix, config.LeaseDuration, config.FinishedTTL)
+	case "nats":
+		return queue.NewNATSQueue(config.NATS.URL, config.NATS.Prefix, config.LeaseDuration)
+	default:
+		return nil, fmt.Errorf("unsupported job queue backend: %s", config.Backend)
+	}
+}
+
+// SubmitJob accepts an invoice for asynchronous processing
+func (h *Handler) SubmitJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.queue == nil {
+		h.sendError(w, http.StatusNotFound, "Async jobs are not enabled")
+		return
+	}
+
+	imageData, header, ok := h.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	params, err := h.processParams(r, tenant)
+	if err != nil {
+		h.sendGenerationError(w, err)
+		return
+	}
+
+	now := time.Now()
+	job := &queue.Job{
+		ID:          storage.NewID(),
+		TenantID:    tenant.ID,
+		CallerKey:   callerKey(r),
+		RequestID:   requestid.FromContext(r.Context()),
+		State:       queue.StatePending,
+		MaxAttempts: h.pool.MaxAttempts(),
+		Filename:    header.Filename,
+		Request:     params,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err = h.queue.Enqueue(r.Context(), job, imageData)
+	if err != nil {
+		if errors.Is(err, queue.ErrFull) {
+			w.Header().Set("Retry-After", "30")
+			h.sendError(w, http.StatusServiceUnavailable, "Job queue is full, retry later")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to enqueue job")
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetJob returns the state and, once finished, the result of a job
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.queue == nil {
+		h.sendError(w, http.StatusNotFound, "Async jobs are not enabled")
+		return
+	}
+
+	job, err := h.queue.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil || job.TenantID != h.resolveTenant(r).ID {
+		if err == nil || errors.Is(err, queue.ErrNotFound) {
+			h.sendError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to load job")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ListJobs lists the caller's jobs, optionally filtered with ?state= (e.g.
+// dead_letter, or its alias failed)
+func (h *Handler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.queue == nil {
+		h.sendError(w, http.StatusNotFound, "Async jobs are not enabled")
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	if state == "failed" {
+		state = queue.StateDeadLetter
+	}
+	jobs, err := h.queue.List(r.Context(), state)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to list jobs")
+		return
+	}
+
+	tenantID := h.resolveTenant(r).ID
+	visible := make([]*queue.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.TenantID == tenantID {
+			visible = append(visible, job)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": visible,
+	})
+}
+
+// RetryJob queues a dead-lettered job again with a fresh set of attempts. Its
+// failures are kept.
+func (h *Handler) RetryJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.queue == nil {
+		h.sendError(w, http.StatusNotFound, "Async jobs are not enabled")
+		return
+	}
+
+	job, err := h.queue.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil || job.TenantID != h.resolveTenant(r).ID {
+		if err == nil || errors.Is(err, queue.ErrNotFound) {
+			h.sendError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to load job")
+		return
+	}
+	if job.State != queue.StateDeadLetter {
+		h.sendError(w, http.StatusConflict, fmt.Sprintf("Only dead-lettered jobs can be retried, this one is %s", job.State))
+		return
+	}
+	if _, err := h.queue.Payload(r.Context(), job.ID); err != nil {
+		if errors.Is(err, queue.ErrNotFound) {
+			h.sendError(w, http.StatusGone, "The job's upload is no longer available")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to load job")
+		return
+	}
+
+	job.State = queue.StatePending
+	job.Attempts = 0
+	job.MaxAttempts = h.pool.MaxAttempts()
+	job.Result = nil
+	job.NextAttemptAt = nil
+	job.UpdatedAt = time.Now()
+	err = h.queue.Retry(r.Context(), job)
+	if err != nil {
+		if errors.Is(err, queue.ErrStateChanged) {
+			h.sendError(w, http.StatusConflict, "The job was retried or changed concurrently")
+			return
+		}
+		if errors.Is(err, queue.ErrNotFound) {
+			h.sendError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		if errors.Is(err, queue.ErrFull) {
+			w.Header().Set("Retry-After", "30")
+			h.sendError(w, http.StatusServiceUnavailable, "Job queue is full, retry later")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to enqueue job")
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// runJob processes a queued job; it is the worker pool's ProcessFunc
+func (h *Handler) runJob(ctx context.Context, job *queue.Job, payload []byte) (*models.ProcessResponse, error) {
+	startTime := time.Now()
+	tenant, ok := h.tenantByID(job.TenantID)
+	if !ok {
+		return nil, fmt.Errorf("job belongs to unknown tenant %s", job.TenantID)
+	}
+	params := job.Request
+	ctx = requestid.WithID(ctx, job.RequestID)
+	ctx = logging.WithLogger(ctx, slog.Default().With(
+		"request_id", job.RequestID,
+		"job_id", job.ID,
+		"tenant", job.TenantID,
+	))
+
+	ctx, span := tracing.Start(ctx, "job.process",
+		attribute.String("job.id", job.ID),
+		attribute.Int("job.attempt", job.Attempts),
+	)
+	defer span.End()
+
+	if timeout := h.cfg().Timeouts.Job; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Jobs wait for a batch slot, letting interactive requests go first
+	if h.slots != nil {
+		release, err := h.slots.Wait(ratelimit.WithPriority(ctx, ratelimit.PriorityBatch))
+		if err != nil {
+			return nil, fmt.Errorf("no processing slot for the job: %w", err)
+		}
+		defer release()
+	}
+	if h.memory != nil {
+		release, err := h.memory.Acquire(ctx, imagedata.EstimateMemory(bytes.NewReader(payload), int64(len(payload))))
+		if err != nil {
+			return nil, fmt.Errorf("no memory to process the job: %w", err)
+		}
+		defer release()
+	}
+
+	result, err := h.processInvoice(ctx, tenant, payload, params, nil)
+	h.recordUsageFor(job.CallerKey, result.Usage)
+
+	totalDuration := time.Since(startTime).Seconds()
+
+	if err != nil {
+		response := h.failureResponse(err, result, params.RedactPII, totalDuration)
+		response.RequestID = job.RequestID
+		logging.FromContext(ctx).Warn("job attempt failed",
+			"attempt", job.Attempts,
+			"code", response.Code,
+			"stage", response.Stage,
+			"error", err,
+		)
+		return &response, err
+	}
+
+	invoice := result.Invoice
+	if params.RedactPII {
+		invoice.RawText = redact.Text(invoice.RawText)
+	}
+
+	err = h.archiveInvoice(ctx, tenant, params, job.Filename, "", result, totalDuration, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store invoice: %w", err)
+	}
+
+	return &models.ProcessResponse{
+		SchemaVersion: models.SchemaV1,
+		Success:       true,
+		Invoice:       invoice,
+		OCRDuration:   result.OCRDuration,
+		AIDuration:    result.AIDuration,
+		TotalDuration: totalDuration,
+		Usage:         &result.Usage,
+		Diagnostics:   result.Diagnostics,
+		RequestID:     job.RequestID,
+	}, nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/gorilla/mux"
+)
+
+// CreateKeyRequest represents the body of a key creation request
+type CreateKeyRequest struct {
+	Name   string `json:"name"`
+	Admin  bool   `json:"admin"`
+	Tenant string `json:"tenant"`
+}
+
+// CreateKeyResponse returns the generated secret (shown only once)
+type CreateKeyResponse struct {
+	auth.KeyInfo
+	Key string `json:"key"`
+}
+
+// ListKeys returns the names of the API keys visible to the caller: all keys
+// for a global admin, the keys of their own tenant otherwise
+func (h *Handler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": h.keys.List(identity.Tenant),
+	})
+}
+
+// CreateKey generates a new runtime API key
+func (h *Handler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req CreateKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Name == "" {
+		h.sendError(w, http.StatusBadRequest, "Request body must be JSON with a name")
+		return
+	}
+
+	// Keys can only be issued for the caller's own tenant
+	identity, _ := auth.IdentityFromContext(r.Context())
+	if identity.Tenant != "" && req.Tenant != identity.Tenant {
+		h.sendError(w, http.StatusForbidden, "Cannot create keys for another tenant")
+		return
+	}
+	if _, exists := findTenant(h.cfg(), req.Tenant); req.Tenant != "" && !exists {
+		h.sendError(w, http.StatusBadRequest, "Unknown tenant")
+		return
+	}
+
+	secret, err := h.keys.Create(req.Name, req.Admin, req.Tenant)
+	if err != nil {
+		if errors.Is(err, auth.ErrKeyExists) {
+			h.sendError(w, http.StatusConflict, "API key name already exists")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateKeyResponse{
+		KeyInfo: auth.KeyInfo{Name: req.Name, Admin: req.Admin, Tenant: req.Tenant, Source: "runtime"},
+		Key:     secret,
+	})
+}
+
+// RevokeKey removes an API key. Tenant admins can only revoke keys of their
+// own tenant; other keys are reported as not found.
+func (h *Handler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	identity, _ := auth.IdentityFromContext(r.Context())
+	err := h.keys.Revoke(mux.Vars(r)["name"], identity.Tenant)
+	if err != nil {
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			h.sendError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireAdmin ensures key management is enabled and the caller holds an admin key
+func (h *Handler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if h.keys == nil {
+		h.sendError(w, http.StatusNotFound, "Authentication is not enabled")
+		return false
+	}
+
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok || !identity.Admin {
+		h.sendError(w, http.StatusForbidden, "Admin API key required")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/learning"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// CategoryMappingRequest represents the body of a category mapping update
+type CategoryMappingRequest struct {
+	Categories []string `json:"categories"`
+}
+
+// applyLearning replaces the categories the AI suggested by those reviewers
+// gave the vendor's earlier invoices, when category learning knows the vendor
+func (h *Handler) applyLearning(tenant *tenantSettings, invoice *models.Invoice) {
+	if h.learning == nil {
+		return
+	}
+	categories := h.learning.Lookup(tenant.ID, invoice.Vendor)
+	if categories == nil {
+		return
+	}
+	invoice.Categories = categories
+	invoice.SetProvenance(models.Provenance{Source: models.SourceLearned}, "categories")
+}
+
+// learnCategories records the categories of a corrected invoice. Failures are
+// logged: the correction itself was stored.
+func (h *Handler) learnCategories(r *http.Request, record *models.StoredInvoice) {
+	if h.learning == nil {
+		return
+	}
+	if err := h.learning.Learn(record.TenantID, record.Invoice.Vendor, record.Invoice.Categories); err != nil {
+		logging.FromContext(r.Context()).Warn("failed to learn vendor categories", "vendor", record.Invoice.Vendor, "error", err)
+	}
+}
+
+// ListCategoryMappings returns the learned and manual vendor categories of the
+// caller's tenant
+func (h *Handler) ListCategoryMappings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.requireLearning(w) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mappings": h.learning.List(h.resolveTenant(r).ID),
+	})
+}
+
+// SetCategoryMapping sets the categories of a vendor by hand
+func (h *Handler) SetCategoryMapping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.requireLearning(w) || !h.requireMappingAdmin(w, r) {
+		return
+	}
+
+	var req CategoryMappingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Categories) == 0 {
+		h.sendError(w, http.StatusBadRequest, "Request body must be JSON with categories")
+		return
+	}
+	tenant := h.resolveTenant(r)
+	for _, category := range req.Categories {
+		if len(tenant.Categories) > 0 && !slices.Contains(tenant.Categories, category) {
+			h.sendError(w, http.StatusBadRequest, "Unknown category: "+category)
+			return
+		}
+	}
+
+	vendor := mux.Vars(r)["vendor"]
+	if learning.Key(vendor) == "" {
+		h.sendError(w, http.StatusBadRequest, "Vendor name has no letters or digits")
+		return
+	}
+
+	mapping, err := h.learning.Set(tenant.ID, vendor, req.Categories)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to store category mapping")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(mapping)
+}
+
+// DeleteCategoryMapping forgets the categories of a vendor
+func (h *Handler) DeleteCategoryMapping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.requireLearning(w) || !h.requireMappingAdmin(w, r) {
+		return
+	}
+
+	found, err := h.learning.Delete(h.resolveTenant(r).ID, mux.Vars(r)["vendor"])
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to store category mappings")
+		return
+	}
+	if !found {
+		h.sendError(w, http.StatusNotFound, "Category mapping not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireLearning ensures category learning is enabled
+func (h *Handler) requireLearning(w http.ResponseWriter) bool {
+	if h.learning == nil {
+		h.sendError(w, http.StatusNotFound, "Category learning is not enabled")
+		return false
+	}
+	return true
+}
+
+// requireMappingAdmin ensures the caller may edit mappings: any caller without
+// authentication, admins with it
+func (h *Handler) requireMappingAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if len(h.authn) == 0 {
+		return true
+	}
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok || !identity.Admin {
+		h.sendError(w, http.StatusForbidden, "Admin credentials required to edit category mappings")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/export"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/mail"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// mailResult emails a processed invoice to the tenant's recipients in the
+// background: a summary, the invoice as JSON and CSV, and the original upload.
+// Failures are logged.
+func (h *Handler) mailResult(ctx context.Context, tenant *tenantSettings, record *models.StoredInvoice, original []byte) {
+	config := tenant.Mail
+	if config.Host == "" || len(config.To) == 0 {
+		return
+	}
+
+	msg, err := resultMessage(record, original)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to build result email", "invoice_id", record.ID, "error", err)
+		return
+	}
+	msg.To = config.To
+
+	logger := logging.FromContext(ctx)
+	go func() {
+		if err := mail.NewSender(config).Send(msg); err != nil {
+			logger.Warn("failed to email result", "invoice_id", record.ID, "error", err)
+		}
+	}()
+}
+
+// resultMessage returns the email of a processed invoice
+func resultMessage(record *models.StoredInvoice, original []byte) (mail.Message, error) {
+	invoice := record.Invoice
+
+	data, err := json.MarshalIndent(invoice, "", "  ")
+	if err != nil {
+		return mail.Message{}, err
+	}
+	var csv bytes.Buffer
+	err = export.Write(&csv, export.FormatCSV, export.LayoutItems, []*models.StoredInvoice{record})
+	if err != nil {
+		return mail.Message{}, err
+	}
+
+	name := "invoice"
+	if record.ID != "" {
+		name = "invoice-" + record.ID
+	}
+	vendor := invoice.Vendor
+	if vendor == "" {
+		vendor = "unknown vendor"
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Vendor: %s\n", vendor)
+	if !invoice.Date.IsZero() {
+		fmt.Fprintf(&body, "Date: %s\n", invoice.Date.Format(time.DateOnly))
+	}
+	fmt.Fprintf(&body, "Total: %s\n", invoice.Total.StringFixed(2))
+	fmt.Fprintf(&body, "Tax: %s\n", invoice.Tax.StringFixed(2))
+	fmt.Fprintf(&body, "Items: %d\n", len(invoice.Items))
+	fmt.Fprintf(&body, "Confidence: %.2f\n", invoice.Confidence)
+	if invoice.OCRConfidence > 0 {
+		fmt.Fprintf(&body, "OCR confidence: %.2f\n", invoice.OCRConfidence)
+	}
+	if invoice.ModelConfidence > 0 {
+		fmt.Fprintf(&body, "Model confidence: %.2f\n", invoice.ModelConfidence)
+	}
+	if record.ID != "" {
+		fmt.Fprintf(&body, "Invoice ID: %s\n", record.ID)
+	}
+	if record.Filename != "" {
+		fmt.Fprintf(&body, "File: %s\n", record.Filename)
+	}
+
+	msg := mail.Message{
+		Subject: fmt.Sprintf("Invoice from %s: %s", vendor, invoice.Total.StringFixed(2)),
+		Body:    body.String(),
+		Attachments: []mail.Attachment{
+			{Name: name + ".json", ContentType: "application/json", Data: data},
+			{Name: name + ".csv", ContentType: "text/csv", Data: csv.Bytes()},
+		},
+	}
+	if original != nil {
+		filename := record.Filename
+		if filename == "" {
+			filename = name + "-original"
+		}
+		msg.Attachments = append(msg.Attachments, mail.Attachment{Name: filename, ContentType: record.ContentType, Data: original})
+	}
+	return msg, nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+)
+
+// memoryAccountKey is the context key of a request's memoryAccount
+type memoryAccountKey struct{}
+
+// memoryAccount holds the memory reserved by a request until it ends
+type memoryAccount struct {
+	mu       sync.Mutex
+	releases []func()
+}
+
+func (a *memoryAccount) add(release func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.releases = append(a.releases, release)
+}
+
+func (a *memoryAccount) release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, release := range a.releases {
+		release()
+	}
+	a.releases = nil
+}
+
+// reserveMemory reserves n bytes of processing memory for the rest of the
+// request, writing 503 with Retry-After when it does not free up in time.
+// Requests outside limitConcurrency, or with memory unlimited, always succeed.
+func (h *Handler) reserveMemory(w http.ResponseWriter, r *http.Request, n int64) bool {
+	account, ok := r.Context().Value(memoryAccountKey{}).(*memoryAccount)
+	if h.memory == nil || !ok {
+		return true
+	}
+	release, err := h.memory.Acquire(r.Context(), n)
+	if err != nil {
+		h.sendBusy(w)
+		return false
+	}
+	account.add(release)
+	return true
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ratelimit"
+)
+
+// priorityHeader names the lane a request waits in for a processing slot,
+// "interactive" or "batch"
+const priorityHeader = "X-Priority"
+
+// requestPriority returns the priority a request asks for, or fallback, the
+// default of its endpoint, when it names none
+func requestPriority(r *http.Request, fallback ratelimit.Priority) (ratelimit.Priority, error) {
+	name := strings.ToLower(strings.TrimSpace(r.Header.Get(priorityHeader)))
+	if name == "" {
+		return fallback, nil
+	}
+	return ratelimit.ParsePriority(name)
+}
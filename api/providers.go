@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ai"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/residency"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// ProvidersResponse lists the AI providers a caller can choose from
+type ProvidersResponse struct {
+	Providers []ProviderInfo `json:"providers"`
+	Policy    string         `json:"policy,omitempty"` // Name of the data residency policy, if one is configured
+}
+
+// ProviderInfo describes a configured AI provider
+type ProviderInfo struct {
+	Name         string      `json:"name"`
+	Default      bool        `json:"default,omitempty"`
+	DefaultModel string      `json:"defaultModel"`
+	Vision       bool        `json:"vision"`                // Whether the default model accepts images
+	Allowed      bool        `json:"allowed"`               // Whether the residency policy allows sending documents to it
+	Host         string      `json:"host,omitempty"`        // Where documents are sent, empty for a local command
+	Models       []ModelInfo `json:"models"`                // Live model list, empty when it could not be fetched
+	ModelsError  string      `json:"modelsError,omitempty"` // Why the model list could not be fetched
+	FetchedAt    *time.Time  `json:"fetchedAt,omitempty"`
+}
+
+// ModelInfo describes a model offered by a provider
+type ModelInfo struct {
+	ID     string `json:"id"`
+	Vision bool   `json:"vision"` // Best guess from the model name
+}
+
+// modelList is a fetched model list of one provider
+type modelList struct {
+	models    []string
+	err       error
+	fetchedAt time.Time
+}
+
+// modelCache reuses provider model lists until they expire
+type modelCache struct {
+	mu    sync.Mutex
+	lists map[string]modelList // By tenant and provider
+}
+
+// get returns the cached list for key, running fetch when it is older than
+// ttl or force is set. Fetches run outside the lock.
+func (c *modelCache) get(key string, ttl time.Duration, force bool, fetch func() ([]string, error)) modelList {
+	c.mu.Lock()
+	list, ok := c.lists[key]
+	c.mu.Unlock()
+	if ok && !force && time.Since(list.fetchedAt) < ttl {
+		return list
+	}
+
+	ids, err := fetch()
+	list = modelList{models: ids, err: err, fetchedAt: time.Now()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lists == nil {
+		c.lists = make(map[string]modelList)
+	}
+	c.lists[key] = list
+	return list
+}
+
+// invalidate forces the next get of every key to fetch again
+func (c *modelCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lists = nil
+}
+
+// ListProviders returns the AI providers configured for the caller's tenant
+// with their default model, live model list and whether the residency policy
+// allows them, so UIs can populate model pickers. Lists are cached like health
+// checks; ?refresh=true fetches them again.
+func (h *Handler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	tenant := h.resolveTenant(r)
+	config := tenant.AI
+	force := r.URL.Query().Get("refresh") == "true"
+
+	policy := h.residency.Load()
+	names := configuredProviders(config)
+	providers := make([]ProviderInfo, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			providers[i] = h.providerInfo(tenant.ID, config, name, force)
+			providers[i].Allowed = policy.Allows(config, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	json.NewEncoder(w).Encode(ProvidersResponse{Providers: providers, Policy: policy.Name()})
+}
+
+// providerInfo describes one provider, fetching its models through the cache
+func (h *Handler) providerInfo(tenantID string, config models.AIConfig, name string, force bool) ProviderInfo {
+	model := pipeline.ResolveModel(config, name, "")
+	info := ProviderInfo{
+		Name:         name,
+		Default:      name == config.DefaultProvider,
+		DefaultModel: model,
+		Vision:       ai.SupportsVision(name, model) || (name == "external" && config.External.Vision),
+		Host:         residency.Host(config, name),
+		Models:       []ModelInfo{},
+	}
+
+	list := h.models.get(tenantID+"/"+name, h.checkTTL(), force, func() ([]string, error) {
+		return listModels(config, name)
+	})
+	info.FetchedAt = &list.fetchedAt
+	if list.err != nil {
+		info.ModelsError = list.err.Error()
+		return info
+	}
+
+	for _, id := range list.models {
+		info.Models = append(info.Models, ModelInfo{ID: id, Vision: ai.SupportsVision(name, id)})
+	}
+	sort.Slice(info.Models, func(i, j int) bool { return info.Models[i].ID < info.Models[j].ID })
+	return info
+}
+
+// listModels fetches the models of a provider with the given credentials. It
+// does not use the request context, so a client disconnect is never cached.
+func listModels(config models.AIConfig, name string) ([]string, error) {
+	provider, err := pipeline.NewProvider(config, name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok := provider.(ai.ModelLister)
+	if !ok {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return lister.ListModels(ctx)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/reconcile"
+	"github.com/shopspring/decimal"
+)
+
+// ReconcileResponse pairs the lines of a bank statement with stored invoices
+type ReconcileResponse struct {
+	Lines             int                `json:"lines"`
+	Matches           []ReconcileMatch   `json:"matches"`           // In statement order
+	UnmatchedLines    []StatementLine    `json:"unmatchedLines"`    // No invoice of that amount in the window
+	UnmatchedInvoices []ReconcileInvoice `json:"unmatchedInvoices"` // Invoices dated in the statement's window without a payment
+}
+
+// ReconcileMatch is a statement line paid for a stored invoice
+type ReconcileMatch struct {
+	Line     StatementLine    `json:"line"`
+	Invoice  ReconcileInvoice `json:"invoice"`
+	Score    float64          `json:"score"`    // 0.5 for the amount alone, up to 1 with the same date and vendor
+	DateDiff int              `json:"dateDiff"` // Days from the invoice date to the booking
+	Vendor   float64          `json:"vendor"`   // Share of the vendor name found in the line description
+}
+
+// StatementLine is a line of an uploaded bank statement
+type StatementLine struct {
+	Row         int             `json:"row"`
+	Date        string          `json:"date"`
+	Amount      decimal.Decimal `json:"amount"` // Negative for debits
+	Currency    string          `json:"currency,omitempty"`
+	Description string          `json:"description"`
+}
+
+// ReconcileInvoice is the part of a stored invoice shown when reconciling
+type ReconcileInvoice struct {
+	ID     string          `json:"id"`
+	Vendor string          `json:"vendor"`
+	Date   string          `json:"date"`
+	Total  decimal.Decimal `json:"total"`
+}
+
+// Reconcile matches the lines of an uploaded bank statement (CSV or CAMT.053)
+// to the caller's stored invoices by amount, date and vendor. Nothing is
+// stored; the matches are returned for review.
+func (h *Handler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	data, _, ok := h.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format != "" && format != reconcile.FormatCSV && format != reconcile.FormatCAMT {
+		h.sendError(w, http.StatusBadRequest, "Invalid format, expected csv or camt")
+		return
+	}
+	options := reconcile.Options{DaysAfter: reconcile.DefaultDaysAfter, DaysBefore: reconcile.DefaultDaysBefore}
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"daysAfter", &options.DaysAfter}, {"daysBefore", &options.DaysBefore}} {
+		if v := r.FormValue(param.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > 366 {
+				h.sendError(w, http.StatusBadRequest, "Invalid "+param.name+", expected 0 to 366 days")
+				return
+			}
+			*param.value = n
+		}
+	}
+
+	lines, err := reconcile.Parse(data, format)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid bank statement: "+err.Error())
+		return
+	}
+
+	first, last := lines[0].Date, lines[0].Date
+	for _, line := range lines {
+		if line.Date.Before(first) {
+			first = line.Date
+		}
+		if line.Date.After(last) {
+			last = line.Date
+		}
+	}
+	from, to := options.Window(first, last)
+	records, err := h.tenantInvoices(h.resolveTenant(r), from, to)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to list invoices")
+		return
+	}
+
+	result := reconcile.Reconcile(lines, records, options)
+	response := ReconcileResponse{
+		Lines:             len(lines),
+		Matches:           make([]ReconcileMatch, 0, len(result.Matches)),
+		UnmatchedLines:    make([]StatementLine, 0, len(result.UnmatchedLines)),
+		UnmatchedInvoices: make([]ReconcileInvoice, 0, len(result.UnmatchedInvoices)),
+	}
+	for _, match := range result.Matches {
+		response.Matches = append(response.Matches, ReconcileMatch{
+			Line:     statementLine(match.Line),
+			Invoice:  reconcileInvoice(match.Invoice),
+			Score:    match.Score,
+			DateDiff: match.DateDiff,
+			Vendor:   match.Vendor,
+		})
+	}
+	for _, line := range result.UnmatchedLines {
+		response.UnmatchedLines = append(response.UnmatchedLines, statementLine(line))
+	}
+	for _, record := range result.UnmatchedInvoices {
+		response.UnmatchedInvoices = append(response.UnmatchedInvoices, reconcileInvoice(record))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func reconcileInvoice(record *models.StoredInvoice) ReconcileInvoice {
+	return ReconcileInvoice{
+		ID:     record.ID,
+		Vendor: record.Invoice.Vendor,
+		Date:   invoiceDate(record).Format(time.DateOnly),
+		Total:  record.Invoice.Total,
+	}
+}
+
+func statementLine(line reconcile.Line) StatementLine {
+	return StatementLine{
+		Row:         line.Row,
+		Date:        line.Date.Format(time.DateOnly),
+		Amount:      line.Amount,
+		Currency:    line.Currency,
+		Description: line.Description,
+	}
+}
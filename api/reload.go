@@ -0,0 +1,129 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/catalog"
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/correct"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/residency"
+	"github.com/facturaIA/invoice-ocr-service/internal/rules"
+	"github.com/facturaIA/invoice-ocr-service/internal/scripts"
+)
+
+// cfg returns the current config. Callers should read it once per operation
+// so a concurrent reload cannot mix old and new settings.
+func (h *Handler) cfg() *models.Config {
+	return h.config.Load()
+}
+
+// Reload swaps in a new config. Categories, prompts, tenants, provider
+// settings, vendor rules, hooks, scripts, OCR text correction, rate limits, timeouts, quotas, budget
+// limits, VIES and registry settings and the gRPC batch concurrency apply to
+// the next request; in-flight
+// requests finish with the settings they started with. Settings wired up at startup
+// (listeners, TLS, CORS, compression, auth, storage, calibration, jobs, logging, tracing,
+// concurrency, usage pricing) keep their old values until a restart.
+func (h *Handler) Reload(config *models.Config) error {
+	err := validateTenants(config)
+	if err != nil {
+		return err
+	}
+	ruleSet, err := rules.Compile(config.Rules)
+	if err != nil {
+		return fmt.Errorf("invalid vendor rules: %w", err)
+	}
+	scriptSet, err := scripts.Compile(config.Scripts)
+	if err != nil {
+		return fmt.Errorf("invalid scripts: %w", err)
+	}
+	corrector, err := correct.Compile(config.OCR.Correction)
+	if err != nil {
+		return fmt.Errorf("invalid ocr.correction: %w", err)
+	}
+	policy, err := residency.ForConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid residency: %w", err)
+	}
+	classifier, err := classify.Compile(config.Classifier)
+	if err != nil {
+		return fmt.Errorf("invalid classifier: %w", err)
+	}
+	profiles, err := classify.CompileProfiles(config.Profiles)
+	if err != nil {
+		return fmt.Errorf("invalid profiles: %w", err)
+	}
+	products, err := catalog.Load(config.Catalog)
+	if err != nil {
+		return fmt.Errorf("invalid catalog: %w", err)
+	}
+
+	old := h.cfg()
+	for _, section := range restartRequired(old, config) {
+		slog.Warn("config change requires a restart to take effect", "setting", section)
+	}
+
+	if h.limiter != nil {
+		h.limiter.Update(config.RateLimit)
+	} else if config.RateLimit.Enabled {
+		slog.Warn("config change requires a restart to take effect", "setting", "rate_limit.enabled")
+	}
+
+	h.config.Store(config)
+	h.rules.Store(ruleSet)
+	h.scripts.Store(scriptSet)
+	h.corrector.Store(corrector)
+	h.residency.Store(policy)
+	h.classifier.Store(classifier)
+	h.profiles.Store(profiles)
+	h.catalog.Store(products)
+
+	// Provider credentials may have changed, so cached checks are stale
+	h.providers.invalidate()
+	h.readiness.invalidate()
+	h.models.invalidate()
+
+	slog.Info("config reloaded")
+	return nil
+}
+
+// restartRequired lists the config sections that changed but are only read at startup
+func restartRequired(old, new *models.Config) []string {
+	sections := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"host", old.Host, new.Host},
+		{"port", old.Port, new.Port},
+		{"api", old.API, new.API},
+		{"tls", old.TLS, new.TLS},
+		{"grpc.enabled", old.GRPC.Enabled, new.GRPC.Enabled},
+		{"grpc.port", old.GRPC.Port, new.GRPC.Port},
+		{"cors", old.CORS, new.CORS},
+		{"compression", old.Compression, new.Compression},
+		{"logging", old.Logging, new.Logging},
+		{"tracing", old.Tracing, new.Tracing},
+		{"offline", old.Offline, new.Offline},
+		{"storage", old.Storage, new.Storage},
+		{"calibration", old.Calibration, new.Calibration},
+		{"category_learning", old.CategoryLearning, new.CategoryLearning},
+		{"auth", old.Auth, new.Auth},
+		{"usage.enabled", old.Usage.Enabled, new.Usage.Enabled},
+		{"usage.prices", old.Usage.Prices, new.Usage.Prices},
+		{"usage.budget.path", old.Usage.Budget.Path, new.Usage.Budget.Path},
+		{"concurrency", old.Concurrency, new.Concurrency},
+		{"jobs", old.Jobs, new.Jobs},
+		{"reload", old.Reload, new.Reload},
+	}
+
+	var changed []string
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.old, s.new) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
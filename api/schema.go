@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// errSchemaVersion rejects an Accept-Version header naming an unknown version
+var errSchemaVersion = errors.New("unsupported schema version")
+
+// invoiceV2 is the schema version 2 shape of an invoice
+type invoiceV2 struct {
+	ID               string                       `json:"id,omitempty"`
+	TenantID         string                       `json:"tenantId,omitempty"`
+	Vendor           vendorV2                     `json:"vendor"`
+	Date             string                       `json:"date,omitempty"` // YYYY-MM-DD, omitted when unknown
+	ReceiptNumber    string                       `json:"receiptNumber,omitempty"`
+	LoyaltyCard      string                       `json:"loyaltyCard,omitempty"`
+	Total            decimal.Decimal              `json:"total"`
+	Tax              decimal.Decimal              `json:"tax"`
+	Rounding         *decimal.Decimal             `json:"roundingAdjustment,omitempty"`
+	Tip              *decimal.Decimal             `json:"tip,omitempty"`
+	Items            []models.InvoiceItem         `json:"items"`
+	TotalMismatch    bool                         `json:"totalMismatch,omitempty"`
+	Handwriting      bool                         `json:"handwritingDetected,omitempty"`
+	Warranty         []models.WarrantyCandidate   `json:"warrantyCandidates,omitempty"`
+	Categories       []string                     `json:"categories"`
+	PolicyViolations []models.PolicyViolation     `json:"policyViolations,omitempty"`
+	DocumentType     string                       `json:"documentType,omitempty"`
+	DocumentSubtype  string                       `json:"documentSubtype,omitempty"`
+	Fuel             *models.FuelDetails          `json:"fuel,omitempty"`
+	Utility          *models.UtilityDetails       `json:"utility,omitempty"`
+	Hotel            *models.HotelDetails         `json:"hotel,omitempty"`
+	Profile          string                       `json:"profile,omitempty"`
+	Fields           map[string]interface{}       `json:"fields,omitempty"`
+	Confidence       confidenceV2                 `json:"confidence"`
+	Provenance       map[string]models.Provenance `json:"provenance,omitempty"`
+	RawText          string                       `json:"rawText,omitempty"`
+	ProcessedAt      time.Time                    `json:"processedAt"`
+}
+
+// vendorV2 groups what is known about the vendor
+type vendorV2 struct {
+	Name      string             `json:"name"`
+	VATNumber string             `json:"vatNumber,omitempty"`
+	VATCheck  *models.VATCheck   `json:"vatCheck,omitempty"`
+	Registry  *models.VendorInfo `json:"registry,omitempty"`
+	Store     *models.StoreInfo  `json:"store,omitempty"`
+}
+
+// confidenceV2 groups the confidence scores of an invoice
+type confidenceV2 struct {
+	Score    float64            `json:"score"`
+	Raw      float64            `json:"raw,omitempty"`    // Before calibration, when Score is calibrated
+	Fields   map[string]float64 `json:"fields,omitempty"` // Calibrated, by field
+	Provider string             `json:"provider,omitempty"`
+	OCR      float64            `json:"ocr,omitempty"`   // Mean word confidence of the OCR text
+	Model    float64            `json:"model,omitempty"` // The AI's assessment of its own answer
+}
+
+// parseSchemaVersion reads an Accept-Version header, "2" or "v2". Empty is SchemaV1.
+func parseSchemaVersion(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return models.SchemaV1, nil
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(header), "v"))
+	if err != nil || version < models.SchemaV1 || version > models.SchemaV2 {
+		return 0, fmt.Errorf("%w %q, expected %d or %d", errSchemaVersion, header, models.SchemaV1, models.SchemaV2)
+	}
+	return version, nil
+}
+
+// toInvoiceV2 converts an invoice to the schema version 2 shape
+func toInvoiceV2(invoice *models.Invoice) invoiceV2 {
+	v2 := invoiceV2{
+		ID:       invoice.ID,
+		TenantID: invoice.TenantID,
+		Vendor: vendorV2{
+			Name:      invoice.Vendor,
+			VATNumber: invoice.VATNumber,
+			VATCheck:  invoice.VATCheck,
+			Registry:  invoice.VendorInfo,
+			Store:     invoice.Store,
+		},
+		ReceiptNumber:    invoice.ReceiptNumber,
+		LoyaltyCard:      invoice.LoyaltyCard,
+		Total:            invoice.Total,
+		Tax:              invoice.Tax,
+		Rounding:         invoice.RoundingAdjustment,
+		Tip:              invoice.Tip,
+		Items:            invoice.Items,
+		TotalMismatch:    invoice.TotalMismatch,
+		Handwriting:      invoice.HandwritingDetected,
+		Warranty:         invoice.WarrantyCandidates,
+		Categories:       invoice.Categories,
+		PolicyViolations: invoice.PolicyViolations,
+		DocumentType:     invoice.DocumentType,
+		DocumentSubtype:  invoice.DocumentSubtype,
+		Fuel:             invoice.Fuel,
+		Utility:          invoice.Utility,
+		Hotel:            invoice.Hotel,
+		Profile:          invoice.Profile,
+		Fields:           invoice.Fields,
+		Confidence: confidenceV2{
+			Score:    invoice.Confidence,
+			Raw:      invoice.RawConfidence,
+			Fields:   invoice.FieldConfidence,
+			Provider: invoice.Provider,
+			OCR:      invoice.OCRConfidence,
+			Model:    invoice.ModelConfidence,
+		},
+		Provenance:  invoice.Provenance,
+		RawText:     invoice.RawText,
+		ProcessedAt: invoice.ProcessedAt,
+	}
+	if !invoice.Date.IsZero() {
+		v2.Date = invoice.Date.Format(time.DateOnly)
+	}
+	if v2.Items == nil {
+		v2.Items = []models.InvoiceItem{}
+	}
+	if v2.Categories == nil {
+		v2.Categories = []string{}
+	}
+	return v2
+}
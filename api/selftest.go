@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+	"github.com/shopspring/decimal"
+)
+
+// selfTestReceipt is a clean till receipt with known values
+//
+//go:embed selftest/receipt.png
+var selfTestReceipt []byte
+
+// selfTestTotal is the total printed on selfTestReceipt
+var selfTestTotal = decimal.RequireFromString("13.86")
+
+// selfTestTimeout bounds one self-test run, OCR and AI call included
+const selfTestTimeout = 2 * time.Minute
+
+// selfTestPending is reported by /ready until the scheduled self-test finishes
+const selfTestPending = "self-test has not finished"
+
+// SelfTest processes an embedded sample receipt through the full pipeline
+// with the default provider, so a missing tessdata pack, ImageMagick delegate
+// or provider credential fails at boot instead of on the first upload. /ready
+// reports the result until the next self-test.
+func (h *Handler) SelfTest(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	err := h.runSelfTest(ctx)
+	status := ServiceStatus{Available: err == nil}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	h.selfTest.Store(&status)
+	h.readiness.invalidate()
+	return err
+}
+
+// runSelfTest processes selfTestReceipt and checks the OCR text and the total
+func (h *Handler) runSelfTest(ctx context.Context) error {
+	options := h.pipelineOptions(h.defaultTenant(), models.ProcessRequest{})
+	// Vendor rules and hooks could skip the AI stage or call out to other systems
+	options.Rules = nil
+	options.Hooks = nil
+
+	invoice, stats, err := pipeline.Process(ctx, selfTestReceipt, options)
+	if err != nil {
+		var se *pipeline.StageError
+		if errors.As(err, &se) {
+			return fmt.Errorf("self-test failed in the %s stage: %w", se.Stage, err)
+		}
+		return fmt.Errorf("self-test failed: %w", err)
+	}
+	if !strings.Contains(strings.ToUpper(stats.RawText), "TOTAL") {
+		return fmt.Errorf("self-test failed in the ocr stage: unexpected text %q", preview(stats.RawText, 200))
+	}
+	if !invoice.Total.Equal(selfTestTotal) {
+		return fmt.Errorf("self-test failed in the ai stage: %s extracted total %s, want %s", stats.Provider, invoice.Total, selfTestTotal)
+	}
+	h.providers.recordSuccess(stats.Provider)
+	return nil
+}
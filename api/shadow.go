@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// shadowTimeout bounds a shadow run when no AI timeout is configured
+const shadowTimeout = 2 * time.Minute
+
+// shadow re-runs a successful extraction with the shadow provider in the
+// background for a sample of requests and logs how its fields differ. The
+// response never waits for it. OCR text is reused, so only the AI stage is
+// compared; vision runs send the image again.
+func (h *Handler) shadow(ctx context.Context, options pipeline.Options, stats pipeline.Stats, invoice *models.Invoice, image []byte) {
+	config := options.AI.Shadow
+	if config.Provider == "" || config.Percent <= 0 || rand.Float64()*100 >= config.Percent {
+		return
+	}
+	options.Provider = config.Provider
+	options.Model = config.Model
+	if options.Provider == stats.Provider && pipeline.ResolveModel(options.AI, options.Provider, options.Model) == stats.Model {
+		return
+	}
+
+	// Runs beyond the limit are skipped rather than queued, so shadow traffic
+	// cannot build up behind a slow provider
+	select {
+	case h.shadowSlots <- struct{}{}:
+	default:
+		logging.FromContext(ctx).Debug("shadow run skipped, too many in flight", "provider", config.Provider)
+		return
+	}
+
+	// The handler goes on to set IDs and redact the invoice
+	primary := *invoice
+	logger := logging.FromContext(ctx)
+	ctx = context.WithoutCancel(ctx)
+	options.Progress = nil
+	options.Hooks = nil // They already ran, and may have side effects
+	timeout := options.AITimeout
+	if timeout <= 0 {
+		timeout = shadowTimeout
+	}
+
+	h.shadowRuns.Add(1)
+	go func() {
+		defer h.shadowRuns.Done()
+		defer func() { <-h.shadowSlots }()
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		start := time.Now()
+		var shadow *models.Invoice
+		var shadowStats pipeline.Stats
+		var err error
+		if options.UseVisionModel || stats.RawText == "" {
+			shadow, shadowStats, err = pipeline.Process(ctx, image, options)
+		} else {
+			shadow, shadowStats, err = pipeline.ExtractText(ctx, stats.RawText, options)
+		}
+		duration := time.Since(start).Seconds()
+
+		attrs := []any{
+			"primary_provider", stats.Provider,
+			"primary_model", stats.Model,
+			"shadow_provider", shadowStats.Provider,
+			"shadow_model", shadowStats.Model,
+			"primary_ai_duration", stats.AIDuration,
+			"shadow_ai_duration", shadowStats.AIDuration,
+			"shadow_duration", duration,
+			"shadow_prompt_tokens", shadowStats.Usage.PromptTokens,
+			"shadow_completion_tokens", shadowStats.Usage.CompletionTokens,
+		}
+		if h.usage != nil {
+			cost := h.usage.EstimateCost(shadowStats.Provider, shadowStats.Model, shadowStats.Usage.PromptTokens, shadowStats.Usage.CompletionTokens)
+			attrs = append(attrs, "shadow_estimated_cost", cost)
+			h.recordSpend(cost)
+		}
+		if err != nil {
+			logger.Warn("shadow extraction failed", append(attrs, "error", err)...)
+			return
+		}
+
+		diff := diffInvoices(&primary, shadow)
+		attrs = append(attrs,
+			"fields", len(diff.matched)+len(diff.mismatched),
+			"matched", len(diff.matched),
+			"mismatched", diff.mismatched,
+			"agreement", float64(len(diff.matched))/float64(len(diff.matched)+len(diff.mismatched)),
+			"total_diff", primary.Total.Sub(shadow.Total).Abs().String(),
+			"tax_diff", primary.Tax.Sub(shadow.Tax).Abs().String(),
+			"primary_confidence", primary.Confidence,
+			"shadow_confidence", shadow.Confidence,
+		)
+		logger.Info("shadow extraction compared", attrs...)
+	}()
+}
+
+// invoiceDiff lists the compared fields on which two extractions agree and differ
+type invoiceDiff struct {
+	matched    []string
+	mismatched []string
+}
+
+// diffInvoices compares the fields of two extractions. Vendors and categories
+// ignore case and spacing; amounts must be equal.
+func diffInvoices(a, b *models.Invoice) invoiceDiff {
+	var diff invoiceDiff
+	compare := func(field string, equal bool) {
+		if equal {
+			diff.matched = append(diff.matched, field)
+		} else {
+			diff.mismatched = append(diff.mismatched, field)
+		}
+	}
+	compare("vendor", foldSpace(a.Vendor) == foldSpace(b.Vendor))
+	compare("date", a.Date.Format(time.DateOnly) == b.Date.Format(time.DateOnly))
+	compare("total", a.Total.Equal(b.Total))
+	compare("tax", a.Tax.Equal(b.Tax))
+	compare("items", len(a.Items) == len(b.Items))
+	compare("categories", strings.Join(categorySet(a.Categories), "\x00") == strings.Join(categorySet(b.Categories), "\x00"))
+	return diff
+}
+
+// foldSpace lower-cases s and collapses its whitespace
+func foldSpace(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// categorySet returns categories folded, deduplicated and sorted
+func categorySet(categories []string) []string {
+	seen := map[string]bool{}
+	var set []string
+	for _, c := range categories {
+		c = foldSpace(c)
+		if !seen[c] {
+			seen[c] = true
+			set = append(set, c)
+		}
+	}
+	sort.Strings(set)
+	return set
+}
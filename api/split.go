@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// SplitResponse is the response of a process-invoice request with split=true or segment=true
+type SplitResponse struct {
+	Success       bool            `json:"success"` // At least one invoice was extracted
+	Documents     []SplitDocument `json:"documents"`
+	RequestID     string          `json:"requestId,omitempty"`
+	OCRDuration   float64         `json:"ocrDuration,omitempty"`
+	AIDuration    float64         `json:"aiDuration,omitempty"`
+	TotalDuration float64         `json:"totalDuration"`
+	Usage         *models.Usage   `json:"usage,omitempty"`
+}
+
+// SplitDocument is one invoice found in a split upload or segmented photo
+type SplitDocument struct {
+	Pages   []int          `json:"pages,omitempty"`   // 1-based pages of the upload, with split=true
+	Region  *models.Region `json:"region,omitempty"`  // Crop of the photo, with segment=true
+	Invoice interface{}    `json:"invoice,omitempty"` // Shaped by the fields parameter
+	Error   string         `json:"error,omitempty"`
+	Code    string         `json:"code,omitempty"`
+	Stage   string         `json:"stage,omitempty"`
+
+	Diagnostics *models.Diagnostics `json:"diagnostics,omitempty"`
+}
+
+// processSplit answers a process-invoice request with split=true or
+// segment=true: every invoice found in the upload by split is extracted and
+// archived on its own. It fails like a single extraction when no invoice
+// could be extracted.
+func (h *Handler) processSplit(
+	w http.ResponseWriter,
+	r *http.Request,
+	split func(context.Context, []byte, pipeline.Options) ([]pipeline.Document, error),
+	tenant *tenantSettings,
+	imageData []byte,
+	header *multipart.FileHeader,
+	params models.ProcessRequest,
+	fields responseFields,
+	startTime time.Time,
+) {
+	ctx := r.Context()
+	options := h.pipelineOptions(tenant, params)
+	options.Language = params.Language
+	options.UseVisionModel = params.UseVisionModel
+
+	documents, err := split(ctx, imageData, options)
+	if err != nil {
+		h.recordUsage(r, models.Usage{})
+		h.sendFailure(w, r, err, &processResult{}, params.RedactPII, fields, time.Since(startTime).Seconds())
+		return
+	}
+
+	response := SplitResponse{
+		RequestID: requestid.FromContext(ctx),
+		Usage:     &models.Usage{},
+	}
+	results := make([]*processResult, len(documents))
+	var firstErr error
+	var firstFailure *processResult
+	for i, document := range documents {
+		result, err := h.runResult(ctx, tenant, document.Invoice, document.Stats, document.Err, params.UseVisionModel)
+		result.Pages = document.Pages
+		result.Region = document.Region
+		results[i] = result
+		addUsage(response.Usage, result.Usage)
+		response.OCRDuration += result.OCRDuration
+		response.AIDuration += result.AIDuration
+
+		item := SplitDocument{Pages: document.Pages, Region: document.Region, Diagnostics: result.Diagnostics}
+		if err != nil {
+			failure := h.failureResponse(err, result, params.RedactPII, 0)
+			item.Error, item.Code, item.Stage = failure.Error, failure.Code, failure.Stage
+			if firstErr == nil {
+				firstErr, firstFailure = err, result
+			}
+		} else {
+			response.Success = true
+		}
+		response.Documents = append(response.Documents, item)
+	}
+	h.recordUsage(r, *response.Usage)
+	response.TotalDuration = time.Since(startTime).Seconds()
+
+	if !response.Success {
+		h.sendFailure(w, r, firstErr, firstFailure, params.RedactPII, fields, response.TotalDuration)
+		return
+	}
+
+	for i, result := range results {
+		if result.Invoice == nil || response.Documents[i].Error != "" {
+			continue
+		}
+		if params.RedactPII {
+			result.Invoice.RawText = redact.Text(result.Invoice.RawText)
+		}
+		// Each invoice keeps only its own pages or area, not the other
+		// documents of the upload
+		original, contentType, err := documents[i].Original(imageData)
+		if err != nil {
+			h.sendError(w, http.StatusInternalServerError, "Failed to store invoice")
+			return
+		}
+		if contentType == "" {
+			contentType = header.Header.Get("Content-Type")
+		}
+		err = h.archiveInvoice(ctx, tenant, params, header.Filename, contentType, result, response.TotalDuration, original)
+		if err != nil {
+			h.sendError(w, http.StatusInternalServerError, "Failed to store invoice")
+			return
+		}
+		response.Documents[i].Invoice = fields.shapeInvoice(result.Invoice)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// processPages re-runs extraction on the pages of a split upload an invoice was found on
+func (h *Handler) processPages(ctx context.Context, tenant *tenantSettings, imageData []byte, pages []int, params models.ProcessRequest) (*processResult, error) {
+	options := h.pipelineOptions(tenant, params)
+	options.Language = params.Language
+	options.UseVisionModel = params.UseVisionModel
+
+	invoice, stats, err := pipeline.ProcessPages(ctx, imageData, pages, options)
+	result, err := h.runResult(ctx, tenant, invoice, stats, err, params.UseVisionModel)
+	result.Pages = pages
+	return result, err
+}
+
+// processRegion re-runs extraction on the area of a segmented photo a receipt was found in
+func (h *Handler) processRegion(ctx context.Context, tenant *tenantSettings, imageData []byte, region models.Region, params models.ProcessRequest) (*processResult, error) {
+	options := h.pipelineOptions(tenant, params)
+	options.Language = params.Language
+	options.UseVisionModel = params.UseVisionModel
+
+	invoice, stats, err := pipeline.ProcessRegion(ctx, imageData, region, options)
+	result, err := h.runResult(ctx, tenant, invoice, stats, err, params.UseVisionModel)
+	result.Region = &region
+	return result, err
+}
+
+// addUsage adds u to total
+func addUsage(total *models.Usage, u models.Usage) {
+	total.Pages += u.Pages
+	total.PromptTokens += u.PromptTokens
+	total.CompletionTokens += u.CompletionTokens
+	total.EstimatedCost += u.EstimatedCost
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// uncategorized groups invoices without categories in the stats
+const uncategorized = "Uncategorized"
+
+// StatsResponse summarizes the stored invoices of a tenant over a date range
+type StatsResponse struct {
+	From              string          `json:"from,omitempty"`
+	To                string          `json:"to,omitempty"`
+	Count             int             `json:"count"`
+	Reprocessed       int             `json:"reprocessed"` // Invoices extracted more than once
+	Total             decimal.Decimal `json:"total"`
+	Tax               decimal.Decimal `json:"tax"`
+	AverageConfidence float64         `json:"averageConfidence"`
+	ByCategory        []StatsGroup    `json:"byCategory"` // Highest total first; an invoice counts in each of its categories
+	ByVendor          []StatsGroup    `json:"byVendor"`   // Highest total first
+	ByMonth           []StatsGroup    `json:"byMonth"`    // Oldest first, keyed YYYY-MM
+	ByProvider        []StatsGroup    `json:"byProvider"` // Most invoices first
+	Latency           LatencyStats    `json:"latency"`
+}
+
+// StatsGroup aggregates the invoices sharing a key
+type StatsGroup struct {
+	Key               string          `json:"key"`
+	Count             int             `json:"count"`
+	Total             decimal.Decimal `json:"total"`
+	AverageConfidence float64         `json:"averageConfidence"`
+}
+
+// LatencyStats summarizes processing durations in seconds. Invoices stored
+// before durations were recorded are not counted.
+type LatencyStats struct {
+	Samples int          `json:"samples"`
+	OCR     DurationStat `json:"ocr"`
+	AI      DurationStat `json:"ai"`
+	Total   DurationStat `json:"total"`
+}
+
+// DurationStat summarizes one duration
+type DurationStat struct {
+	Average float64 `json:"average"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	Max     float64 `json:"max"`
+}
+
+// GetStats reports counts, spend and processing latencies of the caller's
+// stored invoices. ?from= and ?to= (YYYY-MM-DD, inclusive) filter on the
+// invoice date, falling back to when it was processed.
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	from, to, ok := h.dateRange(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := h.tenantInvoices(h.resolveTenant(r), from, to)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "Failed to list invoices")
+		return
+	}
+
+	response := invoiceStats(records)
+	response.From = r.URL.Query().Get("from")
+	response.To = r.URL.Query().Get("to")
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// dateRange reads the ?from= and ?to= dates of a request, writing an error
+// response when one is invalid. Zero times mean no bound; to is exclusive.
+func (h *Handler) dateRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	query := r.URL.Query()
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+			return from, to, false
+		}
+		from = t
+	}
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+			return from, to, false
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	return from, to, true
+}
+
+// tenantInvoices returns the tenant's stored invoices dated in [from, to),
+// oldest first. Zero bounds are open.
+func (h *Handler) tenantInvoices(tenant *tenantSettings, from, to time.Time) ([]*models.StoredInvoice, error) {
+	records, err := h.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]*models.StoredInvoice, 0, len(records))
+	for _, record := range records {
+		if record.TenantID != tenant.ID || record.Invoice == nil {
+			continue
+		}
+		date := invoiceDate(record)
+		if (!from.IsZero() && date.Before(from)) || (!to.IsZero() && !date.Before(to)) {
+			continue
+		}
+		visible = append(visible, record)
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		return invoiceDate(visible[i]).Before(invoiceDate(visible[j]))
+	})
+	return visible, nil
+}
+
+// invoiceDate returns the date on a stored invoice, or when it was processed
+// if the AI found none
+func invoiceDate(record *models.StoredInvoice) time.Time {
+	if !record.Invoice.Date.IsZero() {
+		return record.Invoice.Date
+	}
+	return record.CreatedAt
+}
+
+// statsAccumulator builds a StatsGroup
+type statsAccumulator struct {
+	count      int
+	total      decimal.Decimal
+	confidence float64
+}
+
+func (a *statsAccumulator) add(invoice *models.Invoice) {
+	a.count++
+	a.total = a.total.Add(invoice.Total)
+	a.confidence += invoice.Confidence
+}
+
+func (a *statsAccumulator) group(key string) StatsGroup {
+	group := StatsGroup{Key: key, Count: a.count, Total: a.total}
+	if a.count > 0 {
+		group.AverageConfidence = a.confidence / float64(a.count)
+	}
+	return group
+}
+
+// invoiceStats aggregates stored invoices
+func invoiceStats(records []*models.StoredInvoice) StatsResponse {
+	var (
+		all                          statsAccumulator
+		tax                          decimal.Decimal
+		byCategory, byVendor         = map[string]*statsAccumulator{}, map[string]*statsAccumulator{}
+		byMonth, byProvider          = map[string]*statsAccumulator{}, map[string]*statsAccumulator{}
+		ocrTimes, aiTimes, totalTime []float64
+		reprocessed                  int
+	)
+	add := func(groups map[string]*statsAccumulator, key string, invoice *models.Invoice) {
+		acc, ok := groups[key]
+		if !ok {
+			acc = &statsAccumulator{}
+			groups[key] = acc
+		}
+		acc.add(invoice)
+	}
+
+	for _, record := range records {
+		invoice := record.Invoice
+		all.add(invoice)
+		tax = tax.Add(invoice.Tax)
+		if record.Reprocessed > 0 {
+			reprocessed++
+		}
+
+		categories := invoice.Categories
+		if len(categories) == 0 {
+			categories = []string{uncategorized}
+		}
+		for _, category := range categories {
+			add(byCategory, category, invoice)
+		}
+		vendor := strings.TrimSpace(invoice.Vendor)
+		if vendor == "" {
+			vendor = "Unknown Vendor"
+		}
+		add(byVendor, vendor, invoice)
+		add(byMonth, invoiceDate(record).Format("2006-01"), invoice)
+		add(byProvider, record.AIProvider, invoice)
+
+		if record.TotalDuration > 0 {
+			ocrTimes = append(ocrTimes, record.OCRDuration)
+			aiTimes = append(aiTimes, record.AIDuration)
+			totalTime = append(totalTime, record.TotalDuration)
+		}
+	}
+
+	overall := all.group("")
+	return StatsResponse{
+		Count:             overall.Count,
+		Reprocessed:       reprocessed,
+		Total:             overall.Total,
+		Tax:               tax,
+		AverageConfidence: overall.AverageConfidence,
+		ByCategory:        sortedGroups(byCategory, byTotal),
+		ByVendor:          sortedGroups(byVendor, byTotal),
+		ByMonth:           sortedGroups(byMonth, byKey),
+		ByProvider:        sortedGroups(byProvider, byCount),
+		Latency: LatencyStats{
+			Samples: len(totalTime),
+			OCR:     durationStat(ocrTimes),
+			AI:      durationStat(aiTimes),
+			Total:   durationStat(totalTime),
+		},
+	}
+}
+
+// Orderings of stats groups
+func byTotal(a, b StatsGroup) bool {
+	if c := a.Total.Cmp(b.Total); c != 0 {
+		return c > 0
+	}
+	return a.Key < b.Key
+}
+
+func byCount(a, b StatsGroup) bool {
+	if a.Count != b.Count {
+		return a.Count > b.Count
+	}
+	return a.Key < b.Key
+}
+
+func byKey(a, b StatsGroup) bool { return a.Key < b.Key }
+
+// sortedGroups converts accumulators to groups in the given order
+func sortedGroups(groups map[string]*statsAccumulator, less func(a, b StatsGroup) bool) []StatsGroup {
+	result := make([]StatsGroup, 0, len(groups))
+	for key, acc := range groups {
+		result = append(result, acc.group(key))
+	}
+	sort.Slice(result, func(i, j int) bool { return less(result[i], result[j]) })
+	return result
+}
+
+// durationStat summarizes durations; it sorts values in place
+func durationStat(values []float64) DurationStat {
+	if len(values) == 0 {
+		return DurationStat{}
+	}
+	sort.Float64s(values)
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return DurationStat{
+		Average: sum / float64(len(values)),
+		P50:     percentile(values, 0.50),
+		P95:     percentile(values, 0.95),
+		Max:     values[len(values)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
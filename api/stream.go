@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+const (
+	// textPreviewLength is the number of characters of OCR text sent with ocr_done
+	textPreviewLength = 200
+
+	// heartbeatInterval keeps proxies from closing a stream during a long AI call
+	heartbeatInterval = 15 * time.Second
+)
+
+// Terminal events of a progress stream
+const (
+	EventCompleted = "completed"
+	EventError     = "error"
+)
+
+// ProgressEvent is the data of a stage event
+type ProgressEvent struct {
+	Stage       string  `json:"stage"`
+	TextPreview string  `json:"textPreview,omitempty"` // Start of the OCR text, with ocr_done
+	Elapsed     float64 `json:"elapsed"`               // Seconds since the request started
+}
+
+// ProcessInvoiceStream is the Server-Sent Events variant of ProcessInvoice.
+// It takes the same form and streams an event as each stage starts or ends:
+// preprocessing, ocr_started, ocr_done, ai_started, then completed with the
+// usual response body or error with the failure response.
+func (h *Handler) ProcessInvoiceStream(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	startTime := time.Now()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.sendError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	imageData, header, ok := h.readUpload(w, r)
+	if !ok {
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	params, err := h.processParams(r, tenant)
+	if err != nil {
+		h.sendGenerationError(w, err)
+		return
+	}
+	fields, err := parseResponseFields(r)
+	if err != nil {
+		h.sendResponseFieldsError(w, err)
+		return
+	}
+
+	// Errors from here on are sent as events
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+	stream := &eventStream{w: w, flusher: flusher}
+	flusher.Flush()
+
+	stop := stream.heartbeat(heartbeatInterval)
+	defer stop()
+
+	result, err := h.processInvoice(
+		r.Context(),
+		tenant,
+		imageData,
+		params,
+		func(event pipeline.Event) {
+			data := ProgressEvent{
+				Stage:   event.Stage,
+				Elapsed: time.Since(startTime).Seconds(),
+			}
+			if event.Text != "" {
+				text := event.Text
+				if params.RedactPII {
+					text = redact.Text(text)
+				}
+				data.TextPreview = preview(text, textPreviewLength)
+			}
+			stream.send(event.Stage, data)
+		},
+	)
+	h.recordUsage(r, result.Usage)
+
+	totalDuration := time.Since(startTime).Seconds()
+
+	if err != nil {
+		response := h.failureResponse(err, result, params.RedactPII, totalDuration)
+		response.RequestID = requestid.FromContext(r.Context())
+		h.logFailure(r, err, response, totalDuration)
+		stream.send(EventError, fields.apply(response))
+		return
+	}
+	invoice := result.Invoice
+
+	if params.RedactPII {
+		invoice.RawText = redact.Text(invoice.RawText)
+	}
+
+	err = h.archiveInvoice(r.Context(), tenant, params, header.Filename, header.Header.Get("Content-Type"), result, totalDuration, imageData)
+	if err != nil {
+		stream.send(EventError, models.ErrorResponse{
+			Error:     "Failed to store invoice",
+			Code:      CodeInternal,
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+
+	stream.send(EventCompleted, fields.apply(models.ProcessResponse{
+		Success:       true,
+		Invoice:       invoice,
+		OCRDuration:   result.OCRDuration,
+		AIDuration:    result.AIDuration,
+		TotalDuration: totalDuration,
+		Usage:         &result.Usage,
+		Diagnostics:   result.Diagnostics,
+		RequestID:     requestid.FromContext(r.Context()),
+	}))
+}
+
+// eventStream writes Server-Sent Events, flushing each one
+type eventStream struct {
+	mu      sync.Mutex // Heartbeats are written from another goroutine
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// send writes an event with data encoded as JSON
+func (s *eventStream) send(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	s.flusher.Flush()
+}
+
+// heartbeat writes a comment line every interval until the returned func is called
+func (s *eventStream) heartbeat(interval time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				fmt.Fprint(s.w, ": keep-alive\n\n")
+				s.flusher.Flush()
+				s.mu.Unlock()
+			}
+		}
+	}()
+
+	// Wait for the goroutine so it never writes after the handler returned
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// preview returns the first n characters of text
+func preview(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// tenantSettings is the effective configuration for the caller's tenant
+type tenantSettings struct {
+	ID         string // Empty for the default (untenanted) scope
+	AI         models.AIConfig
+	Categories []string
+	Prompt     string
+	Export     models.ExportConfig
+	Expenses   models.ExpensesConfig
+
+	Integrations models.IntegrationsConfig
+	Webhooks     []models.WebhookConfig
+	Mail         models.MailConfig
+}
+
+// validateTenants checks tenant ids and that every API key references a known tenant
+func validateTenants(config *models.Config) error {
+	seen := make(map[string]bool, len(config.Tenants))
+	for _, t := range config.Tenants {
+		if t.ID == "" {
+			return fmt.Errorf("tenant entries require an id")
+		}
+		if seen[t.ID] {
+			return fmt.Errorf("duplicate tenant id: %s", t.ID)
+		}
+		seen[t.ID] = true
+	}
+
+	for _, k := range config.Auth.APIKeys {
+		if k.Tenant == "" {
+			continue
+		}
+		if !seen[k.Tenant] {
+			return fmt.Errorf("api key %s references unknown tenant %s", k.Name, k.Tenant)
+		}
+	}
+
+	return nil
+}
+
+// findTenant returns the configured tenant with the given id
+func findTenant(config *models.Config, id string) (models.TenantConfig, bool) {
+	for _, t := range config.Tenants {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return models.TenantConfig{}, false
+}
+
+// tenantKey is the context key of the caller's tenant settings
+type tenantKey struct{}
+
+// withTenant stores the settings of the caller's tenant in ctx. It returns
+// false when the caller belongs to a tenant that is not configured, e.g. one
+// named by a token or removed by a reload.
+func (h *Handler) withTenant(ctx context.Context) (context.Context, bool) {
+	id := ""
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		id = identity.Tenant
+	}
+	tenant, ok := h.tenantByID(id)
+	if !ok {
+		return ctx, false
+	}
+	return context.WithValue(ctx, tenantKey{}, tenant), true
+}
+
+// requireTenant rejects callers of unknown tenants with 403 and stores the
+// settings of the others' tenant for resolveTenant
+func (h *Handler) requireTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, ok := h.withTenant(r.Context())
+		if !ok {
+			logging.FromContext(ctx).Warn("unknown tenant rejected", "remote_addr", r.RemoteAddr)
+			w.Header().Set("Content-Type", "application/json")
+			h.sendError(w, http.StatusForbidden, "Unknown tenant")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// resolveTenant returns the settings of the tenant the request belongs to
+func (h *Handler) resolveTenant(r *http.Request) *tenantSettings {
+	return h.tenantFrom(r.Context())
+}
+
+// tenantFrom returns the settings of the caller's tenant stored in ctx by
+// withTenant, which every API request and call goes through
+func (h *Handler) tenantFrom(ctx context.Context) *tenantSettings {
+	if tenant, ok := ctx.Value(tenantKey{}).(*tenantSettings); ok {
+		return tenant
+	}
+	return h.defaultTenant()
+}
+
+// defaultTenant returns the settings of the default (untenanted) scope
+func (h *Handler) defaultTenant() *tenantSettings {
+	tenant, _ := h.tenantByID("")
+	return tenant
+}
+
+// tenantByID returns the settings of a tenant, and false when the tenant is
+// not configured. Settings not overridden by the tenant fall back to the
+// global config; the empty ID is the default scope.
+func (h *Handler) tenantByID(id string) (*tenantSettings, bool) {
+	config := h.cfg()
+	settings := &tenantSettings{
+		ID:         id,
+		AI:         config.AI,
+		Categories: config.Categories,
+		Prompt:     config.Prompt,
+		Export:     config.Export,
+		Expenses:   config.Expenses,
+
+		Integrations: config.Integrations,
+		Webhooks:     config.Webhooks.Endpoints,
+		Mail:         config.Mail,
+	}
+
+	if id == "" {
+		return settings, true
+	}
+	tenant, ok := findTenant(config, id)
+	if !ok {
+		return nil, false
+	}
+
+	settings.AI = mergeAIConfig(settings.AI, tenant.AI)
+	if len(tenant.Categories) > 0 {
+		settings.Categories = tenant.Categories
+	}
+	if tenant.Prompt != "" {
+		settings.Prompt = tenant.Prompt
+	}
+	if tenant.Export.Currency != "" {
+		settings.Export.Currency = tenant.Export.Currency
+	}
+	if tenant.Export.Buyer.Name != "" {
+		settings.Export.Buyer = tenant.Export.Buyer
+	}
+	if tenant.Export.Facturae.Seller.Name != "" {
+		settings.Export.Facturae.Seller = tenant.Export.Facturae.Seller
+	}
+	if f := tenant.Export.Facturae; f.AccountingOffice != "" || f.ManagingBody != "" || f.ProcessingUnit != "" {
+		settings.Export.Facturae.AccountingOffice = f.AccountingOffice
+		settings.Export.Facturae.ManagingBody = f.ManagingBody
+		settings.Export.Facturae.ProcessingUnit = f.ProcessingUnit
+	}
+	if len(tenant.Export.Facturae.SignCommand) > 0 {
+		settings.Export.Facturae.SignCommand = tenant.Export.Facturae.SignCommand
+	}
+	settings.Expenses = mergeExpenses(settings.Expenses, tenant.Expenses)
+	if tenant.Integrations.Odoo.URL != "" {
+		settings.Integrations.Odoo = tenant.Integrations.Odoo
+	}
+	if tenant.Integrations.ReceiptWrangler.URL != "" {
+		settings.Integrations.ReceiptWrangler = tenant.Integrations.ReceiptWrangler
+	}
+	if tenant.Mail.Host != "" {
+		settings.Mail = tenant.Mail
+	} else if len(tenant.Mail.To) > 0 {
+		settings.Mail.To = tenant.Mail.To
+	}
+	if len(tenant.Webhooks) > 0 {
+		settings.Webhooks = append(append([]models.WebhookConfig{}, settings.Webhooks...), tenant.Webhooks...)
+	}
+
+	return settings, true
+}
+
+// mergeExpenses overlays the non-empty fields of override on base
+func mergeExpenses(base, override models.ExpensesConfig) models.ExpensesConfig {
+	merged := base
+	if override.PerDiem != 0 {
+		merged.PerDiem = override.PerDiem
+	}
+	if len(override.PerDiemCategories) > 0 {
+		merged.PerDiemCategories = override.PerDiemCategories
+	}
+	if override.MaxAmount != 0 {
+		merged.MaxAmount = override.MaxAmount
+	}
+	if len(override.CategoryLimits) > 0 {
+		merged.CategoryLimits = override.CategoryLimits
+	}
+	if len(override.MonthlyLimits) > 0 {
+		merged.MonthlyLimits = override.MonthlyLimits
+	}
+	if len(override.BlockedCategories) > 0 {
+		merged.BlockedCategories = override.BlockedCategories
+	}
+	if override.MaxAgeDays != 0 {
+		merged.MaxAgeDays = override.MaxAgeDays
+	}
+	if override.RequireApproval {
+		merged.RequireApproval = true
+	}
+	return merged
+}
+
+// mergeAIConfig overlays the non-empty fields of override on base
+func mergeAIConfig(base, override models.AIConfig) models.AIConfig {
+	merged := base
+
+	if override.DefaultProvider != "" {
+		merged.DefaultProvider = override.DefaultProvider
+	}
+
+	if override.OpenAI.APIKey != "" {
+		merged.OpenAI.APIKey = override.OpenAI.APIKey
+	}
+	if override.OpenAI.BaseURL != "" {
+		merged.OpenAI.BaseURL = override.OpenAI.BaseURL
+	}
+	if override.OpenAI.Model != "" {
+		merged.OpenAI.Model = override.OpenAI.Model
+	}
+	if override.OpenAI.ImageDetail != "" {
+		merged.OpenAI.ImageDetail = override.OpenAI.ImageDetail
+	}
+	if override.OpenAI.MaxImageTokens != 0 {
+		merged.OpenAI.MaxImageTokens = override.OpenAI.MaxImageTokens
+	}
+
+	if override.Gemini.APIKey != "" {
+		merged.Gemini.APIKey = override.Gemini.APIKey
+	}
+	if override.Gemini.Model != "" {
+		merged.Gemini.Model = override.Gemini.Model
+	}
+
+	if override.Ollama.BaseURL != "" {
+		merged.Ollama.BaseURL = override.Ollama.BaseURL
+	}
+	if override.Ollama.Model != "" {
+		merged.Ollama.Model = override.Ollama.Model
+	}
+	if override.Ollama.KeepAlive != "" {
+		merged.Ollama.KeepAlive = override.Ollama.KeepAlive
+	}
+
+	// The extractor's settings belong together, so they are replaced as a whole
+	if len(override.External.Command) > 0 || override.External.URL != "" {
+		merged.External = override.External
+	}
+
+	return merged
+}
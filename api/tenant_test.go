@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func newTenantHandler() *Handler {
+	h := &Handler{}
+	h.config.Store(&models.Config{
+		Prompt:  "global prompt",
+		Tenants: []models.TenantConfig{{ID: "acme", Prompt: "acme prompt"}},
+	})
+	return h
+}
+
+func TestTenantByID(t *testing.T) {
+	h := newTenantHandler()
+
+	tests := []struct {
+		id     string
+		ok     bool
+		prompt string
+	}{
+		{"", true, "global prompt"},
+		{"acme", true, "acme prompt"},
+		{"globex", false, ""},
+	}
+	for _, tt := range tests {
+		tenant, ok := h.tenantByID(tt.id)
+		if ok != tt.ok {
+			t.Errorf("tenantByID(%q) ok = %v, want %v", tt.id, ok, tt.ok)
+			continue
+		}
+		if ok && (tenant.ID != tt.id || tenant.Prompt != tt.prompt) {
+			t.Errorf("tenantByID(%q) = %+v", tt.id, tenant)
+		}
+	}
+}
+
+func TestRequireTenant(t *testing.T) {
+	h := newTenantHandler()
+
+	tests := []struct {
+		name     string
+		identity *auth.Identity
+		status   int
+		tenant   string
+	}{
+		{"unauthenticated", nil, http.StatusOK, ""},
+		{"default scope", &auth.Identity{Name: "app", Method: "api_key"}, http.StatusOK, ""},
+		{"configured tenant", &auth.Identity{Name: "ana", Method: "jwt", Tenant: "acme"}, http.StatusOK, "acme"},
+		{"unknown tenant", &auth.Identity{Name: "eve", Method: "jwt", Tenant: "globex"}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tenant *tenantSettings
+			handler := h.requireTenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tenant = h.resolveTenant(r)
+			}))
+
+			r := httptest.NewRequest("GET", "/api/v1/invoices", nil)
+			if tt.identity != nil {
+				r = r.WithContext(auth.WithIdentity(r.Context(), tt.identity))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				if tenant != nil {
+					t.Error("handler ran for a rejected tenant")
+				}
+				return
+			}
+			if tenant == nil || tenant.ID != tt.tenant {
+				t.Errorf("tenant = %+v, want %q", tenant, tt.tenant)
+			}
+		})
+	}
+}
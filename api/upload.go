@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+)
+
+// sniffLen is how much of an upload is read to detect its type
+const sniffLen = 512
+
+// typeAliases map the non-standard content types clients declare to the
+// sniffed ones
+var typeAliases = map[string]string{
+	"image/jpg":         "image/jpeg",
+	"image/pjpeg":       "image/jpeg",
+	"image/x-png":       "image/png",
+	"image/x-ms-bmp":    "image/bmp",
+	"image/x-tiff":      "image/tiff",
+	"image/heif":        "image/heic",
+	"application/x-pdf": "application/pdf",
+}
+
+// uploadError is an upload refused for its size or type
+type uploadError struct {
+	status   int
+	code     string
+	message  string
+	sniffed  string
+	declared string
+}
+
+// maxUploadSize returns the upload limit in bytes
+func (h *Handler) maxUploadSize() int64 {
+	return int64(h.cfg().Uploads.MaxSizeMB) << 20
+}
+
+// maxJSONUploadSize allows for the base64 overhead of a maxUploadSize image
+func (h *Handler) maxJSONUploadSize() int64 {
+	return h.maxUploadSize()*4/3 + 64*1024
+}
+
+// tooLarge returns the error of an upload above the size limit
+func (h *Handler) tooLarge() *uploadError {
+	return &uploadError{
+		status:  http.StatusRequestEntityTooLarge,
+		code:    CodeFileTooLarge,
+		message: fmt.Sprintf("File too large (max %d bytes)", h.maxUploadSize()),
+	}
+}
+
+// checkUpload checks the size of an upload and its type, sniffed from head,
+// its first bytes, against the allow-list. A declared type, "" when there is
+// none, must match the sniffed one.
+func (h *Handler) checkUpload(head []byte, size int64, declared string) *uploadError {
+	if size > h.maxUploadSize() {
+		return h.tooLarge()
+	}
+
+	sniffed := imagedata.DetectMIMEType(head)
+	if !typeAllowed(sniffed, h.cfg().Uploads.AllowedTypes) {
+		return &uploadError{
+			status:   http.StatusUnsupportedMediaType,
+			code:     CodeUnsupportedType,
+			message:  fmt.Sprintf("Unsupported file type %s", sniffed),
+			sniffed:  sniffed,
+			declared: declared,
+		}
+	}
+	if canonical := canonicalType(declared); canonical != "" && canonical != "application/octet-stream" && canonical != sniffed {
+		return &uploadError{
+			status:   http.StatusUnsupportedMediaType,
+			code:     CodeUnsupportedType,
+			message:  fmt.Sprintf("Declared type %s does not match the content, which is %s", declared, sniffed),
+			sniffed:  sniffed,
+			declared: declared,
+		}
+	}
+	return nil
+}
+
+// sendUploadError reports a refused upload with the sniffed type and the limits
+func (h *Handler) sendUploadError(w http.ResponseWriter, e *uploadError) {
+	response := models.ErrorResponse{
+		Error:        e.message,
+		Code:         e.code,
+		RequestID:    w.Header().Get(requestid.Header),
+		ContentType:  e.sniffed,
+		DeclaredType: e.declared,
+		MaxSize:      h.maxUploadSize(),
+	}
+	if e.code == CodeUnsupportedType {
+		response.AllowedTypes = h.cfg().Uploads.AllowedTypes
+	}
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// typeAllowed reports whether contentType is in allowed, which may hold
+// wildcards like "image/*"
+func typeAllowed(contentType string, allowed []string) bool {
+	major, _, _ := strings.Cut(contentType, "/")
+	for _, a := range allowed {
+		if a == contentType || a == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalType returns a declared content type without parameters, in
+// lowercase and with aliases resolved; "" stays ""
+func canonicalType(declared string) string {
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(declared))
+	}
+	if alias, ok := typeAliases[mediaType]; ok {
+		return alias
+	}
+	return mediaType
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/usage"
+	"github.com/facturaIA/invoice-ocr-service/internal/webhook"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// anonymousKey identifies callers when authentication is disabled
+const anonymousKey = "anonymous"
+
+// BudgetResponse represents the service-wide spend and its limits
+type BudgetResponse struct {
+	Spend    usage.Spend            `json:"spend"`
+	Daily    float64                `json:"daily,omitempty"`   // Limit in USD
+	Monthly  float64                `json:"monthly,omitempty"` // Limit in USD
+	Exceeded bool                   `json:"exceeded"`
+	Fallback *models.BudgetFallback `json:"fallback,omitempty"` // In use while exceeded
+}
+
+// UsageResponse represents the usage report of one caller
+type UsageResponse struct {
+	Key          string                  `json:"key"`
+	CurrentMonth usage.Totals            `json:"currentMonth"`
+	History      map[string]usage.Totals `json:"history"`
+	Quota        *models.QuotaConfig     `json:"quota,omitempty"`
+}
+
+// GetUsage reports usage of the caller, or of any key for admins (?key=).
+// Tenant admins only see the API keys of their own tenant.
+func (h *Handler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.usage == nil {
+		h.sendError(w, http.StatusNotFound, "Usage accounting is not enabled")
+		return
+	}
+
+	key := callerKey(r)
+	identity, _ := auth.IdentityFromContext(r.Context())
+	if requested := r.URL.Query().Get("key"); requested != "" && requested != key {
+		if identity == nil || !identity.Admin {
+			h.sendError(w, http.StatusForbidden, "Admin credentials required to view other keys")
+			return
+		}
+		if requested != "*" && !h.usageVisible(identity, requested) {
+			h.sendError(w, http.StatusNotFound, "Usage key not found")
+			return
+		}
+		key = requested
+	}
+
+	// Admins can list all keys with ?key=*
+	if key == "*" {
+		reports := make([]UsageResponse, 0)
+		for _, k := range h.usage.Keys() {
+			if !h.usageVisible(identity, k) {
+				continue
+			}
+			reports = append(reports, h.usageReport(k))
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": reports,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.usageReport(key))
+}
+
+// usageVisible reports whether an admin may see the usage of key: global
+// admins see every key, tenant admins only API keys of their own tenant
+func (h *Handler) usageVisible(identity *auth.Identity, key string) bool {
+	if identity == nil || identity.Tenant == "" {
+		return true
+	}
+	name, ok := strings.CutPrefix(key, "api_key:")
+	if !ok || h.keys == nil {
+		return false
+	}
+	tenant, exists := h.keys.Tenant(name)
+	return exists && tenant == identity.Tenant
+}
+
+// usageReport builds the usage report of a key
+func (h *Handler) usageReport(key string) UsageResponse {
+	quota := h.quotaFor(key)
+	if defaults := h.cfg().Usage.DefaultQuota; quota == nil && defaults != (models.QuotaConfig{}) {
+		quota = &defaults
+	}
+
+	return UsageResponse{
+		Key:          key,
+		CurrentMonth: h.usage.Month(key),
+		History:      h.usage.History(key),
+		Quota:        quota,
+	}
+}
+
+// GetBudget reports the estimated spend of the current day and month against
+// usage.budget. With authentication enabled it requires an admin.
+func (h *Handler) GetBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.budget == nil {
+		h.sendError(w, http.StatusNotFound, "Usage accounting is not enabled")
+		return
+	}
+	if len(h.authn) > 0 {
+		identity, ok := auth.IdentityFromContext(r.Context())
+		if !ok || !identity.Admin {
+			h.sendError(w, http.StatusForbidden, "Admin credentials required to view the budget")
+			return
+		}
+	}
+
+	config := h.cfg().Usage.Budget
+	response := BudgetResponse{
+		Spend:    h.budget.Spend(),
+		Daily:    config.Daily,
+		Monthly:  config.Monthly,
+		Exceeded: h.budget.Exceeded(config),
+	}
+	if config.Fallback != (models.BudgetFallback{}) {
+		response.Fallback = &config.Fallback
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// recordSpend adds the estimated cost of a provider call to the budget,
+// logging and announcing the thresholds it reached
+func (h *Handler) recordSpend(cost float64) {
+	if h.budget == nil {
+		return
+	}
+	config := h.cfg()
+	alerts, err := h.budget.Add(cost, config.Usage.Budget)
+	if err != nil {
+		slog.Warn("failed to record budget spend", "error", err)
+	}
+	for i, alert := range alerts {
+		slog.Warn("AI budget threshold reached",
+			"period", alert.Period,
+			"threshold", alert.Threshold,
+			"limit", alert.Limit,
+			"spend", alert.Spend,
+		)
+		h.webhooks.Send(webhook.Event{
+			Event:     webhook.EventBudget,
+			Timestamp: time.Now().UTC(),
+			Budget:    &alerts[i],
+		}, config.Webhooks.Endpoints)
+	}
+}
+
+// applyBudgetFallback switches a run to the budget's fallback provider and
+// model once a limit is reached. Generation parameters are dropped when the
+// provider changes, since they may not apply to the new one.
+func (h *Handler) applyBudgetFallback(options *pipeline.Options) {
+	config := h.cfg().Usage.Budget
+	if h.budget == nil || config.Fallback == (models.BudgetFallback{}) || !h.budget.Exceeded(config) {
+		return
+	}
+	provider := options.Provider
+	if provider == "" {
+		provider = options.AI.DefaultProvider
+	}
+	if config.Fallback.Provider != "" && config.Fallback.Provider != provider {
+		options.Provider = config.Fallback.Provider
+		options.Generation = pipeline.Generation{}
+	}
+	options.Model = config.Fallback.Model
+}
+
+// enforceQuota rejects processing requests from callers that exhausted their monthly quota
+func (h *Handler) enforceQuota(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.usage != nil {
+			key := callerKey(r)
+			if exceeded, reason := h.usage.QuotaExceeded(key, h.quotaFor(key)); exceeded {
+				w.Header().Set("Content-Type", "application/json")
+				h.sendErrorCode(w, http.StatusTooManyRequests, CodeQuotaExceeded, fmt.Sprintf("Quota exceeded: %s", reason))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// recordUsage adds the usage of a processing request to the caller's totals
+func (h *Handler) recordUsage(r *http.Request, u models.Usage) {
+	h.recordUsageFor(callerKey(r), u)
+}
+
+// recordUsageFor adds usage to the totals of a caller key
+func (h *Handler) recordUsageFor(key string, u models.Usage) {
+	if h.usage == nil {
+		return
+	}
+	err := h.usage.Record(key, u)
+	if err != nil {
+		slog.Warn("failed to record usage", "caller", key, "error", err)
+	}
+}
+
+// quotaFor returns the quota configured on an API key, if any
+func (h *Handler) quotaFor(key string) *models.QuotaConfig {
+	keys := h.cfg().Auth.APIKeys
+	for i, k := range keys {
+		if "api_key:"+k.Name == key {
+			return keys[i].Quota
+		}
+	}
+	return nil
+}
+
+// callerKey identifies the caller of a request for accounting
+func callerKey(r *http.Request) string {
+	return callerKeyFrom(r.Context())
+}
+
+// callerKeyFrom identifies the authenticated caller stored in ctx
+func callerKeyFrom(ctx context.Context) string {
+	if identity, ok := auth.IdentityFromContext(ctx); ok {
+		return identity.Key()
+	}
+	return anonymousKey
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/vies"
+)
+
+// checkVendor finds the vendor's VAT number in the OCR text when vies or
+// registry is enabled, then checks it in VIES and looks it up in the company
+// registry. The tenant's own numbers, from the export config, are skipped.
+// Failed lookups are reported on the invoice and do not fail the extraction.
+func (h *Handler) checkVendor(ctx context.Context, tenant *tenantSettings, invoice *models.Invoice, rawText string) {
+	config := h.cfg()
+	if (!config.VIES.Enabled && !config.Registry.Enabled) || rawText == "" {
+		return
+	}
+	number := vies.Find(rawText, tenant.Export.Buyer.TaxID, tenant.Export.Facturae.Seller.TaxID)
+	if number == "" {
+		return
+	}
+
+	invoice.VATNumber = number
+	if config.VIES.Enabled {
+		h.checkVAT(ctx, invoice, config.VIES)
+	}
+	if countries := config.Registry.Countries; config.Registry.Enabled && (len(countries) == 0 || slices.Contains(countries, number[:2])) {
+		h.enrichVendor(ctx, invoice, config.Registry)
+	}
+}
+
+// checkVAT checks the invoice's VAT number in VIES
+func (h *Handler) checkVAT(ctx context.Context, invoice *models.Invoice, config models.VIESConfig) {
+	check, err := h.vies.Check(ctx, invoice.VATNumber, config)
+	if err != nil {
+		logging.FromContext(ctx).Warn("VIES lookup failed", "vat_number", invoice.VATNumber, "error", err)
+		check = &models.VATCheck{Error: err.Error(), CheckedAt: time.Now().UTC()}
+	}
+	invoice.VATCheck = check
+}
+
+// enrichVendor looks the invoice's VAT number up in the company registry,
+// replacing the vendor by its legal name with registry.replace_vendor
+func (h *Handler) enrichVendor(ctx context.Context, invoice *models.Invoice, config models.RegistryConfig) {
+	info, err := h.registry.Lookup(ctx, invoice.VATNumber, config)
+	if err != nil {
+		logging.FromContext(ctx).Warn("company registry lookup failed", "vat_number", invoice.VATNumber, "error", err)
+		info = &models.VendorInfo{Error: err.Error(), CheckedAt: time.Now().UTC()}
+	}
+	invoice.VendorInfo = info
+	if config.ReplaceVendor && info.LegalName != "" {
+		invoice.Vendor = info.LegalName
+		invoice.SetProvenance(models.Provenance{Source: models.SourceRegistry}, "vendor")
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/buildinfo"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// VersionResponse describes the running build and the features enabled in its config
+type VersionResponse struct {
+	buildinfo.Info
+	Features []string `json:"features"`
+}
+
+// GetVersion reports the build and enabled features, so support can tell
+// exactly what a deployment is running
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VersionResponse{
+		Info:     buildinfo.Get(),
+		Features: enabledFeatures(h.cfg()),
+	})
+}
+
+// enabledFeatures lists the optional features turned on in config, e.g. "jobs:redis"
+func enabledFeatures(config *models.Config) []string {
+	var features []string
+	add := func(enabled bool, name string) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+
+	add(true, "ocr:"+config.OCR.Engine)
+	for _, provider := range configuredProviders(config.AI) {
+		add(true, "provider:"+provider)
+	}
+	add(config.Auth.Enabled, "auth:"+config.Auth.Mode)
+	add(config.RateLimit.Enabled, "rate_limit")
+	add(config.Concurrency.MaxInFlight > 0, "concurrency_limit")
+	add(config.Usage.Enabled, "usage")
+	add(config.Storage.Enabled, "storage")
+	add(config.Storage.Enabled && config.Storage.EncryptionKey != "", "encryption")
+	add(config.Storage.Enabled && config.Storage.ArtifactTTL > 0, "retention")
+	add(config.Storage.Enabled && config.CategoryLearning.Enabled, "category_learning")
+	add(config.Jobs.Enabled, "jobs:"+config.Jobs.Backend)
+	add(len(config.Tenants) > 0, "tenants")
+	add(config.TLS.Enabled, "tls")
+	add(config.CORS.Enabled, "cors")
+	add(config.Compression.Enabled, "compression")
+	add(config.Tracing.Enabled, "tracing")
+	add(config.Offline.Enabled, "offline")
+	add(config.LegacyErrors, "legacy_errors")
+
+	sort.Strings(features)
+	return features
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// versionedRoute matches route templates carrying an API version, e.g. "/api/v1/jobs"
+var versionedRoute = regexp.MustCompile(`^/api/v[0-9]+/`)
+
+// canonicalRoute maps a legacy unversioned route to its /api/v1 equivalent,
+// so per-route settings apply to both
+func canonicalRoute(name string) string {
+	if strings.HasPrefix(name, "/api/") && !versionedRoute.MatchString(name) {
+		return "/api/v1/" + strings.TrimPrefix(name, "/api/")
+	}
+	return name
+}
+
+// deprecated marks responses of routes under prefix as deprecated in favour
+// of the same path under successor. The Sunset header is sent once a removal
+// date (YYYY-MM-DD) is configured.
+func deprecated(prefix, successor, sunset string) mux.MiddlewareFunc {
+	var sunsetHeader string
+	if date, err := time.Parse(time.DateOnly, sunset); err == nil {
+		sunsetHeader = date.UTC().Format(http.TimeFormat)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", "<"+successor+strings.TrimPrefix(r.URL.Path, prefix)+`>; rel="successor-version"`)
+			if sunsetHeader != "" {
+				w.Header().Set("Sunset", sunsetHeader)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/webhook"
+	"github.com/gorilla/mux"
+)
+
+// ApproveResponse is the response of ApproveInvoice
+type ApproveResponse struct {
+	ID         string    `json:"id"`
+	ApprovedAt time.Time `json:"approvedAt"`
+	ApprovedBy string    `json:"approvedBy,omitempty"`
+}
+
+// ApproveInvoice marks a stored invoice as approved and fires invoice.approved.
+// Approving an approved invoice keeps the first approval.
+func (h *Handler) ApproveInvoice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if h.store == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice storage is not enabled")
+		return
+	}
+
+	tenant := h.resolveTenant(r)
+	record, ok := h.loadInvoice(w, tenant, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if record.Invoice == nil {
+		h.sendError(w, http.StatusNotFound, "Invoice not found")
+		return
+	}
+
+	if record.ApprovedAt == nil {
+		now := time.Now()
+		record.ApprovedAt = &now
+		if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+			record.ApprovedBy = identity.Name
+		}
+		record.UpdatedAt = now
+		if err := h.store.Update(record); err != nil {
+			h.sendError(w, http.StatusInternalServerError, "Failed to store invoice")
+			return
+		}
+		h.send(tenant, webhook.EventApproved, record, record.Invoice)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ApproveResponse{
+		ID:         record.ID,
+		ApprovedAt: *record.ApprovedAt,
+		ApprovedBy: record.ApprovedBy,
+	})
+}
+
+// notify fires invoice.processed for a processed invoice,
+// invoice.needs_review when it has low confidence or no total, and
+// invoice.policy_violation when it went over a monthly limit. record is nil
+// when storage is disabled.
+func (h *Handler) notify(tenant *tenantSettings, record *models.StoredInvoice, invoice *models.Invoice) {
+	h.send(tenant, webhook.EventProcessed, record, invoice)
+	if invoice.Confidence < h.cfg().Webhooks.ReviewThreshold || invoice.Total.IsZero() {
+		h.send(tenant, webhook.EventNeedsReview, record, invoice)
+	}
+	if len(invoice.PolicyViolations) > 0 {
+		h.send(tenant, webhook.EventViolation, record, invoice)
+	}
+}
+
+// send fires an event at the tenant's webhooks
+func (h *Handler) send(tenant *tenantSettings, name string, record *models.StoredInvoice, invoice *models.Invoice) {
+	if len(tenant.Webhooks) == 0 {
+		return
+	}
+	event := webhook.Event{
+		Event:     name,
+		Timestamp: time.Now().UTC(),
+		TenantID:  tenant.ID,
+		Invoice:   invoice,
+		Record:    record,
+	}
+	if record != nil {
+		event.InvoiceID = record.ID
+	}
+	h.webhooks.Send(event, tenant.Webhooks)
+}
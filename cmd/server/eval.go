@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/catalog"
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/config"
+	"github.com/facturaIA/invoice-ocr-service/internal/correct"
+	"github.com/facturaIA/invoice-ocr-service/internal/eval"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/offline"
+	"github.com/facturaIA/invoice-ocr-service/internal/residency"
+	"github.com/facturaIA/invoice-ocr-service/internal/usage"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+)
+
+// evalOptions holds the flags of the eval command
+type evalOptions struct {
+	output      string
+	format      string
+	targets     []string
+	language    string
+	vision      bool
+	promptFile  string
+	tolerance   string
+	concurrency int
+}
+
+func newEvalCommand(configPath *string) *cobra.Command {
+	opts := evalOptions{}
+	cmd := &cobra.Command{
+		Use:   "eval <dir>",
+		Short: "Measure extraction quality against a labeled test set",
+		Long: `Runs every labeled document under dir through the pipeline and compares the
+extracted fields with the expected ones. A document is labeled by a JSON file
+next to it with the same name, e.g. receipt1.jpg and receipt1.json:
+
+  {"vendor": "Whole Foods Market", "date": "2024-03-02", "total": "84.12",
+   "tax": "6.12", "categories": ["Groceries"], "itemCount": 12}
+
+Fields left out are not scored. The report has per-field precision and
+recall, the distribution of total and tax errors, and latency, tokens and
+estimated cost (from usage.prices) for each --target.`,
+		Example: `  server eval ./testdata/invoices
+  server eval -t openai:gpt-4o-mini -t gemini --format json -o report.json ./testdata/invoices
+  server eval --prompt prompt-v2.txt ./testdata/invoices`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEval(*configPath, args[0], opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.output, "output", "o", "", "Write the report to this file instead of stdout")
+	flags.StringVarP(&opts.format, "format", "f", "text", "Report format: text or json (with per-document results)")
+	flags.StringArrayVarP(&opts.targets, "target", "t", nil, "Provider to evaluate as provider[:model], repeatable (default from config)")
+	flags.StringVar(&opts.language, "language", "", "OCR language (default from config)")
+	flags.BoolVar(&opts.vision, "vision", false, "Send images to a vision model instead of OCR text")
+	flags.StringVar(&opts.promptFile, "prompt", "", "Prompt template file to evaluate instead of the configured prompt")
+	flags.StringVar(&opts.tolerance, "tolerance", "0.01", "Largest amount difference counted as correct")
+	flags.IntVarP(&opts.concurrency, "concurrency", "j", 1, "Documents processed at once")
+
+	return cmd
+}
+
+// runEval evaluates the test set in dir and writes the report
+func runEval(configPath, dir string, opts evalOptions) error {
+	if opts.format != "text" && opts.format != "json" {
+		return fmt.Errorf("unsupported format: %s", opts.format)
+	}
+	tolerance, err := decimal.NewFromString(opts.tolerance)
+	if err != nil || tolerance.IsNegative() {
+		return fmt.Errorf("invalid tolerance: %s", opts.tolerance)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Logs go to stderr so stdout carries only the report
+	logger, err := logging.New(cfg.Logging, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to configure logging: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	guard, err := offline.Compile(cfg.Offline)
+	if err != nil {
+		return fmt.Errorf("invalid offline config: %w", err)
+	}
+	guard.Install()
+
+	targets := []eval.Target{{Provider: cfg.AI.DefaultProvider}}
+	if len(opts.targets) > 0 {
+		targets = nil
+		for _, s := range opts.targets {
+			target, err := eval.ParseTarget(s)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	cases, err := eval.LoadCases(dir)
+	if err != nil {
+		return err
+	}
+
+	options := pipeline.Options{
+		AI:             cfg.AI,
+		Language:       opts.language,
+		UseVisionModel: opts.vision,
+		OCREngine:      cfg.OCR.Engine,
+		Categories:     cfg.Categories,
+		Prompt:         cfg.Prompt,
+		AITimeout:      cfg.Timeouts.AI,
+
+		PageParallelism:  cfg.OCR.PageParallelism,
+		LanguageFallback: cfg.OCR.LanguageFallback,
+		OCRRetry:         cfg.OCR.Retry,
+		Handwriting:      cfg.OCR.Handwriting,
+	}
+	if options.Language == "" {
+		options.Language = cfg.OCR.Language
+	}
+	options.Correction, err = correct.Compile(cfg.OCR.Correction)
+	if err != nil {
+		return fmt.Errorf("invalid ocr.correction: %w", err)
+	}
+	options.Residency, err = residency.ForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid residency: %w", err)
+	}
+	options.Classifier, err = classify.Compile(cfg.Classifier)
+	if err != nil {
+		return fmt.Errorf("invalid classifier: %w", err)
+	}
+	options.Profiles, err = classify.CompileProfiles(cfg.Profiles)
+	if err != nil {
+		return fmt.Errorf("invalid profiles: %w", err)
+	}
+	options.Catalog, err = catalog.Load(cfg.Catalog)
+	if err != nil {
+		return fmt.Errorf("invalid catalog: %w", err)
+	}
+	if opts.promptFile != "" {
+		prompt, err := os.ReadFile(opts.promptFile)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt: %w", err)
+		}
+		options.Prompt = string(prompt)
+	}
+
+	// The tracker only prices calls here; nothing is recorded
+	prices, err := usage.NewTracker(models.UsageConfig{Prices: cfg.Usage.Prices})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("evaluating", "documents", len(cases), "targets", len(targets))
+	report, err := eval.Run(ctx, cases, targets, eval.Options{
+		Pipeline:    options,
+		Concurrency: opts.concurrency,
+		Tolerance:   tolerance,
+		Cost:        prices.EstimateCost,
+	}, func(result eval.Result) {
+		if result.Error != "" {
+			slog.Warn("processing failed", "case", result.Case, "target", result.Target, "stage", result.Stage, "error", result.Error)
+			return
+		}
+		slog.Debug("document evaluated", "case", result.Case, "target", result.Target, "mismatch", result.Mismatch)
+	})
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if opts.format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = eval.WriteText(out, report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
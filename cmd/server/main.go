@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/facturaIA/invoice-ocr-service/api"
+	"github.com/facturaIA/invoice-ocr-service/internal/config"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/ocr"
+	"github.com/facturaIA/invoice-ocr-service/internal/offline"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func main() {
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "config.yaml"
+	}
+	var selfTest bool
+
+	// Without a subcommand the binary runs the HTTP service, as before
+	root := &cobra.Command{
+		Use:          "server",
+		Short:        "Invoice OCR Service: extract structured data from invoice images",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			serve(configPath, selfTest)
+		},
+	}
+	root.PersistentFlags().StringVar(&configPath, "config", configPath, "Config file (default from CONFIG_PATH)")
+	root.Flags().BoolVar(&selfTest, "selftest", false, "Process a sample receipt before listening and exit with status 1 if it fails")
+	root.AddCommand(newProcessCommand(&configPath))
+	root.AddCommand(newEvalCommand(&configPath))
+	root.AddCommand(newSynthCommand())
+
+	// ImageMagick is set up once and shared by all requests and pages
+	ocr.InitMagick()
+
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// serve runs the HTTP (and gRPC) service until SIGTERM or SIGINT. With
+// selfTest, the pipeline is verified before the service listens.
+func serve(configPath string, selfTest bool) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fatal("failed to load config", err)
+	}
+
+	logger, err := logging.New(cfg.Logging, os.Stdout)
+	if err != nil {
+		fatal("failed to configure logging", err)
+	}
+	slog.SetDefault(logger)
+
+	guard, err := offline.Compile(cfg.Offline)
+	if err != nil {
+		fatal("invalid offline config", err)
+	}
+	guard.Install()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to configure tracing", err)
+	}
+
+	handler, err := api.NewHandler(cfg)
+	if err != nil {
+		fatal("failed to initialize handler", err)
+	}
+	if selfTest {
+		if err := handler.SelfTest(context.Background()); err != nil {
+			fatal("self-test failed", err)
+		}
+		slog.Info("self-test passed")
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Handler: handler.SetupRoutes(),
+	}
+
+	var challenges *http.Server
+	if cfg.TLS.Enabled {
+		server.TLSConfig, challenges, err = setupTLS(cfg.TLS)
+		if err != nil {
+			fatal("failed to configure TLS", err)
+		}
+	}
+
+	var grpcServer *grpc.Server
+	var grpcListener net.Listener
+	if cfg.GRPC.Enabled {
+		var options []grpc.ServerOption
+		if server.TLSConfig != nil {
+			options = append(options, grpc.Creds(credentials.NewTLS(server.TLSConfig)))
+		}
+		grpcServer = handler.NewGRPCServer(options...)
+		grpcListener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Host, cfg.GRPC.Port))
+		if err != nil {
+			fatal("failed to listen for gRPC", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP and file changes reload the config; reloads run one at a time
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	if cfg.Reload.WatchInterval > 0 {
+		go config.Watch(ctx, configPath, cfg.Reload.WatchInterval, func() {
+			select {
+			case reloads <- syscall.SIGHUP:
+			default:
+			}
+		})
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-reloads:
+				reload(configPath, handler)
+			}
+		}
+	}()
+
+	// Check the Ollama model in the background; a pull can take minutes. The
+	// health.selftest run follows it and holds /ready at not_ready until it passes.
+	go func() {
+		prepareOllama(ctx, cfg.AI)
+		if !cfg.Health.SelfTest || selfTest {
+			return
+		}
+		if err := handler.SelfTest(ctx); err != nil {
+			slog.Error("self-test failed, /ready reports not_ready", "error", err)
+			return
+		}
+		slog.Info("self-test passed")
+	}()
+
+	serverErr := make(chan error, 3)
+	go func() {
+		slog.Info("Invoice OCR Service listening", "addr", server.Addr, "tls", cfg.TLS.Enabled)
+		if cfg.TLS.Enabled {
+			// Certificates come from TLSConfig.GetCertificate
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		serverErr <- server.ListenAndServe()
+	}()
+	if grpcServer != nil {
+		go func() {
+			slog.Info("gRPC listening", "addr", grpcListener.Addr().String(), "tls", cfg.TLS.Enabled)
+			if err := grpcServer.Serve(grpcListener); err != nil {
+				serverErr <- fmt.Errorf("gRPC server: %w", err)
+			}
+		}()
+	}
+	if challenges != nil {
+		go func() {
+			slog.Info("ACME challenge listener started", "addr", challenges.Addr)
+			if err := challenges.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- fmt.Errorf("ACME challenge listener: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("server failed", err)
+		}
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Stop accepting connections and drain in-flight requests, then the job workers
+	slog.Info("shutting down, draining in-flight work", "timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("in-flight requests did not finish", "error", err)
+	}
+	if challenges != nil {
+		challenges.Shutdown(shutdownCtx)
+	}
+	if grpcServer != nil {
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+	if err := handler.Close(shutdownCtx); err != nil {
+		slog.Warn("handler shutdown incomplete", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Warn("failed to flush traces", "error", err)
+	}
+	slog.Info("shutdown complete")
+}
+
+// reload re-reads the config file and applies it, keeping the current config on error
+func reload(configPath string, handler *api.Handler) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		slog.Error("config reload failed, keeping current config", "error", err)
+		return
+	}
+	if err := handler.Reload(cfg); err != nil {
+		slog.Error("config reload failed, keeping current config", "error", err)
+	}
+}
+
+// stopGRPC waits for in-flight calls, closing the remaining streams once ctx expires
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Warn("in-flight gRPC calls did not finish", "error", ctx.Err())
+		server.Stop()
+	}
+}
+
+// fatal logs an error and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ai"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// ollamaPrepareTimeout bounds the startup model check, including a pull
+const ollamaPrepareTimeout = 30 * time.Minute
+
+// prepareOllama checks that the configured Ollama model is installed, pulling
+// it when missing and auto_pull is set, then loads it so the first request
+// does not pay for a cold load. Failures are logged; the service keeps
+// running and /health reports the model state.
+func prepareOllama(ctx context.Context, config models.AIConfig) {
+	if config.DefaultProvider != "ollama" && config.Ollama.BaseURL == "" {
+		return
+	}
+	if config.Recording.Mode == "replay" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, ollamaPrepareTimeout)
+	defer cancel()
+
+	if err := ensureOllamaModel(ctx, config); err != nil {
+		slog.Warn("Ollama model not ready", "model", config.Ollama.Model, "error", err)
+	}
+}
+
+// ensureOllamaModel runs the checks of prepareOllama
+func ensureOllamaModel(ctx context.Context, config models.AIConfig) error {
+	provider, err := pipeline.NewProvider(config, "ollama", "")
+	if err != nil {
+		return err
+	}
+	ollama, ok := provider.(*ai.OllamaProvider)
+	if !ok {
+		return nil
+	}
+
+	state, err := ollama.ModelState(ctx)
+	if err != nil {
+		return err
+	}
+	if !state.Installed {
+		if !config.Ollama.AutoPull {
+			return fmt.Errorf("model is not installed; run `ollama pull %s` or set ai.ollama.auto_pull", state.Name)
+		}
+		slog.Info("pulling Ollama model", "model", state.Name)
+		start := time.Now()
+		if err := ollama.Pull(ctx); err != nil {
+			return err
+		}
+		slog.Info("Ollama model pulled", "model", state.Name, "duration", time.Since(start).String())
+	}
+	if state.Loaded {
+		return nil
+	}
+
+	start := time.Now()
+	if err := ollama.Load(ctx); err != nil {
+		return err
+	}
+	slog.Info("Ollama model loaded", "model", state.Name, "duration", time.Since(start).String(), "keepAlive", config.Ollama.KeepAlive)
+	return nil
+}
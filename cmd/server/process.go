@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/catalog"
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/config"
+	"github.com/facturaIA/invoice-ocr-service/internal/correct"
+	"github.com/facturaIA/invoice-ocr-service/internal/hooks"
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/offline"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
+	"github.com/facturaIA/invoice-ocr-service/internal/residency"
+	"github.com/facturaIA/invoice-ocr-service/internal/rules"
+	"github.com/facturaIA/invoice-ocr-service/internal/scripts"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+	"github.com/spf13/cobra"
+)
+
+// imageExtensions are the files picked up when walking a directory
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true,
+	".tif": true, ".tiff": true, ".webp": true, ".pdf": true,
+}
+
+// csvHeader lists the columns of the CSV output
+var csvHeader = []string{
+	"file", "success", "vendor", "date", "total", "tax", "categories", "items",
+	"confidence", "error", "stage", "total_duration", "prompt_tokens", "completion_tokens",
+}
+
+// processOptions holds the flags of the process command
+type processOptions struct {
+	output      string
+	format      string
+	provider    string
+	model       string
+	language    string
+	vision      bool
+	profile     string
+	redactPII   bool
+	concurrency int
+}
+
+// processRecord is the output for one file
+type processRecord struct {
+	File string `json:"file"`
+	models.ProcessResponse
+}
+
+func newProcessCommand(configPath *string) *cobra.Command {
+	opts := processOptions{}
+	cmd := &cobra.Command{
+		Use:   "process <file|dir>...",
+		Short: "Extract invoices from local files without running the service",
+		Long: `Runs the extraction pipeline on image files and writes one result per file.
+Directories are walked recursively for images and PDFs. AI provider
+credentials, categories and the prompt come from the config file.
+
+Results are written as they finish: JSON Lines (one object per file) or CSV
+(one row per file). The exit status is 1 when any file failed.`,
+		Example: `  server process --format csv -o invoices.csv ./archive/2023
+  server process -j 4 --provider gemini scan1.jpg scan2.jpg`,
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProcess(*configPath, args, opts)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.output, "output", "o", "", "Write results to this file instead of stdout")
+	flags.StringVarP(&opts.format, "format", "f", "json", "Output format: json (JSON Lines) or csv")
+	flags.StringVar(&opts.provider, "provider", "", "AI provider: openai, gemini or ollama (default from config)")
+	flags.StringVar(&opts.model, "model", "", "Model name (default from config)")
+	flags.StringVar(&opts.language, "language", "", "OCR language (default from config)")
+	flags.BoolVar(&opts.vision, "vision", false, "Send images to a vision model instead of OCR text")
+	flags.StringVar(&opts.profile, "profile", "", "Prompt profile, e.g. fuel_receipt (default: picked by the classifier)")
+	flags.BoolVar(&opts.redactPII, "redact-pii", false, "Mask card numbers, IBANs and names in the raw text")
+	flags.IntVarP(&opts.concurrency, "concurrency", "j", 1, "Files processed at once")
+
+	return cmd
+}
+
+// runProcess processes the files and directories in paths. An interrupt stops
+// handing out files; those already started finish and are written.
+func runProcess(configPath string, paths []string, opts processOptions) error {
+	if opts.format != "json" && opts.format != "csv" {
+		return fmt.Errorf("unsupported format: %s", opts.format)
+	}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Logs go to stderr so stdout carries only results
+	logger, err := logging.New(cfg.Logging, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to configure logging: %w", err)
+	}
+	slog.SetDefault(logger)
+
+	guard, err := offline.Compile(cfg.Offline)
+	if err != nil {
+		return fmt.Errorf("invalid offline config: %w", err)
+	}
+	guard.Install()
+
+	files, err := collectFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no image files found")
+	}
+
+	out := io.Writer(os.Stdout)
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	writer, err := newRecordWriter(out, opts.format)
+	if err != nil {
+		return err
+	}
+
+	ruleSet, err := rules.Compile(cfg.Rules)
+	if err != nil {
+		return fmt.Errorf("invalid vendor rules: %w", err)
+	}
+	scriptSet, err := scripts.Compile(cfg.Scripts)
+	if err != nil {
+		return fmt.Errorf("invalid scripts: %w", err)
+	}
+	corrector, err := correct.Compile(cfg.OCR.Correction)
+	if err != nil {
+		return fmt.Errorf("invalid ocr.correction: %w", err)
+	}
+	policy, err := residency.ForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("invalid residency: %w", err)
+	}
+	classifier, err := classify.Compile(cfg.Classifier)
+	if err != nil {
+		return fmt.Errorf("invalid classifier: %w", err)
+	}
+	profiles, err := classify.CompileProfiles(cfg.Profiles)
+	if err != nil {
+		return fmt.Errorf("invalid profiles: %w", err)
+	}
+	if _, err := profiles.Get(opts.profile); err != nil {
+		return err
+	}
+	products, err := catalog.Load(cfg.Catalog)
+	if err != nil {
+		return fmt.Errorf("invalid catalog: %w", err)
+	}
+
+	options := pipeline.Options{
+		AI:             cfg.AI,
+		Provider:       opts.provider,
+		Model:          opts.model,
+		Language:       opts.language,
+		UseVisionModel: opts.vision,
+		OCREngine:      cfg.OCR.Engine,
+		Categories:     cfg.Categories,
+		Prompt:         cfg.Prompt,
+		AITimeout:      cfg.Timeouts.AI,
+		Rules:          ruleSet,
+		Correction:     corrector,
+		Residency:      policy,
+		Classifier:     classifier,
+		Profiles:       profiles,
+		Profile:        opts.profile,
+		Catalog:        products,
+		Hooks:          append(pipeline.RegisteredHooks(), hooks.FromConfig(cfg.Hooks)...),
+
+		PageParallelism:  cfg.OCR.PageParallelism,
+		LanguageFallback: cfg.OCR.LanguageFallback,
+		OCRRetry:         cfg.OCR.Retry,
+		Handwriting:      cfg.OCR.Handwriting,
+		CapturePhoto:     cfg.EXIF.Capture,
+		StripMetadata:    cfg.EXIF.Strip,
+	}
+	if scriptSet != nil {
+		options.Hooks = append(options.Hooks, scriptSet)
+	}
+	if options.Language == "" {
+		options.Language = cfg.OCR.Language
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+	jobs := make(chan string)
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				record := processFile(ctx, file, options, opts.redactPII)
+
+				mu.Lock()
+				if !record.Success {
+					failed++
+				}
+				if err := writer.write(record); err != nil {
+					slog.Error("failed to write result", "file", file, "error", err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := writer.flush(); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+
+	slog.Info("batch complete", "files", len(files), "failed", failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(files))
+	}
+	return ctx.Err()
+}
+
+// processFile runs the pipeline on one file
+func processFile(ctx context.Context, file string, options pipeline.Options, redactPII bool) processRecord {
+	startTime := time.Now()
+	record := processRecord{File: file}
+
+	imageData, err := os.ReadFile(file)
+	if err != nil {
+		record.Error = fmt.Sprintf("failed to read file: %v", err)
+		return record
+	}
+
+	invoice, stats, err := pipeline.Process(ctx, imageData, options)
+	record.OCRDuration = stats.OCRDuration
+	record.AIDuration = stats.AIDuration
+	record.TotalDuration = time.Since(startTime).Seconds()
+	record.Usage = &stats.Usage
+
+	if err != nil {
+		record.Error = err.Error()
+		record.RawText = stats.RawText
+		var se *pipeline.StageError
+		if errors.As(err, &se) {
+			record.Stage = se.Stage
+		}
+		if redactPII {
+			record.RawText = redact.Text(record.RawText)
+		}
+		slog.Warn("processing failed", "file", file, "stage", record.Stage, "error", err)
+		return record
+	}
+
+	if redactPII {
+		invoice.RawText = redact.Text(invoice.RawText)
+	}
+	record.Success = true
+	record.Invoice = invoice
+	slog.Info("invoice processed", "file", file, "vendor", invoice.Vendor, "total", invoice.Total.String())
+	return record
+}
+
+// collectFiles expands directories into the image files they contain. Files
+// named explicitly are always included.
+func collectFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && imageExtensions[strings.ToLower(filepath.Ext(p))] {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %s: %w", path, err)
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// recordWriter writes records in the chosen output format
+type recordWriter struct {
+	json *json.Encoder
+	csv  *csv.Writer
+}
+
+func newRecordWriter(w io.Writer, format string) (*recordWriter, error) {
+	if format == "json" {
+		return &recordWriter{json: json.NewEncoder(w)}, nil
+	}
+
+	writer := &recordWriter{csv: csv.NewWriter(w)}
+	if err := writer.csv.Write(csvHeader); err != nil {
+		return nil, fmt.Errorf("failed to write results: %w", err)
+	}
+	return writer, nil
+}
+
+// write writes one record; CSV rows are flushed so partial output survives an interrupt
+func (w *recordWriter) write(record processRecord) error {
+	if w.json != nil {
+		return w.json.Encode(record)
+	}
+
+	row := make([]string, len(csvHeader))
+	row[0] = record.File
+	row[1] = strconv.FormatBool(record.Success)
+	if invoice := record.Invoice; invoice != nil {
+		row[2] = invoice.Vendor
+		if !invoice.Date.IsZero() {
+			row[3] = invoice.Date.Format(time.DateOnly)
+		}
+		row[4] = invoice.Total.String()
+		if !invoice.Tax.IsZero() {
+			row[5] = invoice.Tax.String()
+		}
+		row[6] = strings.Join(invoice.Categories, ";")
+		row[7] = strconv.Itoa(len(invoice.Items))
+		row[8] = strconv.FormatFloat(invoice.Confidence, 'f', 2, 64)
+	}
+	row[9] = record.Error
+	row[10] = record.Stage
+	row[11] = strconv.FormatFloat(record.TotalDuration, 'f', 2, 64)
+	if record.Usage != nil {
+		row[12] = strconv.Itoa(record.Usage.PromptTokens)
+		row[13] = strconv.Itoa(record.Usage.CompletionTokens)
+	}
+
+	if err := w.csv.Write(row); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// flush writes buffered output
+func (w *recordWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
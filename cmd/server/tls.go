@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certCheckInterval is how often certificate files are checked for renewal
+const certCheckInterval = time.Minute
+
+// setupTLS builds the server TLS config. HTTP/2 is negotiated via ALPN.
+// With autocert it also returns the server answering ACME HTTP-01
+// challenges (and redirecting other plain HTTP requests), if configured.
+func setupTLS(config models.TLSConfig) (*tls.Config, *http.Server, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if config.MinVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+
+	if len(config.Autocert.Domains) == 0 {
+		certs, err := newCertReloader(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.GetCertificate = certs.GetCertificate
+		return tlsConfig, nil, nil
+	}
+
+	cacheDir := config.Autocert.CacheDir
+	if cacheDir == "" {
+		cacheDir = "./data/autocert"
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(config.Autocert.Domains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      config.Autocert.Email,
+	}
+	tlsConfig.GetCertificate = manager.GetCertificate
+	// Allow TLS-ALPN-01 challenges on the TLS listener itself
+	tlsConfig.NextProtos = append(tlsConfig.NextProtos, "acme-tls/1")
+
+	var challenges *http.Server
+	if config.Autocert.HTTPAddr != "" {
+		challenges = &http.Server{
+			Addr:              config.Autocert.HTTPAddr,
+			Handler:           manager.HTTPHandler(nil),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	}
+	return tlsConfig, challenges, nil
+}
+
+// certReloader serves a certificate from disk, picking up renewed files
+// (e.g. from certbot) without a restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the key pair from disk
+func (r *certReloader) load() error {
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = info.ModTime()
+	return nil
+}
+
+// GetCertificate returns the current certificate, reloading it when the file changed
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= certCheckInterval {
+		r.checkedAt = time.Now()
+		if info, err := os.Stat(r.certFile); err == nil && !info.ModTime().Equal(r.modTime) {
+			// Keep serving the old certificate if the new files are incomplete
+			if err := r.load(); err != nil {
+				slog.Warn("failed to reload TLS certificate", "error", err)
+			} else {
+				slog.Info("TLS certificate reloaded", "file", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
@@ -0,0 +1,239 @@
+package ai
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Cassette modes
+const (
+	CassetteRecord = "record" // Call the provider and save each exchange
+	CassetteReplay = "replay" // Answer from saved exchanges only, never calling out
+)
+
+// ErrNoRecording is returned in replay mode for a request without a fixture
+var ErrNoRecording = errors.New("no recorded response for request")
+
+// redactedHeaders are never written to fixtures
+var redactedHeaders = []string{"Authorization", "Api-Key", "X-Goog-Api-Key", "Cookie", "Set-Cookie"}
+
+// Cassette is a transport that records provider exchanges to fixture files
+// and replays them, so the extractor can run without API keys or network.
+// Requests are matched by method, URL and body; credentials are left out of
+// both the match and the fixtures.
+type Cassette struct {
+	mode string
+	dir  string
+	base http.RoundTripper
+}
+
+// NewCassette creates a cassette storing fixtures in dir. base makes the live
+// calls in record mode; nil uses http.DefaultTransport.
+func NewCassette(mode, dir string, base http.RoundTripper) (*Cassette, error) {
+	if mode != CassetteRecord && mode != CassetteReplay {
+		return nil, fmt.Errorf("unsupported cassette mode: %s", mode)
+	}
+	if dir == "" {
+		return nil, errors.New("cassette directory is required")
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Cassette{mode: mode, dir: dir, base: base}, nil
+}
+
+// fixture is a recorded exchange
+type fixture struct {
+	Request  fixtureMessage `json:"request"`
+	Response fixtureMessage `json:"response"`
+}
+
+// fixtureMessage is a request or response. Bodies that are not UTF-8 are
+// stored base64-encoded.
+type fixtureMessage struct {
+	Method     string      `json:"method,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	Status     int         `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 string      `json:"bodyBase64,omitempty"`
+}
+
+// RoundTrip implements http.RoundTripper
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	target := redactURL(req.URL)
+	path := filepath.Join(c.dir, fixtureName(req.Method, target, body))
+
+	if c.mode == CassetteReplay {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s %s (%s)", ErrNoRecording, req.Method, target, filepath.Base(path))
+		}
+		if err != nil {
+			return nil, err
+		}
+		var f fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+		}
+		responseBody, err := f.Response.body()
+		if err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+		}
+		return newResponse(req, f.Response.Status, f.Response.Header, responseBody), nil
+	}
+
+	live := req.Clone(req.Context())
+	live.Body = io.NopCloser(bytes.NewReader(body))
+	live.ContentLength = int64(len(body))
+	resp, err := c.base.RoundTrip(live)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	f := fixture{
+		Request:  newFixtureMessage(redactHeader(req.Header), body),
+		Response: newFixtureMessage(redactHeader(resp.Header), responseBody),
+	}
+	f.Request.Method = req.Method
+	f.Request.URL = target
+	f.Response.Status = resp.StatusCode
+	if err := writeFixture(path, f); err != nil {
+		return nil, fmt.Errorf("failed to record %s %s: %w", req.Method, target, err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+	resp.ContentLength = int64(len(responseBody))
+	return resp, nil
+}
+
+// fixtureName derives the fixture file of a request, e.g.
+// post-api.openai.com-3f2a9c81d0e4.json
+func fixtureName(method, target string, body []byte) string {
+	// Gemini's protobuf JSON varies its whitespace between runs
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		body = compact.Bytes()
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", method, target)
+	h.Write(body)
+
+	host := "local"
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		host = strings.ReplaceAll(u.Host, ":", "_")
+	}
+	return fmt.Sprintf("%s-%s-%s.json", strings.ToLower(method), host, hex.EncodeToString(h.Sum(nil))[:12])
+}
+
+// redactURL returns u without credentials in the query
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	if query.Has("key") {
+		query.Del("key")
+		redacted.RawQuery = query.Encode()
+	}
+	redacted.User = nil
+	return redacted.String()
+}
+
+// redactHeader returns a copy of h without credentials
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		h.Del(name)
+	}
+	return h
+}
+
+// newFixtureMessage stores body as text when possible
+func newFixtureMessage(header http.Header, body []byte) fixtureMessage {
+	m := fixtureMessage{Header: header}
+	if utf8.Valid(body) {
+		m.Body = string(body)
+	} else {
+		m.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	return m
+}
+
+// body returns the decoded body of m
+func (m fixtureMessage) body() ([]byte, error) {
+	if m.BodyBase64 != "" {
+		return base64.StdEncoding.DecodeString(m.BodyBase64)
+	}
+	return []byte(m.Body), nil
+}
+
+// writeFixture writes f atomically, so concurrent identical requests leave one whole file
+func writeFixture(path string, f fixture) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fixture-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// newResponse builds a replayed response to req
+func newResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	// The recorded body is already decoded
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
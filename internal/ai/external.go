@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// defaultExternalTimeout bounds an external extractor call without a configured timeout
+const defaultExternalTimeout = 60 * time.Second
+
+// ExternalProvider implements Provider with a user-supplied extractor, run as
+// a command or called over HTTP. Both receive an externalRequest as JSON and
+// answer with an externalResponse.
+type ExternalProvider struct {
+	httpTransport
+	config    models.ExternalConfig
+	model     string
+	lastUsage Usage
+}
+
+// externalRequest is sent to the extractor
+type externalRequest struct {
+	Model      string                  `json:"model,omitempty"`
+	Prompt     string                  `json:"prompt"`             // The prompt an LLM provider would get, OCR text included
+	Text       string                  `json:"text,omitempty"`     // OCR text alone
+	Image      string                  `json:"image,omitempty"`    // Base64, for vision requests
+	MIMEType   string                  `json:"mimeType,omitempty"` // Of Image
+	Generation models.GenerationParams `json:"generation"`
+}
+
+// externalResponse is returned by the extractor
+type externalResponse struct {
+	Invoice json.RawMessage `json:"invoice"` // Same fields the built-in prompt asks for
+	Usage   struct {
+		PromptTokens     int `json:"promptTokens"`
+		CompletionTokens int `json:"completionTokens"`
+	} `json:"usage"`
+	Error string `json:"error"`
+}
+
+// NewExternalProvider creates a provider calling the extractor of config.
+// model overrides config.Model when set.
+func NewExternalProvider(config models.ExternalConfig, model string) *ExternalProvider {
+	if model == "" {
+		model = config.Model
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultExternalTimeout
+	}
+	return &ExternalProvider{config: config, model: model}
+}
+
+// Ping checks that the command can be found. HTTP extractors have no standard
+// health endpoint and are reported as available.
+func (p *ExternalProvider) Ping(ctx context.Context) error {
+	if len(p.config.Command) == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath(p.config.Command[0]); err != nil {
+		return fmt.Errorf("external extractor check failed: %w", err)
+	}
+	return nil
+}
+
+// ExtractData sends prompt and image to the extractor
+func (p *ExternalProvider) ExtractData(ctx context.Context, prompt string, imageBase64 string, params models.GenerationParams) (string, error) {
+	return p.ExtractWithText(ctx, prompt, "", imageBase64, params)
+}
+
+// ExtractWithText sends prompt, the OCR text and image to the extractor
+func (p *ExternalProvider) ExtractWithText(ctx context.Context, prompt, text, imageBase64 string, params models.GenerationParams) (string, error) {
+	p.lastUsage = Usage{}
+	req := externalRequest{
+		Model:      p.model,
+		Prompt:     prompt,
+		Text:       text,
+		Generation: params,
+	}
+	if imageBase64 != "" {
+		image, mimeType, err := imagedata.Decode(imageBase64)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode image: %w", err)
+		}
+		req.Image = base64.StdEncoding.EncodeToString(image)
+		req.MIMEType = mimeType
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	var output []byte
+	if len(p.config.Command) > 0 {
+		output, err = p.runCommand(ctx, body)
+	} else {
+		output, err = p.post(ctx, body)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var resp externalResponse
+	if err := json.Unmarshal(output, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("external extractor error: %s", resp.Error)
+	}
+	if len(resp.Invoice) == 0 || string(resp.Invoice) == "null" {
+		return "", errors.New("external extractor returned no invoice")
+	}
+	p.lastUsage = Usage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}
+	return string(resp.Invoice), nil
+}
+
+// runCommand writes body to the command's stdin and returns its stdout
+func (p *ExternalProvider) runCommand(ctx context.Context, body []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.config.Command[0], p.config.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = fmt.Errorf("%w: %v", ctxErr, err)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", p.config.Command[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", p.config.Command[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// post sends body to the extractor's URL and returns the response body
+func (p *ExternalProvider) post(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range p.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := p.newHTTPClient(0).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call external extractor: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("external extractor returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// LastUsage returns the token usage of the last call, as reported by the extractor
+func (p *ExternalProvider) LastUsage() Usage {
+	return p.lastUsage
+}
@@ -1,38 +1,80 @@
 package ai
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/redact"
 	"github.com/shopspring/decimal"
 )
 
+// ErrParseResponse is returned when the AI response is not valid invoice JSON
+var ErrParseResponse = errors.New("failed to parse AI response")
+
+// ParseError carries the AI response that could not be parsed. It matches
+// ErrParseResponse with errors.Is.
+type ParseError struct {
+	Response string // As returned by the provider
+	Err      error
+}
+
+func (e *ParseError) Error() string { return fmt.Sprintf("%v: %v", ErrParseResponse, e.Err) }
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+func (e *ParseError) Is(target error) bool { return target == ErrParseResponse }
+
 // Extractor handles AI-based data extraction from OCR text or images
 type Extractor struct {
-	provider   Provider
-	categories []string
+	provider       Provider
+	categories     []string
+	promptTemplate string
+	fields         []models.ProfileField // Asked for besides the standard fields
+	kind           string                // Kind of document whose details are asked for, see WithKind
 }
 
-// NewExtractor creates a new AI extractor
-func NewExtractor(provider Provider, categories []string) *Extractor {
+// NewExtractor creates a new AI extractor. An empty promptTemplate uses the
+// built-in prompt.
+func NewExtractor(provider Provider, categories []string, promptTemplate string) *Extractor {
 	return &Extractor{
-		provider:   provider,
-		categories: categories,
+		provider:       provider,
+		categories:     categories,
+		promptTemplate: promptTemplate,
 	}
 }
 
-// Extract processes OCR text or image and returns structured invoice data
-func (e *Extractor) Extract(ocrText string, imageBase64 string) (*models.Invoice, float64, error) {
+// WithFields returns a copy of the extractor that also asks for fields and
+// returns them in Invoice.Fields. Prompt templates place their description
+// with the @fields placeholder.
+func (e *Extractor) WithFields(fields []models.ProfileField) *Extractor {
+	copied := *e
+	copied.fields = fields
+	return &copied
+}
+
+// Extract processes OCR text or image and returns structured invoice data.
+// params overrides the provider's sampling defaults.
+func (e *Extractor) Extract(ctx context.Context, ocrText string, imageBase64 string, params models.GenerationParams) (*models.Invoice, float64, error) {
 	startTime := time.Now()
 
 	// Build prompt
 	prompt := e.buildPrompt(ocrText)
 
 	// Call AI provider
-	response, err := e.provider.ExtractData(prompt, imageBase64)
+	var response string
+	var err error
+	if textExtractor, ok := e.provider.(TextExtractor); ok {
+		response, err = textExtractor.ExtractWithText(ctx, prompt, ocrText, imageBase64, params)
+	} else {
+		response, err = e.provider.ExtractData(ctx, prompt, imageBase64, params)
+	}
 	if err != nil {
 		return nil, 0, fmt.Errorf("AI extraction failed: %w", err)
 	}
@@ -42,7 +84,7 @@ func (e *Extractor) Extract(ocrText string, imageBase64 string) (*models.Invoice
 	// Parse JSON response
 	invoice, err := e.parseResponse(response, ocrText)
 	if err != nil {
-		return nil, duration, fmt.Errorf("failed to parse AI response: %w", err)
+		return nil, duration, &ParseError{Response: response, Err: err}
 	}
 
 	return invoice, duration, nil
@@ -54,6 +96,16 @@ func (e *Extractor) buildPrompt(ocrText string) string {
 	categoriesStr := strings.Join(e.categories, ", ")
 	currentYear := time.Now().Year()
 
+	// Custom template with Receipt Wrangler style placeholders
+	if e.promptTemplate != "" {
+		return strings.NewReplacer(
+			"@categories", categoriesStr,
+			"@currentYear", fmt.Sprintf("%d", currentYear),
+			"@fields", e.fieldsPrompt(),
+			"@ocrText", ocrText,
+		).Replace(e.promptTemplate)
+	}
+
 	prompt := fmt.Sprintf(`Extract invoice/receipt data from the following text and return ONLY valid JSON.
 
 Available categories: %s
@@ -61,34 +113,75 @@ Available categories: %s
 Return JSON with this EXACT structure (no markdown, no code blocks):
 {
   "vendor": "merchant/store name",
+  "store": {"number": "0421", "address": "Calle Mayor 12, 28013 Madrid"},
   "date": "YYYY-MM-DD",
+  "receiptNumber": "T-0042-118734",
+  "loyaltyCard": "6280123456789012",
   "total": 123.45,
   "tax": 12.34,
+  "roundingAdjustment": -0.02,
+  "tip": 2.00,
   "items": [
     {
       "name": "item name",
       "amount": 10.50,
+      "unitPrice": 10.50,
       "isTaxed": true,
-      "quantity": 1
+      "quantity": 1,
+      "serialNumbers": ["SN123456789"]
     }
   ],
-  "categories": ["category1", "category2"]
+  "categories": ["category1", "category2"],
+  "handwritingDetected": false,
+  "confidence": 0.9
 }
 
 Rules:
 - Use 'Unknown Vendor' if store name cannot be found
+- store is the shop or branch the document was issued at, apart from the legal company: its store or branch number and street address as printed; omit either if not printed
 - Omit fields if not found with confidence
 - Assume year is %d if not specified
+- receiptNumber is the merchant's ticket, receipt or invoice number; loyaltyCard is a loyalty or club card number (not a payment card); omit either if not printed
 - Total and amounts must be numbers (not strings)
+- roundingAdjustment is a printed rounding line (e.g. cash rounding to 5 cents), negative when it lowers the total; omit it if there is none
+- tip is a tip or gratuity ("propina"), printed or handwritten; do not include it in items or tax; omit it if there is none
 - Select up to 2 categories from the provided list
 - Extract individual items if visible in the receipt
-
+- Item amount is the line total; unitPrice is the price of one unit, omitted if not printed
+- serialNumbers lists the serial numbers or IMEIs printed for an item (S/N, IMEI), omitted if none
+- Set handwritingDetected to true when the total, tip or another amount is written by hand rather than printed
+- Set confidence from 0 to 1: how sure you are that vendor, date and total are right
+%s
 Receipt text:
-%s`, categoriesStr, currentYear, ocrText)
+%s`, categoriesStr, currentYear, e.fieldsPrompt(), ocrText)
 
 	return prompt
 }
 
+// fieldTypes describe the profile field types to the model
+var fieldTypes = map[string]string{
+	models.FieldTypeString:  "text",
+	models.FieldTypeNumber:  "number",
+	models.FieldTypeInteger: "whole number",
+	models.FieldTypeBoolean: "true or false",
+	models.FieldTypeDate:    "YYYY-MM-DD",
+}
+
+// fieldsPrompt asks for the extra fields and the details of the document
+// kind, empty without either
+func (e *Extractor) fieldsPrompt() string {
+	if len(e.fields) == 0 {
+		return kindPrompts[e.kind]
+	}
+	var b strings.Builder
+	b.WriteString(kindPrompts[e.kind])
+	b.WriteString("\nAlso return \"fields\", an object with these keys, each omitted when not found:\n")
+	for _, field := range e.fields {
+		fmt.Fprintf(&b, "- %s (%s): %s\n", field.Name, fieldTypes[field.Type], field.Description)
+	}
+	return b.String()
+}
+
 // parseResponse converts AI JSON response to Invoice struct
 func (e *Extractor) parseResponse(response string, ocrText string) (*models.Invoice, error) {
 	// Clean response (remove markdown code blocks if present)
@@ -99,31 +192,55 @@ func (e *Extractor) parseResponse(response string, ocrText string) (*models.Invo
 
 	// Parse JSON
 	var raw struct {
-		Vendor     string          `json:"vendor"`
-		Date       string          `json:"date"`
-		Total      json.Number     `json:"total"`
-		Tax        json.Number     `json:"tax"`
-		Categories []string        `json:"categories"`
+		Vendor     string                     `json:"vendor"`
+		Store      *models.StoreInfo          `json:"store"`
+		Date       string                     `json:"date"`
+		Receipt    string                     `json:"receiptNumber"`
+		Loyalty    string                     `json:"loyaltyCard"`
+		Total      json.Number                `json:"total"`
+		Tax        json.Number                `json:"tax"`
+		Rounding   json.Number                `json:"roundingAdjustment"`
+		Tip        json.Number                `json:"tip"`
+		Categories []string                   `json:"categories"`
+		Confidence json.Number                `json:"confidence"`
+		ByHand     bool                       `json:"handwritingDetected"`
+		Fields     map[string]json.RawMessage `json:"fields"`
 		Items      []struct {
-			Name     string      `json:"name"`
-			Amount   json.Number `json:"amount"`
-			IsTaxed  bool        `json:"isTaxed"`
-			Quantity int         `json:"quantity"`
+			Name      string      `json:"name"`
+			Amount    json.Number `json:"amount"`
+			UnitPrice json.Number `json:"unitPrice"`
+			IsTaxed   bool        `json:"isTaxed"`
+			Quantity  int         `json:"quantity"`
+			Serials   []string    `json:"serialNumbers"`
 		} `json:"items"`
 	}
 
 	err := json.Unmarshal([]byte(cleaned), &raw)
 	if err != nil {
-		return nil, fmt.Errorf("JSON parse error: %w\nResponse: %s", err, cleaned)
+		return nil, fmt.Errorf("JSON parse error: %w", err)
 	}
 
 	// Build invoice
 	invoice := &models.Invoice{
-		Vendor:      raw.Vendor,
-		Categories:  raw.Categories,
-		RawText:     ocrText,
-		Confidence:  0.85, // Default confidence
-		ProcessedAt: time.Now(),
+		Vendor:        raw.Vendor,
+		ReceiptNumber: strings.TrimSpace(raw.Receipt),
+		LoyaltyCard:   redact.Number(raw.Loyalty),
+		Categories:    raw.Categories,
+		RawText:       ocrText,
+		ProcessedAt:   time.Now(),
+	}
+	invoice.HandwritingDetected = raw.ByHand
+
+	// The model's assessment of its answer; the pipeline combines it with
+	// the OCR confidence into Confidence
+	if raw.Confidence != "" {
+		confidence, err := raw.Confidence.Float64()
+		if err == nil && confidence > 0 {
+			if confidence > 1 {
+				confidence /= 100 // Given as a percentage
+			}
+			invoice.ModelConfidence = min(confidence, 1)
+		}
 	}
 
 	// Parse date
@@ -157,6 +274,36 @@ func (e *Extractor) parseResponse(response string, ocrText string) (*models.Invo
 		}
 	}
 
+	// Parse rounding adjustment
+	if raw.Rounding != "" {
+		rounding, err := decimal.NewFromString(string(raw.Rounding))
+		if err == nil && !rounding.IsZero() {
+			invoice.RoundingAdjustment = &rounding
+		}
+	}
+
+	// Parse tip
+	if raw.Tip != "" {
+		tip, err := decimal.NewFromString(string(raw.Tip))
+		if err == nil && tip.IsPositive() {
+			invoice.Tip = &tip
+		}
+	}
+
+	// Parse store
+	if raw.Store != nil {
+		store := models.StoreInfo{
+			Number:  strings.TrimSpace(raw.Store.Number),
+			Address: strings.Join(strings.Fields(raw.Store.Address), " "),
+		}
+		if store != (models.StoreInfo{}) {
+			invoice.Store = &store
+		}
+	}
+
+	invoice.Fields = e.parseFields(raw.Fields)
+	e.parseKind([]byte(cleaned), invoice)
+
 	// Parse items
 	invoice.Items = make([]models.InvoiceItem, len(raw.Items))
 	for i, item := range raw.Items {
@@ -167,7 +314,82 @@ func (e *Extractor) parseResponse(response string, ocrText string) (*models.Invo
 			IsTaxed:  item.IsTaxed,
 			Quantity: item.Quantity,
 		}
+		if unitPrice, err := decimal.NewFromString(string(item.UnitPrice)); err == nil {
+			invoice.Items[i].UnitPrice = &unitPrice
+		}
+		for _, serial := range item.Serials {
+			if serial = strings.TrimSpace(serial); serial != "" {
+				invoice.Items[i].SerialNumbers = append(invoice.Items[i].SerialNumbers, serial)
+			}
+		}
 	}
 
 	return invoice, nil
 }
+
+// parseFields keeps the requested extra fields of an answer, converted to
+// their type. Values that do not convert are dropped.
+func (e *Extractor) parseFields(raw map[string]json.RawMessage) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, field := range e.fields {
+		data, ok := raw[field.Name]
+		if !ok {
+			continue
+		}
+		if value, ok := fieldValue(field.Type, data); ok {
+			fields[field.Name] = value
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// fieldValue converts the JSON value of a profile field to its type: numbers
+// stay json.Number so they are returned as written
+func fieldValue(fieldType string, data json.RawMessage) (interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if decoder.Decode(&value) != nil || value == nil {
+		return nil, false
+	}
+	text, isText := value.(string)
+	text = strings.TrimSpace(text)
+
+	switch fieldType {
+	case models.FieldTypeNumber, models.FieldTypeInteger:
+		number, ok := value.(json.Number)
+		if isText {
+			// Models sometimes quote numbers or keep a decimal comma
+			number, ok = json.Number(strings.Replace(text, ",", ".", 1)), true
+		}
+		if !ok {
+			return nil, false
+		}
+		if fieldType == models.FieldTypeInteger {
+			n, err := number.Int64()
+			return n, err == nil
+		}
+		// ParseFloat also takes NaN and Inf, which are not JSON
+		_, err := number.Float64()
+		return number, err == nil && json.Valid([]byte(number))
+	case models.FieldTypeBoolean:
+		if isText {
+			b, err := strconv.ParseBool(text)
+			return b, err == nil
+		}
+		b, ok := value.(bool)
+		return b, ok
+	case models.FieldTypeDate:
+		if _, err := time.Parse(time.DateOnly, text); !isText || err != nil {
+			return nil, false
+		}
+		return text, true
+	}
+	if number, ok := value.(json.Number); ok {
+		return number.String(), true
+	}
+	return text, isText && text != ""
+}
@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// providerOptions are the provider-specific generation options each provider
+// accepts. Ollama options are passed through as-is, so any name is accepted.
+var providerOptions = map[string]map[string]bool{
+	"openai": {"seed": true, "stop": true},
+	"gemini": {"topK": true, "stop": true},
+}
+
+// ValidateGeneration checks generation overrides before they are sent to a provider
+func ValidateGeneration(provider string, params models.GenerationParams) error {
+	if t := params.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if p := params.TopP; p != nil && (*p <= 0 || *p > 1) {
+		return fmt.Errorf("topP must be greater than 0 and at most 1")
+	}
+	if n := params.MaxTokens; n != nil && *n < 1 {
+		return fmt.Errorf("maxTokens must be positive")
+	}
+	if params.ImageDetail != "" || params.MaxImageTokens != nil {
+		if provider == "gemini" || provider == "ollama" {
+			return fmt.Errorf("imageDetail and maxImageTokens are only supported by openai")
+		}
+		switch params.ImageDetail {
+		case "", DetailLow, DetailHigh, DetailAuto:
+		default:
+			return fmt.Errorf("imageDetail must be low, high or auto")
+		}
+		if n := params.MaxImageTokens; n != nil && *n < lowDetailTokens {
+			return fmt.Errorf("maxImageTokens must be at least %d, the cost of a low detail image", lowDetailTokens)
+		}
+	}
+
+	allowed, ok := providerOptions[provider]
+	if !ok {
+		return nil
+	}
+	for name, value := range params.Options {
+		if !allowed[name] {
+			return fmt.Errorf("option %q is not supported by %s (supported: %s)", name, provider, optionNames(allowed))
+		}
+		var err error
+		switch name {
+		case "seed", "topK":
+			_, err = intOption(value)
+		case "stop":
+			_, err = stringsOption(value)
+		}
+		if err != nil {
+			return fmt.Errorf("option %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// optionNames lists option names for error messages
+func optionNames(options map[string]bool) string {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// intOption converts an option value decoded from JSON to an int
+func intOption(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("must be an integer")
+		}
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("must be an integer")
+}
+
+// stringsOption converts an option value decoded from JSON to a string list.
+// A single string is accepted as a list of one.
+func stringsOption(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a string or list of strings")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("must be a string or list of strings")
+}
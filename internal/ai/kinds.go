@@ -0,0 +1,173 @@
+package ai
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// kindPrompts ask for the details of each kind of document
+var kindPrompts = map[string]string{
+	models.KindFuel: `
+This is a fuel station receipt. Also return "fuel", an object with these keys, each omitted when not printed:
+- liters (number): volume of fuel dispensed
+- pricePerLiter (number): price of one liter
+- fuelType (text): fuel as printed, e.g. "Gasóleo A", "Sin plomo 95"
+- plate (text): vehicle license plate
+`,
+	models.KindUtility: `
+This is a utility bill. Also return "utility", an object with these keys, each omitted when not printed:
+- periodStart (YYYY-MM-DD): first day of the billing period
+- periodEnd (YYYY-MM-DD): last day of the billing period
+- consumption (number): consumption billed
+- consumptionUnit (text): unit of the consumption, e.g. kWh or m3
+- meterNumbers (list of text): meter numbers or supply point codes (CUPS)
+- contractReference (text): contract or customer reference
+`,
+	models.KindHotel: `
+This is a hotel invoice. Also return "hotel", an object with these keys, each omitted when not printed:
+- checkIn (YYYY-MM-DD): arrival date
+- checkOut (YYYY-MM-DD): departure date
+- nights (whole number): nights stayed
+- roomRate (number): price of the room per night
+- cityTax (number): tourist or city tax for the whole stay (tasa turística), not VAT
+`,
+}
+
+// units are the spellings of consumption units, lowercase
+var units = map[string]string{"kwh": "kWh", "mwh": "MWh", "m3": "m3", "m³": "m3", "l": "L", "litros": "L"}
+
+// WithKind returns a copy of the extractor that also asks for the details of
+// a kind of document, e.g. models.KindFuel, and returns them in the Invoice
+func (e *Extractor) WithKind(kind string) *Extractor {
+	copied := *e
+	copied.kind = kind
+	return &copied
+}
+
+// parseKind reads the details of the extractor's kind of document from an
+// answer. Details that are missing or malformed are left out.
+func (e *Extractor) parseKind(answer []byte, invoice *models.Invoice) {
+	switch e.kind {
+	case models.KindFuel:
+		var raw struct {
+			Fuel *struct {
+				Liters        json.Number `json:"liters"`
+				PricePerLiter json.Number `json:"pricePerLiter"`
+				FuelType      string      `json:"fuelType"`
+				Plate         string      `json:"plate"`
+			} `json:"fuel"`
+		}
+		if json.Unmarshal(answer, &raw) != nil || raw.Fuel == nil {
+			return
+		}
+		fuel := &models.FuelDetails{
+			Liters:        positiveDecimal(raw.Fuel.Liters),
+			PricePerLiter: positiveDecimal(raw.Fuel.PricePerLiter),
+			FuelType:      strings.TrimSpace(raw.Fuel.FuelType),
+			Plate: strings.Map(func(r rune) rune {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					return unicode.ToUpper(r)
+				}
+				return -1
+			}, raw.Fuel.Plate),
+		}
+		if *fuel != (models.FuelDetails{}) {
+			invoice.Fuel = fuel
+		}
+
+	case models.KindUtility:
+		var raw struct {
+			Utility *struct {
+				PeriodStart       string      `json:"periodStart"`
+				PeriodEnd         string      `json:"periodEnd"`
+				Consumption       json.Number `json:"consumption"`
+				ConsumptionUnit   string      `json:"consumptionUnit"`
+				MeterNumbers      []string    `json:"meterNumbers"`
+				ContractReference string      `json:"contractReference"`
+			} `json:"utility"`
+		}
+		if json.Unmarshal(answer, &raw) != nil || raw.Utility == nil {
+			return
+		}
+		utility := &models.UtilityDetails{
+			PeriodStart:       dateOnly(raw.Utility.PeriodStart),
+			PeriodEnd:         dateOnly(raw.Utility.PeriodEnd),
+			Consumption:       positiveDecimal(raw.Utility.Consumption),
+			ConsumptionUnit:   strings.TrimSpace(raw.Utility.ConsumptionUnit),
+			ContractReference: strings.TrimSpace(raw.Utility.ContractReference),
+		}
+		if unit, ok := units[strings.ToLower(utility.ConsumptionUnit)]; ok {
+			utility.ConsumptionUnit = unit
+		}
+		if utility.PeriodEnd != "" && utility.PeriodEnd < utility.PeriodStart {
+			utility.PeriodStart, utility.PeriodEnd = utility.PeriodEnd, utility.PeriodStart
+		}
+		for _, meter := range raw.Utility.MeterNumbers {
+			if meter = strings.TrimSpace(meter); meter != "" && !slices.Contains(utility.MeterNumbers, meter) {
+				utility.MeterNumbers = append(utility.MeterNumbers, meter)
+			}
+		}
+		if utility.PeriodStart != "" || utility.PeriodEnd != "" || utility.Consumption != nil ||
+			len(utility.MeterNumbers) > 0 || utility.ContractReference != "" {
+			invoice.Utility = utility
+		}
+
+	case models.KindHotel:
+		var raw struct {
+			Hotel *struct {
+				CheckIn  string      `json:"checkIn"`
+				CheckOut string      `json:"checkOut"`
+				Nights   json.Number `json:"nights"`
+				RoomRate json.Number `json:"roomRate"`
+				CityTax  json.Number `json:"cityTax"`
+			} `json:"hotel"`
+		}
+		if json.Unmarshal(answer, &raw) != nil || raw.Hotel == nil {
+			return
+		}
+		hotel := &models.HotelDetails{
+			CheckIn:  dateOnly(raw.Hotel.CheckIn),
+			CheckOut: dateOnly(raw.Hotel.CheckOut),
+			RoomRate: positiveDecimal(raw.Hotel.RoomRate),
+			CityTax:  positiveDecimal(raw.Hotel.CityTax),
+		}
+		if nights, err := raw.Hotel.Nights.Int64(); err == nil && nights > 0 {
+			hotel.Nights = int(nights)
+		}
+		// The dates, when both are read, tell the nights better than the model
+		if hotel.CheckIn != "" && hotel.CheckOut != "" {
+			checkIn, _ := time.Parse(time.DateOnly, hotel.CheckIn)
+			checkOut, _ := time.Parse(time.DateOnly, hotel.CheckOut)
+			if nights := int(checkOut.Sub(checkIn).Hours() / 24); nights > 0 {
+				hotel.Nights = nights
+			}
+		}
+		if *hotel != (models.HotelDetails{}) {
+			invoice.Hotel = hotel
+		}
+	}
+}
+
+// dateOnly returns a YYYY-MM-DD date of an answer, empty unless it is one
+func dateOnly(text string) string {
+	text = strings.TrimSpace(text)
+	if _, err := time.Parse(time.DateOnly, text); err != nil {
+		return ""
+	}
+	return text
+}
+
+// positiveDecimal returns a number of an answer, nil unless it is positive
+func positiveDecimal(number json.Number) *decimal.Decimal {
+	value, err := decimal.NewFromString(string(number))
+	if err != nil || !value.IsPositive() {
+		return nil
+	}
+	return &value
+}
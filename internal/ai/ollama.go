@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ollamaModelName adds the implicit ":latest" tag, the form Ollama reports names in
+func ollamaModelName(name string) string {
+	if !strings.Contains(name, ":") {
+		return name + ":latest"
+	}
+	return name
+}
+
+// ModelState reports whether the model is installed (/api/tags) and loaded (/api/ps)
+func (p *OllamaProvider) ModelState(ctx context.Context) (*ModelState, error) {
+	installed, err := p.ListModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name := ollamaModelName(p.model)
+	state := &ModelState{Name: p.model}
+	for _, model := range installed {
+		if ollamaModelName(model) == name {
+			state.Installed = true
+			break
+		}
+	}
+	if !state.Installed {
+		return state, nil
+	}
+
+	var running struct {
+		Models []struct {
+			Name      string    `json:"name"`
+			ExpiresAt time.Time `json:"expires_at"`
+		} `json:"models"`
+	}
+	if err := p.call(ctx, http.MethodGet, "/api/ps", nil, 10*time.Second, &running); err != nil {
+		return nil, fmt.Errorf("failed to list loaded Ollama models: %w", err)
+	}
+	for _, model := range running.Models {
+		if ollamaModelName(model.Name) == name {
+			state.Loaded = true
+			expiresAt := model.ExpiresAt
+			state.ExpiresAt = &expiresAt
+			break
+		}
+	}
+	return state, nil
+}
+
+// Pull downloads the model. It can take minutes; ctx bounds it.
+func (p *OllamaProvider) Pull(ctx context.Context) error {
+	body := map[string]interface{}{"model": p.model, "stream": false}
+	var resp struct {
+		Status string `json:"status"`
+	}
+	if err := p.call(ctx, http.MethodPost, "/api/pull", body, 0, &resp); err != nil {
+		return fmt.Errorf("failed to pull Ollama model %s: %w", p.model, err)
+	}
+	if resp.Status != "success" {
+		return fmt.Errorf("failed to pull Ollama model %s: status %q", p.model, resp.Status)
+	}
+	return nil
+}
+
+// Load loads the model into memory with the configured keep_alive, so the
+// first extraction does not pay for a cold load
+func (p *OllamaProvider) Load(ctx context.Context) error {
+	body := map[string]interface{}{"model": p.model, "stream": false}
+	if p.keepAlive != "" {
+		body["keep_alive"] = p.keepAlive
+	}
+	if err := p.call(ctx, http.MethodPost, "/api/generate", body, 0, nil); err != nil {
+		return fmt.Errorf("failed to load Ollama model %s: %w", p.model, err)
+	}
+	return nil
+}
+
+// call sends a JSON request to the Ollama API and decodes the response into
+// out, unless out is nil. A zero timeout leaves the request bounded by ctx.
+func (p *OllamaProvider) call(ctx context.Context, method, path string, body interface{}, timeout time.Duration, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.newHTTPClient(timeout).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyText, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Ollama returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(bodyText)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
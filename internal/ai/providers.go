@@ -3,28 +3,103 @@ package ai
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
 	"github.com/google/generative-ai-go/genai"
 	"github.com/sashabaranov/go-openai"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
-// Provider interface for AI providers
+// Provider interface for AI providers. params overrides the provider's
+// sampling defaults; it has been checked with ValidateGeneration.
 type Provider interface {
-	ExtractData(prompt string, imageBase64 string) (string, error)
+	ExtractData(ctx context.Context, prompt string, imageBase64 string, params models.GenerationParams) (string, error)
+}
+
+// Usage reports the token consumption of a provider call
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// Pinger is implemented by providers that can cheaply verify their API is usable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// UsageReporter is implemented by providers that report token usage of their last call
+type UsageReporter interface {
+	LastUsage() Usage
+}
+
+// TransportSetter is implemented by providers whose HTTP transport can be replaced
+type TransportSetter interface {
+	SetTransport(base http.RoundTripper)
+}
+
+// TextExtractor is implemented by providers that also take the OCR text on
+// its own, apart from the prompt
+type TextExtractor interface {
+	ExtractWithText(ctx context.Context, prompt, text, imageBase64 string, params models.GenerationParams) (string, error)
+}
+
+// ModelLister is implemented by providers that can list the models available to them
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// ModelStater is implemented by providers serving models themselves, which can
+// report whether the configured model is installed and loaded
+type ModelStater interface {
+	ModelState(ctx context.Context) (*ModelState, error)
+}
+
+// ModelState is the state of a provider's configured model
+type ModelState struct {
+	Name      string     `json:"name"`
+	Installed bool       `json:"installed"`
+	Loaded    bool       `json:"loaded"`              // In memory, so requests avoid a cold load
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // When an idle loaded model is unloaded
+}
+
+// visionModels are name fragments of models known to accept images, per provider
+var visionModels = map[string][]string{
+	"openai": {"gpt-4o", "gpt-4-turbo", "gpt-4.1", "vision", "o1", "o3", "o4"},
+	"gemini": {"gemini-1.5", "gemini-2", "vision", "flash", "pro-latest"},
+	"ollama": {"llava", "bakllava", "moondream", "minicpm-v", "vision", "qwen2.5vl", "gemma3"},
+}
+
+// SupportsVision reports whether a model is known to accept images. It is a
+// name-based guess; unknown models report false.
+func SupportsVision(provider, model string) bool {
+	model = strings.ToLower(model)
+	for _, fragment := range visionModels[provider] {
+		if strings.Contains(model, fragment) {
+			return true
+		}
+	}
+	return false
 }
 
 // OpenAIProvider implements Provider for OpenAI/Azure OpenAI
 type OpenAIProvider struct {
-	apiKey  string
-	baseURL string
-	model   string
+	httpTransport
+	apiKey    string
+	baseURL   string
+	model     string
+	lastUsage Usage
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
@@ -39,8 +114,8 @@ func NewOpenAIProvider(apiKey, baseURL, model string) *OpenAIProvider {
 	}
 }
 
-// ExtractData sends prompt and image to OpenAI
-func (p *OpenAIProvider) ExtractData(prompt string, imageBase64 string) (string, error) {
+// newClient creates an OpenAI or Azure OpenAI client
+func (p *OpenAIProvider) newClient() *openai.Client {
 	var config openai.ClientConfig
 
 	// Check if Azure OpenAI
@@ -53,13 +128,52 @@ func (p *OpenAIProvider) ExtractData(prompt string, imageBase64 string) (string,
 		}
 	}
 
-	client := openai.NewClientWithConfig(config)
+	config.HTTPClient = p.newHTTPClient(0)
+
+	return openai.NewClientWithConfig(config)
+}
+
+// Ping lists the available models, verifying reachability and the API key
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	_, err := p.newClient().ListModels(ctx)
+	if err != nil {
+		return fmt.Errorf("OpenAI API check failed: %w", err)
+	}
+	return nil
+}
+
+// ListModels returns the ids of the models the API key can use
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	list, err := p.newClient().ListModels(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OpenAI models: %w", err)
+	}
+
+	ids := make([]string, 0, len(list.Models))
+	for _, model := range list.Models {
+		ids = append(ids, model.ID)
+	}
+	return ids, nil
+}
+
+// ExtractData sends prompt and image to OpenAI
+func (p *OpenAIProvider) ExtractData(ctx context.Context, prompt string, imageBase64 string, params models.GenerationParams) (string, error) {
+	client := p.newClient()
 
 	// Build messages
 	var messages []openai.ChatCompletionMessage
 
 	if imageBase64 != "" {
-		// Vision model with image
+		// Vision model with image, which OpenAI takes as a data URI
+		image, mimeType, err := imagedata.Decode(imageBase64)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode image: %w", err)
+		}
+		maxImageTokens := 0
+		if params.MaxImageTokens != nil {
+			maxImageTokens = *params.MaxImageTokens
+		}
+		detail := chooseImageDetail(image, params.ImageDetail, maxImageTokens)
 		messages = []openai.ChatCompletionMessage{
 			{
 				Role: openai.ChatMessageRoleUser,
@@ -71,8 +185,8 @@ func (p *OpenAIProvider) ExtractData(prompt string, imageBase64 string) (string,
 					{
 						Type: openai.ChatMessagePartTypeImageURL,
 						ImageURL: &openai.ChatMessageImageURL{
-							URL:    imageBase64,
-							Detail: openai.ImageURLDetailAuto,
+							URL:    imagedata.Encode(image, mimeType),
+							Detail: openai.ImageURLDetail(detail),
 						},
 					},
 				},
@@ -88,23 +202,43 @@ func (p *OpenAIProvider) ExtractData(prompt string, imageBase64 string) (string,
 		}
 	}
 
-	// Create chat completion
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model:       p.model,
-			Messages:    messages,
-			Temperature: 0, // Deterministic results
-			ResponseFormat: &openai.ChatCompletionResponseFormat{
-				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
-			},
+	request := openai.ChatCompletionRequest{
+		Model:       p.model,
+		Messages:    messages,
+		Temperature: 0, // Deterministic results
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		},
-	)
+	}
+	if params.Temperature != nil {
+		request.Temperature = *params.Temperature
+	}
+	if params.MaxTokens != nil {
+		request.MaxTokens = *params.MaxTokens
+	}
+	if params.TopP != nil {
+		request.TopP = *params.TopP
+	}
+	if v, ok := params.Options["seed"]; ok {
+		seed, _ := intOption(v)
+		request.Seed = &seed
+	}
+	if v, ok := params.Options["stop"]; ok {
+		request.Stop, _ = stringsOption(v)
+	}
+
+	// Create chat completion
+	resp, err := client.CreateChatCompletion(ctx, request)
 
 	if err != nil {
 		return "", fmt.Errorf("OpenAI API call failed: %w", err)
 	}
 
+	p.lastUsage = Usage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}
+
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response from OpenAI")
 	}
@@ -112,10 +246,17 @@ func (p *OpenAIProvider) ExtractData(prompt string, imageBase64 string) (string,
 	return resp.Choices[0].Message.Content, nil
 }
 
+// LastUsage returns the token usage of the last call
+func (p *OpenAIProvider) LastUsage() Usage {
+	return p.lastUsage
+}
+
 // GeminiProvider implements Provider for Google Gemini
 type GeminiProvider struct {
-	apiKey string
-	model  string
+	httpTransport
+	apiKey    string
+	model     string
+	lastUsage Usage
 }
 
 // NewGeminiProvider creates a new Gemini provider
@@ -129,11 +270,56 @@ func NewGeminiProvider(apiKey, model string) *GeminiProvider {
 	}
 }
 
-// ExtractData sends prompt and image to Gemini
-func (p *GeminiProvider) ExtractData(prompt string, imageBase64 string) (string, error) {
-	ctx := context.Background()
+// newClient creates a Gemini client
+func (p *GeminiProvider) newClient(ctx context.Context) (*genai.Client, error) {
+	// A custom HTTP client bypasses the API key option, so the transport sets the key
+	httpClient := p.newHTTPClient(0)
+	httpClient.Transport = &apiKeyTransport{key: p.apiKey, base: httpClient.Transport}
+
+	return genai.NewClient(ctx, option.WithAPIKey(p.apiKey), option.WithHTTPClient(httpClient))
+}
+
+// Ping fetches the first page of models, verifying reachability and the API key
+func (p *GeminiProvider) Ping(ctx context.Context) error {
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+	defer client.Close()
+
+	_, err = client.ListModels(ctx).Next()
+	if err != nil && !errors.Is(err, iterator.Done) {
+		return fmt.Errorf("Gemini API check failed: %w", err)
+	}
+	return nil
+}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(p.apiKey))
+// ListModels returns the names of the available models, without the "models/" prefix
+func (p *GeminiProvider) ListModels(ctx context.Context) ([]string, error) {
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+	defer client.Close()
+
+	var names []string
+	it := client.ListModels(ctx)
+	for {
+		info, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Gemini models: %w", err)
+		}
+		names = append(names, strings.TrimPrefix(info.Name, "models/"))
+	}
+	return names, nil
+}
+
+// ExtractData sends prompt and image to Gemini
+func (p *GeminiProvider) ExtractData(ctx context.Context, prompt string, imageBase64 string, params models.GenerationParams) (string, error) {
+	client, err := p.newClient(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to create Gemini client: %w", err)
 	}
@@ -141,30 +327,33 @@ func (p *GeminiProvider) ExtractData(prompt string, imageBase64 string) (string,
 
 	model := client.GenerativeModel(p.model)
 	model.GenerationConfig.ResponseMIMEType = "application/json"
+	if params.Temperature != nil {
+		model.SetTemperature(*params.Temperature)
+	}
+	if params.MaxTokens != nil {
+		model.SetMaxOutputTokens(int32(*params.MaxTokens))
+	}
+	if params.TopP != nil {
+		model.SetTopP(*params.TopP)
+	}
+	if v, ok := params.Options["topK"]; ok {
+		topK, _ := intOption(v)
+		model.SetTopK(int32(topK))
+	}
+	if v, ok := params.Options["stop"]; ok {
+		model.StopSequences, _ = stringsOption(v)
+	}
 
 	// Build parts
 	parts := []genai.Part{genai.Text(prompt)}
 
 	// Add image if provided
 	if imageBase64 != "" {
-		// Remove data URI prefix if present
-		imageData := imageBase64
-		if strings.HasPrefix(imageData, "data:image") {
-			parts := strings.Split(imageData, ",")
-			if len(parts) > 1 {
-				imageData = parts[1]
-			}
-		}
-
-		// Decode base64
-		imageBytes, err := decodeBase64(imageData)
+		imageBytes, mimeType, err := imagedata.Decode(imageBase64)
 		if err != nil {
 			return "", fmt.Errorf("failed to decode image: %w", err)
 		}
 
-		// Detect MIME type
-		mimeType := detectMIMEType(imageBytes)
-
 		blob := genai.Blob{
 			MIMEType: mimeType,
 			Data:     imageBytes,
@@ -179,6 +368,13 @@ func (p *GeminiProvider) ExtractData(prompt string, imageBase64 string) (string,
 		return "", fmt.Errorf("Gemini API call failed: %w", err)
 	}
 
+	if resp.UsageMetadata != nil {
+		p.lastUsage = Usage{
+			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+			CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		}
+	}
+
 	if len(resp.Candidates) == 0 {
 		return "", fmt.Errorf("no response from Gemini")
 	}
@@ -192,14 +388,24 @@ func (p *GeminiProvider) ExtractData(prompt string, imageBase64 string) (string,
 	return result, nil
 }
 
+// LastUsage returns the token usage of the last call
+func (p *GeminiProvider) LastUsage() Usage {
+	return p.lastUsage
+}
+
 // OllamaProvider implements Provider for local Ollama
 type OllamaProvider struct {
-	baseURL string
-	model   string
+	httpTransport
+	baseURL   string
+	model     string
+	keepAlive string
+	lastUsage Usage
 }
 
-// NewOllamaProvider creates a new Ollama provider
-func NewOllamaProvider(baseURL, model string) *OllamaProvider {
+// NewOllamaProvider creates a new Ollama provider. keepAlive is how long
+// Ollama keeps the model loaded after a request, e.g. "30m"; empty uses
+// Ollama's default.
+func NewOllamaProvider(baseURL, model, keepAlive string) *OllamaProvider {
 	if baseURL == "" {
 		baseURL = "http://localhost:11434" // Default Ollama URL
 	}
@@ -207,13 +413,66 @@ func NewOllamaProvider(baseURL, model string) *OllamaProvider {
 		model = "mistral" // Default model
 	}
 	return &OllamaProvider{
-		baseURL: baseURL,
-		model:   model,
+		baseURL:   baseURL,
+		model:     model,
+		keepAlive: keepAlive,
+	}
+}
+
+// Ping lists the locally installed models
+func (p *OllamaProvider) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.newHTTPClient(10 * time.Second).Do(req)
+	if err != nil {
+		return fmt.Errorf("Ollama API check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Ollama returned status %d", resp.StatusCode)
 	}
+	return nil
+}
+
+// ListModels returns the locally installed models
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.newHTTPClient(10 * time.Second).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Ollama models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama returned status %d", resp.StatusCode)
+	}
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to decode Ollama models: %w", err)
+	}
+
+	names := make([]string, 0, len(tags.Models))
+	for _, model := range tags.Models {
+		names = append(names, model.Name)
+	}
+	return names, nil
 }
 
 // ExtractData sends prompt and image to Ollama
-func (p *OllamaProvider) ExtractData(prompt string, imageBase64 string) (string, error) {
+func (p *OllamaProvider) ExtractData(ctx context.Context, prompt string, imageBase64 string, params models.GenerationParams) (string, error) {
 	// Build message
 	message := map[string]interface{}{
 		"role":    "user",
@@ -222,24 +481,39 @@ func (p *OllamaProvider) ExtractData(prompt string, imageBase64 string) (string,
 
 	// Add image if provided
 	if imageBase64 != "" {
-		// Remove data URI prefix if present
-		if strings.HasPrefix(imageBase64, "data:image") {
-			parts := strings.Split(imageBase64, ",")
-			if len(parts) > 1 {
-				imageBase64 = parts[1]
-			}
+		// Ollama takes bare standard base64
+		imageBytes, _, err := imagedata.Decode(imageBase64)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode image: %w", err)
 		}
+		message["images"] = []string{base64.StdEncoding.EncodeToString(imageBytes)}
+	}
 
-		message["images"] = []string{imageBase64}
+	// Sampling parameters go in "options"; provider-specific ones pass through
+	options := map[string]interface{}{"temperature": 0}
+	for name, value := range params.Options {
+		options[name] = value
+	}
+	if params.Temperature != nil {
+		options["temperature"] = *params.Temperature
+	}
+	if params.MaxTokens != nil {
+		options["num_predict"] = *params.MaxTokens
+	}
+	if params.TopP != nil {
+		options["top_p"] = *params.TopP
 	}
 
 	// Build request body
 	body := map[string]interface{}{
-		"model":       p.model,
-		"messages":    []interface{}{message},
-		"temperature": 0,
-		"stream":      false,
-		"format":      "json",
+		"model":    p.model,
+		"messages": []interface{}{message},
+		"options":  options,
+		"stream":   false,
+		"format":   "json",
+	}
+	if p.keepAlive != "" {
+		body["keep_alive"] = p.keepAlive
 	}
 
 	bodyBytes, err := json.Marshal(body)
@@ -248,12 +522,10 @@ func (p *OllamaProvider) ExtractData(prompt string, imageBase64 string) (string,
 	}
 
 	// Make HTTP request
-	httpClient := &http.Client{
-		Timeout: 120 * time.Second, // Ollama can be slow on CPU
-	}
+	httpClient := p.newHTTPClient(120 * time.Second) // Ollama can be slow on CPU
 
 	url := p.baseURL + "/api/chat"
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -281,6 +553,8 @@ func (p *OllamaProvider) ExtractData(prompt string, imageBase64 string) (string,
 		Message struct {
 			Content string `json:"content"`
 		} `json:"message"`
+		PromptEvalCount int `json:"prompt_eval_count"`
+		EvalCount       int `json:"eval_count"`
 	}
 
 	err = json.Unmarshal(responseBody, &responseObj)
@@ -288,54 +562,49 @@ func (p *OllamaProvider) ExtractData(prompt string, imageBase64 string) (string,
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return responseObj.Message.Content, nil
-}
-
-// Helper functions
-
-func decodeBase64(s string) ([]byte, error) {
-	// Try standard base64 first
-	decoded := make([]byte, len(s))
-	n, err := io.ReadFull(strings.NewReader(s), decoded)
-	if err == nil {
-		return decoded[:n], nil
+	p.lastUsage = Usage{
+		PromptTokens:     responseObj.PromptEvalCount,
+		CompletionTokens: responseObj.EvalCount,
 	}
 
-	// If that fails, use encoding/base64
-	import_base64 := func() ([]byte, error) {
-		// This would normally import encoding/base64
-		// For simplicity, returning error
-		return nil, fmt.Errorf("base64 decoding not implemented")
-	}
+	return responseObj.Message.Content, nil
+}
 
-	return import_base64()
+// LastUsage returns the token usage of the last call
+func (p *OllamaProvider) LastUsage() Usage {
+	return p.lastUsage
 }
 
-func detectMIMEType(data []byte) string {
-	// Simple MIME type detection based on magic bytes
-	if len(data) < 4 {
-		return "application/octet-stream"
-	}
+// Helper functions
 
-	// JPEG
-	if data[0] == 0xFF && data[1] == 0xD8 {
-		return "image/jpeg"
-	}
+// httpTransport holds the base transport of a provider's HTTP clients
+type httpTransport struct {
+	base http.RoundTripper // nil uses http.DefaultTransport
+}
 
-	// PNG
-	if data[0] == 0x89 && data[1] == 0x50 && data[2] == 0x4E && data[3] == 0x47 {
-		return "image/png"
-	}
+// SetTransport replaces the transport that sends the provider's requests,
+// e.g. with a Cassette
+func (t *httpTransport) SetTransport(base http.RoundTripper) {
+	t.base = base
+}
 
-	// GIF
-	if data[0] == 0x47 && data[1] == 0x49 && data[2] == 0x46 {
-		return "image/gif"
+// newHTTPClient creates an HTTP client that forwards the request ID and trace context
+func (t *httpTransport) newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &requestid.Transport{Base: tracing.Transport(t.base)},
 	}
+}
 
-	// WebP
-	if len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP" {
-		return "image/webp"
-	}
+// apiKeyTransport adds the Gemini API key header to outgoing requests
+type apiKeyTransport struct {
+	key  string
+	base http.RoundTripper
+}
 
-	return "image/jpeg" // Default assumption for images
+// RoundTrip implements http.RoundTripper
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.key)
+	return t.base.RoundTrip(req)
 }
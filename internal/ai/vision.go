@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"bytes"
+	"image"
+
+	// Formats imageSize can read
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// OpenAI image detail levels
+const (
+	DetailLow  = "low"
+	DetailHigh = "high"
+	DetailAuto = "auto"
+)
+
+// Image token costs of OpenAI vision models (gpt-4o family)
+const (
+	lowDetailTokens = 85  // Flat cost of a low detail image, seen at 512x512
+	tileTokens      = 170 // Per 512px tile of a high detail image, on top of lowDetailTokens
+	lowDetailSize   = 512 // Side of the square a low detail image is scaled into
+)
+
+// ImageTokens estimates the input tokens OpenAI charges for a width x height
+// image at detail. High detail images are scaled to fit 2048x2048, then so
+// their shortest side is at most 768px, and cost 170 tokens per 512px tile
+// plus 85.
+func ImageTokens(width, height int, detail string) int {
+	if detail == DetailLow || width <= 0 || height <= 0 {
+		return lowDetailTokens
+	}
+	w, h := float64(width), float64(height)
+	if longest := max(w, h); longest > 2048 {
+		w, h = w*2048/longest, h*2048/longest
+	}
+	if shortest := min(w, h); shortest > 768 {
+		w, h = w*768/shortest, h*768/shortest
+	}
+	tiles := ceilDiv(int(w+0.5), 512) * ceilDiv(int(h+0.5), 512)
+	return lowDetailTokens + tileTokens*tiles
+}
+
+// ceilDiv divides rounding up
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// chooseImageDetail returns the detail level to send an image at. low is
+// kept, and high is kept unless it would exceed maxTokens (0 = no budget).
+// Otherwise low is chosen when it loses nothing, because the image already
+// fits 512x512 (small receipts, thumbnails), or when high detail would exceed
+// the budget. Images whose size cannot be read are left to OpenAI's auto, or
+// sent at low detail when there is a budget.
+func chooseImageDetail(data []byte, detail string, maxTokens int) string {
+	if detail == DetailLow || detail == DetailHigh {
+		if detail == DetailHigh && maxTokens > 0 {
+			if size, err := imageSize(data); err == nil && ImageTokens(size.X, size.Y, DetailHigh) > maxTokens {
+				return DetailLow
+			}
+		}
+		return detail
+	}
+
+	size, err := imageSize(data)
+	if err != nil {
+		if maxTokens > 0 {
+			return DetailLow
+		}
+		return DetailAuto
+	}
+	if max(size.X, size.Y) <= lowDetailSize {
+		return DetailLow
+	}
+	if maxTokens > 0 && ImageTokens(size.X, size.Y, DetailHigh) > maxTokens {
+		return DetailLow
+	}
+	return DetailHigh
+}
+
+// imageSize reads the dimensions of an encoded image without decoding it
+func imageSize(data []byte) (image.Point, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Point{X: config.Width, Y: config.Height}, nil
+}
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// ErrKeyExists is returned when creating a key whose name is already in use
+var ErrKeyExists = errors.New("api key name already exists")
+
+// ErrKeyNotFound is returned when revoking an unknown key
+var ErrKeyNotFound = errors.New("api key not found")
+
+// KeyInfo is the public description of an API key (never includes the secret)
+type KeyInfo struct {
+	Name   string `json:"name"`
+	Admin  bool   `json:"admin"`
+	Tenant string `json:"tenant,omitempty"`
+	Source string `json:"source"` // "config" or "runtime"
+}
+
+type apiKey struct {
+	hash [sha256.Size]byte
+	info KeyInfo
+}
+
+// KeyStore validates API keys defined in config or created at runtime
+type KeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*apiKey // by name
+}
+
+// NewKeyStore creates a key store from the configured keys
+func NewKeyStore(configured []models.APIKeyConfig) (*KeyStore, error) {
+	ks := &KeyStore{
+		keys: make(map[string]*apiKey),
+	}
+
+	for _, k := range configured {
+		if k.Name == "" || k.Key == "" {
+			return nil, fmt.Errorf("api key entries require both name and key")
+		}
+		if _, exists := ks.keys[k.Name]; exists {
+			return nil, fmt.Errorf("duplicate api key name: %s", k.Name)
+		}
+		ks.keys[k.Name] = &apiKey{
+			hash: sha256.Sum256([]byte(k.Key)),
+			info: KeyInfo{Name: k.Name, Admin: k.Admin, Tenant: k.Tenant, Source: "config"},
+		}
+	}
+
+	return ks, nil
+}
+
+// Authenticate returns the identity owning the given secret
+func (ks *KeyStore) Authenticate(secret string) (*Identity, bool) {
+	if secret == "" {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(secret))
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	// Compare against every key in constant time to avoid leaking which one matched
+	var found *apiKey
+	for _, k := range ks.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			found = k
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+
+	return &Identity{
+		Name:   found.info.Name,
+		Admin:  found.info.Admin,
+		Method: "api_key",
+		Tenant: found.info.Tenant,
+	}, true
+}
+
+// List returns the keys of tenant sorted by name, or all keys when tenant is empty
+func (ks *KeyStore) List(tenant string) []KeyInfo {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	infos := make([]KeyInfo, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		if tenant != "" && k.info.Tenant != tenant {
+			continue
+		}
+		infos = append(infos, k.info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos
+}
+
+// Tenant returns the tenant of the named key
+func (ks *KeyStore) Tenant(name string) (string, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	k, exists := ks.keys[name]
+	if !exists {
+		return "", false
+	}
+	return k.info.Tenant, true
+}
+
+// Create generates a new runtime key and returns its secret. Runtime keys are
+// kept in memory only and disappear on restart.
+func (ks *KeyStore) Create(name string, admin bool, tenant string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("key name is required")
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret := "ioc_" + hex.EncodeToString(b)
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, exists := ks.keys[name]; exists {
+		return "", ErrKeyExists
+	}
+	ks.keys[name] = &apiKey{
+		hash: sha256.Sum256([]byte(secret)),
+		info: KeyInfo{Name: name, Admin: admin, Tenant: tenant, Source: "runtime"},
+	}
+
+	return secret, nil
+}
+
+// Revoke removes a key by name. When tenant is set, keys of other tenants
+// (and global keys) are reported as not found.
+func (ks *KeyStore) Revoke(name, tenant string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	k, exists := ks.keys[name]
+	if !exists || (tenant != "" && k.info.Tenant != tenant) {
+		return ErrKeyNotFound
+	}
+	delete(ks.keys, name)
+
+	return nil
+}
+
+// AuthenticateRequest resolves the API key sent in the X-API-Key header or an
+// "Authorization: Bearer" header
+func (ks *KeyStore) AuthenticateRequest(r *http.Request) (*Identity, error) {
+	secret := extractKey(r)
+	if secret == "" {
+		return nil, ErrNoCredentials
+	}
+
+	identity, ok := ks.Authenticate(secret)
+	if !ok {
+		return nil, fmt.Errorf("invalid api key")
+	}
+
+	return identity, nil
+}
+
+// extractKey reads the API key from the request headers
+func extractKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	authz := r.Header.Get("Authorization")
+	if len(authz) > 7 && strings.EqualFold(authz[:7], "bearer ") {
+		return strings.TrimSpace(authz[7:])
+	}
+
+	return ""
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func newTestKeyStore(t *testing.T) *KeyStore {
+	t.Helper()
+	ks, err := NewKeyStore([]models.APIKeyConfig{
+		{Name: "root", Key: "root-secret", Admin: true},
+		{Name: "acme-admin", Key: "acme-secret", Admin: true, Tenant: "acme"},
+		{Name: "acme-app", Key: "acme-app-secret", Tenant: "acme"},
+		{Name: "globex-app", Key: "globex-app-secret", Tenant: "globex"},
+	})
+	if err != nil {
+		t.Fatalf("NewKeyStore: %v", err)
+	}
+	return ks
+}
+
+func TestNewKeyStoreRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []models.APIKeyConfig
+	}{
+		{"missing name", []models.APIKeyConfig{{Key: "secret"}}},
+		{"missing key", []models.APIKeyConfig{{Name: "app"}}},
+		{"duplicate name", []models.APIKeyConfig{{Name: "app", Key: "a"}, {Name: "app", Key: "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyStore(tt.keys); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ks := newTestKeyStore(t)
+
+	tests := []struct {
+		secret string
+		ok     bool
+		name   string
+		admin  bool
+		tenant string
+	}{
+		{"root-secret", true, "root", true, ""},
+		{"acme-secret", true, "acme-admin", true, "acme"},
+		{"acme-app-secret", true, "acme-app", false, "acme"},
+		{"wrong", false, "", false, ""},
+		{"", false, "", false, ""},
+		{"root-secret ", false, "", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			identity, ok := ks.Authenticate(tt.secret)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if identity.Name != tt.name || identity.Admin != tt.admin || identity.Tenant != tt.tenant || identity.Method != "api_key" {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestCreateAndRevoke(t *testing.T) {
+	ks := newTestKeyStore(t)
+
+	secret, err := ks.Create("erp", false, "acme")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	identity, ok := ks.Authenticate(secret)
+	if !ok || identity.Name != "erp" || identity.Tenant != "acme" {
+		t.Fatalf("created key does not authenticate: %+v", identity)
+	}
+	if _, err := ks.Create("erp", false, ""); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Create duplicate: err = %v, want ErrKeyExists", err)
+	}
+
+	if err := ks.Revoke("erp", ""); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, ok := ks.Authenticate(secret); ok {
+		t.Error("revoked key still authenticates")
+	}
+	if err := ks.Revoke("erp", ""); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Revoke twice: err = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestListByTenant(t *testing.T) {
+	ks := newTestKeyStore(t)
+
+	tests := []struct {
+		tenant string
+		want   []string
+	}{
+		{"", []string{"acme-admin", "acme-app", "globex-app", "root"}},
+		{"acme", []string{"acme-admin", "acme-app"}},
+		{"globex", []string{"globex-app"}},
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tenant, func(t *testing.T) {
+			infos := ks.List(tt.tenant)
+			if len(infos) != len(tt.want) {
+				t.Fatalf("List(%q) = %+v, want %v", tt.tenant, infos, tt.want)
+			}
+			for i, info := range infos {
+				if info.Name != tt.want[i] {
+					t.Errorf("List(%q)[%d] = %s, want %s", tt.tenant, i, info.Name, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeByTenant(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		tenant  string
+		wantErr error
+	}{
+		{"own tenant", "acme-app", "acme", nil},
+		{"other tenant", "globex-app", "acme", ErrKeyNotFound},
+		{"global key", "root", "acme", ErrKeyNotFound},
+		{"global admin", "globex-app", "", nil},
+		{"unknown", "missing", "", ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newTestKeyStore(t)
+			err := ks.Revoke(tt.key, tt.tenant)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Revoke(%q, %q) = %v, want %v", tt.key, tt.tenant, err, tt.wantErr)
+			}
+			_, exists := ks.keys[tt.key]
+			if tt.wantErr == nil && exists {
+				t.Error("key still present")
+			}
+			if tt.wantErr != nil && tt.key != "missing" && !exists {
+				t.Error("key of another tenant was removed")
+			}
+		})
+	}
+}
+
+func TestAuthenticateRequestHeaders(t *testing.T) {
+	ks := newTestKeyStore(t)
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		wantErr bool
+		noCreds bool
+	}{
+		{"api key header", "X-API-Key", "root-secret", false, false},
+		{"bearer", "Authorization", "Bearer root-secret", false, false},
+		{"lowercase bearer", "Authorization", "bearer root-secret", false, false},
+		{"basic", "Authorization", "Basic cm9vdA==", true, true},
+		{"invalid", "X-API-Key", "nope", true, false},
+		{"none", "", "", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			_, err := ks.AuthenticateRequest(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNoCredentials) != tt.noCreds {
+				t.Errorf("err = %v, want ErrNoCredentials: %v", err, tt.noCreds)
+			}
+		})
+	}
+}
+
+func TestTenant(t *testing.T) {
+	ks := newTestKeyStore(t)
+
+	tests := []struct {
+		key    string
+		tenant string
+		exists bool
+	}{
+		{"acme-app", "acme", true},
+		{"root", "", true},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		tenant, exists := ks.Tenant(tt.key)
+		if tenant != tt.tenant || exists != tt.exists {
+			t.Errorf("Tenant(%q) = %q, %v, want %q, %v", tt.key, tenant, exists, tt.tenant, tt.exists)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/logging"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+)
+
+// ErrNoCredentials is returned when a request carries no credentials for an authenticator
+var ErrNoCredentials = errors.New("no credentials provided")
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// Identity describes the authenticated caller of a request
+type Identity struct {
+	Name   string                 // Key name or token subject
+	Admin  bool                   // May manage API keys
+	Method string                 // "api_key" or "jwt"
+	Tenant string                 // Tenant ID, empty for the default scope
+	Claims map[string]interface{} // Token claims (JWT only)
+}
+
+// Key returns a stable identifier of the caller for accounting and rate limiting
+func (i *Identity) Key() string {
+	return i.Method + ":" + i.Name
+}
+
+// Authenticator resolves the caller identity of a request
+type Authenticator interface {
+	AuthenticateRequest(r *http.Request) (*Identity, error)
+}
+
+// Authenticate returns the identity from the first authenticator accepting r.
+// The error is ErrNoCredentials unless some credentials were present but invalid.
+func Authenticate(r *http.Request, authenticators ...Authenticator) (*Identity, error) {
+	var lastErr error = ErrNoCredentials
+	for _, a := range authenticators {
+		identity, err := a.AuthenticateRequest(r)
+		if err == nil {
+			return identity, nil
+		}
+		if !errors.Is(err, ErrNoCredentials) {
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// WithCaller stores identity in ctx and adds the caller and tenant to its logger
+func WithCaller(ctx context.Context, identity *Identity) context.Context {
+	ctx = logging.With(WithIdentity(ctx, identity), "caller", identity.Key())
+	if identity.Tenant != "" {
+		ctx = logging.With(ctx, "tenant", identity.Tenant)
+	}
+	return ctx
+}
+
+// Middleware rejects requests that none of the authenticators accept
+func Middleware(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := Authenticate(r, authenticators...)
+			if err == nil {
+				ctx := WithCaller(r.Context(), identity)
+				logging.FromContext(ctx).Debug("authenticated")
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			logging.FromContext(r.Context()).Warn("authentication rejected", "remote_addr", r.RemoteAddr, "error", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="invoice-ocr-service"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":     "Missing or invalid credentials",
+				"code":      "unauthorized",
+				"requestId": w.Header().Get(requestid.Header),
+			})
+		})
+	}
+}
+
+// WithIdentity returns a copy of ctx carrying the caller identity
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// IdentityFromContext returns the caller identity, if the request was authenticated
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey).(*Identity)
+	return identity, ok
+}
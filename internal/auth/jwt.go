@@ -0,0 +1,427 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"golang.org/x/sync/singleflight"
+)
+
+// clockSkew tolerates small clock differences with the identity provider
+const clockSkew = 60 * time.Second
+
+// JWTValidator authenticates bearer JWTs against keys published at a JWKS endpoint
+type JWTValidator struct {
+	jwksURL     string
+	issuer      string
+	audience    string
+	nameClaim   string
+	adminClaim  string
+	adminValue  string
+	tenantClaim string
+	refresh     time.Duration
+	httpClient  *http.Client
+
+	refreshes singleflight.Group // Collapses concurrent JWKS fetches
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey // by kid
+	fetchedAt time.Time
+}
+
+// NewJWTValidator creates a new JWT validator
+func NewJWTValidator(config models.JWTConfig) (*JWTValidator, error) {
+	if config.JWKSURL == "" {
+		return nil, fmt.Errorf("jwt authentication requires jwks_url")
+	}
+
+	nameClaim := config.NameClaim
+	if nameClaim == "" {
+		nameClaim = "sub" // Default identity claim
+	}
+	refresh := config.JWKSRefresh
+	if refresh <= 0 {
+		refresh = time.Hour // Default JWKS cache lifetime
+	}
+
+	return &JWTValidator{
+		jwksURL:     config.JWKSURL,
+		issuer:      config.Issuer,
+		audience:    config.Audience,
+		nameClaim:   nameClaim,
+		adminClaim:  config.AdminClaim,
+		adminValue:  config.AdminValue,
+		tenantClaim: config.TenantClaim,
+		refresh:     refresh,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		keys:        make(map[string]crypto.PublicKey),
+	}, nil
+}
+
+// AuthenticateRequest validates the bearer token of a request
+func (v *JWTValidator) AuthenticateRequest(r *http.Request) (*Identity, error) {
+	authz := r.Header.Get("Authorization")
+	if len(authz) <= 7 || !strings.EqualFold(authz[:7], "bearer ") {
+		return nil, ErrNoCredentials
+	}
+	token := strings.TrimSpace(authz[7:])
+
+	// Opaque API keys sent as bearer tokens are not JWTs
+	if strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := v.Validate(token)
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := claims[v.nameClaim].(string)
+	identity := &Identity{
+		Name:   name,
+		Admin:  v.isAdmin(claims),
+		Method: "jwt",
+		Claims: claims,
+	}
+	// A token without the tenant claim must not fall into the default scope
+	if v.tenantClaim != "" {
+		tenant, _ := claims[v.tenantClaim].(string)
+		if tenant == "" {
+			return nil, fmt.Errorf("token has no %s claim", v.tenantClaim)
+		}
+		identity.Tenant = tenant
+	}
+
+	return identity, nil
+}
+
+// Validate verifies the signature and registered claims of a token
+func (v *JWTValidator) Validate(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding: %w", err)
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	err = v.checkClaims(claims, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// checkClaims validates expiry, not-before, issuer and audience
+func (v *JWTValidator) checkClaims(claims map[string]interface{}, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return fmt.Errorf("token expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("token not yet valid")
+	}
+
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("unexpected token issuer: %s", iss)
+		}
+	}
+
+	if v.audience != "" && !claimContains(claims["aud"], v.audience) {
+		return fmt.Errorf("token audience does not include %s", v.audience)
+	}
+
+	return nil
+}
+
+// isAdmin reports whether the admin claim grants key management
+func (v *JWTValidator) isAdmin(claims map[string]interface{}) bool {
+	if v.adminClaim == "" || v.adminValue == "" {
+		return false
+	}
+	return claimContains(claims[v.adminClaim], v.adminValue)
+}
+
+// key returns the verification key for a kid, refreshing the JWKS when the
+// kid is unknown (key rotation). A cached key that is merely stale is used
+// right away while the JWKS is refreshed in the background.
+func (v *JWTValidator) key(kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetchedAt) > v.refresh
+	v.mu.RUnlock()
+
+	if ok {
+		if stale {
+			go func() {
+				// Keep using the cached key while the identity provider is unreachable
+				if err := v.fetchKeys(); err != nil {
+					slog.Warn("JWKS refresh failed, using cached keys", "error", err)
+				}
+			}()
+		}
+		return key, nil
+	}
+
+	err := v.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, ok = v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+
+	return key, nil
+}
+
+// fetchKeys refreshes the cached keys from the JWKS endpoint. Concurrent
+// calls share one download, and the lock is only taken to swap the keys in,
+// so validations never wait on the network for cached keys.
+func (v *JWTValidator) fetchKeys() error {
+	_, err, _ := v.refreshes.Do("jwks", func() (interface{}, error) {
+		// Don't hammer the identity provider with tokens of unknown kids
+		v.mu.RLock()
+		recent := time.Since(v.fetchedAt) < 10*time.Second
+		v.mu.RUnlock()
+		if recent {
+			return nil, nil
+		}
+
+		keys, err := v.downloadKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		v.mu.Lock()
+		v.keys = keys
+		v.fetchedAt = time.Now()
+		v.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+// downloadKeys downloads and parses the JWKS document
+func (v *JWTValidator) downloadKeys() (map[string]crypto.PublicKey, error) {
+	resp, err := v.httpClient.Get(v.jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			// Skip key types we do not support
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	return keys, nil
+}
+
+// jwk is a JSON Web Key (RFC 7517) restricted to RSA and EC signing keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts the JWK into a Go public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// verifySignature checks a JWS signature for the supported algorithms
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		// Rejects "none" and HMAC algorithms, which cannot be verified with a JWKS
+		return fmt.Errorf("unsupported token algorithm: %s", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return fmt.Errorf("algorithm %s does not match RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' {
+			return fmt.Errorf("algorithm %s does not match EC key", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported key type")
+	}
+}
+
+// decodeSegment decodes a base64url JSON token segment
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeBigInt decodes a base64url big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// claimContains reports whether a string or string-array claim contains value
+func claimContains(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case string:
+		if c == value {
+			return true
+		}
+		// Space-separated claims such as "scope"
+		for _, field := range strings.Fields(c) {
+			if field == value {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range c {
+			if s, ok := item.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
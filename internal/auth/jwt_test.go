@@ -0,0 +1,349 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// testIdP serves a JWKS document and signs tokens with its keys
+type testIdP struct {
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches atomic.Int32
+	delay   time.Duration
+	server  *httptest.Server
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &testIdP{rsaKey: rsaKey, ecKey: ecKey}
+	idp.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp.fetches.Add(1)
+		time.Sleep(idp.delay)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+				{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+				{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+			},
+		})
+	}))
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign returns a token with the given header values and claims
+func (idp *testIdP) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + b64(signature)
+}
+
+func (idp *testIdP) validator(t *testing.T, config models.JWTConfig) *JWTValidator {
+	t.Helper()
+	config.JWKSURL = idp.server.URL
+	v, err := NewJWTValidator(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub": "user-1",
+		"iss": "https://idp.example.com",
+		"aud": []string{"invoice-ocr", "other"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, models.JWTConfig{Issuer: "https://idp.example.com", Audience: "invoice-ocr"})
+
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		alg     string
+		kid     string
+		claims  map[string]interface{}
+		wantErr string
+	}{
+		{"rsa", "RS256", "rsa", validClaims(), ""},
+		{"ec", "ES256", "ec", validClaims(), ""},
+		{"alg does not match key", "ES256", "rsa", validClaims(), "does not match RSA key"},
+		{"none", "none", "rsa", validClaims(), "unsupported token algorithm"},
+		{"hmac", "HS256", "rsa", validClaims(), "unsupported token algorithm"},
+		{"unknown kid", "RS256", "missing", validClaims(), "unknown signing key"},
+		{"encryption key", "RS256", "enc", validClaims(), "unknown signing key"},
+		{"expired", "RS256", "rsa", with("exp", time.Now().Add(-time.Hour).Unix()), "token expired"},
+		{"expired within skew", "RS256", "rsa", with("exp", time.Now().Add(-30*time.Second).Unix()), ""},
+		{"no expiry", "RS256", "rsa", with("exp", nil), "no expiry"},
+		{"not yet valid", "RS256", "rsa", with("nbf", time.Now().Add(time.Hour).Unix()), "not yet valid"},
+		{"wrong issuer", "RS256", "rsa", with("iss", "https://evil.example.com"), "unexpected token issuer"},
+		{"wrong audience", "RS256", "rsa", with("aud", "other"), "audience"},
+		{"string audience", "RS256", "rsa", with("aud", "invoice-ocr"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(idp.sign(t, tt.alg, tt.kid, tt.claims))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsTamperedTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, models.JWTConfig{})
+
+	token := idp.sign(t, "RS256", "rsa", validClaims())
+	parts := strings.Split(token, ".")
+
+	claims := validClaims()
+	claims["sub"] = "admin"
+	forged, _ := json.Marshal(claims)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"swapped claims", parts[0] + "." + b64(forged) + "." + parts[2]},
+		{"no signature", parts[0] + "." + parts[1] + "."},
+		{"bad encoding", parts[0] + "." + parts[1] + ".!!!"},
+		{"two segments", parts[0] + "." + parts[1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Validate(tt.token); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthenticateRequestClaims(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, models.JWTConfig{
+		NameClaim:   "email",
+		AdminClaim:  "roles",
+		AdminValue:  "invoice-admin",
+		TenantClaim: "tenant",
+	})
+
+	tests := []struct {
+		name   string
+		extra  map[string]interface{}
+		admin  bool
+		tenant string
+	}{
+		{"plain", nil, false, "acme"},
+		{"admin role", map[string]interface{}{"roles": []string{"user", "invoice-admin"}}, true, "acme"},
+		{"admin scope string", map[string]interface{}{"roles": "user invoice-admin"}, true, "acme"},
+		{"other role", map[string]interface{}{"roles": []string{"invoice-admin-2"}}, false, "acme"},
+		{"other tenant", map[string]interface{}{"tenant": "globex"}, false, "globex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			claims["email"] = "ana@example.com"
+			claims["tenant"] = "acme"
+			for k, value := range tt.extra {
+				claims[k] = value
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+idp.sign(t, "RS256", "rsa", claims))
+
+			identity, err := v.AuthenticateRequest(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Name != "ana@example.com" || identity.Method != "jwt" || identity.Admin != tt.admin || identity.Tenant != tt.tenant {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRequestRequiresTenantClaim(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, models.JWTConfig{TenantClaim: "tenant"})
+
+	tests := []struct {
+		name   string
+		tenant interface{}
+	}{
+		{"missing", nil},
+		{"empty", ""},
+		{"number", 42},
+		{"array", []string{"acme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			if tt.tenant != nil {
+				claims["tenant"] = tt.tenant
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+idp.sign(t, "RS256", "rsa", claims))
+
+			identity, err := v.AuthenticateRequest(r)
+			if err == nil || err == ErrNoCredentials {
+				t.Errorf("identity = %+v, err = %v, want a rejection", identity, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRequestIgnoresOpaqueTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, models.JWTConfig{})
+
+	for _, header := range []string{"", "Bearer ioc_0123456789", "Basic dXNlcjpwYXNz"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if _, err := v.AuthenticateRequest(r); err != ErrNoCredentials {
+			t.Errorf("%q: err = %v, want ErrNoCredentials", header, err)
+		}
+	}
+	if n := idp.fetches.Load(); n != 0 {
+		t.Errorf("JWKS fetched %d times for non-JWT credentials", n)
+	}
+}
+
+func TestKeyCaching(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, models.JWTConfig{})
+	token := idp.sign(t, "RS256", "rsa", validClaims())
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Validate(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := idp.fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+
+	// Unknown kids right after a fetch do not trigger another one
+	v.Validate(idp.sign(t, "RS256", "rotated", validClaims()))
+	if n := idp.fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times after unknown kid, want 1", n)
+	}
+}
+
+func TestConcurrentRefreshesShareOneFetch(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.delay = 100 * time.Millisecond
+	v := idp.validator(t, models.JWTConfig{})
+	token := idp.sign(t, "RS256", "rsa", validClaims())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Validate(token); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := idp.fetches.Load(); n != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", n)
+	}
+}
+
+func TestStaleKeysDoNotBlockValidation(t *testing.T) {
+	idp := newTestIdP(t)
+	v := idp.validator(t, models.JWTConfig{JWKSRefresh: time.Minute})
+	token := idp.sign(t, "RS256", "rsa", validClaims())
+	if _, err := v.Validate(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make the cache stale and the identity provider slow
+	v.mu.Lock()
+	v.fetchedAt = time.Now().Add(-time.Hour)
+	v.mu.Unlock()
+	idp.delay = 2 * time.Second
+
+	start := time.Now()
+	if _, err := v.Validate(token); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("validation with a cached key took %v", elapsed)
+	}
+}
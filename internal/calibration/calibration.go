@@ -0,0 +1,216 @@
+// Package calibration maps the confidence reported by the AI to the share of
+// reviewed invoices that needed no correction, learned per provider and per
+// field from the corrections stored with invoices
+package calibration
+
+import (
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+)
+
+// Calibration methods
+const (
+	MethodIsotonic = "isotonic" // Monotonic step curve, needs more samples
+	MethodPlatt    = "platt"    // Logistic curve, smooth with few samples
+)
+
+// Overall is the curve of whole invoices, right when no field was corrected
+const Overall = "invoice"
+
+// Pooled is the provider of the curves fitted on every provider's samples
+const Pooled = "*"
+
+// Fields are the corrected fields calibrated one by one
+var Fields = []string{"vendor", "date", "total", "tax", "categories", "items"}
+
+// Sample is a reviewed extraction
+type Sample struct {
+	Provider   string
+	Confidence float64         // Reported by the AI
+	Corrected  map[string]bool // By field
+}
+
+// Samples returns the reviewed extractions of records: approved invoices and
+// invoices with corrected fields. Invoices corrected before corrected fields
+// were recorded are left out, since what was wrong is unknown.
+func Samples(records []*models.StoredInvoice) []Sample {
+	var samples []Sample
+	for _, record := range records {
+		invoice := record.Invoice
+		if invoice == nil || len(record.CorrectedFields) == 0 && (record.ApprovedAt == nil || record.CorrectedAt != nil) {
+			continue
+		}
+		provider := invoice.Provider
+		if provider == "" {
+			provider = record.AIProvider
+		}
+		confidence := invoice.Confidence
+		if invoice.FieldConfidence != nil {
+			confidence = invoice.RawConfidence
+		}
+		sample := Sample{Provider: provider, Confidence: confidence, Corrected: make(map[string]bool)}
+		for _, field := range record.CorrectedFields {
+			sample.Corrected[field] = true
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Model is a set of fitted curves by provider and field. Providers with too
+// few samples of their own use the Pooled curves.
+type Model struct {
+	Method    string                       `json:"method"`
+	FittedAt  time.Time                    `json:"fittedAt"`
+	Samples   int                          `json:"samples"`
+	Providers map[string]map[string]*Curve `json:"providers"` // By provider, then by field or Overall
+}
+
+// Fit fits the curves of samples. Providers with fewer than minSamples
+// samples get no curves of their own; the pooled curves need minSamples too.
+func Fit(samples []Sample, method string, minSamples int) *Model {
+	model := &Model{
+		Method:    method,
+		FittedAt:  time.Now().UTC(),
+		Samples:   len(samples),
+		Providers: make(map[string]map[string]*Curve),
+	}
+
+	byProvider := map[string][]Sample{Pooled: samples}
+	for _, sample := range samples {
+		if sample.Provider != "" {
+			byProvider[sample.Provider] = append(byProvider[sample.Provider], sample)
+		}
+	}
+	for provider, group := range byProvider {
+		if len(group) == 0 || len(group) < minSamples {
+			continue
+		}
+		curves := make(map[string]*Curve, len(Fields)+1)
+		for _, field := range append([]string{Overall}, Fields...) {
+			xs := make([]float64, len(group))
+			ys := make([]float64, len(group))
+			for i, sample := range group {
+				xs[i] = sample.Confidence
+				if !sample.corrected(field) {
+					ys[i] = 1
+				}
+			}
+			curves[field] = fitCurve(xs, ys, method)
+		}
+		model.Providers[provider] = curves
+	}
+	return model
+}
+
+// corrected reports whether field was corrected, any field for Overall
+func (s Sample) corrected(field string) bool {
+	if field == Overall {
+		return len(s.Corrected) > 0
+	}
+	return s.Corrected[field]
+}
+
+// Calibrate returns the calibrated confidence of an invoice extracted by
+// provider with the given raw confidence, and that of each field. ok is false
+// when neither the provider nor the pool has enough samples.
+func (m *Model) Calibrate(provider string, confidence float64) (float64, map[string]float64, bool) {
+	curves, ok := m.Providers[provider]
+	if !ok {
+		if curves, ok = m.Providers[Pooled]; !ok {
+			return confidence, nil, false
+		}
+	}
+	fields := make(map[string]float64, len(Fields))
+	for _, field := range Fields {
+		fields[field] = round(curves[field].Apply(confidence))
+	}
+	return round(curves[Overall].Apply(confidence)), fields, true
+}
+
+func round(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
+
+// Calibrator periodically refits a model from the stored invoices
+type Calibrator struct {
+	store      storage.Store
+	method     string
+	minSamples int
+	interval   time.Duration
+	model      atomic.Pointer[Model] // nil until the first fit
+	stop       chan struct{}
+	once       sync.Once
+}
+
+// NewCalibrator creates a calibrator
+func NewCalibrator(store storage.Store, config models.CalibrationConfig) *Calibrator {
+	interval := config.Interval
+	if interval <= 0 {
+		interval = time.Hour // Default refit interval
+	}
+	return &Calibrator{
+		store:      store,
+		method:     config.Method,
+		minSamples: config.MinSamples,
+		interval:   interval,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start runs the refit loop in the background until Stop is called
+func (c *Calibrator) Start() {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := c.Refit(); err != nil {
+				slog.Error("confidence calibration failed", "error", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the refit loop
+func (c *Calibrator) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+// Refit fits a new model from the stored invoices and swaps it in
+func (c *Calibrator) Refit() error {
+	records, err := c.store.List()
+	if err != nil {
+		return err
+	}
+	model := Fit(Samples(records), c.method, c.minSamples)
+	c.model.Store(model)
+
+	providers := make([]string, 0, len(model.Providers))
+	for provider := range model.Providers {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	slog.Info("confidence calibration fitted", "samples", model.Samples, "providers", providers)
+	return nil
+}
+
+// Model returns the latest model, nil before the first fit
+func (c *Calibrator) Model() *Model {
+	return c.model.Load()
+}
@@ -0,0 +1,164 @@
+package calibration
+
+import (
+	"math"
+	"sort"
+)
+
+// Curve maps a raw confidence to the observed share of right answers
+type Curve struct {
+	Samples  int       `json:"samples"`
+	Accuracy float64   `json:"accuracy"`    // Share of the samples that were right
+	X        []float64 `json:"x,omitempty"` // Isotonic: raw confidences, increasing
+	Y        []float64 `json:"y,omitempty"` // Isotonic: calibrated confidence at each X
+	A        float64   `json:"a,omitempty"` // Platt: sigmoid(A*x + B)
+	B        float64   `json:"b,omitempty"`
+}
+
+// Apply returns the calibrated confidence of x
+func (c *Curve) Apply(x float64) float64 {
+	if len(c.X) == 0 {
+		return sigmoid(c.A*x + c.B)
+	}
+	i := sort.SearchFloat64s(c.X, x)
+	switch {
+	case i == 0:
+		return c.Y[0]
+	case i == len(c.X):
+		return c.Y[len(c.Y)-1]
+	}
+	x0, x1 := c.X[i-1], c.X[i]
+	return c.Y[i-1] + (c.Y[i]-c.Y[i-1])*(x-x0)/(x1-x0)
+}
+
+// fitCurve fits the outcomes ys, 1 when right and 0 when wrong, of the raw
+// confidences xs
+func fitCurve(xs, ys []float64, method string) *Curve {
+	curve := &Curve{Samples: len(xs)}
+	right := 0.0
+	for _, y := range ys {
+		right += y
+	}
+	curve.Accuracy = round(right / float64(len(ys)))
+
+	if method == MethodPlatt {
+		curve.A, curve.B = platt(xs, ys)
+	} else {
+		curve.X, curve.Y = isotonic(xs, ys)
+	}
+	return curve
+}
+
+// isotonic fits a non-decreasing step function with the pool adjacent
+// violators algorithm, returning the mean confidence and outcome of each pool
+func isotonic(xs, ys []float64) ([]float64, []float64) {
+	order := make([]int, len(xs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return xs[order[i]] < xs[order[j]] })
+
+	type pool struct{ sumX, sumY, n float64 }
+	var pools []pool
+	for _, i := range order {
+		pools = append(pools, pool{xs[i], ys[i], 1})
+		// Merge while the previous pool is right more often than the last one
+		for len(pools) > 1 {
+			last, prev := pools[len(pools)-1], pools[len(pools)-2]
+			if prev.sumY/prev.n < last.sumY/last.n {
+				break
+			}
+			pools = pools[:len(pools)-1]
+			pools[len(pools)-1] = pool{prev.sumX + last.sumX, prev.sumY + last.sumY, prev.n + last.n}
+		}
+	}
+
+	curveX := make([]float64, 0, len(pools))
+	curveY := make([]float64, 0, len(pools))
+	for _, p := range pools {
+		x := round(p.sumX / p.n)
+		if len(curveX) > 0 && x <= curveX[len(curveX)-1] {
+			// Rounded into the previous point: keep the higher outcome
+			curveY[len(curveY)-1] = round(p.sumY / p.n)
+			continue
+		}
+		curveX = append(curveX, x)
+		curveY = append(curveY, round(p.sumY/p.n))
+	}
+	return curveX, curveY
+}
+
+// platt fits sigmoid(a*x + b) to the outcomes by Newton's method on the
+// cross-entropy, with Platt's smoothed targets so that a handful of samples
+// all right or all wrong do not give a certainty
+func platt(xs, ys []float64) (float64, float64) {
+	var positives, negatives float64
+	for _, y := range ys {
+		if y > 0 {
+			positives++
+		} else {
+			negatives++
+		}
+	}
+	high, low := (positives+1)/(positives+2), 1/(negatives+2)
+	targets := make([]float64, len(ys))
+	for i, y := range ys {
+		targets[i] = low
+		if y > 0 {
+			targets[i] = high
+		}
+	}
+
+	loss := func(a, b float64) float64 {
+		total := 0.0
+		for i, x := range xs {
+			z := a*x + b
+			softplus := math.Max(z, 0) + math.Log1p(math.Exp(-math.Abs(z))) // log(1 + e^z)
+			total += targets[i]*(softplus-z) + (1-targets[i])*softplus
+		}
+		return total
+	}
+
+	a, b := 0.0, math.Log((positives+1)/(negatives+1))
+	current := loss(a, b)
+	for iteration := 0; iteration < 100; iteration++ {
+		var gA, gB, hAA, hAB, hBB float64
+		for i, x := range xs {
+			p := sigmoid(a*x + b)
+			d := p - targets[i]
+			w := p * (1 - p)
+			gA += d * x
+			gB += d
+			hAA += w * x * x
+			hAB += w * x
+			hBB += w
+		}
+		if math.Abs(gA) < 1e-5 && math.Abs(gB) < 1e-5 {
+			break
+		}
+		hAA += 1e-12
+		hBB += 1e-12
+		det := hAA*hBB - hAB*hAB
+		stepA := (hBB*gA - hAB*gB) / det
+		stepB := (hAA*gB - hAB*gA) / det
+
+		// Halve the step until the loss decreases
+		improved := false
+		for scale := 1.0; scale >= 1e-10; scale /= 2 {
+			nextA, nextB := a-scale*stepA, b-scale*stepB
+			if next := loss(nextA, nextB); next < current-1e-4*scale*(gA*stepA+gB*stepB) {
+				a, b, current = nextA, nextB, next
+				improved = true
+				break
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return math.Round(a*1e4) / 1e4, math.Round(b*1e4) / 1e4
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
@@ -0,0 +1,207 @@
+// Package catalog matches extracted line items to the products of a catalog,
+// so supplier invoices can be booked into stock systems by product ID. Receipt
+// item names are abbreviated and misread, so names are compared by the
+// character trigrams they share rather than exactly.
+package catalog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// defaultMinScore is the similarity a match needs when min_score is not set
+const defaultMinScore = 0.7
+
+// accents maps accented letters to their base letter, so "Azúcar" matches "AZUCAR"
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i", "ó", "o", "ò", "o", "ô", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u", "ñ", "n", "ç", "c",
+)
+
+// Product is a catalog entry
+type Product struct {
+	SKU   string
+	Name  string
+	names []map[string]bool // Trigrams of the name and each alias
+}
+
+// Catalog is a loaded product catalog
+type Catalog struct {
+	products []*Product
+	bySKU    map[string]*Product // Lowercase SKU
+	minScore float64
+}
+
+// Load reads the catalog file of config. It returns nil when no file is set.
+func Load(config models.CatalogConfig) (*Catalog, error) {
+	if config.File == "" {
+		return nil, nil
+	}
+	if config.MinScore < 0 || config.MinScore > 1 {
+		return nil, fmt.Errorf("min_score: must be between 0 and 1, got %v", config.MinScore)
+	}
+	file, err := os.Open(config.File)
+	if err != nil {
+		return nil, fmt.Errorf("file: %w", err)
+	}
+	defer file.Close()
+
+	c, err := Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("file: %s: %w", config.File, err)
+	}
+	if config.MinScore > 0 {
+		c.minScore = config.MinScore
+	}
+	return c, nil
+}
+
+// Parse reads a catalog CSV. Its header names the "sku" and "name" columns
+// and, optionally, an "aliases" column of "|"-separated other names.
+func Parse(r io.Reader) (*Catalog, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty catalog")
+		}
+		return nil, err
+	}
+	columns := map[string]int{"sku": -1, "name": -1, "aliases": -1}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if _, ok := columns[column]; ok {
+			columns[column] = i
+		}
+	}
+	if columns["sku"] < 0 || columns["name"] < 0 {
+		return nil, errors.New(`header must name the "sku" and "name" columns`)
+	}
+
+	c := &Catalog{bySKU: make(map[string]*Product), minScore: defaultMinScore}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		cell := func(column string) string {
+			if i := columns[column]; i >= 0 && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		product := &Product{SKU: cell("sku"), Name: cell("name")}
+		if product.SKU == "" || product.Name == "" {
+			return nil, fmt.Errorf("line %d: sku and name are required", line)
+		}
+		if c.bySKU[strings.ToLower(product.SKU)] != nil {
+			return nil, fmt.Errorf("line %d: duplicate sku %q", line, product.SKU)
+		}
+		product.names = append(product.names, trigrams(product.Name))
+		for _, alias := range strings.Split(cell("aliases"), "|") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				product.names = append(product.names, trigrams(alias))
+			}
+		}
+		c.products = append(c.products, product)
+		c.bySKU[strings.ToLower(product.SKU)] = product
+	}
+	return c, nil
+}
+
+// Len returns the number of products
+func (c *Catalog) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.products)
+}
+
+// Match returns the product an item name refers to and how similar their
+// names are, or nil when no product reaches the minimum score. A name
+// containing a SKU as a word matches that product with a score of 1.
+func (c *Catalog) Match(name string) (*Product, float64) {
+	if c == nil {
+		return nil, 0
+	}
+	for _, word := range strings.Fields(name) {
+		if product := c.bySKU[strings.ToLower(strings.Trim(word, ".,;:()[]#"))]; product != nil {
+			return product, 1
+		}
+	}
+
+	item := trigrams(name)
+	var best *Product
+	bestScore := 0.0
+	for _, product := range c.products {
+		for _, names := range product.names {
+			if score := similarity(item, names); score > bestScore {
+				best, bestScore = product, score
+			}
+		}
+	}
+	if bestScore < c.minScore {
+		return nil, 0
+	}
+	return best, bestScore
+}
+
+// Apply sets the product ID and match score of the items that match a
+// product. A nil catalog leaves the items as they are.
+func (c *Catalog) Apply(items []models.InvoiceItem) {
+	if c == nil {
+		return
+	}
+	for i := range items {
+		if product, score := c.Match(items[i].Name); product != nil {
+			items[i].ProductID = product.SKU
+			items[i].MatchScore = float64(int(score*100+0.5)) / 100
+		}
+	}
+}
+
+// trigrams returns the character trigrams of the words of a name, lowercase
+// and without accents. Words are padded with spaces so that short words and
+// word starts count.
+func trigrams(name string) map[string]bool {
+	words := strings.FieldsFunc(accents.Replace(strings.ToLower(name)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	set := make(map[string]bool)
+	for _, word := range words {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// similarity is the Dice coefficient of two trigram sets: twice the shared
+// trigrams over the sum of their sizes
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for trigram := range a {
+		if b[trigram] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
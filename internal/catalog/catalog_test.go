@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+const testCatalog = `SKU,Name,Aliases
+LCH-001,Leche entera Puleva 1L,LECHE ENT PULEVA
+AZU-010,Azúcar blanco 1kg,
+TOR-M8,Tornillo métrico M8 x 40,TORN M8X40|Tornillo M8
+ACE-500,Aceite de oliva virgen extra 500ml,
+`
+
+func TestMatch(t *testing.T) {
+	c, err := Parse(strings.NewReader(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"LECHE ENT PULEVA", "LCH-001"},
+		{"Leche Entera Puleva 1 L", "LCH-001"},
+		{"AZUCAR BLANCO 1KG", "AZU-010"},
+		{"TORN M8X40", "TOR-M8"},
+		{"Ref. tor-m8 caja 100", "TOR-M8"},
+		{"ACEITE OLIVA V.EXTRA 500ML", "ACE-500"},
+		{"PAN DE MOLDE", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product, score := c.Match(tt.name)
+			got := ""
+			if product != nil {
+				got = product.SKU
+			}
+			if got != tt.want {
+				t.Errorf("Match = %q (%.2f), want %q", got, score, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	c, err := Parse(strings.NewReader(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []models.InvoiceItem{{Name: "TORN M8X40"}, {Name: "PORTES"}}
+	c.Apply(items)
+	if items[0].ProductID != "TOR-M8" || items[0].MatchScore != 1 {
+		t.Errorf("items[0] = %+v", items[0])
+	}
+	if items[1].ProductID != "" || items[1].MatchScore != 0 {
+		t.Errorf("items[1] = %+v", items[1])
+	}
+
+	var none *Catalog
+	none.Apply(items)
+	if product, _ := none.Match("TORN M8X40"); product != nil {
+		t.Error("nil catalog matched")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"code,description\nA,B\n",
+		"sku,name\nA,\n",
+		"sku,name\nA,Apple\na,Apricot\n",
+	} {
+		if _, err := Parse(strings.NewReader(data)); err == nil {
+			t.Errorf("Parse(%q): expected an error", data)
+		}
+	}
+
+	c, err := Parse(strings.NewReader("\ufeffname;sku\n"))
+	if err == nil {
+		t.Errorf("semicolons: Parse = %d products, expected an error", c.Len())
+	}
+	c, err = Parse(strings.NewReader("\ufeffName,SKU\nApple,A\n"))
+	if err != nil || c.Len() != 1 {
+		t.Errorf("BOM and column order: %v, %d products", err, c.Len())
+	}
+}
@@ -0,0 +1,224 @@
+// Package classify tells invoices, receipts and other documents apart from
+// their OCR text with keyword heuristics, so documents that are not financial,
+// such as identity cards or random photos, can be refused before the AI stage
+// and receipts can get a prompt of their own
+package classify
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Document types
+const (
+	Invoice = "invoice"
+	Receipt = "receipt"
+	Other   = "other" // Neither, e.g. an identity card or a photo without text
+)
+
+// Document subtypes of invoices that are not the original to book
+const (
+	SubtypeProforma  = "proforma"  // A quote in the form of an invoice, not payable
+	SubtypeDuplicate = "duplicate" // A reissue of an invoice, e.g. marked "DUPLICADO"
+	SubtypeCopy      = "copy"      // A copy of an invoice, e.g. stamped "COPY"
+)
+
+// ErrNotAnInvoice is wrapped by the errors of documents classified as Other
+var ErrNotAnInvoice = errors.New("not an invoice")
+
+var (
+	// moneyWords are words only financial documents carry in number
+	moneyWords = []string{
+		"total", "subtotal", "amount", "tax", "vat", "iva", "igic", "base imponible",
+		"importe", "precio", "price", "cuota", "mwst", "ust", "summe", "betrag", "tva", "montant",
+		"eur", "usd", "gbp",
+	}
+
+	// invoiceWords mark a full invoice: numbered, addressed and with payment terms
+	invoiceWords = []string{
+		"invoice", "invoice number", "invoice no", "bill to", "due date", "payment terms",
+		"vat number", "vat no", "tax id", "factura", "nº factura", "num factura", "vencimiento",
+		"forma de pago", "nif", "cif", "rechnung", "rechnungsnummer", "facture", "fattura",
+	}
+
+	// receiptWords mark a till receipt
+	receiptWords = []string{
+		"receipt", "ticket", "recibo", "cash", "change", "card", "efectivo", "cambio", "tarjeta",
+		"entregado", "thank you", "gracias", "terminal", "tpv", "kassenbon", "quittung", "reçu",
+	}
+
+	// simplifiedInvoices are receipts under their legal name
+	simplifiedInvoices = []string{"factura simplificada", "simplified invoice", "vereinfachte rechnung"}
+
+	// identityWords mark identity documents
+	identityWords = []string{
+		"passport", "pasaporte", "identity card", "documento nacional de identidad",
+		"date of birth", "fecha de nacimiento", "place of birth", "lugar de nacimiento",
+		"nationality", "nacionalidad", "driving licence", "driver license", "permiso de conducción",
+		"personalausweis", "reisepass", "carte d identité",
+	}
+
+	// proformaWords and duplicateWords mark a subtype anywhere in the text
+	proformaWords  = []string{"proforma", "pro forma", "proformarechnung"}
+	duplicateWords = []string{"duplicado", "duplicada", "duplicate", "duplicata", "duplikat"}
+
+	// copyWords mark a copy only on a line of their own, like a stamp or
+	// watermark: card slips print "copia cliente" on every receipt
+	copyWords = []string{"copy", "copia", "copie", "kopie", "invoice copy", "copia factura"}
+
+	// amount matches an amount with two decimals
+	amount = regexp.MustCompile(`\d[.,]\d{2}\b`)
+
+	// mrz matches a machine-readable zone line of a passport or identity card
+	mrz = regexp.MustCompile(`(?m)^[A-Z0-9<]{25,44}$`)
+)
+
+// normalize lowercases text and separates its words by single spaces, with a
+// space at either end, so phrases match whole words as " vat number "
+func normalize(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return " " + strings.Join(fields, " ") + " "
+}
+
+// count returns how many of words a normalized text contains
+func count(text string, words []string) int {
+	n := 0
+	for _, word := range words {
+		if strings.Contains(text, " "+word+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+// Result is the classification of a document
+type Result struct {
+	Type   string // Invoice, Receipt or Other
+	Reason string // Why a document is Other
+}
+
+// Classifier classifies documents and picks their prompt
+type Classifier struct {
+	reject  bool
+	prompts map[string]string
+}
+
+// Compile checks config and returns its classifier. It returns nil when
+// classification is disabled.
+func Compile(config models.ClassifierConfig) (*Classifier, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	for docType, prompt := range config.Prompts {
+		if docType != Invoice && docType != Receipt {
+			return nil, fmt.Errorf("prompts: must be keyed by %s or %s, got %q", Invoice, Receipt, docType)
+		}
+		if strings.TrimSpace(prompt) == "" {
+			return nil, fmt.Errorf("prompts.%s: must not be empty", docType)
+		}
+	}
+	return &Classifier{reject: config.Reject, prompts: config.Prompts}, nil
+}
+
+// Classify classifies the OCR text of a document. A nil classifier returns
+// an empty Result.
+func (c *Classifier) Classify(text string) Result {
+	if c == nil {
+		return Result{}
+	}
+	return Classify(text)
+}
+
+// Check returns an error wrapping ErrNotAnInvoice when result is Other and
+// such documents are rejected
+func (c *Classifier) Check(result Result) error {
+	if c == nil || !c.reject || result.Type != Other {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrNotAnInvoice, result.Reason)
+}
+
+// ClassifyExtraction classifies a document without text, such as one sent
+// to a vision model, by what the AI read from it: one with neither a vendor
+// nor a total is Other. Others are left unclassified, as invoices and
+// receipts cannot be told apart without their text. A nil classifier
+// returns an empty Result.
+func (c *Classifier) ClassifyExtraction(invoice *models.Invoice) Result {
+	if c == nil {
+		return Result{}
+	}
+	if strings.TrimSpace(invoice.Vendor) == "" && !invoice.Total.IsPositive() {
+		return Result{Type: Other, Reason: "no text, vendor or total found"}
+	}
+	return Result{}
+}
+
+// Prompt returns the prompt template of a document type, empty when it has
+// none
+func (c *Classifier) Prompt(docType string) string {
+	if c == nil {
+		return ""
+	}
+	return c.prompts[docType]
+}
+
+// Classify classifies OCR text. Documents with neither money words nor
+// several amounts are Other, as are those with more identity document marks
+// than money words; the rest are invoices when invoice words outnumber
+// receipt words, receipts otherwise.
+func Classify(text string) Result {
+	words := normalize(text)
+
+	money := count(words, moneyWords)
+	if strings.ContainsAny(text, "€$£") {
+		money++
+	}
+	identity := count(words, identityWords)
+	if len(mrz.FindAllString(text, 3)) >= 2 {
+		identity += 3
+	}
+	if identity >= 2 && identity > money {
+		return Result{Type: Other, Reason: "looks like an identity document"}
+	}
+	if money == 0 && len(amount.FindAllString(text, 2)) < 2 {
+		if strings.TrimSpace(text) == "" {
+			return Result{Type: Other, Reason: "no text found"}
+		}
+		return Result{Type: Other, Reason: "no amounts or totals found"}
+	}
+
+	for _, phrase := range simplifiedInvoices {
+		words = strings.ReplaceAll(words, " "+phrase+" ", " receipt ")
+	}
+	if count(words, invoiceWords) > count(words, receiptWords) {
+		return Result{Type: Invoice}
+	}
+	return Result{Type: Receipt}
+}
+
+// Subtype returns the subtype an invoice's OCR text is marked with,
+// SubtypeProforma, SubtypeDuplicate or SubtypeCopy, empty for an original.
+// A proforma mark wins over the others.
+func Subtype(text string) string {
+	words := normalize(text)
+	if count(words, proformaWords) > 0 {
+		return SubtypeProforma
+	}
+	if count(words, duplicateWords) > 0 {
+		return SubtypeDuplicate
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if slices.Contains(copyWords, strings.TrimSpace(normalize(line))) {
+			return SubtypeCopy
+		}
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package classify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			"supermarket receipt",
+			"MERCADONA S.A.\nPAN BARRA 0,85\nLECHE 1,20\nTOTAL 2,05\nTARJETA 2,05\nGRACIAS POR SU VISITA",
+			Receipt,
+		},
+		{
+			"simplified invoice",
+			"Factura simplificada 2024-001\nNIF B12345678\nCafé 1,50\nTotal 1,50 €\nEfectivo 2,00 Cambio 0,50",
+			Receipt,
+		},
+		{
+			"amounts without keywords",
+			"BAR PEPE\n2 x CANA 3.00\n1 x TAPA 4.50",
+			Receipt,
+		},
+		{
+			"invoice",
+			"ACME Consulting SL\nInvoice number: 2024/117\nBill to: Example Ltd\nVAT number: ESB12345678\nConsulting services 1,000.00\nVAT 21% 210.00\nTotal 1,210.00\nDue date: 2024-04-15\nPayment terms: 30 days",
+			Invoice,
+		},
+		{
+			"spanish invoice",
+			"FACTURA Nº 117\nCIF: B12345678\nBase imponible 100,00\nIVA 21% 21,00\nTotal factura 121,00\nForma de pago: transferencia\nVencimiento: 15/04/2024",
+			Invoice,
+		},
+		{
+			"identity card",
+			"REINO DE ESPAÑA\nDOCUMENTO NACIONAL DE IDENTIDAD\nAPELLIDOS ESPAÑOLA ESPAÑOLA\nNOMBRE CARMEN\nNACIONALIDAD ESP\nFECHA DE NACIMIENTO 01 01 1980",
+			Other,
+		},
+		{
+			"passport MRZ",
+			"PASSPORT\nP<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408122F1204159ZE184226B<<<<<10",
+			Other,
+		},
+		{
+			"photo with a sign",
+			"OPEN\nWelcome to Barcelona",
+			Other,
+		},
+		{"no text", "  \n", Other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Classify(tt.text)
+			if result.Type != tt.want {
+				t.Errorf("Type = %s, want %s", result.Type, tt.want)
+			}
+			if (result.Reason != "") != (tt.want == Other) {
+				t.Errorf("Reason = %q", result.Reason)
+			}
+		})
+	}
+}
+
+func TestSubtype(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"proforma", "FACTURA PROFORMA Nº 24/031\nBase imponible 100,00\nTotal 121,00", SubtypeProforma},
+		{"pro-forma", "ACME Ltd\nPro-forma invoice\nTotal 1,210.00", SubtypeProforma},
+		{"duplicate", "FACTURA 2024/117\nDUPLICADO\nTotal 121,00", SubtypeDuplicate},
+		{"copy stamp", "FACTURA 2024/117\n*** COPIA ***\nTotal 121,00", SubtypeCopy},
+		{"proforma copy", "COPY\nProforma invoice 88\nTotal 50.00", SubtypeProforma},
+		{"card slip", "MERCADONA\nTOTAL 12,40\nCOPIA CLIENTE\nTARJETA 12,40", ""},
+		{"copy paper", "OFFICE DEPOT\nCopy paper A4 5,99\nTotal 5,99", ""},
+		{"original", "FACTURA 2024/117\nTotal 121,00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Subtype(tt.text); got != tt.want {
+				t.Errorf("Subtype = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	other := Result{Type: Other, Reason: "no text found"}
+
+	rejecting, err := Compile(models.ClassifierConfig{Enabled: true, Reject: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rejecting.Check(other); !errors.Is(err, ErrNotAnInvoice) {
+		t.Errorf("err = %v, want ErrNotAnInvoice", err)
+	}
+	if err := rejecting.Check(Result{Type: Receipt}); err != nil {
+		t.Errorf("receipt: %v", err)
+	}
+
+	labelling, err := Compile(models.ClassifierConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := labelling.Check(other); err != nil {
+		t.Errorf("without reject: %v", err)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	c, err := Compile(models.ClassifierConfig{Reject: true})
+	if err != nil || c != nil {
+		t.Fatalf("disabled: Compile = %v, %v, want nil, nil", c, err)
+	}
+	if result := c.Classify("passport nationality"); result.Type != "" {
+		t.Errorf("nil Classifier classified as %s", result.Type)
+	}
+
+	c, err = Compile(models.ClassifierConfig{Enabled: true, Prompts: map[string]string{Receipt: "Read this receipt: @ocrText"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Prompt(Receipt) == "" || c.Prompt(Invoice) != "" {
+		t.Errorf("prompts = %q, %q", c.Prompt(Receipt), c.Prompt(Invoice))
+	}
+
+	for _, prompts := range []map[string]string{{"fuel": "x"}, {Invoice: " "}} {
+		if _, err := Compile(models.ClassifierConfig{Enabled: true, Prompts: prompts}); err == nil {
+			t.Errorf("prompts %v: expected an error", prompts)
+		}
+	}
+}
+
+func TestClassifyExtraction(t *testing.T) {
+	classifier, err := Compile(models.ClassifierConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		invoice models.Invoice
+		want    string
+	}{
+		{"vendor and total", models.Invoice{Vendor: "Mercadona", Total: decimal.RequireFromString("2.05")}, ""},
+		{"total only", models.Invoice{Total: decimal.RequireFromString("2.05")}, ""},
+		{"vendor only", models.Invoice{Vendor: "Mercadona"}, ""},
+		{"nothing read", models.Invoice{Vendor: " "}, Other},
+		{"zero total", models.Invoice{Total: decimal.Zero}, Other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifier.ClassifyExtraction(&tt.invoice); got.Type != tt.want {
+				t.Errorf("Type = %q, want %q", got.Type, tt.want)
+			}
+		})
+	}
+
+	var disabled *Classifier
+	if got := disabled.ClassifyExtraction(&models.Invoice{}); got != (Result{}) {
+		t.Errorf("nil classifier = %+v, want empty", got)
+	}
+}
@@ -0,0 +1,189 @@
+package classify
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// ErrUnknownProfile is returned for a requested profile that does not exist
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// builtinProfiles are the profiles available without configuration, in the
+// order the classifier tries them
+var builtinProfiles = []models.ProfileConfig{
+	{
+		Name: "fuel_receipt",
+		Type: Receipt,
+		Keywords: []string{
+			"gasolina", "gasóleo", "gasoleo", "diesel", "sin plomo", "unleaded", "petrol", "litros",
+			"litres", "liters", "surtidor", "pump", "adblue", "carburant", "kraftstoff",
+		},
+		Fields: []models.ProfileField{
+			{Name: "pump", Description: "Pump number"},
+		},
+		Kind: models.KindFuel,
+	},
+	{
+		Name: "hotel_folio",
+		Keywords: []string{
+			"check in", "check out", "checkin", "checkout", "fecha de entrada", "fecha de salida",
+			"llegada", "arrival", "departure", "noches", "nights", "pernoctaciones", "habitación",
+			"habitacion", "tasa turística", "tasa turistica", "city tax", "tourist tax", "taxe de séjour", "kurtaxe",
+		},
+		Kind: models.KindHotel,
+	},
+	{
+		Name: "restaurant_receipt",
+		Type: Receipt,
+		Keywords: []string{
+			"restaurante", "restaurant", "mesa", "table", "comensales", "covers", "camarero",
+			"waiter", "server", "propina", "tip", "gratuity", "menu del dia", "menú del día", "cafetería",
+		},
+		Fields: []models.ProfileField{
+			{Name: "covers", Type: models.FieldTypeInteger, Description: "Number of diners"},
+			{Name: "table", Description: "Table number"},
+			{Name: "service_charge", Type: models.FieldTypeNumber, Description: "Service charge added to the bill, not a tip"},
+		},
+	},
+	{
+		Name: "utility_invoice",
+		Type: Invoice,
+		Keywords: []string{
+			"kwh", "consumo", "consumption", "periodo de facturación", "billing period", "lectura",
+			"meter", "contador", "cups", "potencia contratada", "m3", "m³", "electricidad",
+			"electricity", "gas natural", "suministro", "supply point",
+		},
+		Kind: models.KindUtility,
+	},
+	{
+		Name: "professional_services",
+		Type: Invoice,
+		Keywords: []string{
+			"honorarios", "fees", "consulting", "consultoría", "consultoria", "servicios profesionales",
+			"professional services", "hours", "horas", "retención", "retencion", "irpf", "withholding",
+		},
+		Fields: []models.ProfileField{
+			{Name: "hours", Type: models.FieldTypeNumber, Description: "Hours billed"},
+			{Name: "hourly_rate", Type: models.FieldTypeNumber, Description: "Rate per hour"},
+			{Name: "withholding_tax", Type: models.FieldTypeNumber, Description: "Income tax withheld (retención, IRPF), as a positive amount"},
+			{Name: "service_period", Description: "Period the services were rendered in, as printed"},
+		},
+	},
+}
+
+// Profile is the prompt and extra fields of one kind of document
+type Profile struct {
+	Name     string
+	Type     string // Invoice, Receipt or empty for both
+	Prompt   string // Prompt template; empty keeps the prompt otherwise used
+	Fields   []models.ProfileField
+	Kind     string   // Typed details asked for, e.g. models.KindFuel
+	keywords []string // Normalized
+}
+
+// Profiles are the built-in and configured profiles
+type Profiles struct {
+	profiles []*Profile // Configured ones first
+	byName   map[string]*Profile
+}
+
+// CompileProfiles checks configs and returns them with the built-in profiles.
+// A configured profile named like a built-in one replaces it.
+func CompileProfiles(configs []models.ProfileConfig) (*Profiles, error) {
+	p := &Profiles{byName: make(map[string]*Profile)}
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("[%d].name: required", i)
+		}
+		if p.byName[config.Name] != nil {
+			return nil, fmt.Errorf("[%d].name: duplicate profile %q", i, config.Name)
+		}
+		profile, err := compileProfile(config)
+		if err != nil {
+			return nil, fmt.Errorf("[%d].%w", i, err)
+		}
+		p.add(profile)
+	}
+	for _, config := range builtinProfiles {
+		if p.byName[config.Name] == nil {
+			profile, _ := compileProfile(config)
+			p.add(profile)
+		}
+	}
+	return p, nil
+}
+
+func (p *Profiles) add(profile *Profile) {
+	p.profiles = append(p.profiles, profile)
+	p.byName[profile.Name] = profile
+}
+
+func compileProfile(config models.ProfileConfig) (*Profile, error) {
+	if config.Type != "" && config.Type != Invoice && config.Type != Receipt {
+		return nil, fmt.Errorf("type: must be %s or %s, got %q", Invoice, Receipt, config.Type)
+	}
+	if config.Kind != "" && !slices.Contains(models.Kinds, config.Kind) {
+		return nil, fmt.Errorf("kind: must be one of %s, got %q", strings.Join(models.Kinds, ", "), config.Kind)
+	}
+	profile := &Profile{Name: config.Name, Type: config.Type, Prompt: config.Prompt, Kind: config.Kind}
+	seen := make(map[string]bool)
+	for i, field := range config.Fields {
+		if field.Name == "" {
+			return nil, fmt.Errorf("fields[%d].name: required", i)
+		}
+		if seen[field.Name] {
+			return nil, fmt.Errorf("fields[%d].name: duplicate field %q", i, field.Name)
+		}
+		seen[field.Name] = true
+		switch field.Type {
+		case "":
+			field.Type = models.FieldTypeString
+		case models.FieldTypeString, models.FieldTypeNumber, models.FieldTypeInteger, models.FieldTypeBoolean, models.FieldTypeDate:
+		default:
+			return nil, fmt.Errorf("fields[%d].type: must be string, number, integer, boolean or date, got %q", i, field.Type)
+		}
+		profile.Fields = append(profile.Fields, field)
+	}
+	for _, keyword := range config.Keywords {
+		if normalized := strings.TrimSpace(normalize(keyword)); normalized != "" {
+			profile.keywords = append(profile.keywords, normalized)
+		}
+	}
+	return profile, nil
+}
+
+// Get returns the profile named name, or an error wrapping ErrUnknownProfile.
+// An empty name returns nil.
+func (p *Profiles) Get(name string) (*Profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if p != nil {
+		if profile := p.byName[name]; profile != nil {
+			return profile, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+}
+
+// Select returns the first profile of a document type whose keywords the OCR
+// text contains, nil when none does. A nil Profiles selects nothing.
+func (p *Profiles) Select(text, docType string) *Profile {
+	if p == nil || (docType != Invoice && docType != Receipt) {
+		return nil
+	}
+	words := normalize(text)
+	for _, profile := range p.profiles {
+		if profile.Type != "" && profile.Type != docType {
+			continue
+		}
+		if count(words, profile.keywords) > 0 {
+			return profile
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package classify
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func TestSelect(t *testing.T) {
+	p, err := CompileProfiles([]models.ProfileConfig{
+		{Name: "parking", Type: Receipt, Keywords: []string{"Parking", "aparcamiento"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		docType string
+		want    string
+	}{
+		{"fuel", "REPSOL\nGASOLEO A 45,20 L\nSURTIDOR 3\nTOTAL 70,00", Receipt, "fuel_receipt"},
+		{"hotel", "HOTEL COLON\nFactura\nLlegada 10/06/2024 Salida 13/06/2024\n3 Noches Habitación doble\nTasa turística 6,60", Invoice, "hotel_folio"},
+		{"hotel restaurant charges", "HOTEL COLON\nCheck-in 10/06\nRestaurante mesa 4 32,00", Receipt, "hotel_folio"},
+		{"restaurant", "CASA PACO\nMESA 4 COMENSALES 2\nMENU DEL DIA 2 x 12,50\nTOTAL 25,00", Receipt, "restaurant_receipt"},
+		{"utility", "Iberdrola\nFactura\nPeriodo de facturación 01/03/2024 - 31/03/2024\nConsumo 230 kWh", Invoice, "utility_invoice"},
+		{"professional services", "Honorarios profesionales\nRetención IRPF 15%", Invoice, "professional_services"},
+		{"configured first", "PARKING CENTRO\nLitros 0\nTOTAL 3,50", Receipt, "parking"},
+		{"type must match", "Gasóleo A 45,20 L", Invoice, ""},
+		{"no keyword", "MERCADONA\nPAN 0,85\nTOTAL 0,85", Receipt, ""},
+		{"other", "Gasóleo", Other, ""},
+		{"not classified", "Gasóleo", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if profile := p.Select(tt.text, tt.docType); profile != nil {
+				got = profile.Name
+			}
+			if got != tt.want {
+				t.Errorf("Select = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var none *Profiles
+	if profile := none.Select("Gasóleo", Receipt); profile != nil {
+		t.Errorf("nil Profiles selected %s", profile.Name)
+	}
+}
+
+func TestGet(t *testing.T) {
+	p, err := CompileProfiles([]models.ProfileConfig{
+		{Name: "fuel_receipt", Prompt: "Read this fuel receipt: @fields @ocrText", Fields: []models.ProfileField{{Name: "liters"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := p.Get("fuel_receipt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Prompt == "" || len(profile.Fields) != 1 || profile.Fields[0].Type != models.FieldTypeString {
+		t.Errorf("configured profile did not replace the built-in one: %+v", profile)
+	}
+	if profile, _ := p.Get("fuel_receipt"); profile.Kind != "" {
+		t.Errorf("configured profile kept the built-in kind %q", profile.Kind)
+	}
+	if profile, err := p.Get("utility_invoice"); err != nil || profile == nil {
+		t.Errorf("built-in profile: %v, %v", profile, err)
+	}
+	if profile, err := p.Get(""); err != nil || profile != nil {
+		t.Errorf("empty name: %v, %v, want nil, nil", profile, err)
+	}
+	if _, err := p.Get("boat_receipt"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("err = %v, want ErrUnknownProfile", err)
+	}
+}
+
+func TestCompileProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []models.ProfileConfig
+		want    string
+	}{
+		{"no name", []models.ProfileConfig{{}}, "[0].name: required"},
+		{"duplicate", []models.ProfileConfig{{Name: "a"}, {Name: "a"}}, `[1].name: duplicate profile "a"`},
+		{"bad type", []models.ProfileConfig{{Name: "a", Type: "other"}}, `[0].type: must be invoice or receipt, got "other"`},
+		{
+			"bad field type",
+			[]models.ProfileConfig{{Name: "a", Fields: []models.ProfileField{{Name: "x", Type: "money"}}}},
+			`[0].fields[0].type: must be string, number, integer, boolean or date, got "money"`,
+		},
+		{
+			"duplicate field",
+			[]models.ProfileConfig{{Name: "a", Fields: []models.ProfileField{{Name: "x"}, {Name: "x"}}}},
+			`[0].fields[1].name: duplicate field "x"`,
+		},
+		{"bad kind", []models.ProfileConfig{{Name: "a", Kind: "boat"}}, `[0].kind: must be one of fuel, utility, hotel, got "boat"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileProfiles(tt.configs)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("err = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+const defaultMinSize = 1024
+
+// Middleware compresses JSON responses with gzip or deflate when the client
+// accepts it and the body reaches a minimum size
+type Middleware struct {
+	minSize int
+	level   int
+}
+
+// New creates the compression middleware from config
+func New(config models.CompressionConfig) *Middleware {
+	m := &Middleware{
+		minSize: config.MinSize,
+		level:   config.Level,
+	}
+	if m.minSize <= 0 {
+		m.minSize = defaultMinSize
+	}
+	if m.level == 0 {
+		m.level = gzip.DefaultCompression
+	}
+	return m
+}
+
+// Handler wraps next with response compression
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &responseWriter{ResponseWriter: w, encoding: encoding, minSize: m.minSize, level: m.level, status: http.StatusOK}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiate picks gzip or deflate from an Accept-Encoding header, preferring gzip
+func negotiate(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q > 0
+	}
+
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// responseWriter buffers the start of the body until it knows whether the
+// response is worth compressing
+type responseWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+	level    int
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser // nil when the response is sent uncompressed
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start sends the headers, choosing compression from the buffered body, and
+// writes the buffered bytes
+func (w *responseWriter) start() error {
+	w.decided = true
+
+	header := w.Header()
+	if compressible(header, w.status) {
+		header.Add("Vary", "Accept-Encoding")
+		if len(w.buf) >= w.minSize {
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			w.encoder = w.newEncoder()
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *responseWriter) newEncoder() io.WriteCloser {
+	if w.encoding == "deflate" {
+		encoder, err := flate.NewWriter(w.ResponseWriter, w.level)
+		if err != nil {
+			encoder, _ = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+		}
+		return encoder
+	}
+	encoder, err := gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	if err != nil {
+		encoder = gzip.NewWriter(w.ResponseWriter)
+	}
+	return encoder
+}
+
+// Flush sends what has been written so far, e.g. for streaming responses
+func (w *responseWriter) Flush() {
+	if !w.decided {
+		w.start()
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends a body smaller than the threshold as is, or finishes the compressed stream
+func (w *responseWriter) Close() error {
+	if !w.decided {
+		return w.start()
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+// compressible reports whether a response may be compressed: JSON that is not
+// already encoded and has a body
+func compressible(header http.Header, status int) bool {
+	if header.Get("Content-Encoding") != "" || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes environment variables that override config values
+const EnvPrefix = "INVOICE_OCR_"
+
+// secretsTimeout bounds fetching all secret references of a config
+const secretsTimeout = 30 * time.Second
+
+// Load reads the YAML config at path, expands ${VAR} references, overlays
+// INVOICE_OCR_* environment variables, resolves secret files and store
+// references, applies defaults and validates the result
+func Load(path string) (*models.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Parse builds a validated config from YAML data and the environment
+func Parse(data []byte) (*models.Config, error) {
+	var config models.Config
+	err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	err = applyEnv(&config, EnvPrefix, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyLegacyEnv(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	err = resolveSecrets(ctx, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadRules(&config.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	applyDefaults(&config)
+
+	err = Validate(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// applyLegacyEnv applies the unprefixed variables set by hosting platforms
+func applyLegacyEnv(config *models.Config) error {
+	if port := os.Getenv("PORT"); port != "" {
+		value, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("invalid PORT: %w", err)
+		}
+		config.Port = value
+	}
+	if host := os.Getenv("HOST"); host != "" {
+		config.Host = host
+	}
+	if os.Getenv("ENABLE_DEBUG_MODE") == "true" {
+		config.Logging.Level = "debug"
+	}
+	return nil
+}
+
+// loadRules appends the vendor rules of rules.File to the inline ones
+func loadRules(rules *models.RulesConfig) error {
+	if rules.File == "" {
+		return nil
+	}
+	data, err := os.ReadFile(rules.File)
+	if err != nil {
+		return fmt.Errorf("rules.file: %w", err)
+	}
+	var file struct {
+		Vendors []models.VendorRule `yaml:"vendors"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("rules.file: failed to parse %s: %w", rules.File, err)
+	}
+	rules.Vendors = append(rules.Vendors, file.Vendors...)
+	return nil
+}
+
+// applyDefaults fills in values left empty in the config
+func applyDefaults(config *models.Config) {
+	if config.Port == 0 {
+		config.Port = 8080
+	}
+	if config.GRPC.Enabled && config.GRPC.Port == 0 {
+		config.GRPC.Port = 9090
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = 30 * time.Second
+	}
+	if config.OCR.Engine == "" {
+		config.OCR.Engine = "tesseract"
+	}
+	if config.OCR.Language == "" {
+		config.OCR.Language = "eng"
+	}
+	if config.OCR.PageParallelism == 0 {
+		config.OCR.PageParallelism = 4
+	}
+	if config.AI.DefaultProvider == "" {
+		config.AI.DefaultProvider = "openai"
+	}
+	if config.Auth.Enabled && config.Auth.Mode == "" {
+		config.Auth.Mode = "api_key"
+	}
+	if config.Jobs.Enabled && config.Jobs.Backend == "" {
+		config.Jobs.Backend = "memory"
+	}
+	if config.Storage.Enabled && config.Storage.PurgeInterval <= 0 {
+		config.Storage.PurgeInterval = time.Hour
+	}
+	if config.Export.Currency == "" {
+		config.Export.Currency = "EUR"
+	}
+	if len(config.Usage.Budget.Thresholds) == 0 {
+		config.Usage.Budget.Thresholds = []float64{0.8, 1}
+	}
+	if config.Webhooks.ReviewThreshold <= 0 {
+		config.Webhooks.ReviewThreshold = 0.7
+	}
+	if config.Export.Facturae.SignTimeout <= 0 {
+		config.Export.Facturae.SignTimeout = 30 * time.Second
+	}
+	if config.VIES.URL == "" {
+		config.VIES.URL = "https://ec.europa.eu/taxation_customs/vies/rest-api"
+	}
+	if config.VIES.Timeout <= 0 {
+		config.VIES.Timeout = 10 * time.Second
+	}
+	if config.VIES.CacheTTL <= 0 {
+		config.VIES.CacheTTL = 24 * time.Hour
+	}
+	if config.Registry.APIKeyHeader == "" {
+		config.Registry.APIKeyHeader = "X-API-Key"
+	}
+	if config.Registry.Fields.LegalName == "" {
+		config.Registry.Fields.LegalName = "name"
+	}
+	if config.Registry.Fields.Address == "" {
+		config.Registry.Fields.Address = "address"
+	}
+	if config.Registry.Timeout <= 0 {
+		config.Registry.Timeout = 10 * time.Second
+	}
+	if config.Registry.CacheTTL <= 0 {
+		config.Registry.CacheTTL = 24 * time.Hour
+	}
+	if config.Uploads.MaxSizeMB <= 0 {
+		config.Uploads.MaxSizeMB = 10
+	}
+	if len(config.Uploads.AllowedTypes) == 0 {
+		config.Uploads.AllowedTypes = []string{
+			"image/jpeg", "image/png", "image/webp", "image/gif", "image/bmp",
+			"image/tiff", "image/heic", "application/pdf",
+		}
+	}
+	if config.Uploads.SpoolThresholdKB <= 0 {
+		config.Uploads.SpoolThresholdKB = 1024
+	}
+	if config.Calibration.Method == "" {
+		config.Calibration.Method = "isotonic"
+	}
+	if config.Calibration.MinSamples <= 0 {
+		config.Calibration.MinSamples = 50
+	}
+	if config.Calibration.Interval <= 0 {
+		config.Calibration.Interval = time.Hour
+	}
+	if config.CategoryLearning.MinCorrections <= 0 {
+		config.CategoryLearning.MinCorrections = 1
+	}
+	if config.AI.Shadow.MaxConcurrent <= 0 {
+		config.AI.Shadow.MaxConcurrent = 4
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/secrets"
+)
+
+// fileSuffix marks options holding the path of a file with the secret, e.g. api_key_file
+const fileSuffix = "_file"
+
+// resolveSecrets replaces every "<name>_file" option by the content of the file
+// in its "<name>" sibling, then every "vault:" or "aws-sm:" value by the secret
+// it references
+func resolveSecrets(ctx context.Context, config *models.Config) error {
+	r := &secretWalker{ctx: ctx, resolver: secrets.NewResolver(config.Secrets)}
+	return r.walk(reflect.ValueOf(config).Elem(), "")
+}
+
+type secretWalker struct {
+	ctx      context.Context
+	resolver *secrets.Resolver
+}
+
+func (s *secretWalker) walk(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return s.walk(v.Elem(), path)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			err := s.walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		return s.walkStruct(v, path)
+	case reflect.String:
+		if !secrets.IsReference(v.String()) {
+			return nil
+		}
+		value, err := s.resolver.Resolve(s.ctx, v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		v.SetString(value)
+	}
+	return nil
+}
+
+func (s *secretWalker) walkStruct(v reflect.Value, path string) error {
+	t := v.Type()
+	fields := make(map[string]reflect.Value, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if tag != "" && tag != "-" {
+			fields[tag] = v.Field(i)
+		}
+	}
+
+	for tag, fv := range fields {
+		if !strings.HasSuffix(tag, fileSuffix) || fv.Kind() != reflect.String || fv.String() == "" {
+			continue
+		}
+		name := strings.TrimSuffix(tag, fileSuffix)
+		target, ok := fields[name]
+		if !ok || target.Kind() != reflect.String {
+			continue
+		}
+		if target.String() != "" {
+			return fmt.Errorf("%s: set either %s or %s, not both", join(path, name), name, tag)
+		}
+
+		value, err := secrets.ReadFile(fv.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", join(path, tag), err)
+		}
+		target.SetString(value)
+	}
+
+	for tag, fv := range fields {
+		err := s.walk(fv, join(path, tag))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// join appends a YAML key to a dotted config path
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
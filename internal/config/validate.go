@@ -0,0 +1,403 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/catalog"
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/correct"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/offline"
+	"github.com/facturaIA/invoice-ocr-service/internal/residency"
+	"github.com/facturaIA/invoice-ocr-service/internal/rules"
+	"github.com/facturaIA/invoice-ocr-service/internal/scripts"
+	"github.com/facturaIA/invoice-ocr-service/internal/storage"
+	"github.com/facturaIA/invoice-ocr-service/internal/webhook"
+)
+
+// validator collects every problem so they can be reported at once
+type validator struct {
+	errs []error
+}
+
+func (v *validator) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf(format, args...))
+	}
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks required fields and enum values of a config with defaults applied
+func Validate(config *models.Config) error {
+	v := &validator{}
+
+	v.check(config.Port > 0 && config.Port < 65536, "port: must be between 1 and 65535, got %d", config.Port)
+	if config.API.LegacySunset != "" {
+		_, err := time.Parse(time.DateOnly, config.API.LegacySunset)
+		v.check(err == nil, "api.legacy_sunset: must be a date like 2025-12-31, got %q", config.API.LegacySunset)
+	}
+	if config.GRPC.Enabled {
+		v.check(config.GRPC.Port > 0 && config.GRPC.Port < 65536, "grpc.port: must be between 1 and 65535, got %d", config.GRPC.Port)
+		v.check(config.GRPC.Port != config.Port, "grpc.port: must differ from port %d", config.Port)
+		v.check(config.GRPC.BatchConcurrency >= 0, "grpc.batch_concurrency: must not be negative")
+	}
+	if config.TLS.Enabled {
+		validateTLS(v, config.TLS)
+	}
+	v.check(config.Compression.Level >= -1 && config.Compression.Level <= 9,
+		"compression.level: must be between 1 and 9, got %d", config.Compression.Level)
+	if config.CORS.Enabled {
+		v.check(len(config.CORS.AllowedOrigins) > 0, "cors.allowed_origins: required when CORS is enabled")
+		v.check(!config.CORS.AllowCredentials || !slices.Contains(config.CORS.AllowedOrigins, "*"),
+			"cors.allow_credentials: cannot be combined with the \"*\" origin; list the allowed origins")
+		v.check(config.CORS.MaxAge >= 0, "cors.max_age: must not be negative")
+	}
+	v.check(oneOf(strings.ToLower(config.Logging.Level), "", "debug", "info", "warn", "warning", "error"),
+		"logging.level: must be debug, info, warn or error, got %q", config.Logging.Level)
+	v.check(oneOf(strings.ToLower(config.Logging.Format), "", "text", "json"),
+		"logging.format: must be text or json, got %q", config.Logging.Format)
+	v.check(config.Tracing.SampleRatio >= 0 && config.Tracing.SampleRatio <= 1,
+		"tracing.sample_ratio: must be between 0 and 1, got %v", config.Tracing.SampleRatio)
+
+	v.check(oneOf(config.OCR.Engine, "tesseract", "easyocr"),
+		"ocr.engine: must be tesseract or easyocr, got %q", config.OCR.Engine)
+	v.check(config.OCR.PageParallelism >= 0, "ocr.page_parallelism: must not be negative")
+	v.check(config.OCR.Retry.Below >= 0 && config.OCR.Retry.Below <= 1, "ocr.retry.below: must be between 0 and 1")
+	for _, strategy := range config.OCR.Retry.Strategies {
+		v.check(oneOf(strategy, "single_block", "single_column", "inverted", "unprocessed"),
+			"ocr.retry.strategies: must be single_block, single_column, inverted or unprocessed, got %q", strategy)
+	}
+	v.check(config.OCR.Handwriting.Below >= 0 && config.OCR.Handwriting.Below <= 1, "ocr.handwriting.below: must be between 0 and 1")
+	v.check(oneOf(config.OCR.Handwriting.Provider, "", "openai", "gemini", "ollama", "external"),
+		"ocr.handwriting.provider: must be openai, gemini, ollama or external, got %q", config.OCR.Handwriting.Provider)
+
+	validateAI(v, "ai", config.AI, true)
+
+	if config.Auth.Enabled {
+		validateAuth(v, config.Auth)
+	}
+
+	v.check(config.RateLimit.PerKey.RequestsPerMinute >= 0 && config.RateLimit.PerIP.RequestsPerMinute >= 0,
+		"rate_limit: requests_per_minute must not be negative")
+	v.check(config.RateLimit.ProxyHops >= 0, "rate_limit.proxy_hops: must not be negative")
+	v.check(config.Concurrency.MaxInFlight >= 0 && config.Concurrency.MaxQueue >= 0,
+		"concurrency: max_in_flight and max_queue must not be negative")
+	v.check(config.Concurrency.BatchMaxInFlight >= 0 && config.Concurrency.BatchMaxInFlight <= config.Concurrency.MaxInFlight,
+		"concurrency.batch_max_in_flight: must be between 0 and max_in_flight, got %d", config.Concurrency.BatchMaxInFlight)
+	v.check(config.Concurrency.MemoryLimitMB >= 0, "concurrency.memory_limit_mb: must not be negative")
+	for i, contentType := range config.Uploads.AllowedTypes {
+		major, minor, ok := strings.Cut(contentType, "/")
+		v.check(ok && major != "" && minor != "" && contentType == strings.ToLower(contentType),
+			"uploads.allowed_types[%d]: must be a lowercase content type like image/png, got %q", i, contentType)
+	}
+	v.check(config.Timeouts.Default >= 0 && config.Timeouts.AI >= 0 && config.Timeouts.Job >= 0,
+		"timeouts: must not be negative")
+	v.check(config.Reload.WatchInterval >= 0, "reload.watch_interval: must not be negative")
+
+	if config.Storage.Enabled {
+		v.check(config.Storage.Path != "", "storage.path: required when storage is enabled")
+		if config.Storage.EncryptionKey != "" {
+			_, err := storage.ParseKey(config.Storage.EncryptionKey)
+			v.check(err == nil, "storage.encryption_key: %v", err)
+		}
+	}
+
+	for model, price := range config.Usage.Prices {
+		v.check(price.InputPer1K >= 0 && price.OutputPer1K >= 0, "usage.prices.%s: prices must not be negative", model)
+	}
+	budget := config.Usage.Budget
+	v.check(budget.Daily >= 0 && budget.Monthly >= 0, "usage.budget: limits must not be negative")
+	for i, threshold := range budget.Thresholds {
+		v.check(threshold > 0, "usage.budget.thresholds[%d]: must be positive, got %v", i, threshold)
+	}
+	v.check(oneOf(budget.Fallback.Provider, "", "openai", "gemini", "ollama", "external"),
+		"usage.budget.fallback.provider: must be openai, gemini, ollama or external, got %q", budget.Fallback.Provider)
+
+	if config.Jobs.Enabled {
+		v.check(config.Jobs.LeaseDuration == 0 || config.Jobs.LeaseDuration >= 3*time.Second,
+			"jobs.lease_duration: must be at least 3s, got %s", config.Jobs.LeaseDuration)
+		v.check(config.Jobs.FinishedTTL >= 0,
+			"jobs.finished_ttl: must not be negative, got %s", config.Jobs.FinishedTTL)
+		v.check(oneOf(config.Jobs.Backend, "memory", "redis", "nats"),
+			"jobs.backend: must be memory, redis or nats, got %q", config.Jobs.Backend)
+		if config.Jobs.Backend == "redis" {
+			v.check(config.Jobs.Redis.Addr != "", "jobs.redis.addr: required for the redis backend")
+		}
+		if config.Jobs.Backend == "nats" {
+			v.check(config.Jobs.NATS.URL != "", "jobs.nats.url: required for the nats backend")
+		}
+	}
+
+	validateExport(v, "export", config.Export)
+	validateExpenses(v, "expenses", config.Expenses, config.Storage.Enabled)
+	validateIntegrations(v, "integrations", config.Integrations)
+	if config.Registry.Enabled {
+		v.check(config.Registry.URL != "", "registry.url: required when the registry is enabled")
+		v.check(strings.Contains(config.Registry.URL, "{vatNumber}") || strings.Contains(config.Registry.URL, "{number}"),
+			"registry.url: must contain {vatNumber} or {number}")
+	}
+	for i, country := range config.Registry.Countries {
+		v.check(isUpperCode(country, 2), "registry.countries[%d]: must be a country prefix like ES, got %q", i, country)
+	}
+	v.check(oneOf(config.Calibration.Method, "isotonic", "platt"), "calibration.method: must be isotonic or platt, got %q", config.Calibration.Method)
+	v.check(!config.Calibration.Enabled || config.Storage.Enabled, "calibration.enabled: requires storage.enabled")
+	v.check(!config.CategoryLearning.Enabled || config.Storage.Enabled, "category_learning.enabled: requires storage.enabled")
+	v.check(config.Webhooks.ReviewThreshold <= 1, "webhooks.review_threshold: must be between 0 and 1")
+	validateWebhooks(v, "webhooks.endpoints", config.Webhooks.Endpoints)
+	validateMail(v, "mail", config.Mail)
+	v.check(config.Rules.MismatchConfidence >= 0 && config.Rules.MismatchConfidence <= 1,
+		"rules.mismatch_confidence: must be between 0 and 1")
+	if _, err := rules.Compile(config.Rules); err != nil {
+		v.check(false, "rules: %v", err)
+	}
+	for i, hook := range config.Hooks {
+		v.check(hook.Name != "", "hooks[%d].name: required", i)
+		v.check(len(hook.Command) > 0, "hooks[%d].command: required", i)
+		v.check(len(hook.Stages) > 0, "hooks[%d].stages: required", i)
+		for _, stage := range hook.Stages {
+			v.check(oneOf(stage, "pre_ocr", "post_ocr", "post_extract"),
+				"hooks[%d].stages: must be pre_ocr, post_ocr or post_extract, got %q", i, stage)
+		}
+		v.check(hook.Timeout >= 0, "hooks[%d].timeout: must not be negative", i)
+	}
+	if _, err := scripts.Compile(config.Scripts); err != nil {
+		v.check(false, "scripts: %v", err)
+	}
+	if _, err := correct.Compile(config.OCR.Correction); err != nil {
+		v.check(false, "ocr.correction.%v", err)
+	}
+	validateResidency(v, config)
+	if _, err := classify.Compile(config.Classifier); err != nil {
+		v.check(false, "classifier.%v", err)
+	}
+	if _, err := classify.CompileProfiles(config.Profiles); err != nil {
+		v.check(false, "profiles%v", err)
+	}
+	if _, err := catalog.Load(config.Catalog); err != nil {
+		v.check(false, "catalog.%v", err)
+	}
+	if _, err := offline.Compile(config.Offline); err != nil {
+		v.check(false, "offline.%v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, tenant := range config.Tenants {
+		v.check(tenant.ID != "", "tenants[%d].id: required", i)
+		v.check(!seen[tenant.ID], "tenants[%d].id: duplicate tenant %q", i, tenant.ID)
+		seen[tenant.ID] = true
+		validateAI(v, fmt.Sprintf("tenants[%d].ai", i), tenant.AI, false)
+		validateExport(v, fmt.Sprintf("tenants[%d].export", i), tenant.Export)
+		validateExpenses(v, fmt.Sprintf("tenants[%d].expenses", i), tenant.Expenses, config.Storage.Enabled)
+		validateIntegrations(v, fmt.Sprintf("tenants[%d].integrations", i), tenant.Integrations)
+		validateWebhooks(v, fmt.Sprintf("tenants[%d].webhooks", i), tenant.Webhooks)
+		validateMail(v, fmt.Sprintf("tenants[%d].mail", i), tenant.Mail)
+	}
+
+	return errors.Join(v.errs...)
+}
+
+// validateAI checks provider settings. Tenant overrides may leave everything empty.
+func validateAI(v *validator, path string, ai models.AIConfig, required bool) {
+	if !required && ai.DefaultProvider == "" {
+		return
+	}
+
+	v.check(oneOf(ai.DefaultProvider, "openai", "gemini", "ollama", "external"),
+		"%s.default_provider: must be openai, gemini, ollama or external, got %q", path, ai.DefaultProvider)
+	v.check(ai.UnknownConfidence >= 0 && ai.UnknownConfidence <= 1,
+		"%s.unknown_confidence: must be between 0 and 1, got %v", path, ai.UnknownConfidence)
+	if ai.Ollama.KeepAlive != "" {
+		_, err := time.ParseDuration(ai.Ollama.KeepAlive)
+		v.check(err == nil, "%s.ollama.keep_alive: must be a duration like 30m, got %q", path, ai.Ollama.KeepAlive)
+	}
+	v.check(oneOf(ai.OpenAI.ImageDetail, "", "low", "high", "auto"),
+		"%s.openai.image_detail: must be low, high or auto, got %q", path, ai.OpenAI.ImageDetail)
+	v.check(ai.OpenAI.MaxImageTokens == 0 || ai.OpenAI.MaxImageTokens >= 85,
+		"%s.openai.max_image_tokens: must be at least 85, the cost of a low detail image", path)
+	if !required {
+		return
+	}
+
+	v.check(oneOf(ai.Recording.Mode, "", "record", "replay"),
+		"%s.recording.mode: must be record or replay, got %q", path, ai.Recording.Mode)
+	v.check(ai.Recording.Mode == "" || ai.Recording.Dir != "", "%s.recording.dir: required with a recording mode", path)
+	v.check(oneOf(ai.Shadow.Provider, "", "openai", "gemini", "ollama", "external"),
+		"%s.shadow.provider: must be openai, gemini, ollama or external, got %q", path, ai.Shadow.Provider)
+	v.check(len(ai.External.Command) == 0 || ai.External.URL == "", "%s.external: set command or url, not both", path)
+	v.check(ai.External.Timeout >= 0, "%s.external.timeout: must not be negative", path)
+	v.check(ai.Shadow.Percent >= 0 && ai.Shadow.Percent <= 100,
+		"%s.shadow.percent: must be between 0 and 100, got %v", path, ai.Shadow.Percent)
+	// Replayed responses need no credentials
+	if ai.Recording.Mode == "replay" {
+		return
+	}
+
+	switch ai.DefaultProvider {
+	case "openai":
+		v.check(ai.OpenAI.APIKey != "", "%s.openai.api_key: required for the default provider (set OPENAI_API_KEY or api_key_file)", path)
+	case "gemini":
+		v.check(ai.Gemini.APIKey != "", "%s.gemini.api_key: required for the default provider (set GEMINI_API_KEY or api_key_file)", path)
+	case "ollama":
+		v.check(ai.Ollama.BaseURL != "", "%s.ollama.base_url: required for the default provider", path)
+	case "external":
+		v.check(len(ai.External.Command) > 0 || ai.External.URL != "", "%s.external: command or url required for the default provider", path)
+	}
+}
+
+// validateResidency checks the residency policy and that the providers the
+// service picks on its own are allowed by it
+func validateResidency(v *validator, config *models.Config) {
+	policy, err := residency.Compile(config.Residency)
+	if err != nil {
+		v.check(false, "residency.%v", err)
+		return
+	}
+	for _, picked := range []struct{ path, provider string }{
+		{"ai.default_provider", config.AI.DefaultProvider},
+		{"ai.shadow.provider", config.AI.Shadow.Provider},
+		{"usage.budget.fallback.provider", config.Usage.Budget.Fallback.Provider},
+	} {
+		if picked.provider != "" {
+			err := policy.Check(config.AI, picked.provider)
+			v.check(err == nil, "%s: %v", picked.path, err)
+		}
+	}
+}
+
+// validateExport checks the codes of export settings. Empty values are allowed.
+func validateExport(v *validator, path string, export models.ExportConfig) {
+	v.check(export.Currency == "" || isUpperCode(export.Currency, 3),
+		"%s.currency: must be an ISO 4217 code like EUR, got %q", path, export.Currency)
+	v.check(export.Buyer.Country == "" || isUpperCode(export.Buyer.Country, 2),
+		"%s.buyer.country: must be an ISO 3166-1 alpha-2 code like ES, got %q", path, export.Buyer.Country)
+	v.check(export.Facturae.Seller.Country == "" || isUpperCode(export.Facturae.Seller.Country, 2),
+		"%s.facturae.seller.country: must be an ISO 3166-1 alpha-2 code like ES, got %q", path, export.Facturae.Seller.Country)
+	v.check(export.Facturae.SignTimeout >= 0, "%s.facturae.sign_timeout: must not be negative", path)
+}
+
+// validateExpenses checks that expense policy limits are not negative, and
+// that monthly limits have stored invoices to add up
+func validateExpenses(v *validator, path string, expenses models.ExpensesConfig, storage bool) {
+	v.check(expenses.PerDiem >= 0, "%s.per_diem: must not be negative", path)
+	v.check(expenses.MaxAmount >= 0, "%s.max_amount: must not be negative", path)
+	v.check(expenses.MaxAgeDays >= 0, "%s.max_age_days: must not be negative", path)
+	for category, limit := range expenses.CategoryLimits {
+		v.check(limit > 0, "%s.category_limits.%s: must be positive", path, category)
+	}
+	for category, limit := range expenses.MonthlyLimits {
+		v.check(limit > 0, "%s.monthly_limits.%s: must be positive", path, category)
+	}
+	v.check(len(expenses.MonthlyLimits) == 0 || storage, "%s.monthly_limits: requires storage.enabled", path)
+}
+
+// validateIntegrations checks that configured integrations have their credentials
+func validateIntegrations(v *validator, path string, integrations models.IntegrationsConfig) {
+	if odoo := integrations.Odoo; odoo.URL != "" {
+		v.check(strings.HasPrefix(odoo.URL, "http://") || strings.HasPrefix(odoo.URL, "https://"),
+			"%s.odoo.url: must be an http(s) URL, got %q", path, odoo.URL)
+		v.check(odoo.Database != "", "%s.odoo.database: required", path)
+		v.check(odoo.Username != "", "%s.odoo.username: required", path)
+		v.check(odoo.APIKey != "", "%s.odoo.api_key: required (or api_key_file)", path)
+	}
+	if rw := integrations.ReceiptWrangler; rw.URL != "" {
+		v.check(strings.HasPrefix(rw.URL, "http://") || strings.HasPrefix(rw.URL, "https://"),
+			"%s.receipt_wrangler.url: must be an http(s) URL, got %q", path, rw.URL)
+		v.check(rw.APIKey != "", "%s.receipt_wrangler.api_key: required (or api_key_file)", path)
+		v.check(rw.GroupID > 0, "%s.receipt_wrangler.group_id: required", path)
+		v.check(rw.PaidByUserID > 0, "%s.receipt_wrangler.paid_by_user_id: required", path)
+		v.check(rw.Status == "" || oneOf(rw.Status, "OPEN", "NEEDS_ATTENTION", "RESOLVED", "DRAFT"),
+			"%s.receipt_wrangler.status: must be OPEN, NEEDS_ATTENTION, RESOLVED or DRAFT, got %q", path, rw.Status)
+	}
+}
+
+// validateWebhooks checks webhook URLs, events and payload templates
+func validateWebhooks(v *validator, path string, hooks []models.WebhookConfig) {
+	for i, hook := range hooks {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		v.check(strings.HasPrefix(hook.URL, "http://") || strings.HasPrefix(hook.URL, "https://"),
+			"%s.url: must be an http(s) URL, got %q", p, hook.URL)
+		v.check(hook.Method == "" || oneOf(hook.Method, "POST", "PUT", "PATCH"),
+			"%s.method: must be POST, PUT or PATCH, got %q", p, hook.Method)
+		for _, event := range hook.Events {
+			v.check(oneOf(event, webhook.Events...),
+				"%s.events: unknown event %q, expected one of %s", p, event, strings.Join(webhook.Events, ", "))
+		}
+		if hook.Template != "" {
+			_, err := webhook.Parse(hook.Template)
+			v.check(err == nil, "%s.template: %v", p, err)
+		}
+	}
+}
+
+// validateMail checks the SMTP settings and email addresses
+func validateMail(v *validator, path string, config models.MailConfig) {
+	if config.Host != "" {
+		_, err := mail.ParseAddress(config.From)
+		v.check(err == nil, "%s.from: must be an email address, got %q", path, config.From)
+	}
+	v.check(config.TLS == "" || oneOf(config.TLS, "starttls", "tls", "none"),
+		"%s.tls: must be starttls, tls or none, got %q", path, config.TLS)
+	for i, to := range config.To {
+		_, err := mail.ParseAddress(to)
+		v.check(err == nil, "%s.to[%d]: must be an email address, got %q", path, i, to)
+	}
+}
+
+// isUpperCode reports whether s is n uppercase ASCII letters
+func isUpperCode(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateTLS checks that exactly one certificate source is configured
+func validateTLS(v *validator, tls models.TLSConfig) {
+	files := tls.CertFile != "" || tls.KeyFile != ""
+	autocert := len(tls.Autocert.Domains) > 0
+
+	v.check(files || autocert, "tls: set cert_file and key_file or autocert.domains")
+	v.check(!(files && autocert), "tls: cert_file/key_file and autocert.domains are mutually exclusive")
+	if files {
+		v.check(tls.CertFile != "" && tls.KeyFile != "", "tls: cert_file and key_file must be set together")
+	}
+	v.check(oneOf(tls.MinVersion, "", "1.2", "1.3"), "tls.min_version: must be 1.2 or 1.3, got %q", tls.MinVersion)
+}
+
+// validateAuth checks the authentication settings
+func validateAuth(v *validator, auth models.AuthConfig) {
+	v.check(oneOf(auth.Mode, "api_key", "jwt", "both"),
+		"auth.mode: must be api_key, jwt or both, got %q", auth.Mode)
+
+	if auth.Mode == "api_key" || auth.Mode == "both" {
+		names := make(map[string]bool)
+		for i, key := range auth.APIKeys {
+			v.check(key.Name != "", "auth.api_keys[%d].name: required", i)
+			v.check(key.Key != "", "auth.api_keys[%d].key: required (set key or key_file)", i)
+			v.check(!names[key.Name], "auth.api_keys[%d].name: duplicate key name %q", i, key.Name)
+			names[key.Name] = true
+		}
+	}
+
+	if auth.Mode == "jwt" || auth.Mode == "both" {
+		v.check(auth.JWT.JWKSURL != "", "auth.jwt.jwks_url: required for jwt authentication")
+	}
+}
@@ -0,0 +1,135 @@
+// Package consistency checks the arithmetic of extracted invoices and repairs
+// values OCR misread, so an invoice does not contradict itself
+package consistency
+
+import (
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// Line item fields a repair can replace
+const (
+	FieldQuantity  = "quantity"
+	FieldUnitPrice = "unitPrice"
+	FieldAmount    = "amount"
+)
+
+// confusions are the digits OCR commonly reads instead of each digit
+var confusions = map[rune]string{
+	'0': "869",
+	'1': "74",
+	'2': "7",
+	'3': "8",
+	'4': "19",
+	'5': "68",
+	'6': "580",
+	'7': "12",
+	'8': "0365",
+	'9': "04",
+}
+
+var (
+	cent    = decimal.New(1, -2)
+	ten     = decimal.NewFromInt(10)
+	hundred = decimal.NewFromInt(100)
+)
+
+// RepairItems checks that quantity × unit price is the amount of each item
+// that has all three. When it is not, it looks for a single misread value: one
+// digit confused with a lookalike, or a lost or extra decimal separator. The
+// value is replaced only when exactly one such change makes the item add up;
+// otherwise the item is marked Inconsistent. It returns the number of items
+// repaired.
+func RepairItems(items []models.InvoiceItem) int {
+	repaired := 0
+	for i := range items {
+		item := &items[i]
+		item.Repair = nil
+		item.Inconsistent = false
+		if item.Quantity <= 0 || item.UnitPrice == nil || item.UnitPrice.IsZero() || item.Amount.IsZero() {
+			continue
+		}
+		quantity := decimal.NewFromInt(int64(item.Quantity))
+		if adds(quantity, *item.UnitPrice, item.Amount) {
+			continue
+		}
+
+		type candidate struct {
+			field string
+			value decimal.Decimal
+		}
+		var found []candidate
+		for _, v := range variants(quantity, 0) {
+			if v.IsInteger() && adds(v, *item.UnitPrice, item.Amount) {
+				found = append(found, candidate{FieldQuantity, v})
+			}
+		}
+		for _, v := range variants(*item.UnitPrice, 2) {
+			if adds(quantity, v, item.Amount) {
+				found = append(found, candidate{FieldUnitPrice, v})
+			}
+		}
+		for _, v := range variants(item.Amount, 2) {
+			if adds(quantity, *item.UnitPrice, v) {
+				found = append(found, candidate{FieldAmount, v})
+			}
+		}
+		if len(found) != 1 {
+			item.Inconsistent = true
+			continue
+		}
+
+		switch fix := found[0]; fix.field {
+		case FieldQuantity:
+			item.Repair = &models.ItemRepair{Field: fix.field, Original: quantity}
+			item.Quantity = int(fix.value.IntPart())
+		case FieldUnitPrice:
+			item.Repair = &models.ItemRepair{Field: fix.field, Original: *item.UnitPrice}
+			item.UnitPrice = &fix.value
+		case FieldAmount:
+			item.Repair = &models.ItemRepair{Field: fix.field, Original: item.Amount}
+			item.Amount = fix.value
+		}
+		repaired++
+	}
+	return repaired
+}
+
+// adds reports whether quantity × unitPrice is amount, allowing for unit
+// prices rounded to the cent: half a cent per unit, at least a cent
+func adds(quantity, unitPrice, amount decimal.Decimal) bool {
+	tolerance := decimal.Max(cent, quantity.Mul(cent).Div(decimal.NewFromInt(2)))
+	return quantity.Mul(unitPrice).Sub(amount).Abs().LessThanOrEqual(tolerance)
+}
+
+// variants returns the positive values value may have been misread from,
+// written with places decimals: each digit replaced by a lookalike, and the
+// decimal separator moved by one or two places
+func variants(value decimal.Decimal, places int32) []decimal.Decimal {
+	var list []decimal.Decimal
+	seen := map[string]bool{value.String(): true}
+	add := func(v decimal.Decimal) {
+		if v.IsPositive() && !seen[v.String()] {
+			seen[v.String()] = true
+			list = append(list, v)
+		}
+	}
+
+	text := value.StringFixed(places)
+	for i, digit := range text {
+		for _, lookalike := range confusions[digit] {
+			if v, err := decimal.NewFromString(text[:i] + string(lookalike) + text[i+1:]); err == nil {
+				add(v)
+			}
+		}
+	}
+	if places > 0 && !strings.HasPrefix(text, "-") {
+		add(value.Mul(ten))
+		add(value.Mul(hundred))
+		add(value.Div(ten).Round(places))
+		add(value.Div(hundred).Round(places))
+	}
+	return list
+}
@@ -0,0 +1,63 @@
+package consistency
+
+import (
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestRepairItems(t *testing.T) {
+	price := func(s string) *decimal.Decimal {
+		d := decimal.RequireFromString(s)
+		return &d
+	}
+
+	tests := []struct {
+		name         string
+		quantity     int
+		unitPrice    *decimal.Decimal
+		amount       string
+		wantField    string
+		wantQuantity int
+		wantPrice    string
+		wantAmount   string
+		inconsistent bool
+	}{
+		{"consistent", 3, price("2.50"), "7.50", "", 3, "2.50", "7.50", false},
+		{"rounded unit price", 3, price("3.33"), "10.00", "", 3, "3.33", "10.00", false},
+		{"no unit price", 3, nil, "7.00", "", 3, "", "7.00", false},
+		{"misread amount digit", 2, price("4.25"), "8.60", FieldAmount, 2, "4.25", "8.50", false},
+		{"misread unit price digit", 4, price("2.15"), "11.00", FieldUnitPrice, 4, "2.75", "11.00", false},
+		{"ambiguous decimal separator", 1, price("1250"), "12.50", "", 1, "1250", "12.50", true},
+		{"misread quantity", 8, price("1.20"), "3.60", FieldQuantity, 3, "1.20", "3.60", false},
+		{"no single repair", 2, price("4.00"), "13.37", "", 2, "4.00", "13.37", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []models.InvoiceItem{{Quantity: tt.quantity, UnitPrice: tt.unitPrice, Amount: decimal.RequireFromString(tt.amount)}}
+			RepairItems(items)
+			item := items[0]
+
+			field := ""
+			if item.Repair != nil {
+				field = item.Repair.Field
+			}
+			if field != tt.wantField {
+				t.Errorf("repaired %q, want %q", field, tt.wantField)
+			}
+			if item.Inconsistent != tt.inconsistent {
+				t.Errorf("Inconsistent = %v, want %v", item.Inconsistent, tt.inconsistent)
+			}
+			if item.Quantity != tt.wantQuantity {
+				t.Errorf("Quantity = %d, want %d", item.Quantity, tt.wantQuantity)
+			}
+			if item.UnitPrice != nil && !item.UnitPrice.Equal(decimal.RequireFromString(tt.wantPrice)) {
+				t.Errorf("UnitPrice = %s, want %s", item.UnitPrice, tt.wantPrice)
+			}
+			if !item.Amount.Equal(decimal.RequireFromString(tt.wantAmount)) {
+				t.Errorf("Amount = %s, want %s", item.Amount, tt.wantAmount)
+			}
+		})
+	}
+}
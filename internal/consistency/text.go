@@ -0,0 +1,31 @@
+package consistency
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// number matches a number of OCR text, with thousands and decimal separators
+var number = regexp.MustCompile(`\d(?:[\d.,']*\d)?`)
+
+// InText reports whether amount is printed in OCR text, as 1234.50, 1.234,50,
+// 1'234.50 or, for whole amounts, 1234. An amount read from elsewhere, e.g.
+// guessed by the model or written by hand, is usually not.
+func InText(amount decimal.Decimal, text string) bool {
+	amount = amount.Abs()
+	cents := strings.Replace(amount.StringFixed(2), ".", "", 1)
+	for _, match := range number.FindAllString(text, -1) {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, match)
+		if digits == cents || (amount.IsInteger() && digits == amount.String()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package consistency
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestInText(t *testing.T) {
+	tests := []struct {
+		amount string
+		text   string
+		want   bool
+	}{
+		{"12.50", "TOTAL 12,50 EUR", true},
+		{"12.50", "TOTAL: 12.50", true},
+		{"1234.50", "Total factura 1.234,50 €", true},
+		{"1234.50", "Total CHF 1'234.50", true},
+		{"12.00", "TOTAL 12 €", true},
+		{"12.50", "SUBTOTAL 312,50", false},
+		{"12.50", "2 x 6,25\nTOTAL ____", false},
+		{"45.00", "PROPINA ____\nTOTAL", false},
+	}
+	for _, tt := range tests {
+		if got := InText(decimal.RequireFromString(tt.amount), tt.text); got != tt.want {
+			t.Errorf("InText(%s, %q) = %v, want %v", tt.amount, tt.text, got, tt.want)
+		}
+	}
+}
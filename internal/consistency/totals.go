@@ -0,0 +1,38 @@
+package consistency
+
+import (
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// CheckTotal sets TotalMismatch when the items of an invoice do not add up to
+// its total. Item amounts may include tax or not, so the total may be their sum
+// or their sum plus tax; either way the tip and the printed cash rounding are
+// added. An invoice without items or total is not checked. It returns
+// TotalMismatch.
+func CheckTotal(invoice *models.Invoice) bool {
+	invoice.TotalMismatch = false
+	if len(invoice.Items) == 0 || invoice.Total.IsZero() {
+		return false
+	}
+
+	sum := decimal.Zero
+	for _, item := range invoice.Items {
+		sum = sum.Add(item.Amount)
+	}
+	if invoice.Tip != nil {
+		sum = sum.Add(*invoice.Tip)
+	}
+	if invoice.RoundingAdjustment != nil {
+		sum = sum.Add(*invoice.RoundingAdjustment)
+	}
+	// A cent per item for amounts each rounded on their own
+	tolerance := cent.Mul(decimal.NewFromInt(int64(len(invoice.Items))))
+	for _, total := range []decimal.Decimal{sum, sum.Add(invoice.Tax)} {
+		if total.Sub(invoice.Total).Abs().LessThanOrEqual(tolerance) {
+			return false
+		}
+	}
+	invoice.TotalMismatch = true
+	return true
+}
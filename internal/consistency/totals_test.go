@@ -0,0 +1,52 @@
+package consistency
+
+import (
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestCheckTotal(t *testing.T) {
+	amount := decimal.RequireFromString
+
+	tests := []struct {
+		name     string
+		items    []string
+		tax      string
+		rounding string
+		tip      string
+		total    string
+		want     bool
+	}{
+		{"tax included", []string{"2.50", "4.99"}, "0.68", "", "", "7.49", false},
+		{"tax added", []string{"100.00", "20.00"}, "25.20", "", "", "145.20", false},
+		{"cash rounding", []string{"1.99", "2.99"}, "0", "0.02", "", "5.00", false},
+		{"cash rounding down", []string{"1.99", "2.99"}, "0", "-0.03", "", "4.95", false},
+		{"within a cent per item", []string{"1.99", "2.99"}, "0", "", "", "5.00", false},
+		{"wrong total", []string{"1.99", "2.99"}, "0", "", "", "15.00", true},
+		{"rounding does not explain", []string{"1.99", "2.99"}, "0", "-0.03", "", "5.10", true},
+		{"tip", []string{"24.50", "3.20"}, "2.52", "", "3.00", "30.70", false},
+		{"tip left out", []string{"24.50", "3.20"}, "2.52", "", "", "30.70", true},
+		{"no items", nil, "0", "", "", "12.00", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice := &models.Invoice{Total: amount(tt.total), Tax: amount(tt.tax)}
+			for _, a := range tt.items {
+				invoice.Items = append(invoice.Items, models.InvoiceItem{Amount: amount(a)})
+			}
+			if tt.rounding != "" {
+				rounding := amount(tt.rounding)
+				invoice.RoundingAdjustment = &rounding
+			}
+			if tt.tip != "" {
+				tip := amount(tt.tip)
+				invoice.Tip = &tip
+			}
+			if got := CheckTotal(invoice); got != tt.want || invoice.TotalMismatch != tt.want {
+				t.Errorf("CheckTotal = %v, TotalMismatch = %v, want %v", got, invoice.TotalMismatch, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Package correct fixes characters and word breaks OCR commonly gets wrong on
+// receipts, such as an O read for a 0 in an amount or a label run into its
+// value, before the text reaches vendor rules and the AI
+package correct
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Correction passes
+const (
+	Amounts    = "amounts"     // Letters read for digits in amounts: O/0, l/1, S/5...
+	SplitWords = "split_words" // Keywords run together or into an amount: "TOTALDUE12.50"
+)
+
+// digitFor maps the letters thermal-printer fonts are misread as to their digit
+var digitFor = map[rune]rune{
+	'O': '0', 'o': '0', 'Q': '0', 'D': '0',
+	'l': '1', 'I': '1',
+	'Z': '2',
+	'S': '5', 's': '5',
+	'B': '8',
+}
+
+// defaultKeywords are the receipt words split out of joined words
+var defaultKeywords = []string{
+	"total", "subtotal", "tax", "vat", "net", "due", "amount", "balance", "cash",
+	"change", "card", "paid", "tip", "discount", "price", "qty", "date", "time",
+	"iva", "base", "importe", "efectivo", "cambio", "tarjeta", "entregado",
+	"summe", "betrag", "mwst", "gesamt", "montant", "tva",
+}
+
+var (
+	// amountLike matches an amount with two decimals whose characters may
+	// include letters misread for digits, e.g. "l2.5O" or "1.2S4,OO"
+	amountLike = regexp.MustCompile(`[0-9OoQDlIZSsB]+(?:[.,][0-9OoQDlIZSsB]{3})*[.,][0-9OoQDlIZSsB]{2}\b`)
+
+	// amount matches a well-formed amount with two decimals
+	amount = regexp.MustCompile(`^\d+(?:[.,]\d{3})*[.,]\d{2}$`)
+
+	// labelAmount matches a word run into the amount that follows it
+	labelAmount = regexp.MustCompile(`\b([A-Za-z]{2,})(\d{1,3}(?:[.,]\d{3})*[.,]\d{2}|\d+[.,]\d{2})\b`)
+
+	// amountLabel matches an amount run into the word that follows it, e.g. a currency
+	amountLabel = regexp.MustCompile(`(\d[.,]\d{2})([A-Za-z]{2,})\b`)
+
+	// word matches a run of ASCII letters
+	word = regexp.MustCompile(`[A-Za-z]+`)
+)
+
+// Corrector applies the configured correction passes
+type Corrector struct {
+	amounts    bool
+	splitWords bool
+	keywords   map[string]bool
+}
+
+// Compile checks config and returns its corrector. It returns nil when
+// correction is disabled.
+func Compile(config models.CorrectionConfig) (*Corrector, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	c := &Corrector{keywords: make(map[string]bool)}
+	passes := config.Passes
+	if len(passes) == 0 {
+		passes = []string{Amounts, SplitWords}
+	}
+	for _, pass := range passes {
+		switch pass {
+		case Amounts:
+			c.amounts = true
+		case SplitWords:
+			c.splitWords = true
+		default:
+			return nil, fmt.Errorf("passes: must be %s or %s, got %q", Amounts, SplitWords, pass)
+		}
+	}
+
+	for _, keyword := range defaultKeywords {
+		c.keywords[keyword] = true
+	}
+	for i, keyword := range config.Keywords {
+		if keyword == "" || word.FindString(keyword) != keyword {
+			return nil, fmt.Errorf("keywords[%d]: must be ASCII letters, got %q", i, keyword)
+		}
+		c.keywords[strings.ToLower(keyword)] = true
+	}
+	return c, nil
+}
+
+// Text returns text with the corrections applied. A nil Corrector returns it
+// unchanged.
+func (c *Corrector) Text(text string) string {
+	if c == nil {
+		return text
+	}
+	if c.amounts {
+		text = fixAmounts(text)
+	}
+	if c.splitWords {
+		text = c.split(text)
+	}
+	return text
+}
+
+// fixAmounts replaces the misread letters of amount-shaped tokens that have
+// at least one real digit
+func fixAmounts(text string) string {
+	matches := amountLike.FindAllStringIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		// A label run into the amount keeps its letters, e.g. "TOTALl2.5O"
+		if start > 0 && isLetter(text[start-1]) {
+			for start < end && !isDigit(text[start]) {
+				start++
+			}
+		}
+		candidate := text[start:end]
+		if !strings.ContainsAny(candidate, "0123456789") {
+			continue
+		}
+		fixed := strings.Map(func(r rune) rune {
+			if d, ok := digitFor[r]; ok {
+				return d
+			}
+			return r
+		}, candidate)
+		if fixed == candidate || !amount.MatchString(fixed) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(fixed)
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// split separates labels and amounts that were run together, and words made
+// of several keywords
+func (c *Corrector) split(text string) string {
+	text = labelAmount.ReplaceAllString(text, "$1 $2")
+	text = amountLabel.ReplaceAllString(text, "$1 $2")
+	return word.ReplaceAllStringFunc(text, func(w string) string {
+		if parts := c.segment(w); parts != nil {
+			return strings.Join(parts, " ")
+		}
+		return w
+	})
+}
+
+// segment splits w into keywords, preferring the longest last keyword. It
+// returns nil unless w is made of two or more keywords, so keywords such as
+// "subtotal" and other words are left alone.
+func (c *Corrector) segment(w string) []string {
+	lower := strings.ToLower(w)
+	if len(lower) < 6 || c.keywords[lower] {
+		return nil
+	}
+
+	// from[i] is where the last keyword of a split of lower[:i] starts, -1 when there is none
+	from := make([]int, len(lower)+1)
+	for i := range from {
+		from[i] = -1
+	}
+	from[0] = 0
+	for i := 1; i <= len(lower); i++ {
+		for j := 0; j < i; j++ {
+			if from[j] >= 0 && c.keywords[lower[j:i]] {
+				from[i] = j
+				break
+			}
+		}
+	}
+	if from[len(lower)] < 0 {
+		return nil
+	}
+
+	var parts []string
+	for i := len(lower); i > 0; i = from[i] {
+		parts = append([]string{w[from[i]:i]}, parts...)
+	}
+	if len(parts) < 2 {
+		return nil
+	}
+	return parts
+}
+
+func isLetter(b byte) bool {
+	return b < unicode.MaxASCII && unicode.IsLetter(rune(b))
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
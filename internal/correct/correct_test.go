@@ -0,0 +1,99 @@
+package correct
+
+import (
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func compile(t *testing.T, config models.CorrectionConfig) *Corrector {
+	t.Helper()
+	config.Enabled = true
+	c, err := Compile(config)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return c
+}
+
+func TestText(t *testing.T) {
+	c := compile(t, models.CorrectionConfig{})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"o for zero", "TOTAL 12.5O", "TOTAL 12.50"},
+		{"l for one", "Bread l2.50", "Bread 12.50"},
+		{"s for five", "Milk 1.2S", "Milk 1.25"},
+		{"comma decimals", "IVA 2l,OO", "IVA 21,00"},
+		{"thousands", "Room 1.2S4,OO", "Room 1.254,00"},
+		{"currency symbol", "€l2.5O", "€12.50"},
+		{"percent", "Tax 1O,OO%", "Tax 10,00%"},
+		{"no digit", "SOLD.OS", "SOLD.OS"},
+		{"plain word", "Sourdough Bread", "Sourdough Bread"},
+		{"date", "Date: 15.O3.2024", "Date: 15.03.2024"},
+		{"label run into amount", "TOTAL13.86", "TOTAL 13.86"},
+		{"amount run into currency", "13.86EUR", "13.86 EUR"},
+		{"joined keywords", "TOTALDUE 13.86", "TOTAL DUE 13.86"},
+		{"joined keywords and amount", "AmountDue12.5O", "Amount Due 12.50"},
+		{"keyword left alone", "SUBTOTAL 12.60", "SUBTOTAL 12.60"},
+		{"unknown word left alone", "CASHBACK 5.00", "CASHBACK 5.00"},
+		{"short word left alone", "TAXI 5.00", "TAXI 5.00"},
+		{"multiline", "Coffee 8.9O\nTOTALTAX l.26", "Coffee 8.90\nTOTAL TAX 1.26"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasses(t *testing.T) {
+	in := "TOTALDUE l2.5O"
+
+	tests := []struct {
+		passes []string
+		want   string
+	}{
+		{[]string{Amounts}, "TOTALDUE 12.50"},
+		{[]string{SplitWords}, "TOTAL DUE l2.5O"},
+		{[]string{Amounts, SplitWords}, "TOTAL DUE 12.50"},
+	}
+	for _, tt := range tests {
+		c := compile(t, models.CorrectionConfig{Passes: tt.passes})
+		if got := c.Text(in); got != tt.want {
+			t.Errorf("passes %v: Text(%q) = %q, want %q", tt.passes, in, got, tt.want)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	c := compile(t, models.CorrectionConfig{Keywords: []string{"Propina"}})
+	if got, want := c.Text("PROPINATOTAL 2.00"), "PROPINA TOTAL 2.00"; got != want {
+		t.Errorf("Text = %q, want %q", got, want)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	c, err := Compile(models.CorrectionConfig{})
+	if err != nil || c != nil {
+		t.Fatalf("disabled: Compile = %v, %v, want nil, nil", c, err)
+	}
+	if got := c.Text("l2.5O"); got != "l2.5O" {
+		t.Errorf("nil Corrector changed text to %q", got)
+	}
+
+	for _, config := range []models.CorrectionConfig{
+		{Enabled: true, Passes: []string{"spelling"}},
+		{Enabled: true, Keywords: []string{"tip tax"}},
+		{Enabled: true, Keywords: []string{""}},
+	} {
+		if _, err := Compile(config); err == nil {
+			t.Errorf("Compile(%+v): expected an error", config)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+var (
+	defaultMethods = []string{"GET", "POST", "DELETE"}
+	defaultHeaders = []string{"Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "Accept-Version", "X-Priority"}
+	defaultExposed = []string{"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After", "Location"}
+)
+
+const defaultMaxAge = 10 * time.Minute
+
+// Policy decides which cross-origin requests browsers may make
+type Policy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	suffixes    []string // From "https://*.example.com" patterns, e.g. ".example.com" with scheme "https://"
+	methods     string
+	headers     map[string]bool
+	allowHeader string
+	exposed     string
+	credentials bool
+	maxAge      string
+}
+
+// New creates a policy from config, applying defaults for empty lists
+func New(config models.CORSConfig) *Policy {
+	p := &Policy{
+		origins:     make(map[string]bool),
+		headers:     make(map[string]bool),
+		credentials: config.AllowCredentials,
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		origin = strings.TrimRight(strings.ToLower(origin), "/")
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			p.suffixes = append(p.suffixes, strings.Replace(origin, "://*.", "://.", 1))
+		default:
+			p.origins[origin] = true
+		}
+	}
+
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultMethods
+	}
+	p.methods = strings.ToUpper(strings.Join(methods, ", "))
+
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultHeaders
+	}
+	for _, h := range headers {
+		p.headers[strings.ToLower(h)] = true
+	}
+	p.allowHeader = strings.Join(headers, ", ")
+
+	exposed := config.ExposedHeaders
+	if len(exposed) == 0 {
+		exposed = defaultExposed
+	}
+	p.exposed = strings.Join(exposed, ", ")
+
+	maxAge := config.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultMaxAge
+	}
+	p.maxAge = strconv.Itoa(int(maxAge.Seconds()))
+
+	return p
+}
+
+// allowOrigin reports whether origin may access the API
+func (p *Policy) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, suffix := range p.suffixes {
+		scheme, domain, _ := strings.Cut(suffix, "://")
+		if strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders reports whether every header requested in a preflight is allowed
+func (p *Policy) allowHeaders(requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && !p.headers[h] {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler adds CORS headers to responses for allowed origins and answers
+// preflight requests. Disallowed origins get no CORS headers, so browsers
+// block the response; the request itself is still served for non-browser clients.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !p.allowOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Credentials are never allowed for the "*" wildcard; validation
+		// rejects the combination, and any origin must not get them
+		if p.anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if p.credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", p.exposed)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if !strings.Contains(", "+p.methods+", ", ", "+method+", ") || !p.allowHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", p.methods)
+		w.Header().Set("Access-Control-Allow-Headers", p.allowHeader)
+		w.Header().Set("Access-Control-Max-Age", p.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
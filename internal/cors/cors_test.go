@@ -0,0 +1,117 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func serve(p *Policy, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/v1/process-invoice", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	p.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(w, r)
+	return w
+}
+
+func TestAllowOrigin(t *testing.T) {
+	p := New(models.CORSConfig{AllowedOrigins: []string{"https://app.example.com/", "https://*.facturaia.com"}})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://other.example.com", false},
+		{"https://eu.facturaia.com", true},
+		{"https://a.b.facturaia.com", true},
+		{"https://facturaia.com", false},
+		{"http://eu.facturaia.com", false},
+		{"https://evilfacturaia.com", false},
+		{"https://eu.facturaia.com.evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := p.allowOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerHeaders(t *testing.T) {
+	tests := []struct {
+		name            string
+		config          models.CORSConfig
+		origin          string
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"listed origin", models.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}},
+			"https://app.example.com", "https://app.example.com", ""},
+		{"credentials echo listed origin", models.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true},
+			"https://app.example.com", "https://app.example.com", "true"},
+		{"wildcard", models.CORSConfig{AllowedOrigins: []string{"*"}},
+			"https://any.example.org", "*", ""},
+		{"wildcard never grants credentials", models.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+			"https://evil.example.org", "*", ""},
+		{"other origin", models.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true},
+			"https://evil.example.org", "", ""},
+		{"no origin", models.CORSConfig{AllowedOrigins: []string{"*"}},
+			"", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(New(tt.config), http.MethodPost, tt.origin, nil)
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want 200", w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	p := New(models.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}})
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		want    int
+	}{
+		{"allowed", "https://app.example.com", "POST", "Content-Type, X-API-Key", http.StatusNoContent},
+		{"disallowed origin", "https://evil.example.org", "POST", "", http.StatusForbidden},
+		{"disallowed method", "https://app.example.com", "PUT", "", http.StatusForbidden},
+		{"disallowed header", "https://app.example.com", "POST", "X-Custom", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(p, http.MethodOptions, tt.origin, map[string]string{
+				"Access-Control-Request-Method":  tt.method,
+				"Access-Control-Request-Headers": tt.headers,
+			})
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusNoContent && w.Header().Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Access-Control-Max-Age = %q", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Package eval measures extraction quality against a labeled test set: each
+// document is run through the pipeline and its fields are compared with the
+// expected values, per provider and model
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+	"github.com/shopspring/decimal"
+)
+
+// ErrNoCases is returned by LoadCases when a directory holds no labeled documents
+var ErrNoCases = errors.New("no labeled documents found")
+
+// documentExtensions are the files LoadCases picks up
+var documentExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true,
+	".tif": true, ".tiff": true, ".webp": true, ".pdf": true,
+}
+
+// Expected holds the labeled fields of a document. Fields left out of the
+// label file are not scored; an empty value ("", "0", []) expects the field
+// to be missing from the extraction.
+type Expected struct {
+	Vendor     *string          `json:"vendor"`
+	Date       *string          `json:"date"` // YYYY-MM-DD
+	Total      *decimal.Decimal `json:"total"`
+	Tax        *decimal.Decimal `json:"tax"`
+	Categories []string         `json:"categories"`
+	ItemCount  *int             `json:"itemCount"`
+}
+
+// Case is a document with its expected fields
+type Case struct {
+	Name     string // Path relative to the test set directory
+	File     string
+	Expected Expected
+}
+
+// Target is a provider and model to evaluate
+type Target struct {
+	Provider string
+	Model    string // Empty uses the provider's configured model
+}
+
+// String returns "provider/model", or the provider alone
+func (t Target) String() string {
+	if t.Model == "" {
+		return t.Provider
+	}
+	return t.Provider + "/" + t.Model
+}
+
+// ParseTarget parses "provider" or "provider:model"
+func ParseTarget(s string) (Target, error) {
+	provider, model, _ := strings.Cut(s, ":")
+	if provider == "" {
+		return Target{}, fmt.Errorf("invalid target %q, expected provider[:model]", s)
+	}
+	return Target{Provider: provider, Model: model}, nil
+}
+
+// Options configures a run. Options.Pipeline.Provider and Model are set per target.
+type Options struct {
+	Pipeline    pipeline.Options
+	Concurrency int                                                                      // Documents processed at once (default: 1)
+	Tolerance   decimal.Decimal                                                          // Largest amount difference counted as correct (default: 0.01)
+	Cost        func(provider, model string, promptTokens, completionTokens int) float64 // Estimated USD cost, nil for none
+}
+
+// Result is the outcome of one document with one target
+type Result struct {
+	Case     string            `json:"case"`
+	Target   string            `json:"target"`
+	Model    string            `json:"model"` // Model used, with config defaults applied
+	Error    string            `json:"error,omitempty"`
+	Stage    string            `json:"stage,omitempty"`
+	Invoice  *pipeline.Invoice `json:"invoice,omitempty"`
+	Duration float64           `json:"duration"` // Seconds, for the whole pipeline
+	Usage    pipeline.Usage    `json:"usage"`
+	Mismatch []string          `json:"mismatch,omitempty"` // Scored fields that were wrong or missing
+}
+
+// Label returns the expected fields of a document whose values are known,
+// e.g. a generated one, labeling every scored field
+func Label(invoice *pipeline.Invoice) Expected {
+	vendor := invoice.Vendor
+	date := ""
+	if !invoice.Date.IsZero() {
+		date = invoice.Date.Format(time.DateOnly)
+	}
+	total, tax := invoice.Total, invoice.Tax
+	categories := append([]string{}, invoice.Categories...)
+	itemCount := len(invoice.Items)
+	return Expected{
+		Vendor:     &vendor,
+		Date:       &date,
+		Total:      &total,
+		Tax:        &tax,
+		Categories: categories,
+		ItemCount:  &itemCount,
+	}
+}
+
+// LoadCases finds the documents under dir that have a label file: the
+// document name with a .json extension, e.g. receipt1.jpg and receipt1.json
+func LoadCases(dir string) ([]Case, error) {
+	var cases []Case
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || !documentExtensions[ext] {
+			return nil
+		}
+
+		labelPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+		data, err := os.ReadFile(labelPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var expected Expected
+		if err := json.Unmarshal(data, &expected); err != nil {
+			return fmt.Errorf("invalid label file %s: %w", labelPath, err)
+		}
+		if expected.Date != nil && *expected.Date != "" {
+			if _, err := time.Parse(time.DateOnly, *expected.Date); err != nil {
+				return fmt.Errorf("invalid date in %s, expected YYYY-MM-DD", labelPath)
+			}
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			name = path
+		}
+		cases = append(cases, Case{Name: name, File: path, Expected: expected})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test set: %w", err)
+	}
+	if len(cases) == 0 {
+		return nil, ErrNoCases
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, nil
+}
+
+// Run evaluates every case with every target and returns the report.
+// progress, if not nil, is called after each document.
+func Run(ctx context.Context, cases []Case, targets []Target, opts Options, progress func(Result)) (*Report, error) {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Tolerance.IsZero() {
+		opts.Tolerance = decimal.NewFromFloat(0.01)
+	}
+
+	report := &Report{Cases: len(cases)}
+	for _, target := range targets {
+		results := make([]Result, len(cases))
+
+		var wg sync.WaitGroup
+		jobs := make(chan int)
+		for i := 0; i < opts.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					results[i] = runCase(ctx, cases[i], target, opts)
+					if progress != nil {
+						progress(results[i])
+					}
+				}
+			}()
+		}
+		for i := range cases {
+			if ctx.Err() != nil {
+				break
+			}
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		report.Targets = append(report.Targets, summarize(target, cases, results, opts.Tolerance))
+		report.Results = append(report.Results, results...)
+	}
+	return report, nil
+}
+
+// runCase processes one document with target and scores the result
+func runCase(ctx context.Context, c Case, target Target, opts Options) Result {
+	result := Result{Case: c.Name, Target: target.String()}
+
+	image, err := os.ReadFile(c.File)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read file: %v", err)
+		return result
+	}
+
+	options := opts.Pipeline
+	options.Provider = target.Provider
+	options.Model = target.Model
+
+	start := time.Now()
+	invoice, stats, err := pipeline.Process(ctx, image, options)
+	result.Duration = time.Since(start).Seconds()
+	result.Model = stats.Model
+	result.Usage = stats.Usage
+	if opts.Cost != nil {
+		result.Usage.EstimatedCost = opts.Cost(stats.Provider, stats.Model, stats.Usage.PromptTokens, stats.Usage.CompletionTokens)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		var se *pipeline.StageError
+		if errors.As(err, &se) {
+			result.Stage = se.Stage
+		}
+		return result
+	}
+
+	// The raw text is not scored and would bloat per-document output
+	invoice.RawText = ""
+	result.Invoice = invoice
+	for _, field := range score(c.Expected, invoice, opts.Tolerance) {
+		if field.outcome == correct || field.outcome == absent {
+			continue
+		}
+		// Categories score each label, but are listed once
+		if n := len(result.Mismatch); n == 0 || result.Mismatch[n-1] != field.name {
+			result.Mismatch = append(result.Mismatch, field.name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,341 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+	"github.com/shopspring/decimal"
+)
+
+// Scored fields, in report order
+var fieldNames = []string{"vendor", "date", "total", "tax", "categories", "itemCount"}
+
+// outcome is how an extracted field compares with its label
+type outcome int
+
+const (
+	correct  outcome = iota // Expected and extracted alike
+	absent                  // Expected empty and not extracted
+	missing                 // Expected but not extracted
+	wrong                   // Extracted with a different value
+	spurious                // Extracted although expected empty
+)
+
+// fieldScore is the outcome of one field; categories score each label separately
+type fieldScore struct {
+	name    string
+	outcome outcome
+}
+
+// Report summarizes a run
+type Report struct {
+	Cases   int            `json:"cases"`
+	Targets []TargetReport `json:"targets"`
+	Results []Result       `json:"results"`
+}
+
+// TargetReport holds the metrics of one provider and model
+type TargetReport struct {
+	Target    string `json:"target"`
+	Model     string `json:"model"`
+	Documents int    `json:"documents"`
+	Failures  int    `json:"failures"`
+	Exact     int    `json:"exact"` // Documents with every scored field correct
+
+	Fields []FieldMetrics `json:"fields"`
+
+	TotalError AmountError `json:"totalError"`
+	TaxError   AmountError `json:"taxError"`
+
+	Latency          Distribution `json:"latency"` // Seconds per document
+	PromptTokens     int          `json:"promptTokens"`
+	CompletionTokens int          `json:"completionTokens"`
+	Cost             float64      `json:"cost"`            // Estimated USD for the whole set
+	CostPerDocument  float64      `json:"costPerDocument"` // Estimated USD
+}
+
+// FieldMetrics counts the outcomes of one field. A wrong value counts against
+// both precision and recall.
+type FieldMetrics struct {
+	Field     string  `json:"field"`
+	Correct   int     `json:"correct"`
+	Wrong     int     `json:"wrong"`
+	Missing   int     `json:"missing"`
+	Spurious  int     `json:"spurious"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+}
+
+// AmountError describes the absolute error of an amount over the documents
+// where it was both expected and extracted
+type AmountError struct {
+	Distribution
+	WithinTolerance float64 `json:"withinTolerance"` // Share of samples counted as correct
+}
+
+// Distribution summarizes a set of samples
+type Distribution struct {
+	Samples int     `json:"samples"`
+	Mean    float64 `json:"mean"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	Max     float64 `json:"max"`
+}
+
+// score compares an extraction with the labels. invoice is nil for a failed run.
+func score(expected Expected, invoice *pipeline.Invoice, tolerance decimal.Decimal) []fieldScore {
+	if invoice == nil {
+		invoice = &pipeline.Invoice{}
+	}
+	var scores []fieldScore
+	add := func(name string, o outcome) {
+		scores = append(scores, fieldScore{name, o})
+	}
+
+	if expected.Vendor != nil {
+		add("vendor", compare(normalize(*expected.Vendor), normalize(invoice.Vendor), func(a, b string) bool { return a == b }))
+	}
+	if expected.Date != nil {
+		got := ""
+		if !invoice.Date.IsZero() {
+			got = invoice.Date.Format(time.DateOnly)
+		}
+		add("date", compare(*expected.Date, got, func(a, b string) bool { return a == b }))
+	}
+	if expected.Total != nil {
+		add("total", compareAmount(*expected.Total, invoice.Total, tolerance))
+	}
+	if expected.Tax != nil {
+		add("tax", compareAmount(*expected.Tax, invoice.Tax, tolerance))
+	}
+	if expected.Categories != nil {
+		got := map[string]bool{}
+		for _, c := range invoice.Categories {
+			got[normalize(c)] = true
+		}
+		for _, c := range expected.Categories {
+			if got[normalize(c)] {
+				add("categories", correct)
+				delete(got, normalize(c))
+			} else {
+				add("categories", missing)
+			}
+		}
+		for range got {
+			add("categories", spurious)
+		}
+	}
+	if expected.ItemCount != nil {
+		add("itemCount", compare(*expected.ItemCount, len(invoice.Items), func(a, b int) bool { return a == b }))
+	}
+	return scores
+}
+
+// compare scores a field whose empty value is the zero value
+func compare[T comparable](expected, got T, equal func(a, b T) bool) outcome {
+	var zero T
+	switch {
+	case expected == zero && got == zero:
+		return absent
+	case expected == zero:
+		return spurious
+	case got == zero:
+		return missing
+	case equal(expected, got):
+		return correct
+	default:
+		return wrong
+	}
+}
+
+// compareAmount scores an amount, counting differences up to tolerance as correct
+func compareAmount(expected, got, tolerance decimal.Decimal) outcome {
+	switch {
+	case expected.IsZero() && got.IsZero():
+		return absent
+	case expected.IsZero():
+		return spurious
+	case got.IsZero():
+		return missing
+	case expected.Sub(got).Abs().LessThanOrEqual(tolerance):
+		return correct
+	default:
+		return wrong
+	}
+}
+
+// normalize folds case, punctuation and spacing, so "ACME, Inc." matches "Acme Inc"
+func normalize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(".,;:'\"()-&", r) {
+			return ' '
+		}
+		return r
+	}, strings.ToLower(s))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// summarize computes the metrics of one target from its results, in case order
+func summarize(target Target, cases []Case, results []Result, tolerance decimal.Decimal) TargetReport {
+	report := TargetReport{Target: target.String(), Documents: len(results)}
+
+	counts := map[string]*FieldMetrics{}
+	for _, name := range fieldNames {
+		counts[name] = &FieldMetrics{Field: name}
+	}
+	var latencies, totalErrors, taxErrors []float64
+	var totalWithin, taxWithin int
+
+	for i, result := range results {
+		if result.Model != "" {
+			report.Model = result.Model
+		}
+		if result.Error != "" {
+			report.Failures++
+		}
+		latencies = append(latencies, result.Duration)
+		report.PromptTokens += result.Usage.PromptTokens
+		report.CompletionTokens += result.Usage.CompletionTokens
+		report.Cost += result.Usage.EstimatedCost
+
+		exact := result.Error == ""
+		for _, field := range score(cases[i].Expected, result.Invoice, tolerance) {
+			m := counts[field.name]
+			switch field.outcome {
+			case correct:
+				m.Correct++
+			case missing:
+				m.Missing++
+			case wrong:
+				m.Wrong++
+			case spurious:
+				m.Spurious++
+			}
+			if field.outcome != correct && field.outcome != absent {
+				exact = false
+			}
+		}
+		if exact {
+			report.Exact++
+		}
+
+		if result.Invoice == nil {
+			continue
+		}
+		if e := amountError(cases[i].Expected.Total, result.Invoice.Total); e >= 0 {
+			totalErrors = append(totalErrors, e)
+			if e <= tolerance.InexactFloat64() {
+				totalWithin++
+			}
+		}
+		if e := amountError(cases[i].Expected.Tax, result.Invoice.Tax); e >= 0 {
+			taxErrors = append(taxErrors, e)
+			if e <= tolerance.InexactFloat64() {
+				taxWithin++
+			}
+		}
+	}
+
+	for _, name := range fieldNames {
+		m := counts[name]
+		m.Precision = ratio(m.Correct, m.Correct+m.Wrong+m.Spurious)
+		m.Recall = ratio(m.Correct, m.Correct+m.Wrong+m.Missing)
+		if m.Precision+m.Recall > 0 {
+			m.F1 = 2 * m.Precision * m.Recall / (m.Precision + m.Recall)
+		}
+		report.Fields = append(report.Fields, *m)
+	}
+
+	report.TotalError = AmountError{distribution(totalErrors), ratio(totalWithin, len(totalErrors))}
+	report.TaxError = AmountError{distribution(taxErrors), ratio(taxWithin, len(taxErrors))}
+	report.Latency = distribution(latencies)
+	if report.Documents > 0 {
+		report.CostPerDocument = report.Cost / float64(report.Documents)
+	}
+	return report
+}
+
+// amountError returns the absolute error of an extracted amount, or -1 when
+// the amount was not labeled, expected empty or not extracted
+func amountError(expected *decimal.Decimal, got decimal.Decimal) float64 {
+	if expected == nil || expected.IsZero() || got.IsZero() {
+		return -1
+	}
+	return expected.Sub(got).Abs().InexactFloat64()
+}
+
+// ratio returns n/d, or 0 for an empty denominator
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+// distribution summarizes samples with nearest-rank percentiles
+func distribution(samples []float64) Distribution {
+	d := Distribution{Samples: len(samples)}
+	if len(samples) == 0 {
+		return d
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	percentile := func(p float64) float64 {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+
+	var sum float64
+	for _, s := range sorted {
+		sum += s
+	}
+	d.Mean = sum / float64(len(sorted))
+	d.P50 = percentile(0.5)
+	d.P90 = percentile(0.9)
+	d.P95 = percentile(0.95)
+	d.Max = sorted[len(sorted)-1]
+	return d
+}
+
+// WriteText writes the report as tables for a terminal
+func WriteText(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, t := range report.Targets {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%s): %d documents, %d failed, %d exact\n\n", t.Target, t.Model, t.Documents, t.Failures, t.Exact)
+
+		fmt.Fprintln(tw, "field\tcorrect\twrong\tmissing\tspurious\tprecision\trecall\tf1")
+		for _, f := range t.Fields {
+			if f.Correct+f.Wrong+f.Missing+f.Spurious == 0 {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.3f\t%.3f\t%.3f\n",
+				f.Field, f.Correct, f.Wrong, f.Missing, f.Spurious, f.Precision, f.Recall, f.F1)
+		}
+		fmt.Fprintln(tw)
+
+		fmt.Fprintln(tw, "error\tsamples\tmean\tp50\tp90\tmax\twithin tolerance")
+		for _, a := range []struct {
+			name string
+			AmountError
+		}{{"total", t.TotalError}, {"tax", t.TaxError}} {
+			fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.1f%%\n",
+				a.name, a.Samples, a.Mean, a.P50, a.P90, a.Max, a.WithinTolerance*100)
+		}
+		fmt.Fprintln(tw)
+
+		fmt.Fprintf(tw, "latency\tmean %.2fs\tp50 %.2fs\tp95 %.2fs\tmax %.2fs\n", t.Latency.Mean, t.Latency.P50, t.Latency.P95, t.Latency.Max)
+		fmt.Fprintf(tw, "tokens\tprompt %d\tcompletion %d\n", t.PromptTokens, t.CompletionTokens)
+		fmt.Fprintf(tw, "cost\t$%.4f\t$%.5f per document\n", t.Cost, t.CostPerDocument)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,254 @@
+// Package exif reads the capture time and GPS position recorded in the EXIF
+// data of JPEG and TIFF photos, without decoding the image
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// ErrNoEXIF is returned for images without EXIF data, including formats
+// other than JPEG and TIFF
+var ErrNoEXIF = errors.New("no EXIF data")
+
+// TIFF tags read
+const (
+	tagDateTime           = 0x0132 // IFD0: last modification, used without DateTimeOriginal
+	tagExifIFD            = 0x8769 // IFD0: pointer to the Exif IFD
+	tagGPSIFD             = 0x8825 // IFD0: pointer to the GPS IFD
+	tagDateTimeOriginal   = 0x9003 // Exif IFD: capture time, camera clock
+	tagOffsetTimeOriginal = 0x9011 // Exif IFD: UTC offset of DateTimeOriginal, e.g. "+01:00"
+	tagGPSLatitudeRef     = 0x0001 // GPS IFD: "N" or "S"
+	tagGPSLatitude        = 0x0002 // GPS IFD: degrees, minutes, seconds
+	tagGPSLongitudeRef    = 0x0003 // GPS IFD: "E" or "W"
+	tagGPSLongitude       = 0x0004 // GPS IFD: degrees, minutes, seconds
+)
+
+// TIFF field types read, and their sizes
+const (
+	typeASCII    = 2
+	typeLong     = 4
+	typeRational = 5
+)
+
+var typeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// exifLayout is the EXIF date format
+const exifLayout = "2006:01:02 15:04:05"
+
+// Read returns the capture time and position of a photo. It returns nil
+// and ErrNoEXIF when the image has no EXIF data, and nil without an error
+// when the data records neither.
+func Read(image []byte) (*models.PhotoMetadata, error) {
+	tiff, err := tiffData(image)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newReader(tiff)
+	if err != nil {
+		return nil, err
+	}
+
+	ifd0, err := t.ifd(t.order.Uint32(tiff[4:]))
+	if err != nil {
+		return nil, err
+	}
+	var metadata models.PhotoMetadata
+
+	taken, zone := t.ascii(ifd0[tagDateTime]), ""
+	if offset, ok := t.pointer(ifd0[tagExifIFD]); ok {
+		exifIFD, err := t.ifd(offset)
+		if err != nil {
+			return nil, fmt.Errorf("exif IFD: %w", err)
+		}
+		if original := t.ascii(exifIFD[tagDateTimeOriginal]); original != "" {
+			taken = original
+			zone = t.ascii(exifIFD[tagOffsetTimeOriginal])
+		}
+	}
+	metadata.TakenAt = takenAt(taken, zone)
+
+	if offset, ok := t.pointer(ifd0[tagGPSIFD]); ok {
+		gps, err := t.ifd(offset)
+		if err != nil {
+			return nil, fmt.Errorf("GPS IFD: %w", err)
+		}
+		metadata.Location = t.location(gps)
+	}
+
+	if metadata.TakenAt == "" && metadata.Location == nil {
+		return nil, nil
+	}
+	return &metadata, nil
+}
+
+// tiffData returns the TIFF structure holding the EXIF data of a JPEG or
+// TIFF image
+func tiffData(image []byte) ([]byte, error) {
+	if bytes.HasPrefix(image, []byte("II*\x00")) || bytes.HasPrefix(image, []byte("MM\x00*")) {
+		return image, nil
+	}
+	if !bytes.HasPrefix(image, []byte{0xFF, 0xD8}) {
+		return nil, ErrNoEXIF
+	}
+
+	// JPEG segments up to the image data: marker, then a big-endian length
+	// that includes itself
+	for i := 2; i+4 <= len(image); {
+		if image[i] != 0xFF {
+			return nil, errors.New("invalid JPEG segment")
+		}
+		marker := image[i+1]
+		if marker == 0xDA || marker == 0xD9 { // Start of scan, end of image
+			break
+		}
+		length := int(binary.BigEndian.Uint16(image[i+2:]))
+		if length < 2 || i+2+length > len(image) {
+			return nil, errors.New("truncated JPEG segment")
+		}
+		payload := image[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return payload[6:], nil
+		}
+		i += 2 + length
+	}
+	return nil, ErrNoEXIF
+}
+
+// reader reads the fields of a TIFF structure
+type reader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newReader(data []byte) (*reader, error) {
+	if len(data) < 8 {
+		return nil, errors.New("truncated TIFF header")
+	}
+	switch string(data[:2]) {
+	case "II":
+		return &reader{data, binary.LittleEndian}, nil
+	case "MM":
+		return &reader{data, binary.BigEndian}, nil
+	}
+	return nil, errors.New("invalid TIFF byte order")
+}
+
+// field is a TIFF field with its value bytes
+type field struct {
+	typ   uint16
+	count int
+	value []byte
+}
+
+// ifd returns the fields of the image file directory at offset, by tag
+func (t *reader) ifd(offset uint32) (map[uint16]field, error) {
+	start := int(offset)
+	if start < 8 || start+2 > len(t.data) {
+		return nil, errors.New("IFD offset out of range")
+	}
+	n := int(t.order.Uint16(t.data[start:]))
+	if start+2+n*12 > len(t.data) {
+		return nil, errors.New("truncated IFD")
+	}
+
+	fields := make(map[uint16]field, n)
+	for i := 0; i < n; i++ {
+		entry := t.data[start+2+i*12:]
+		tag, typ := t.order.Uint16(entry), t.order.Uint16(entry[2:])
+		count := t.order.Uint32(entry[4:])
+		size, known := typeSize[typ]
+		if !known || uint64(count)*uint64(size) > uint64(len(t.data)) {
+			continue // Unknown type or bogus count
+		}
+		length := int(count) * size
+
+		// Values of up to 4 bytes are stored in the entry itself
+		value := entry[8:12]
+		if length > 4 {
+			at := int(t.order.Uint32(entry[8:]))
+			if at+length > len(t.data) {
+				continue
+			}
+			value = t.data[at : at+length]
+		}
+		fields[tag] = field{typ: typ, count: int(count), value: value[:min(length, len(value))]}
+	}
+	return fields, nil
+}
+
+// pointer returns the offset held by an IFD pointer field
+func (t *reader) pointer(f field) (uint32, bool) {
+	if f.typ != typeLong || f.count != 1 {
+		return 0, false
+	}
+	return t.order.Uint32(f.value), true
+}
+
+// ascii returns the text of an ASCII field, empty for other fields
+func (t *reader) ascii(f field) string {
+	if f.typ != typeASCII {
+		return ""
+	}
+	return string(bytes.TrimRight(f.value, "\x00 "))
+}
+
+// degrees returns the degrees of a GPS coordinate field made of three
+// rationals: degrees, minutes and seconds
+func (t *reader) degrees(f field) (float64, bool) {
+	if f.typ != typeRational || f.count != 3 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num, den := t.order.Uint32(f.value[i*8:]), t.order.Uint32(f.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
+
+// location returns the position recorded in a GPS IFD, nil when incomplete
+func (t *reader) location(gps map[uint16]field) *models.GeoPoint {
+	latitude, ok := t.degrees(gps[tagGPSLatitude])
+	if !ok {
+		return nil
+	}
+	longitude, ok := t.degrees(gps[tagGPSLongitude])
+	if !ok {
+		return nil
+	}
+	if t.ascii(gps[tagGPSLatitudeRef]) == "S" {
+		latitude = -latitude
+	}
+	if t.ascii(gps[tagGPSLongitudeRef]) == "W" {
+		longitude = -longitude
+	}
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil
+	}
+	return &models.GeoPoint{Latitude: latitude, Longitude: longitude}
+}
+
+// takenAt formats an EXIF date as RFC 3339 when its UTC offset is known, and
+// without a zone otherwise, as cameras record their local clock. Unreadable
+// and unset ("0000:00:00 00:00:00") dates are empty.
+func takenAt(date, offset string) string {
+	taken, err := time.Parse(exifLayout, date)
+	if err != nil {
+		return ""
+	}
+	if offset != "" {
+		if withZone, err := time.Parse(exifLayout+"-07:00", date+offset); err == nil {
+			return withZone.Format(time.RFC3339)
+		}
+	}
+	return taken.Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,224 @@
+package exif
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+// byteOrder writes TIFF structures in either byte order
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// entry is an IFD entry of a test TIFF structure
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // Encoded value
+}
+
+func asciiEntry(tag uint16, s string) entry {
+	return entry{tag, typeASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func dmsEntry(order byteOrder, tag uint16, d, m, s, sDen uint32) entry {
+	value := make([]byte, 24)
+	for i, part := range [][2]uint32{{d, 1}, {m, 1}, {s, sDen}} {
+		order.PutUint32(value[i*8:], part[0])
+		order.PutUint32(value[i*8+4:], part[1])
+	}
+	return entry{tag, typeRational, 3, value}
+}
+
+// buildTIFF lays out IFD0, then the Exif and GPS IFDs when given, each
+// followed by its out-of-line values. IFD0 gets the pointers to the others.
+func buildTIFF(order byteOrder, ifd0, exifIFD, gps []entry) []byte {
+	data := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(data, "II*\x00")
+	} else {
+		copy(data, "MM\x00*")
+	}
+	order.PutUint32(data[4:], 8)
+
+	size := func(entries []entry) int {
+		n := 2 + len(entries)*12 + 4
+		for _, e := range entries {
+			if len(e.value) > 4 {
+				n += len(e.value)
+			}
+		}
+		return n
+	}
+	pointers := 0
+	if exifIFD != nil {
+		pointers++
+	}
+	if gps != nil {
+		pointers++
+	}
+	next := uint32(8 + size(ifd0) + pointers*12)
+	if exifIFD != nil {
+		ifd0 = append(ifd0, entry{tagExifIFD, typeLong, 1, order.AppendUint32(nil, next)})
+		next += uint32(size(exifIFD))
+	}
+	if gps != nil {
+		ifd0 = append(ifd0, entry{tagGPSIFD, typeLong, 1, order.AppendUint32(nil, next)})
+	}
+
+	for _, entries := range [][]entry{ifd0, exifIFD, gps} {
+		if entries == nil {
+			continue
+		}
+		start := len(data)
+		values := start + 2 + len(entries)*12 + 4
+		data = order.AppendUint16(data, uint16(len(entries)))
+		var extra []byte
+		for _, e := range entries {
+			data = order.AppendUint16(data, e.tag)
+			data = order.AppendUint16(data, e.typ)
+			data = order.AppendUint32(data, e.count)
+			if len(e.value) > 4 {
+				data = order.AppendUint32(data, uint32(values+len(extra)))
+				extra = append(extra, e.value...)
+			} else {
+				inline := make([]byte, 4)
+				copy(inline, e.value)
+				data = append(data, inline...)
+			}
+		}
+		data = order.AppendUint32(data, 0) // No next IFD
+		data = append(data, extra...)
+	}
+	return data
+}
+
+// jpeg wraps a TIFF structure in the APP1 segment of a minimal JPEG
+func jpeg(tiff []byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	// A JFIF segment first, as cameras and editors often write
+	data = append(data, 0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	data = append(data, 0xFF, 0xE1)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(payload)+2))
+	data = append(data, payload...)
+	return append(data, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9)
+}
+
+func TestRead(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		madrid := []entry{
+			asciiEntry(tagGPSLatitudeRef, "N"),
+			dmsEntry(order, tagGPSLatitude, 40, 25, 1230, 100),
+			asciiEntry(tagGPSLongitudeRef, "W"),
+			dmsEntry(order, tagGPSLongitude, 3, 42, 3600, 100),
+		}
+
+		tests := []struct {
+			name     string
+			image    []byte
+			takenAt  string
+			location bool
+		}{
+			{
+				"original date with offset and GPS",
+				jpeg(buildTIFF(order,
+					[]entry{asciiEntry(tagDateTime, "2024:03:16 09:00:00")},
+					[]entry{asciiEntry(tagDateTimeOriginal, "2024:03:15 13:45:10"), asciiEntry(tagOffsetTimeOriginal, "+01:00")},
+					madrid,
+				)),
+				"2024-03-15T13:45:10+01:00", true,
+			},
+			{
+				"original date without offset",
+				jpeg(buildTIFF(order, nil, []entry{asciiEntry(tagDateTimeOriginal, "2024:03:15 13:45:10")}, nil)),
+				"2024-03-15T13:45:10", false,
+			},
+			{
+				"modification date only",
+				jpeg(buildTIFF(order, []entry{asciiEntry(tagDateTime, "2024:03:16 09:00:00")}, nil, nil)),
+				"2024-03-16T09:00:00", false,
+			},
+			{
+				"unset date",
+				jpeg(buildTIFF(order, nil, []entry{asciiEntry(tagDateTimeOriginal, "0000:00:00 00:00:00")}, madrid)),
+				"", true,
+			},
+			{
+				"TIFF",
+				buildTIFF(order, []entry{asciiEntry(tagDateTime, "2024:03:16 09:00:00")}, nil, madrid),
+				"2024-03-16T09:00:00", true,
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				metadata, err := Read(tt.image)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if metadata == nil {
+					t.Fatal("no metadata")
+				}
+				if metadata.TakenAt != tt.takenAt {
+					t.Errorf("TakenAt = %q, want %q", metadata.TakenAt, tt.takenAt)
+				}
+				if (metadata.Location != nil) != tt.location {
+					t.Fatalf("Location = %+v, want one: %v", metadata.Location, tt.location)
+				}
+				if tt.location {
+					// 40°25'12.3"N 3°42'36"W
+					if math.Abs(metadata.Location.Latitude-40.420083) > 1e-5 || math.Abs(metadata.Location.Longitude+3.71) > 1e-5 {
+						t.Errorf("Location = %+v", metadata.Location)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestReadWithoutMetadata(t *testing.T) {
+	order := binary.LittleEndian
+	metadata, err := Read(jpeg(buildTIFF(order, []entry{asciiEntry(0x010F, "Camera Maker")}, nil, nil)))
+	if err != nil || metadata != nil {
+		t.Errorf("no date or GPS: Read = %+v, %v, want nil, nil", metadata, err)
+	}
+
+	// A GPS IFD without coordinates, as phones write with location off
+	metadata, err = Read(jpeg(buildTIFF(order, nil, nil, []entry{asciiEntry(tagGPSLatitudeRef, "N")})))
+	if err != nil || metadata != nil {
+		t.Errorf("empty GPS IFD: Read = %+v, %v, want nil, nil", metadata, err)
+	}
+
+	for name, image := range map[string][]byte{
+		"PNG":          []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"),
+		"JPEG no EXIF": {0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9},
+		"empty":        nil,
+	} {
+		if _, err := Read(image); !errors.Is(err, ErrNoEXIF) {
+			t.Errorf("%s: err = %v, want ErrNoEXIF", name, err)
+		}
+	}
+}
+
+func TestReadRejectsCorruptData(t *testing.T) {
+	order := binary.BigEndian
+	valid := buildTIFF(order, nil, []entry{asciiEntry(tagDateTimeOriginal, "2024:03:15 13:45:10")}, nil)
+
+	outOfRange := append([]byte(nil), valid...)
+	order.PutUint32(outOfRange[4:], 1<<30)
+
+	tests := map[string][]byte{
+		"truncated JPEG segment": {0xFF, 0xD8, 0xFF, 0xE1, 0x40, 0x00, 'E'},
+		"truncated TIFF":         jpeg(valid[:20]),
+		"IFD out of range":       jpeg(outOfRange),
+	}
+	for name, image := range tests {
+		if _, err := Read(image); err == nil || errors.Is(err, ErrNoEXIF) {
+			t.Errorf("%s: err = %v, want a parse error", name, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// writeCSV writes t as CSV with a header row
+func writeCSV(w io.Writer, t table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(t.header))
+	for _, row := range t.rows {
+		for i, cell := range row {
+			record[i] = text(cell)
+			if _, ok := cell.(string); ok {
+				record[i] = escapeFormula(record[i])
+			}
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeFormula prefixes text that spreadsheets would run as a formula, such
+// as a vendor name extracted as "=HYPERLINK(...)"
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+// Package export writes stored invoices as flat files for bookkeeping
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+	FormatUBL  Format = "ubl" // UBL 2.1 Invoice XML, one document per invoice
+)
+
+// Layout selects what a row represents
+type Layout string
+
+const (
+	LayoutInvoices Layout = "invoices" // One row per invoice
+	LayoutItems    Layout = "items"    // One row per line item, repeating the invoice columns
+)
+
+// ContentType returns the MIME type of files in the format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatUBL, FormatFacturae:
+		return "application/xml"
+	case FormatFacturX:
+		return "application/pdf"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// table is an export before serialization. Cells are string, int, float64,
+// decimal.Decimal, bool or time.Time (a date); nil leaves a cell empty.
+type table struct {
+	header []string
+	rows   [][]interface{}
+}
+
+// Write writes records to w. Records without an invoice are skipped.
+func Write(w io.Writer, format Format, layout Layout, records []*models.StoredInvoice) error {
+	var t table
+	switch layout {
+	case LayoutInvoices, "":
+		t = invoiceTable(records)
+	case LayoutItems:
+		t = itemTable(records)
+	default:
+		return fmt.Errorf("unsupported layout: %s", layout)
+	}
+
+	switch format {
+	case FormatCSV, "":
+		return writeCSV(w, t)
+	case FormatXLSX:
+		return writeXLSX(w, t)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// invoiceColumns are the columns describing an invoice, shared by both layouts
+var invoiceColumns = []string{"Invoice ID", "Date", "Vendor", "Total", "Tax", "Net", "Categories"}
+
+// invoiceCells returns the cells of invoiceColumns
+func invoiceCells(record *models.StoredInvoice) []interface{} {
+	invoice := record.Invoice
+	var date, tax interface{}
+	if !invoice.Date.IsZero() {
+		date = invoice.Date
+	}
+	if !invoice.Tax.IsZero() {
+		tax = invoice.Tax
+	}
+	return []interface{}{
+		record.ID,
+		date,
+		invoice.Vendor,
+		invoice.Total,
+		tax,
+		invoice.Total.Sub(invoice.Tax),
+		strings.Join(invoice.Categories, "; "),
+	}
+}
+
+func invoiceTable(records []*models.StoredInvoice) table {
+	t := table{header: append(append([]string{}, invoiceColumns...),
+		"Items", "Confidence", "Filename", "AI Provider", "Model", "Processed At", "Store", "Store Address")}
+	for _, record := range records {
+		if record.Invoice == nil {
+			continue
+		}
+		row := append(invoiceCells(record),
+			len(record.Invoice.Items),
+			record.Invoice.Confidence,
+			record.Filename,
+			record.AIProvider,
+			record.Model,
+			record.CreatedAt.UTC().Format(time.RFC3339),
+		)
+		if store := record.Invoice.Store; store != nil {
+			row = append(row, store.Number, store.Address)
+		} else {
+			row = append(row, nil, nil)
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+func itemTable(records []*models.StoredInvoice) table {
+	t := table{header: append(append([]string{}, invoiceColumns...),
+		"Item", "Quantity", "Amount", "Taxed")}
+	for _, record := range records {
+		if record.Invoice == nil {
+			continue
+		}
+		// Invoices without items still get a row, so totals reconcile
+		if len(record.Invoice.Items) == 0 {
+			t.rows = append(t.rows, append(invoiceCells(record), nil, nil, nil, nil))
+			continue
+		}
+		for _, item := range record.Invoice.Items {
+			var quantity interface{}
+			if item.Quantity > 0 {
+				quantity = item.Quantity
+			}
+			t.rows = append(t.rows, append(invoiceCells(record), item.Name, quantity, item.Amount, item.IsTaxed))
+		}
+	}
+	return t
+}
+
+// text formats a cell for text formats
+func text(cell interface{}) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return fmt.Sprint(v)
+	case float64:
+		return fmt.Sprintf("%.2f", v)
+	case decimal.Decimal:
+		return v.StringFixed(2)
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case time.Time:
+		return v.Format(time.DateOnly)
+	}
+	return fmt.Sprint(cell)
+}
@@ -0,0 +1,370 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// FormatFacturae is Facturae 3.2.2 XML, the Spanish e-invoice format accepted by FACe
+const FormatFacturae Format = "facturae"
+
+// ErrMissingTaxID is returned when a Facturae party has no tax ID
+var ErrMissingTaxID = errors.New("facturae requires a tax ID")
+
+// Facturae namespaces
+const (
+	facturaeNS = "http://www.facturae.gob.es/formato/Versiones/Facturaev3_2_2.xml"
+	xmldsigNS  = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+// spanishVATRates are the Spanish VAT rates a computed rate snaps to
+var spanishVATRates = []float64{0, 4, 5, 10, 21}
+
+// alpha3 maps ISO 3166-1 alpha-2 codes to the alpha-3 codes Facturae uses
+var alpha3 = map[string]string{
+	"ES": "ESP", "PT": "PRT", "FR": "FRA", "DE": "DEU", "IT": "ITA", "NL": "NLD",
+	"BE": "BEL", "LU": "LUX", "IE": "IRL", "AT": "AUT", "PL": "POL", "SE": "SWE",
+	"DK": "DNK", "FI": "FIN", "GR": "GRC", "CZ": "CZE", "RO": "ROU", "HU": "HUN",
+	"BG": "BGR", "HR": "HRV", "SI": "SVN", "SK": "SVK", "EE": "EST", "LV": "LVA",
+	"LT": "LTU", "CY": "CYP", "MT": "MLT", "GB": "GBR", "CH": "CHE", "NO": "NOR",
+	"AD": "AND", "US": "USA", "MX": "MEX", "AR": "ARG", "CO": "COL", "CL": "CHL",
+	"PE": "PER", "MA": "MAR",
+}
+
+// euCountries are the alpha-2 codes of EU members, for the residence type
+var euCountries = map[string]bool{
+	"PT": true, "FR": true, "DE": true, "IT": true, "NL": true, "BE": true,
+	"LU": true, "IE": true, "AT": true, "PL": true, "SE": true, "DK": true,
+	"FI": true, "GR": true, "CZ": true, "RO": true, "HU": true, "BG": true,
+	"HR": true, "SI": true, "SK": true, "EE": true, "LV": true, "LT": true,
+	"CY": true, "MT": true,
+}
+
+type feFacturae struct {
+	XMLName  xml.Name    `xml:"fe:Facturae"`
+	FE       string      `xml:"xmlns:fe,attr"`
+	DS       string      `xml:"xmlns:ds,attr"`
+	Header   feHeader    `xml:"FileHeader"`
+	Parties  feParties   `xml:"Parties"`
+	Invoices []feInvoice `xml:"Invoices>Invoice"`
+}
+
+type feHeader struct {
+	SchemaVersion     string `xml:"SchemaVersion"`
+	Modality          string `xml:"Modality"`
+	IssuerType        string `xml:"InvoiceIssuerType"`
+	BatchIdentifier   string `xml:"Batch>BatchIdentifier"`
+	InvoicesCount     int    `xml:"Batch>InvoicesCount"`
+	TotalInvoices     string `xml:"Batch>TotalInvoicesAmount>TotalAmount"`
+	TotalOutstanding  string `xml:"Batch>TotalOutstandingAmount>TotalAmount"`
+	TotalExecutable   string `xml:"Batch>TotalExecutableAmount>TotalAmount"`
+	BatchCurrencyCode string `xml:"Batch>InvoiceCurrencyCode"`
+}
+
+type feParties struct {
+	Seller feParty `xml:"SellerParty"`
+	Buyer  feParty `xml:"BuyerParty"`
+}
+
+type feParty struct {
+	PersonType    string         `xml:"TaxIdentification>PersonTypeCode"`
+	ResidenceType string         `xml:"TaxIdentification>ResidenceTypeCode"`
+	TaxID         string         `xml:"TaxIdentification>TaxIdentificationNumber"`
+	Centres       *feCentres     `xml:"AdministrativeCentres,omitempty"`
+	LegalEntity   *feLegalEntity `xml:"LegalEntity,omitempty"`
+	Individual    *feIndividual  `xml:"Individual,omitempty"`
+}
+
+type feCentres struct {
+	Centres []feCentre `xml:"AdministrativeCentre"`
+}
+
+type feCentre struct {
+	Code     string `xml:"CentreCode"`
+	RoleType string `xml:"RoleTypeCode"`
+}
+
+type feLegalEntity struct {
+	CorporateName string    `xml:"CorporateName"`
+	Address       feAddress `xml:",any"`
+}
+
+type feIndividual struct {
+	Name         string    `xml:"Name"`
+	FirstSurname string    `xml:"FirstSurname"`
+	Address      feAddress `xml:",any"`
+}
+
+// feAddress is an AddressInSpain or OverseasAddress element
+type feAddress struct {
+	XMLName         xml.Name
+	Address         string `xml:"Address"`
+	PostCode        string `xml:"PostCode,omitempty"`
+	PostCodeAndTown string `xml:"PostCodeAndTown,omitempty"`
+	Town            string `xml:"Town,omitempty"`
+	Province        string `xml:"Province"`
+	CountryCode     string `xml:"CountryCode"`
+}
+
+type feInvoice struct {
+	Number       string        `xml:"InvoiceHeader>InvoiceNumber"`
+	DocumentType string        `xml:"InvoiceHeader>InvoiceDocumentType"`
+	Class        string        `xml:"InvoiceHeader>InvoiceClass"`
+	IssueDate    string        `xml:"InvoiceIssueData>IssueDate"`
+	Currency     string        `xml:"InvoiceIssueData>InvoiceCurrencyCode"`
+	TaxCurrency  string        `xml:"InvoiceIssueData>TaxCurrencyCode"`
+	Language     string        `xml:"InvoiceIssueData>LanguageName"`
+	Taxes        []feTax       `xml:"TaxesOutputs>Tax"`
+	Totals       feTotals      `xml:"InvoiceTotals"`
+	Lines        []feLine      `xml:"Items>InvoiceLine"`
+	Additional   *feAdditional `xml:"AdditionalData,omitempty"`
+}
+
+type feAdditional struct {
+	Information string `xml:"InvoiceAdditionalInformation"`
+}
+
+type feTax struct {
+	TypeCode    string `xml:"TaxTypeCode"`
+	Rate        string `xml:"TaxRate"`
+	TaxableBase string `xml:"TaxableBase>TotalAmount"`
+	TaxAmount   string `xml:"TaxAmount>TotalAmount"`
+}
+
+type feTotals struct {
+	Gross            string `xml:"TotalGrossAmount"`
+	GrossBeforeTaxes string `xml:"TotalGrossAmountBeforeTaxes"`
+	TaxOutputs       string `xml:"TotalTaxOutputs"`
+	TaxesWithheld    string `xml:"TotalTaxesWithheld"`
+	InvoiceTotal     string `xml:"InvoiceTotal"`
+	Outstanding      string `xml:"TotalOutstandingAmount"`
+	Executable       string `xml:"TotalExecutableAmount"`
+}
+
+type feLine struct {
+	Description string  `xml:"ItemDescription"`
+	Quantity    string  `xml:"Quantity"`
+	UnitPrice   string  `xml:"UnitPriceWithoutTax"`
+	TotalCost   string  `xml:"TotalCost"`
+	GrossAmount string  `xml:"GrossAmount"`
+	Taxes       []feTax `xml:"TaxesOutputs>Tax"`
+}
+
+// WriteFacturae writes a stored invoice as a Facturae 3.2.2 document. The
+// seller is config.Facturae.Seller (default: the vendor) and the buyer
+// config.Buyer with the FACe centres; both need a tax ID. The VAT rate is
+// derived from the extracted tax and applied to taxed items, whose amounts are
+// taken as net line totals. signer, if not nil, signs the document with XAdES.
+func WriteFacturae(ctx context.Context, w io.Writer, record *models.StoredInvoice, config models.ExportConfig, signer Signer) error {
+	invoice := record.Invoice
+
+	seller := config.Facturae.Seller
+	if seller.Name == "" {
+		seller = models.PartyConfig{Name: vendorName(invoice)}
+	}
+	sellerParty, err := facturaeParty(seller, nil)
+	if err != nil {
+		return fmt.Errorf("seller: %w", err)
+	}
+	buyerParty, err := facturaeParty(config.Buyer, facturaeCentres(config.Facturae))
+	if err != nil {
+		return fmt.Errorf("buyer: %w", err)
+	}
+
+	issued := invoice.Date
+	if issued.IsZero() {
+		issued = record.CreatedAt
+	}
+	net := invoice.Total.Sub(invoice.Tax)
+	rate := vatRate(net, invoice.Tax, spanishVATRates)
+	total := invoice.Total.StringFixed(2)
+
+	doc := feFacturae{
+		FE: facturaeNS,
+		DS: xmldsigNS,
+		Header: feHeader{
+			SchemaVersion:     "3.2.2",
+			Modality:          "I",  // Individual invoice
+			IssuerType:        "EM", // Issued by the seller
+			BatchIdentifier:   sellerParty.TaxID + record.ID,
+			InvoicesCount:     1,
+			TotalInvoices:     total,
+			TotalOutstanding:  total,
+			TotalExecutable:   total,
+			BatchCurrencyCode: config.Currency,
+		},
+		Parties: feParties{Seller: sellerParty, Buyer: buyerParty},
+	}
+
+	fe := feInvoice{
+		Number:       record.ID,
+		DocumentType: "FC", // Complete invoice
+		Class:        "OO", // Original
+		IssueDate:    issued.Format(time.DateOnly),
+		Currency:     config.Currency,
+		TaxCurrency:  config.Currency,
+		Language:     "es",
+		Taxes:        []feTax{vatTax(rate, net, invoice.Tax)},
+		Totals: feTotals{
+			Gross:            net.StringFixed(2),
+			GrossBeforeTaxes: net.StringFixed(2),
+			TaxOutputs:       invoice.Tax.StringFixed(2),
+			TaxesWithheld:    "0.00",
+			InvoiceTotal:     total,
+			Outstanding:      total,
+			Executable:       total,
+		},
+	}
+	if len(invoice.Categories) > 0 {
+		fe.Additional = &feAdditional{Information: "Categories: " + strings.Join(invoice.Categories, ", ")}
+	}
+
+	for _, item := range invoice.Items {
+		quantity := item.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+		lineRate := decimal.Zero
+		if item.IsTaxed {
+			lineRate = rate
+		}
+		amount := item.Amount.StringFixed(2)
+		fe.Lines = append(fe.Lines, feLine{
+			Description: item.Name,
+			Quantity:    fmt.Sprintf("%d.0", quantity),
+			UnitPrice:   item.Amount.Div(decimal.NewFromInt(int64(quantity))).StringFixed(6),
+			TotalCost:   amount,
+			GrossAmount: amount,
+			Taxes:       []feTax{vatTax(lineRate, item.Amount, item.Amount.Mul(lineRate).Div(decimal.NewFromInt(100)))},
+		})
+	}
+	if len(fe.Lines) == 0 {
+		fe.Lines = []feLine{{
+			Description: vendorName(invoice),
+			Quantity:    "1.0",
+			UnitPrice:   net.StringFixed(6),
+			TotalCost:   net.StringFixed(2),
+			GrossAmount: net.StringFixed(2),
+			Taxes:       []feTax{vatTax(rate, net, invoice.Tax)},
+		}}
+	}
+	doc.Invoices = []feInvoice{fe}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	buf.WriteString("\n")
+
+	data := buf.Bytes()
+	if signer != nil {
+		data, err = signer.Sign(ctx, data)
+		if err != nil {
+			return fmt.Errorf("failed to sign Facturae document: %w", err)
+		}
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// facturaeParty converts a configured party. Spanish tax IDs starting with a
+// letter other than X, Y, Z, K, L or M belong to legal entities.
+func facturaeParty(p models.PartyConfig, centres *feCentres) (feParty, error) {
+	taxID := strings.ToUpper(strings.ReplaceAll(p.TaxID, " ", ""))
+	if taxID == "" {
+		return feParty{}, ErrMissingTaxID
+	}
+	country := p.Country
+	if country == "" {
+		country = "ES"
+	}
+	code, ok := alpha3[country]
+	if !ok {
+		return feParty{}, fmt.Errorf("unsupported country %q", country)
+	}
+
+	party := feParty{TaxID: taxID, Centres: centres, ResidenceType: "R"}
+	if country != "ES" {
+		party.ResidenceType = "E"
+		if euCountries[country] {
+			party.ResidenceType = "U"
+		}
+	}
+
+	address := feAddress{Address: p.Address, Province: p.Province, CountryCode: code}
+	if country == "ES" {
+		address.XMLName = xml.Name{Local: "AddressInSpain"}
+		address.PostCode = p.PostalCode
+		address.Town = p.City
+	} else {
+		address.XMLName = xml.Name{Local: "OverseasAddress"}
+		address.PostCodeAndTown = strings.TrimSpace(p.PostalCode + " " + p.City)
+	}
+
+	nif := strings.TrimPrefix(taxID, "ES")
+	if nif != "" && nif[0] >= 'A' && nif[0] <= 'W' && !strings.ContainsRune("KLM", rune(nif[0])) {
+		party.PersonType = "J"
+		party.LegalEntity = &feLegalEntity{CorporateName: p.Name, Address: address}
+	} else {
+		party.PersonType = "F"
+		name, surname, _ := strings.Cut(p.Name, " ")
+		party.Individual = &feIndividual{Name: name, FirstSurname: surname, Address: address}
+	}
+	return party, nil
+}
+
+// facturaeCentres returns the FACe administrative centres of the buyer, or nil when none are configured
+func facturaeCentres(config models.FacturaeConfig) *feCentres {
+	var centres []feCentre
+	for _, c := range []struct{ code, role string }{
+		{config.AccountingOffice, "01"},
+		{config.ManagingBody, "02"},
+		{config.ProcessingUnit, "03"},
+	} {
+		if c.code != "" {
+			centres = append(centres, feCentre{Code: c.code, RoleType: c.role})
+		}
+	}
+	if len(centres) == 0 {
+		return nil
+	}
+	return &feCentres{Centres: centres}
+}
+
+// vatRate derives the VAT rate from the net amount and tax, snapping it to
+// the nearest standard rate when within half a point
+func vatRate(net, tax decimal.Decimal, standardRates []float64) decimal.Decimal {
+	if net.IsZero() || tax.IsZero() {
+		return decimal.Zero
+	}
+	rate := tax.Div(net).Mul(decimal.NewFromInt(100))
+	value, _ := rate.Float64()
+	for _, standard := range standardRates {
+		if value > standard-0.5 && value < standard+0.5 {
+			return decimal.NewFromFloat(standard)
+		}
+	}
+	return rate.Round(2)
+}
+
+// vatTax returns a Facturae VAT entry
+func vatTax(rate, base, amount decimal.Decimal) feTax {
+	return feTax{
+		TypeCode:    "01", // IVA
+		Rate:        rate.StringFixed(2),
+		TaxableBase: base.StringFixed(2),
+		TaxAmount:   amount.StringFixed(2),
+	}
+}
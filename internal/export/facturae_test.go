@@ -0,0 +1,219 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// facturaeResult is the part of a Facturae document the tests check
+type facturaeResult struct {
+	BatchID string `xml:"FileHeader>Batch>BatchIdentifier"`
+	Total   string `xml:"FileHeader>Batch>TotalInvoicesAmount>TotalAmount"`
+	Seller  struct {
+		PersonType string `xml:"TaxIdentification>PersonTypeCode"`
+		Residence  string `xml:"TaxIdentification>ResidenceTypeCode"`
+		TaxID      string `xml:"TaxIdentification>TaxIdentificationNumber"`
+		Corporate  string `xml:"LegalEntity>CorporateName"`
+	} `xml:"Parties>SellerParty"`
+	Buyer struct {
+		PersonType string   `xml:"TaxIdentification>PersonTypeCode"`
+		Residence  string   `xml:"TaxIdentification>ResidenceTypeCode"`
+		Corporate  string   `xml:"LegalEntity>CorporateName"`
+		Overseas   string   `xml:"LegalEntity>OverseasAddress>PostCodeAndTown"`
+		Country    string   `xml:"LegalEntity>OverseasAddress>CountryCode"`
+		Centres    []string `xml:"AdministrativeCentres>AdministrativeCentre>RoleTypeCode"`
+	} `xml:"Parties>BuyerParty"`
+	Invoice struct {
+		IssueDate string `xml:"InvoiceIssueData>IssueDate"`
+		Rate      string `xml:"TaxesOutputs>Tax>TaxRate"`
+		Base      string `xml:"TaxesOutputs>Tax>TaxableBase>TotalAmount"`
+		Total     string `xml:"InvoiceTotals>InvoiceTotal"`
+		Lines     []struct {
+			Description string `xml:"ItemDescription"`
+			Quantity    string `xml:"Quantity"`
+			UnitPrice   string `xml:"UnitPriceWithoutTax"`
+			Rate        string `xml:"TaxesOutputs>Tax>TaxRate"`
+		} `xml:"Items>InvoiceLine"`
+	} `xml:"Invoices>Invoice"`
+}
+
+func facturaeConfig() models.ExportConfig {
+	return models.ExportConfig{
+		Currency: "EUR",
+		Buyer:    models.PartyConfig{Name: "Dupont SARL", TaxID: "FR12345678901", City: "Paris", PostalCode: "75001", Country: "FR"},
+		Facturae: models.FacturaeConfig{
+			Seller:           models.PartyConfig{Name: "Café Central SL", TaxID: "ES B12345678", City: "Madrid", PostalCode: "28001", Province: "Madrid"},
+			AccountingOffice: "L01280796",
+			ProcessingUnit:   "L01280796",
+		},
+	}
+}
+
+func TestWriteFacturae(t *testing.T) {
+	record := testRecord(item("Menu", "80.00", 2), models.InvoiceItem{Name: "Water", Amount: decimal.RequireFromString("20.00")})
+
+	var buf bytes.Buffer
+	if err := WriteFacturae(context.Background(), &buf, record, facturaeConfig(), nil); err != nil {
+		t.Fatal(err)
+	}
+	var doc facturaeResult
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+
+	if doc.BatchID != "ESB12345678inv-1" || doc.Total != "121.00" {
+		t.Errorf("batch = %s, total %s", doc.BatchID, doc.Total)
+	}
+	if s := doc.Seller; s.PersonType != "J" || s.Residence != "R" || s.TaxID != "ESB12345678" || s.Corporate != "Café Central SL" {
+		t.Errorf("seller = %+v", s)
+	}
+	b := doc.Buyer
+	if b.PersonType != "J" || b.Residence != "U" || b.Corporate != "Dupont SARL" || b.Overseas != "75001 Paris" || b.Country != "FRA" {
+		t.Errorf("buyer = %+v", b)
+	}
+	if len(b.Centres) != 2 || b.Centres[0] != "01" || b.Centres[1] != "03" {
+		t.Errorf("centre roles = %v, want [01 03]", b.Centres)
+	}
+
+	if inv := doc.Invoice; inv.IssueDate != "2024-03-05" || inv.Rate != "21.00" || inv.Base != "100.00" || inv.Total != "121.00" {
+		t.Errorf("invoice = %+v", inv)
+	}
+	want := []string{"Menu 2.0 40.000000 21.00", "Water 1.0 20.000000 0.00"}
+	if len(doc.Invoice.Lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(doc.Invoice.Lines), len(want))
+	}
+	for i, line := range doc.Invoice.Lines {
+		if got := line.Description + " " + line.Quantity + " " + line.UnitPrice + " " + line.Rate; got != want[i] {
+			t.Errorf("line %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestFacturaeParty(t *testing.T) {
+	tests := []struct {
+		name       string
+		party      models.PartyConfig
+		personType string
+		residence  string
+		address    string
+	}{
+		{"spanish company", models.PartyConfig{Name: "Acme SL", TaxID: "B12345678"}, "J", "R", "AddressInSpain"},
+		{"spanish person", models.PartyConfig{Name: "Ana García", TaxID: "12345678Z"}, "F", "R", "AddressInSpain"},
+		{"foreign resident", models.PartyConfig{Name: "John Smith", TaxID: "X1234567L"}, "F", "R", "AddressInSpain"},
+		{"eu company", models.PartyConfig{Name: "Acme GmbH", TaxID: "DE123456789", Country: "DE"}, "J", "U", "OverseasAddress"},
+		{"non-eu", models.PartyConfig{Name: "Acme Inc", TaxID: "US12-3456789", Country: "US"}, "J", "E", "OverseasAddress"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			party, err := facturaeParty(tt.party, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			address := xml.Name{}
+			if party.LegalEntity != nil {
+				address = party.LegalEntity.Address.XMLName
+			} else if party.Individual != nil {
+				address = party.Individual.Address.XMLName
+			}
+			if party.PersonType != tt.personType || party.ResidenceType != tt.residence || address.Local != tt.address {
+				t.Errorf("party = %s %s %s, want %s %s %s", party.PersonType, party.ResidenceType, address.Local, tt.personType, tt.residence, tt.address)
+			}
+		})
+	}
+}
+
+func TestWriteFacturaeRequiresTaxIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  func(*models.ExportConfig)
+		wantErr string
+	}{
+		{"default seller", func(c *models.ExportConfig) { c.Facturae.Seller = models.PartyConfig{} }, "seller"},
+		{"buyer", func(c *models.ExportConfig) { c.Buyer.TaxID = "" }, "buyer"},
+		{"unsupported country", func(c *models.ExportConfig) { c.Buyer.Country = "ZZ" }, "unsupported country"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := facturaeConfig()
+			tt.config(&config)
+			err := WriteFacturae(context.Background(), &bytes.Buffer{}, testRecord(), config, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// stubSigner wraps documents in a marker, or fails with err
+type stubSigner struct{ err error }
+
+func (s stubSigner) Sign(ctx context.Context, doc []byte) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append(doc, []byte("<!-- signed -->")...), nil
+}
+
+func TestWriteFacturaeSigns(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFacturae(context.Background(), &buf, testRecord(), facturaeConfig(), stubSigner{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "<!-- signed -->") {
+		t.Error("document was not passed through the signer")
+	}
+
+	buf.Reset()
+	err := WriteFacturae(context.Background(), &buf, testRecord(), facturaeConfig(), stubSigner{err: errors.New("no certificate")})
+	if err == nil || !strings.Contains(err.Error(), "no certificate") {
+		t.Fatalf("err = %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Error("unsigned document written after the signer failed")
+	}
+}
+
+func TestVATRate(t *testing.T) {
+	tests := []struct {
+		net, tax string
+		rates    []float64
+		want     string
+	}{
+		{"100", "21", spanishVATRates, "21"},
+		{"100", "20.8", spanishVATRates, "21"}, // Rounded amounts
+		{"100", "10", spanishVATRates, "10"},
+		{"100", "15", spanishVATRates, "15"}, // No standard rate nearby
+		{"100", "19", dachVATRates, "19"},
+		{"100", "0", spanishVATRates, "0"},
+		{"0", "5", spanishVATRates, "0"},
+	}
+	for _, tt := range tests {
+		got := vatRate(decimal.RequireFromString(tt.net), decimal.RequireFromString(tt.tax), tt.rates)
+		if !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("vatRate(%s, %s) = %s, want %s", tt.net, tt.tax, got, tt.want)
+		}
+	}
+}
+
+func TestCommandSigner(t *testing.T) {
+	if NewCommandSigner(nil, 0) != nil {
+		t.Error("NewCommandSigner without a command should return nil")
+	}
+
+	signed, err := NewCommandSigner([]string{"cat"}, 0).Sign(context.Background(), []byte("<doc/>"))
+	if err != nil || string(signed) != "<doc/>" {
+		t.Fatalf("Sign = %q, %v", signed, err)
+	}
+
+	_, err = NewCommandSigner([]string{"sh", "-c", "echo bad key >&2; exit 1"}, 0).Sign(context.Background(), []byte("<doc/>"))
+	if err == nil || !strings.Contains(err.Error(), "bad key") {
+		t.Errorf("err = %v, want the command's stderr", err)
+	}
+}
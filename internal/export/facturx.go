@@ -0,0 +1,343 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// FormatFacturX is a Factur-X / ZUGFeRD hybrid invoice: a PDF with the
+// invoice as embedded Cross Industry Invoice XML
+const FormatFacturX Format = "facturx"
+
+// facturXProfile is the Factur-X profile of generated invoices
+const facturXProfile = "urn:cen.eu:en16931:2017#compliant#urn:factur-x.eu:1p0:basic"
+
+// facturXFilename is the name Factur-X readers look up the embedded XML by
+const facturXFilename = "factur-x.xml"
+
+// dachVATRates are the German and Austrian VAT rates a computed rate snaps to
+var dachVATRates = []float64{0, 7, 10, 13, 19, 20}
+
+// CII namespaces
+const (
+	ciiRSMNS = "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+	ciiRAMNS = "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+	ciiUDTNS = "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100"
+)
+
+// ciiInvoice is a Cross Industry Invoice. Field order follows the schema.
+type ciiInvoice struct {
+	XMLName xml.Name `xml:"rsm:CrossIndustryInvoice"`
+	RSM     string   `xml:"xmlns:rsm,attr"`
+	RAM     string   `xml:"xmlns:ram,attr"`
+	UDT     string   `xml:"xmlns:udt,attr"`
+
+	Profile     string         `xml:"rsm:ExchangedDocumentContext>ram:GuidelineSpecifiedDocumentContextParameter>ram:ID"`
+	ID          string         `xml:"rsm:ExchangedDocument>ram:ID"`
+	TypeCode    string         `xml:"rsm:ExchangedDocument>ram:TypeCode"`
+	IssueDate   ciiDate        `xml:"rsm:ExchangedDocument>ram:IssueDateTime>udt:DateTimeString"`
+	Notes       []ciiNote      `xml:"rsm:ExchangedDocument>ram:IncludedNote,omitempty"`
+	Transaction ciiTransaction `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type ciiNote struct {
+	Content string `xml:"ram:Content"`
+}
+
+type ciiDate struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ciiTransaction struct {
+	Lines      []ciiLine     `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Seller     ciiParty      `xml:"ram:ApplicableHeaderTradeAgreement>ram:SellerTradeParty"`
+	Buyer      ciiParty      `xml:"ram:ApplicableHeaderTradeAgreement>ram:BuyerTradeParty"`
+	Delivery   struct{}      `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement ciiSettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type ciiLine struct {
+	LineID   string      `xml:"ram:AssociatedDocumentLineDocument>ram:LineID"`
+	Name     string      `xml:"ram:SpecifiedTradeProduct>ram:Name"`
+	Price    string      `xml:"ram:SpecifiedLineTradeAgreement>ram:NetPriceProductTradePrice>ram:ChargeAmount"`
+	Quantity ciiQuantity `xml:"ram:SpecifiedLineTradeDelivery>ram:BilledQuantity"`
+	Tax      ciiLineTax  `xml:"ram:SpecifiedLineTradeSettlement>ram:ApplicableTradeTax"`
+	Total    string      `xml:"ram:SpecifiedLineTradeSettlement>ram:SpecifiedTradeSettlementLineMonetarySummation>ram:LineTotalAmount"`
+}
+
+type ciiQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiLineTax struct {
+	TypeCode     string `xml:"ram:TypeCode"`
+	CategoryCode string `xml:"ram:CategoryCode"`
+	Rate         string `xml:"ram:RateApplicablePercent"`
+}
+
+type ciiParty struct {
+	Name    string      `xml:"ram:Name"`
+	Address *ciiAddress `xml:"ram:PostalTradeAddress,omitempty"`
+	TaxID   *ciiTaxID   `xml:"ram:SpecifiedTaxRegistration>ram:ID,omitempty"`
+}
+
+type ciiAddress struct {
+	PostalCode string `xml:"ram:PostcodeCode,omitempty"`
+	Street     string `xml:"ram:LineOne,omitempty"`
+	City       string `xml:"ram:CityName,omitempty"`
+	Country    string `xml:"ram:CountryID"`
+}
+
+type ciiTaxID struct {
+	Scheme string `xml:"schemeID,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ciiSettlement struct {
+	Currency string       `xml:"ram:InvoiceCurrencyCode"`
+	Tax      ciiHeaderTax `xml:"ram:ApplicableTradeTax"`
+	Totals   ciiTotals    `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+}
+
+type ciiHeaderTax struct {
+	Amount       string `xml:"ram:CalculatedAmount"`
+	TypeCode     string `xml:"ram:TypeCode"`
+	Basis        string `xml:"ram:BasisAmount"`
+	CategoryCode string `xml:"ram:CategoryCode"`
+	Rate         string `xml:"ram:RateApplicablePercent"`
+}
+
+type ciiTotals struct {
+	LineTotal  string    `xml:"ram:LineTotalAmount"`
+	TaxBasis   string    `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotal   ublAmount `xml:"ram:TaxTotalAmount"`
+	GrandTotal string    `xml:"ram:GrandTotalAmount"`
+	DuePayable string    `xml:"ram:DuePayableAmount"`
+}
+
+// WriteFacturX writes a stored invoice as a Factur-X (ZUGFeRD 2) PDF with
+// BASIC profile XML. The vendor is the seller and config.Buyer the buyer. The
+// original upload, if not nil, is attached as the invoice's source.
+func WriteFacturX(w io.Writer, record *models.StoredInvoice, config models.ExportConfig, original []byte) error {
+	if config.Buyer.Name == "" {
+		return fmt.Errorf("factur-x requires a buyer name")
+	}
+
+	data, err := facturXML(record, config)
+	if err != nil {
+		return err
+	}
+
+	issued := record.Invoice.Date
+	if issued.IsZero() {
+		issued = record.CreatedAt
+	}
+	doc := pdfDocument{
+		Title:    "Invoice " + record.ID,
+		Author:   vendorName(record.Invoice),
+		Created:  issued,
+		Lines:    facturXSummary(record, config),
+		Metadata: facturXMetadata,
+		Attachments: []pdfAttachment{{
+			Name:         facturXFilename,
+			Description:  "Factur-X invoice",
+			ContentType:  "text/xml",
+			Relationship: "Data",
+			Data:         data,
+		}},
+	}
+	if original != nil {
+		doc.Attachments = append(doc.Attachments, pdfAttachment{
+			Name:         originalFilename(record),
+			Description:  "Original invoice",
+			ContentType:  record.ContentType,
+			Relationship: "Source",
+			Data:         original,
+		})
+	}
+	return writePDF(w, doc)
+}
+
+// facturXML returns the CII XML of a stored invoice. Items become lines when
+// they add up to the net amount, which the profile requires; otherwise the
+// invoice gets a single line for its net amount.
+func facturXML(record *models.StoredInvoice, config models.ExportConfig) ([]byte, error) {
+	invoice := record.Invoice
+	net := invoice.Total.Sub(invoice.Tax)
+	rate := vatRate(net, invoice.Tax, dachVATRates)
+	category := "S" // Standard rate
+	if rate.IsZero() {
+		category = "Z" // Zero rated
+	}
+	lineTax := ciiLineTax{TypeCode: "VAT", CategoryCode: category, Rate: rate.StringFixed(2)}
+
+	issued := invoice.Date
+	if issued.IsZero() {
+		issued = record.CreatedAt
+	}
+
+	doc := ciiInvoice{
+		RSM:       ciiRSMNS,
+		RAM:       ciiRAMNS,
+		UDT:       ciiUDTNS,
+		Profile:   facturXProfile,
+		ID:        record.ID,
+		TypeCode:  "380", // Commercial invoice
+		IssueDate: ciiDate{Format: "102", Value: issued.Format("20060102")},
+	}
+	for _, category := range invoice.Categories {
+		doc.Notes = append(doc.Notes, ciiNote{Content: "Category: " + category})
+	}
+
+	country := config.Buyer.Country
+	if country == "" {
+		country = "DE"
+	}
+	doc.Transaction.Seller = ciiParty{Name: vendorName(invoice), Address: &ciiAddress{Country: country}}
+	doc.Transaction.Buyer = ciiParty{Name: config.Buyer.Name}
+	if config.Buyer.Country != "" {
+		doc.Transaction.Buyer.Address = &ciiAddress{
+			PostalCode: config.Buyer.PostalCode,
+			Street:     config.Buyer.Address,
+			City:       config.Buyer.City,
+			Country:    config.Buyer.Country,
+		}
+	}
+	if config.Buyer.TaxID != "" {
+		doc.Transaction.Buyer.TaxID = &ciiTaxID{Scheme: "VA", Value: config.Buyer.TaxID}
+	}
+
+	sum := decimal.Zero
+	for _, item := range invoice.Items {
+		sum = sum.Add(item.Amount)
+	}
+	if len(invoice.Items) > 0 && sum.Equal(net) {
+		for i, item := range invoice.Items {
+			quantity := item.Quantity
+			if quantity < 1 {
+				quantity = 1
+			}
+			doc.Transaction.Lines = append(doc.Transaction.Lines, ciiLine{
+				LineID:   strconv.Itoa(i + 1),
+				Name:     item.Name,
+				Price:    item.Amount.Div(decimal.NewFromInt(int64(quantity))).StringFixed(4),
+				Quantity: ciiQuantity{UnitCode: "C62", Value: strconv.Itoa(quantity)}, // C62 = unit
+				Tax:      lineTax,
+				Total:    item.Amount.StringFixed(2),
+			})
+		}
+	} else {
+		doc.Transaction.Lines = []ciiLine{{
+			LineID:   "1",
+			Name:     vendorName(invoice),
+			Price:    net.StringFixed(4),
+			Quantity: ciiQuantity{UnitCode: "C62", Value: "1"},
+			Tax:      lineTax,
+			Total:    net.StringFixed(2),
+		}}
+	}
+
+	doc.Transaction.Settlement = ciiSettlement{
+		Currency: config.Currency,
+		Tax: ciiHeaderTax{
+			Amount:       invoice.Tax.StringFixed(2),
+			TypeCode:     "VAT",
+			Basis:        net.StringFixed(2),
+			CategoryCode: category,
+			Rate:         rate.StringFixed(2),
+		},
+		Totals: ciiTotals{
+			LineTotal:  net.StringFixed(2),
+			TaxBasis:   net.StringFixed(2),
+			TaxTotal:   ublAmount{Currency: config.Currency, Value: invoice.Tax.StringFixed(2)},
+			GrandTotal: invoice.Total.StringFixed(2),
+			DuePayable: invoice.Total.StringFixed(2),
+		},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// facturXSummary returns the text lines of the human-readable PDF page
+func facturXSummary(record *models.StoredInvoice, config models.ExportConfig) []string {
+	invoice := record.Invoice
+	lines := []string{
+		"Invoice " + record.ID,
+		"",
+		"Seller: " + vendorName(invoice),
+		"Buyer: " + config.Buyer.Name,
+	}
+	if !invoice.Date.IsZero() {
+		lines = append(lines, "Date: "+invoice.Date.Format(time.DateOnly))
+	}
+	lines = append(lines, "")
+	for _, item := range invoice.Items {
+		quantity := ""
+		if item.Quantity > 1 {
+			quantity = fmt.Sprintf("%d x ", item.Quantity)
+		}
+		lines = append(lines, fmt.Sprintf("%s%s  %s %s", quantity, item.Name, item.Amount.StringFixed(2), config.Currency))
+	}
+	if len(invoice.Items) > 0 {
+		lines = append(lines, "")
+	}
+	return append(lines,
+		fmt.Sprintf("Net: %s %s", invoice.Total.Sub(invoice.Tax).StringFixed(2), config.Currency),
+		fmt.Sprintf("Tax: %s %s", invoice.Tax.StringFixed(2), config.Currency),
+		fmt.Sprintf("Total: %s %s", invoice.Total.StringFixed(2), config.Currency),
+	)
+}
+
+// originalFilename names the attached original upload
+func originalFilename(record *models.StoredInvoice) string {
+	if record.Filename != "" {
+		return record.Filename
+	}
+	switch record.ContentType {
+	case "application/pdf":
+		return "original.pdf"
+	case "image/png":
+		return "original.png"
+	}
+	return "original.jpg"
+}
+
+// facturXMetadata is the Factur-X part of the XMP metadata, including the
+// PDF/A extension schema that declares it
+const facturXMetadata = `<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+<fx:DocumentType>INVOICE</fx:DocumentType>
+<fx:DocumentFileName>factur-x.xml</fx:DocumentFileName>
+<fx:Version>1.0</fx:Version>
+<fx:ConformanceLevel>BASIC</fx:ConformanceLevel>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas><rdf:Bag><rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>fx</pdfaSchema:prefix>
+<pdfaSchema:property><rdf:Seq>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>DocumentFileName</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The name of the embedded XML document</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>DocumentType</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The type of the hybrid document in capital letters, e.g. INVOICE or ORDER</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>Version</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The actual version of the standard applying to the embedded XML document</pdfaProperty:description></rdf:li>
+<rdf:li rdf:parseType="Resource"><pdfaProperty:name>ConformanceLevel</pdfaProperty:name><pdfaProperty:valueType>Text</pdfaProperty:valueType><pdfaProperty:category>external</pdfaProperty:category><pdfaProperty:description>The conformance level of the embedded XML document</pdfaProperty:description></rdf:li>
+</rdf:Seq></pdfaSchema:property>
+</rdf:li></rdf:Bag></pdfaExtension:schemas>
+</rdf:Description>
+`
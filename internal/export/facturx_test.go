@@ -0,0 +1,180 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// ciiResult is the part of a Cross Industry Invoice the tests check
+type ciiResult struct {
+	Profile   string `xml:"ExchangedDocumentContext>GuidelineSpecifiedDocumentContextParameter>ID"`
+	ID        string `xml:"ExchangedDocument>ID"`
+	IssueDate string `xml:"ExchangedDocument>IssueDateTime>DateTimeString"`
+	Lines     []struct {
+		Name     string `xml:"SpecifiedTradeProduct>Name"`
+		Quantity string `xml:"SpecifiedLineTradeDelivery>BilledQuantity"`
+		Total    string `xml:"SpecifiedLineTradeSettlement>SpecifiedTradeSettlementLineMonetarySummation>LineTotalAmount"`
+	} `xml:"SupplyChainTradeTransaction>IncludedSupplyChainTradeLineItem"`
+	Seller     string `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeAgreement>SellerTradeParty>Name"`
+	BuyerTaxID string `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeAgreement>BuyerTradeParty>SpecifiedTaxRegistration>ID"`
+	Tax        struct {
+		Amount   string `xml:"CalculatedAmount"`
+		Basis    string `xml:"BasisAmount"`
+		Category string `xml:"CategoryCode"`
+		Rate     string `xml:"RateApplicablePercent"`
+	} `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement>ApplicableTradeTax"`
+	GrandTotal string `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement>SpecifiedTradeSettlementHeaderMonetarySummation>GrandTotalAmount"`
+}
+
+func facturXConfig() models.ExportConfig {
+	return models.ExportConfig{Currency: "EUR", Buyer: models.PartyConfig{Name: "Acme GmbH", TaxID: "DE123456789", Country: "DE"}}
+}
+
+func zeroRated(record *models.StoredInvoice) *models.StoredInvoice {
+	record.Invoice.Tax = decimal.Zero
+	return record
+}
+
+func TestFacturXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   *models.StoredInvoice
+		category string
+		rate     string
+		lines    []string // Name, quantity and total of each line
+	}{
+		{
+			name:     "items adding up to the net amount",
+			record:   testRecord(item("Coffee", "6.00", 3), item("Lunch", "94.00", 0)),
+			category: "S", rate: "21.00",
+			lines: []string{"Coffee 3 6.00", "Lunch 1 94.00"},
+		},
+		{
+			name:     "items not adding up",
+			record:   testRecord(item("Coffee", "6.00", 3)),
+			category: "S", rate: "21.00",
+			lines: []string{"Café Central 1 100.00"},
+		},
+		{
+			name:     "zero rated",
+			record:   zeroRated(testRecord()),
+			category: "Z", rate: "0.00",
+			lines: []string{"Café Central 1 121.00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := facturXML(tt.record, facturXConfig())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc ciiResult
+			if err := xml.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("invalid XML: %v\n%s", err, data)
+			}
+			if doc.Profile != facturXProfile || doc.ID != "inv-1" || doc.IssueDate != "20240305" || doc.Seller != "Café Central" || doc.BuyerTaxID != "DE123456789" {
+				t.Errorf("header = %+v", doc)
+			}
+			if doc.Tax.Category != tt.category || doc.Tax.Rate != tt.rate || doc.GrandTotal != "121.00" {
+				t.Errorf("tax = %+v, grand total %s", doc.Tax, doc.GrandTotal)
+			}
+			if len(doc.Lines) != len(tt.lines) {
+				t.Fatalf("got %d lines, want %d", len(doc.Lines), len(tt.lines))
+			}
+			for i, line := range doc.Lines {
+				if got := line.Name + " " + line.Quantity + " " + line.Total; got != tt.lines[i] {
+					t.Errorf("line %d = %q, want %q", i, got, tt.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFacturX(t *testing.T) {
+	record := testRecord(item("Coffee", "6.00", 3), item("Lunch", "94.00", 0))
+	original := []byte("\xff\xd8original jpeg\xff\xd9")
+
+	var buf bytes.Buffer
+	if err := WriteFacturX(&buf, record, facturXConfig(), original); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+
+	data, _ := facturXML(record, facturXConfig())
+	for _, want := range [][]byte{
+		[]byte("%PDF-1.7\n"),
+		data,
+		original,
+		[]byte("/F (factur-x.xml)"),
+		[]byte("/AFRelationship /Data"),
+		[]byte("/F (receipt.jpg)"),
+		[]byte("/AFRelationship /Source"),
+		[]byte("<fx:ConformanceLevel>BASIC</fx:ConformanceLevel>"),
+		[]byte("<pdfaid:part>3</pdfaid:part>"),
+	} {
+		if !bytes.Contains(pdf, want) {
+			t.Errorf("PDF lacks %q", want)
+		}
+	}
+	checkXref(t, pdf)
+}
+
+func TestWriteFacturXRequiresBuyer(t *testing.T) {
+	if err := WriteFacturX(&bytes.Buffer{}, testRecord(), models.ExportConfig{Currency: "EUR"}, nil); err == nil {
+		t.Fatal("expected an error without a buyer")
+	}
+}
+
+// checkXref verifies that startxref points at the xref table and that every
+// entry points at its object
+func checkXref(t *testing.T, pdf []byte) {
+	t.Helper()
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("no startxref trailer")
+	}
+	start, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(pdf[start:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", start)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[start:], -1)
+	if len(entries) == 0 {
+		t.Fatal("empty xref table")
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[offset:offset+10])
+		}
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Invoice (copy)", `(Invoice \(copy\))`},
+		{`C:\path`, `(C:\\path)`},
+		{"Café 12 €", `(Caf\351 12 \200)`},
+		{"日本", "(??)"},
+	}
+	for _, tt := range tests {
+		if got := pdfString(tt.in); got != tt.want {
+			t.Errorf("pdfString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPDFName(t *testing.T) {
+	if got := pdfName("application/pdf"); got != "/application#2Fpdf" {
+		t.Errorf("pdfName = %s", got)
+	}
+}
@@ -0,0 +1,229 @@
+package export
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// pdfDocument is a single-page text PDF with embedded files, structured
+// after PDF/A-3b: XMP metadata, associated files (/AF) and a document ID
+type pdfDocument struct {
+	Title       string
+	Author      string
+	Created     time.Time
+	Lines       []string // Page text, one line each
+	Metadata    string   // Extra rdf:Description elements of the XMP metadata
+	Attachments []pdfAttachment
+}
+
+// pdfAttachment is an embedded file associated with the document
+type pdfAttachment struct {
+	Name         string
+	Description  string
+	ContentType  string
+	Relationship string // AFRelationship: Data, Source, Alternative, ...
+	Data         []byte
+}
+
+// pdfWriter numbers and writes objects, recording their offsets for the xref table
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// reserve allocates an object number to be written later
+func (p *pdfWriter) reserve() int {
+	p.offsets = append(p.offsets, 0)
+	return len(p.offsets)
+}
+
+// write writes object n
+func (p *pdfWriter) write(n int, body string) {
+	p.offsets[n-1] = p.buf.Len()
+	fmt.Fprintf(&p.buf, "%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+// add writes a new object and returns its number
+func (p *pdfWriter) add(body string) int {
+	n := p.reserve()
+	p.write(n, body)
+	return n
+}
+
+// addStream writes a new stream object; dict holds the entries besides /Length
+func (p *pdfWriter) addStream(dict string, data []byte) int {
+	n := p.reserve()
+	p.offsets[n-1] = p.buf.Len()
+	if dict != "" {
+		dict += " "
+	}
+	fmt.Fprintf(&p.buf, "%d 0 obj\n<< %s/Length %d >>\nstream\n", n, dict, len(data))
+	p.buf.Write(data)
+	p.buf.WriteString("\nendstream\nendobj\n")
+	return n
+}
+
+// writePDF writes doc to w
+func writePDF(w io.Writer, doc pdfDocument) error {
+	p := &pdfWriter{}
+	// The binary comment marks the file as binary for transfer tools
+	p.buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	catalog := p.reserve()
+	pages := p.reserve()
+
+	font := p.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	var content bytes.Buffer
+	content.WriteString("BT\n/F1 11 Tf\n14 TL\n56 786 Td\n")
+	for i, line := range doc.Lines {
+		if i == 0 {
+			// The first line is a heading
+			fmt.Fprintf(&content, "/F1 16 Tf\n%s Tj\n/F1 11 Tf\nT*\n", pdfString(line))
+			continue
+		}
+		fmt.Fprintf(&content, "%s '\n", pdfString(line))
+	}
+	content.WriteString("ET\n")
+	contents := p.addStream("", content.Bytes())
+	page := p.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>", pages, font, contents))
+	p.write(pages, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", page))
+
+	date := pdfDate(doc.Created)
+	var specs []string
+	names := map[string]int{}
+	for _, a := range doc.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		file := p.addStream(fmt.Sprintf("/Type /EmbeddedFile /Subtype %s /Params << /ModDate %s /Size %d >>",
+			pdfName(contentType), pdfString(date), len(a.Data)), a.Data)
+		spec := p.add(fmt.Sprintf("<< /Type /Filespec /F %s /UF %s /Desc %s /AFRelationship /%s /EF << /F %d 0 R /UF %d 0 R >> >>",
+			pdfString(a.Name), pdfString(a.Name), pdfString(a.Description), a.Relationship, file, file))
+		specs = append(specs, fmt.Sprintf("%d 0 R", spec))
+		names[a.Name] = spec
+	}
+
+	metadata := p.addStream("/Type /Metadata /Subtype /XML", []byte(xmpMetadata(doc)))
+	info := p.add(fmt.Sprintf("<< /Title %s /Author %s /Producer (invoice-ocr-service) /CreationDate %s /ModDate %s >>",
+		pdfString(doc.Title), pdfString(doc.Author), pdfString(date), pdfString(date)))
+
+	catalogDict := fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R /Metadata %d 0 R /Lang (en)", pages, metadata)
+	if len(specs) > 0 {
+		// The name tree must be sorted by key
+		keys := make([]string, 0, len(names))
+		for name := range names {
+			keys = append(keys, name)
+		}
+		sort.Strings(keys)
+		var tree []string
+		for _, name := range keys {
+			tree = append(tree, fmt.Sprintf("%s %d 0 R", pdfString(name), names[name]))
+		}
+		catalogDict += fmt.Sprintf(" /Names << /EmbeddedFiles << /Names [%s] >> >> /AF [%s] /PageMode /UseAttachments",
+			strings.Join(tree, " "), strings.Join(specs, " "))
+	}
+	p.write(catalog, catalogDict+" >>")
+
+	xref := p.buf.Len()
+	fmt.Fprintf(&p.buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		fmt.Fprintf(&p.buf, "%010d 00000 n \n", offset)
+	}
+	id := fmt.Sprintf("<%x>", md5.Sum(p.buf.Bytes()))
+	fmt.Fprintf(&p.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R /ID [%s %s] >>\nstartxref\n%d\n%%%%EOF\n",
+		len(p.offsets)+1, catalog, info, id, id, xref)
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+// xmpMetadata returns the XMP packet of doc, declaring PDF/A-3b conformance
+func xmpMetadata(doc pdfDocument) string {
+	created := doc.Created.UTC().Format(time.RFC3339)
+	var b strings.Builder
+	b.WriteString(`<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+<pdfaid:part>3</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">`)
+	b.WriteString(xmlText(doc.Title))
+	b.WriteString(`</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>`)
+	b.WriteString(xmlText(doc.Author))
+	b.WriteString(`</rdf:li></rdf:Seq></dc:creator>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+<xmp:CreateDate>` + created + `</xmp:CreateDate>
+<xmp:ModifyDate>` + created + `</xmp:ModifyDate>
+<pdf:Producer>invoice-ocr-service</pdf:Producer>
+</rdf:Description>
+`)
+	b.WriteString(doc.Metadata)
+	b.WriteString(`</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+	return b.String()
+}
+
+// pdfString encodes s as a literal string in WinAnsiEncoding, which covers
+// Latin-1 and the euro sign; other characters become '?'
+func pdfString(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '€':
+			b.WriteString(`\200`)
+		case r == utf8.RuneError || r < 0x20 || r > 0xff || (r >= 0x7f && r < 0xa0):
+			b.WriteByte('?')
+		case r >= 0x80:
+			fmt.Fprintf(&b, `\%03o`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// pdfName encodes s as a name, e.g. application/pdf as /application#2Fpdf
+func pdfName(s string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("#/()<>[]{}%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// pdfDate formats t as a PDF date, e.g. D:20240131120000Z
+func pdfDate(t time.Time) string {
+	return "D:" + t.UTC().Format("20060102150405") + "Z"
+}
+
+// xmlText escapes s for XML character data
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Signer signs an XML document, e.g. with an XAdES enveloped signature
+type Signer interface {
+	Sign(ctx context.Context, doc []byte) ([]byte, error)
+}
+
+// CommandSigner signs documents with an external command (autofirma,
+// xades-signer, a script around a PKCS#12 certificate, ...). The document is
+// written to its stdin and the signed document read from its stdout.
+type CommandSigner struct {
+	Command []string
+	Timeout time.Duration
+}
+
+// NewCommandSigner creates a signer running command, or returns nil when command is empty
+func NewCommandSigner(command []string, timeout time.Duration) *CommandSigner {
+	if len(command) == 0 {
+		return nil
+	}
+	return &CommandSigner{Command: command, Timeout: timeout}
+}
+
+// Sign runs the command on doc
+func (s *CommandSigner) Sign(ctx context.Context, doc []byte) ([]byte, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(doc)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", s.Command[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", s.Command[0], err)
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("%s: no output", s.Command[0])
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,215 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// UBL namespaces
+const (
+	ublInvoiceNS = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublCACNS     = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublCBCNS     = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// ublInvoice is a UBL 2.1 Invoice. Field order follows the schema.
+type ublInvoice struct {
+	XMLName xml.Name `xml:"Invoice"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	CAC     string   `xml:"xmlns:cac,attr"`
+	CBC     string   `xml:"xmlns:cbc,attr"`
+
+	UBLVersionID         string      `xml:"cbc:UBLVersionID"`
+	CustomizationID      string      `xml:"cbc:CustomizationID"`
+	ID                   string      `xml:"cbc:ID"`
+	IssueDate            string      `xml:"cbc:IssueDate"`
+	InvoiceTypeCode      string      `xml:"cbc:InvoiceTypeCode"`
+	Notes                []string    `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode string      `xml:"cbc:DocumentCurrencyCode"`
+	Supplier             ublParty    `xml:"cac:AccountingSupplierParty>cac:Party"`
+	Customer             *ublParty   `xml:"cac:AccountingCustomerParty>cac:Party,omitempty"`
+	TaxTotal             ublTaxTotal `xml:"cac:TaxTotal"`
+	MonetaryTotal        ublTotals   `xml:"cac:LegalMonetaryTotal"`
+	Lines                []ublLine   `xml:"cac:InvoiceLine"`
+}
+
+type ublParty struct {
+	Name      string        `xml:"cac:PartyName>cbc:Name"`
+	Address   *ublAddress   `xml:"cac:PostalAddress,omitempty"`
+	TaxScheme *ublTaxScheme `xml:"cac:PartyTaxScheme,omitempty"`
+}
+
+type ublTaxScheme struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	Scheme    string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+type ublAddress struct {
+	Street      string `xml:"cbc:StreetName,omitempty"`
+	City        string `xml:"cbc:CityName,omitempty"`
+	PostalCode  string `xml:"cbc:PostalZone,omitempty"`
+	Province    string `xml:"cbc:CountrySubentity,omitempty"`
+	CountryCode string `xml:"cac:Country>cbc:IdentificationCode,omitempty"`
+}
+
+type ublAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount ublAmount `xml:"cbc:TaxAmount"`
+}
+
+type ublTotals struct {
+	LineExtension ublAmount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusive  ublAmount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusive  ublAmount `xml:"cbc:TaxInclusiveAmount"`
+	Payable       ublAmount `xml:"cbc:PayableAmount"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublLine struct {
+	ID            string      `xml:"cbc:ID"`
+	Quantity      ublQuantity `xml:"cbc:InvoicedQuantity"`
+	LineExtension ublAmount   `xml:"cbc:LineExtensionAmount"`
+	ItemName      string      `xml:"cac:Item>cbc:Name"`
+	Price         ublAmount   `xml:"cac:Price>cbc:PriceAmount"`
+}
+
+// WriteUBL writes a stored invoice as a UBL 2.1 Invoice. The vendor is the
+// supplier and config.Buyer, when set, the customer. Item amounts are line
+// totals; an invoice without items gets one line for its net amount.
+func WriteUBL(w io.Writer, record *models.StoredInvoice, config models.ExportConfig) error {
+	invoice := record.Invoice
+	currency := config.Currency
+	amount := func(d decimal.Decimal) ublAmount {
+		return ublAmount{Currency: currency, Value: d.StringFixed(2)}
+	}
+
+	issued := invoice.Date
+	if issued.IsZero() {
+		issued = record.CreatedAt
+	}
+
+	doc := ublInvoice{
+		XMLNS:                ublInvoiceNS,
+		CAC:                  ublCACNS,
+		CBC:                  ublCBCNS,
+		UBLVersionID:         "2.1",
+		CustomizationID:      "urn:cen.eu:en16931:2017",
+		ID:                   record.ID,
+		IssueDate:            issued.Format(time.DateOnly),
+		InvoiceTypeCode:      "380", // Commercial invoice
+		DocumentCurrencyCode: currency,
+		Supplier:             ublParty{Name: vendorName(invoice)},
+		Customer:             partyUBL(config.Buyer),
+		TaxTotal:             ublTaxTotal{TaxAmount: amount(invoice.Tax)},
+	}
+	for _, category := range invoice.Categories {
+		doc.Notes = append(doc.Notes, "Category: "+category)
+	}
+
+	net := invoice.Total.Sub(invoice.Tax)
+	lines := decimal.Zero
+	for i, item := range invoice.Items {
+		quantity := item.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+		lines = lines.Add(item.Amount)
+		doc.Lines = append(doc.Lines, ublLine{
+			ID:            strconv.Itoa(i + 1),
+			Quantity:      ublQuantity{UnitCode: "C62", Value: strconv.Itoa(quantity)}, // C62 = unit
+			LineExtension: amount(item.Amount),
+			ItemName:      item.Name,
+			Price:         amount(item.Amount.Div(decimal.NewFromInt(int64(quantity)))),
+		})
+	}
+	if len(doc.Lines) == 0 {
+		lines = net
+		doc.Lines = []ublLine{{
+			ID:            "1",
+			Quantity:      ublQuantity{UnitCode: "C62", Value: "1"},
+			LineExtension: amount(net),
+			ItemName:      vendorName(invoice),
+			Price:         amount(net),
+		}}
+	}
+
+	doc.MonetaryTotal = ublTotals{
+		LineExtension: amount(lines),
+		TaxExclusive:  amount(net),
+		TaxInclusive:  amount(invoice.Total),
+		Payable:       amount(invoice.Total),
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteUBLArchive writes a zip file of UBL documents named <id>.xml. Records
+// without an invoice are skipped.
+func WriteUBLArchive(w io.Writer, records []*models.StoredInvoice, config models.ExportConfig) error {
+	archive := zip.NewWriter(w)
+	for _, record := range records {
+		if record.Invoice == nil {
+			continue
+		}
+		f, err := archive.Create(record.ID + ".xml")
+		if err != nil {
+			return err
+		}
+		if err := WriteUBL(f, record, config); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// partyUBL converts a configured party, or returns nil when it has no name
+func partyUBL(p models.PartyConfig) *ublParty {
+	if p.Name == "" {
+		return nil
+	}
+	party := &ublParty{Name: p.Name}
+	if p.TaxID != "" {
+		party.TaxScheme = &ublTaxScheme{CompanyID: p.TaxID, Scheme: "VAT"}
+	}
+	if p.Address != "" || p.City != "" || p.PostalCode != "" || p.Country != "" {
+		party.Address = &ublAddress{
+			Street:      p.Address,
+			City:        p.City,
+			PostalCode:  p.PostalCode,
+			Province:    p.Province,
+			CountryCode: p.Country,
+		}
+	}
+	return party
+}
+
+// vendorName returns the vendor of an invoice, with the extraction prompt's placeholder when empty
+func vendorName(invoice *models.Invoice) string {
+	if invoice.Vendor == "" {
+		return "Unknown Vendor"
+	}
+	return invoice.Vendor
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// testRecord returns a stored invoice of 121.00 with 21.00 VAT
+func testRecord(items ...models.InvoiceItem) *models.StoredInvoice {
+	return &models.StoredInvoice{
+		ID:          "inv-1",
+		Filename:    "receipt.jpg",
+		ContentType: "image/jpeg",
+		CreatedAt:   time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC),
+		Invoice: &models.Invoice{
+			Vendor:     "Café Central",
+			Date:       time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+			Total:      decimal.RequireFromString("121.00"),
+			Tax:        decimal.RequireFromString("21.00"),
+			Items:      items,
+			Categories: []string{"Meals"},
+		},
+	}
+}
+
+func item(name, amount string, quantity int) models.InvoiceItem {
+	return models.InvoiceItem{Name: name, Amount: decimal.RequireFromString(amount), Quantity: quantity, IsTaxed: true}
+}
+
+// ublResult is the part of a UBL document the tests check
+type ublResult struct {
+	ID        string   `xml:"ID"`
+	IssueDate string   `xml:"IssueDate"`
+	Currency  string   `xml:"DocumentCurrencyCode"`
+	Notes     []string `xml:"Note"`
+	Supplier  string   `xml:"AccountingSupplierParty>Party>PartyName>Name"`
+	Customer  *struct {
+		Name      string `xml:"PartyName>Name"`
+		CompanyID string `xml:"PartyTaxScheme>CompanyID"`
+		Country   string `xml:"PostalAddress>Country>IdentificationCode"`
+	} `xml:"AccountingCustomerParty>Party"`
+	Tax    string `xml:"TaxTotal>TaxAmount"`
+	Totals struct {
+		LineExtension string `xml:"LineExtensionAmount"`
+		TaxExclusive  string `xml:"TaxExclusiveAmount"`
+		Payable       string `xml:"PayableAmount"`
+	} `xml:"LegalMonetaryTotal"`
+	Lines []struct {
+		ID       string `xml:"ID"`
+		Quantity string `xml:"InvoicedQuantity"`
+		Amount   string `xml:"LineExtensionAmount"`
+		Name     string `xml:"Item>Name"`
+		Price    string `xml:"Price>PriceAmount"`
+	} `xml:"InvoiceLine"`
+}
+
+func TestWriteUBL(t *testing.T) {
+	tests := []struct {
+		name      string
+		record    *models.StoredInvoice
+		buyer     models.PartyConfig
+		lines     []string // Name, quantity, amount and price of each line
+		lineTotal string
+	}{
+		{
+			name:      "items",
+			record:    testRecord(item("Coffee", "6.00", 3), item("Lunch", "94.00", 0)),
+			buyer:     models.PartyConfig{Name: "Acme SL", TaxID: "ESB12345678", Country: "ES"},
+			lines:     []string{"Coffee 3 6.00 2.00", "Lunch 1 94.00 94.00"},
+			lineTotal: "100.00",
+		},
+		{
+			name:      "no items",
+			record:    testRecord(),
+			lines:     []string{"Café Central 1 100.00 100.00"},
+			lineTotal: "100.00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteUBL(&buf, tt.record, models.ExportConfig{Currency: "EUR", Buyer: tt.buyer})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var doc ublResult
+			if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+				t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+			}
+			if doc.ID != "inv-1" || doc.IssueDate != "2024-03-05" || doc.Currency != "EUR" || doc.Supplier != "Café Central" {
+				t.Errorf("header = %+v", doc)
+			}
+			if len(doc.Notes) != 1 || doc.Notes[0] != "Category: Meals" {
+				t.Errorf("notes = %v", doc.Notes)
+			}
+			if doc.Tax != "21.00" || doc.Totals.TaxExclusive != "100.00" || doc.Totals.Payable != "121.00" || doc.Totals.LineExtension != tt.lineTotal {
+				t.Errorf("totals = tax %s, %+v", doc.Tax, doc.Totals)
+			}
+			if (doc.Customer != nil) != (tt.buyer.Name != "") {
+				t.Fatalf("customer = %+v, want buyer %q", doc.Customer, tt.buyer.Name)
+			}
+			if doc.Customer != nil && (doc.Customer.Name != tt.buyer.Name || doc.Customer.CompanyID != tt.buyer.TaxID || doc.Customer.Country != tt.buyer.Country) {
+				t.Errorf("customer = %+v", doc.Customer)
+			}
+
+			if len(doc.Lines) != len(tt.lines) {
+				t.Fatalf("got %d lines, want %d", len(doc.Lines), len(tt.lines))
+			}
+			for i, line := range doc.Lines {
+				got := line.Name + " " + line.Quantity + " " + line.Amount + " " + line.Price
+				if got != tt.lines[i] {
+					t.Errorf("line %s = %q, want %q", line.ID, got, tt.lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteUBLFallsBackToCreationDate(t *testing.T) {
+	record := testRecord()
+	record.Invoice.Date = time.Time{}
+	record.Invoice.Vendor = ""
+
+	var buf bytes.Buffer
+	if err := WriteUBL(&buf, record, models.ExportConfig{Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+	var doc ublResult
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.IssueDate != "2024-03-10" || doc.Supplier != "Unknown Vendor" {
+		t.Errorf("issue date %s, supplier %q", doc.IssueDate, doc.Supplier)
+	}
+}
+
+func TestWriteUBLArchive(t *testing.T) {
+	other := testRecord()
+	other.ID = "inv-2"
+	empty := &models.StoredInvoice{ID: "failed"}
+
+	var buf bytes.Buffer
+	if err := WriteUBLArchive(&buf, []*models.StoredInvoice{testRecord(), empty, other}, models.ExportConfig{Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range archive.File {
+		names = append(names, f.Name)
+	}
+	if len(names) != 2 || names[0] != "inv-1.xml" || names[1] != "inv-2.xml" {
+		t.Errorf("archive files = %v", names)
+	}
+}
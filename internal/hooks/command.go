@@ -0,0 +1,176 @@
+// Package hooks runs pipeline hooks implemented as external commands, so
+// deployments can add validation, enrichment or routing in any language
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+)
+
+// Hook stages
+const (
+	PreOCR      = "pre_ocr"
+	PostOCR     = "post_ocr"
+	PostExtract = "post_extract"
+)
+
+// defaultTimeout bounds a command hook without a configured timeout
+const defaultTimeout = 30 * time.Second
+
+// Command is a hook running an external command once per stage it is
+// configured for. A JSON request is written to its stdin and a JSON response
+// read from its stdout; see the README for the protocol.
+type Command struct {
+	name    string
+	command []string
+	stages  map[string]bool
+	timeout time.Duration
+}
+
+// request is written to the command's stdin
+type request struct {
+	Stage    string          `json:"stage"`
+	Image    []byte          `json:"image,omitempty"` // Base64 in JSON
+	Text     string          `json:"text,omitempty"`
+	Invoice  *models.Invoice `json:"invoice,omitempty"`
+	Provider string          `json:"provider,omitempty"`
+	Model    string          `json:"model,omitempty"`
+	Rule     string          `json:"rule,omitempty"`
+}
+
+// response is read from the command's stdout. Empty output or omitted
+// fields keep the input unchanged.
+type response struct {
+	Image   []byte          `json:"image,omitempty"`
+	Text    *string         `json:"text,omitempty"`
+	Invoice json.RawMessage `json:"invoice,omitempty"` // Merged into the invoice
+	Reject  string          `json:"reject,omitempty"`  // Reason to refuse the document
+}
+
+// NewCommand creates a hook from its config
+func NewCommand(config models.HookConfig) *Command {
+	c := &Command{
+		name:    config.Name,
+		command: config.Command,
+		stages:  make(map[string]bool),
+		timeout: config.Timeout,
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	for _, stage := range config.Stages {
+		c.stages[stage] = true
+	}
+	return c
+}
+
+// FromConfig creates the hooks of configs, in order
+func FromConfig(configs []models.HookConfig) []pipeline.Hook {
+	hooks := make([]pipeline.Hook, 0, len(configs))
+	for _, config := range configs {
+		hooks = append(hooks, NewCommand(config))
+	}
+	return hooks
+}
+
+// Name implements pipeline.Hook
+func (c *Command) Name() string {
+	return c.name
+}
+
+// PreOCR implements pipeline.PreOCRHook
+func (c *Command) PreOCR(ctx context.Context, image []byte) ([]byte, error) {
+	if !c.stages[PreOCR] {
+		return nil, nil
+	}
+	resp, err := c.run(ctx, request{Stage: PreOCR, Image: image})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Image, nil
+}
+
+// PostOCR implements pipeline.PostOCRHook
+func (c *Command) PostOCR(ctx context.Context, text string) (string, error) {
+	if !c.stages[PostOCR] {
+		return text, nil
+	}
+	resp, err := c.run(ctx, request{Stage: PostOCR, Text: text})
+	if err != nil {
+		return "", err
+	}
+	if resp.Text != nil {
+		return *resp.Text, nil
+	}
+	return text, nil
+}
+
+// PostExtract implements pipeline.PostExtractHook
+func (c *Command) PostExtract(ctx context.Context, invoice *models.Invoice, stats pipeline.Stats) error {
+	if !c.stages[PostExtract] {
+		return nil
+	}
+	resp, err := c.run(ctx, request{
+		Stage:    PostExtract,
+		Text:     stats.RawText,
+		Invoice:  invoice,
+		Provider: stats.Provider,
+		Model:    stats.Model,
+		Rule:     stats.Rule,
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Invoice) > 0 {
+		if err := json.Unmarshal(resp.Invoice, invoice); err != nil {
+			return fmt.Errorf("invalid invoice in response: %w", err)
+		}
+	}
+	return nil
+}
+
+// run executes the command with req and decodes its response
+func (c *Command) run(ctx context.Context, req request) (*response, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = fmt.Errorf("%w: %v", ctxErr, err)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", c.command[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", c.command[0], err)
+	}
+
+	resp := &response{}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return resp, nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", c.command[0], err)
+	}
+	if resp.Reject != "" {
+		return nil, fmt.Errorf("%w: %s", pipeline.ErrRejected, resp.Reject)
+	}
+	return resp, nil
+}
@@ -0,0 +1,117 @@
+// Package imagedata converts images between raw bytes, base64 and data URIs,
+// as exchanged with AI providers and JSON clients
+package imagedata
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrEmpty is returned when there is no image data to decode
+var ErrEmpty = errors.New("empty image data")
+
+// Decode returns the bytes and MIME type of an image given as a data URI
+// ("data:image/png;base64,...") or as bare base64. Standard and URL-safe
+// alphabets are accepted, with or without padding, and whitespace such as the
+// line breaks of `base64` output is ignored. The MIME type comes from the data
+// URI, or is sniffed from the bytes.
+func Decode(s string) ([]byte, string, error) {
+	mimeType := ""
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(s), "data:"); ok {
+		header, payload, found := strings.Cut(rest, ",")
+		if !found {
+			return nil, "", errors.New("invalid data URI: missing comma")
+		}
+		params := strings.Split(header, ";")
+		if params[len(params)-1] != "base64" {
+			return nil, "", errors.New("invalid data URI: only base64 payloads are supported")
+		}
+		mimeType = strings.ToLower(params[0])
+		s = payload
+	}
+
+	data, err := decodeBase64(s)
+	if err != nil {
+		return nil, "", err
+	}
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = DetectMIMEType(data)
+	}
+	return data, mimeType, nil
+}
+
+// decodeBase64 decodes standard or URL-safe base64, padded or not
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nil, ErrEmpty
+	}
+
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(s, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	data, err := encoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	return data, nil
+}
+
+// Encode returns data as a data URI. An empty mimeType is sniffed from data.
+func Encode(data []byte, mimeType string) string {
+	if mimeType == "" {
+		mimeType = DetectMIMEType(data)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// Normalize re-encodes an image given as a data URI or bare base64 as a data
+// URI with standard base64, the form providers accept
+func Normalize(s string) (string, error) {
+	data, mimeType, err := Decode(s)
+	if err != nil {
+		return "", err
+	}
+	return Encode(data, mimeType), nil
+}
+
+// DetectMIMEType sniffs the type of an image or PDF from its leading bytes.
+// Unknown data is reported as application/octet-stream.
+func DetectMIMEType(data []byte) string {
+	// Formats net/http does not sniff
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && isHEIFBrand(string(data[8:12])):
+		return "image/heic"
+	}
+
+	mimeType := http.DetectContentType(data)
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	if strings.HasPrefix(mimeType, "image/") || mimeType == "application/pdf" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// isHEIFBrand reports whether an ISO media brand is HEIC or HEIF
+func isHEIFBrand(brand string) bool {
+	switch brand {
+	case "heic", "heix", "heim", "heis", "mif1", "msf1":
+		return true
+	}
+	return false
+}
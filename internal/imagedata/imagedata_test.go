@@ -0,0 +1,203 @@
+package imagedata
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// pngImage returns a PNG of width × height pixels
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	data := pngImage(t, 2, 3)
+	std := base64.StdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name     string
+		input    string
+		mimeType string
+		err      bool
+	}{
+		{"bare base64", std, "image/png", false},
+		{"data URI", "data:image/png;base64," + std, "image/png", false},
+		{"data URI type wins", "data:image/webp;base64," + std, "image/webp", false},
+		{"data URI type is lowercased", "data:IMAGE/PNG;base64," + std, "image/png", false},
+		{"octet-stream is sniffed", "data:application/octet-stream;base64," + std, "image/png", false},
+		{"data URI parameters", "data:image/png;name=receipt.png;base64," + std, "image/png", false},
+		{"surrounding whitespace", "  \n" + std + "\n", "image/png", false},
+		{"missing comma", "data:image/png;base64", "", true},
+		{"not base64", "data:image/png," + std, "", true},
+		{"empty", "", "", true},
+		{"garbage", "not an image!", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, mimeType, err := Decode(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Decode = %d bytes, %q, want an error", len(got), mimeType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) || mimeType != tt.mimeType {
+				t.Errorf("Decode = %d bytes, %q, want %d bytes, %q", len(got), mimeType, len(data), tt.mimeType)
+			}
+		})
+	}
+}
+
+func TestDecodeBase64(t *testing.T) {
+	// 0xfb 0xff sets the bits that differ between the two alphabets
+	data := []byte{0xfb, 0xff, 0xbf, 'i', 'n', 'v'}
+
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"standard", base64.StdEncoding.EncodeToString(data), nil},
+		{"URL-safe", base64.URLEncoding.EncodeToString(data), nil},
+		{"missing padding", base64.RawStdEncoding.EncodeToString(data[:5]), nil},
+		{"URL-safe without padding", base64.RawURLEncoding.EncodeToString(data[:4]), nil},
+		{"line breaks", "+/+/\r\naW52\n", nil},
+		{"only whitespace", " \n\t", ErrEmpty},
+		{"empty", "", ErrEmpty},
+		{"garbage", "%%%%", errors.New("invalid base64")},
+		{"truncated", "+/+/a", errors.New("invalid base64")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeBase64(tt.input)
+			switch {
+			case tt.err == ErrEmpty:
+				if !errors.Is(err, ErrEmpty) {
+					t.Errorf("err = %v, want ErrEmpty", err)
+				}
+			case tt.err != nil:
+				if err == nil || !strings.HasPrefix(err.Error(), tt.err.Error()) {
+					t.Errorf("err = %v, want %v", err, tt.err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !bytes.HasPrefix(data, got) || len(got) == 0:
+				t.Errorf("decodeBase64 = %x, want a prefix of %x", got, data)
+			}
+		})
+	}
+}
+
+func TestDetectMIMEType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"png", pngImage(t, 1, 1), "image/png"},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "image/jpeg"},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), "image/gif"},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"tiff little endian", []byte("II*\x00\x08\x00\x00\x00"), "image/tiff"},
+		{"tiff big endian", []byte("MM\x00*\x00\x00\x00\x08"), "image/tiff"},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic"},
+		{"heif", []byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00"), "image/heic"},
+		{"mp4 is not an image", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x00\x00"), "application/octet-stream"},
+		{"text", []byte("TOTAL 12,50"), "application/octet-stream"},
+		{"empty", nil, "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectMIMEType(tt.data); got != tt.want {
+				t.Errorf("DetectMIMEType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	data := pngImage(t, 2, 2)
+	want := "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{"bare base64", base64.StdEncoding.EncodeToString(data), false},
+		{"URL-safe without padding", base64.RawURLEncoding.EncodeToString(data), false},
+		{"data URI", want, false},
+		{"wrapped lines", wrap(base64.StdEncoding.EncodeToString(data), 76), false},
+		{"garbage", "data:image/png;base64,%%%", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Normalize = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("Normalize = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		want     string
+	}{
+		{"sniffed", pngImage(t, 3, 1), "", "image/png"},
+		{"given", pngImage(t, 3, 1), "image/x-custom", "image/x-custom"},
+		{"pdf", []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"), "", "application/pdf"},
+		{"unknown", []byte{0x00, 0x01, 0x02}, "", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := Encode(tt.data, tt.mimeType)
+			if !strings.HasPrefix(uri, "data:"+tt.want+";base64,") {
+				t.Fatalf("Encode = %q, want a %s data URI", uri, tt.want)
+			}
+			data, mimeType, err := Decode(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.data) || mimeType != tt.want {
+				t.Errorf("Decode(Encode) = %x, %q, want %x, %q", data, mimeType, tt.data, tt.want)
+			}
+		})
+	}
+}
+
+// wrap breaks s into lines of n characters, as the base64 tool does
+func wrap(s string, n int) string {
+	var lines []string
+	for len(s) > n {
+		lines = append(lines, s[:n])
+		s = s[n:]
+	}
+	return strings.Join(append(lines, s), "\n")
+}
@@ -0,0 +1,32 @@
+package imagedata
+
+import (
+	"image"
+	"io"
+
+	// Decoders of the formats whose size can be read from the header
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// bytesPerPixel is what processing an image holds per pixel: ImageMagick
+	// keeps 4 channels of 16 bits, and preprocessing works on a copy
+	bytesPerPixel = 16
+
+	// unknownFactor multiplies the size of uploads whose dimensions cannot be
+	// read cheaply, such as PDFs, TIFF and HEIC
+	unknownFactor = 10
+)
+
+// EstimateMemory returns the memory processing an upload of size bytes is
+// expected to take, from the dimensions in its header. Only the header is
+// read from r.
+func EstimateMemory(r io.Reader, size int64) int64 {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return size * unknownFactor
+	}
+	return size + int64(config.Width)*int64(config.Height)*bytesPerPixel
+}
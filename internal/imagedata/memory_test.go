@@ -0,0 +1,31 @@
+package imagedata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEstimateMemory(t *testing.T) {
+	png := pngImage(t, 100, 50)
+	size := int64(len(png))
+
+	tests := []struct {
+		name string
+		data []byte
+		size int64
+		want int64
+	}{
+		{"png header", png, size, size + 100*50*bytesPerPixel},
+		{"pdf", []byte("%PDF-1.7\n"), 1000, 1000 * unknownFactor},
+		{"tiff", []byte("II*\x00\x08\x00\x00\x00"), 2000, 2000 * unknownFactor},
+		{"truncated header", png[:10], size, size * unknownFactor},
+		{"empty", nil, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateMemory(bytes.NewReader(tt.data), tt.size); got != tt.want {
+				t.Errorf("EstimateMemory = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
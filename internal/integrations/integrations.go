@@ -0,0 +1,55 @@
+// Package integrations pushes stored invoices into external accounting systems
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Integration names, as used in routes and StoredInvoice.ExternalIDs
+const (
+	Odoo            = "odoo"
+	ReceiptWrangler = "receipt-wrangler"
+)
+
+// ErrNotConfigured is returned for an integration that is not set up
+var ErrNotConfigured = errors.New("integration is not configured")
+
+// Pusher creates stored invoices in an external system
+type Pusher interface {
+	// Push creates the invoice, attaching original when not nil, and
+	// returns the ID the system assigned to it
+	Push(ctx context.Context, record *models.StoredInvoice, original []byte) (string, error)
+}
+
+// New returns a pusher for the named integration
+func New(name string, config models.IntegrationsConfig) (Pusher, error) {
+	switch name {
+	case Odoo:
+		if config.Odoo.URL == "" {
+			return nil, ErrNotConfigured
+		}
+		return NewOdooClient(config.Odoo), nil
+	case ReceiptWrangler:
+		if config.ReceiptWrangler.URL == "" {
+			return nil, ErrNotConfigured
+		}
+		return NewReceiptWranglerClient(config.ReceiptWrangler), nil
+	}
+	return nil, fmt.Errorf("unknown integration: %s", name)
+}
+
+// AutoPush lists the integrations that push every archived invoice
+func AutoPush(config models.IntegrationsConfig) []string {
+	var names []string
+	if config.Odoo.URL != "" && config.Odoo.AutoPush {
+		names = append(names, Odoo)
+	}
+	if config.ReceiptWrangler.URL != "" && config.ReceiptWrangler.AutoPush {
+		names = append(names, ReceiptWrangler)
+	}
+	return names
+}
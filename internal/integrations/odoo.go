@@ -0,0 +1,227 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// OdooClient creates vendor bills through Odoo's external JSON-RPC API
+type OdooClient struct {
+	url    string
+	config models.OdooConfig
+	client *http.Client
+}
+
+// NewOdooClient creates an Odoo client
+func NewOdooClient(config models.OdooConfig) *OdooClient {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &OdooClient{
+		url:    strings.TrimRight(config.URL, "/") + "/jsonrpc",
+		config: config,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Push creates a draft vendor bill (account.move of type in_invoice) from the
+// invoice, finding or creating the vendor as a partner, and attaches the
+// original upload. It returns the bill ID.
+func (o *OdooClient) Push(ctx context.Context, record *models.StoredInvoice, original []byte) (string, error) {
+	invoice := record.Invoice
+	if invoice == nil {
+		return "", fmt.Errorf("invoice has no extraction result")
+	}
+
+	var uid int
+	err := o.call(ctx, "common", "login", []interface{}{o.config.Database, o.config.Username, o.config.APIKey}, &uid)
+	if err != nil {
+		return "", fmt.Errorf("login failed: %w", err)
+	}
+	if uid == 0 {
+		return "", fmt.Errorf("login failed: invalid database, username or API key")
+	}
+
+	partnerID, err := o.vendor(ctx, uid, invoice.Vendor)
+	if err != nil {
+		return "", err
+	}
+
+	bill := map[string]interface{}{
+		"move_type":        "in_invoice",
+		"partner_id":       partnerID,
+		"ref":              record.ID,
+		"invoice_line_ids": o.billLines(invoice),
+	}
+	if !invoice.Date.IsZero() {
+		bill["invoice_date"] = invoice.Date.Format(time.DateOnly)
+	}
+	if o.config.JournalID > 0 {
+		bill["journal_id"] = o.config.JournalID
+	}
+	var billID int
+	err = o.execute(ctx, uid, "account.move", "create", []interface{}{bill}, &billID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create vendor bill: %w", err)
+	}
+
+	if original != nil {
+		name := record.Filename
+		if name == "" {
+			name = "invoice-" + record.ID
+		}
+		attachment := map[string]interface{}{
+			"name":      name,
+			"datas":     base64.StdEncoding.EncodeToString(original),
+			"res_model": "account.move",
+			"res_id":    billID,
+			"mimetype":  record.ContentType,
+		}
+		var attachmentID int
+		err = o.execute(ctx, uid, "ir.attachment", "create", []interface{}{attachment}, &attachmentID)
+		if err != nil {
+			return "", fmt.Errorf("created vendor bill %d but failed to attach the original: %w", billID, err)
+		}
+	}
+
+	return strconv.Itoa(billID), nil
+}
+
+// vendor returns the ID of the partner named like the vendor, creating it when missing
+func (o *OdooClient) vendor(ctx context.Context, uid int, name string) (int, error) {
+	if name == "" {
+		name = "Unknown Vendor"
+	}
+
+	var ids []int
+	domain := []interface{}{[]interface{}{"name", "=ilike", name}}
+	err := o.execute(ctx, uid, "res.partner", "search", []interface{}{domain}, &ids, map[string]interface{}{"limit": 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to search vendor: %w", err)
+	}
+	if len(ids) > 0 {
+		return ids[0], nil
+	}
+
+	var id int
+	partner := map[string]interface{}{"name": name, "is_company": true, "supplier_rank": 1}
+	err = o.execute(ctx, uid, "res.partner", "create", []interface{}{partner}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create vendor: %w", err)
+	}
+	return id, nil
+}
+
+// billLines returns the invoice_line_ids commands of a bill. Item amounts are
+// line totals; an invoice without items gets one line for its net amount.
+func (o *OdooClient) billLines(invoice *models.Invoice) []interface{} {
+	line := func(name string, quantity int, amount decimal.Decimal, taxed bool) []interface{} {
+		price, _ := amount.Div(decimal.NewFromInt(int64(quantity))).Float64()
+		values := map[string]interface{}{
+			"name":       name,
+			"quantity":   quantity,
+			"price_unit": price,
+			"tax_ids":    []interface{}{[]interface{}{6, 0, []int{}}},
+		}
+		if taxed && o.config.PurchaseTaxID > 0 {
+			values["tax_ids"] = []interface{}{[]interface{}{6, 0, []int{o.config.PurchaseTaxID}}}
+		}
+		// (0, 0, values) creates a line
+		return []interface{}{0, 0, values}
+	}
+
+	var lines []interface{}
+	for _, item := range invoice.Items {
+		quantity := item.Quantity
+		if quantity < 1 {
+			quantity = 1
+		}
+		lines = append(lines, line(item.Name, quantity, item.Amount, item.IsTaxed))
+	}
+	if len(lines) == 0 {
+		name := invoice.Vendor
+		if name == "" {
+			name = "Invoice"
+		}
+		lines = append(lines, line(name, 1, invoice.Total.Sub(invoice.Tax), !invoice.Tax.IsZero()))
+	}
+	return lines
+}
+
+// execute calls a model method through the object service
+func (o *OdooClient) execute(ctx context.Context, uid int, model, method string, args []interface{}, result interface{}, kwargs ...map[string]interface{}) error {
+	params := []interface{}{o.config.Database, uid, o.config.APIKey, model, method, args}
+	if len(kwargs) > 0 {
+		params = append(params, kwargs[0])
+	}
+	return o.call(ctx, "object", "execute_kw", params, result)
+}
+
+// odooResponse is a JSON-RPC 2.0 response
+type odooResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+		Data    struct {
+			Message string `json:"message"`
+		} `json:"data"`
+	} `json:"error"`
+}
+
+// call invokes a method of an Odoo service and decodes its result
+func (o *OdooClient) call(ctx context.Context, service, method string, args []interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "call",
+		"params":  map[string]interface{}{"service": service, "method": method, "args": args},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("odoo returned %d: %s", resp.StatusCode, strings.TrimSpace(string(text)))
+	}
+
+	var rpc odooResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpc); err != nil {
+		return fmt.Errorf("failed to decode odoo response: %w", err)
+	}
+	if rpc.Error != nil {
+		// data.message carries the server-side exception, e.g. an access error
+		if rpc.Error.Data.Message != "" {
+			return fmt.Errorf("odoo error: %s", rpc.Error.Data.Message)
+		}
+		return fmt.Errorf("odoo error: %s", rpc.Error.Message)
+	}
+	// login answers false for bad credentials
+	if string(rpc.Result) == "false" {
+		return nil
+	}
+	return json.Unmarshal(rpc.Result, result)
+}
@@ -0,0 +1,208 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// ReceiptWranglerClient creates receipts through the Receipt Wrangler API
+type ReceiptWranglerClient struct {
+	url    string
+	config models.ReceiptWranglerConfig
+	client *http.Client
+}
+
+// NewReceiptWranglerClient creates a Receipt Wrangler client
+func NewReceiptWranglerClient(config models.ReceiptWranglerConfig) *ReceiptWranglerClient {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	if config.Status == "" {
+		config.Status = "OPEN"
+	}
+	return &ReceiptWranglerClient{
+		url:    strings.TrimRight(config.URL, "/") + "/api",
+		config: config,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// rwCategory is a Receipt Wrangler category
+type rwCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// rwItem is a receipt item ("share" in the Receipt Wrangler UI)
+type rwItem struct {
+	Name            string       `json:"name"`
+	Amount          string       `json:"amount"`
+	ChargedToUserID int          `json:"chargedToUserId"`
+	Status          string       `json:"status"`
+	Categories      []rwCategory `json:"categories"`
+}
+
+// rwReceipt is the body of a receipt creation
+type rwReceipt struct {
+	Name         string       `json:"name"`
+	Amount       string       `json:"amount"`
+	Date         string       `json:"date"`
+	GroupID      int          `json:"groupId"`
+	PaidByUserID int          `json:"paidByUserId"`
+	Status       string       `json:"status"`
+	Categories   []rwCategory `json:"categories"`
+	Tags         []struct{}   `json:"tags"`
+	Items        []rwItem     `json:"receiptItems"`
+}
+
+// Push creates a receipt in the configured group, mapping categories to the
+// Receipt Wrangler categories of the same name, and uploads the original as
+// the receipt image. It returns the receipt ID.
+func (c *ReceiptWranglerClient) Push(ctx context.Context, record *models.StoredInvoice, original []byte) (string, error) {
+	invoice := record.Invoice
+	if invoice == nil {
+		return "", fmt.Errorf("invoice has no extraction result")
+	}
+
+	categories, err := c.categories(ctx, invoice.Categories)
+	if err != nil {
+		return "", err
+	}
+
+	date := invoice.Date
+	if date.IsZero() {
+		date = record.CreatedAt
+	}
+	name := invoice.Vendor
+	if name == "" {
+		name = "Unknown Vendor"
+	}
+	receipt := rwReceipt{
+		Name:         name,
+		Amount:       invoice.Total.StringFixed(2),
+		Date:         date.UTC().Format(time.RFC3339),
+		GroupID:      c.config.GroupID,
+		PaidByUserID: c.config.PaidByUserID,
+		Status:       c.config.Status,
+		Categories:   categories,
+		Tags:         []struct{}{},
+		Items:        []rwItem{},
+	}
+	for _, item := range invoice.Items {
+		receipt.Items = append(receipt.Items, rwItem{
+			Name:            item.Name,
+			Amount:          item.Amount.StringFixed(2),
+			ChargedToUserID: c.config.PaidByUserID,
+			Status:          "OPEN",
+			Categories:      []rwCategory{},
+		})
+	}
+
+	body, err := json.Marshal(receipt)
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		ID int `json:"id"`
+	}
+	err = c.do(ctx, http.MethodPost, "/receipt/", "application/json", bytes.NewReader(body), &created)
+	if err != nil {
+		return "", fmt.Errorf("failed to create receipt: %w", err)
+	}
+	id := strconv.Itoa(created.ID)
+
+	if original != nil {
+		if err := c.uploadImage(ctx, id, record, original); err != nil {
+			return "", fmt.Errorf("created receipt %s but failed to upload the original: %w", id, err)
+		}
+	}
+	return id, nil
+}
+
+// categories maps category names to the Receipt Wrangler categories with the
+// same name, ignoring case; names without a match are skipped
+func (c *ReceiptWranglerClient) categories(ctx context.Context, names []string) ([]rwCategory, error) {
+	matched := []rwCategory{}
+	if len(names) == 0 {
+		return matched, nil
+	}
+
+	var all []rwCategory
+	err := c.do(ctx, http.MethodGet, "/category/", "", nil, &all)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+	for _, name := range names {
+		for _, category := range all {
+			if strings.EqualFold(category.Name, name) {
+				matched = append(matched, category)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// uploadImage attaches the original upload to a receipt
+func (c *ReceiptWranglerClient) uploadImage(ctx context.Context, receiptID string, record *models.StoredInvoice, original []byte) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("receiptId", receiptID)
+	name := record.Filename
+	if name == "" {
+		name = "invoice-" + record.ID
+	}
+	f, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(original); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/receiptImage/", form.FormDataContentType(), &body, nil)
+}
+
+// do sends an authenticated request and decodes the JSON response into result, if not nil
+func (c *ReceiptWranglerClient) do(ctx context.Context, method, path, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("receipt wrangler returned %d: %s", resp.StatusCode, strings.TrimSpace(string(text)))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode receipt wrangler response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package learning remembers the categories reviewers give each vendor's
+// invoices, so later invoices of the vendor get them without relying on the AI
+package learning
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// legalForms are company type suffixes left out of vendor keys, so
+// "Repsol S.A." and "REPSOL" share a mapping
+var legalForms = map[string]bool{
+	"sa": true, "sl": true, "slu": true, "sau": true, "scp": true, "cb": true,
+	"gmbh": true, "ag": true, "kg": true, "ltd": true, "limited": true, "plc": true,
+	"inc": true, "llc": true, "corp": true, "co": true, "sas": true, "sarl": true,
+	"srl": true, "spa": true, "bv": true, "nv": true,
+}
+
+// Key returns the key vendor names are matched by: lowercase words without
+// punctuation or legal form. It is empty for a name without words.
+func Key(vendor string) string {
+	fields := strings.FieldsFunc(strings.ToLower(vendor), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '.'
+	})
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		word := strings.ReplaceAll(field, ".", "")
+		if word != "" && !legalForms[word] {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Mapping is the categories of one vendor
+type Mapping struct {
+	Key         string    `json:"key"`    // See Key
+	Vendor      string    `json:"vendor"` // As last corrected or set
+	Categories  []string  `json:"categories"`
+	Manual      bool      `json:"manual"`      // Set through the API; corrections leave it alone
+	Corrections int       `json:"corrections"` // Corrections in a row to these categories
+	Active      bool      `json:"active"`      // Applied to new invoices
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Store keeps the mappings of each tenant
+type Store struct {
+	path           string // JSON persistence file, empty for in-memory only
+	minCorrections int
+
+	mu       sync.Mutex
+	mappings map[string]map[string]*Mapping // tenant -> key -> mapping
+}
+
+// NewStore creates a store, loading previous mappings from config.Path if it
+// exists
+func NewStore(config models.CategoryLearningConfig) (*Store, error) {
+	s := &Store{
+		path:           config.Path,
+		minCorrections: max(config.MinCorrections, 1),
+		mappings:       make(map[string]map[string]*Mapping),
+	}
+	if s.path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read category mappings: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse category mappings: %w", err)
+	}
+	return s, nil
+}
+
+// Learn records that a reviewer gave an invoice of vendor these categories.
+// Repeating the categories of a mapping counts towards min_corrections,
+// different ones start over. Manual mappings and empty categories are ignored.
+func (s *Store) Learn(tenant, vendor string, categories []string) error {
+	key := Key(vendor)
+	if key == "" || len(categories) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mapping := s.mappings[tenant][key]
+	switch {
+	case mapping == nil:
+		mapping = &Mapping{Key: key}
+		s.put(tenant, mapping)
+	case mapping.Manual:
+		return nil
+	}
+	if sameCategories(mapping.Categories, categories) {
+		mapping.Corrections++
+	} else {
+		mapping.Categories = slices.Clone(categories)
+		mapping.Corrections = 1
+	}
+	mapping.Vendor = strings.TrimSpace(vendor)
+	mapping.UpdatedAt = time.Now().UTC()
+	return s.save()
+}
+
+// Lookup returns the categories of vendor, nil without an active mapping
+func (s *Store) Lookup(tenant, vendor string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mapping := s.mappings[tenant][Key(vendor)]
+	if mapping == nil || !s.active(mapping) {
+		return nil
+	}
+	return slices.Clone(mapping.Categories)
+}
+
+// List returns the mappings of a tenant, sorted by key
+func (s *Store) List(tenant string) []Mapping {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Mapping, 0, len(s.mappings[tenant]))
+	for _, mapping := range s.mappings[tenant] {
+		list = append(list, s.copy(mapping))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Set sets the categories of vendor by hand. The mapping applies right away
+// and corrections no longer change it.
+func (s *Store) Set(tenant, vendor string, categories []string) (Mapping, error) {
+	key := Key(vendor)
+	if key == "" {
+		return Mapping{}, fmt.Errorf("vendor %q has no letters or digits", vendor)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mapping := &Mapping{
+		Key:        key,
+		Vendor:     strings.TrimSpace(vendor),
+		Categories: slices.Clone(categories),
+		Manual:     true,
+		UpdatedAt:  time.Now().UTC(),
+	}
+	s.put(tenant, mapping)
+	return s.copy(mapping), s.save()
+}
+
+// Delete removes the mapping of vendor, reporting whether there was one
+func (s *Store) Delete(tenant, vendor string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := Key(vendor)
+	if s.mappings[tenant][key] == nil {
+		return false, nil
+	}
+	delete(s.mappings[tenant], key)
+	if len(s.mappings[tenant]) == 0 {
+		delete(s.mappings, tenant)
+	}
+	return true, s.save()
+}
+
+// put adds or replaces a mapping (caller holds the lock)
+func (s *Store) put(tenant string, mapping *Mapping) {
+	if s.mappings[tenant] == nil {
+		s.mappings[tenant] = make(map[string]*Mapping)
+	}
+	s.mappings[tenant][mapping.Key] = mapping
+}
+
+// active reports whether a mapping is applied (caller holds the lock)
+func (s *Store) active(mapping *Mapping) bool {
+	return mapping.Manual || mapping.Corrections >= s.minCorrections
+}
+
+// copy returns a mapping with Active set (caller holds the lock)
+func (s *Store) copy(mapping *Mapping) Mapping {
+	c := *mapping
+	c.Categories = slices.Clone(mapping.Categories)
+	c.Active = s.active(mapping)
+	return c
+}
+
+// save writes all mappings to the persistence file (caller holds the lock)
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.mappings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal category mappings: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return fmt.Errorf("failed to create category mappings directory: %w", err)
+	}
+	tempPath := s.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write category mappings: %w", err)
+	}
+	return os.Rename(tempPath, s.path)
+}
+
+// sameCategories reports whether a and b hold the same categories in any order
+func sameCategories(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, category := range b {
+		if !slices.Contains(a, category) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package learning
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		vendor string
+		want   string
+	}{
+		{"Repsol S.A.", "repsol"},
+		{"REPSOL", "repsol"},
+		{"  Café  Central, S.L.U. ", "café central"},
+		{"Acme Ltd.", "acme"},
+		{"Amazon.com", "amazoncom"},
+		{"S.A.", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.vendor); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.vendor, got, tt.want)
+		}
+	}
+}
+
+func TestLearn(t *testing.T) {
+	s, err := NewStore(models.CategoryLearningConfig{MinCorrections: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fuel := []string{"Fuel"}
+	if err := s.Learn("", "Repsol S.A.", fuel); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Lookup("", "REPSOL"); got != nil {
+		t.Errorf("applied after one correction: %v", got)
+	}
+	s.Learn("", "Repsol", fuel)
+	if got := s.Lookup("", "REPSOL"); !slices.Equal(got, fuel) {
+		t.Errorf("Lookup = %v, want %v", got, fuel)
+	}
+	if got := s.Lookup("acme", "Repsol"); got != nil {
+		t.Errorf("other tenant: %v", got)
+	}
+
+	// Different categories start over
+	s.Learn("", "Repsol", []string{"Travel"})
+	if got := s.Lookup("", "Repsol"); got != nil {
+		t.Errorf("applied after a change: %v", got)
+	}
+
+	// Manual mappings apply at once and are kept
+	if _, err := s.Set("", "Repsol", fuel); err != nil {
+		t.Fatal(err)
+	}
+	s.Learn("", "Repsol", []string{"Travel"})
+	if got := s.Lookup("", "Repsol"); !slices.Equal(got, fuel) {
+		t.Errorf("manual mapping: Lookup = %v, want %v", got, fuel)
+	}
+
+	list := s.List("")
+	if len(list) != 1 || !list[0].Manual || !list[0].Active || list[0].Key != "repsol" {
+		t.Errorf("List = %+v", list)
+	}
+
+	if ok, err := s.Delete("", "repsol s.a."); !ok || err != nil {
+		t.Errorf("Delete = %v, %v", ok, err)
+	}
+	if ok, _ := s.Delete("", "Repsol"); ok {
+		t.Error("deleted twice")
+	}
+	if _, err := s.Set("", "S.A.", fuel); err == nil {
+		t.Error("Set accepted a vendor without a key")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	config := models.CategoryLearningConfig{Path: filepath.Join(t.TempDir(), "learning", "mappings.json")}
+	s, err := NewStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Learn("acme", "Repsol", []string{"Fuel"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Lookup("acme", "Repsol"); !slices.Equal(got, []string{"Fuel"}) {
+		t.Errorf("Lookup after reload = %v", got)
+	}
+}
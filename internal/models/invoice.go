@@ -8,78 +8,1147 @@ import (
 
 // Invoice represents the extracted data from a receipt/invoice
 type Invoice struct {
+	// Identifier (set when the invoice is stored)
+	ID       string `json:"id,omitempty"`
+	TenantID string `json:"tenantId,omitempty"` // Owning tenant (multi-tenant deployments)
+
 	// Basic information
-	Vendor string          `json:"vendor"`           // Merchant/store name
-	Date   time.Time       `json:"date"`             // Invoice date
-	Total  decimal.Decimal `json:"total"`            // Total amount
-	Tax    decimal.Decimal `json:"tax,omitempty"`    // Tax amount if available
+	Vendor string          `json:"vendor"`        // Merchant/store name
+	Date   time.Time       `json:"date"`          // Invoice date
+	Total  decimal.Decimal `json:"total"`         // Total amount
+	Tax    decimal.Decimal `json:"tax,omitempty"` // Tax amount if available
+
+	// Cash rounding line of a receipt, signed, e.g. -0.02 (if printed)
+	RoundingAdjustment *decimal.Decimal `json:"roundingAdjustment,omitempty"`
+
+	// Tip ("propina") included in the total, printed or handwritten, kept
+	// apart from items and tax since expense policies treat it differently
+	Tip *decimal.Decimal `json:"tip,omitempty"`
 
 	// Line items
 	Items []InvoiceItem `json:"items,omitempty"` // Individual line items
 
+	// Whether the items, with tax and rounding, do not add up to Total
+	TotalMismatch bool `json:"totalMismatch,omitempty"`
+
+	// Whether the AI saw the total, tip or another amount written by hand
+	HandwritingDetected bool `json:"handwritingDetected,omitempty"`
+
+	// Items likely covered by a warranty, such as electronics
+	WarrantyCandidates []WarrantyCandidate `json:"warrantyCandidates,omitempty"`
+
 	// Categories (optional)
 	Categories []string `json:"categories,omitempty"` // Suggested categories
 
+	// Monthly category limits of the expense policy the invoice went over
+	PolicyViolations []PolicyViolation `json:"policyViolations,omitempty"`
+
+	// "invoice", "receipt" or "other", as told by the document classifier (classifier.enabled)
+	DocumentType string `json:"documentType,omitempty"`
+
+	// "proforma", "duplicate" or "copy" when the OCR text is marked so, empty
+	// for an original. Proformas are not payable and must not be booked.
+	DocumentSubtype string `json:"documentSubtype,omitempty"`
+
+	// Typed details of the document kind of the prompt profile (profiles kind)
+	Fuel    *FuelDetails    `json:"fuel,omitempty"`
+	Utility *UtilityDetails `json:"utility,omitempty"`
+	Hotel   *HotelDetails   `json:"hotel,omitempty"`
+
+	// Prompt profile the invoice was extracted with, and the extra fields it
+	// asked for, by name
+	Profile string                 `json:"profile,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+
+	// Vendor VAT number found in the OCR text (vies or registry enabled), its
+	// VIES check and the vendor's company registry entry
+	VATNumber  string      `json:"vatNumber,omitempty"`
+	VATCheck   *VATCheck   `json:"vatCheck,omitempty"`
+	VendorInfo *VendorInfo `json:"vendorInfo,omitempty"`
+
+	// Store or branch of a chain the purchase was made at, apart from the
+	// legal vendor entity, so chains can be analyzed per location
+	Store *StoreInfo `json:"store,omitempty"`
+
+	// Merchant's reference of the document, e.g. its ticket number, and the
+	// loyalty card presented, masked, for retrieval from the merchant and returns
+	ReceiptNumber string `json:"receiptNumber,omitempty"`
+	LoyaltyCard   string `json:"loyaltyCard,omitempty"` // Last four characters, e.g. "****1234"
+
+	// Where the value of each field came from, by field, e.g. "total"
+	Provenance map[string]Provenance `json:"provenance,omitempty"`
+
 	// Raw data
 	RawText string `json:"rawText,omitempty"` // Complete OCR text
 
 	// Metadata
-	Confidence  float64 `json:"confidence"`  // Overall confidence score (0-1)
-	ProcessedAt time.Time `json:"processedAt"` // When it was processed
+	Confidence  float64   `json:"confidence"`         // Overall confidence score (0-1)
+	ProcessedAt time.Time `json:"processedAt"`        // When it was processed
+	Provider    string    `json:"provider,omitempty"` // AI provider that extracted the invoice
+
+	// Capture time and place of a photographed document (exif.capture)
+	Photo *PhotoMetadata `json:"photo,omitempty"`
+
+	// What Confidence was derived from, when known
+	OCRConfidence   float64 `json:"ocrConfidence,omitempty"`   // Mean word confidence of the OCR text (0-1)
+	ModelConfidence float64 `json:"modelConfidence,omitempty"` // The AI's assessment of its own answer (0-1)
+
+	// Set when confidence is calibrated from correction history: Confidence is
+	// then the observed share of such invoices with no field corrected
+	RawConfidence   float64            `json:"rawConfidence,omitempty"`   // Confidence before calibration
+	FieldConfidence map[string]float64 `json:"fieldConfidence,omitempty"` // Observed share of each field left uncorrected, e.g. "total"
+}
+
+// PhotoMetadata is what the EXIF data of a photo records of its capture
+type PhotoMetadata struct {
+	TakenAt  string    `json:"takenAt,omitempty"`  // RFC 3339, or without a zone when the camera did not record its UTC offset
+	Location *GeoPoint `json:"location,omitempty"` // Where the photo was taken
+}
+
+// GeoPoint is a WGS 84 position in decimal degrees
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
 }
 
 // InvoiceItem represents a line item in an invoice
 type InvoiceItem struct {
-	Name   string          `json:"name"`             // Item name/description
-	Amount decimal.Decimal `json:"amount"`           // Item price
-	IsTaxed bool           `json:"isTaxed"`          // Whether tax applies to this item
-	Quantity int           `json:"quantity,omitempty"` // Quantity (if detected)
+	Name     string          `json:"name"`               // Item name/description
+	Amount   decimal.Decimal `json:"amount"`             // Item price
+	IsTaxed  bool            `json:"isTaxed"`            // Whether tax applies to this item
+	Quantity int             `json:"quantity,omitempty"` // Quantity (if detected)
+
+	// Price of one unit (if printed). When quantity × unit price is not the
+	// amount, a misread digit of one of the three is repaired and recorded in
+	// Repair; items that cannot be repaired are marked Inconsistent.
+	UnitPrice    *decimal.Decimal `json:"unitPrice,omitempty"`
+	Repair       *ItemRepair      `json:"repair,omitempty"`
+	Inconsistent bool             `json:"inconsistent,omitempty"`
+
+	// Serial numbers or IMEIs printed for the item
+	SerialNumbers []string `json:"serialNumbers,omitempty"`
+
+	// Catalog product the item was matched to (catalog.file), and how similar
+	// their names are, from 0 to 1
+	ProductID  string  `json:"productId,omitempty"`
+	MatchScore float64 `json:"matchScore,omitempty"`
+}
+
+// Kinds of documents with typed details, asked for by prompt profiles
+const (
+	KindFuel    = "fuel"    // Fuel station receipt, see FuelDetails
+	KindUtility = "utility" // Electricity, gas or water bill, see UtilityDetails
+	KindHotel   = "hotel"   // Hotel invoice or folio, see HotelDetails
+)
+
+// Kinds lists the document kinds
+var Kinds = []string{KindFuel, KindUtility, KindHotel}
+
+// FuelDetails are the details of a fuel station receipt
+type FuelDetails struct {
+	Liters        *decimal.Decimal `json:"liters,omitempty"`
+	PricePerLiter *decimal.Decimal `json:"pricePerLiter,omitempty"`
+	FuelType      string           `json:"fuelType,omitempty"` // As printed, e.g. "Gasóleo A"
+	Plate         string           `json:"plate,omitempty"`    // Vehicle license plate, uppercase without spaces
+}
+
+// UtilityDetails are the details of an electricity, gas or water bill
+type UtilityDetails struct {
+	PeriodStart       string           `json:"periodStart,omitempty"` // First day billed, YYYY-MM-DD
+	PeriodEnd         string           `json:"periodEnd,omitempty"`   // Last day billed, YYYY-MM-DD
+	Consumption       *decimal.Decimal `json:"consumption,omitempty"`
+	ConsumptionUnit   string           `json:"consumptionUnit,omitempty"` // "kWh", "m3" or as printed
+	MeterNumbers      []string         `json:"meterNumbers,omitempty"`    // Meter or supply point (CUPS) numbers
+	ContractReference string           `json:"contractReference,omitempty"`
+}
+
+// HotelDetails are the details of a hotel stay, as per-diem calculations need them
+type HotelDetails struct {
+	CheckIn  string           `json:"checkIn,omitempty"`  // YYYY-MM-DD
+	CheckOut string           `json:"checkOut,omitempty"` // YYYY-MM-DD
+	Nights   int              `json:"nights,omitempty"`
+	RoomRate *decimal.Decimal `json:"roomRate,omitempty"` // Per night
+	CityTax  *decimal.Decimal `json:"cityTax,omitempty"`  // Tourist tax for the whole stay
+}
+
+// StoreInfo identifies the store or branch a document was issued at
+type StoreInfo struct {
+	Number  string `json:"number,omitempty"`  // Store or branch number, as printed
+	Address string `json:"address,omitempty"` // Street address of the store, one line
+}
+
+// WarrantyCandidate is a line item likely covered by a warranty
+type WarrantyCandidate struct {
+	Item          int             `json:"item"` // Index in Items
+	Name          string          `json:"name"`
+	Amount        decimal.Decimal `json:"amount"`
+	SerialNumbers []string        `json:"serialNumbers,omitempty"`
+	Reason        string          `json:"reason"` // "serial_number" or "product"
+}
+
+// ItemRepair records the value of a line item field replaced to make
+// quantity × unit price equal the amount
+type ItemRepair struct {
+	Field    string          `json:"field"`    // "quantity", "unitPrice" or "amount"
+	Original decimal.Decimal `json:"original"` // As extracted
 }
 
 // ProcessRequest represents the input for invoice processing
 type ProcessRequest struct {
-	// Image data (base64 encoded or raw bytes will be sent as multipart)
+	// Image data, uploaded as a multipart file or as base64 in a JSON body
 	ImageData []byte `json:"-"`
 
 	// Configuration (optional)
 	UseVisionModel bool   `json:"useVisionModel"` // Use vision AI directly (skip OCR)
-	AIProvider     string `json:"aiProvider"`     // "openai", "gemini", "ollama"
+	AIProvider     string `json:"aiProvider"`     // "openai", "gemini", "ollama", "external"
 	Model          string `json:"model"`          // Specific model name
 	Language       string `json:"language"`       // OCR language (default: "eng")
+	RedactPII      bool   `json:"redactPII"`      // Mask card numbers, IBANs and names in rawText
+	Profile        string `json:"profile"`        // Prompt profile, e.g. "fuel_receipt"; empty lets the classifier pick
+
+	Generation *GenerationParams `json:"generation,omitempty"` // AI sampling overrides
+}
+
+// GenerationParams overrides the sampling parameters of the AI call. Nil
+// fields keep the provider's defaults.
+type GenerationParams struct {
+	Temperature *float32               `json:"temperature,omitempty"` // 0-2
+	MaxTokens   *int                   `json:"maxTokens,omitempty"`   // Completion token limit
+	TopP        *float32               `json:"topP,omitempty"`        // 0-1
+	Options     map[string]interface{} `json:"options,omitempty"`     // Provider-specific, e.g. Ollama "num_ctx"
+
+	// OpenAI vision: "low", "high" or "auto" (default), where auto picks low
+	// for images that fit 512x512 or would exceed MaxImageTokens
+	ImageDetail    string `json:"imageDetail,omitempty"`
+	MaxImageTokens *int   `json:"maxImageTokens,omitempty"` // Input token budget of the image; larger images are sent at low detail
+}
+
+// ExtractTextRequest represents the input for extraction from text that was OCR'd elsewhere
+type ExtractTextRequest struct {
+	Text       string `json:"text"`       // OCR output, email body, ...
+	AIProvider string `json:"aiProvider"` // "openai", "gemini", "ollama", "external"
+	Model      string `json:"model"`      // Specific model name
+	RedactPII  bool   `json:"redactPII"`  // Mask card numbers, IBANs and names in rawText
+	Profile    string `json:"profile"`    // Prompt profile, e.g. "fuel_receipt"; empty lets the classifier pick
+
+	GenerationParams // AI sampling overrides, e.g. "temperature": 0.2
 }
 
 // ProcessResponse represents the output of invoice processing
 type ProcessResponse struct {
-	Success bool     `json:"success"`
-	Invoice *Invoice `json:"invoice,omitempty"`
-	Error   string   `json:"error,omitempty"`
+	SchemaVersion int      `json:"schemaVersion"` // Shape of invoice, see SchemaV1
+	Success       bool     `json:"success"`
+	Invoice       *Invoice `json:"invoice,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	Code          string   `json:"code,omitempty"`      // Machine-readable error code, e.g. "ocr_failed"
+	RequestID     string   `json:"requestId,omitempty"` // ID to quote when reporting a failure
+
+	// Partial results of a failed request
+	Stage   string `json:"stage,omitempty"`   // Pipeline stage that failed: "preprocess", "ocr" or "ai"
+	RawText string `json:"rawText,omitempty"` // OCR text, when OCR succeeded before the failure
+
+	ProviderResponse string `json:"providerResponse,omitempty"` // Start of an AI response that was not valid invoice JSON
+
+	InstalledLanguages []string `json:"installedLanguages,omitempty"` // Tesseract languages to choose from, with code "language_not_installed"
 
 	// Processing metadata
-	OCRDuration float64 `json:"ocrDuration,omitempty"` // OCR time in seconds
-	AIDuration  float64 `json:"aiDuration,omitempty"`  // AI extraction time in seconds
-	TotalDuration float64 `json:"totalDuration"`       // Total processing time
+	OCRDuration   float64 `json:"ocrDuration,omitempty"` // OCR time in seconds
+	AIDuration    float64 `json:"aiDuration,omitempty"`  // AI extraction time in seconds
+	TotalDuration float64 `json:"totalDuration"`         // Total processing time
+	Usage         *Usage  `json:"usage,omitempty"`       // Resources consumed by this request
+
+	Diagnostics *Diagnostics `json:"diagnostics,omitempty"` // How the request was processed, also on failures
+}
+
+// Diagnostics describes how a document was processed, to investigate results
+// that are slow or wrong. Image sizes are of the first page of a document.
+type Diagnostics struct {
+	PreprocessDuration float64    `json:"preprocessDuration"`           // Seconds
+	ImageSize          *ImageSize `json:"imageSize,omitempty"`          // As uploaded
+	ProcessedImageSize *ImageSize `json:"processedImageSize,omitempty"` // After preprocessing
+
+	OCREngine     string  `json:"ocrEngine,omitempty"`   // Empty when no OCR ran, e.g. with a vision model
+	OCRLanguage   string  `json:"ocrLanguage,omitempty"` // Tesseract language used
+	OCRConfidence float64 `json:"ocrConfidence"`         // Mean word confidence of the OCR text (0-1)
+	OCRRetries    int     `json:"ocrRetries"`            // Low-confidence OCR retries, over all pages
+	OCRStrategy   string  `json:"ocrStrategy,omitempty"` // Retry strategy whose text was kept
+	Handwriting   bool    `json:"handwriting,omitempty"` // A vision model read the document again for a handwritten total
+
+	Provider         string `json:"provider,omitempty"`
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int    `json:"promptTokens"`
+	CompletionTokens int    `json:"completionTokens"`
+	Rule             string `json:"rule,omitempty"`       // Vendor rule that matched the OCR text
+	RuleBypass       bool   `json:"ruleBypass,omitempty"` // The rule supplied the fields and the AI was not called
+}
+
+// ImageSize is the size of an image in pixels
+type ImageSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Invoice schema versions of processing responses, chosen by the client with
+// the Accept-Version header
+const (
+	SchemaV1 = 1 // Invoice as stored: flat, dates as timestamps (default)
+	SchemaV2 = 2 // Vendor and confidence details grouped, dates as YYYY-MM-DD
+)
+
+// ErrorResponse represents the body of an error response
+type ErrorResponse struct {
+	Error     string `json:"error"`               // Human-readable message
+	Code      string `json:"code"`                // Stable machine-readable code
+	RequestID string `json:"requestId,omitempty"` // ID to quote when reporting a failure
+
+	// Set when an upload is refused for its size or type
+	ContentType  string   `json:"contentType,omitempty"`  // Type sniffed from the content
+	DeclaredType string   `json:"declaredType,omitempty"` // Type the client declared
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+	MaxSize      int64    `json:"maxSize,omitempty"` // Upload limit in bytes
+}
+
+// Usage represents the resources consumed by one processing request
+type Usage struct {
+	Pages            int     `json:"pages"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	EstimatedCost    float64 `json:"estimatedCost"` // USD, from the configured price table
+}
+
+// Region is a rectangle of an image, in pixels from its top-left corner
+// after EXIF orientation is applied
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// StoredInvoice represents a processed invoice persisted with its original upload
+type StoredInvoice struct {
+	ID          string `json:"id"`
+	TenantID    string `json:"tenantId,omitempty"`
+	Filename    string `json:"filename,omitempty"`    // Original upload filename
+	ContentType string `json:"contentType,omitempty"` // Original upload MIME type
+
+	// Processing parameters of the latest extraction
+	AIProvider     string            `json:"aiProvider"`
+	Model          string            `json:"model,omitempty"`
+	Language       string            `json:"language,omitempty"`
+	UseVisionModel bool              `json:"useVisionModel"`
+	RedactPII      bool              `json:"redactPII,omitempty"`
+	Profile        string            `json:"profile,omitempty"` // Requested prompt profile
+	Generation     *GenerationParams `json:"generation,omitempty"`
+	RequestID      string            `json:"requestId,omitempty"` // X-Request-ID of the latest extraction
+
+	// Processing durations of the latest extraction, in seconds
+	OCRDuration   float64 `json:"ocrDuration,omitempty"`
+	AIDuration    float64 `json:"aiDuration,omitempty"`
+	TotalDuration float64 `json:"totalDuration,omitempty"`
+
+	Invoice *Invoice `json:"invoice"`
+	Pages   []int    `json:"pages,omitempty"`  // Pages of a split upload the invoice was found on
+	Region  *Region  `json:"region,omitempty"` // Area of a segmented photo the receipt was found in
+
+	// Set when the original holds only Pages or Region. Invoices stored before
+	// it was introduced keep the whole upload, which reprocessing splits again.
+	OriginalTrimmed bool `json:"originalTrimmed,omitempty"`
+
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Reprocessed int       `json:"reprocessed,omitempty"` // Number of re-extractions
+
+	// IDs of the invoice in the systems it was pushed to, by integration, e.g. "odoo"
+	ExternalIDs map[string]string `json:"externalIds,omitempty"`
+
+	// Set once the invoice was approved
+	ApprovedAt *time.Time `json:"approvedAt,omitempty"`
+	ApprovedBy string     `json:"approvedBy,omitempty"` // Caller that approved it
+
+	// Set when extracted fields were last corrected by hand
+	CorrectedAt     *time.Time `json:"correctedAt,omitempty"`
+	CorrectedFields []string   `json:"correctedFields,omitempty"` // Fields whose value changed, e.g. "total"
+
+	// Set once the retention policy removed the original image and raw text
+	ArtifactsPurgedAt *time.Time `json:"artifactsPurgedAt,omitempty"`
 }
 
 // Config represents the service configuration
 type Config struct {
 	// Server config
-	Port int    `yaml:"port"`
-	Host string `yaml:"host"`
+	Port            int           `yaml:"port"`
+	Host            string        `yaml:"host"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // Max wait for in-flight requests on shutdown (default: "30s")
+	LegacyErrors    bool          `yaml:"legacy_errors"`    // Answer processing failures with 200 and an error body
+
+	// API versioning
+	API APIConfig `yaml:"api"`
+
+	// Native TLS (and HTTP/2) without a reverse proxy
+	TLS TLSConfig `yaml:"tls"`
+
+	// gRPC API on its own port
+	GRPC GRPCConfig `yaml:"grpc"`
+
+	// Cross-origin requests from browser frontends
+	CORS CORSConfig `yaml:"cors"`
+
+	// Response compression
+	Compression CompressionConfig `yaml:"compression"`
+
+	// Embedded review web UI
+	UI UIConfig `yaml:"ui"`
+
+	// Deterministic extraction rules for known vendors
+	Rules RulesConfig `yaml:"rules"`
+
+	// External commands run around the OCR and AI stages
+	Hooks []HookConfig `yaml:"hooks"`
+
+	// Expression rules validating and normalizing extractions
+	Scripts []ScriptRule `yaml:"scripts"`
+
+	// Logging config
+	Logging LoggingConfig `yaml:"logging"`
+
+	// Tracing config
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Health check config
+	Health HealthConfig `yaml:"health"`
+
+	// Config hot-reload
+	Reload ReloadConfig `yaml:"reload"`
+
+	// External secret stores referenced as "vault:..." or "aws-sm:..." values
+	Secrets SecretsConfig `yaml:"secrets"`
 
 	// OCR config
 	OCR OCRConfig `yaml:"ocr"`
 
+	// EXIF metadata of uploaded photos
+	EXIF EXIFConfig `yaml:"exif"`
+
+	// Document type classification of OCR text
+	Classifier ClassifierConfig `yaml:"classifier"`
+
+	// Prompts and extra fields by kind of document, added to the built-in profiles
+	Profiles []ProfileConfig `yaml:"profiles"`
+
+	// Products extracted line items are matched to
+	Catalog CatalogConfig `yaml:"catalog"`
+
 	// AI config
 	AI AIConfig `yaml:"ai"`
 
+	// Providers documents may be sent to
+	Residency ResidencyConfig `yaml:"residency"`
+
+	// Air-gapped mode: local AI and OCR only, outgoing HTTP refused
+	Offline OfflineConfig `yaml:"offline"`
+
+	// Storage config
+	Storage StorageConfig `yaml:"storage"`
+
+	// Authentication config
+	Auth AuthConfig `yaml:"auth"`
+
+	// Rate limiting config
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+	// Usage accounting config
+	Usage UsageConfig `yaml:"usage"`
+
+	// Processing concurrency config
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+
+	// Upload limits and buffering config
+	Uploads UploadsConfig `yaml:"uploads"`
+
+	// Request timeout config
+	Timeouts TimeoutConfig `yaml:"timeouts"`
+
+	// Async job queue config
+	Jobs JobsConfig `yaml:"jobs"`
+
+	// E-invoice export (UBL) settings
+	Export ExportConfig `yaml:"export"`
+
+	// Policy checked by expense reports
+	Expenses ExpensesConfig `yaml:"expenses"`
+
+	// EU VAT number checks in VIES
+	VIES VIESConfig `yaml:"vies"`
+
+	// Vendor legal names and addresses from a company registry
+	Registry RegistryConfig `yaml:"registry"`
+
+	// Confidence calibration from stored corrections
+	Calibration CalibrationConfig `yaml:"calibration"`
+
+	// Vendor categories learned from corrections
+	CategoryLearning CategoryLearningConfig `yaml:"category_learning"`
+
+	// Accounting systems stored invoices are pushed to
+	Integrations IntegrationsConfig `yaml:"integrations"`
+
+	// Outbound webhooks fired on invoice events
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+
+	// Emailing of extraction results
+	Mail MailConfig `yaml:"mail"`
+
 	// Categories (for better extraction)
 	Categories []string `yaml:"categories"`
+
+	// Prompt template override (placeholders: @categories, @currentYear, @ocrText)
+	Prompt string `yaml:"prompt"`
+
+	// Tenants with their own provider settings, categories and prompt
+	Tenants []TenantConfig `yaml:"tenants"`
+}
+
+// TenantConfig overrides global settings for one tenant
+type TenantConfig struct {
+	ID         string   `yaml:"id"`
+	AI         AIConfig `yaml:"ai"`         // Non-empty fields override the global AI config
+	Categories []string `yaml:"categories"` // Replaces the global categories when set
+	Prompt     string   `yaml:"prompt"`     // Replaces the global prompt template when set
+
+	Export   ExportConfig   `yaml:"export"`   // Non-empty fields override the global export config
+	Expenses ExpensesConfig `yaml:"expenses"` // Non-empty fields override the global expense policy
+
+	Integrations IntegrationsConfig `yaml:"integrations"` // A configured integration replaces the global one
+	Webhooks     []WebhookConfig    `yaml:"webhooks"`     // Fired for this tenant's invoices, besides the global endpoints
+	Mail         MailConfig         `yaml:"mail"`         // A host replaces the global server; recipients alone replace the global ones
+}
+
+// ExportConfig represents the settings of e-invoice exports. Extracted
+// invoices have no currency or buyer, so they come from here.
+type ExportConfig struct {
+	Currency string         `yaml:"currency"` // ISO 4217 code of extracted amounts (default: "EUR")
+	Buyer    PartyConfig    `yaml:"buyer"`    // The customer on exported invoices, usually your company
+	Facturae FacturaeConfig `yaml:"facturae"` // Spanish e-invoices for FACe
+}
+
+// ExpensesConfig represents the policy expense reports are checked against.
+// Amounts are in the export currency; invoices in other currencies are
+// totalled but not checked against them.
+type ExpensesConfig struct {
+	PerDiem           float64            `yaml:"per_diem"`            // Daily limit of per-diem spend (0 = unchecked)
+	PerDiemCategories []string           `yaml:"per_diem_categories"` // Categories counted against the per diem (empty = all)
+	MaxAmount         float64            `yaml:"max_amount"`          // Limit of a single invoice (0 = unchecked)
+	CategoryLimits    map[string]float64 `yaml:"category_limits"`     // Limit of a single invoice by category
+	MonthlyLimits     map[string]float64 `yaml:"monthly_limits"`      // Limit of a month's spend by category; requires storage
+	BlockedCategories []string           `yaml:"blocked_categories"`  // Categories never reimbursed, e.g. "Alcohol"
+	MaxAgeDays        int                `yaml:"max_age_days"`        // Invoices dated longer ago are late (0 = unchecked)
+	RequireApproval   bool               `yaml:"require_approval"`    // Invoices not approved yet are violations
+}
+
+// VIESConfig represents the lookup of extracted vendor VAT numbers in the
+// EU VAT Information Exchange System
+type VIESConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	URL      string        `yaml:"url"`       // REST API base (default: the European Commission's)
+	Timeout  time.Duration `yaml:"timeout"`   // Per lookup (default: "10s")
+	CacheTTL time.Duration `yaml:"cache_ttl"` // How long answers are reused (default: "24h")
+}
+
+// Sources of extracted field values
+const (
+	SourceOCRLLM          = "ocr+llm"          // AI reading of the OCR text
+	SourceVision          = "vision"           // Vision model reading the image
+	SourceTemplateRule    = "template_rule"    // Vendor rule, without the AI
+	SourceScript          = "script"           // Script rule run after extraction
+	SourceRegistry        = "registry"         // Company registry entry of the vendor's tax ID
+	SourceHumanCorrection = "human_correction" // Corrected through the API or review UI
+	SourceLearned         = "learned"          // Vendor categories learned from corrections
+)
+
+// ProvenanceFields are the fields whose source is recorded
+var ProvenanceFields = []string{"vendor", "date", "total", "tax", "categories", "items"}
+
+// Provenance records where the value of an invoice field came from
+type Provenance struct {
+	Source   string     `json:"source"`
+	Provider string     `json:"provider,omitempty"` // AI provider, for ocr+llm and vision
+	Model    string     `json:"model,omitempty"`    // AI model, for ocr+llm and vision
+	Rule     string     `json:"rule,omitempty"`     // Vendor rule or script that set the value
+	By       string     `json:"by,omitempty"`       // Caller that corrected the value
+	At       *time.Time `json:"at,omitempty"`       // When the value was corrected
+}
+
+// SetProvenance records the source of the given fields
+func (i *Invoice) SetProvenance(provenance Provenance, fields ...string) {
+	if i.Provenance == nil {
+		i.Provenance = make(map[string]Provenance, len(ProvenanceFields))
+	}
+	for _, field := range fields {
+		i.Provenance[field] = provenance
+	}
+}
+
+// VATCheck is the answer of VIES for a VAT number
+type VATCheck struct {
+	Valid     bool      `json:"valid"`
+	Name      string    `json:"name,omitempty"`    // Registered company name, when the member state discloses it
+	Address   string    `json:"address,omitempty"` // Registered address, when disclosed
+	Error     string    `json:"error,omitempty"`   // Set when the lookup failed, e.g. the member state was unavailable; Valid is then unknown
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// RegistryConfig represents a company registry API the vendor's tax ID is
+// looked up in, to complete its legal name and address
+type RegistryConfig struct {
+	Enabled       bool           `yaml:"enabled"`
+	URL           string         `yaml:"url"`            // GET endpoint; {vatNumber}, {country} and {number} are replaced, e.g. "https://registry.example/v1/companies/{number}"
+	APIKey        string         `yaml:"api_key"`        // Sent in api_key_header when set
+	APIKeyFile    string         `yaml:"api_key_file"`   // Read the API key from this file instead
+	APIKeyHeader  string         `yaml:"api_key_header"` // Default: "X-API-Key"
+	Countries     []string       `yaml:"countries"`      // Tax ID countries looked up, e.g. ["ES"] (empty = all)
+	Fields        RegistryFields `yaml:"fields"`         // Where the response holds each field
+	ReplaceVendor bool           `yaml:"replace_vendor"` // Use the legal name as the invoice vendor
+	Timeout       time.Duration  `yaml:"timeout"`        // Per lookup (default: "10s")
+	CacheTTL      time.Duration  `yaml:"cache_ttl"`      // How long answers are reused (default: "24h")
+}
+
+// RegistryFields are dot-separated paths into the JSON response of a company
+// registry, e.g. "data.company.name" or "results.0.name". Empty paths are not read.
+type RegistryFields struct {
+	LegalName  string `yaml:"legal_name"` // Default: "name"
+	Address    string `yaml:"address"`    // Default: "address"
+	City       string `yaml:"city"`
+	PostalCode string `yaml:"postal_code"`
+	Country    string `yaml:"country"`
+}
+
+// CalibrationConfig maps the confidence reported by the AI to the share of
+// reviewed invoices that needed no correction, per provider and field
+type CalibrationConfig struct {
+	Enabled    bool          `yaml:"enabled"`     // Requires storage
+	Method     string        `yaml:"method"`      // "isotonic" (default) or "platt"
+	MinSamples int           `yaml:"min_samples"` // Reviewed invoices needed to fit a provider, else all providers are pooled (default: 50)
+	Interval   time.Duration `yaml:"interval"`    // How often the curves are refitted (default: "1h")
+}
+
+// CategoryLearningConfig represents the learning of vendor categories from
+// corrected invoices
+type CategoryLearningConfig struct {
+	Enabled        bool   `yaml:"enabled"`         // Requires storage
+	Path           string `yaml:"path"`            // JSON file persisting the mappings (empty = in-memory)
+	MinCorrections int    `yaml:"min_corrections"` // Corrections to the same categories before a mapping is applied (default: 1)
+}
+
+// VendorInfo is the company registry entry of an invoice's vendor
+type VendorInfo struct {
+	Found      bool      `json:"found"` // The registry knows the tax ID
+	LegalName  string    `json:"legalName,omitempty"`
+	Address    string    `json:"address,omitempty"`
+	City       string    `json:"city,omitempty"`
+	PostalCode string    `json:"postalCode,omitempty"`
+	Country    string    `json:"country,omitempty"`
+	Error      string    `json:"error,omitempty"` // Set when the lookup failed; Found is then unknown
+	CheckedAt  time.Time `json:"checkedAt"`
+}
+
+// FacturaeConfig represents the settings of Facturae exports. Facturae
+// requires tax IDs, which extraction does not provide, so the seller is
+// configured here: typically your company, submitting the invoices it issued
+// to a public administration (the buyer).
+type FacturaeConfig struct {
+	Seller PartyConfig `yaml:"seller"` // Default: the extracted vendor, which then lacks a tax ID
+
+	// DIR3 codes of the buyer's administrative centres, required by FACe
+	AccountingOffice string `yaml:"accounting_office"` // Oficina contable
+	ManagingBody     string `yaml:"managing_body"`     // Órgano gestor
+	ProcessingUnit   string `yaml:"processing_unit"`   // Unidad tramitadora
+
+	// XAdES signing: the unsigned document is piped to this command, which
+	// must write the signed document to stdout. Empty = unsigned.
+	SignCommand []string      `yaml:"sign_command"`
+	SignTimeout time.Duration `yaml:"sign_timeout"` // Default: "30s"
+}
+
+// IntegrationsConfig represents the accounting systems stored invoices are pushed to
+type IntegrationsConfig struct {
+	Odoo            OdooConfig            `yaml:"odoo"`
+	ReceiptWrangler ReceiptWranglerConfig `yaml:"receipt_wrangler"`
+}
+
+// OdooConfig for pushing invoices to Odoo as vendor bills over JSON-RPC
+type OdooConfig struct {
+	URL           string        `yaml:"url"`             // e.g. "https://acme.odoo.com"; empty = disabled
+	Database      string        `yaml:"database"`        // Odoo database name
+	Username      string        `yaml:"username"`        // Login of the user bills are created as
+	APIKey        string        `yaml:"api_key"`         // API key (or password) of that user
+	APIKeyFile    string        `yaml:"api_key_file"`    // Read the API key from this file instead
+	JournalID     int           `yaml:"journal_id"`      // Purchase journal (default: the company's default)
+	PurchaseTaxID int           `yaml:"purchase_tax_id"` // Tax applied to taxed lines (default: none)
+	AutoPush      bool          `yaml:"auto_push"`       // Push every archived invoice after processing
+	Timeout       time.Duration `yaml:"timeout"`         // Per request (default: "30s")
+}
+
+// ReceiptWranglerConfig for pushing invoices to a Receipt Wrangler instance as receipts
+type ReceiptWranglerConfig struct {
+	URL          string        `yaml:"url"`             // e.g. "https://receipts.example.com"; empty = disabled
+	APIKey       string        `yaml:"api_key"`         // API key of the user receipts are created as
+	APIKeyFile   string        `yaml:"api_key_file"`    // Read the API key from this file instead
+	GroupID      int           `yaml:"group_id"`        // Group receipts are added to
+	PaidByUserID int           `yaml:"paid_by_user_id"` // Payer of receipts, and user their items are charged to
+	Status       string        `yaml:"status"`          // Receipt status (default: "OPEN")
+	AutoPush     bool          `yaml:"auto_push"`       // Push every archived invoice after processing
+	Timeout      time.Duration `yaml:"timeout"`         // Per request (default: "30s")
+}
+
+// WebhooksConfig represents the outbound webhooks
+type WebhooksConfig struct {
+	ReviewThreshold float64         `yaml:"review_threshold"` // invoice.needs_review below this confidence (default: 0.7)
+	Endpoints       []WebhookConfig `yaml:"endpoints"`
+}
+
+// WebhookConfig represents one webhook endpoint
+type WebhookConfig struct {
+	Name        string            `yaml:"name"` // Shown in logs
+	URL         string            `yaml:"url"`
+	Events      []string          `yaml:"events"`       // e.g. ["invoice.processed"]; empty = all events
+	Method      string            `yaml:"method"`       // POST (default), PUT or PATCH
+	Headers     map[string]string `yaml:"headers"`      // e.g. Authorization
+	ContentType string            `yaml:"content_type"` // Default: "application/json"
+	Template    string            `yaml:"template"`     // Go text/template of the body; empty = the event as JSON
+	Timeout     time.Duration     `yaml:"timeout"`      // Per attempt (default: "10s")
+	MaxAttempts int               `yaml:"max_attempts"` // Attempts on network errors, 5xx and 429 (default: 3)
+}
+
+// MailConfig for emailing every processed invoice (JSON, CSV and the original) over SMTP
+type MailConfig struct {
+	Host         string        `yaml:"host"`     // SMTP server; empty = disabled
+	Port         int           `yaml:"port"`     // Default: 587, or 465 with tls: "tls"
+	TLS          string        `yaml:"tls"`      // "starttls" (default), "tls" (implicit) or "none"
+	Username     string        `yaml:"username"` // Empty = no authentication
+	Password     string        `yaml:"password"`
+	PasswordFile string        `yaml:"password_file"` // Read the password from this file instead
+	From         string        `yaml:"from"`          // e.g. "Invoice OCR <ocr@example.com>"
+	To           []string      `yaml:"to"`            // Recipients; none = no mail
+	Timeout      time.Duration `yaml:"timeout"`       // Per message (default: "30s")
+}
+
+// PartyConfig represents a party of an exported invoice
+type PartyConfig struct {
+	Name       string `yaml:"name"`
+	TaxID      string `yaml:"tax_id"` // VAT number, e.g. "ESB12345678"
+	Address    string `yaml:"address"`
+	City       string `yaml:"city"`
+	PostalCode string `yaml:"postal_code"`
+	Province   string `yaml:"province"`
+	Country    string `yaml:"country"` // ISO 3166-1 alpha-2 code, e.g. "ES"
+}
+
+// APIConfig represents API versioning settings
+type APIConfig struct {
+	LegacySunset        string `yaml:"legacy_sunset"`         // Removal date of the unversioned /api routes (YYYY-MM-DD), sent as Sunset
+	DisableLegacyRoutes bool   `yaml:"disable_legacy_routes"` // Serve only /api/v1, e.g. to test clients before the sunset
+}
+
+// GRPCConfig represents the gRPC listener. It shares authentication, rate
+// limits and TLS certificates with the HTTP API.
+type GRPCConfig struct {
+	Enabled          bool `yaml:"enabled"`
+	Port             int  `yaml:"port"`              // Default: 9090
+	BatchConcurrency int  `yaml:"batch_concurrency"` // Invoices of one ProcessInvoices stream processed at once (default: 4)
+}
+
+// TLSConfig represents native TLS termination: a certificate from files or
+// one obtained from Let's Encrypt
+type TLSConfig struct {
+	Enabled    bool           `yaml:"enabled"`
+	CertFile   string         `yaml:"cert_file"`   // PEM certificate chain, reloaded when the file changes
+	KeyFile    string         `yaml:"key_file"`    // PEM private key
+	MinVersion string         `yaml:"min_version"` // "1.2" (default) or "1.3"
+	Autocert   AutocertConfig `yaml:"autocert"`
+}
+
+// AutocertConfig obtains and renews certificates from Let's Encrypt
+type AutocertConfig struct {
+	Domains  []string `yaml:"domains"`   // Hostnames to request certificates for; enables autocert
+	Email    string   `yaml:"email"`     // Contact for expiry notices (optional)
+	CacheDir string   `yaml:"cache_dir"` // Certificate cache (default: "./data/autocert")
+	HTTPAddr string   `yaml:"http_addr"` // Plain HTTP listener for HTTP-01 challenges and redirects, e.g. ":80"
+}
+
+// CORSConfig represents the cross-origin policy for browser clients
+type CORSConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	AllowedOrigins   []string      `yaml:"allowed_origins"`   // Exact origins, "https://*.example.com" or "*"
+	AllowedMethods   []string      `yaml:"allowed_methods"`   // Default: GET, POST, DELETE
+	AllowedHeaders   []string      `yaml:"allowed_headers"`   // Default: Authorization, Content-Type, X-API-Key, X-Request-ID, Accept-Version
+	ExposedHeaders   []string      `yaml:"exposed_headers"`   // Default: X-Request-ID, rate limit headers, Retry-After, Location
+	AllowCredentials bool          `yaml:"allow_credentials"` // Allow cookies and HTTP auth; not with "*"
+	MaxAge           time.Duration `yaml:"max_age"`           // Preflight cache lifetime (default: "10m")
+}
+
+// CompressionConfig represents gzip/deflate compression of JSON responses
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	MinSize int  `yaml:"min_size"` // Smallest body worth compressing in bytes (default: 1024)
+	Level   int  `yaml:"level"`    // 1 (fastest) to 9 (smallest), default: 6
+}
+
+// ScriptRule represents a validation or normalization rule written in the
+// expr language (https://expr-lang.org), applied after extraction
+type ScriptRule struct {
+	Name   string            `yaml:"name"`
+	When   string            `yaml:"when"`   // Boolean expression; empty applies the rule to every invoice
+	Set    map[string]string `yaml:"set"`    // Field to expression: vendor, date, total, tax, categories or confidence
+	Reject string            `yaml:"reject"` // Refuse the document with this reason instead
+}
+
+// HookConfig represents a pipeline hook implemented by an external command
+type HookConfig struct {
+	Name    string        `yaml:"name"`
+	Command []string      `yaml:"command"` // Program and arguments; exchanges JSON over stdin and stdout
+	Stages  []string      `yaml:"stages"`  // pre_ocr, post_ocr and/or post_extract
+	Timeout time.Duration `yaml:"timeout"` // Per call (default: "30s")
+}
+
+// RulesConfig represents per-vendor extraction rules applied to the OCR text
+type RulesConfig struct {
+	File               string       `yaml:"file"`                // YAML file with a "vendors" list, re-read on reload
+	Vendors            []VendorRule `yaml:"vendors"`             // Inline rules, tried before those of File
+	MismatchConfidence float64      `yaml:"mismatch_confidence"` // Confidence cap when the AI disagrees with a crosscheck rule (default: 0.5)
+}
+
+// VendorRule extracts the fields of one vendor's documents with regular expressions
+type VendorRule struct {
+	Name       string     `yaml:"name"`
+	Match      string     `yaml:"match"`      // Regex on the OCR text identifying the vendor
+	Mode       string     `yaml:"mode"`       // crosscheck (default): compare with the AI; bypass: skip the AI
+	Vendor     string     `yaml:"vendor"`     // Vendor name reported (default: Name)
+	Categories []string   `yaml:"categories"` // Reported categories with bypass
+	Total      *FieldRule `yaml:"total"`
+	Tax        *FieldRule `yaml:"tax"`
+	Date       *FieldRule `yaml:"date"`
+}
+
+// FieldRule finds a field value in the OCR text
+type FieldRule struct {
+	Pattern  string `yaml:"pattern"`   // Regex; the first capture group, or the whole match, is the value
+	FromLine int    `yaml:"from_line"` // Zone: first OCR line searched, 1-based; negative counts from the end
+	ToLine   int    `yaml:"to_line"`   // Zone: last OCR line searched; 0 = the last line
+	Last     bool   `yaml:"last"`      // Use the last match instead of the first
+	Decimal  string `yaml:"decimal"`   // Amounts: decimal separator, "." (default) or ","
+	Layout   string `yaml:"layout"`    // Dates: Go layout, e.g. "02/01/2006" (default: "2006-01-02")
+}
+
+// UIConfig represents the embedded review web UI served at /ui/
+type UIConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// LoggingConfig represents log output settings
+type LoggingConfig struct {
+	Level  string `yaml:"level"`  // debug, info (default), warn or error
+	Format string `yaml:"format"` // text (default) or json
+}
+
+// TracingConfig represents OpenTelemetry trace export settings
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP collector host:port (empty = OTEL_EXPORTER_OTLP_ENDPOINT)
+	Insecure    bool    `yaml:"insecure"`     // Plain HTTP to the collector
+	ServiceName string  `yaml:"service_name"` // Default: "invoice-ocr-service"
+	SampleRatio float64 `yaml:"sample_ratio"` // Fraction of traces sampled, 0 = all
+}
+
+// HealthConfig represents health and readiness probe settings
+type HealthConfig struct {
+	CacheTTL time.Duration `yaml:"cache_ttl"` // Reuse dependency check results this long (default: "30s")
+	SelfTest bool          `yaml:"selftest"`  // Process a sample receipt at startup; /ready fails until it passes
+}
+
+// ReloadConfig represents config hot-reload settings (SIGHUP always reloads)
+type ReloadConfig struct {
+	WatchInterval time.Duration `yaml:"watch_interval"` // Check the config file for changes this often (0 disables watching)
+}
+
+// SecretsConfig represents the external secret stores
+type SecretsConfig struct {
+	Vault VaultConfig      `yaml:"vault"`
+	AWS   AWSSecretsConfig `yaml:"aws"`
+}
+
+// VaultConfig for HashiCorp Vault (KV v1 or v2)
+type VaultConfig struct {
+	Address   string        `yaml:"address"`    // e.g. "https://vault.example.com:8200" (default: VAULT_ADDR)
+	Token     string        `yaml:"token"`      // Default: VAULT_TOKEN
+	TokenFile string        `yaml:"token_file"` // Read the token from this file instead
+	Namespace string        `yaml:"namespace"`  // Vault Enterprise namespace (optional)
+	Timeout   time.Duration `yaml:"timeout"`    // Per request (default: "10s")
+}
+
+// AWSSecretsConfig for AWS Secrets Manager; credentials come from the default AWS chain
+type AWSSecretsConfig struct {
+	Region string `yaml:"region"` // Default: AWS_REGION
 }
 
 // OCRConfig represents OCR-specific configuration
 type OCRConfig struct {
-	Engine   string `yaml:"engine"` // "tesseract" or "easyocr"
+	Engine   string `yaml:"engine"`   // "tesseract" or "easyocr"
 	Language string `yaml:"language"` // OCR language (default: "eng")
+
+	PageParallelism  int  `yaml:"page_parallelism"`  // Pages of a multi-page document OCR'd at once (default: 4)
+	LanguageFallback bool `yaml:"language_fallback"` // Use "eng" when the requested language is not installed instead of failing
+
+	Correction  CorrectionConfig  `yaml:"correction"`  // Fixes OCR confusions before vendor rules and the AI
+	Retry       OCRRetryConfig    `yaml:"retry"`       // Runs OCR again with other settings when its confidence is low
+	Handwriting HandwritingConfig `yaml:"handwriting"` // Reads the document again with a vision model when its total may be handwritten
+}
+
+// HandwritingConfig represents the vision model reading of documents whose
+// total OCR may have missed because it is handwritten
+type HandwritingConfig struct {
+	Below    float64 `yaml:"below"`    // Read again when the extraction's confidence (0-1) is below this or its total is not in the OCR text; 0 disables
+	Provider string  `yaml:"provider"` // Vision provider (default: the request's)
+	Model    string  `yaml:"model"`    // Vision model (default: the provider's)
+}
+
+// OCRRetryConfig represents the OCR retries of low-confidence text
+type OCRRetryConfig struct {
+	Below      float64  `yaml:"below"`      // Retry when the mean word confidence (0-1) is below this; 0 disables
+	Strategies []string `yaml:"strategies"` // Tried in order: "single_block", "single_column", "inverted", "unprocessed" (default: all)
+}
+
+// CorrectionConfig represents the post-OCR text correction pass
+type CorrectionConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Passes   []string `yaml:"passes"`   // "amounts" and/or "split_words" (default: both)
+	Keywords []string `yaml:"keywords"` // Added to the built-in words split out of joined words, e.g. "propina"
+}
+
+// ClassifierConfig represents the classification of documents as invoices,
+// receipts or other documents before the AI stage
+type ClassifierConfig struct {
+	Enabled bool              `yaml:"enabled"`
+	Reject  bool              `yaml:"reject"`  // Fail documents that are neither invoices nor receipts with not_an_invoice
+	Prompts map[string]string `yaml:"prompts"` // Prompt template by document type ("invoice", "receipt"), used instead of prompt
+}
+
+// ProfileConfig represents a prompt profile: the prompt and extra fields of
+// one kind of document. A profile named like a built-in one replaces it.
+type ProfileConfig struct {
+	Name     string         `yaml:"name"`     // Requested as "profile", e.g. "fuel_receipt"
+	Type     string         `yaml:"type"`     // Classifier type it refines: "invoice", "receipt" or empty for both
+	Keywords []string       `yaml:"keywords"` // The classifier picks the profile for text containing any of these words
+	Prompt   string         `yaml:"prompt"`   // Prompt template; empty keeps the prompt otherwise used
+	Fields   []ProfileField `yaml:"fields"`   // Asked for in addition to the standard fields, returned in "fields"
+	Kind     string         `yaml:"kind"`     // Typed details asked for, one of Kinds, e.g. "fuel"; empty for none
+}
+
+// ProfileField represents an extra field of a prompt profile
+type ProfileField struct {
+	Name        string `yaml:"name"`        // JSON key, e.g. "liters"
+	Type        string `yaml:"type"`        // One of the FieldType constants (default: string)
+	Description string `yaml:"description"` // Told to the model
+}
+
+// Types of profile fields
+const (
+	FieldTypeString  = "string"
+	FieldTypeNumber  = "number"
+	FieldTypeInteger = "integer"
+	FieldTypeBoolean = "boolean"
+	FieldTypeDate    = "date" // YYYY-MM-DD
+)
+
+// CatalogConfig represents the product catalog extracted line items are
+// matched to by name
+type CatalogConfig struct {
+	File     string  `yaml:"file"`      // CSV with "sku" and "name" columns and optional "aliases" ("|"-separated); empty = disabled
+	MinScore float64 `yaml:"min_score"` // Name similarity from 0 to 1 a match needs (default: 0.7)
+}
+
+// EXIFConfig represents the handling of photo EXIF metadata
+type EXIFConfig struct {
+	Capture bool `yaml:"capture"` // Add the capture time and GPS position of photos to invoices as "photo"
+	Strip   bool `yaml:"strip"`   // Remove metadata from images before they are stored or sent to AI providers
+}
+
+// StorageConfig represents invoice archive configuration
+type StorageConfig struct {
+	Enabled bool   `yaml:"enabled"` // Persist invoices and original images
+	Path    string `yaml:"path"`    // Directory for stored artifacts (default: "./data/invoices")
+
+	// Encryption at rest: AES-256 key as 64 hex chars or base64 (e.g. "${STORAGE_ENCRYPTION_KEY}")
+	EncryptionKey     string `yaml:"encryption_key"`
+	EncryptionKeyFile string `yaml:"encryption_key_file"` // Read the key from this file instead
+
+	// Retention policy for original images and raw OCR text (0 keeps them forever)
+	ArtifactTTL   time.Duration `yaml:"artifact_ttl"`   // e.g. "720h"
+	PurgeInterval time.Duration `yaml:"purge_interval"` // Default: "1h"
+}
+
+// AuthConfig represents API authentication configuration
+type AuthConfig struct {
+	Enabled bool           `yaml:"enabled"`  // Require credentials on /api/* routes
+	Mode    string         `yaml:"mode"`     // "api_key" (default), "jwt" or "both"
+	APIKeys []APIKeyConfig `yaml:"api_keys"` // Static keys
+	JWT     JWTConfig      `yaml:"jwt"`      // Bearer JWT validation
+}
+
+// APIKeyConfig defines a named API key
+type APIKeyConfig struct {
+	Name    string       `yaml:"name"`     // Identifies the caller in logs
+	Key     string       `yaml:"key"`      // Secret, e.g. "${BILLING_API_KEY}"
+	KeyFile string       `yaml:"key_file"` // Read the secret from this file instead
+	Admin   bool         `yaml:"admin"`    // May manage keys via /api/keys
+	Tenant  string       `yaml:"tenant"`   // Tenant the key belongs to (optional)
+	Quota   *QuotaConfig `yaml:"quota"`    // Overrides usage.default_quota for this key
+}
+
+// JWTConfig defines how bearer JWTs from an OIDC identity provider are validated
+type JWTConfig struct {
+	JWKSURL     string        `yaml:"jwks_url"`     // e.g. "https://idp.example.com/.well-known/jwks.json"
+	Issuer      string        `yaml:"issuer"`       // Required "iss" value (optional)
+	Audience    string        `yaml:"audience"`     // Required "aud" entry (optional)
+	NameClaim   string        `yaml:"name_claim"`   // Claim identifying the caller (default: "sub")
+	AdminClaim  string        `yaml:"admin_claim"`  // Claim granting key management, e.g. "roles"
+	AdminValue  string        `yaml:"admin_value"`  // Value of AdminClaim that grants admin
+	JWKSRefresh time.Duration `yaml:"jwks_refresh"` // JWKS cache lifetime (default: "1h")
+	TenantClaim string        `yaml:"tenant_claim"` // Claim holding the tenant ID, e.g. "tenant"
+}
+
+// RateLimitConfig represents token-bucket rate limiting on /api/* routes
+type RateLimitConfig struct {
+	Enabled    bool            `yaml:"enabled"`
+	PerKey     RateLimitBucket `yaml:"per_key"`     // Per API key / token subject
+	PerIP      RateLimitBucket `yaml:"per_ip"`      // Per client IP
+	TrustProxy bool            `yaml:"trust_proxy"` // Use X-Forwarded-For for the client IP
+	ProxyHops  int             `yaml:"proxy_hops"`  // Trusted proxies appending to X-Forwarded-For (default: 1)
+}
+
+// RateLimitBucket defines a token bucket (0 requests disables the limit)
+type RateLimitBucket struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"` // Default: requests_per_minute
+}
+
+// ConcurrencyConfig bounds concurrent OCR/AI processing
+type ConcurrencyConfig struct {
+	MaxInFlight  int           `yaml:"max_in_flight"` // Concurrent processing requests (0 = unlimited)
+	MaxQueue     int           `yaml:"max_queue"`     // Requests allowed to wait for a slot
+	QueueTimeout time.Duration `yaml:"queue_timeout"` // Max wait for a slot (default: "30s")
+	RetryAfter   time.Duration `yaml:"retry_after"`   // Retry-After sent with 503 (default: "5s")
+
+	// Slots batch work (async jobs, gRPC batch streams, X-Priority: batch)
+	// may hold at once, the rest being kept for interactive requests
+	// (default: half of MaxInFlight)
+	BatchMaxInFlight int `yaml:"batch_max_in_flight"`
+
+	// Estimated memory of the images being processed at once, in MB (0 =
+	// unlimited). Requests wait up to QueueTimeout for memory to be released.
+	MemoryLimitMB int `yaml:"memory_limit_mb"`
+}
+
+// UploadsConfig represents the limits of uploads and how they are buffered
+type UploadsConfig struct {
+	MaxSizeMB        int      `yaml:"max_size_mb"`        // Largest accepted upload (default: 10)
+	AllowedTypes     []string `yaml:"allowed_types"`      // Accepted content types, sniffed from the bytes; "image/*" allows all images (default: JPEG, PNG, WebP, GIF, BMP, TIFF, HEIC and PDF)
+	SpoolThresholdKB int      `yaml:"spool_threshold_kb"` // Uploads above this are written to a temp file in $TMPDIR while read (default: 1024)
+}
+
+// TimeoutConfig represents request and pipeline stage timeouts (0 = no timeout)
+type TimeoutConfig struct {
+	Default   time.Duration            `yaml:"default"`   // Applied to /api endpoints without their own timeout
+	Endpoints map[string]time.Duration `yaml:"endpoints"` // Per route, e.g. "/api/v1/process-invoice": "90s"
+	AI        time.Duration            `yaml:"ai"`        // Limit of the AI stage alone
+	Job       time.Duration            `yaml:"job"`       // Limit of one async job attempt
+}
+
+// JobsConfig represents the async job queue and worker pool
+type JobsConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Backend       string        `yaml:"backend"`        // "memory" (default), "redis" or "nats"
+	Workers       int           `yaml:"workers"`        // Concurrent workers (default: 1)
+	QueueCapacity int           `yaml:"queue_capacity"` // Pending jobs held by the memory backend
+	MaxAttempts   int           `yaml:"max_attempts"`   // Attempts before dead-lettering (default: 3)
+	RetryBackoff  time.Duration `yaml:"retry_backoff"`  // First retry delay, doubled per attempt (default: "10s")
+	MaxBackoff    time.Duration `yaml:"max_backoff"`    // Upper bound of the retry delay
+	LeaseDuration time.Duration `yaml:"lease_duration"` // Redis and NATS: a job whose worker stops renewing it for this long goes to another instance (default: "60s")
+	FinishedTTL   time.Duration `yaml:"finished_ttl"`   // Redis: succeeded and dead-lettered jobs are deleted this long after finishing (default: "168h")
+	Redis         RedisConfig   `yaml:"redis"`
+	NATS          NATSConfig    `yaml:"nats"`
+}
+
+// RedisConfig for the Redis job queue backend
+type RedisConfig struct {
+	Addr         string `yaml:"addr"` // e.g. "localhost:6379"
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"` // Read the password from this file instead
+	DB           int    `yaml:"db"`
+	Prefix       string `yaml:"prefix"` // Key prefix (default: "invoice-ocr")
+}
+
+// NATSConfig for the NATS JetStream job queue backend
+type NATSConfig struct {
+	URL    string `yaml:"url"`    // e.g. "nats://localhost:4222"
+	Prefix string `yaml:"prefix"` // Stream and bucket prefix (default: "invoice-ocr")
+}
+
+// UsageConfig represents per-caller usage accounting and quotas
+type UsageConfig struct {
+	Enabled      bool                  `yaml:"enabled"`
+	Path         string                `yaml:"path"`          // JSON file persisting totals (empty = in-memory)
+	Prices       map[string]ModelPrice `yaml:"prices"`        // Keyed by "provider/model", model name or provider, most specific first
+	DefaultQuota QuotaConfig           `yaml:"default_quota"` // Applies to callers without their own quota
+	Budget       BudgetConfig          `yaml:"budget"`        // Service-wide spend limits
+}
+
+// BudgetConfig represents service-wide limits on the estimated AI spend
+type BudgetConfig struct {
+	Daily      float64        `yaml:"daily"`      // USD per UTC day, 0 = unlimited
+	Monthly    float64        `yaml:"monthly"`    // USD per UTC month, 0 = unlimited
+	Thresholds []float64      `yaml:"thresholds"` // Fractions of a limit that fire budget.threshold (default: [0.8, 1])
+	Path       string         `yaml:"path"`       // JSON file persisting spend (empty = in-memory)
+	Fallback   BudgetFallback `yaml:"fallback"`   // Used once a limit is reached; empty keeps extracting as requested
+}
+
+// BudgetFallback is the cheaper provider and model used over budget
+type BudgetFallback struct {
+	Provider string `yaml:"provider"` // Default: the requested provider
+	Model    string `yaml:"model"`    // Default: the provider's configured model
+}
+
+// PolicyViolation reports that the stored invoices of a category, an invoice
+// included, add up to more than a monthly limit of the expense policy
+type PolicyViolation struct {
+	Rule     string          `json:"rule"` // "monthly_limit"
+	Category string          `json:"category"`
+	Month    string          `json:"month"` // "2006-01", of the invoice date
+	Limit    decimal.Decimal `json:"limit"`
+	Spent    decimal.Decimal `json:"spent"`
+	Message  string          `json:"message"`
+}
+
+// BudgetAlert reports that the estimated spend reached a threshold of a budget limit
+type BudgetAlert struct {
+	Period    string  `json:"period"`    // "daily" or "monthly"
+	Threshold float64 `json:"threshold"` // Fraction of the limit, e.g. 0.8
+	Limit     float64 `json:"limit"`     // USD
+	Spend     float64 `json:"spend"`     // USD, including the call that reached the threshold
+}
+
+// ModelPrice is the USD price per 1000 tokens of a model
+type ModelPrice struct {
+	InputPer1K  float64 `yaml:"input_per_1k"`
+	OutputPer1K float64 `yaml:"output_per_1k"`
+}
+
+// QuotaConfig defines monthly limits (0 = unlimited)
+type QuotaConfig struct {
+	Requests int     `yaml:"requests"`
+	Pages    int     `yaml:"pages"`
+	Tokens   int     `yaml:"tokens"`
+	Cost     float64 `yaml:"cost"` // USD
 }
 
 // AIConfig represents AI provider configuration
@@ -93,25 +1162,91 @@ type AIConfig struct {
 	// Ollama (local)
 	Ollama OllamaConfig `yaml:"ollama"`
 
+	// User-supplied extractor, run as a command or called over HTTP
+	External ExternalConfig `yaml:"external"`
+
 	// Default provider
-	DefaultProvider string `yaml:"default_provider"` // "openai", "gemini", "ollama"
+	DefaultProvider string `yaml:"default_provider"` // "openai", "gemini", "ollama", "external"
+
+	// Confidence of an extraction when neither OCR nor the model gives one,
+	// e.g. a vision run with a custom prompt (default: 0.85)
+	UnknownConfidence float64 `yaml:"unknown_confidence"`
+
+	// Record provider responses to fixtures, or replay them (tests and CI)
+	Recording RecordingConfig `yaml:"recording"`
+
+	// Secondary provider compared in the background, e.g. before a migration
+	Shadow ShadowConfig `yaml:"shadow"`
+}
+
+// ResidencyConfig represents a data-residency policy: the AI providers that
+// documents and their OCR text may be sent to
+type ResidencyConfig struct {
+	Policy    string                    `yaml:"policy"`    // Name shown in /api/v1/providers, e.g. "eu-only"
+	Providers []ResidencyProviderConfig `yaml:"providers"` // Allowed providers; empty allows every provider
+}
+
+// OfflineConfig represents the air-gapped mode
+type OfflineConfig struct {
+	Enabled      bool     `yaml:"enabled"`       // Only Ollama may extract, and HTTP requests may only go to local hosts
+	AllowedHosts []string `yaml:"allowed_hosts"` // Further hosts requests may go to, e.g. an Ollama server: names, IPs or CIDR blocks
+}
+
+// ResidencyProviderConfig represents a provider allowed by the residency policy
+type ResidencyProviderConfig struct {
+	Name  string   `yaml:"name"`  // openai, gemini, ollama or external
+	Hosts []string `yaml:"hosts"` // Endpoint hosts it may use, "*.example.com" for subdomains; empty allows any
+}
+
+// ShadowConfig represents shadow extractions with a secondary provider. They
+// only produce log entries and never change a response.
+type ShadowConfig struct {
+	Provider      string  `yaml:"provider"`       // openai, gemini or ollama; empty disables shadowing
+	Model         string  `yaml:"model"`          // Default: the provider's configured model
+	Percent       float64 `yaml:"percent"`        // Share of successful extractions to shadow, 0-100
+	MaxConcurrent int     `yaml:"max_concurrent"` // Shadow runs at once; more are skipped (default: 4)
+}
+
+// RecordingConfig represents recording and replaying of provider HTTP exchanges
+type RecordingConfig struct {
+	Mode string `yaml:"mode"` // "record" or "replay"; empty calls providers normally
+	Dir  string `yaml:"dir"`  // Fixture directory
 }
 
 // OpenAIConfig for OpenAI/Azure OpenAI
 type OpenAIConfig struct {
-	APIKey  string `yaml:"api_key"`
-	BaseURL string `yaml:"base_url,omitempty"` // For custom endpoints
-	Model   string `yaml:"model"`              // Default: "gpt-4"
+	APIKey     string `yaml:"api_key"`
+	APIKeyFile string `yaml:"api_key_file,omitempty"` // Read the key from this file instead
+	BaseURL    string `yaml:"base_url,omitempty"`     // For custom endpoints
+	Model      string `yaml:"model"`                  // Default: "gpt-4"
+
+	// Vision defaults, overridden per request by imageDetail and maxImageTokens
+	ImageDetail    string `yaml:"image_detail"`     // "low", "high" or "auto" (default)
+	MaxImageTokens int    `yaml:"max_image_tokens"` // 0 = no budget
 }
 
 // GeminiConfig for Google Gemini
 type GeminiConfig struct {
-	APIKey string `yaml:"api_key"`
-	Model  string `yaml:"model"` // Default: "gemini-pro"
+	APIKey     string `yaml:"api_key"`
+	APIKeyFile string `yaml:"api_key_file,omitempty"` // Read the key from this file instead
+	Model      string `yaml:"model"`                  // Default: "gemini-pro"
 }
 
 // OllamaConfig for local Ollama
 type OllamaConfig struct {
-	BaseURL string `yaml:"base_url"` // Default: "http://localhost:11434"
-	Model   string `yaml:"model"`    // e.g., "mistral", "llama2"
+	BaseURL   string `yaml:"base_url"`   // Default: "http://localhost:11434"
+	Model     string `yaml:"model"`      // e.g., "mistral", "llama2"
+	KeepAlive string `yaml:"keep_alive"` // How long the model stays loaded after a request, e.g. "30m"; "-1m" keeps it loaded. Default: Ollama's (5m)
+	AutoPull  bool   `yaml:"auto_pull"`  // Pull the model on startup when it is not installed
+}
+
+// ExternalConfig represents an extractor outside the service, e.g. a
+// proprietary model. Command and URL receive the same JSON request.
+type ExternalConfig struct {
+	Command []string          `yaml:"command"` // Program and arguments; the request is written to stdin, the response read from stdout
+	URL     string            `yaml:"url"`     // Or an endpoint the request is POSTed to
+	Headers map[string]string `yaml:"headers"` // Added to HTTP requests, e.g. Authorization
+	Model   string            `yaml:"model"`   // Passed through in requests
+	Timeout time.Duration     `yaml:"timeout"` // Per call (default: "60s")
+	Vision  bool              `yaml:"vision"`  // Whether the extractor accepts images
 }
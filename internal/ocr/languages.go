@@ -0,0 +1,71 @@
+package ocr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/otiai10/gosseract/v2"
+)
+
+// LanguageError reports a Tesseract language without installed language data
+type LanguageError struct {
+	Language  string   // As requested, e.g. "eng+spa"
+	Missing   []string // Languages of Language without a traineddata file
+	Installed []string // Languages that can be used instead
+}
+
+func (e *LanguageError) Error() string {
+	return fmt.Sprintf("tesseract language not installed: %s (installed: %s)",
+		strings.Join(e.Missing, ", "), strings.Join(e.Installed, ", "))
+}
+
+// InstalledLanguages returns the languages with Tesseract data in the default
+// tessdata directory, sorted
+func InstalledLanguages() ([]string, error) {
+	found, err := gosseract.GetAvailableLanguages()
+	if err != nil {
+		return nil, err
+	}
+	return readable(found), nil
+}
+
+// readable returns the languages that can read text, sorted. The orientation
+// and script data ("osd") is left out.
+func readable(found []string) []string {
+	languages := make([]string, 0, len(found))
+	for _, language := range found {
+		if language != "osd" {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// CheckLanguage returns a *LanguageError when a language of spec, e.g.
+// "eng+spa", is not installed. When no installed languages can be found, e.g.
+// because Tesseract reads its data from an unusual place, the check is left
+// to Tesseract.
+func CheckLanguage(spec string) error {
+	found, err := gosseract.GetAvailableLanguages()
+	if err != nil || len(found) == 0 {
+		return nil
+	}
+	installed := make(map[string]bool, len(found))
+	for _, language := range found {
+		installed[language] = true
+	}
+
+	var missing []string
+	for _, language := range strings.Split(spec, "+") {
+		language = strings.TrimSpace(language)
+		if language != "" && !installed[language] {
+			missing = append(missing, language)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &LanguageError{Language: spec, Missing: missing, Installed: readable(found)}
+}
@@ -0,0 +1,10 @@
+package ocr
+
+// ImageMagick is used in one of two ways, chosen at build time. By default
+// the service links the MagickWand 7 library (magick_wand.go and the other
+// _wand.go files). Built with -tags magickcli, it runs the ImageMagick
+// programs instead (the _cli.go files), which works with ImageMagick 6 as
+// packaged by Debian and Ubuntu and needs no development files.
+
+// requiredFormats are the image formats preprocessing needs a coder for
+var requiredFormats = []string{"JPEG", "PNG"}
@@ -0,0 +1,160 @@
+//go:build magickcli
+
+package ocr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// magickTool is a way of running ImageMagick: IM7's magick, or IM6's convert
+// and identify
+type magickTool struct {
+	convert  []string
+	identify []string
+}
+
+// magickTools are tried in order. On Windows convert.exe is a disk tool, so
+// a convert is only used when it reports itself as ImageMagick.
+var magickTools = []magickTool{
+	{convert: []string{"magick"}, identify: []string{"magick", "identify"}},
+	{convert: []string{"convert"}, identify: []string{"identify"}},
+}
+
+var (
+	magickOnce    sync.Once
+	magick        magickTool
+	magickVersion string
+	magickFormats map[string]bool // Formats ImageMagick can read
+	errNoMagick   = errors.New("ImageMagick not found: install ImageMagick 6 (convert) or 7 (magick)")
+)
+
+// InitMagick finds the ImageMagick programs once for the life of the process.
+// It is safe to call from several goroutines, and every function of this
+// package calls it.
+func InitMagick() {
+	magickOnce.Do(findMagick)
+}
+
+// findMagick picks the first of magickTools that runs and is ImageMagick
+func findMagick() {
+	for _, tool := range magickTools {
+		out, err := run(tool.convert, nil, []string{"-version"})
+		if err != nil {
+			continue
+		}
+		line, _, _ := strings.Cut(string(out), "\n")
+		if !strings.Contains(line, "ImageMagick") {
+			continue
+		}
+		magick = tool
+		magickVersion = strings.TrimSpace(strings.TrimPrefix(line, "Version:"))
+		break
+	}
+	if magick.convert == nil {
+		return
+	}
+
+	magickFormats = make(map[string]bool)
+	out, err := run(magick.convert, nil, []string{"-list", "format"})
+	if err != nil {
+		return
+	}
+	// Lines are e.g. "     JPEG* JPEG      rw-   Joint Photographic Experts Group JFIF format"
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && strings.HasPrefix(fields[2], "r") {
+			magickFormats[strings.TrimRight(fields[0], "*")] = true
+		}
+	}
+}
+
+// MagickVersion returns the version of the ImageMagick programs found, empty
+// when there are none
+func MagickVersion() string {
+	InitMagick()
+	return magickVersion
+}
+
+// MissingFormats returns the required formats ImageMagick cannot read, e.g.
+// when it was built without libjpeg, or all of them without ImageMagick
+func MissingFormats() []string {
+	InitMagick()
+	var missing []string
+	for _, format := range requiredFormats {
+		if !magickFormats[format] {
+			missing = append(missing, format)
+		}
+	}
+	return missing
+}
+
+// Dimensions returns the width and height of an image in pixels. Only the
+// header is read, so it is cheap on large uploads.
+func Dimensions(image []byte) (width, height uint, err error) {
+	out, err := runIdentify(image, "-ping", "-format", "%w %h\n", "-")
+	if err != nil {
+		return 0, 0, err
+	}
+	w, h, err := parseSize(out)
+	return uint(w), uint(h), err
+}
+
+// RunMagick runs convert (IM6) or magick (IM7) with input on its standard
+// input, where "-" reads it, and returns the standard output. It is only
+// built with the magickcli tag.
+func RunMagick(input []byte, args ...string) ([]byte, error) {
+	InitMagick()
+	if magick.convert == nil {
+		return nil, errNoMagick
+	}
+	return run(magick.convert, input, args)
+}
+
+// runIdentify runs identify like RunMagick
+func runIdentify(input []byte, args ...string) ([]byte, error) {
+	InitMagick()
+	if magick.identify == nil {
+		return nil, errNoMagick
+	}
+	return run(magick.identify, input, args)
+}
+
+// run runs command with args, feeding it input unless input is nil
+func run(command []string, input []byte, args []string) ([]byte, error) {
+	cmd := exec.Command(command[0], append(command[1:len(command):len(command)], args...)...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s: %w: %s", command[0], err, message)
+		}
+		return nil, fmt.Errorf("%s: %w", command[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// parseSize reads the first "width height" line of -format "%w %h\n" output
+func parseSize(out []byte) (width, height int, err error) {
+	line, _, _ := strings.Cut(string(out), "\n")
+	w, h, ok := strings.Cut(strings.TrimSpace(line), " ")
+	if ok {
+		width, err = strconv.Atoi(w)
+		if err == nil {
+			height, err = strconv.Atoi(h)
+		}
+	}
+	if !ok || err != nil {
+		return 0, 0, fmt.Errorf("unexpected image size %q", line)
+	}
+	return width, height, nil
+}
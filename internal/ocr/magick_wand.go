@@ -0,0 +1,56 @@
+//go:build !magickcli
+
+package ocr
+
+import (
+	"sync"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+var magickOnce sync.Once
+
+// InitMagick initializes ImageMagick once for the life of the process. It is
+// safe to call from several goroutines, and every function of this package
+// calls it. ImageMagick is never terminated: wands of concurrent requests and
+// pages may be in use at any time until the process exits.
+func InitMagick() {
+	magickOnce.Do(imagick.Initialize)
+}
+
+// MagickVersion returns the version of the ImageMagick library the service is
+// linked against. Preprocessing never runs the ImageMagick programs, so this
+// is what matters rather than whether convert (IM6, and an unrelated disk
+// tool on Windows) or magick (IM7) is on the PATH.
+func MagickVersion() string {
+	InitMagick()
+	version, _ := imagick.GetVersion()
+	return version
+}
+
+// MissingFormats returns the required formats the linked ImageMagick cannot
+// read, e.g. when it was built without libjpeg
+func MissingFormats() []string {
+	InitMagick()
+	var missing []string
+	for _, format := range requiredFormats {
+		if len(imagick.QueryFormats(format)) == 0 {
+			missing = append(missing, format)
+		}
+	}
+	return missing
+}
+
+// Dimensions returns the width and height of an image in pixels. Only the
+// header is read, so it is cheap on large uploads.
+func Dimensions(image []byte) (width, height uint, err error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	if err := mw.PingImageBlob(image); err != nil {
+		return 0, 0, err
+	}
+	return mw.GetImageWidth(), mw.GetImageHeight(), nil
+}
@@ -0,0 +1,19 @@
+package ocr
+
+import "fmt"
+
+// pageDensity is the resolution PDF pages are rendered at, in DPI
+const pageDensity = 300
+
+// checkPages validates 1-based page numbers against a document of count
+// pages. whole reports that they select every page in order.
+func checkPages(numbers []int, count int) (whole bool, err error) {
+	whole = len(numbers) == count
+	for i, n := range numbers {
+		if n < 1 || n > count {
+			return false, fmt.Errorf("page %d out of range: the document has %d pages", n, count)
+		}
+		whole = whole && n == i+1
+	}
+	return whole, nil
+}
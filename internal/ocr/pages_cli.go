@@ -0,0 +1,117 @@
+//go:build magickcli
+
+package ocr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+)
+
+// SplitPages returns each page of a multi-page upload (PDF or multi-page
+// TIFF) as a PNG image. Single images are returned as one page, unchanged.
+func SplitPages(data []byte) ([][]byte, error) {
+	dir, files, err := writePages(data, "png")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if len(files) <= 1 {
+		return [][]byte{data}, nil
+	}
+	pages := make([][]byte, 0, len(files))
+	for i, file := range files {
+		blob, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i+1, err)
+		}
+		if len(blob) == 0 {
+			return nil, fmt.Errorf("page %d: rendered image is empty", i+1)
+		}
+		pages = append(pages, blob)
+	}
+	return pages, nil
+}
+
+// SelectPages returns a document of the upload's format holding only the
+// given 1-based pages of a multi-page upload, in the order given. PDF pages
+// are re-encoded as images at the rendering resolution. The upload is
+// returned unchanged when it has one page or all pages are selected in order.
+func SelectPages(data []byte, numbers []int) ([]byte, error) {
+	format := ""
+	switch imagedata.DetectMIMEType(data) {
+	case "application/pdf":
+		format = "pdf"
+	case "image/tiff":
+		format = "tiff"
+	case "image/gif":
+		format = "gif"
+	}
+
+	// Pages are kept losslessly until the document is written
+	dir, files, err := writePages(data, "miff")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	whole, err := checkPages(numbers, len(files))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) <= 1 || whole {
+		return data, nil
+	}
+	if format == "" {
+		return nil, fmt.Errorf("unsupported multi-page format %s", imagedata.DetectMIMEType(data))
+	}
+
+	args := make([]string, 0, len(numbers)+1)
+	for _, n := range numbers {
+		args = append(args, "miff:"+files[n-1])
+	}
+	blob, err := RunMagick(nil, append(args, format+":-")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write selected pages: %w", err)
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("selected pages rendered empty")
+	}
+	return blob, nil
+}
+
+// writePages renders every page of a document to its own file of the given
+// format in a new temporary directory, which the caller removes. Paths carry
+// an explicit format prefix, so ImageMagick does not take a Windows drive
+// letter for one.
+func writePages(data []byte, format string) (dir string, files []string, err error) {
+	dir, err = os.MkdirTemp("", "pages-")
+	if err != nil {
+		return "", nil, err
+	}
+	// Density must come before the input for PDFs to render sharp enough for OCR
+	density := strconv.Itoa(pageDensity)
+	target := format + ":" + filepath.Join(dir, "page-%04d."+format)
+	if _, err := RunMagick(data, "-density", density, "-", "+adjoin", target); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	// Names are zero-padded, and ReadDir sorts them
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "page-") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return dir, files, nil
+}
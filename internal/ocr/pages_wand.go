@@ -0,0 +1,98 @@
+//go:build !magickcli
+
+package ocr
+
+import (
+	"fmt"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// SplitPages returns each page of a multi-page upload (PDF or multi-page
+// TIFF) as a PNG image. Single images are returned as one page, unchanged.
+func SplitPages(data []byte) ([][]byte, error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	// Must be set before reading for PDFs to render sharp enough for OCR
+	if err := mw.SetResolution(pageDensity, pageDensity); err != nil {
+		return nil, fmt.Errorf("failed to set resolution: %w", err)
+	}
+	if err := mw.ReadImageBlob(data); err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	count := int(mw.GetNumberImages())
+	if count <= 1 {
+		return [][]byte{data}, nil
+	}
+
+	pages := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		mw.SetIteratorIndex(i)
+		page := mw.GetImage()
+		err := page.SetImageFormat("png")
+		blob := page.GetImageBlob()
+		page.Destroy()
+		if err != nil {
+			return nil, fmt.Errorf("page %d: failed to convert: %w", i+1, err)
+		}
+		if len(blob) == 0 {
+			return nil, fmt.Errorf("page %d: rendered image is empty", i+1)
+		}
+		pages = append(pages, blob)
+	}
+	return pages, nil
+}
+
+// SelectPages returns a document of the upload's format holding only the
+// given 1-based pages of a multi-page upload, in the order given. PDF pages
+// are re-encoded as images at the rendering resolution. The upload is
+// returned unchanged when it has one page or all pages are selected in order.
+func SelectPages(data []byte, numbers []int) ([]byte, error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	if err := mw.SetResolution(pageDensity, pageDensity); err != nil {
+		return nil, fmt.Errorf("failed to set resolution: %w", err)
+	}
+	if err := mw.ReadImageBlob(data); err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	count := int(mw.GetNumberImages())
+	whole, err := checkPages(numbers, count)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 1 || whole {
+		return data, nil
+	}
+
+	selected := imagick.NewMagickWand()
+	defer selected.Destroy()
+	for _, n := range numbers {
+		mw.SetIteratorIndex(n - 1)
+		page := mw.GetImage()
+		err := selected.AddImage(page)
+		page.Destroy()
+		if err != nil {
+			return nil, fmt.Errorf("page %d: failed to copy: %w", n, err)
+		}
+	}
+
+	mw.SetIteratorIndex(0)
+	if err := selected.SetFormat(mw.GetImageFormat()); err != nil {
+		return nil, fmt.Errorf("failed to set format: %w", err)
+	}
+	selected.ResetIterator()
+	blob := selected.GetImagesBlob()
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("selected pages rendered empty")
+	}
+	return blob, nil
+}
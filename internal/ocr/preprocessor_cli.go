@@ -0,0 +1,60 @@
+//go:build magickcli
+
+package ocr
+
+import "fmt"
+
+// PreprocessImageFromBytes optimizes an image for OCR with the same
+// ImageMagick operations as the linked library does, in one run of the
+// command. The image keeps its format.
+func (p *Preprocessor) PreprocessImageFromBytes(imageData []byte) ([]byte, error) {
+	args := []string{
+		"-",
+		"-trim",
+		"-type", "Bilevel",
+		"-blur", "0x1.5",
+		"-sharpen", "0x1",
+		"-enhance",
+		"+contrast",
+		"-deskew", "40%",
+	}
+	if p.scaleForEasyOCR {
+		args = append(args, "-scale", "50%")
+	}
+	blob, err := RunMagick(imageData, append(args, "-")...)
+	if err != nil {
+		return nil, fmt.Errorf("preprocessing failed: %w", err)
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("processed image is empty")
+	}
+
+	return blob, nil
+}
+
+// Invert returns the negative of an image, for text printed light on a dark
+// background that OCR reads poorly as it is
+func Invert(imageData []byte) ([]byte, error) {
+	blob, err := RunMagick(imageData, "-", "-negate", "-")
+	if err != nil {
+		return nil, fmt.Errorf("negate failed: %w", err)
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("inverted image is empty")
+	}
+
+	return blob, nil
+}
+
+// strip orients every page of an image and removes its metadata
+func strip(data []byte) ([]byte, error) {
+	blob, err := RunMagick(data, "-", "-auto-orient", "-strip", "-")
+	if err != nil {
+		return nil, fmt.Errorf("strip failed: %w", err)
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("stripped image is empty")
+	}
+
+	return blob, nil
+}
@@ -0,0 +1,148 @@
+//go:build !magickcli
+
+package ocr
+
+import (
+	"fmt"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// PreprocessImageFromBytes applies ImageMagick operations to optimize image for OCR
+// Based on Receipt Wrangler's prepareImage() function
+func (p *Preprocessor) PreprocessImageFromBytes(imageData []byte) ([]byte, error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	// Read image from memory: ImageMagick never parses a path, so Windows
+	// drive letters are not taken for a format prefix, and no temp file is written
+	err := mw.ReadImageBlob(imageData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	// Step 1: Trim borders/whitespace
+	err = mw.TrimImage(0)
+	if err != nil {
+		return nil, fmt.Errorf("trim failed: %w", err)
+	}
+
+	// Step 2: Convert to bilevel (pure black and white)
+	// This improves OCR accuracy by removing gray areas
+	err = mw.SetImageType(imagick.IMAGE_TYPE_BILEVEL)
+	if err != nil {
+		return nil, fmt.Errorf("bilevel conversion failed: %w", err)
+	}
+
+	// Step 3: Apply blur to reduce noise
+	// Radius: 0 (auto), Sigma: 1.5
+	err = mw.BlurImage(0, 1.5)
+	if err != nil {
+		return nil, fmt.Errorf("blur failed: %w", err)
+	}
+
+	// Step 4: Sharpen edges
+	// Radius: 0 (auto), Sigma: 1
+	err = mw.SharpenImage(0, 1)
+	if err != nil {
+		return nil, fmt.Errorf("sharpen failed: %w", err)
+	}
+
+	// Step 5: Enhance image (improve contrast and detail)
+	err = mw.EnhanceImage()
+	if err != nil {
+		return nil, fmt.Errorf("enhance failed: %w", err)
+	}
+
+	// Step 6: Reduce contrast
+	// false = reduce (not increase)
+	err = mw.ContrastImage(false)
+	if err != nil {
+		return nil, fmt.Errorf("contrast reduction failed: %w", err)
+	}
+
+	// Step 7: Deskew (straighten tilted images)
+	// Threshold: 0.40 (40%)
+	err = mw.DeskewImage(0.40)
+	if err != nil {
+		return nil, fmt.Errorf("deskew failed: %w", err)
+	}
+
+	// Step 8: Scale down for EasyOCR (optional)
+	// EasyOCR performs better with smaller images
+	if p.scaleForEasyOCR {
+		width := mw.GetImageWidth()
+		height := mw.GetImageHeight()
+		err = mw.ScaleImage(width/2, height/2)
+		if err != nil {
+			return nil, fmt.Errorf("scale failed: %w", err)
+		}
+	}
+
+	// Get processed image as bytes
+	blob := mw.GetImageBlob()
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("processed image is empty")
+	}
+
+	return blob, nil
+}
+
+// Invert returns the negative of an image, for text printed light on a dark
+// background that OCR reads poorly as it is
+func Invert(imageData []byte) ([]byte, error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	err := mw.ReadImageBlob(imageData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	// false = negate every pixel, not only gray ones
+	err = mw.NegateImage(false)
+	if err != nil {
+		return nil, fmt.Errorf("negate failed: %w", err)
+	}
+
+	blob := mw.GetImageBlob()
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("inverted image is empty")
+	}
+
+	return blob, nil
+}
+
+// strip orients every page of an image and removes its metadata
+func strip(data []byte) ([]byte, error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	err := mw.ReadImageBlob(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	mw.ResetIterator()
+	for mw.NextImage() {
+		if err := mw.AutoOrientImage(); err != nil {
+			return nil, fmt.Errorf("failed to orient image: %w", err)
+		}
+		if err := mw.StripImage(); err != nil {
+			return nil, fmt.Errorf("strip failed: %w", err)
+		}
+	}
+
+	blob := mw.GetImagesBlob()
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("stripped image is empty")
+	}
+
+	return blob, nil
+}
@@ -0,0 +1,203 @@
+package ocr
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"sort"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+const (
+	// segmentSize is the long side, in pixels, photos are scaled down to for segmentation
+	segmentSize = 800
+	// minReceiptArea is the smallest receipt, as a fraction of the photo
+	minReceiptArea = 0.02
+	// maxReceiptArea is the largest receipt, as a fraction of the photo; a
+	// larger bright area is the background or a single receipt filling the photo
+	maxReceiptArea = 0.9
+	// minReceiptFill is how much of its bounding box a receipt must cover,
+	// ruling out thin or scattered shapes such as table edges and glare
+	minReceiptFill = 0.5
+	// receiptPadding is the margin added around each receipt, as a fraction of the photo's long side
+	receiptPadding = 0.01
+)
+
+// FindReceipts returns the areas of a photo holding separate receipts, in
+// reading order (top to bottom, then left to right). Receipts are found as
+// bright paper on a darker background; nil is returned when fewer than two
+// are found, e.g. for a single receipt or a scan.
+func FindReceipts(data []byte) ([]models.Region, error) {
+	thumb, width, height, scale, err := thumbnail(data, segmentSize)
+	if err != nil {
+		return nil, err
+	}
+	small, err := png.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	boxes := brightAreas(small)
+	if len(boxes) < 2 {
+		return nil, nil
+	}
+
+	pad := int(receiptPadding * float64(max(width, height)))
+	regions := make([]models.Region, len(boxes))
+	for i, box := range boxes {
+		r := image.Rect(
+			int(float64(box.Min.X)*scale)-pad,
+			int(float64(box.Min.Y)*scale)-pad,
+			int(float64(box.Max.X)*scale)+pad,
+			int(float64(box.Max.Y)*scale)+pad,
+		).Intersect(image.Rect(0, 0, width, height))
+		regions[i] = models.Region{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+	}
+	return regions, nil
+}
+
+// Crop returns an area of an image, as found by FindReceipts, as a PNG image
+func Crop(data []byte, region models.Region) ([]byte, error) {
+	if region.Width <= 0 || region.Height <= 0 || region.X < 0 || region.Y < 0 {
+		return nil, fmt.Errorf("invalid region %dx%d+%d+%d", region.Width, region.Height, region.X, region.Y)
+	}
+	return crop(data, region)
+}
+
+// thumbnailSize returns the size a width × height image is scaled to for a
+// long side of at most size pixels, and the factor it is scaled down by
+func thumbnailSize(width, height, size int) (cols, rows int, scale float64) {
+	if long := max(width, height); long > size {
+		scale = float64(long) / float64(size)
+		return max(1, int(float64(width)/scale)), max(1, int(float64(height)/scale)), scale
+	}
+	return width, height, 1
+}
+
+// checkRegion fails unless region lies within a width × height image
+func checkRegion(region models.Region, width, height int) error {
+	if region.X+region.Width > width || region.Y+region.Height > height {
+		return fmt.Errorf("region %dx%d+%d+%d is outside the %dx%d image", region.Width, region.Height, region.X, region.Y, width, height)
+	}
+	return nil
+}
+
+// brightAreas returns the bounding boxes of the connected areas brighter than
+// the Otsu threshold of img that look like receipts, sorted in reading order
+func brightAreas(img image.Image) []image.Rectangle {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	gray := make([]uint8, w*h)
+	var histogram [256]int
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+			gray[y*w+x] = v
+			histogram[v]++
+		}
+	}
+	threshold := otsu(histogram, w*h)
+
+	total := float64(w * h)
+	seen := make([]bool, w*h)
+	var boxes []image.Rectangle
+	queue := make([]int, 0, w*h)
+	for start := range gray {
+		if seen[start] || gray[start] <= threshold {
+			continue
+		}
+		// Flood fill the 4-connected bright area
+		seen[start] = true
+		queue = append(queue[:0], start)
+		box := image.Rect(start%w, start/w, start%w+1, start/w+1)
+		for i := 0; i < len(queue); i++ {
+			p := queue[i]
+			x, y := p%w, p/w
+			box = box.Union(image.Rect(x, y, x+1, y+1))
+			for _, n := range [4]int{p - w, p + w, p - 1, p + 1} {
+				switch {
+				case n < 0 || n >= len(gray):
+					continue
+				case (n == p-1 && x == 0) || (n == p+1 && x == w-1):
+					continue
+				case seen[n] || gray[n] <= threshold:
+					continue
+				}
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+
+		area := float64(len(queue))
+		boxArea := float64(box.Dx() * box.Dy())
+		if area < minReceiptArea*total || boxArea > maxReceiptArea*total || area < minReceiptFill*boxArea {
+			continue
+		}
+		boxes = append(boxes, box)
+	}
+
+	// Drop areas inside another one, e.g. a white label on a receipt
+	var receipts []image.Rectangle
+	for i, box := range boxes {
+		nested := false
+		for j, other := range boxes {
+			if i != j && box.In(other) && box != other {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			receipts = append(receipts, box)
+		}
+	}
+
+	// Receipts whose tops are within half the shortest receipt's height are on the same row
+	sort.Slice(receipts, func(i, j int) bool {
+		a, b := receipts[i], receipts[j]
+		if abs(a.Min.Y-b.Min.Y) > min(a.Dy(), b.Dy())/2 {
+			return a.Min.Y < b.Min.Y
+		}
+		return a.Min.X < b.Min.X
+	})
+	return receipts
+}
+
+// otsu returns the gray level that best separates the histogram into dark and bright pixels
+func otsu(histogram [256]int, total int) uint8 {
+	var sum float64
+	for v, n := range histogram {
+		sum += float64(v * n)
+	}
+
+	var best uint8
+	var bestVariance, sumDark float64
+	dark := 0
+	for v, n := range histogram {
+		dark += n
+		if dark == 0 {
+			continue
+		}
+		bright := total - dark
+		if bright == 0 {
+			break
+		}
+		sumDark += float64(v * n)
+		meanDark := sumDark / float64(dark)
+		meanBright := (sum - sumDark) / float64(bright)
+		variance := float64(dark) * float64(bright) * (meanDark - meanBright) * (meanDark - meanBright)
+		if variance > bestVariance {
+			best, bestVariance = uint8(v), variance
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
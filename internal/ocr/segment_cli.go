@@ -0,0 +1,61 @@
+//go:build magickcli
+
+package ocr
+
+import (
+	"fmt"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// thumbnail returns the oriented image scaled to a long side of at most size
+// pixels as a PNG image, with the oriented size and the scale factor
+func thumbnail(data []byte, size int) (thumb []byte, width, height int, scale float64, err error) {
+	width, height, err = orientedSize(data)
+	if err != nil {
+		return nil, 0, 0, 0, err
+	}
+	if width == 0 || height == 0 {
+		return nil, 0, 0, 0, fmt.Errorf("image is empty")
+	}
+	cols, rows, scale := thumbnailSize(width, height, size)
+
+	thumb, err = RunMagick(data, "-", "-auto-orient", "-scale", fmt.Sprintf("%dx%d!", cols, rows), "png:-")
+	if err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to scale image: %w", err)
+	}
+	return thumb, width, height, scale, nil
+}
+
+// crop cuts region out of the oriented image
+func crop(data []byte, region models.Region) ([]byte, error) {
+	// Regions are in oriented coordinates
+	width, height, err := orientedSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRegion(region, width, height); err != nil {
+		return nil, err
+	}
+
+	// +repage drops the virtual canvas offset left by the crop
+	geometry := fmt.Sprintf("%dx%d+%d+%d", region.Width, region.Height, region.X, region.Y)
+	blob, err := RunMagick(data, "-", "-auto-orient", "-crop", geometry, "+repage", "png:-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to crop image: %w", err)
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("cropped image is empty")
+	}
+	return blob, nil
+}
+
+// orientedSize returns the size of an image once turned as its EXIF
+// orientation says
+func orientedSize(data []byte) (width, height int, err error) {
+	out, err := RunMagick(data, "-", "-auto-orient", "-format", "%w %h\n", "info:")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read image: %w", err)
+	}
+	return parseSize(out)
+}
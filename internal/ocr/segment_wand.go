@@ -0,0 +1,76 @@
+//go:build !magickcli
+
+package ocr
+
+import (
+	"fmt"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// thumbnail returns the oriented image scaled to a long side of at most size
+// pixels as a PNG image, with the oriented size and the scale factor
+func thumbnail(data []byte, size int) (thumb []byte, width, height int, scale float64, err error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	if err := mw.ReadImageBlob(data); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to read image: %w", err)
+	}
+	if err := mw.AutoOrientImage(); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to orient image: %w", err)
+	}
+
+	width, height = int(mw.GetImageWidth()), int(mw.GetImageHeight())
+	if width == 0 || height == 0 {
+		return nil, 0, 0, 0, fmt.Errorf("image is empty")
+	}
+	cols, rows, scale := thumbnailSize(width, height, size)
+	if scale > 1 {
+		if err := mw.ScaleImage(uint(cols), uint(rows)); err != nil {
+			return nil, 0, 0, 0, fmt.Errorf("failed to scale image: %w", err)
+		}
+	}
+	if err := mw.SetImageFormat("png"); err != nil {
+		return nil, 0, 0, 0, fmt.Errorf("failed to convert image: %w", err)
+	}
+	return mw.GetImageBlob(), width, height, scale, nil
+}
+
+// crop cuts region out of the oriented image
+func crop(data []byte, region models.Region) ([]byte, error) {
+	InitMagick()
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+
+	if err := mw.ReadImageBlob(data); err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	// Regions are in oriented coordinates
+	if err := mw.AutoOrientImage(); err != nil {
+		return nil, fmt.Errorf("failed to orient image: %w", err)
+	}
+	if err := checkRegion(region, int(mw.GetImageWidth()), int(mw.GetImageHeight())); err != nil {
+		return nil, err
+	}
+	if err := mw.CropImage(uint(region.Width), uint(region.Height), region.X, region.Y); err != nil {
+		return nil, fmt.Errorf("failed to crop image: %w", err)
+	}
+	// Drop the virtual canvas offset left by the crop
+	if err := mw.ResetImagePage(""); err != nil {
+		return nil, fmt.Errorf("failed to crop image: %w", err)
+	}
+	if err := mw.SetImageFormat("png"); err != nil {
+		return nil, fmt.Errorf("failed to convert image: %w", err)
+	}
+
+	blob := mw.GetImageBlob()
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("cropped image is empty")
+	}
+	return blob, nil
+}
@@ -2,6 +2,7 @@ package ocr
 
 import (
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/otiai10/gosseract/v2"
@@ -9,7 +10,22 @@ import (
 
 // TesseractOCR implements OCR using Tesseract engine
 type TesseractOCR struct {
-	language string
+	language    string
+	pageSegMode gosseract.PageSegMode
+}
+
+// Page segmentation modes, see tesseract --help-psm
+const (
+	SegmentAuto         = gosseract.PSM_AUTO          // Tesseract's default
+	SegmentSingleColumn = gosseract.PSM_SINGLE_COLUMN // One column of text of varying sizes
+	SegmentSingleBlock  = gosseract.PSM_SINGLE_BLOCK  // One uniform block of text, like a till receipt
+)
+
+// Result is the outcome of an OCR run
+type Result struct {
+	Text       string
+	Duration   float64 // Seconds
+	Confidence float64 // Mean word confidence (0-1), 0 when no words were found
 }
 
 // NewTesseractOCR creates a new Tesseract OCR instance
@@ -18,13 +34,21 @@ func NewTesseractOCR(language string) *TesseractOCR {
 		language = "eng" // Default to English
 	}
 	return &TesseractOCR{
-		language: language,
+		language:    language,
+		pageSegMode: SegmentAuto,
 	}
 }
 
+// WithPageSegMode returns a copy of t using another page segmentation mode
+func (t *TesseractOCR) WithPageSegMode(mode gosseract.PageSegMode) *TesseractOCR {
+	c := *t
+	c.pageSegMode = mode
+	return &c
+}
+
 // ExtractText performs OCR on preprocessed image bytes
 // Based on Receipt Wrangler's ReadImageWithTesseract function
-func (t *TesseractOCR) ExtractText(imageBytes []byte) (string, float64, error) {
+func (t *TesseractOCR) ExtractText(imageBytes []byte) (Result, error) {
 	startTime := time.Now()
 
 	// Create Tesseract client
@@ -34,7 +58,12 @@ func (t *TesseractOCR) ExtractText(imageBytes []byte) (string, float64, error) {
 	// Set language
 	err := client.SetLanguage(t.language)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to set language: %w", err)
+		return Result{}, fmt.Errorf("failed to set language: %w", err)
+	}
+
+	err = client.SetPageSegMode(t.pageSegMode)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to set page segmentation mode: %w", err)
 	}
 
 	// Blacklist special characters that rarely appear in invoices
@@ -43,43 +72,51 @@ func (t *TesseractOCR) ExtractText(imageBytes []byte) (string, float64, error) {
 	err = client.SetVariable("tessedit_char_blacklist", blacklist)
 	if err != nil {
 		// Non-fatal error, continue
-		fmt.Printf("Warning: failed to set character blacklist: %v\n", err)
+		slog.Warn("failed to set character blacklist", "error", err)
 	}
 
 	// Set image from bytes
 	err = client.SetImageFromBytes(imageBytes)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to set image: %w", err)
+		return Result{}, fmt.Errorf("failed to set image: %w", err)
 	}
 
-	// Extract text
-	text, err := client.Text()
+	// Word confidences first: they run recognition, which Text then reuses
+	confidence, err := meanConfidence(client)
 	if err != nil {
-		return "", 0, fmt.Errorf("OCR extraction failed: %w", err)
+		// Non-fatal, the text is still usable
+		slog.Warn("failed to compute OCR confidence", "error", err)
 	}
 
-	duration := time.Since(startTime).Seconds()
-
-	// Calculate confidence (0-1 scale)
-	confidence, err := t.calculateConfidence(client)
+	// Extract text
+	text, err := client.Text()
 	if err != nil {
-		// Non-fatal, use default confidence
-		confidence = 0.8
+		return Result{}, fmt.Errorf("OCR extraction failed: %w", err)
 	}
 
-	return text, duration, nil
+	return Result{
+		Text:       text,
+		Duration:   time.Since(startTime).Seconds(),
+		Confidence: confidence,
+	}, nil
 }
 
-// calculateConfidence gets mean confidence from Tesseract
-func (t *TesseractOCR) calculateConfidence(client *gosseract.Client) (float64, error) {
-	// Get confidence (0-100 scale)
-	conf, err := client.GetConfidence()
+// meanConfidence returns the mean confidence of the recognized words (0-1)
+func meanConfidence(client *gosseract.Client) (float64, error) {
+	// Word confidences are on a 0-100 scale
+	boxes, err := client.GetBoundingBoxes(gosseract.RIL_WORD)
 	if err != nil {
 		return 0, err
 	}
+	if len(boxes) == 0 {
+		return 0, nil
+	}
 
-	// Convert to 0-1 scale
-	return float64(conf) / 100.0, nil
+	var sum float64
+	for _, box := range boxes {
+		sum += box.Confidence
+	}
+	return sum / float64(len(boxes)) / 100.0, nil
 }
 
 // ExtractTextWithDetails returns text and detailed word information
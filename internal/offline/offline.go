@@ -0,0 +1,162 @@
+// Package offline implements the air-gapped mode: HTTP requests may only go
+// to the machine itself and listed hosts, and the config is checked for
+// cloud services
+package offline
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// ErrBlocked is wrapped by the errors of HTTP requests the guard refuses
+var ErrBlocked = errors.New("outgoing request blocked in offline mode")
+
+// Guard decides which hosts HTTP requests may go to
+type Guard struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+}
+
+// Compile checks config and returns its guard. It returns nil when offline
+// mode is disabled, which allows every host.
+func Compile(config models.OfflineConfig) (*Guard, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	g := &Guard{hosts: make(map[string]bool)}
+	for i, host := range config.AllowedHosts {
+		if strings.Contains(host, "/") {
+			_, network, err := net.ParseCIDR(host)
+			if err != nil {
+				return nil, fmt.Errorf("allowed_hosts[%d]: invalid CIDR block %q", i, host)
+			}
+			g.networks = append(g.networks, network)
+			continue
+		}
+		if host == "" || (strings.ContainsAny(host, ":*") && net.ParseIP(host) == nil) {
+			return nil, fmt.Errorf("allowed_hosts[%d]: must be a host name, IP address or CIDR block, got %q", i, host)
+		}
+		g.hosts[strings.ToLower(host)] = true
+	}
+	return g, nil
+}
+
+// Allows reports whether requests may go to host. The machine itself is
+// always allowed; a nil guard allows every host.
+func (g *Guard) Allows(host string) bool {
+	if g == nil {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || g.hosts[host] {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false // Names are not resolved: a listed name could point anywhere
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, network := range g.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transport wraps base so requests to hosts the guard does not allow fail
+// with ErrBlocked. Redirects are checked as well, as each one is a request.
+func (g *Guard) Transport(base http.RoundTripper) http.RoundTripper {
+	if g == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{guard: g, base: base}
+}
+
+// Install guards http.DefaultTransport, which every HTTP client of the
+// service sends its requests through unless it has a transport of its own
+func (g *Guard) Install() {
+	http.DefaultTransport = g.Transport(http.DefaultTransport)
+}
+
+type transport struct {
+	guard *Guard
+	base  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if host := req.URL.Hostname(); !t.guard.Allows(host) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrBlocked, host)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Violations lists the settings of config that need a cloud service or a host
+// the guard does not allow, as "path: problem". A nil guard reports none.
+func (g *Guard) Violations(config *models.Config) []string {
+	if g == nil {
+		return nil
+	}
+	var problems []string
+	g.checkAI(&problems, "ai", config.AI)
+	if provider := config.Usage.Budget.Fallback.Provider; provider != "" && provider != "ollama" {
+		problems = append(problems, fmt.Sprintf("usage.budget.fallback.provider: %s is not allowed offline", provider))
+	}
+	for i, tenant := range config.Tenants {
+		g.checkAI(&problems, fmt.Sprintf("tenants[%d].ai", i), tenant.AI)
+	}
+	if config.Tracing.Enabled && config.Tracing.Endpoint != "" {
+		host, _, err := net.SplitHostPort(config.Tracing.Endpoint)
+		if err != nil {
+			host = config.Tracing.Endpoint
+		}
+		if !g.Allows(host) {
+			problems = append(problems, fmt.Sprintf("tracing.endpoint: %s is not a local or allowed host", host))
+		}
+	}
+	return problems
+}
+
+// checkAI adds the problems of one AI section. Empty tenant overrides pass.
+func (g *Guard) checkAI(problems *[]string, path string, ai models.AIConfig) {
+	add := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+"."+fmt.Sprintf(format, args...))
+	}
+	if ai.DefaultProvider != "" && ai.DefaultProvider != "ollama" {
+		add("default_provider: %s is not allowed offline", ai.DefaultProvider)
+	}
+	if ai.Shadow.Provider != "" && ai.Shadow.Provider != "ollama" {
+		add("shadow.provider: %s is not allowed offline", ai.Shadow.Provider)
+	}
+	if ai.OpenAI.APIKey != "" {
+		add("openai.api_key: OpenAI is a cloud provider")
+	}
+	if ai.Gemini.APIKey != "" {
+		add("gemini.api_key: Gemini is a cloud provider")
+	}
+	if len(ai.External.Command) > 0 || ai.External.URL != "" {
+		add("external: only Ollama is allowed offline")
+	}
+	if ai.Ollama.BaseURL != "" {
+		u, err := url.Parse(ai.Ollama.BaseURL)
+		if err != nil || !g.Allows(u.Hostname()) {
+			add("ollama.base_url: %s is not a local or allowed host", ai.Ollama.BaseURL)
+		}
+	}
+}
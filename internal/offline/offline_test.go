@@ -0,0 +1,124 @@
+package offline
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func compile(t *testing.T, allowed ...string) *Guard {
+	t.Helper()
+	g, err := Compile(models.OfflineConfig{Enabled: true, AllowedHosts: allowed})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	return g
+}
+
+func TestAllows(t *testing.T) {
+	g := compile(t, "ollama.internal", "10.0.0.0/8", "fd00::1")
+
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"localhost", true},
+		{"LOCALHOST.", true},
+		{"ollama.localhost", true},
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"::1", true},
+		{"ollama.internal", true},
+		{"Ollama.Internal", true},
+		{"10.1.2.3", true},
+		{"fd00::1", true},
+		{"fd00::2", false},
+		{"11.1.2.3", false},
+		{"api.openai.com", false},
+		{"ollama.internal.example.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := g.Allows(tt.host); got != tt.allowed {
+			t.Errorf("Allows(%q) = %v, want %v", tt.host, got, tt.allowed)
+		}
+	}
+
+	var disabled *Guard
+	if !disabled.Allows("api.openai.com") {
+		t.Error("nil guard refused a host")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://203.0.113.7/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: compile(t).Transport(nil)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("local request: %v", err)
+	}
+	resp.Body.Close()
+
+	for _, url := range []string{"http://203.0.113.7/", "https://api.openai.com/v1/models", server.URL + "/redirect"} {
+		_, err := client.Get(url)
+		if !errors.Is(err, ErrBlocked) {
+			t.Errorf("GET %s: err = %v, want ErrBlocked", url, err)
+		}
+	}
+}
+
+func TestViolations(t *testing.T) {
+	config := &models.Config{
+		AI: models.AIConfig{
+			DefaultProvider: "ollama",
+			Ollama:          models.OllamaConfig{BaseURL: "http://10.0.0.5:11434"},
+		},
+		Tenants: []models.TenantConfig{{ID: "acme"}},
+	}
+	if problems := compile(t, "10.0.0.0/8").Violations(config); len(problems) != 0 {
+		t.Fatalf("local config: %v", problems)
+	}
+
+	config.AI.Gemini.APIKey = "key"
+	config.Tenants[0].AI.DefaultProvider = "openai"
+	config.Tracing = models.TracingConfig{Enabled: true, Endpoint: "collector.example.com:4318"}
+	problems := compile(t).Violations(config)
+	want := []string{"ai.gemini.api_key", "ai.ollama.base_url", "tenants[0].ai.default_provider", "tracing.endpoint"}
+	if len(problems) != len(want) {
+		t.Fatalf("problems = %v, want %v", problems, want)
+	}
+	for i, path := range want {
+		if !strings.HasPrefix(problems[i], path+":") {
+			t.Errorf("problems[%d] = %q, want %s", i, problems[i], path)
+		}
+	}
+
+	var disabled *Guard
+	if problems := disabled.Violations(config); problems != nil {
+		t.Errorf("nil guard: %v", problems)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	g, err := Compile(models.OfflineConfig{AllowedHosts: []string{"ollama.internal"}})
+	if err != nil || g != nil {
+		t.Fatalf("disabled: Compile = %v, %v, want nil, nil", g, err)
+	}
+
+	for _, host := range []string{"", "10.0.0.0/33", "*.internal", "ollama.internal:11434"} {
+		if _, err := Compile(models.OfflineConfig{Enabled: true, AllowedHosts: []string{host}}); err == nil {
+			t.Errorf("allowed host %q: expected an error", host)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryQueue implements Queue in process memory. Jobs are lost on restart.
+type MemoryQueue struct {
+	mu       sync.RWMutex
+	jobs     map[string]*Job
+	payloads map[string][]byte
+	ready    chan string
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NewMemoryQueue creates an in-memory queue holding up to capacity pending jobs
+func NewMemoryQueue(capacity int) *MemoryQueue {
+	if capacity <= 0 {
+		capacity = 1000 // Default pending capacity
+	}
+	return &MemoryQueue{
+		jobs:     make(map[string]*Job),
+		payloads: make(map[string][]byte),
+		ready:    make(chan string, capacity),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Enqueue stores the job and its payload and schedules it for processing
+func (q *MemoryQueue) Enqueue(ctx context.Context, job *Job, payload []byte) error {
+	q.mu.Lock()
+	q.jobs[job.ID] = copyJob(job)
+	q.payloads[job.ID] = payload
+	q.mu.Unlock()
+
+	err := q.push(ctx, job.ID)
+	if err != nil {
+		q.mu.Lock()
+		delete(q.jobs, job.ID)
+		delete(q.payloads, job.ID)
+		q.mu.Unlock()
+	}
+	return err
+}
+
+// Requeue schedules an existing job for another attempt
+func (q *MemoryQueue) Requeue(ctx context.Context, job *Job) error {
+	err := q.Update(ctx, job)
+	if err != nil {
+		return err
+	}
+	return q.push(ctx, job.ID)
+}
+
+// Retry schedules a dead-lettered job again
+func (q *MemoryQueue) Retry(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	stored, ok := q.jobs[job.ID]
+	if !ok {
+		q.mu.Unlock()
+		return ErrNotFound
+	}
+	if stored.State != StateDeadLetter {
+		q.mu.Unlock()
+		return ErrStateChanged
+	}
+	q.jobs[job.ID] = copyJob(job)
+	q.mu.Unlock()
+
+	err := q.push(ctx, job.ID)
+	if err != nil {
+		// Leave the job dead-lettered so it can be retried later
+		q.mu.Lock()
+		q.jobs[job.ID] = stored
+		q.mu.Unlock()
+	}
+	return err
+}
+
+// Dequeue blocks until a job is available or ctx is done
+func (q *MemoryQueue) Dequeue(ctx context.Context) (*Job, error) {
+	for {
+		select {
+		case id := <-q.ready:
+			job, err := q.Get(ctx, id)
+			if err == ErrNotFound {
+				// Deleted while waiting
+				continue
+			}
+			return job, err
+		case <-q.closed:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Update persists the state of a job
+func (q *MemoryQueue) Update(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.jobs[job.ID]; !ok {
+		return ErrNotFound
+	}
+	q.jobs[job.ID] = copyJob(job)
+
+	return nil
+}
+
+// Get loads a job
+func (q *MemoryQueue) Get(ctx context.Context, id string) (*Job, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyJob(job), nil
+}
+
+// Payload loads the uploaded image of a job
+func (q *MemoryQueue) Payload(ctx context.Context, id string) ([]byte, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	payload, ok := q.payloads[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return payload, nil
+}
+
+// DeletePayload drops the uploaded image once it is no longer needed
+func (q *MemoryQueue) DeletePayload(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.payloads, id)
+	return nil
+}
+
+// List returns jobs, optionally filtered by state, oldest first
+func (q *MemoryQueue) List(ctx context.Context, state string) ([]*Job, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if state != "" && job.State != state {
+			continue
+		}
+		jobs = append(jobs, copyJob(job))
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	return jobs, nil
+}
+
+// Ping reports whether the queue is still open
+func (q *MemoryQueue) Ping(ctx context.Context) error {
+	select {
+	case <-q.closed:
+		return ErrClosed
+	default:
+		return nil
+	}
+}
+
+// Close unblocks Dequeue
+func (q *MemoryQueue) Close() error {
+	q.once.Do(func() {
+		close(q.closed)
+	})
+	return nil
+}
+
+// push hands a job ID to the workers without blocking
+func (q *MemoryQueue) push(ctx context.Context, id string) error {
+	select {
+	case <-q.closed:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case q.ready <- id:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// copyJob returns a shallow copy so callers cannot mutate stored state
+func copyJob(job *Job) *Job {
+	c := *job
+	return &c
+}
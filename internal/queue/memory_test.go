@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func deadLetteredJob(t *testing.T, q *MemoryQueue, id string) *Job {
+	t.Helper()
+	ctx := context.Background()
+	job := &Job{ID: id, State: StatePending, MaxAttempts: 1, CreatedAt: time.Now()}
+	if err := q.Enqueue(ctx, job, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+	dequeued, err := q.Dequeue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dequeued.State = StateDeadLetter
+	dequeued.Attempts = 1
+	if err := q.Update(ctx, dequeued); err != nil {
+		t.Fatal(err)
+	}
+	return dequeued
+}
+
+func TestMemoryQueueRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		wantErr error
+	}{
+		{"dead letter", StateDeadLetter, nil},
+		{"pending", StatePending, ErrStateChanged},
+		{"processing", StateProcessing, ErrStateChanged},
+		{"succeeded", StateSucceeded, ErrStateChanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q := NewMemoryQueue(10)
+			job := deadLetteredJob(t, q, "job-1")
+			job.State = tt.state
+			q.Update(ctx, job)
+
+			job.State = StatePending
+			job.Attempts = 0
+			err := q.Retry(ctx, job)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Retry = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				stored, _ := q.Get(ctx, job.ID)
+				if stored.State != tt.state {
+					t.Errorf("state = %s, want %s", stored.State, tt.state)
+				}
+				return
+			}
+			dequeued, err := q.Dequeue(ctx)
+			if err != nil || dequeued.ID != job.ID || dequeued.State != StatePending {
+				t.Fatalf("Dequeue = %+v, %v", dequeued, err)
+			}
+		})
+	}
+}
+
+func TestMemoryQueueRetryUnknownJob(t *testing.T) {
+	q := NewMemoryQueue(10)
+	if err := q.Retry(context.Background(), &Job{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Retry = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryQueueConcurrentRetriesQueueOnce(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue(100)
+	job := deadLetteredJob(t, q, "job-1")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retry := *job
+			retry.State = StatePending
+			retry.Attempts = 0
+			errs <- q.Retry(ctx, &retry)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrStateChanged):
+			t.Errorf("Retry = %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d retries succeeded, want 1", succeeded)
+	}
+	if n := len(q.ready); n != 1 {
+		t.Errorf("job queued %d times, want 1", n)
+	}
+}
+
+func TestMemoryQueueRetryFullKeepsDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue(1)
+	job := deadLetteredJob(t, q, "job-1")
+	if err := q.Enqueue(ctx, &Job{ID: "job-2", State: StatePending}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	job.State = StatePending
+	if err := q.Retry(ctx, job); !errors.Is(err, ErrFull) {
+		t.Fatalf("Retry = %v, want ErrFull", err)
+	}
+	stored, _ := q.Get(ctx, job.ID)
+	if stored.State != StateDeadLetter {
+		t.Errorf("state = %s, want %s", stored.State, StateDeadLetter)
+	}
+}
@@ -0,0 +1,378 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSQueue implements Queue and Leaser on NATS JetStream: a work-queue
+// stream carries job IDs, a key-value bucket holds job state and an object
+// store holds payloads. A job's message is acknowledged only once the job
+// finishes or is requeued; JetStream redelivers it when the lease, the
+// consumer's ack wait, passes without a heartbeat.
+type NATSQueue struct {
+	conn    *nats.Conn
+	sub     *nats.Subscription
+	kv      nats.KeyValue
+	objects nats.ObjectStore
+	js      nats.JetStreamContext
+	subject string
+
+	mu   sync.Mutex
+	msgs map[string]*nats.Msg // Unacknowledged message of each leased job
+}
+
+// NewNATSQueue connects to NATS and creates the JetStream resources if
+// needed. Jobs are leased for lease at a time.
+func NewNATSQueue(url, prefix string, lease time.Duration) (*NATSQueue, error) {
+	if prefix == "" {
+		prefix = "invoice-ocr" // Default resource prefix
+	}
+	if lease <= 0 {
+		lease = time.Minute // Default lease
+	}
+
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	q, err := newNATSQueue(conn, prefix, lease)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func newNATSQueue(conn *nats.Conn, prefix string, lease time.Duration) (*NATSQueue, error) {
+	js, err := conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+
+	stream := prefix + "-jobs"
+	subject := prefix + ".jobs"
+	_, err = js.StreamInfo(stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:      stream,
+			Subjects:  []string{subject},
+			Retention: nats.WorkQueuePolicy,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job stream: %w", err)
+	}
+
+	kv, err := js.KeyValue(prefix + "-job-state")
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: prefix + "-job-state"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job state bucket: %w", err)
+	}
+
+	objects, err := js.ObjectStore(prefix + "-job-payloads")
+	if errors.Is(err, nats.ErrStreamNotFound) || errors.Is(err, nats.ErrBucketNotFound) {
+		objects, err = js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: prefix + "-job-payloads"})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job payload store: %w", err)
+	}
+
+	sub, err := js.PullSubscribe(subject, prefix+"-workers", nats.AckWait(lease))
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to jobs: %w", err)
+	}
+
+	return &NATSQueue{
+		conn:    conn,
+		sub:     sub,
+		kv:      kv,
+		objects: objects,
+		js:      js,
+		subject: subject,
+		msgs:    make(map[string]*nats.Msg),
+	}, nil
+}
+
+// Enqueue stores the job and its payload and schedules it for processing
+func (q *NATSQueue) Enqueue(ctx context.Context, job *Job, payload []byte) error {
+	_, err := q.objects.PutBytes(job.ID, payload)
+	if err != nil {
+		return fmt.Errorf("failed to store job payload: %w", err)
+	}
+
+	err = q.Update(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.js.Publish(q.subject, []byte(job.ID), nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to publish job: %w", err)
+	}
+
+	return nil
+}
+
+// Requeue schedules an existing job for another attempt, ending the lease
+// of a dequeued job
+func (q *NATSQueue) Requeue(ctx context.Context, job *Job) error {
+	err := q.Update(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.js.Publish(q.subject, []byte(job.ID), nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to publish job: %w", err)
+	}
+
+	if _, err := q.ack(job); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Retry schedules a dead-lettered job again. The state is updated at the
+// revision it was checked at, so a concurrent retry makes the update fail.
+func (q *NATSQueue) Retry(ctx context.Context, job *Job) error {
+	entry, err := q.kv.Get(job.ID)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to load job: %w", err)
+	}
+	var stored Job
+	if err := json.Unmarshal(entry.Value(), &stored); err != nil {
+		return fmt.Errorf("failed to parse job: %w", err)
+	}
+	if stored.State != StateDeadLetter {
+		return ErrStateChanged
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	_, err = q.kv.Update(job.ID, data, entry.Revision())
+	if err != nil {
+		var apiErr *nats.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence {
+			return ErrStateChanged
+		}
+		return fmt.Errorf("failed to store job: %w", err)
+	}
+
+	_, err = q.js.Publish(q.subject, []byte(job.ID), nats.Context(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to publish job: %w", err)
+	}
+
+	return nil
+}
+
+// Dequeue blocks until a job is available or ctx is done
+func (q *NATSQueue) Dequeue(ctx context.Context) (*Job, error) {
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		msgs, err := q.sub.Fetch(1, nats.Context(fetchCtx))
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) {
+				continue
+			}
+			if errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, nats.ErrBadSubscription) {
+				return nil, ErrClosed
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("failed to fetch job: %w", err)
+		}
+
+		for _, msg := range msgs {
+			job, err := q.Get(ctx, string(msg.Data))
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					msg.Ack()
+					continue
+				}
+				msg.Nak()
+				return nil, err
+			}
+
+			// Work-queue retention removes the message once acknowledged, by
+			// Release or Requeue; retries are republished by the worker pool
+			q.mu.Lock()
+			q.msgs[job.ID] = msg
+			q.mu.Unlock()
+			return job, nil
+		}
+	}
+}
+
+// Heartbeat renews the lease of a dequeued job. Redelivery after an expired
+// lease is not detected here; the worker holding the job keeps it.
+func (q *NATSQueue) Heartbeat(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	msg, ok := q.msgs[job.ID]
+	q.mu.Unlock()
+	if !ok {
+		return ErrLeaseLost
+	}
+	if err := msg.InProgress(); err != nil {
+		return fmt.Errorf("failed to renew job lease: %w", err)
+	}
+	return nil
+}
+
+// Release stores a job and acknowledges its message, ending its lease
+func (q *NATSQueue) Release(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	_, ok := q.msgs[job.ID]
+	q.mu.Unlock()
+	if !ok {
+		return ErrLeaseLost
+	}
+	if err := q.Update(ctx, job); err != nil {
+		return err
+	}
+	if held, err := q.ack(job); err != nil {
+		return err
+	} else if !held {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ack acknowledges the message of a job, reporting whether it was held
+func (q *NATSQueue) ack(job *Job) (bool, error) {
+	q.mu.Lock()
+	msg, ok := q.msgs[job.ID]
+	delete(q.msgs, job.ID)
+	q.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := msg.Ack(); err != nil {
+		return true, fmt.Errorf("failed to acknowledge job: %w", err)
+	}
+	return true, nil
+}
+
+// RecoverExpired does nothing: JetStream redelivers the messages of expired
+// leases itself
+func (q *NATSQueue) RecoverExpired(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+// Update persists the state of a job
+func (q *NATSQueue) Update(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	_, err = q.kv.Put(job.ID, data)
+	if err != nil {
+		return fmt.Errorf("failed to store job: %w", err)
+	}
+
+	return nil
+}
+
+// Get loads a job
+func (q *NATSQueue) Get(ctx context.Context, id string) (*Job, error) {
+	entry, err := q.kv.Get(id)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load job: %w", err)
+	}
+
+	var job Job
+	err = json.Unmarshal(entry.Value(), &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// Payload loads the uploaded image of a job
+func (q *NATSQueue) Payload(ctx context.Context, id string) ([]byte, error) {
+	data, err := q.objects.GetBytes(id)
+	if err != nil {
+		if errors.Is(err, nats.ErrObjectNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load job payload: %w", err)
+	}
+	return data, nil
+}
+
+// DeletePayload drops the uploaded image once it is no longer needed
+func (q *NATSQueue) DeletePayload(ctx context.Context, id string) error {
+	err := q.objects.Delete(id)
+	if err != nil && !errors.Is(err, nats.ErrObjectNotFound) {
+		return fmt.Errorf("failed to delete job payload: %w", err)
+	}
+	return nil
+}
+
+// List returns jobs, optionally filtered by state, oldest first
+func (q *NATSQueue) List(ctx context.Context, state string) ([]*Job, error) {
+	keys, err := q.kv.Keys()
+	if err != nil {
+		if errors.Is(err, nats.ErrNoKeysFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(keys))
+	for _, key := range keys {
+		job, err := q.Get(ctx, key)
+		if err != nil {
+			continue
+		}
+		if state != "" && job.State != state {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	return jobs, nil
+}
+
+// Ping reports whether the NATS connection is up
+func (q *NATSQueue) Ping(ctx context.Context) error {
+	if !q.conn.IsConnected() {
+		return fmt.Errorf("not connected to NATS")
+	}
+	return nil
+}
+
+// Close drains the subscription and closes the connection
+func (q *NATSQueue) Close() error {
+	q.conn.Close()
+	return nil
+}
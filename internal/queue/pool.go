@@ -0,0 +1,398 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// ProcessFunc processes one job and returns its result
+type ProcessFunc func(ctx context.Context, job *Job, payload []byte) (*models.ProcessResponse, error)
+
+// RetryPolicy controls how failed jobs are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts before the job is dead-lettered
+	Backoff     time.Duration // Delay before the first retry, doubled on each attempt
+	MaxBackoff  time.Duration // Upper bound of the delay
+}
+
+// Delay returns the backoff before the given (1-based) retry
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Pool runs a bounded number of workers consuming a queue. With a queue
+// implementing Leaser, it renews the leases of the jobs it holds, running or
+// waiting for a retry, and recovers jobs whose lease expired.
+type Pool struct {
+	queue   Queue
+	process ProcessFunc
+	retry   RetryPolicy
+	workers int
+	worker  string // Recorded on the jobs this pool picks up
+
+	leaser    Leaser        // nil when the queue does not lease jobs
+	heartbeat time.Duration // Interval of lease renewals and recovery
+	stopped   chan struct{} // Closed by Stop, ending lease renewals
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// jobCtx is passed to running jobs and cancelled when Stop gives up waiting
+	jobCtx context.Context
+	abort  context.CancelFunc
+
+	mu      sync.Mutex
+	retries map[string]*pendingRetry
+	running map[string]*runningJob
+}
+
+// pendingRetry is a retry waiting for its backoff to elapse
+type pendingRetry struct {
+	timer *time.Timer
+	job   Job
+}
+
+// runningJob is a job being processed, whose lease the pool renews
+type runningJob struct {
+	job    Job
+	cancel context.CancelFunc
+	lost   bool // The lease expired and the job went to another worker
+}
+
+// NewPool creates a worker pool. Jobs of a Leaser queue are leased for
+// lease, which the pool renews every third of it.
+func NewPool(queue Queue, process ProcessFunc, workers int, retry RetryPolicy, lease time.Duration) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = 3 // Default attempts
+	}
+	if retry.Backoff <= 0 {
+		retry.Backoff = 10 * time.Second // Default first retry delay
+	}
+	if lease <= 0 {
+		lease = time.Minute // Default lease
+	}
+	leaser, _ := queue.(Leaser)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobCtx, abort := context.WithCancel(context.Background())
+	return &Pool{
+		queue:   queue,
+		process: process,
+		retry:   retry,
+		workers: workers,
+		worker:  workerName(),
+
+		leaser:    leaser,
+		heartbeat: lease / 3,
+		stopped:   make(chan struct{}),
+
+		ctx:     ctx,
+		cancel:  cancel,
+		jobCtx:  jobCtx,
+		abort:   abort,
+		retries: make(map[string]*pendingRetry),
+		running: make(map[string]*runningJob),
+	}
+}
+
+// MaxAttempts returns the configured attempts per job
+func (p *Pool) MaxAttempts() int {
+	return p.retry.MaxAttempts
+}
+
+// Start launches the workers
+func (p *Pool) Start() {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	if p.leaser != nil {
+		go p.renewLeases()
+	}
+}
+
+// Stop stops taking new jobs and waits for running jobs to finish or ctx to
+// expire, in which case running jobs are aborted. Retries still waiting for
+// their backoff are handed to the queue right away so durable backends keep them.
+func (p *Pool) Stop(ctx context.Context) error {
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		p.abort()
+	}
+
+	p.flushRetries()
+	close(p.stopped)
+	return err
+}
+
+// flushRetries requeues pending retries without waiting for their backoff
+func (p *Pool) flushRetries() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, pending := range p.retries {
+		delete(p.retries, id)
+		if !pending.timer.Stop() {
+			continue // Already firing
+		}
+		job := pending.job
+		if err := p.queue.Requeue(context.Background(), &job); err != nil {
+			slog.Warn("failed to requeue job", "job_id", id, "error", err)
+		}
+	}
+}
+
+// work consumes jobs until the pool is stopped
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for {
+		job, err := p.queue.Dequeue(p.ctx)
+		if err != nil {
+			if errors.Is(err, ErrClosed) || p.ctx.Err() != nil {
+				return
+			}
+			slog.Warn("failed to dequeue job", "error", err)
+			select {
+			case <-time.After(time.Second):
+			case <-p.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		p.run(job)
+	}
+}
+
+// run processes one job and records the outcome
+func (p *Pool) run(job *Job) {
+	// Job state is always persisted; only the processing itself can be aborted
+	ctx := context.Background()
+	jobCtx, cancel := context.WithCancel(p.jobCtx)
+	defer cancel()
+	p.track(job, cancel)
+
+	job.Worker = p.worker
+	job.State = StateProcessing
+	job.Attempts++
+	job.NextAttemptAt = nil
+	job.UpdatedAt = time.Now()
+	if err := p.queue.Update(ctx, job); err != nil {
+		slog.Warn("failed to update job", "job_id", job.ID, "error", err)
+	}
+
+	payload, err := p.queue.Payload(ctx, job.ID)
+	var result *models.ProcessResponse
+	if err == nil {
+		result, err = p.process(jobCtx, job, payload)
+	}
+	if p.untrack(job.ID) {
+		slog.Warn("job lease lost, leaving the job to its new worker", "job_id", job.ID)
+		return
+	}
+
+	job.UpdatedAt = time.Now()
+
+	if err == nil {
+		job.State = StateSucceeded
+		job.LastError = ""
+		job.Result = result
+		p.finish(ctx, job, true)
+		return
+	}
+
+	job.LastError = err.Error()
+	job.Result = result
+	job.Failures = append(job.Failures, newFailure(job.Attempts, result, err))
+	if len(job.Failures) > maxFailures {
+		job.Failures = job.Failures[len(job.Failures)-maxFailures:]
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		job.State = StateDeadLetter
+		p.finish(ctx, job, false)
+		return
+	}
+
+	// Schedule a retry with exponential backoff
+	delay := p.retry.Delay(job.Attempts)
+	next := time.Now().Add(delay)
+	job.State = StateRetrying
+	job.NextAttemptAt = &next
+	if err := p.queue.Update(ctx, job); errors.Is(err, ErrLeaseLost) {
+		slog.Warn("job lease lost, leaving the job to its new worker", "job_id", job.ID)
+		return
+	} else if err != nil {
+		slog.Warn("failed to update job", "job_id", job.ID, "error", err)
+	}
+
+	p.scheduleRetry(*job, delay)
+}
+
+// scheduleRetry requeues a job once its backoff has elapsed
+func (p *Pool) scheduleRetry(job Job, delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending := &pendingRetry{job: job}
+	pending.timer = time.AfterFunc(delay, func() {
+		p.mu.Lock()
+		delete(p.retries, job.ID)
+		p.mu.Unlock()
+
+		if err := p.queue.Requeue(context.Background(), &job); err != nil {
+			slog.Warn("failed to requeue job", "job_id", job.ID, "error", err)
+		}
+	})
+	p.retries[job.ID] = pending
+}
+
+// finish persists a terminal job state. With a Leaser the state is stored as
+// the lease ends, so a worker that lost the job does not overwrite it.
+// Payloads of successful jobs are dropped; dead-lettered jobs keep theirs for
+// inspection and replay.
+func (p *Pool) finish(ctx context.Context, job *Job, succeeded bool) {
+	var err error
+	if p.leaser != nil {
+		err = p.leaser.Release(ctx, job)
+	} else {
+		err = p.queue.Update(ctx, job)
+	}
+	if errors.Is(err, ErrLeaseLost) {
+		slog.Warn("job lease lost, leaving the job to its new worker", "job_id", job.ID)
+		return
+	}
+	if err != nil {
+		slog.Warn("failed to update job", "job_id", job.ID, "error", err)
+	}
+	if succeeded {
+		if err := p.queue.DeletePayload(ctx, job.ID); err != nil {
+			slog.Warn("failed to delete job payload", "job_id", job.ID, "error", err)
+		}
+	}
+}
+
+// track registers a job being processed for lease renewal
+func (p *Pool) track(job *Job, cancel context.CancelFunc) {
+	if p.leaser == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running[job.ID] = &runningJob{job: *job, cancel: cancel}
+}
+
+// untrack ends the lease renewal of a processed job, reporting whether its
+// lease was lost meanwhile
+func (p *Pool) untrack(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	running, ok := p.running[id]
+	delete(p.running, id)
+	return ok && running.lost
+}
+
+// renewLeases renews the leases of held jobs and recovers expired ones
+// every heartbeat until the pool is stopped
+func (p *Pool) renewLeases() {
+	ticker := time.NewTicker(p.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stopped:
+			return
+		}
+
+		p.mu.Lock()
+		held := make([]Job, 0, len(p.running)+len(p.retries))
+		for _, running := range p.running {
+			held = append(held, running.job)
+		}
+		for _, pending := range p.retries {
+			held = append(held, pending.job)
+		}
+		p.mu.Unlock()
+
+		for i := range held {
+			ctx, cancel := context.WithTimeout(context.Background(), p.heartbeat)
+			err := p.leaser.Heartbeat(ctx, &held[i])
+			cancel()
+			if errors.Is(err, ErrLeaseLost) {
+				p.loseLease(held[i].ID)
+			} else if err != nil {
+				slog.Warn("failed to renew job lease", "job_id", held[i].ID, "error", err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.heartbeat)
+		ids, err := p.leaser.RecoverExpired(ctx)
+		cancel()
+		if err != nil {
+			slog.Warn("failed to recover expired jobs", "error", err)
+		}
+		for _, id := range ids {
+			slog.Warn("job lease expired, requeued", "job_id", id)
+		}
+	}
+}
+
+// loseLease gives up a job whose lease expired: processing is cancelled and
+// a pending retry dropped, as another worker has the job now
+func (p *Pool) loseLease(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if running, ok := p.running[id]; ok {
+		running.lost = true
+		running.cancel()
+	}
+	if pending, ok := p.retries[id]; ok && pending.timer.Stop() {
+		delete(p.retries, id)
+		slog.Warn("job lease lost, dropping its retry", "job_id", id)
+	}
+}
+
+// workerName identifies this process in the jobs it picks up, as the host
+// name and a random suffix telling apart instances on the same host
+func workerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	b := make([]byte, 3)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
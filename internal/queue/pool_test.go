@@ -0,0 +1,245 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// leasingQueue is a MemoryQueue implementing Leaser, whose heartbeats fail
+// with ErrLeaseLost once lost is set, and releases once releaseLost is set
+type leasingQueue struct {
+	*MemoryQueue
+	lost        atomic.Bool
+	releaseLost atomic.Bool
+	heartbeats  atomic.Int32
+	released    atomic.Int32
+}
+
+func (q *leasingQueue) Heartbeat(ctx context.Context, job *Job) error {
+	q.heartbeats.Add(1)
+	if q.lost.Load() {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (q *leasingQueue) Release(ctx context.Context, job *Job) error {
+	q.released.Add(1)
+	if q.releaseLost.Load() {
+		return ErrLeaseLost
+	}
+	return q.Update(ctx, job)
+}
+
+func (q *leasingQueue) RecoverExpired(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+// waitState polls until the job reaches state
+func waitState(t *testing.T, q Queue, id, state string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, err := q.Get(context.Background(), id)
+		if err == nil && job.State == state {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s = %+v, %v, want state %s", id, job, err, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func enqueue(t *testing.T, q Queue, id string, maxAttempts int) {
+	t.Helper()
+	job := &Job{ID: id, State: StatePending, MaxAttempts: maxAttempts, CreatedAt: time.Now()}
+	if err := q.Enqueue(context.Background(), job, []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func stopPool(t *testing.T, p *Pool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.Stop(ctx); err != nil {
+		t.Errorf("Stop: %v", err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestPoolOutcomes(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int // Attempts failing before one succeeds
+		maxAttempts int
+		state       string
+		attempts    int
+		payload     bool // Kept after the job finished
+	}{
+		{"success", 0, 3, StateSucceeded, 1, false},
+		{"success after retries", 2, 3, StateSucceeded, 3, false},
+		{"dead letter", 5, 3, StateDeadLetter, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewMemoryQueue(10)
+			var calls atomic.Int32
+			process := func(ctx context.Context, job *Job, payload []byte) (*models.ProcessResponse, error) {
+				if int(calls.Add(1)) <= tt.failures {
+					return &models.ProcessResponse{Code: "provider_unavailable"}, errors.New("provider down")
+				}
+				return &models.ProcessResponse{Success: true}, nil
+			}
+			p := NewPool(q, process, 1, RetryPolicy{MaxAttempts: tt.maxAttempts, Backoff: time.Millisecond}, 0)
+			p.Start()
+			defer stopPool(t, p)
+
+			enqueue(t, q, "job-1", tt.maxAttempts)
+			job := waitState(t, q, "job-1", tt.state)
+
+			if job.Attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", job.Attempts, tt.attempts)
+			}
+			if want := min(tt.failures, tt.attempts); len(job.Failures) != want {
+				t.Errorf("failures = %d, want %d", len(job.Failures), want)
+			}
+			if len(job.Failures) > 0 && (job.Failures[0].Code != "provider_unavailable" || job.Failures[0].Attempt != 1) {
+				t.Errorf("first failure = %+v", job.Failures[0])
+			}
+			_, err := q.Payload(context.Background(), job.ID)
+			if (err == nil) != tt.payload {
+				t.Errorf("payload kept = %v, want %v", err == nil, tt.payload)
+			}
+		})
+	}
+}
+
+func TestPoolStopRequeuesPendingRetries(t *testing.T) {
+	q := NewMemoryQueue(10)
+	process := func(ctx context.Context, job *Job, payload []byte) (*models.ProcessResponse, error) {
+		return nil, errors.New("provider down")
+	}
+	p := NewPool(q, process, 1, RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}, 0)
+	p.Start()
+
+	enqueue(t, q, "job-1", 3)
+	waitState(t, q, "job-1", StateRetrying)
+	stopPool(t, p)
+
+	select {
+	case id := <-q.ready:
+		if id != "job-1" {
+			t.Errorf("requeued %s, want job-1", id)
+		}
+	default:
+		t.Error("pending retry was not requeued on Stop")
+	}
+}
+
+func TestPoolRenewsLeases(t *testing.T) {
+	q := &leasingQueue{MemoryQueue: NewMemoryQueue(10)}
+	release := make(chan struct{})
+	process := func(ctx context.Context, job *Job, payload []byte) (*models.ProcessResponse, error) {
+		<-release
+		return &models.ProcessResponse{Success: true}, nil
+	}
+	p := NewPool(q, process, 1, RetryPolicy{}, 30*time.Millisecond)
+	p.Start()
+	defer stopPool(t, p)
+
+	enqueue(t, q, "job-1", 3)
+	waitState(t, q, "job-1", StateProcessing)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	waitState(t, q, "job-1", StateSucceeded)
+	if n := q.heartbeats.Load(); n == 0 {
+		t.Error("lease of the running job was not renewed")
+	}
+	if n := q.released.Load(); n != 1 {
+		t.Errorf("lease released %d times, want 1", n)
+	}
+}
+
+func TestPoolGivesUpLostLeases(t *testing.T) {
+	q := &leasingQueue{MemoryQueue: NewMemoryQueue(10)}
+	q.lost.Store(true)
+
+	var cancelled sync.WaitGroup
+	cancelled.Add(1)
+	process := func(ctx context.Context, job *Job, payload []byte) (*models.ProcessResponse, error) {
+		<-ctx.Done()
+		cancelled.Done()
+		return nil, ctx.Err()
+	}
+	p := NewPool(q, process, 1, RetryPolicy{MaxAttempts: 1}, 30*time.Millisecond)
+	p.Start()
+	defer stopPool(t, p)
+
+	enqueue(t, q, "job-1", 1)
+	cancelled.Wait()
+	time.Sleep(20 * time.Millisecond)
+
+	// The new owner records the outcome, not this worker
+	job, _ := q.Get(context.Background(), "job-1")
+	if job.State != StateProcessing || len(job.Failures) != 0 {
+		t.Errorf("job = %s with %d failures, want it left processing", job.State, len(job.Failures))
+	}
+	if n := q.released.Load(); n != 0 {
+		t.Errorf("lost lease released %d times", n)
+	}
+}
+
+func TestPoolKeepsPayloadOfLostRelease(t *testing.T) {
+	q := &leasingQueue{MemoryQueue: NewMemoryQueue(10)}
+	q.releaseLost.Store(true)
+
+	done := make(chan struct{})
+	process := func(ctx context.Context, job *Job, payload []byte) (*models.ProcessResponse, error) {
+		defer close(done)
+		return &models.ProcessResponse{Success: true}, nil
+	}
+	p := NewPool(q, process, 1, RetryPolicy{}, time.Minute)
+	p.Start()
+	defer stopPool(t, p)
+
+	enqueue(t, q, "job-1", 3)
+	<-done
+	time.Sleep(20 * time.Millisecond)
+
+	// The lease expired before the result was stored: the new owner needs
+	// the payload, and the state is its to write
+	job, _ := q.Get(context.Background(), "job-1")
+	if job.State != StateProcessing {
+		t.Errorf("job = %s, want it left processing", job.State)
+	}
+	if _, err := q.Payload(context.Background(), "job-1"); err != nil {
+		t.Errorf("payload of the job was dropped: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Job states
+const (
+	StatePending    = "pending"     // Waiting for a worker
+	StateProcessing = "processing"  // Picked up by a worker
+	StateRetrying   = "retrying"    // Failed, scheduled for another attempt
+	StateSucceeded  = "succeeded"   // Finished successfully
+	StateDeadLetter = "dead_letter" // Failed max attempts, kept for inspection
+)
+
+// ErrNotFound is returned when a job does not exist
+var ErrNotFound = errors.New("job not found")
+
+// ErrFull is returned when the queue cannot accept more jobs
+var ErrFull = errors.New("queue is full")
+
+// ErrClosed is returned by Dequeue once the queue has been closed
+var ErrClosed = errors.New("queue closed")
+
+// ErrStateChanged is returned by Retry when the job left the dead-letter
+// state, e.g. because a concurrent retry already requeued it
+var ErrStateChanged = errors.New("job state changed")
+
+// ErrLeaseLost is returned when the lease of a job expired and the job was
+// handed to another worker
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Job is an asynchronous invoice processing request
+type Job struct {
+	ID          string `json:"id"`
+	TenantID    string `json:"tenantId,omitempty"`
+	CallerKey   string `json:"callerKey,omitempty"` // Usage accounting key of the submitter (key name, never the secret)
+	RequestID   string `json:"requestId,omitempty"` // X-Request-ID of the submitting request
+	State       string `json:"state"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"maxAttempts"`
+	LastError   string `json:"lastError,omitempty"`
+	Worker      string `json:"worker,omitempty"` // Worker that last picked the job up, as host-id
+
+	// Processing parameters
+	Filename string                  `json:"filename,omitempty"`
+	Request  models.ProcessRequest   `json:"request"`
+	Result   *models.ProcessResponse `json:"result,omitempty"`
+
+	Failures []Failure `json:"failures,omitempty"` // Failed attempts, oldest first, up to maxFailures
+
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+
+	lease string // Token of the dequeue holding the job, for Leaser backends
+}
+
+// maxFailures bounds the failed attempts a job keeps
+const maxFailures = 10
+
+// Failure describes a failed attempt of a job
+type Failure struct {
+	Attempt          int       `json:"attempt"`
+	Code             string    `json:"code,omitempty"`  // As in failure responses, e.g. "provider_unavailable"
+	Stage            string    `json:"stage,omitempty"` // Pipeline stage that failed
+	Errors           []string  `json:"errors"`          // Error chain, outermost first
+	ProviderResponse string    `json:"providerResponse,omitempty"`
+	At               time.Time `json:"at"`
+}
+
+// newFailure records a failed attempt from its error and failure response,
+// which may be nil
+func newFailure(attempt int, result *models.ProcessResponse, err error) Failure {
+	failure := Failure{Attempt: attempt, Errors: errorChain(err), At: time.Now()}
+	if result != nil {
+		failure.Code = result.Code
+		failure.Stage = result.Stage
+		failure.ProviderResponse = result.ProviderResponse
+	}
+	return failure
+}
+
+// errorChain splits an error into the messages of its wrapping levels, each
+// without the message of the error it wraps. Levels adding nothing, such as
+// a stage error, are skipped.
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		message := err.Error()
+		inner := errors.Unwrap(err)
+		if inner != nil {
+			if message == inner.Error() {
+				err = inner
+				continue
+			}
+			message = strings.TrimSuffix(message, ": "+inner.Error())
+		}
+		chain = append(chain, message)
+		err = inner
+	}
+	return chain
+}
+
+// Queue stores jobs and their payloads and hands job IDs to workers
+type Queue interface {
+	// Enqueue stores the job and its payload and schedules it for processing
+	Enqueue(ctx context.Context, job *Job, payload []byte) error
+	// Requeue schedules an existing job for another attempt, ending the
+	// lease of a dequeued job
+	Requeue(ctx context.Context, job *Job) error
+	// Retry stores job, a dead-lettered job reset for another run, and
+	// schedules it, or fails with ErrStateChanged when the stored job is no
+	// longer dead-lettered. The check and the update are atomic.
+	Retry(ctx context.Context, job *Job) error
+	// Dequeue blocks until a job is available or ctx is done
+	Dequeue(ctx context.Context) (*Job, error)
+	// Update persists the state of a job
+	Update(ctx context.Context, job *Job) error
+	// Get loads a job
+	Get(ctx context.Context, id string) (*Job, error)
+	// Payload loads the uploaded image of a job
+	Payload(ctx context.Context, id string) ([]byte, error)
+	// DeletePayload drops the uploaded image once it is no longer needed
+	DeletePayload(ctx context.Context, id string) error
+	// List returns jobs, optionally filtered by state
+	List(ctx context.Context, state string) ([]*Job, error)
+	// Ping checks connectivity to the backend
+	Ping(ctx context.Context) error
+	// Close releases backend resources and unblocks Dequeue
+	Close() error
+}
+
+// Leaser is implemented by queues shared between service instances. A
+// dequeued job is leased to the worker that took it until it finishes or is
+// requeued; a lease that is not renewed, e.g. because the instance died,
+// expires and the job is handed to another worker.
+type Leaser interface {
+	// Heartbeat renews the lease of a dequeued job, or fails with
+	// ErrLeaseLost when it already expired
+	Heartbeat(ctx context.Context, job *Job) error
+	// Release stores a job that reached a final state and ends its lease,
+	// or fails with ErrLeaseLost, leaving the job untouched, when it already
+	// expired
+	Release(ctx context.Context, job *Job) error
+	// RecoverExpired requeues jobs whose lease expired and returns their IDs
+	RecoverExpired(ctx context.Context) ([]string, error)
+}
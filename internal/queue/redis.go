@@ -0,0 +1,428 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// heartbeatScript renews a lease if the token still holds it.
+	// KEYS: owners, leases. ARGV: job ID, token, expiry in ms.
+	heartbeatScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then return 0 end
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+return 1`)
+
+	// updateScript stores a job if the token still holds its lease, so a
+	// worker that lost it cannot overwrite the state written by the new one.
+	// KEYS: owners, job. ARGV: job ID, token, job data.
+	updateScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then return 0 end
+redis.call('SET', KEYS[2], ARGV[3])
+return 1`)
+
+	// releaseScript stores a job and ends the lease held by the token in one
+	// step, pushing the job back to the ready list when ARGV[3] is 1. With a
+	// TTL in ARGV[5], the job and its payload expire after that many ms.
+	// KEYS: owners, leases, processing, ready, job, payload.
+	// ARGV: job ID, token, push, job data, TTL in ms or 0.
+	releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) ~= ARGV[2] then return 0 end
+redis.call('HDEL', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('LREM', KEYS[3], 1, ARGV[1])
+if ARGV[5] ~= '0' then
+  redis.call('SET', KEYS[5], ARGV[4], 'PX', ARGV[5])
+  redis.call('PEXPIRE', KEYS[6], ARGV[5])
+else
+  redis.call('SET', KEYS[5], ARGV[4])
+end
+if ARGV[3] == '1' then redis.call('LPUSH', KEYS[4], ARGV[1]) end
+return 1`)
+
+	// recoverScript moves jobs whose lease expired from the processing list
+	// back to the ready list. A job without a lease, taken by a worker that
+	// died before recording it, gets one so it is recovered in turn.
+	// KEYS: processing, leases, owners, ready. ARGV: now and expiry in ms.
+	recoverScript = redis.NewScript(`
+local recovered = {}
+for _, id in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+  local expiry = redis.call('ZSCORE', KEYS[2], id)
+  if not expiry then
+    redis.call('ZADD', KEYS[2], 'NX', ARGV[2], id)
+  elseif tonumber(expiry) < tonumber(ARGV[1]) then
+    redis.call('ZREM', KEYS[2], id)
+    redis.call('HDEL', KEYS[3], id)
+    redis.call('LREM', KEYS[1], 1, id)
+    redis.call('LPUSH', KEYS[4], id)
+    table.insert(recovered, id)
+  end
+end
+return recovered`)
+)
+
+// RedisQueue implements Queue and Leaser on Redis, so several service
+// instances can share work. Dequeued jobs move to a processing list and are
+// leased to their worker until they finish. Finished jobs expire.
+type RedisQueue struct {
+	client   *redis.Client
+	prefix   string
+	lease    time.Duration
+	finished time.Duration // TTL of succeeded and dead-lettered jobs
+}
+
+// NewRedisQueue connects to Redis. Jobs are leased for lease at a time, and
+// deleted with their payload finished after they succeed or are dead-lettered.
+func NewRedisQueue(addr, password string, db int, prefix string, lease, finished time.Duration) (*RedisQueue, error) {
+	if prefix == "" {
+		prefix = "invoice-ocr" // Default key prefix
+	}
+	if lease <= 0 {
+		lease = time.Minute // Default lease
+	}
+	if finished <= 0 {
+		finished = 7 * 24 * time.Hour // Default TTL of finished jobs
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisQueue{
+		client:   client,
+		prefix:   prefix,
+		lease:    lease,
+		finished: finished,
+	}, nil
+}
+
+// Enqueue stores the job and its payload and schedules it for processing
+func (q *RedisQueue) Enqueue(ctx context.Context, job *Job, payload []byte) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, q.jobKey(job.ID), data, 0)
+		pipe.Set(ctx, q.payloadKey(job.ID), payload, 0)
+		pipe.SAdd(ctx, q.key("jobs"), job.ID)
+		pipe.LPush(ctx, q.key("ready"), job.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	return nil
+}
+
+// Requeue schedules an existing job for another attempt, ending the lease
+// of a dequeued job. A job whose lease was lost is left to its new holder.
+func (q *RedisQueue) Requeue(ctx context.Context, job *Job) error {
+	if job.lease != "" {
+		return q.release(ctx, job, true, 0)
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, q.jobKey(job.ID), data, 0)
+		pipe.LPush(ctx, q.key("ready"), job.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to requeue job: %w", err)
+	}
+	return nil
+}
+
+// Retry schedules a dead-lettered job again. The job key is watched so a
+// concurrent retry makes the transaction fail. The job and its payload no
+// longer expire.
+func (q *RedisQueue) Retry(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	key := q.jobKey(job.ID)
+	err = q.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return ErrNotFound
+			}
+			return fmt.Errorf("failed to load job: %w", err)
+		}
+		var stored Job
+		if err := json.Unmarshal(current, &stored); err != nil {
+			return fmt.Errorf("failed to parse job: %w", err)
+		}
+		if stored.State != StateDeadLetter {
+			return ErrStateChanged
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			pipe.Persist(ctx, q.payloadKey(job.ID))
+			pipe.LPush(ctx, q.key("ready"), job.ID)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return ErrStateChanged
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrStateChanged) {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+	return err
+}
+
+// Dequeue blocks until a job is available or ctx is done, and leases it
+func (q *RedisQueue) Dequeue(ctx context.Context) (*Job, error) {
+	for {
+		// Short blocking moves so cancellation is noticed promptly
+		id, err := q.client.BLMove(ctx, q.key("ready"), q.key("processing"), "RIGHT", "LEFT", 5*time.Second).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if errors.Is(err, redis.ErrClosed) {
+				return nil, ErrClosed
+			}
+			return nil, fmt.Errorf("failed to dequeue job: %w", err)
+		}
+
+		job, err := q.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			q.client.LRem(ctx, q.key("processing"), 1, id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := newLeaseToken()
+		if err != nil {
+			return nil, err
+		}
+		_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, q.key("lease-owners"), id, token)
+			pipe.ZAdd(ctx, q.key("leases"), redis.Z{Score: float64(q.expiry()), Member: id})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to lease job: %w", err)
+		}
+		job.lease = token
+		return job, nil
+	}
+}
+
+// Heartbeat renews the lease of a dequeued job
+func (q *RedisQueue) Heartbeat(ctx context.Context, job *Job) error {
+	held, err := heartbeatScript.Run(ctx, q.client,
+		[]string{q.key("lease-owners"), q.key("leases")},
+		job.ID, job.lease, q.expiry(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to renew job lease: %w", err)
+	}
+	if held == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Release stores a job that reached a final state and ends its lease. The
+// job and its payload expire after the finished TTL.
+func (q *RedisQueue) Release(ctx context.Context, job *Job) error {
+	return q.release(ctx, job, false, q.finished)
+}
+
+// RecoverExpired requeues jobs whose lease expired
+func (q *RedisQueue) RecoverExpired(ctx context.Context) ([]string, error) {
+	ids, err := recoverScript.Run(ctx, q.client,
+		[]string{q.key("processing"), q.key("leases"), q.key("lease-owners"), q.key("ready")},
+		time.Now().UnixMilli(), q.expiry(),
+	).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to recover expired jobs: %w", err)
+	}
+	return ids, nil
+}
+
+// release stores job and ends its lease, pushing it back to the ready list
+// with push. A positive ttl makes the job and its payload expire.
+func (q *RedisQueue) release(ctx context.Context, job *Job, push bool, ttl time.Duration) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	flag := "0"
+	if push {
+		flag = "1"
+	}
+	held, err := releaseScript.Run(ctx, q.client,
+		[]string{
+			q.key("lease-owners"), q.key("leases"), q.key("processing"), q.key("ready"),
+			q.jobKey(job.ID), q.payloadKey(job.ID),
+		},
+		job.ID, job.lease, flag, data, ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to release job lease: %w", err)
+	}
+	if held == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// expiry returns the expiry of a lease taken or renewed now, in ms
+func (q *RedisQueue) expiry() int64 {
+	return time.Now().Add(q.lease).UnixMilli()
+}
+
+// Update persists the state of a job. A dequeued job is only stored while
+// its lease is held, failing with ErrLeaseLost otherwise.
+func (q *RedisQueue) Update(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	if job.lease == "" {
+		return q.client.Set(ctx, q.jobKey(job.ID), data, 0).Err()
+	}
+
+	held, err := updateScript.Run(ctx, q.client,
+		[]string{q.key("lease-owners"), q.jobKey(job.ID)},
+		job.ID, job.lease, data,
+	).Int()
+	if err != nil {
+		return fmt.Errorf("failed to store job: %w", err)
+	}
+	if held == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Get loads a job
+func (q *RedisQueue) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := q.client.Get(ctx, q.jobKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load job: %w", err)
+	}
+
+	var job Job
+	err = json.Unmarshal(data, &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// Payload loads the uploaded image of a job
+func (q *RedisQueue) Payload(ctx context.Context, id string) ([]byte, error) {
+	data, err := q.client.Get(ctx, q.payloadKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load job payload: %w", err)
+	}
+	return data, nil
+}
+
+// DeletePayload drops the uploaded image once it is no longer needed
+func (q *RedisQueue) DeletePayload(ctx context.Context, id string) error {
+	return q.client.Del(ctx, q.payloadKey(id)).Err()
+}
+
+// List returns jobs, optionally filtered by state, oldest first. Expired
+// jobs are dropped from the job set as they are found.
+func (q *RedisQueue) List(ctx context.Context, state string) ([]*Job, error) {
+	ids, err := q.client.SMembers(ctx, q.key("jobs")).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := q.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			q.client.SRem(ctx, q.key("jobs"), id)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if state != "" && job.State != state {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+
+	return jobs, nil
+}
+
+// Ping checks the Redis connection
+func (q *RedisQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
+// Close releases the Redis connection
+func (q *RedisQueue) Close() error {
+	return q.client.Close()
+}
+
+func (q *RedisQueue) key(name string) string {
+	return q.prefix + ":" + name
+}
+
+func (q *RedisQueue) jobKey(id string) string {
+	return q.prefix + ":job:" + id
+}
+
+func (q *RedisQueue) payloadKey(id string) string {
+	return q.prefix + ":payload:" + id
+}
+
+// newLeaseToken returns a random token identifying one dequeue of a job
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lease token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,218 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSaturated is returned when no processing slot is free and the wait queue is full
+var ErrSaturated = errors.New("server is at capacity")
+
+// Priority is the lane a request waits in for a processing slot
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // A client is waiting for the response (default)
+	PriorityBatch                       // Bulk work such as async jobs; yields to interactive requests
+)
+
+// String returns the name used by the X-Priority header
+func (p Priority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// ParsePriority reads a priority name, "interactive" or "batch"
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "interactive":
+		return PriorityInteractive, nil
+	case "batch":
+		return PriorityBatch, nil
+	}
+	return 0, fmt.Errorf("unknown priority %q, expected interactive or batch", name)
+}
+
+// priorityKey is the context key of a request's Priority
+type priorityKey struct{}
+
+// WithPriority returns a context whose slot acquisitions wait in lane p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority of ctx, PriorityInteractive when unset
+func PriorityFrom(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// ConcurrencyLimiter bounds the number of requests processed at once, queueing
+// a limited number of waiters in two lanes. A freed slot goes to the oldest
+// interactive waiter, and to batch waiters only when no interactive request
+// waits; batch work also holds at most maxBatch slots, leaving the rest to
+// interactive requests.
+type ConcurrencyLimiter struct {
+	maxInFlight  int
+	maxBatch     int
+	maxQueue     int
+	queueTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	batch    int           // Slots held by batch work
+	waiters  [2]*list.List // Of *slotWaiter, by Priority
+}
+
+// slotWaiter is a request waiting for a slot; ready is closed once granted
+type slotWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewConcurrencyLimiter creates a limiter with maxInFlight slots, of which
+// batch work holds up to maxBatch, and up to maxQueue waiters per lane
+func NewConcurrencyLimiter(maxInFlight, maxBatch, maxQueue int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	if maxBatch <= 0 || maxBatch > maxInFlight {
+		maxBatch = max(1, maxInFlight/2) // Default: half the slots
+	}
+	if queueTimeout <= 0 {
+		queueTimeout = 30 * time.Second // Default queue wait
+	}
+	return &ConcurrencyLimiter{
+		maxInFlight:  maxInFlight,
+		maxBatch:     maxBatch,
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+		waiters:      [2]*list.List{list.New(), list.New()},
+	}
+}
+
+// Acquire takes a processing slot in the lane of ctx's priority, waiting in
+// the queue if there is room. The returned release function must be called
+// when processing finishes.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context) (func(), error) {
+	return c.acquire(ctx, true)
+}
+
+// Wait takes a slot like Acquire, but waits regardless of the queue length
+// and the queue timeout, until ctx is done. It is for callers that bound
+// their waiters themselves, such as the job workers.
+func (c *ConcurrencyLimiter) Wait(ctx context.Context) (func(), error) {
+	return c.acquire(ctx, false)
+}
+
+func (c *ConcurrencyLimiter) acquire(ctx context.Context, bounded bool) (func(), error) {
+	priority := PriorityFrom(ctx)
+
+	c.mu.Lock()
+	// Fast path: free slot and nobody ahead
+	if c.waiters[PriorityInteractive].Len() == 0 && c.waiters[priority].Len() == 0 && c.available(priority) {
+		c.take(priority)
+		c.mu.Unlock()
+		return c.releaseFunc(priority), nil
+	}
+	if bounded && c.waiters[priority].Len() >= c.maxQueue {
+		c.mu.Unlock()
+		return nil, ErrSaturated
+	}
+	waiter := &slotWaiter{ready: make(chan struct{})}
+	element := c.waiters[priority].PushBack(waiter)
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if bounded {
+		timer := time.NewTimer(c.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-waiter.ready:
+		return c.releaseFunc(priority), nil
+	case <-timeout:
+		err = ErrSaturated
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if waiter.granted {
+		// Granted while giving up: hand the slot on
+		c.free(priority)
+	} else {
+		c.waiters[priority].Remove(element)
+	}
+	return nil, err
+}
+
+// available reports whether a request of priority p can take a slot now
+func (c *ConcurrencyLimiter) available(p Priority) bool {
+	if c.inFlight >= c.maxInFlight {
+		return false
+	}
+	return p == PriorityInteractive || c.batch < c.maxBatch
+}
+
+func (c *ConcurrencyLimiter) take(p Priority) {
+	c.inFlight++
+	if p == PriorityBatch {
+		c.batch++
+	}
+}
+
+func (c *ConcurrencyLimiter) releaseFunc(p Priority) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.free(p)
+		})
+	}
+}
+
+// free returns a slot of priority p and grants freed slots to waiters,
+// interactive ones first
+func (c *ConcurrencyLimiter) free(p Priority) {
+	c.inFlight--
+	if p == PriorityBatch {
+		c.batch--
+	}
+	for _, lane := range []Priority{PriorityInteractive, PriorityBatch} {
+		for c.waiters[lane].Len() > 0 && c.available(lane) {
+			waiter := c.waiters[lane].Remove(c.waiters[lane].Front()).(*slotWaiter)
+			c.take(lane)
+			waiter.granted = true
+			close(waiter.ready)
+		}
+		if c.waiters[lane].Len() > 0 {
+			return // Lower lanes wait behind this one
+		}
+	}
+}
+
+// InFlight returns the number of requests currently being processed
+func (c *ConcurrencyLimiter) InFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight
+}
+
+// Queued returns the number of requests waiting for a slot
+func (c *ConcurrencyLimiter) Queued() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.waiters[PriorityInteractive].Len() + c.waiters[PriorityBatch].Len()
+}
@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued blocks until c has n waiters
+func waitQueued(t *testing.T, c *ConcurrencyLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for c.Queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Queued = %d, want %d", c.Queued(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Priority
+		wantErr bool
+	}{
+		{"interactive", PriorityInteractive, false},
+		{"batch", PriorityBatch, false},
+		{"urgent", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePriority(tt.name)
+		if (err != nil) != tt.wantErr || p != tt.want {
+			t.Errorf("ParsePriority(%q) = %v, %v", tt.name, p, err)
+		}
+		if err == nil && p.String() != tt.name {
+			t.Errorf("String() = %q, want %q", p.String(), tt.name)
+		}
+	}
+}
+
+func TestAcquireQueueFull(t *testing.T) {
+	c := NewConcurrencyLimiter(1, 1, 1, time.Second)
+	release, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		release, err := c.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		waited <- err
+	}()
+	waitQueued(t, c, 1)
+
+	if _, err := c.Acquire(context.Background()); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("Acquire with a full queue = %v, want ErrSaturated", err)
+	}
+
+	release()
+	if err := <-waited; err != nil {
+		t.Fatalf("queued Acquire = %v", err)
+	}
+	if n := c.InFlight(); n != 0 {
+		t.Errorf("InFlight = %d after release, want 0", n)
+	}
+}
+
+func TestAcquireQueueTimeout(t *testing.T) {
+	c := NewConcurrencyLimiter(1, 1, 1, 20*time.Millisecond)
+	release, _ := c.Acquire(context.Background())
+	defer release()
+
+	if _, err := c.Acquire(context.Background()); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("Acquire = %v, want ErrSaturated", err)
+	}
+	if n := c.Queued(); n != 0 {
+		t.Errorf("Queued = %d after timeout, want 0", n)
+	}
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	c := NewConcurrencyLimiter(1, 1, 1, time.Minute)
+	release, _ := c.Acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire = %v, want DeadlineExceeded", err)
+	}
+	if n := c.Queued(); n != 0 {
+		t.Errorf("Queued = %d after cancel, want 0", n)
+	}
+}
+
+func TestInteractiveBeforeBatch(t *testing.T) {
+	c := NewConcurrencyLimiter(1, 1, 10, time.Second)
+	release, _ := c.Acquire(context.Background())
+
+	order := make(chan Priority, 2)
+	acquire := func(p Priority) {
+		release, err := c.Acquire(WithPriority(context.Background(), p))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		order <- p
+		release()
+	}
+	go acquire(PriorityBatch)
+	waitQueued(t, c, 1)
+	go acquire(PriorityInteractive)
+	waitQueued(t, c, 2)
+
+	release()
+	if first := <-order; first != PriorityInteractive {
+		t.Errorf("first granted lane = %v, want interactive", first)
+	}
+	if second := <-order; second != PriorityBatch {
+		t.Errorf("second granted lane = %v, want batch", second)
+	}
+}
+
+func TestBatchSlotCap(t *testing.T) {
+	c := NewConcurrencyLimiter(3, 1, 10, time.Second)
+	batch := WithPriority(context.Background(), PriorityBatch)
+
+	release, err := c.Acquire(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(batch, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second batch Acquire = %v, want to wait", err)
+	}
+
+	// Interactive requests still get the remaining slots
+	for i := 0; i < 2; i++ {
+		if _, err := c.Acquire(context.Background()); err != nil {
+			t.Fatalf("interactive Acquire %d = %v", i, err)
+		}
+	}
+	release()
+	if n := c.InFlight(); n != 2 {
+		t.Errorf("InFlight = %d, want 2", n)
+	}
+}
+
+func TestWaitIgnoresQueueLength(t *testing.T) {
+	c := NewConcurrencyLimiter(1, 1, 0, 10*time.Millisecond)
+	release, _ := c.Acquire(context.Background())
+
+	granted := make(chan error, 1)
+	go func() {
+		release, err := c.Wait(context.Background())
+		if err == nil {
+			release()
+		}
+		granted <- err
+	}()
+	waitQueued(t, c, 1)
+
+	// Longer than the queue timeout, which Wait does not apply
+	time.Sleep(30 * time.Millisecond)
+	release()
+	if err := <-granted; err != nil {
+		t.Fatalf("Wait = %v", err)
+	}
+}
+
+func TestReleaseIsIdempotent(t *testing.T) {
+	c := NewConcurrencyLimiter(2, 1, 1, time.Second)
+	release, _ := c.Acquire(context.Background())
+	c.Acquire(context.Background())
+
+	release()
+	release()
+	if n := c.InFlight(); n != 1 {
+		t.Errorf("InFlight = %d after double release, want 1", n)
+	}
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often idle buckets are dropped
+const sweepInterval = 10 * time.Minute
+
+// Result describes the outcome of a rate limit check
+type Result struct {
+	Allowed    bool
+	Limit      int           // Bucket capacity
+	Remaining  int           // Tokens left after this request
+	Reset      time.Duration // Time until the bucket is full again
+	RetryAfter time.Duration // Time until the next token (only when not allowed)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a keyed token-bucket rate limiter
+type Limiter struct {
+	rate  float64 // Tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter refilling requestsPerMinute tokens per minute up to burst
+func NewLimiter(requestsPerMinute, burst int) *Limiter {
+	if burst <= 0 {
+		burst = requestsPerMinute
+	}
+	return &Limiter{
+		rate:      float64(requestsPerMinute) / 60,
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetRate changes the refill rate and capacity, keeping existing buckets.
+// Buckets above the new capacity are capped on their next request.
+func (l *Limiter) SetRate(requestsPerMinute, burst int) {
+	if burst <= 0 {
+		burst = requestsPerMinute
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(requestsPerMinute) / 60
+	l.burst = float64(burst)
+}
+
+// Allow takes one token from the bucket identified by key
+func (l *Limiter) Allow(key string) Result {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	result := Result{Limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = l.duration(l.burst - b.tokens)
+
+	return result
+}
+
+// duration returns the time needed to refill the given number of tokens
+func (l *Limiter) duration(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have been idle long enough to be full again (caller holds the lock)
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
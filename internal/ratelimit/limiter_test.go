@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterBurst(t *testing.T) {
+	tests := []struct {
+		name     string
+		rpm      int
+		burst    int
+		requests int
+		allowed  int
+	}{
+		{"burst", 60, 3, 5, 3},
+		{"default burst", 5, 0, 7, 5},
+		{"single token", 1, 1, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.rpm, tt.burst)
+			allowed := 0
+			for i := 0; i < tt.requests; i++ {
+				if l.Allow("key").Allowed {
+					allowed++
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("allowed %d of %d requests, want %d", allowed, tt.requests, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestLimiterResult(t *testing.T) {
+	l := NewLimiter(60, 2)
+
+	first := l.Allow("key")
+	if !first.Allowed || first.Limit != 2 || first.Remaining != 1 {
+		t.Errorf("first = %+v", first)
+	}
+	l.Allow("key")
+	rejected := l.Allow("key")
+	if rejected.Allowed || rejected.Remaining != 0 {
+		t.Errorf("rejected = %+v", rejected)
+	}
+	if rejected.RetryAfter <= 0 || rejected.RetryAfter > time.Second {
+		t.Errorf("RetryAfter = %v, want at most one token at 1/s", rejected.RetryAfter)
+	}
+	if rejected.Reset <= time.Second || rejected.Reset > 2*time.Second {
+		t.Errorf("Reset = %v, want time to refill two tokens", rejected.Reset)
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	l := NewLimiter(60, 1)
+	if !l.Allow("a").Allowed || !l.Allow("b").Allowed {
+		t.Fatal("first request of each key must be allowed")
+	}
+	if l.Allow("a").Allowed {
+		t.Error("second request of a must be rejected")
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := NewLimiter(60, 1)
+	l.Allow("key")
+	if l.Allow("key").Allowed {
+		t.Fatal("bucket should be empty")
+	}
+
+	// Pretend a second has passed
+	l.mu.Lock()
+	l.buckets["key"].last = l.buckets["key"].last.Add(-time.Second)
+	l.mu.Unlock()
+
+	if !l.Allow("key").Allowed {
+		t.Error("bucket should have refilled one token")
+	}
+}
+
+func TestLimiterSetRateCapsBuckets(t *testing.T) {
+	l := NewLimiter(60, 10)
+	l.Allow("key")
+	l.SetRate(60, 2)
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if l.Allow("key").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("allowed %d requests after lowering the burst, want 2", allowed)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := NewLimiter(60, 1)
+	l.Allow("idle")
+
+	l.mu.Lock()
+	l.buckets["idle"].last = time.Now().Add(-time.Hour)
+	l.lastSweep = time.Now().Add(-2 * sweepInterval)
+	l.mu.Unlock()
+
+	l.Allow("other")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket was not swept")
+	}
+}
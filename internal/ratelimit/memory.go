@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryLimiter bounds the estimated memory held by requests at once. A
+// request waits until enough is released, for a limited time.
+type MemoryLimiter struct {
+	limit   int64
+	timeout time.Duration
+
+	mu      sync.Mutex
+	used    int64
+	changed chan struct{} // Closed and replaced on every release
+}
+
+// NewMemoryLimiter creates a limiter of limit bytes
+func NewMemoryLimiter(limit int64, timeout time.Duration) *MemoryLimiter {
+	if timeout <= 0 {
+		timeout = 30 * time.Second // Default wait
+	}
+	return &MemoryLimiter{
+		limit:   limit,
+		timeout: timeout,
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire reserves n bytes, waiting for releases if they are not available.
+// A reservation above the limit waits until nothing else is held. The
+// returned release function must be called when the memory is freed.
+func (m *MemoryLimiter) Acquire(ctx context.Context, n int64) (func(), error) {
+	n = min(n, m.limit)
+	var timer *time.Timer
+	for {
+		m.mu.Lock()
+		if m.used+n <= m.limit {
+			m.used += n
+			m.mu.Unlock()
+			if timer != nil {
+				timer.Stop()
+			}
+			var once sync.Once
+			return func() { once.Do(func() { m.release(n) }) }, nil
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(m.timeout)
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil, ErrSaturated
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (m *MemoryLimiter) release(n int64) {
+	m.mu.Lock()
+	m.used -= n
+	close(m.changed)
+	m.changed = make(chan struct{})
+	m.mu.Unlock()
+}
+
+// InUse returns the bytes currently reserved
+func (m *MemoryLimiter) InUse() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/requestid"
+)
+
+// ipResultKey is the context key of the per-IP result of a request
+type ipResultKey struct{}
+
+// Middleware enforces per-API-key and per-IP limits
+type Middleware struct {
+	mu        sync.RWMutex
+	perKey    *Limiter // nil when disabled
+	perIP     *Limiter // nil when disabled
+	proxyHops int      // Trusted proxies in front of the service, 0 to ignore X-Forwarded-For
+}
+
+// NewMiddleware creates the rate limiting middleware from config
+func NewMiddleware(config models.RateLimitConfig) *Middleware {
+	m := &Middleware{}
+	m.Update(config)
+	return m
+}
+
+// Update applies new limits. Existing buckets are kept, so callers don't get
+// a fresh allowance when limits change.
+func (m *Middleware) Update(config models.RateLimitConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.proxyHops = 0
+	if config.TrustProxy {
+		m.proxyHops = max(config.ProxyHops, 1)
+	}
+	m.perKey = updateLimiter(m.perKey, config.PerKey)
+	m.perIP = updateLimiter(m.perIP, config.PerIP)
+}
+
+// updateLimiter reconfigures l, creating it when a limit is newly set and
+// dropping it when the limit is removed
+func updateLimiter(l *Limiter, config models.RateLimitBucket) *Limiter {
+	if config.RequestsPerMinute <= 0 {
+		return nil
+	}
+	if l == nil {
+		return NewLimiter(config.RequestsPerMinute, config.Burst)
+	}
+	l.SetRate(config.RequestsPerMinute, config.Burst)
+	return l
+}
+
+// CheckIP takes a token for the client IP of r. It runs before
+// authentication, so floods of requests with no or invalid credentials are
+// limited too. It returns false when no per-IP limit applies.
+func (m *Middleware) CheckIP(r *http.Request) (Result, bool) {
+	m.mu.RLock()
+	perIP, proxyHops := m.perIP, m.proxyHops
+	m.mu.RUnlock()
+
+	if perIP == nil {
+		return Result{}, false
+	}
+	return perIP.Allow(ClientIP(r, proxyHops)), true
+}
+
+// CheckKey takes a token for the authenticated caller of r. It returns false
+// when no per-key limit applies.
+func (m *Middleware) CheckKey(r *http.Request) (Result, bool) {
+	m.mu.RLock()
+	perKey := m.perKey
+	m.mu.RUnlock()
+
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if perKey == nil || !ok {
+		return Result{}, false
+	}
+	return perKey.Allow(identity.Key()), true
+}
+
+// IPHandler wraps next with the per-IP limit. Install it before
+// authentication, and KeyHandler after it.
+func (m *Middleware) IPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, limited := m.CheckIP(r)
+		if limited {
+			if !result.Allowed {
+				reject(w, result)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), ipResultKey{}, result))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// KeyHandler wraps next with the per-key limit and the X-RateLimit-* headers
+// of the most restrictive of it and the per-IP limit of IPHandler
+func (m *Middleware) KeyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var results []Result
+		if result, ok := r.Context().Value(ipResultKey{}).(Result); ok {
+			results = append(results, result)
+		}
+		if result, ok := m.CheckKey(r); ok {
+			results = append(results, result)
+		}
+		if len(results) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := restrictive(results)
+		if !result.Allowed {
+			reject(w, result)
+			return
+		}
+		setHeaders(w, result)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// restrictive returns the most restrictive of results, preferring one that
+// rejected the request
+func restrictive(results []Result) Result {
+	result := results[0]
+	for _, res := range results[1:] {
+		if result.Allowed && (!res.Allowed || res.Remaining < result.Remaining) {
+			result = res
+		}
+	}
+	return result
+}
+
+// setHeaders sets the X-RateLimit-* headers of a result
+func setHeaders(w http.ResponseWriter, result Result) {
+	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", seconds(result.Reset)))
+}
+
+// reject answers 429 for a result that did not allow the request
+func reject(w http.ResponseWriter, result Result) {
+	setHeaders(w, result)
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds(result.RetryAfter)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":     "Rate limit exceeded",
+		"code":      "rate_limited",
+		"requestId": w.Header().Get(requestid.Header),
+	})
+}
+
+// ClientIP returns the client address. Behind proxyHops trusted proxies it is
+// taken from X-Forwarded-For, counting proxyHops entries from the right: each
+// proxy appends the address it received the request from, so entries further
+// left were sent by the client and can be forged.
+func ClientIP(r *http.Request, proxyHops int) string {
+	if proxyHops > 0 {
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					forwarded = append(forwarded, entry)
+				}
+			}
+		}
+		if len(forwarded) > 0 {
+			return forwarded[max(len(forwarded)-proxyHops, 0)]
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
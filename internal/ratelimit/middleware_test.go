@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/auth"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		realIP    string
+		hops      int
+		want      string
+	}{
+		{"no proxy ignores headers", []string{"203.0.113.9"}, "203.0.113.8", 0, "192.0.2.1"},
+		{"single proxy", []string{"198.51.100.7"}, "", 1, "198.51.100.7"},
+		{"forged entries are skipped", []string{"1.1.1.1, 2.2.2.2, 198.51.100.7"}, "", 1, "198.51.100.7"},
+		{"two hops", []string{"1.1.1.1, 198.51.100.7, 10.0.0.2"}, "", 2, "198.51.100.7"},
+		{"more hops than entries", []string{"198.51.100.7"}, "", 3, "198.51.100.7"},
+		{"repeated headers", []string{"1.1.1.1", "198.51.100.7"}, "", 1, "198.51.100.7"},
+		{"blank entries", []string{"198.51.100.7, ,"}, "", 1, "198.51.100.7"},
+		{"real ip fallback", nil, " 198.51.100.8 ", 1, "198.51.100.8"},
+		{"remote addr fallback", nil, "", 1, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = "192.0.2.1:4711"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := ClientIP(r, tt.hops); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRotatingForwardedFor(t *testing.T) {
+	m := NewMiddleware(models.RateLimitConfig{
+		Enabled:    true,
+		PerIP:      models.RateLimitBucket{RequestsPerMinute: 60, Burst: 2},
+		TrustProxy: true,
+	})
+
+	// A client rotating the left-most entry must still share one bucket
+	for i, forged := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Forwarded-For", forged+", 198.51.100.7")
+		result, limited := m.CheckIP(r)
+		if !limited {
+			t.Fatal("per-IP limit not applied")
+		}
+		if want := i < 2; result.Allowed != want {
+			t.Errorf("request %d: allowed = %v, want %v", i, result.Allowed, want)
+		}
+	}
+}
+
+func TestMiddlewarePrefersRejection(t *testing.T) {
+	m := NewMiddleware(models.RateLimitConfig{
+		Enabled: true,
+		PerKey:  models.RateLimitBucket{RequestsPerMinute: 60, Burst: 1},
+		PerIP:   models.RateLimitBucket{RequestsPerMinute: 60, Burst: 10},
+	})
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{Name: "app", Method: "api_key"})
+	handler := m.IPHandler(m.KeyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i, w.Code, want)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+			t.Errorf("request %d: remaining = %q, want the per-key 0", i, got)
+		}
+	}
+}
+
+func TestIPHandlerLimitsUnauthenticated(t *testing.T) {
+	m := NewMiddleware(models.RateLimitConfig{
+		Enabled: true,
+		PerKey:  models.RateLimitBucket{RequestsPerMinute: 60, Burst: 10},
+		PerIP:   models.RateLimitBucket{RequestsPerMinute: 60, Burst: 1},
+	})
+	calls := 0
+	handler := m.IPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++ // Authentication, which rejects the request
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	for i, want := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, want %d", i, w.Code, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("authentication ran %d times, want 1", calls)
+	}
+}
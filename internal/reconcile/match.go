@@ -0,0 +1,199 @@
+package reconcile
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Default matching window: invoices are usually paid after their date, sometimes
+// before it when the card payment is booked late
+const (
+	DefaultDaysAfter  = 45
+	DefaultDaysBefore = 3
+)
+
+// Scoring weights; the amount must always match
+const (
+	amountScore = 0.5
+	dateScore   = 0.25
+	vendorScore = 0.25
+)
+
+// Options tune the matching
+type Options struct {
+	DaysAfter  int // Days a payment may be booked after the invoice date
+	DaysBefore int // Days a payment may be booked before the invoice date
+}
+
+// Match pairs a statement line with a stored invoice
+type Match struct {
+	Line     Line
+	Invoice  *models.StoredInvoice
+	Score    float64 // 0.5 for the amount alone, up to 1 with the same date and vendor
+	DateDiff int     // Days from the invoice date to the booking
+	Vendor   float64 // Share of the vendor name found in the line description, 0 to 1
+}
+
+// Result is the outcome of matching a statement
+type Result struct {
+	Matches           []Match // In statement order
+	UnmatchedLines    []Line
+	UnmatchedInvoices []*models.StoredInvoice
+}
+
+// Window returns the invoice dates that can match lines booked between first
+// and last, as a [from, to) range
+func (o Options) Window(first, last time.Time) (time.Time, time.Time) {
+	return first.AddDate(0, 0, -o.DaysAfter), last.AddDate(0, 0, o.DaysBefore+1)
+}
+
+// Reconcile matches statement lines to invoices. A line matches an invoice
+// of the same absolute amount dated within the window of options; among the
+// candidates, the best score wins, then the closest date. Each line and each
+// invoice is matched at most once.
+func Reconcile(lines []Line, invoices []*models.StoredInvoice, options Options) Result {
+	var candidates []Match
+	for _, line := range lines {
+		if line.Amount.IsZero() {
+			continue
+		}
+		amount := line.Amount.Abs()
+		for _, record := range invoices {
+			invoice := record.Invoice
+			if invoice == nil || !invoice.Total.Abs().Equal(amount) {
+				continue
+			}
+			date := invoice.Date
+			if date.IsZero() {
+				date = record.CreatedAt
+			}
+			diff := int(math.Round(line.Date.Sub(truncateDay(date)).Hours() / 24))
+			if diff > options.DaysAfter || diff < -options.DaysBefore {
+				continue
+			}
+
+			vendor := vendorSimilarity(invoice.Vendor, line.Description)
+			closeness := 1 - float64(abs(diff))/float64(max(options.DaysAfter, options.DaysBefore, 1))
+			candidates = append(candidates, Match{
+				Line:     line,
+				Invoice:  record,
+				Score:    math.Round((amountScore+dateScore*closeness+vendorScore*vendor)*100) / 100,
+				DateDiff: diff,
+				Vendor:   math.Round(vendor*100) / 100,
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return abs(a.DateDiff) < abs(b.DateDiff)
+	})
+
+	var result Result
+	usedLines := make(map[int]bool)
+	usedInvoices := make(map[string]bool)
+	for _, candidate := range candidates {
+		if usedLines[candidate.Line.Row] || usedInvoices[candidate.Invoice.ID] {
+			continue
+		}
+		usedLines[candidate.Line.Row] = true
+		usedInvoices[candidate.Invoice.ID] = true
+		result.Matches = append(result.Matches, candidate)
+	}
+	sort.Slice(result.Matches, func(i, j int) bool { return result.Matches[i].Line.Row < result.Matches[j].Line.Row })
+
+	for _, line := range lines {
+		if !usedLines[line.Row] {
+			result.UnmatchedLines = append(result.UnmatchedLines, line)
+		}
+	}
+	for _, record := range invoices {
+		if !usedInvoices[record.ID] {
+			result.UnmatchedInvoices = append(result.UnmatchedInvoices, record)
+		}
+	}
+	return result
+}
+
+// legalSuffixes are company forms left out of vendor names when matching
+var legalSuffixes = map[string]bool{
+	"sl": true, "sa": true, "slu": true, "sau": true, "sll": true, "scp": true,
+	"gmbh": true, "ag": true, "kg": true, "ug": true, "ltd": true, "llc": true,
+	"inc": true, "corp": true, "co": true, "plc": true, "bv": true, "nv": true,
+	"sas": true, "sarl": true, "srl": true, "spa": true, "lda": true,
+}
+
+// vendorSimilarity returns the share of the words of vendor found in a
+// statement description, 0 to 1. Bank descriptions are often upper case,
+// unaccented and truncated, so a word also counts when the description has a
+// word it starts with, or that starts it, of at least four letters.
+func vendorSimilarity(vendor, description string) float64 {
+	words := vendorWords(vendor)
+	if len(words) == 0 {
+		return 0
+	}
+	described := vendorWords(description)
+	found := 0
+	for _, word := range words {
+		for _, other := range described {
+			if word == other || (min(len(word), len(other)) >= 4 && (strings.HasPrefix(word, other) || strings.HasPrefix(other, word))) {
+				found++
+				break
+			}
+		}
+	}
+	return float64(found) / float64(len(words))
+}
+
+// unaccent folds the accented letters of the languages we see most
+var unaccent = strings.NewReplacer(
+	"á", "a", "à", "a", "ä", "a", "â", "a", "ã", "a",
+	"é", "e", "è", "e", "ë", "e", "ê", "e",
+	"í", "i", "ì", "i", "ï", "i", "î", "i",
+	"ó", "o", "ò", "o", "ö", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ù", "u", "ü", "u", "û", "u",
+	"ñ", "n", "ç", "c", "ß", "ss",
+)
+
+// vendorWords splits a name into lowercase, unaccented words, without legal
+// forms and words shorter than two letters
+func vendorWords(s string) []string {
+	var b strings.Builder
+	for _, r := range unaccent.Replace(strings.ToLower(s)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '.':
+			// "S.L." is "sl"
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	var words []string
+	for _, word := range strings.Fields(b.String()) {
+		if len(word) >= 2 && !legalSuffixes[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// truncateDay drops the time of day
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
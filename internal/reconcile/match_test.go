@@ -0,0 +1,147 @@
+package reconcile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+func storedInvoice(id, vendor, total string, date time.Time) *models.StoredInvoice {
+	return &models.StoredInvoice{
+		ID:      id,
+		Invoice: &models.Invoice{Vendor: vendor, Total: decimal.RequireFromString(total), Date: date},
+	}
+}
+
+func line(row int, date time.Time, amount, description string) Line {
+	return Line{Row: row, Date: date, Amount: decimal.RequireFromString(amount), Description: description}
+}
+
+func TestVendorSimilarity(t *testing.T) {
+	tests := []struct {
+		vendor      string
+		description string
+		want        float64
+	}{
+		{"Café Central S.L.", "CAFE CENTRAL MADRID", 1},
+		{"Mercadona", "COMPRA TARJ MERCADON", 1}, // Truncated by the bank
+		{"Acme Widgets GmbH", "ACME PAYMENT", 0.5},
+		{"Globex", "Initech", 0},
+		{"SL", "anything", 0},
+	}
+	for _, tt := range tests {
+		if got := vendorSimilarity(tt.vendor, tt.description); got != tt.want {
+			t.Errorf("vendorSimilarity(%q, %q) = %v, want %v", tt.vendor, tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	options := Options{DaysAfter: DefaultDaysAfter, DaysBefore: DefaultDaysBefore}
+	march := func(d int) time.Time { return day(2024, 3, d) }
+
+	tests := []struct {
+		name     string
+		lines    []Line
+		invoices []*models.StoredInvoice
+		want     map[int]string // Line row to invoice ID
+	}{
+		{
+			name:     "amount and vendor",
+			lines:    []Line{line(1, march(5), "-24.50", "CAFE CENTRAL")},
+			invoices: []*models.StoredInvoice{storedInvoice("a", "Café Central", "24.50", march(4))},
+			want:     map[int]string{1: "a"},
+		},
+		{
+			name:     "different amount",
+			lines:    []Line{line(1, march(5), "-24.51", "CAFE CENTRAL")},
+			invoices: []*models.StoredInvoice{storedInvoice("a", "Café Central", "24.50", march(4))},
+			want:     map[int]string{},
+		},
+		{
+			name:     "paid too long before the invoice",
+			lines:    []Line{line(1, march(1), "-24.50", "CAFE CENTRAL")},
+			invoices: []*models.StoredInvoice{storedInvoice("a", "Café Central", "24.50", march(10))},
+			want:     map[int]string{},
+		},
+		{
+			name:     "paid too long after the invoice",
+			lines:    []Line{line(1, day(2024, 5, 1), "-24.50", "CAFE CENTRAL")},
+			invoices: []*models.StoredInvoice{storedInvoice("a", "Café Central", "24.50", day(2024, 1, 2))},
+			want:     map[int]string{},
+		},
+		{
+			name:  "vendor breaks an amount tie",
+			lines: []Line{line(1, march(5), "-10.00", "REWE MARKT")},
+			invoices: []*models.StoredInvoice{
+				storedInvoice("other", "Lidl", "10.00", march(5)),
+				storedInvoice("rewe", "REWE", "10.00", march(5)),
+			},
+			want: map[int]string{1: "rewe"},
+		},
+		{
+			name:  "closer date wins",
+			lines: []Line{line(1, march(20), "-10.00", "")},
+			invoices: []*models.StoredInvoice{
+				storedInvoice("old", "Shop", "10.00", march(1)),
+				storedInvoice("recent", "Shop", "10.00", march(18)),
+			},
+			want: map[int]string{1: "recent"},
+		},
+		{
+			name: "each invoice matched once",
+			lines: []Line{
+				line(1, march(5), "-10.00", "SHOP"),
+				line(2, march(6), "-10.00", "SHOP"),
+			},
+			invoices: []*models.StoredInvoice{storedInvoice("a", "Shop", "10.00", march(5))},
+			want:     map[int]string{1: "a"},
+		},
+		{
+			name:     "zero amount skipped",
+			lines:    []Line{line(1, march(5), "0", "SHOP")},
+			invoices: []*models.StoredInvoice{storedInvoice("a", "Shop", "0", march(5))},
+			want:     map[int]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Reconcile(tt.lines, tt.invoices, options)
+
+			got := make(map[int]string)
+			for _, match := range result.Matches {
+				got[match.Line.Row] = match.Invoice.ID
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("matches = %v, want %v", got, tt.want)
+			}
+			for row, id := range tt.want {
+				if got[row] != id {
+					t.Errorf("line %d matched %q, want %q", row, got[row], id)
+				}
+			}
+			if n := len(result.UnmatchedLines) + len(result.Matches); n != len(tt.lines) {
+				t.Errorf("%d lines accounted for, want %d", n, len(tt.lines))
+			}
+			if n := len(result.UnmatchedInvoices) + len(result.Matches); n != len(tt.invoices) {
+				t.Errorf("%d invoices accounted for, want %d", n, len(tt.invoices))
+			}
+		})
+	}
+}
+
+func TestReconcileScore(t *testing.T) {
+	options := Options{DaysAfter: DefaultDaysAfter, DaysBefore: DefaultDaysBefore}
+	invoice := storedInvoice("a", "Café Central", "24.50", day(2024, 3, 5))
+
+	result := Reconcile([]Line{line(1, day(2024, 3, 5), "-24.50", "CAFE CENTRAL")}, []*models.StoredInvoice{invoice}, options)
+	if len(result.Matches) != 1 {
+		t.Fatalf("matches = %+v", result.Matches)
+	}
+	match := result.Matches[0]
+	if match.Score != 1 || match.DateDiff != 0 || match.Vendor != 1 {
+		t.Errorf("match = score %v, date diff %d, vendor %v, want 1, 0, 1", match.Score, match.DateDiff, match.Vendor)
+	}
+}
@@ -0,0 +1,309 @@
+// Package reconcile matches bank statement lines to stored invoices: it reads
+// CSV and CAMT.053 statements and pairs each payment with the invoice of the
+// same amount closest in date and vendor
+package reconcile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Statement formats
+const (
+	FormatCSV  = "csv"
+	FormatCAMT = "camt" // ISO 20022 camt.053 bank-to-customer statement
+)
+
+// Line is one booking of a bank statement
+type Line struct {
+	Row         int // 1-based record of a CSV, the header being 1, or entry of a CAMT statement
+	Date        time.Time
+	Amount      decimal.Decimal // Negative for debits
+	Currency    string
+	Description string // Counterparty and remittance text
+}
+
+// Parse reads the lines of a statement. An empty format is detected from the
+// content: XML is read as CAMT, anything else as CSV.
+func Parse(data []byte, format string) ([]Line, error) {
+	if format == "" {
+		format = FormatCSV
+		if bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff"))), []byte("<")) {
+			format = FormatCAMT
+		}
+	}
+
+	var lines []Line
+	var err error
+	switch format {
+	case FormatCSV:
+		lines, err = parseCSV(data)
+	case FormatCAMT:
+		lines, err = parseCAMT(data)
+	default:
+		return nil, fmt.Errorf("unsupported statement format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("statement has no lines")
+	}
+	return lines, nil
+}
+
+// CSV header names, lowercased, in the languages of the banks we see most
+var (
+	dateColumns        = []string{"date", "booking date", "transaction date", "value date", "fecha", "fecha operación", "fecha operacion", "fecha valor", "buchungstag", "valutadatum", "datum", "data"}
+	amountColumns      = []string{"amount", "importe", "betrag", "monto", "montant", "importo"}
+	debitColumns       = []string{"debit", "withdrawal", "cargo", "cargos", "soll", "débit", "debito"}
+	creditColumns      = []string{"credit", "deposit", "abono", "abonos", "haben", "crédit", "credito"}
+	currencyColumns    = []string{"currency", "moneda", "divisa", "währung", "waehrung", "devise"}
+	descriptionColumns = []string{"description", "details", "memo", "payee", "name", "counterparty", "concepto", "descripción", "descripcion", "beneficiario", "verwendungszweck", "empfänger", "auftraggeber/empfänger", "libellé", "libelle"}
+)
+
+// dateLayouts are the date formats of CSV statements, day first when ambiguous
+var dateLayouts = []string{"2006-01-02", "02/01/2006", "02.01.2006", "02-01-2006", "2/1/2006", "02/01/06", "02.01.06", "20060102"}
+
+// parseCSV reads a CSV statement with a header row. The delimiter (comma,
+// semicolon or tab) and the columns are detected from the header.
+func parseCSV(data []byte) ([]Line, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	delimiter := ','
+	for _, d := range []rune{';', '\t'} {
+		if bytes.Count(header, []byte(string(d))) > bytes.Count(header, []byte(string(delimiter))) {
+			delimiter = d
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, errors.New("CSV needs a header row and at least one line")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	find := func(names []string) int {
+		for _, name := range names {
+			if i, ok := columns[name]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	date, amount, debit, credit := find(dateColumns), find(amountColumns), find(debitColumns), find(creditColumns)
+	currency, description := find(currencyColumns), find(descriptionColumns)
+	if date < 0 {
+		return nil, errors.New("CSV has no date column")
+	}
+	if amount < 0 && debit < 0 && credit < 0 {
+		return nil, errors.New("CSV has no amount, debit or credit column")
+	}
+
+	cell := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var lines []Line
+	for n, record := range records[1:] {
+		row := n + 2
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		line := Line{Row: row, Currency: strings.ToUpper(cell(record, currency)), Description: cell(record, description)}
+		if line.Date, err = parseDate(cell(record, date)); err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		if amount >= 0 {
+			line.Amount, err = parseAmount(cell(record, amount))
+		} else {
+			// Separate debit and credit columns, one of them empty
+			var d, c decimal.Decimal
+			if d, err = parseAmount(cell(record, debit)); err == nil {
+				c, err = parseAmount(cell(record, credit))
+			}
+			line.Amount = c.Abs().Sub(d.Abs())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// parseDate reads a statement date
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseAmount reads an amount written with either decimal separator, e.g.
+// "-1.234,56", "1,234.56" or "12,5 €". Empty is zero.
+func parseAmount(s string) (decimal.Decimal, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',', r == '-':
+			return r
+		case r == '−': // Unicode minus
+			return '-'
+		}
+		return -1
+	}, s)
+	if strings.HasSuffix(cleaned, "-") {
+		cleaned = "-" + strings.TrimSuffix(cleaned, "-")
+	}
+	if cleaned == "" || cleaned == "-" {
+		if strings.TrimSpace(s) == "" {
+			return decimal.Zero, nil
+		}
+		return decimal.Zero, fmt.Errorf("invalid amount %q", s)
+	}
+
+	// The last separator is the decimal one, unless a lone separator is
+	// followed by three digits ("1.234" or "1,234")
+	last := strings.LastIndexAny(cleaned, ".,")
+	if last >= 0 {
+		lone := strings.Count(cleaned, ".")+strings.Count(cleaned, ",") == 1
+		if lone && len(cleaned)-last-1 == 3 {
+			last = -1
+		}
+	}
+	var integer, fraction string
+	if last < 0 {
+		integer = cleaned
+	} else {
+		integer, fraction = cleaned[:last], cleaned[last+1:]
+	}
+	integer = strings.NewReplacer(".", "", ",", "").Replace(integer)
+	if fraction != "" {
+		integer += "." + fraction
+	}
+	amount, err := decimal.NewFromString(integer)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+// camtDocument is the part of a camt.053 document read by parseCAMT. Element
+// names match regardless of namespace, so every camt.053 version is read.
+type camtDocument struct {
+	Statements []struct {
+		Entries []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtEntry struct {
+	Amount struct {
+		Value    string `xml:",chardata"`
+		Currency string `xml:"Ccy,attr"`
+	} `xml:"Amt"`
+	Indicator   string   `xml:"CdtDbtInd"` // CRDT or DBIT
+	BookingDate camtDate `xml:"BookgDt"`
+	ValueDate   camtDate `xml:"ValDt"`
+	Info        string   `xml:"AddtlNtryInf"`
+	Details     []struct {
+		Creditor     string   `xml:"RltdPties>Cdtr>Nm"`
+		CreditorPty  string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+		Debtor       string   `xml:"RltdPties>Dbtr>Nm"`
+		DebtorPty    string   `xml:"RltdPties>Dbtr>Pty>Nm"`
+		Unstructured []string `xml:"RmtInf>Ustrd"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d camtDate) time() (time.Time, bool) {
+	if d.Date != "" {
+		t, err := time.Parse(time.DateOnly, d.Date)
+		return t, err == nil
+	}
+	if len(d.DateTime) >= len(time.DateOnly) {
+		t, err := time.Parse(time.DateOnly, d.DateTime[:len(time.DateOnly)])
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// parseCAMT reads the entries of a camt.053 statement
+func parseCAMT(data []byte) ([]Line, error) {
+	var document camtDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid CAMT statement: %w", err)
+	}
+
+	var lines []Line
+	for _, statement := range document.Statements {
+		for _, entry := range statement.Entries {
+			row := len(lines) + 1
+			amount, err := decimal.NewFromString(strings.TrimSpace(entry.Amount.Value))
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: invalid amount %q", row, entry.Amount.Value)
+			}
+			if entry.Indicator == "DBIT" {
+				amount = amount.Neg()
+			}
+			date, ok := entry.BookingDate.time()
+			if !ok {
+				if date, ok = entry.ValueDate.time(); !ok {
+					return nil, fmt.Errorf("entry %d: missing booking date", row)
+				}
+			}
+
+			var parts []string
+			for _, details := range entry.Details {
+				// The counterparty is the creditor of a debit and the debtor of a credit
+				if entry.Indicator == "DBIT" {
+					parts = append(parts, details.Creditor, details.CreditorPty)
+				} else {
+					parts = append(parts, details.Debtor, details.DebtorPty)
+				}
+				parts = append(parts, details.Unstructured...)
+			}
+			parts = append(parts, entry.Info)
+			var description []string
+			for _, part := range parts {
+				if part = strings.Join(strings.Fields(part), " "); part != "" {
+					description = append(description, part)
+				}
+			}
+
+			lines = append(lines, Line{
+				Row:         row,
+				Date:        date,
+				Amount:      amount,
+				Currency:    entry.Amount.Currency,
+				Description: strings.Join(description, " / "),
+			})
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,168 @@
+package reconcile
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"12.50", "12.5", false},
+		{"-1.234,56", "-1234.56", false},
+		{"1,234.56", "1234.56", false},
+		{"1.234", "1234", false},
+		{"1,234", "1234", false},
+		{"12,5 €", "12.5", false},
+		{"100.00-", "-100", false},
+		{"−42,10", "-42.1", false},
+		{"", "0", false},
+		{"n/a", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAmount(%q) error = %v", tt.in, err)
+			continue
+		}
+		if !tt.wantErr && !got.Equal(decimal.RequireFromString(tt.want)) {
+			t.Errorf("parseAmount(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		lines []Line
+	}{
+		{
+			name: "amount column",
+			data: "Date,Amount,Currency,Description\n2024-03-05,-24.50,eur,CAFE CENTRAL\n2024-03-06,100.00,EUR,Refund\n",
+			lines: []Line{
+				{Row: 2, Date: day(2024, 3, 5), Amount: decimal.RequireFromString("-24.5"), Currency: "EUR", Description: "CAFE CENTRAL"},
+				{Row: 3, Date: day(2024, 3, 6), Amount: decimal.RequireFromString("100"), Currency: "EUR", Description: "Refund"},
+			},
+		},
+		{
+			name: "spanish semicolons with debit and credit",
+			data: "\ufeffFecha;Concepto;Cargo;Abono\n05/03/2024;MERCADONA SA;24,50;\n\n07/03/2024;Transferencia;;1.200,00\n",
+			lines: []Line{
+				{Row: 2, Date: day(2024, 3, 5), Amount: decimal.RequireFromString("-24.5"), Description: "MERCADONA SA"},
+				{Row: 3, Date: day(2024, 3, 7), Amount: decimal.RequireFromString("1200"), Description: "Transferencia"}, // Records, blank lines skipped,
+			},
+		},
+		{
+			name: "german tabs",
+			data: "Buchungstag\tVerwendungszweck\tBetrag\n05.03.2024\tREWE\t-12,30\n",
+			lines: []Line{
+				{Row: 2, Date: day(2024, 3, 5), Amount: decimal.RequireFromString("-12.3"), Description: "REWE"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := Parse([]byte(tt.data), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertLines(t, lines, tt.lines)
+		})
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"header only", "Date,Amount\n", "at least one line"},
+		{"no date", "Amount,Description\n1,a\n", "no date column"},
+		{"no amount", "Date,Description\n2024-03-05,a\n", "no amount"},
+		{"bad date", "Date,Amount\nyesterday,1\n", "row 2: invalid date"},
+		{"bad amount", "Date,Amount\n2024-03-05,abc\n", "row 2: invalid amount"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), FormatCSV)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+const camtStatement = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Ntry>
+        <Amt Ccy="EUR">24.50</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <BookgDt><Dt>2024-03-05</Dt></BookgDt>
+        <NtryDtls><TxDtls>
+          <RltdPties><Cdtr><Nm>Cafe   Central SL</Nm></Cdtr><Dbtr><Nm>Acme</Nm></Dbtr></RltdPties>
+          <RmtInf><Ustrd>Invoice F-123</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">1200.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <ValDt><DtTm>2024-03-07T10:00:00</DtTm></ValDt>
+        <NtryDtls><TxDtls>
+          <RltdPties><Dbtr><Nm>Globex</Nm></Dbtr></RltdPties>
+        </TxDtls></NtryDtls>
+        <AddtlNtryInf>Transfer</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`
+
+func TestParseCAMT(t *testing.T) {
+	lines, err := Parse([]byte(camtStatement), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertLines(t, lines, []Line{
+		{Row: 1, Date: day(2024, 3, 5), Amount: decimal.RequireFromString("-24.5"), Currency: "EUR", Description: "Cafe Central SL / Invoice F-123"},
+		{Row: 2, Date: day(2024, 3, 7), Amount: decimal.RequireFromString("1200"), Currency: "EUR", Description: "Globex / Transfer"},
+	})
+}
+
+func TestParseCAMTMissingDate(t *testing.T) {
+	data := `<Document><BkToCstmrStmt><Stmt><Ntry><Amt Ccy="EUR">1</Amt></Ntry></Stmt></BkToCstmrStmt></Document>`
+	if _, err := Parse([]byte(data), FormatCAMT); err == nil || !strings.Contains(err.Error(), "missing booking date") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestParseUnknownFormat(t *testing.T) {
+	if _, err := Parse([]byte("x"), "ofx"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func assertLines(t *testing.T, got, want []Line) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Row != w.Row || !g.Date.Equal(w.Date) || !g.Amount.Equal(w.Amount) || g.Currency != w.Currency || g.Description != w.Description {
+			t.Errorf("line %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package redact
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const mask = "[REDACTED]"
+
+var (
+	// Card numbers: 13-19 digits, optionally grouped with spaces or dashes
+	cardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+	// IBAN: country code, check digits and 11-30 alphanumerics, optionally grouped in fours
+	ibanPattern = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?:[ ]?[A-Z0-9]){11,30}\b`)
+
+	// Personal names following common receipt labels (English and Spanish).
+	// Only spaces and tabs separate label and name: a label ending its line
+	// must not mask the next line.
+	namePattern = regexp.MustCompile(`(?im)^([ \t]*(?:name|customer|client|cliente|nombre|cardholder|card holder|titular|cashier|cajero|cajera|served by|atendido por|le atendi[oó])(?:[ \t]*[:#-][ \t]*|[ \t]+))(\p{L}[\p{L}'.-]*(?:[ \t]+\p{L}[\p{L}'.-]*){0,3})`)
+)
+
+// Text masks credit card numbers, IBANs and personal names in OCR text
+func Text(text string) string {
+	text = cardPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if !luhnValid(digitsOnly(match)) {
+			return match
+		}
+		return mask
+	})
+
+	text = ibanPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if !ibanValid(match) {
+			return match
+		}
+		return mask
+	})
+
+	text = namePattern.ReplaceAllString(text, "${1}"+mask)
+
+	return text
+}
+
+// Number masks all but the last four letters and digits of a card or account
+// number, e.g. "****1234". Numbers of four or fewer are masked entirely,
+// unless they were printed masked already, like "****1234".
+func Number(number string) string {
+	var kept []rune
+	for _, r := range number {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+	if len(kept) <= 4 && !strings.Contains(number, "*") {
+		return "****"
+	}
+	if len(kept) < 4 {
+		return "****" + string(kept)
+	}
+	return "****" + string(kept[len(kept)-4:])
+}
+
+// digitsOnly strips separators from a number
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// luhnValid reports whether a digit string passes the Luhn checksum used by card numbers
+func luhnValid(digits string) bool {
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// ibanValid reports whether a string passes the ISO 13616 mod-97 check
+func ibanValid(s string) bool {
+	iban := strings.ReplaceAll(s, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	// Move country code and check digits to the end, then convert letters to numbers
+	rearranged := iban[4:] + iban[:4]
+	var numeric strings.Builder
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			numeric.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			numeric.WriteString(big.NewInt(int64(r-'A') + 10).String())
+		default:
+			return false
+		}
+	}
+
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return false
+	}
+
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,90 @@
+package redact
+
+import "testing"
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"card", "VISA 4111111111111111 APPROVED", "VISA [REDACTED] APPROVED"},
+		{"grouped card", "Card: 4111 1111 1111 1111", "Card: [REDACTED]"},
+		{"dashed card", "5500-0000-0000-0004", "[REDACTED]"},
+		{"failed luhn", "Ref 4111111111111112", "Ref 4111111111111112"},
+		{"short number", "Order 123456789012", "Order 123456789012"},
+		{"iban", "IBAN: ES9121000418450200051332", "IBAN: [REDACTED]"},
+		{"grouped iban", "GB82 WEST 1234 5698 7654 32", "[REDACTED]"},
+		{"bad iban checksum", "ES0021000418450200051332", "ES0021000418450200051332"},
+		{"name label", "Customer: Ana García", "Customer: [REDACTED]"},
+		{"spanish label", "Le atendió María José", "Le atendió [REDACTED]"},
+		{"label mid-line", "Total 12,00 cliente", "Total 12,00 cliente"},
+		{"label ends line", "Cliente:\nTOTAL 12,00", "Cliente:\nTOTAL 12,00"},
+		{"label without colon ends line", "Cashier\nIVA 21%", "Cashier\nIVA 21%"},
+		{"label after blank line", "TOTAL 12,00\n\nCustomer: Ana García", "TOTAL 12,00\n\nCustomer: [REDACTED]"},
+		{"tab separated", "Nombre\tAna García\nTOTAL 12,00", "Nombre\t[REDACTED]\nTOTAL 12,00"},
+		{"no pii", "TOTAL 24.50 EUR", "TOTAL 24.50 EUR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"6280 1234 5678 9012", "****9012"},
+		{"00-77-1234", "****1234"},
+		{"XXXXXXXX1234", "****1234"},
+		{"****9012", "****9012"},
+		{"1234", "****"},
+		{" - ", ""},
+	}
+	for _, tt := range tests {
+		if got := Number(tt.in); got != tt.want {
+			t.Errorf("Number(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"123456789012", false}, // Too short
+		{"41111111111111111111", false},
+	}
+	for _, tt := range tests {
+		if got := luhnValid(tt.digits); got != tt.want {
+			t.Errorf("luhnValid(%s) = %v, want %v", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestIBANValid(t *testing.T) {
+	tests := []struct {
+		iban string
+		want bool
+	}{
+		{"DE89370400440532013000", true},
+		{"DE89 3704 0044 0532 0130 00", true},
+		{"DE88370400440532013000", false},
+		{"DE8937040044", false}, // Too short
+		{"DE89-3704-0044-0532-0130-00", false},
+	}
+	for _, tt := range tests {
+		if got := ibanValid(tt.iban); got != tt.want {
+			t.Errorf("ibanValid(%s) = %v, want %v", tt.iban, got, tt.want)
+		}
+	}
+}
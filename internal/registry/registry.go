@@ -0,0 +1,149 @@
+// Package registry looks vendors up by tax ID in a company registry API, to
+// complete extracted invoices with the vendor's legal name and address
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// maxCached bounds the cache; expired answers are dropped beyond it
+const maxCached = 10000
+
+// Client looks tax IDs up in a company registry, caching the answers
+type Client struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*models.VendorInfo
+}
+
+// NewClient creates a client
+func NewClient() *Client {
+	return &Client{
+		client: &http.Client{},
+		cache:  make(map[string]*models.VendorInfo),
+	}
+}
+
+// Lookup returns the registry entry of a normalized VAT number, e.g.
+// "ESB12345678". A 404 answer is an entry with Found false. Answers are
+// cached for config.CacheTTL; failures are not, and are returned as an error.
+func (c *Client) Lookup(ctx context.Context, vatNumber string, config models.RegistryConfig) (*models.VendorInfo, error) {
+	key := config.URL + "|" + vatNumber
+	c.mu.Lock()
+	cached, ok := c.cache[key]
+	if ok && time.Since(cached.CheckedAt) > config.CacheTTL {
+		delete(c.cache, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		info := *cached
+		return &info, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	country, number := vatNumber[:min(2, len(vatNumber))], vatNumber[min(2, len(vatNumber)):]
+	endpoint := strings.NewReplacer(
+		"{vatNumber}", url.PathEscape(vatNumber),
+		"{country}", url.PathEscape(country),
+		"{number}", url.PathEscape(number),
+	).Replace(config.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if config.APIKey != "" {
+		req.Header.Set(config.APIKeyHeader, config.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry response: %w", err)
+	}
+
+	info := &models.VendorInfo{CheckedAt: time.Now().UTC()}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// Unknown tax ID
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("registry returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	default:
+		var document interface{}
+		if err := json.Unmarshal(body, &document); err != nil {
+			return nil, fmt.Errorf("failed to parse registry response: %w", err)
+		}
+		fields := config.Fields
+		info.LegalName = field(document, fields.LegalName)
+		info.Address = field(document, fields.Address)
+		info.City = field(document, fields.City)
+		info.PostalCode = field(document, fields.PostalCode)
+		info.Country = field(document, fields.Country)
+		info.Found = info.LegalName != ""
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxCached {
+		for cachedKey, cached := range c.cache {
+			if time.Since(cached.CheckedAt) > config.CacheTTL {
+				delete(c.cache, cachedKey)
+			}
+		}
+	}
+	c.cache[key] = info
+	c.mu.Unlock()
+
+	result := *info
+	return &result, nil
+}
+
+// field reads a dot-separated path of a JSON document, e.g. "results.0.name".
+// Strings and numbers are returned as text; anything else, or a missing
+// field, as "".
+func field(document interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	value := document
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return ""
+			}
+			value = v[i]
+		default:
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Join(strings.Fields(v), " ")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
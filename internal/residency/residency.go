@@ -0,0 +1,146 @@
+// Package residency enforces a data-residency policy: the AI providers, and
+// the endpoint hosts of each, that documents and their text may be sent to
+package residency
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// ErrNotAllowed is wrapped by the errors of providers the policy forbids
+var ErrNotAllowed = errors.New("provider not allowed by the data residency policy")
+
+// providers are the provider names a policy can list
+var providers = []string{"openai", "gemini", "ollama", "external"}
+
+// Policy is a compiled residency policy
+type Policy struct {
+	name  string
+	hosts map[string][]string // Allowed hosts by allowed provider, nil allows any
+}
+
+// Compile checks config and returns its policy. It returns nil when no
+// providers are listed, which allows every provider.
+func Compile(config models.ResidencyConfig) (*Policy, error) {
+	if len(config.Providers) == 0 {
+		return nil, nil
+	}
+
+	p := &Policy{name: config.Policy, hosts: make(map[string][]string)}
+	for i, provider := range config.Providers {
+		if !known(provider.Name) {
+			return nil, fmt.Errorf("providers[%d].name: must be one of %s, got %q", i, strings.Join(providers, ", "), provider.Name)
+		}
+		if _, dup := p.hosts[provider.Name]; dup {
+			return nil, fmt.Errorf("providers[%d].name: duplicate provider %q", i, provider.Name)
+		}
+		for j, host := range provider.Hosts {
+			pattern := strings.TrimPrefix(host, "*.")
+			if pattern == "" || strings.ContainsAny(pattern, "*/:") {
+				return nil, fmt.Errorf("providers[%d].hosts[%d]: must be a host name, optionally starting with \"*.\", got %q", i, j, host)
+			}
+		}
+		p.hosts[provider.Name] = provider.Hosts
+	}
+	return p, nil
+}
+
+// ForConfig compiles the policy of config. In offline mode only Ollama is
+// allowed, whatever residency lists, and the offline guard decides its hosts.
+func ForConfig(config *models.Config) (*Policy, error) {
+	if config.Offline.Enabled {
+		return &Policy{name: "offline", hosts: map[string][]string{"ollama": nil}}, nil
+	}
+	return Compile(config.Residency)
+}
+
+func known(name string) bool {
+	for _, provider := range providers {
+		if name == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of the policy, empty for a nil policy
+func (p *Policy) Name() string {
+	if p == nil {
+		return ""
+	}
+	return p.name
+}
+
+// Check returns an error wrapping ErrNotAllowed when documents may not be
+// sent to provider as configured in config. A nil policy allows everything.
+func (p *Policy) Check(config models.AIConfig, provider string) error {
+	if p == nil {
+		return nil
+	}
+	hosts, ok := p.hosts[provider]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotAllowed, provider)
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	host := Host(config, provider)
+	if host == "" {
+		return nil // A local command
+	}
+	for _, pattern := range hosts {
+		if matches(pattern, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s at %s", ErrNotAllowed, provider, host)
+}
+
+// Allows reports whether documents may be sent to provider, see Check
+func (p *Policy) Allows(config models.AIConfig, provider string) bool {
+	return p.Check(config, provider) == nil
+}
+
+// Host returns the host documents are sent to by a provider, empty for an
+// external extractor run as a command
+func Host(config models.AIConfig, provider string) string {
+	var endpoint string
+	switch provider {
+	case "openai":
+		endpoint = config.OpenAI.BaseURL
+		if endpoint == "" {
+			return "api.openai.com"
+		}
+	case "gemini":
+		return "generativelanguage.googleapis.com"
+	case "ollama":
+		endpoint = config.Ollama.BaseURL
+		if endpoint == "" {
+			return "localhost"
+		}
+	case "external":
+		if len(config.External.Command) > 0 {
+			return ""
+		}
+		endpoint = config.External.URL
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return endpoint // Matches no pattern unless listed verbatim
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// matches reports whether host is pattern, or one of its subdomains when
+// pattern starts with "*."
+func matches(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
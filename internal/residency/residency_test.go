@@ -0,0 +1,106 @@
+package residency
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func TestCheck(t *testing.T) {
+	policy, err := Compile(models.ResidencyConfig{
+		Policy: "eu-only",
+		Providers: []models.ResidencyProviderConfig{
+			{Name: "ollama"},
+			{Name: "openai", Hosts: []string{"*.openai.azure.com", "api.mistral.ai"}},
+			{Name: "external", Hosts: []string{"extractor.internal"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(edit func(*models.AIConfig)) models.AIConfig {
+		var config models.AIConfig
+		edit(&config)
+		return config
+	}
+	none := func(*models.AIConfig) {}
+
+	tests := []struct {
+		name     string
+		config   models.AIConfig
+		provider string
+		allowed  bool
+	}{
+		{"listed without hosts", with(none), "ollama", true},
+		{"remote ollama", with(func(c *models.AIConfig) { c.Ollama.BaseURL = "http://gpu.example.com:11434" }), "ollama", true},
+		{"not listed", with(none), "gemini", false},
+		{"default openai host", with(none), "openai", false},
+		{"azure subdomain", with(func(c *models.AIConfig) { c.OpenAI.BaseURL = "https://acme-eu.openai.azure.com/openai" }), "openai", true},
+		{"azure apex", with(func(c *models.AIConfig) { c.OpenAI.BaseURL = "https://openai.azure.com" }), "openai", false},
+		{"exact host", with(func(c *models.AIConfig) { c.OpenAI.BaseURL = "https://API.mistral.ai/v1" }), "openai", true},
+		{"suffix is not a subdomain", with(func(c *models.AIConfig) { c.OpenAI.BaseURL = "https://evilopenai.azure.com" }), "openai", false},
+		{"external url", with(func(c *models.AIConfig) { c.External.URL = "http://extractor.internal:8080/extract" }), "external", true},
+		{"external other url", with(func(c *models.AIConfig) { c.External.URL = "https://extractor.example.com" }), "external", false},
+		{"external command", with(func(c *models.AIConfig) { c.External.Command = []string{"./extract"} }), "external", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.config, tt.provider)
+			if tt.allowed && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrNotAllowed) {
+				t.Fatalf("err = %v, want ErrNotAllowed", err)
+			}
+		})
+	}
+}
+
+func TestNilPolicyAllowsEverything(t *testing.T) {
+	policy, err := Compile(models.ResidencyConfig{Policy: "unused"})
+	if err != nil || policy != nil {
+		t.Fatalf("Compile = %v, %v, want nil, nil", policy, err)
+	}
+	if err := policy.Check(models.AIConfig{}, "gemini"); err != nil {
+		t.Errorf("nil policy: %v", err)
+	}
+	if policy.Name() != "" {
+		t.Errorf("nil policy name = %q", policy.Name())
+	}
+}
+
+func TestOfflineAllowsOnlyOllama(t *testing.T) {
+	config := &models.Config{
+		Residency: models.ResidencyConfig{Providers: []models.ResidencyProviderConfig{{Name: "openai"}}},
+		Offline:   models.OfflineConfig{Enabled: true},
+	}
+	policy, err := ForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Name() != "offline" {
+		t.Errorf("name = %q, want offline", policy.Name())
+	}
+	for provider, allowed := range map[string]bool{"ollama": true, "openai": false, "external": false} {
+		if got := policy.Allows(config.AI, provider); got != allowed {
+			t.Errorf("Allows(%s) = %v, want %v", provider, got, allowed)
+		}
+	}
+}
+
+func TestCompileRejectsInvalidPolicies(t *testing.T) {
+	tests := map[string][]models.ResidencyProviderConfig{
+		"unknown provider":   {{Name: "mistral"}},
+		"duplicate provider": {{Name: "ollama"}, {Name: "ollama"}},
+		"url as host":        {{Name: "openai", Hosts: []string{"https://api.mistral.ai"}}},
+		"inner wildcard":     {{Name: "openai", Hosts: []string{"api.*.com"}}},
+		"bare wildcard":      {{Name: "openai", Hosts: []string{"*."}}},
+	}
+	for name, providers := range tests {
+		if _, err := Compile(models.ResidencyConfig{Providers: providers}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
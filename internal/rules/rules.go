@@ -0,0 +1,284 @@
+// Package rules extracts invoice fields deterministically for known vendors:
+// a vendor is recognized by a regular expression on the OCR text, and each
+// field is read by a pattern, optionally restricted to a range of lines
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// Rule modes
+const (
+	CrossCheck = "crosscheck" // Run the AI and compare its fields with the rule's
+	Bypass     = "bypass"     // Use the rule's fields without calling the AI
+)
+
+// defaultMismatchConfidence caps the confidence of an extraction that disagrees with a rule
+const defaultMismatchConfidence = 0.5
+
+// Set is a compiled list of vendor rules, tried in order
+type Set struct {
+	vendors            []*vendor
+	mismatchConfidence float64
+}
+
+// vendor is a compiled VendorRule
+type vendor struct {
+	models.VendorRule
+	match            *regexp.Regexp
+	total, tax, date *field
+}
+
+// field is a compiled FieldRule
+type field struct {
+	models.FieldRule
+	pattern *regexp.Regexp
+}
+
+// Result holds the fields a rule found in a document
+type Result struct {
+	Rule    string
+	Mode    string
+	Invoice *models.Invoice // Vendor, categories and the fields found
+	Missing []string        // Fields the rule defines but did not find
+
+	found []string
+}
+
+// Complete reports whether the rule found every field it defines
+func (r *Result) Complete() bool {
+	return len(r.Missing) == 0
+}
+
+// Compile checks and compiles the rules of config. It returns nil when there are none.
+func Compile(config models.RulesConfig) (*Set, error) {
+	if len(config.Vendors) == 0 {
+		return nil, nil
+	}
+	set := &Set{mismatchConfidence: config.MismatchConfidence}
+	if set.mismatchConfidence <= 0 {
+		set.mismatchConfidence = defaultMismatchConfidence
+	}
+
+	for i, rule := range config.Vendors {
+		name := rule.Name
+		if name == "" {
+			return nil, fmt.Errorf("vendors[%d].name: required", i)
+		}
+		if rule.Mode == "" {
+			rule.Mode = CrossCheck
+		}
+		if rule.Mode != CrossCheck && rule.Mode != Bypass {
+			return nil, fmt.Errorf("vendor rule %s: mode must be crosscheck or bypass, got %q", name, rule.Mode)
+		}
+		if rule.Vendor == "" {
+			rule.Vendor = name
+		}
+		if rule.Total == nil && rule.Tax == nil && rule.Date == nil {
+			return nil, fmt.Errorf("vendor rule %s: defines no fields", name)
+		}
+
+		match, err := regexp.Compile(rule.Match)
+		if err != nil || rule.Match == "" {
+			return nil, fmt.Errorf("vendor rule %s: invalid match pattern: %v", name, err)
+		}
+		v := &vendor{VendorRule: rule, match: match}
+		for _, f := range []struct {
+			name string
+			rule *models.FieldRule
+			dest **field
+		}{{"total", rule.Total, &v.total}, {"tax", rule.Tax, &v.tax}, {"date", rule.Date, &v.date}} {
+			if f.rule == nil {
+				continue
+			}
+			compiled, err := compileField(*f.rule)
+			if err != nil {
+				return nil, fmt.Errorf("vendor rule %s: %s: %w", name, f.name, err)
+			}
+			*f.dest = compiled
+		}
+		set.vendors = append(set.vendors, v)
+	}
+	return set, nil
+}
+
+// compileField checks and compiles a field rule
+func compileField(rule models.FieldRule) (*field, error) {
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil || rule.Pattern == "" {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	if rule.Decimal != "" && rule.Decimal != "." && rule.Decimal != "," {
+		return nil, fmt.Errorf("decimal must be \".\" or \",\", got %q", rule.Decimal)
+	}
+	if rule.Layout == "" {
+		rule.Layout = time.DateOnly
+	}
+	return &field{FieldRule: rule, pattern: pattern}, nil
+}
+
+// Apply runs the first rule whose vendor matches text. It returns nil when
+// no rule matches; a nil Set matches nothing.
+func (s *Set) Apply(text string) *Result {
+	if s == nil {
+		return nil
+	}
+	for _, v := range s.vendors {
+		if v.match.MatchString(text) {
+			return v.apply(text)
+		}
+	}
+	return nil
+}
+
+// apply extracts the fields of v from text
+func (v *vendor) apply(text string) *Result {
+	result := &Result{
+		Rule: v.Name,
+		Mode: v.Mode,
+		Invoice: &models.Invoice{
+			Vendor:      v.Vendor,
+			Categories:  v.Categories,
+			RawText:     text,
+			Confidence:  1,
+			ProcessedAt: time.Now(),
+		},
+	}
+	lines := strings.Split(text, "\n")
+
+	if v.total != nil {
+		amount, ok := v.total.amount(lines)
+		if ok {
+			result.Invoice.Total = amount
+			result.found = append(result.found, "total")
+		} else {
+			result.Missing = append(result.Missing, "total")
+		}
+	}
+	if v.tax != nil {
+		amount, ok := v.tax.amount(lines)
+		if ok {
+			result.Invoice.Tax = amount
+			result.found = append(result.found, "tax")
+		} else {
+			result.Missing = append(result.Missing, "tax")
+		}
+	}
+	if v.date != nil {
+		date, ok := v.date.date(lines)
+		if ok {
+			result.Invoice.Date = date
+			result.found = append(result.found, "date")
+		} else {
+			result.Missing = append(result.Missing, "date")
+		}
+	}
+	return result
+}
+
+// find returns the value of f in its zone of lines
+func (f *field) find(lines []string) (string, bool) {
+	from, to := f.FromLine, f.ToLine
+	if from < 0 {
+		from = len(lines) + from + 1
+	}
+	if from < 1 {
+		from = 1
+	}
+	if to < 0 {
+		to = len(lines) + to + 1
+	}
+	if to == 0 || to > len(lines) {
+		to = len(lines)
+	}
+	if from > to {
+		return "", false
+	}
+	zone := strings.Join(lines[from-1:to], "\n")
+
+	matches := f.pattern.FindAllStringSubmatch(zone, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	match := matches[0]
+	if f.Last {
+		match = matches[len(matches)-1]
+	}
+	if len(match) > 1 {
+		return strings.TrimSpace(match[1]), true
+	}
+	return strings.TrimSpace(match[0]), true
+}
+
+// amount parses the value of f as an amount, dropping currency symbols and
+// thousands separators
+func (f *field) amount(lines []string) (decimal.Decimal, bool) {
+	value, ok := f.find(lines)
+	if !ok {
+		return decimal.Decimal{}, false
+	}
+	separator := "."
+	if f.Decimal == "," {
+		separator = ","
+	}
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '-':
+			return r
+		case string(r) == separator:
+			return '.'
+		default:
+			// Currency symbols, spaces and thousands separators
+			return -1
+		}
+	}, value)
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.Decimal{}, false
+	}
+	return amount, true
+}
+
+// date parses the value of f with its layout
+func (f *field) date(lines []string) (time.Time, bool) {
+	value, ok := f.find(lines)
+	if !ok {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(f.Layout, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// CrossCheck compares an AI extraction with the fields a rule found and
+// returns those that differ. On a difference the invoice's confidence is
+// capped, so it is flagged for review; its values are kept.
+func (s *Set) CrossCheck(result *Result, invoice *models.Invoice) []string {
+	var mismatched []string
+	for _, name := range result.found {
+		var equal bool
+		switch name {
+		case "total":
+			equal = invoice.Total.Equal(result.Invoice.Total)
+		case "tax":
+			equal = invoice.Tax.Equal(result.Invoice.Tax)
+		case "date":
+			equal = invoice.Date.Format(time.DateOnly) == result.Invoice.Date.Format(time.DateOnly)
+		}
+		if !equal {
+			mismatched = append(mismatched, name)
+		}
+	}
+	if len(mismatched) > 0 && invoice.Confidence > s.mismatchConfidence {
+		invoice.Confidence = s.mismatchConfidence
+	}
+	return mismatched
+}
@@ -0,0 +1,244 @@
+// Package scripts applies validation and normalization rules written in the
+// expr language (https://expr-lang.org) to extracted invoices, e.g.
+// "if the vendor contains AMZN, set the category to Office"
+package scripts
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/pkg/pipeline"
+	"github.com/shopspring/decimal"
+)
+
+// env holds the values expressions can read
+type env struct {
+	Vendor     string   `expr:"vendor"`
+	Date       string   `expr:"date"` // YYYY-MM-DD, empty when unknown
+	Total      float64  `expr:"total"`
+	Tax        float64  `expr:"tax"`
+	Categories []string `expr:"categories"`
+	Items      []item   `expr:"items"`
+	Confidence float64  `expr:"confidence"`
+	Text       string   `expr:"text"` // OCR text
+	Provider   string   `expr:"provider"`
+	Model      string   `expr:"model"`
+	Rule       string   `expr:"rule"` // Vendor rule that matched, if any
+}
+
+// item is a line item as expressions see it
+type item struct {
+	Name     string  `expr:"name"`
+	Amount   float64 `expr:"amount"`
+	IsTaxed  bool    `expr:"isTaxed"`
+	Quantity int     `expr:"quantity"`
+}
+
+// fieldOptions are the fields a rule may set, with the result type their expressions must have
+var fieldOptions = map[string][]expr.Option{
+	"vendor":     {expr.AsKind(reflect.String)},
+	"date":       {expr.AsKind(reflect.String)},
+	"total":      {expr.AsFloat64()},
+	"tax":        {expr.AsFloat64()},
+	"confidence": {expr.AsFloat64()},
+	"categories": nil, // A list of strings, checked when applied
+}
+
+// Set is a compiled list of script rules. It is a pipeline.PostExtractHook.
+type Set struct {
+	rules []*rule
+}
+
+// rule is a compiled ScriptRule
+type rule struct {
+	models.ScriptRule
+	when   *vm.Program // nil matches every invoice
+	assign []assignment
+}
+
+// assignment sets one field to the result of an expression
+type assignment struct {
+	field   string
+	program *vm.Program
+}
+
+// Compile checks and compiles rules. It returns nil when there are none.
+func Compile(rules []models.ScriptRule) (*Set, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	set := &Set{}
+	for i, config := range rules {
+		name := config.Name
+		if name == "" {
+			return nil, fmt.Errorf("scripts[%d].name: required", i)
+		}
+		if len(config.Set) == 0 && config.Reject == "" {
+			return nil, fmt.Errorf("script %s: set or reject required", name)
+		}
+		if len(config.Set) > 0 && config.Reject != "" {
+			return nil, fmt.Errorf("script %s: set and reject are exclusive", name)
+		}
+
+		r := &rule{ScriptRule: config}
+		if config.When != "" {
+			program, err := expr.Compile(config.When, expr.Env(env{}), expr.AsBool())
+			if err != nil {
+				return nil, fmt.Errorf("script %s: when: %w", name, err)
+			}
+			r.when = program
+		}
+
+		fields := make([]string, 0, len(config.Set))
+		for field := range config.Set {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			options, ok := fieldOptions[field]
+			if !ok {
+				return nil, fmt.Errorf("script %s: cannot set %q (allowed: vendor, date, total, tax, categories, confidence)", name, field)
+			}
+			program, err := expr.Compile(config.Set[field], append([]expr.Option{expr.Env(env{})}, options...)...)
+			if err != nil {
+				return nil, fmt.Errorf("script %s: set %s: %w", name, field, err)
+			}
+			r.assign = append(r.assign, assignment{field: field, program: program})
+		}
+		set.rules = append(set.rules, r)
+	}
+	return set, nil
+}
+
+// Name implements pipeline.Hook
+func (s *Set) Name() string {
+	return "scripts"
+}
+
+// PostExtract applies the rules in order. Each rule sees the changes of the
+// ones before it; the fields a rule sets are all computed before any is changed.
+func (s *Set) PostExtract(ctx context.Context, invoice *models.Invoice, stats pipeline.Stats) error {
+	for _, r := range s.rules {
+		values := newEnv(invoice, stats)
+		if r.when != nil {
+			matched, err := expr.Run(r.when, values)
+			if err != nil {
+				return fmt.Errorf("script %s: when: %w", r.Name, err)
+			}
+			if ok, _ := matched.(bool); !ok {
+				continue
+			}
+		}
+		if r.Reject != "" {
+			return fmt.Errorf("%w: %s", pipeline.ErrRejected, r.Reject)
+		}
+
+		results := make([]any, len(r.assign))
+		for i, a := range r.assign {
+			result, err := expr.Run(a.program, values)
+			if err != nil {
+				return fmt.Errorf("script %s: set %s: %w", r.Name, a.field, err)
+			}
+			results[i] = result
+		}
+		for i, a := range r.assign {
+			if err := setField(invoice, a.field, results[i]); err != nil {
+				return fmt.Errorf("script %s: set %s: %w", r.Name, a.field, err)
+			}
+			if a.field != "confidence" {
+				invoice.SetProvenance(models.Provenance{Source: models.SourceScript, Rule: r.Name}, a.field)
+			}
+		}
+	}
+	return nil
+}
+
+// newEnv returns the values expressions see for invoice
+func newEnv(invoice *models.Invoice, stats pipeline.Stats) env {
+	e := env{
+		Vendor:     invoice.Vendor,
+		Total:      invoice.Total.InexactFloat64(),
+		Tax:        invoice.Tax.InexactFloat64(),
+		Categories: invoice.Categories,
+		Confidence: invoice.Confidence,
+		Text:       stats.RawText,
+		Provider:   stats.Provider,
+		Model:      stats.Model,
+		Rule:       stats.Rule,
+	}
+	if !invoice.Date.IsZero() {
+		e.Date = invoice.Date.Format(time.DateOnly)
+	}
+	for _, i := range invoice.Items {
+		e.Items = append(e.Items, item{
+			Name:     i.Name,
+			Amount:   i.Amount.InexactFloat64(),
+			IsTaxed:  i.IsTaxed,
+			Quantity: i.Quantity,
+		})
+	}
+	return e
+}
+
+// setField stores the result of an expression in a field of invoice
+func setField(invoice *models.Invoice, field string, value any) error {
+	switch field {
+	case "vendor":
+		invoice.Vendor = value.(string)
+	case "date":
+		if value == "" {
+			invoice.Date = time.Time{}
+			return nil
+		}
+		date, err := time.Parse(time.DateOnly, value.(string))
+		if err != nil {
+			return fmt.Errorf("must be a date like 2024-12-31, got %q", value)
+		}
+		invoice.Date = date
+	case "total":
+		invoice.Total = decimal.NewFromFloat(value.(float64))
+	case "tax":
+		invoice.Tax = decimal.NewFromFloat(value.(float64))
+	case "confidence":
+		confidence := value.(float64)
+		if confidence < 0 || confidence > 1 {
+			return fmt.Errorf("must be between 0 and 1, got %v", confidence)
+		}
+		invoice.Confidence = confidence
+	case "categories":
+		categories, err := stringList(value)
+		if err != nil {
+			return err
+		}
+		invoice.Categories = categories
+	}
+	return nil
+}
+
+// stringList converts an expression result to a list of strings. A single
+// string is accepted as a list of one.
+func stringList(value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, element := range v {
+			s, ok := element.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a list of strings, got element %v", element)
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("must be a list of strings, got %T", value)
+}
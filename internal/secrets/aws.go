@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// AWS reads secrets from AWS Secrets Manager
+type AWS struct {
+	client *secretsmanager.Client
+}
+
+// NewAWS creates a Secrets Manager fetcher using the default credential chain
+// (environment, shared config, IAM role)
+func NewAWS(ctx context.Context, config models.AWSSecretsConfig) (*AWS, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if config.Region != "" {
+		options = append(options, awsconfig.WithRegion(config.Region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return &AWS{client: secretsmanager.NewFromConfig(cfg)}, nil
+}
+
+// Fetch reads the secret with the given name or ARN. JSON secrets expose
+// their keys as fields; plain text secrets are a single value.
+func (a *AWS) Fetch(ctx context.Context, name string) (map[string]string, error) {
+	out, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("secret has no string value")
+	}
+	return decodeFields(*out.SecretString), nil
+}
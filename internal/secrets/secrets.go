@@ -0,0 +1,125 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Reference prefixes of values fetched from a secret store, e.g.
+// "vault:secret/data/invoice-ocr#openai_api_key" or "aws-sm:invoice-ocr/prod#openai_api_key"
+const (
+	VaultPrefix = "vault:"
+	AWSPrefix   = "aws-sm:"
+)
+
+// Fetcher reads a whole secret from a store
+type Fetcher interface {
+	Fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+// IsReference reports whether value points at a secret store
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, VaultPrefix) || strings.HasPrefix(value, AWSPrefix)
+}
+
+// Resolver resolves secret references. Each secret is fetched once, so
+// several fields of the same secret cost a single request.
+type Resolver struct {
+	config models.SecretsConfig
+	vault  Fetcher
+	aws    Fetcher
+	cache  map[string]map[string]string
+}
+
+// NewResolver creates a resolver. Stores are only contacted when a reference uses them.
+func NewResolver(config models.SecretsConfig) *Resolver {
+	return &Resolver{
+		config: config,
+		cache:  make(map[string]map[string]string),
+	}
+}
+
+// Resolve returns the secret a reference points at. Without a "#field"
+// suffix the secret must hold exactly one value.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	prefix := AWSPrefix
+	if strings.HasPrefix(ref, VaultPrefix) {
+		prefix = VaultPrefix
+	}
+	path, field, _ := strings.Cut(strings.TrimPrefix(ref, prefix), "#")
+
+	values, ok := r.cache[prefix+path]
+	if !ok {
+		fetcher, err := r.fetcher(ctx, prefix)
+		if err != nil {
+			return "", err
+		}
+		values, err = fetcher.Fetch(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch secret %s: %w", path, err)
+		}
+		r.cache[prefix+path] = values
+	}
+
+	if field == "" {
+		if len(values) != 1 {
+			return "", fmt.Errorf("secret %s has %d fields, select one with #field", path, len(values))
+		}
+		for _, value := range values {
+			return value, nil
+		}
+	}
+	value, ok := values[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %q", path, field)
+	}
+	return value, nil
+}
+
+// fetcher returns the store for a reference prefix, creating it on first use
+func (r *Resolver) fetcher(ctx context.Context, prefix string) (Fetcher, error) {
+	var err error
+	if prefix == VaultPrefix {
+		if r.vault == nil {
+			r.vault, err = NewVault(r.config.Vault)
+		}
+		return r.vault, err
+	}
+	if r.aws == nil {
+		r.aws, err = NewAWS(ctx, r.config.AWS)
+	}
+	return r.aws, err
+}
+
+// ReadFile reads a secret from a file such as a Docker or Kubernetes secret,
+// trimming the trailing newline most tools add
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// decodeFields turns a JSON object into string fields; non-JSON data is a single value
+func decodeFields(data string) map[string]string {
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return map[string]string{"": data}
+	}
+
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			values[k] = s
+		} else {
+			values[k] = fmt.Sprint(v)
+		}
+	}
+	return values
+}
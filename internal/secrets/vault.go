@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Vault reads secrets from a HashiCorp Vault KV engine over its HTTP API
+type Vault struct {
+	address   string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// NewVault creates a Vault fetcher, falling back to VAULT_ADDR and VAULT_TOKEN
+func NewVault(config models.VaultConfig) (*Vault, error) {
+	address := config.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("vault address is not configured (set secrets.vault.address or VAULT_ADDR)")
+	}
+
+	token := config.Token
+	if config.TokenFile != "" {
+		t, err := ReadFile(config.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault token: %w", err)
+		}
+		token = t
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("vault token is not configured (set secrets.vault.token_file or VAULT_TOKEN)")
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &Vault{
+		address:   strings.TrimRight(address, "/"),
+		token:     token,
+		namespace: config.Namespace,
+		client:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Fetch reads the secret at path, e.g. "secret/data/invoice-ocr" for KV v2
+func (v *Vault) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.address+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var payload struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	// KV v2 nests the values under data.data next to data.metadata
+	data := payload.Data
+	if inner, ok := data["data"]; ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nil
+			err = json.Unmarshal(inner, &data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode vault secret: %w", err)
+			}
+		}
+	}
+
+	values := make(map[string]string, len(data))
+	for k, raw := range data {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			values[k] = s
+		} else {
+			values[k] = string(raw)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"hex", strings.Repeat("42", 32), false},
+		{"hex with newline", strings.Repeat("42", 32) + "\n", false},
+		{"base64", base64.StdEncoding.EncodeToString(testKey), false},
+		{"short hex", strings.Repeat("42", 16), true},
+		{"short base64", base64.StdEncoding.EncodeToString(testKey[:16]), true},
+		{"garbage", "not a key", true},
+		{"empty", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(key, testKey) {
+				t.Errorf("key = %x", key)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	aead, err := newAEAD(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte("INVOICE 2024-001 TOTAL 12.50")
+	sealed, err := seal(aead, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, encryptedMagic) || bytes.Contains(sealed, plain) {
+		t.Fatal("sealed data must be prefixed and not contain the plaintext")
+	}
+	again, _ := seal(aead, plain)
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice must use fresh nonces")
+	}
+
+	opened, err := open(aead, sealed)
+	if err != nil || !bytes.Equal(opened, plain) {
+		t.Fatalf("open = %q, %v", opened, err)
+	}
+
+	otherKey, _ := newAEAD(bytes.Repeat([]byte{0x43}, 32))
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		aead cipher.AEAD
+		data []byte
+	}{
+		{"tampered", aead, tampered},
+		{"wrong key", otherKey, sealed},
+		{"truncated", aead, sealed[:len(encryptedMagic)+4]},
+		{"no key", nil, sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := open(tt.aead, tt.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestOpenPlaintext(t *testing.T) {
+	aead, _ := newAEAD(testKey)
+	plain := []byte(`{"id":"written-before-encryption"}`)
+	if data, err := open(aead, plain); err != nil || !bytes.Equal(data, plain) {
+		t.Errorf("open with key = %q, %v", data, err)
+	}
+	if data, err := open(nil, plain); err != nil || !bytes.Equal(data, plain) {
+		t.Errorf("open without key = %q, %v", data, err)
+	}
+}
+
+func TestFileStoreEncryptsAtRest(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := &models.StoredInvoice{ID: "inv", Invoice: &models.Invoice{Vendor: "ACME Secret Vendor"}, CreatedAt: time.Now()}
+	if err := store.Save(record, []byte("original image bytes")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{metadataFile, originalFile} {
+		raw, err := os.ReadFile(filepath.Join(dir, "inv", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(raw, encryptedMagic) || bytes.Contains(raw, []byte("ACME")) || bytes.Contains(raw, []byte("original")) {
+			t.Errorf("%s is not encrypted", name)
+		}
+	}
+
+	got, err := store.Get("inv")
+	if err != nil || got.Invoice.Vendor != "ACME Secret Vendor" {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+	original, err := store.GetOriginal("inv")
+	if err != nil || string(original) != "original image bytes" {
+		t.Fatalf("GetOriginal = %q, %v", original, err)
+	}
+
+	plainStore, _ := NewFileStore(dir, nil)
+	if _, err := plainStore.Get("inv"); err == nil {
+		t.Error("reading encrypted metadata without a key must fail")
+	}
+}
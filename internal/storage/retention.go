@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Purger periodically removes original images and raw OCR text older than a TTL
+type Purger struct {
+	store    Store
+	ttl      time.Duration
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewPurger creates a new retention purger
+func NewPurger(store Store, ttl, interval time.Duration) *Purger {
+	if interval <= 0 {
+		interval = time.Hour // Default purge interval
+	}
+	return &Purger{
+		store:    store,
+		ttl:      ttl,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the purge loop in the background until Stop is called
+func (p *Purger) Start() {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := p.Purge(time.Now()); err != nil {
+				slog.Error("retention purge failed", "error", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop terminates the purge loop
+func (p *Purger) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Purge removes expired artifacts and returns the number of invoices affected.
+// The listing only selects candidates; each invoice is re-read by the store
+// when purging, so changes made since the listing are not overwritten.
+func (p *Purger) Purge(now time.Time) (int, error) {
+	records, err := p.store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := now.Add(-p.ttl)
+	purged := 0
+	for _, record := range records {
+		if record.ArtifactsPurgedAt != nil || !record.CreatedAt.Before(cutoff) {
+			continue
+		}
+
+		ok, err := p.store.PurgeArtifacts(record.ID, now)
+		if errors.Is(err, ErrNotFound) {
+			continue // Deleted since the listing
+		}
+		if err != nil {
+			return purged, err
+		}
+		if ok {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+func saveTestInvoice(t *testing.T, store *FileStore, id string, createdAt time.Time) {
+	t.Helper()
+	record := &models.StoredInvoice{
+		ID:        id,
+		Invoice:   &models.Invoice{Vendor: "ACME", RawText: "ACME\nTOTAL 12.50"},
+		CreatedAt: createdAt,
+	}
+	if err := store.Save(record, []byte("image")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	saveTestInvoice(t, store, "old", now.Add(-48*time.Hour))
+	saveTestInvoice(t, store, "new", now.Add(-time.Hour))
+
+	purger := NewPurger(store, 24*time.Hour, 0)
+	purged, err := purger.Purge(now)
+	if err != nil || purged != 1 {
+		t.Fatalf("Purge = %d, %v, want 1", purged, err)
+	}
+
+	tests := []struct {
+		id     string
+		purged bool
+	}{
+		{"old", true},
+		{"new", false},
+	}
+	for _, tt := range tests {
+		record, err := store.Get(tt.id)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", tt.id, err)
+		}
+		_, err = store.GetOriginal(tt.id)
+		if got := errors.Is(err, ErrNotFound); got != tt.purged {
+			t.Errorf("%s: original missing = %v, want %v", tt.id, got, tt.purged)
+		}
+		if got := record.Invoice.RawText == ""; got != tt.purged {
+			t.Errorf("%s: raw text cleared = %v, want %v", tt.id, got, tt.purged)
+		}
+		if got := record.ArtifactsPurgedAt != nil; got != tt.purged {
+			t.Errorf("%s: ArtifactsPurgedAt set = %v, want %v", tt.id, got, tt.purged)
+		}
+		if record.Invoice.Vendor != "ACME" {
+			t.Errorf("%s: vendor = %q, extracted fields must be kept", tt.id, record.Invoice.Vendor)
+		}
+	}
+
+	// A second run finds nothing left to purge
+	if purged, err := purger.Purge(now); err != nil || purged != 0 {
+		t.Errorf("second Purge = %d, %v, want 0", purged, err)
+	}
+}
+
+func TestPurgeArtifactsKeepsConcurrentChanges(t *testing.T) {
+	store, err := NewFileStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	saveTestInvoice(t, store, "inv", now.Add(-48*time.Hour))
+
+	// A correction lands after the purger listed the invoice
+	record, _ := store.Get("inv")
+	record.Invoice.Vendor = "ACME Corp"
+	record.CorrectedFields = []string{"vendor"}
+	if err := store.Update(record); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := store.PurgeArtifacts("inv", now)
+	if err != nil || !ok {
+		t.Fatalf("PurgeArtifacts = %v, %v", ok, err)
+	}
+	record, _ = store.Get("inv")
+	if record.Invoice.Vendor != "ACME Corp" || len(record.CorrectedFields) != 1 {
+		t.Errorf("correction was overwritten: %+v", record)
+	}
+
+	if ok, err := store.PurgeArtifacts("inv", now); err != nil || ok {
+		t.Errorf("purging twice = %v, %v, want false", ok, err)
+	}
+	if _, err := store.PurgeArtifacts("missing", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing invoice: err = %v, want ErrNotFound", err)
+	}
+}
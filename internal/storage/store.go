@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+const (
+	metadataFile = "invoice.json"
+	originalFile = "original"
+)
+
+// ErrNotFound is returned when no stored invoice exists for an ID
+var ErrNotFound = errors.New("invoice not found")
+
+// validID guards against path traversal through user-supplied IDs
+var validID = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// Store persists processed invoices together with their original upload
+type Store interface {
+	Save(record *models.StoredInvoice, original []byte) error
+	Update(record *models.StoredInvoice) error
+	Get(id string) (*models.StoredInvoice, error)
+	GetOriginal(id string) ([]byte, error)
+	List() ([]*models.StoredInvoice, error)
+	PurgeArtifacts(id string, at time.Time) (bool, error)
+	Delete(id string) error
+}
+
+// FileStore implements Store on the local filesystem, one directory per invoice
+type FileStore struct {
+	basePath string
+	aead     cipher.AEAD // nil when encryption at rest is disabled
+	mu       sync.RWMutex
+}
+
+// NewFileStore creates a new filesystem-backed store rooted at basePath.
+// When key is non-empty, images and metadata are encrypted with AES-256-GCM.
+func NewFileStore(basePath string, key []byte) (*FileStore, error) {
+	if basePath == "" {
+		basePath = "./data/invoices" // Default storage location
+	}
+
+	s := &FileStore{
+		basePath: basePath,
+	}
+
+	if len(key) > 0 {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		s.aead = aead
+	}
+
+	return s, nil
+}
+
+// Save writes the invoice metadata and the original image
+func (s *FileStore) Save(record *models.StoredInvoice, original []byte) error {
+	dir, err := s.dir(record.ID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err = os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return fmt.Errorf("failed to create invoice directory: %w", err)
+	}
+
+	err = s.writeFile(filepath.Join(dir, originalFile), original)
+	if err != nil {
+		return fmt.Errorf("failed to write original image: %w", err)
+	}
+
+	return s.writeMetadata(dir, record)
+}
+
+// Update overwrites the metadata of an existing invoice, keeping the original image
+func (s *FileStore) Update(record *models.StoredInvoice) error {
+	dir, err := s.dir(record.ID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	return s.writeMetadata(dir, record)
+}
+
+// Get loads the metadata of a stored invoice
+func (s *FileStore) Get(id string) (*models.StoredInvoice, error) {
+	dir, err := s.dir(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.readMetadata(dir)
+}
+
+// GetOriginal loads the original uploaded image of a stored invoice
+func (s *FileStore) GetOriginal(id string) ([]byte, error) {
+	dir, err := s.dir(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := s.readFile(filepath.Join(dir, originalFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read original image: %w", err)
+	}
+
+	return data, nil
+}
+
+// List loads the metadata of all stored invoices
+func (s *FileStore) List() ([]*models.StoredInvoice, error) {
+	s.mu.RLock()
+	entries, err := os.ReadDir(s.basePath)
+	s.mu.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list invoices: %w", err)
+	}
+
+	records := make([]*models.StoredInvoice, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		record, err := s.Get(entry.Name())
+		if err != nil {
+			// Skip partially written or already deleted entries
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// PurgeArtifacts removes the original image and the raw OCR text of a stored
+// invoice, keeping the rest of its metadata, and records the time in
+// ArtifactsPurgedAt. It reads and writes the metadata under the store lock, so
+// concurrent corrections are kept. It reports false when the invoice was
+// already purged.
+func (s *FileStore) PurgeArtifacts(id string, at time.Time) (bool, error) {
+	dir, err := s.dir(id)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.readMetadata(dir)
+	if err != nil {
+		return false, err
+	}
+	if record.ArtifactsPurgedAt != nil {
+		return false, nil
+	}
+
+	err = os.Remove(filepath.Join(dir, originalFile))
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to delete original image: %w", err)
+	}
+
+	if record.Invoice != nil {
+		record.Invoice.RawText = ""
+	}
+	record.ArtifactsPurgedAt = &at
+
+	return true, s.writeMetadata(dir, record)
+}
+
+// Delete removes all artifacts of a stored invoice
+func (s *FileStore) Delete(id string) error {
+	dir, err := s.dir(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return fmt.Errorf("failed to delete invoice: %w", err)
+	}
+
+	return nil
+}
+
+// dir returns the directory holding the artifacts of an invoice
+func (s *FileStore) dir(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.basePath, id), nil
+}
+
+// readMetadata loads the metadata file of an invoice (caller holds the lock)
+func (s *FileStore) readMetadata(dir string) (*models.StoredInvoice, error) {
+	data, err := s.readFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read invoice metadata: %w", err)
+	}
+
+	var record models.StoredInvoice
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse invoice metadata: %w", err)
+	}
+
+	return &record, nil
+}
+
+// writeMetadata atomically replaces the metadata file (caller holds the lock)
+func (s *FileStore) writeMetadata(dir string, record *models.StoredInvoice) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal invoice metadata: %w", err)
+	}
+
+	tempPath := filepath.Join(dir, metadataFile+".tmp")
+	err = s.writeFile(tempPath, data)
+	if err != nil {
+		return fmt.Errorf("failed to write invoice metadata: %w", err)
+	}
+
+	return os.Rename(tempPath, filepath.Join(dir, metadataFile))
+}
+
+// writeFile writes an artifact, encrypting it when a key is configured
+func (s *FileStore) writeFile(path string, data []byte) error {
+	if s.aead != nil {
+		sealed, err := seal(s.aead, data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+	return os.WriteFile(path, data, 0o640)
+}
+
+// readFile reads an artifact, transparently decrypting it
+func (s *FileStore) readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return open(s.aead, data)
+}
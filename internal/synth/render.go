@@ -0,0 +1,96 @@
+package synth
+
+import "math/rand"
+
+// RenderOptions configures how a document is drawn
+type RenderOptions struct {
+	Format  string  // Image format, e.g. "png" (default) or "jpg"
+	Font    string  // Font name or file; empty uses ImageMagick's default
+	Degrade bool    // Simulate a phone photo: slight rotation, noise and blur
+	Seed    int64   // Drives the degradation
+	Scale   float64 // Multiplies the page size and font, default 1
+}
+
+// page is a document laid out for drawing
+type page struct {
+	width, height float64
+	texts         []text
+	rules         []rule
+	ruleWidth     float64
+}
+
+// text is a line of text drawn at a baseline position
+type text struct {
+	x, y  float64
+	size  float64
+	value string
+	right bool // x is the right edge rather than the left
+}
+
+// rule is a horizontal line
+type rule struct {
+	x1, x2, y float64
+}
+
+// degradation is how a rendered page is made to look like a phone photo
+type degradation struct {
+	angle float64 // Rotation in degrees
+	noise float64 // Gaussian noise attenuation
+	sigma float64 // Blur
+}
+
+// Render draws doc as an image
+func Render(doc *Document, opts RenderOptions) ([]byte, error) {
+	if opts.Format == "" {
+		opts.Format = "png"
+	}
+	if opts.Scale <= 0 {
+		opts.Scale = 1
+	}
+
+	width, fontSize := 420.0, 18.0
+	if doc.Layout == LayoutInvoice {
+		width, fontSize = 1240, 26
+	}
+	width *= opts.Scale
+	fontSize *= opts.Scale
+	lineHeight := fontSize * 1.5
+	margin := fontSize * 2
+
+	lines := doc.Lines()
+	height := 2*margin + lineHeight*float64(len(lines))
+	if doc.Layout == LayoutInvoice && height < width*1.414 {
+		height = width * 1.414 // A4
+	}
+
+	p := page{width: width, height: height, ruleWidth: opts.Scale}
+	for i, line := range lines {
+		y := margin + lineHeight*float64(i+1)
+		size := fontSize
+		if i == 0 || line[0] == "TOTAL" || line[0] == "INVOICE" {
+			size = fontSize * 1.3 // Vendor name, heading and total stand out
+		}
+
+		if line[0] != "" {
+			p.texts = append(p.texts, text{x: margin, y: y, size: size, value: line[0]})
+		}
+		if line[1] != "" {
+			p.texts = append(p.texts, text{x: width - margin, y: y, size: size, value: line[1], right: true})
+		}
+		if line[0] == "Subtotal" {
+			// A rule above the totals, as on most receipts
+			p.rules = append(p.rules, rule{x1: margin, x2: width - margin, y: y - lineHeight*0.8})
+		}
+	}
+
+	var degrade *degradation
+	if opts.Degrade {
+		r := rand.New(rand.NewSource(opts.Seed))
+		degrade = &degradation{
+			angle: r.Float64()*4 - 2,
+			noise: 0.3 + r.Float64()*0.5,
+			sigma: 0.3 + r.Float64()*0.6,
+		}
+	}
+	return draw(p, degrade, opts)
+}
@@ -0,0 +1,51 @@
+//go:build magickcli
+
+package synth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ocr"
+)
+
+// mvgQuote escapes a string for a double-quoted MVG string
+var mvgQuote = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// draw renders p by running ImageMagick, drawing with a vector graphics
+// (MVG) script passed on the command line
+func draw(p page, degrade *degradation, opts RenderOptions) ([]byte, error) {
+	var mvg strings.Builder
+	if opts.Font != "" {
+		fmt.Fprintf(&mvg, "font \"%s\"\n", mvgQuote.Replace(opts.Font))
+	}
+	mvg.WriteString("fill black\nstroke black\nstroke-width 0\n")
+	for _, t := range p.texts {
+		anchor := "start"
+		if t.right {
+			anchor = "end"
+		}
+		fmt.Fprintf(&mvg, "font-size %.2f\ntext-anchor %s\ntext %.2f,%.2f \"%s\"\n", t.size, anchor, t.x, t.y, mvgQuote.Replace(t.value))
+	}
+	fmt.Fprintf(&mvg, "stroke-width %.2f\n", p.ruleWidth)
+	for _, r := range p.rules {
+		fmt.Fprintf(&mvg, "line %.2f,%.2f %.2f,%.2f\n", r.x1, r.y, r.x2, r.y)
+	}
+
+	args := []string{"-size", fmt.Sprintf("%dx%d", uint(p.width), uint(p.height)), "xc:white", "-draw", mvg.String()}
+	if degrade != nil {
+		args = append(args,
+			"-background", "white", "-rotate", fmt.Sprintf("%.4f", degrade.angle),
+			"-attenuate", fmt.Sprintf("%.4f", degrade.noise), "+noise", "Gaussian",
+			"-blur", fmt.Sprintf("0x%.4f", degrade.sigma),
+		)
+	}
+	blob, err := ocr.RunMagick(nil, append(args, opts.Format+":-")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render image: %w", err)
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("rendered image is empty")
+	}
+	return blob, nil
+}
@@ -0,0 +1,77 @@
+//go:build !magickcli
+
+package synth
+
+import (
+	"fmt"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ocr"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// draw renders p with the linked ImageMagick library
+func draw(p page, degrade *degradation, opts RenderOptions) ([]byte, error) {
+	ocr.InitMagick()
+
+	white := imagick.NewPixelWand()
+	defer white.Destroy()
+	white.SetColor("white")
+	black := imagick.NewPixelWand()
+	defer black.Destroy()
+	black.SetColor("black")
+
+	mw := imagick.NewMagickWand()
+	defer mw.Destroy()
+	if err := mw.NewImage(uint(p.width), uint(p.height), white); err != nil {
+		return nil, fmt.Errorf("failed to create image: %w", err)
+	}
+
+	dw := imagick.NewDrawingWand()
+	defer dw.Destroy()
+	if opts.Font != "" {
+		if err := dw.SetFont(opts.Font); err != nil {
+			return nil, fmt.Errorf("failed to set font %s: %w", opts.Font, err)
+		}
+	}
+	dw.SetFillColor(black)
+	dw.SetStrokeColor(black)
+
+	dw.SetStrokeWidth(0)
+	for _, t := range p.texts {
+		dw.SetFontSize(t.size)
+		if t.right {
+			dw.SetTextAlignment(imagick.ALIGN_RIGHT)
+		} else {
+			dw.SetTextAlignment(imagick.ALIGN_LEFT)
+		}
+		dw.Annotation(t.x, t.y, t.value)
+	}
+	dw.SetStrokeWidth(p.ruleWidth)
+	for _, r := range p.rules {
+		dw.Line(r.x1, r.y, r.x2, r.y)
+	}
+	if err := mw.DrawImage(dw); err != nil {
+		return nil, fmt.Errorf("failed to draw text: %w", err)
+	}
+
+	if degrade != nil {
+		if err := mw.RotateImage(white, degrade.angle); err != nil {
+			return nil, fmt.Errorf("rotate failed: %w", err)
+		}
+		if err := mw.AddNoiseImage(imagick.NOISE_GAUSSIAN, degrade.noise); err != nil {
+			return nil, fmt.Errorf("noise failed: %w", err)
+		}
+		if err := mw.BlurImage(0, degrade.sigma); err != nil {
+			return nil, fmt.Errorf("blur failed: %w", err)
+		}
+	}
+
+	if err := mw.SetImageFormat(opts.Format); err != nil {
+		return nil, fmt.Errorf("unsupported format %s: %w", opts.Format, err)
+	}
+	blob := mw.GetImageBlob()
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("rendered image is empty")
+	}
+	return blob, nil
+}
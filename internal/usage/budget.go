@@ -0,0 +1,145 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Budget periods
+const (
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// Spend is the estimated service-wide spend of the current UTC day and month
+type Spend struct {
+	Day     string  `json:"day"`   // "2006-01-02"
+	Daily   float64 `json:"daily"` // USD
+	Month   string  `json:"month"` // "2006-01"
+	Monthly float64 `json:"monthly"`
+}
+
+// Budget tracks the estimated spend of all callers against the limits of a
+// models.BudgetConfig. Limits are passed to each call, so they can change on
+// reload.
+type Budget struct {
+	path string // JSON persistence file, empty for in-memory only
+
+	mu    sync.Mutex
+	spend Spend
+}
+
+// NewBudget creates a budget, loading the spend so far from path if it exists
+func NewBudget(path string) (*Budget, error) {
+	b := &Budget{path: path}
+	if path == "" {
+		return b, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, fmt.Errorf("failed to read budget file: %w", err)
+	}
+	if err := json.Unmarshal(data, &b.spend); err != nil {
+		return nil, fmt.Errorf("failed to parse budget file: %w", err)
+	}
+	return b, nil
+}
+
+// Add records the estimated cost of a call and returns the thresholds it
+// made the spend reach. Each threshold fires once per day or month.
+func (b *Budget) Add(cost float64, config models.BudgetConfig) ([]models.BudgetAlert, error) {
+	if cost <= 0 {
+		return nil, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	daily, monthly := b.spend.Daily, b.spend.Monthly
+	b.spend.Daily += cost
+	b.spend.Monthly += cost
+
+	var alerts []models.BudgetAlert
+	alerts = appendCrossed(alerts, Daily, config.Daily, config.Thresholds, daily, b.spend.Daily)
+	alerts = appendCrossed(alerts, Monthly, config.Monthly, config.Thresholds, monthly, b.spend.Monthly)
+	return alerts, b.save()
+}
+
+// appendCrossed appends an alert for each threshold of limit between before
+// (exclusive) and after (inclusive)
+func appendCrossed(alerts []models.BudgetAlert, period string, limit float64, thresholds []float64, before, after float64) []models.BudgetAlert {
+	if limit <= 0 {
+		return alerts
+	}
+	for _, threshold := range thresholds {
+		if at := threshold * limit; before < at && after >= at {
+			alerts = append(alerts, models.BudgetAlert{
+				Period:    period,
+				Threshold: threshold,
+				Limit:     limit,
+				Spend:     after,
+			})
+		}
+	}
+	return alerts
+}
+
+// Exceeded reports whether the spend reached the daily or monthly limit
+func (b *Budget) Exceeded(config models.BudgetConfig) bool {
+	spend := b.Spend()
+	return (config.Daily > 0 && spend.Daily >= config.Daily) ||
+		(config.Monthly > 0 && spend.Monthly >= config.Monthly)
+}
+
+// Spend returns the spend of the current day and month
+func (b *Budget) Spend() Spend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	return b.spend
+}
+
+// rollover starts a new day or month when the current one ended (caller holds the lock)
+func (b *Budget) rollover() {
+	now := time.Now().UTC()
+	if day := now.Format("2006-01-02"); b.spend.Day != day {
+		b.spend.Day = day
+		b.spend.Daily = 0
+	}
+	if month := now.Format("2006-01"); b.spend.Month != month {
+		b.spend.Month = month
+		b.spend.Monthly = 0
+	}
+}
+
+// save writes the spend to the persistence file (caller holds the lock)
+func (b *Budget) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(b.spend)
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o750); err != nil {
+		return fmt.Errorf("failed to create budget directory: %w", err)
+	}
+	tempPath := b.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write budget file: %w", err)
+	}
+	return os.Rename(tempPath, b.path)
+}
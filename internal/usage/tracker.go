@@ -0,0 +1,190 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Totals accumulates usage for one key over one month
+type Totals struct {
+	Requests         int     `json:"requests"`
+	Pages            int     `json:"pages"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	EstimatedCost    float64 `json:"estimatedCost"` // USD
+}
+
+// Tracker records usage per caller key and month ("2006-01")
+type Tracker struct {
+	path   string // JSON persistence file, empty for in-memory only
+	prices map[string]models.ModelPrice
+	quotas models.QuotaConfig
+
+	mu     sync.Mutex
+	totals map[string]map[string]*Totals // key -> month -> totals
+}
+
+// NewTracker creates a tracker, loading previous totals from path if it exists
+func NewTracker(config models.UsageConfig) (*Tracker, error) {
+	t := &Tracker{
+		path:   config.Path,
+		prices: config.Prices,
+		quotas: config.DefaultQuota,
+		totals: make(map[string]map[string]*Totals),
+	}
+
+	if t.path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return t, nil
+		}
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+
+	err = json.Unmarshal(data, &t.totals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse usage file: %w", err)
+	}
+
+	return t, nil
+}
+
+// Record adds one processed request to the caller's totals for the current month
+func (t *Tracker) Record(key string, u models.Usage) error {
+	month := time.Now().UTC().Format("2006-01")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	months, ok := t.totals[key]
+	if !ok {
+		months = make(map[string]*Totals)
+		t.totals[key] = months
+	}
+	totals, ok := months[month]
+	if !ok {
+		totals = &Totals{}
+		months[month] = totals
+	}
+
+	totals.Requests++
+	totals.Pages += u.Pages
+	totals.PromptTokens += u.PromptTokens
+	totals.CompletionTokens += u.CompletionTokens
+	totals.EstimatedCost += u.EstimatedCost
+
+	return t.save()
+}
+
+// EstimateCost returns the estimated USD cost of a call from the price table.
+// Prices are looked up as "provider/model", then model, then provider; calls
+// without a price cost 0.
+func (t *Tracker) EstimateCost(provider, model string, promptTokens, completionTokens int) float64 {
+	price, ok := t.prices[provider+"/"+model]
+	if !ok {
+		price, ok = t.prices[model]
+	}
+	if !ok {
+		price, ok = t.prices[provider]
+	}
+	if !ok {
+		return 0
+	}
+	return float64(promptTokens)/1000*price.InputPer1K + float64(completionTokens)/1000*price.OutputPer1K
+}
+
+// Month returns the caller's totals for the current month
+func (t *Tracker) Month(key string) Totals {
+	month := time.Now().UTC().Format("2006-01")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if totals, ok := t.totals[key][month]; ok {
+		return *totals
+	}
+	return Totals{}
+}
+
+// History returns all monthly totals of a caller, keyed by month
+func (t *Tracker) History(key string) map[string]Totals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	history := make(map[string]Totals, len(t.totals[key]))
+	for month, totals := range t.totals[key] {
+		history[month] = *totals
+	}
+	return history
+}
+
+// Keys returns every caller key with recorded usage
+func (t *Tracker) Keys() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.totals))
+	for key := range t.totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// QuotaExceeded reports whether the caller exhausted its monthly quota.
+// quota overrides the default quota when non-nil.
+func (t *Tracker) QuotaExceeded(key string, quota *models.QuotaConfig) (bool, string) {
+	q := t.quotas
+	if quota != nil {
+		q = *quota
+	}
+
+	totals := t.Month(key)
+	switch {
+	case q.Requests > 0 && totals.Requests >= q.Requests:
+		return true, "monthly request quota exhausted"
+	case q.Pages > 0 && totals.Pages >= q.Pages:
+		return true, "monthly page quota exhausted"
+	case q.Tokens > 0 && totals.PromptTokens+totals.CompletionTokens >= q.Tokens:
+		return true, "monthly token quota exhausted"
+	case q.Cost > 0 && totals.EstimatedCost >= q.Cost:
+		return true, "monthly cost quota exhausted"
+	}
+	return false, ""
+}
+
+// save writes all totals to the persistence file (caller holds the lock)
+func (t *Tracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(t.totals)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(t.path), 0o750)
+	if err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	tempPath := t.path + ".tmp"
+	err = os.WriteFile(tempPath, data, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+
+	return os.Rename(tempPath, t.path)
+}
@@ -0,0 +1,252 @@
+// Package vies finds EU VAT numbers in invoice text and checks them in VIES,
+// the European Commission's VAT Information Exchange System
+package vies
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// maxCached bounds the cache; expired answers are dropped beyond it
+const maxCached = 10000
+
+// formats are the VAT number formats of the member states, after the country
+// prefix. Greece uses EL and Northern Ireland XI.
+var formats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}`),
+	"BE": regexp.MustCompile(`^[01]\d{9}`),
+	"BG": regexp.MustCompile(`^\d{9,10}`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]`),
+	"CZ": regexp.MustCompile(`^\d{8,10}`),
+	"DE": regexp.MustCompile(`^\d{9}`),
+	"DK": regexp.MustCompile(`^\d{8}`),
+	"EE": regexp.MustCompile(`^\d{9}`),
+	"EL": regexp.MustCompile(`^\d{9}`),
+	"ES": regexp.MustCompile(`^(?:[A-Z]\d{7}[A-Z0-9]|\d{8}[A-Z])`),
+	"FI": regexp.MustCompile(`^\d{8}`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}`),
+	"HR": regexp.MustCompile(`^\d{11}`),
+	"HU": regexp.MustCompile(`^\d{8}`),
+	"IE": regexp.MustCompile(`^\d[A-Z0-9+*]\d{5}[A-Z]{1,2}`),
+	"IT": regexp.MustCompile(`^\d{11}`),
+	"LT": regexp.MustCompile(`^(?:\d{12}|\d{9})`),
+	"LU": regexp.MustCompile(`^\d{8}`),
+	"LV": regexp.MustCompile(`^\d{11}`),
+	"MT": regexp.MustCompile(`^\d{8}`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}`),
+	"PL": regexp.MustCompile(`^\d{10}`),
+	"PT": regexp.MustCompile(`^\d{9}`),
+	"RO": regexp.MustCompile(`^\d{2,10}`),
+	"SE": regexp.MustCompile(`^\d{12}`),
+	"SI": regexp.MustCompile(`^\d{8}`),
+	"SK": regexp.MustCompile(`^\d{10}`),
+	"XI": regexp.MustCompile(`^(?:\d{12}|\d{9}|GD\d{3}|HA\d{3})`),
+}
+
+var (
+	// labeled matches a number after a VAT label, e.g. "VAT No: DE123456789"
+	// or "CIF: B12345678"
+	labeled = regexp.MustCompile(`(?i)\b(VAT(?:\s*(?:No|Number|Reg(?:istration)?|ID))?|IVA|TVA|BTW|MWST|USt-?Id(?:Nr)?|Partita\s+IVA|P\.?\s*IVA|N\.?\s?I\.?\s?F|C\.?\s?I\.?\s?F|UID)\b\.?\s*(?:n[ºo°]\.?\s*)?[:#]?\s*([A-Z0-9][A-Z0-9 .\-]{6,20})`)
+
+	// prefixed matches a number written with its country prefix and no space
+	prefixed = regexp.MustCompile(`\b(?:AT|BE|BG|CY|CZ|DE|DK|EE|EL|GR|ES|FI|FR|HR|HU|IE|IT|LT|LU|LV|MT|NL|PL|PT|RO|SE|SI|SK|XI)[A-Z0-9+*]{8,12}\b`)
+
+	// nationalLabels imply the country of numbers printed without their prefix
+	nationalLabels = []struct {
+		label   *regexp.Regexp
+		country string
+	}{
+		{regexp.MustCompile(`(?i)^(?:N\.?\s?I\.?\s?F|C\.?\s?I\.?\s?F)$`), "ES"},
+		{regexp.MustCompile(`(?i)^(?:Partita\s+IVA|P\.?\s*IVA)$`), "IT"},
+		{regexp.MustCompile(`(?i)^USt-?Id(?:Nr)?$`), "DE"},
+	}
+
+	// separators are left out of VAT numbers
+	separators = strings.NewReplacer(" ", "", ".", "", "-", "")
+)
+
+// Normalize returns a VAT number in the compact form VIES expects, e.g.
+// "ESB12345678" for "ES B-1234567-8", and whether it has a valid format
+func Normalize(number string) (string, bool) {
+	compact := separators.Replace(strings.ToUpper(strings.TrimSpace(number)))
+	country, rest := prefix(compact)
+	format, ok := formats[country]
+	if !ok || format.FindString(rest) != rest {
+		return compact, false
+	}
+	return country + rest, true
+}
+
+// Find returns the first VAT number in text that is not one of exclude,
+// typically the buyer's own number, or "" if there is none. Labeled numbers
+// are preferred over bare ones.
+func Find(text string, exclude ...string) string {
+	excluded := make(map[string]bool, len(exclude))
+	for _, number := range exclude {
+		if normalized, ok := Normalize(number); ok {
+			excluded[normalized] = true
+		}
+	}
+
+	var candidates []string
+	for _, match := range labeled.FindAllStringSubmatch(text, -1) {
+		compact := separators.Replace(strings.ToUpper(match[2]))
+		country, rest := prefix(compact)
+		if _, ok := formats[country]; !ok {
+			if country = impliedCountry(match[1]); country == "" {
+				continue
+			}
+			rest = compact
+		}
+		// The match may run into the next word: keep the longest number that is
+		// not followed by another digit
+		number := formats[country].FindString(rest)
+		if number == "" || (len(rest) > len(number) && rest[len(number)] >= '0' && rest[len(number)] <= '9') {
+			continue
+		}
+		candidates = append(candidates, country+number)
+	}
+	candidates = append(candidates, prefixed.FindAllString(text, -1)...)
+
+	for _, candidate := range candidates {
+		if number, ok := Normalize(candidate); ok && !excluded[number] {
+			return number
+		}
+	}
+	return ""
+}
+
+// impliedCountry returns the country of a national tax ID label, or ""
+func impliedCountry(label string) string {
+	for _, national := range nationalLabels {
+		if national.label.MatchString(label) {
+			return national.country
+		}
+	}
+	return ""
+}
+
+// prefix splits the country prefix off a compact VAT number, mapping Greece's
+// ISO code GR to the EL used by VIES
+func prefix(compact string) (string, string) {
+	if len(compact) < 2 {
+		return "", compact
+	}
+	country := compact[:2]
+	if country == "GR" {
+		country = "EL"
+	}
+	return country, compact[2:]
+}
+
+// Client checks VAT numbers in VIES, caching the answers
+type Client struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*models.VATCheck
+}
+
+// NewClient creates a client
+func NewClient() *Client {
+	return &Client{
+		client: &http.Client{},
+		cache:  make(map[string]*models.VATCheck),
+	}
+}
+
+// response is the answer of the VIES REST API
+type response struct {
+	IsValid   bool   `json:"isValid"`
+	UserError string `json:"userError"` // "VALID", "INVALID" or an error such as "MS_UNAVAILABLE"
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+}
+
+// Check looks a normalized VAT number up. Answers are cached for
+// config.CacheTTL; failures, such as an unavailable member state service,
+// are not, and are returned as an error.
+func (c *Client) Check(ctx context.Context, number string, config models.VIESConfig) (*models.VATCheck, error) {
+	c.mu.Lock()
+	cached, ok := c.cache[number]
+	if ok && time.Since(cached.CheckedAt) > config.CacheTTL {
+		delete(c.cache, number)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		check := *cached
+		return &check, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	country, rest := prefix(number)
+	endpoint := fmt.Sprintf("%s/ms/%s/vat/%s", strings.TrimSuffix(config.URL, "/"), url.PathEscape(country), url.PathEscape(rest))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("VIES request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VIES response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("VIES returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var answer response
+	if err := json.Unmarshal(body, &answer); err != nil {
+		return nil, fmt.Errorf("failed to parse VIES response: %w", err)
+	}
+	if answer.UserError != "" && answer.UserError != "VALID" && answer.UserError != "INVALID" {
+		return nil, fmt.Errorf("VIES lookup failed: %s", answer.UserError)
+	}
+
+	check := &models.VATCheck{
+		Valid:     answer.IsValid,
+		Name:      disclosed(answer.Name),
+		Address:   disclosed(answer.Address),
+		CheckedAt: time.Now().UTC(),
+	}
+	c.mu.Lock()
+	if len(c.cache) >= maxCached {
+		for cachedNumber, cached := range c.cache {
+			if time.Since(cached.CheckedAt) > config.CacheTTL {
+				delete(c.cache, cachedNumber)
+			}
+		}
+	}
+	c.cache[number] = check
+	c.mu.Unlock()
+
+	result := *check
+	return &result, nil
+}
+
+// disclosed returns a VIES field, or "" when the member state withholds it ("---")
+func disclosed(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if strings.Trim(s, "-") == "" {
+		return ""
+	}
+	return s
+}
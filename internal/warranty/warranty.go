@@ -0,0 +1,94 @@
+// Package warranty flags the line items of a purchase that are likely covered
+// by a warranty, such as electronics and appliances, so users can be reminded
+// before it expires
+package warranty
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+// Reasons an item is a candidate
+const (
+	ReasonSerialNumber = "serial_number" // A serial number or IMEI was printed for it
+	ReasonProduct      = "product"       // Its name is of a product usually sold with a warranty
+)
+
+// minAmount is the price below which products are taken for accessories
+var minAmount = decimal.NewFromInt(20)
+
+// products are the words, without accents, of products usually sold with a
+// warranty, in English, Spanish, German and French
+var products = []string{
+	"tv", "television", "televisor", "fernseher", "televiseur", "monitor", "portatil", "laptop",
+	"notebook", "ordenador", "computer", "pc", "tablet", "ipad", "macbook", "imac", "movil",
+	"smartphone", "iphone", "galaxy", "pixel", "telefono", "handy", "impresora", "printer",
+	"drucker", "imprimante", "auriculares", "headphones", "kopfhorer", "casque", "airpods",
+	"altavoz", "speaker", "camara", "camera", "kamera", "objetivo", "consola", "console",
+	"playstation", "ps5", "xbox", "nintendo", "switch", "smartwatch", "reloj", "watch", "router",
+	"ssd", "disco", "proyector", "projector", "lavadora", "secadora", "lavavajillas", "frigorifico",
+	"nevera", "congelador", "microondas", "horno", "aspiradora", "robot", "cafetera", "batidora",
+	"freidora", "plancha", "secador", "afeitadora", "waschmaschine", "kuhlschrank", "staubsauger",
+	"kaffeemaschine", "lave", "refrigerateur", "aspirateur", "cafetiere", "bicicleta", "patinete",
+	"ebike", "scooter", "taladro", "drill",
+}
+
+// accessories are the words of items sold with products that have no warranty
+// of their own
+var accessories = []string{
+	"cable", "funda", "case", "protector", "pila", "pilas", "battery", "batteries", "cargador",
+	"charger", "adaptador", "adapter", "soporte", "bolsa", "bag", "garantia", "warranty", "seguro",
+	"insurance", "servicio", "service", "instalacion", "installation", "envio", "shipping",
+}
+
+// accents maps accented letters to their base letter
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i", "ó", "o", "ò", "o", "ô", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u", "ñ", "n", "ç", "c",
+)
+
+// Candidates returns the items likely covered by a warranty: those with a
+// serial number, and products such as electronics and appliances that cost at
+// least 20 and are not accessories, services or extended warranties.
+func Candidates(items []models.InvoiceItem) []models.WarrantyCandidate {
+	var candidates []models.WarrantyCandidate
+	for i, item := range items {
+		reason := ""
+		switch {
+		case len(item.SerialNumbers) > 0:
+			reason = ReasonSerialNumber
+		case item.Amount.GreaterThanOrEqual(minAmount) && isProduct(item.Name):
+			reason = ReasonProduct
+		}
+		if reason != "" {
+			candidates = append(candidates, models.WarrantyCandidate{
+				Item:          i,
+				Name:          item.Name,
+				Amount:        item.Amount,
+				SerialNumbers: item.SerialNumbers,
+				Reason:        reason,
+			})
+		}
+	}
+	return candidates
+}
+
+// isProduct reports whether an item name has a product word and no accessory word
+func isProduct(name string) bool {
+	words := strings.FieldsFunc(accents.Replace(strings.ToLower(name)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	product := false
+	for _, word := range words {
+		if slices.Contains(accessories, word) {
+			return false
+		}
+		product = product || slices.Contains(products, word)
+	}
+	return product
+}
@@ -0,0 +1,46 @@
+package warranty
+
+import (
+	"testing"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestCandidates(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount string
+		serial string
+		want   string
+	}{
+		{"TELEVISOR LG 55\" OLED", "899.00", "", ReasonProduct},
+		{"Portátil Lenovo IdeaPad 5", "649.99", "", ReasonProduct},
+		{"Cafetera Nespresso", "89.90", "", ReasonProduct},
+		{"MOD. XR-200", "129.00", "SN4711X9", ReasonSerialNumber},
+		{"Cable HDMI 2m", "24.99", "", ""},
+		{"Funda iPhone 15", "29.99", "", ""},
+		{"Garantía extendida 2 años televisor", "99.00", "", ""},
+		{"Auriculares básicos", "9.99", "", ""},
+		{"Leche entera", "1.20", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := models.InvoiceItem{Name: tt.name, Amount: decimal.RequireFromString(tt.amount)}
+			if tt.serial != "" {
+				item.SerialNumbers = []string{tt.serial}
+			}
+			candidates := Candidates([]models.InvoiceItem{{Name: "BOLSA", Amount: decimal.NewFromInt(0)}, item})
+			got := ""
+			if len(candidates) > 0 {
+				got = candidates[0].Reason
+				if candidates[0].Item != 1 || candidates[0].Name != tt.name {
+					t.Errorf("candidate = %+v, want item 1", candidates[0])
+				}
+			}
+			if got != tt.want {
+				t.Errorf("reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
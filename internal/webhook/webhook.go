@@ -0,0 +1,214 @@
+// Package webhook delivers invoice events to configured HTTP endpoints
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+)
+
+// Event names
+const (
+	EventProcessed   = "invoice.processed"        // An invoice was processed or reprocessed
+	EventNeedsReview = "invoice.needs_review"     // A processed invoice has low confidence or no total
+	EventApproved    = "invoice.approved"         // A stored invoice was approved
+	EventViolation   = "invoice.policy_violation" // A processed invoice went over a monthly limit of the expense policy
+	EventBudget      = "budget.threshold"         // The estimated AI spend reached a threshold of usage.budget
+)
+
+// Events lists the event names webhooks can subscribe to
+var Events = []string{EventProcessed, EventNeedsReview, EventApproved, EventViolation, EventBudget}
+
+// Event is the data passed to payload templates
+type Event struct {
+	Event     string                `json:"event"`
+	Timestamp time.Time             `json:"timestamp"`
+	TenantID  string                `json:"tenantId,omitempty"`
+	InvoiceID string                `json:"invoiceId,omitempty"` // Empty when storage is disabled
+	Invoice   *models.Invoice       `json:"invoice,omitempty"`   // Nil for budget events
+	Record    *models.StoredInvoice `json:"-"`                   // The stored invoice, nil when storage is disabled
+	Budget    *models.BudgetAlert   `json:"budget,omitempty"`    // For budget events
+}
+
+// funcs are the functions available to payload templates
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Parse parses a payload template
+func Parse(text string) (*template.Template, error) {
+	return template.New("payload").Funcs(funcs).Option("missingkey=error").Parse(text)
+}
+
+// Dispatcher sends events to webhooks in the background, retrying failed deliveries
+type Dispatcher struct {
+	client *http.Client
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	templates map[string]*template.Template // Parsed templates by text
+}
+
+// NewDispatcher creates a dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		client:    &http.Client{},
+		templates: make(map[string]*template.Template),
+	}
+}
+
+// Send delivers event to the hooks subscribed to it. Deliveries run in the
+// background; failures are logged after the last attempt.
+func (d *Dispatcher) Send(event Event, hooks []models.WebhookConfig) {
+	for _, hook := range hooks {
+		if !subscribed(hook, event.Event) {
+			continue
+		}
+		body, err := d.render(hook, event)
+		if err != nil {
+			slog.Warn("webhook payload failed", "webhook", hook.Name, "event", event.Event, "error", err)
+			continue
+		}
+
+		d.wg.Add(1)
+		go func(hook models.WebhookConfig) {
+			defer d.wg.Done()
+			err := d.deliver(hook, body)
+			if err != nil {
+				slog.Warn("webhook delivery failed", "webhook", hook.Name, "event", event.Event, "invoice_id", event.InvoiceID, "error", err)
+			}
+		}(hook)
+	}
+}
+
+// Close waits for pending deliveries until ctx expires
+func (d *Dispatcher) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// subscribed reports whether hook receives the event; no events means all of them
+func subscribed(hook models.WebhookConfig, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, e := range hook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the payload of event: the hook's template, or the event as JSON
+func (d *Dispatcher) render(hook models.WebhookConfig, event Event) ([]byte, error) {
+	if hook.Template == "" {
+		return json.Marshal(event)
+	}
+
+	d.mu.Lock()
+	tmpl, ok := d.templates[hook.Template]
+	if !ok {
+		var err error
+		tmpl, err = Parse(hook.Template)
+		if err != nil {
+			d.mu.Unlock()
+			return nil, err
+		}
+		d.templates[hook.Template] = tmpl
+	}
+	d.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deliver sends body, retrying network errors and 5xx/429 responses with backoff
+func (d *Dispatcher) deliver(hook models.WebhookConfig, body []byte) error {
+	attempts := hook.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := time.Second
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var retry bool
+		retry, err = d.post(hook, body)
+		if err == nil || !retry {
+			return err
+		}
+		if attempt < attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying
+func (d *Dispatcher) post(hook models.WebhookConfig, body []byte) (bool, error) {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	method := hook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	contentType := hook.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "invoice-ocr-service")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return false, nil
+	}
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(text)))
+}
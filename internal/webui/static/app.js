@@ -0,0 +1,330 @@
+// Review UI for invoice-ocr-service. Talks to /api/v1 with the API key kept
+// in localStorage; no build step or dependencies.
+"use strict";
+
+const API = "/api/v1";
+const PAGE_SIZE = 25;
+
+const $ = (id) => document.getElementById(id);
+
+const state = {
+  offset: 0,
+  total: 0,
+  record: null,
+  originalURL: null,
+};
+
+$("api-key").value = localStorage.getItem("apiKey") || "";
+
+async function api(path, options = {}) {
+  const headers = new Headers(options.headers || {});
+  const key = localStorage.getItem("apiKey");
+  if (key) {
+    headers.set("X-API-Key", key);
+  }
+  const response = await fetch(API + path, { ...options, headers });
+  if (!response.ok) {
+    let message = response.status + " " + response.statusText;
+    try {
+      const body = await response.json();
+      if (body.error) {
+        message = body.error;
+      }
+    } catch (e) {
+      // Not a JSON error body
+    }
+    throw new Error(message);
+  }
+  return response;
+}
+
+function setStatus(id, message, isError) {
+  const el = $(id);
+  el.textContent = message;
+  el.classList.toggle("error", !!isError);
+}
+
+function formatDate(value) {
+  if (!value || value.startsWith("0001-")) {
+    return "";
+  }
+  return value.slice(0, 10);
+}
+
+// Lists the newest invoices
+
+async function loadList() {
+  let list;
+  try {
+    const response = await api(`/invoices?limit=${PAGE_SIZE}&offset=${state.offset}`);
+    list = await response.json();
+  } catch (e) {
+    $("invoices").replaceChildren(Object.assign(document.createElement("li"), {
+      className: "error",
+      textContent: e.message,
+    }));
+    return;
+  }
+
+  state.total = list.total;
+  const items = list.invoices.map((invoice) => {
+    const li = document.createElement("li");
+    li.dataset.id = invoice.id;
+    li.classList.toggle("selected", state.record && state.record.id === invoice.id);
+
+    const vendor = document.createElement("strong");
+    vendor.textContent = invoice.vendor || invoice.filename || invoice.id;
+    const details = document.createElement("span");
+    details.textContent = [formatDate(invoice.date), invoice.total].filter(Boolean).join(" · ");
+    const badge = document.createElement("span");
+    badge.className = "badge";
+    if (invoice.approvedAt) {
+      badge.textContent = "approved";
+    } else if (invoice.correctedAt) {
+      badge.textContent = "corrected";
+    } else if (invoice.confidence < 0.7) {
+      badge.textContent = "review";
+      badge.classList.add("warn");
+    }
+    li.append(vendor, details, badge);
+    li.addEventListener("click", () => openInvoice(invoice.id));
+    return li;
+  });
+  $("invoices").replaceChildren(...items);
+
+  const pages = Math.max(1, Math.ceil(state.total / PAGE_SIZE));
+  $("page").textContent = `${Math.floor(state.offset / PAGE_SIZE) + 1} / ${pages}`;
+  $("prev").disabled = state.offset === 0;
+  $("next").disabled = state.offset + PAGE_SIZE >= state.total;
+}
+
+// Shows one invoice: the original with the extracted fields over it, and the edit form
+
+async function openInvoice(id) {
+  let record;
+  try {
+    record = await (await api(`/invoices/${encodeURIComponent(id)}`)).json();
+  } catch (e) {
+    setStatus("edit-status", e.message, true);
+    return;
+  }
+  state.record = record;
+  $("detail").hidden = false;
+  setStatus("edit-status", "");
+  for (const li of $("invoices").children) {
+    li.classList.toggle("selected", li.dataset.id === id);
+  }
+
+  await showOriginal(record);
+  fillForm(record);
+}
+
+async function showOriginal(record) {
+  if (state.originalURL) {
+    URL.revokeObjectURL(state.originalURL);
+    state.originalURL = null;
+  }
+  $("image").hidden = true;
+  $("pdf").hidden = true;
+  $("no-original").hidden = true;
+
+  let blob;
+  try {
+    blob = await (await api(`/invoices/${encodeURIComponent(record.id)}/original`)).blob();
+  } catch (e) {
+    $("no-original").textContent = e.message;
+    $("no-original").hidden = false;
+    return;
+  }
+  state.originalURL = URL.createObjectURL(blob);
+  if (blob.type === "application/pdf") {
+    $("pdf").src = state.originalURL;
+    $("pdf").hidden = false;
+  } else {
+    $("image").src = state.originalURL;
+    $("image").hidden = false;
+  }
+}
+
+function fillForm(record) {
+  const invoice = record.invoice || {};
+  const form = $("edit");
+  $("title").textContent = invoice.vendor || record.filename || record.id;
+
+  const meta = [`Confidence ${Math.round((invoice.confidence || 0) * 100)}%`];
+  if (record.aiProvider) {
+    meta.push(record.model ? `${record.aiProvider}/${record.model}` : record.aiProvider);
+  }
+  if (record.correctedAt) {
+    meta.push(`corrected ${formatDate(record.correctedAt)}`);
+  }
+  if (record.approvedAt) {
+    meta.push(`approved ${formatDate(record.approvedAt)}` + (record.approvedBy ? ` by ${record.approvedBy}` : ""));
+  }
+  $("meta").textContent = meta.join(" · ");
+
+  form.vendor.value = invoice.vendor || "";
+  form.date.value = formatDate(invoice.date);
+  form.total.value = invoice.total || "";
+  form.tax.value = invoice.tax || "";
+  form.categories.value = (invoice.categories || []).join(", ");
+
+  $("items").replaceChildren();
+  for (const item of invoice.items || []) {
+    addItemRow(item);
+  }
+  renderSummary(invoice);
+  $("approve").disabled = !!record.approvedAt;
+}
+
+function addItemRow(item = {}) {
+  const row = $("item-row").content.firstElementChild.cloneNode(true);
+  row.querySelector('[data-field="name"]').value = item.name || "";
+  row.querySelector('[data-field="quantity"]').value = item.quantity || "";
+  row.querySelector('[data-field="amount"]').value = item.amount || "";
+  row.querySelector('[data-field="isTaxed"]').checked = !!item.isTaxed;
+  row.querySelector(".remove").addEventListener("click", () => row.remove());
+  $("items").append(row);
+}
+
+function renderSummary(invoice) {
+  const fields = [
+    ["Vendor", invoice.vendor],
+    ["Date", formatDate(invoice.date)],
+    ["Total", invoice.total],
+    ["Tax", invoice.tax],
+    ["Items", (invoice.items || []).length || ""],
+    ["Categories", (invoice.categories || []).join(", ")],
+  ];
+  const nodes = [];
+  for (const [label, value] of fields) {
+    const dt = document.createElement("dt");
+    dt.textContent = label;
+    const dd = document.createElement("dd");
+    dd.textContent = value || "—";
+    dd.classList.toggle("missing", !value);
+    nodes.push(dt, dd);
+  }
+  $("summary").replaceChildren(...nodes);
+}
+
+function readForm() {
+  const form = $("edit");
+  const items = [...$("items").children].map((row) => ({
+    name: row.querySelector('[data-field="name"]').value.trim(),
+    quantity: parseInt(row.querySelector('[data-field="quantity"]').value, 10) || 0,
+    amount: row.querySelector('[data-field="amount"]').value.trim() || "0",
+    isTaxed: row.querySelector('[data-field="isTaxed"]').checked,
+  }));
+  return {
+    vendor: form.vendor.value,
+    date: form.date.value,
+    total: form.total.value.trim() || "0",
+    tax: form.tax.value.trim() || "0",
+    categories: form.categories.value.split(",").map((c) => c.trim()).filter(Boolean),
+    items,
+  };
+}
+
+// Actions
+
+$("auth").addEventListener("submit", (event) => {
+  event.preventDefault();
+  localStorage.setItem("apiKey", $("api-key").value.trim());
+  state.offset = 0;
+  loadList();
+});
+
+$("upload").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const file = $("file").files[0];
+  if (!file) {
+    return;
+  }
+  const body = new FormData();
+  body.append("file", file);
+  if ($("vision").checked) {
+    body.append("useVisionModel", "true");
+  }
+
+  setStatus("upload-status", "Processing…");
+  try {
+    const result = await (await api("/process-invoice", { method: "POST", body })).json();
+    if (!result.success) {
+      throw new Error(result.error || "Processing failed");
+    }
+    $("upload").reset();
+    state.offset = 0;
+    await loadList();
+    if (result.invoice && result.invoice.id) {
+      setStatus("upload-status", "");
+      await openInvoice(result.invoice.id);
+    } else {
+      setStatus("upload-status", "Processed, but storage is disabled so the result cannot be reviewed.", true);
+    }
+  } catch (e) {
+    setStatus("upload-status", e.message, true);
+  }
+});
+
+$("edit").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const id = state.record.id;
+  try {
+    const record = await (await api(`/invoices/${encodeURIComponent(id)}`, {
+      method: "PATCH",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(readForm()),
+    })).json();
+    state.record = record;
+    fillForm(record);
+    setStatus("edit-status", "Saved");
+    loadList();
+  } catch (e) {
+    setStatus("edit-status", e.message, true);
+  }
+});
+
+$("approve").addEventListener("click", async () => {
+  try {
+    await api(`/invoices/${encodeURIComponent(state.record.id)}/approve`, { method: "POST" });
+    await openInvoice(state.record.id);
+    setStatus("edit-status", "Approved");
+    loadList();
+  } catch (e) {
+    setStatus("edit-status", e.message, true);
+  }
+});
+
+$("reprocess").addEventListener("click", async () => {
+  if (!confirm("Run the extraction again? Manual corrections are replaced.")) {
+    return;
+  }
+  setStatus("edit-status", "Processing…");
+  try {
+    await api(`/invoices/${encodeURIComponent(state.record.id)}/reprocess`, { method: "POST" });
+    await openInvoice(state.record.id);
+    setStatus("edit-status", "Reprocessed");
+    loadList();
+  } catch (e) {
+    setStatus("edit-status", e.message, true);
+  }
+});
+
+$("add-item").addEventListener("click", () => addItemRow());
+
+$("toggle-overlay").addEventListener("click", () => {
+  $("overlay").classList.toggle("collapsed");
+});
+
+$("prev").addEventListener("click", () => {
+  state.offset = Math.max(0, state.offset - PAGE_SIZE);
+  loadList();
+});
+
+$("next").addEventListener("click", () => {
+  state.offset += PAGE_SIZE;
+  loadList();
+});
+
+loadList();
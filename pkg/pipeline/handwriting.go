@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/consistency"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// handwritten reports whether the total of an extraction from OCR text may be
+// handwritten: Tesseract reads handwriting poorly, so the model was unsure or
+// took the total from somewhere other than the text
+func handwritten(invoice *Invoice, stats *Stats, config Handwriting) bool {
+	if config.Below <= 0 || stats.RuleBypass || stats.RawText == "" {
+		return false
+	}
+	return invoice.Total.IsZero() || invoice.Confidence < config.Below ||
+		!consistency.InText(invoice.Total, stats.RawText)
+}
+
+// readHandwriting reads image again with the vision model of opts.Handwriting
+// and takes the total and tip it reads, which may be handwritten, into
+// invoice. A failed reading leaves invoice as it is: the OCR extraction stands.
+func readHandwriting(ctx context.Context, opts Options, stats *Stats, profile *Profile, image []byte, invoice *Invoice) {
+	ctx, span := tracing.Start(ctx, "ai.handwriting", attribute.Float64("invoice.confidence", invoice.Confidence))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	visionOpts := opts
+	visionOpts.UseVisionModel = true
+	if opts.Handwriting.Provider != "" {
+		visionOpts.Provider = opts.Handwriting.Provider
+		visionOpts.Model = ""
+	}
+	if opts.Handwriting.Model != "" {
+		visionOpts.Model = opts.Handwriting.Model
+	}
+	imageBase64, err := visionImage(image, visionOpts)
+	if err != nil {
+		return
+	}
+	visionStats := newStats(visionOpts)
+	read, err := extractInvoice(ctx, visionOpts, &visionStats, profile, imageBase64)
+	stats.Handwriting = true
+	stats.AIDuration += visionStats.AIDuration
+	stats.Usage.PromptTokens += visionStats.Usage.PromptTokens
+	stats.Usage.CompletionTokens += visionStats.Usage.CompletionTokens
+	if err != nil || !read.Total.IsPositive() {
+		return
+	}
+
+	invoice.HandwritingDetected = read.HandwritingDetected
+	invoice.Total = read.Total
+	invoice.SetProvenance(read.Provenance["total"], "total")
+	if read.Tip != nil {
+		invoice.Tip = read.Tip
+	}
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrRejected is wrapped by hooks that refuse a document, e.g. one failing a
+// custom validation
+var ErrRejected = errors.New("rejected by hook")
+
+// Hook customizes runs. It also implements one or more of PreOCRHook,
+// PostOCRHook and PostExtractHook; hooks run in the order given.
+type Hook interface {
+	Name() string
+}
+
+// PreOCRHook runs on the image before preprocessing. It returns a replacement
+// image, or nil to keep it.
+type PreOCRHook interface {
+	PreOCR(ctx context.Context, image []byte) ([]byte, error)
+}
+
+// PostOCRHook runs on the OCR text before the AI stage, including text passed
+// to ExtractText, and returns the text to extract from. Vision runs skip it.
+type PostOCRHook interface {
+	PostOCR(ctx context.Context, text string) (string, error)
+}
+
+// PostExtractHook runs on a successful extraction and may modify the invoice
+type PostExtractHook interface {
+	PostExtract(ctx context.Context, invoice *Invoice, stats Stats) error
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Hook
+)
+
+// RegisterHook adds a hook that the service applies to every run, typically
+// from an init function in a file added to cmd/server. Programs calling
+// Process directly pass their hooks in Options.Hooks instead.
+func RegisterHook(hook Hook) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, hook)
+}
+
+// RegisteredHooks returns the hooks added with RegisterHook
+func RegisteredHooks() []Hook {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Hook(nil), registry...)
+}
+
+// runPreOCR passes image through the PreOCR hooks
+func runPreOCR(ctx context.Context, hooks []Hook, image []byte) ([]byte, error) {
+	for _, hook := range hooks {
+		h, ok := hook.(PreOCRHook)
+		if !ok {
+			continue
+		}
+		ctx, span := tracing.Start(ctx, "hook.pre_ocr", attribute.String("hook.name", hook.Name()))
+		replaced, err := h.PreOCR(ctx, image)
+		tracing.End(span, err)
+		if err != nil {
+			return nil, hookError(hook, err)
+		}
+		if replaced != nil {
+			image = replaced
+		}
+	}
+	return image, nil
+}
+
+// runPostOCR passes text through the PostOCR hooks
+func runPostOCR(ctx context.Context, hooks []Hook, text string) (string, error) {
+	for _, hook := range hooks {
+		h, ok := hook.(PostOCRHook)
+		if !ok {
+			continue
+		}
+		ctx, span := tracing.Start(ctx, "hook.post_ocr", attribute.String("hook.name", hook.Name()))
+		var err error
+		text, err = h.PostOCR(ctx, text)
+		tracing.End(span, err)
+		if err != nil {
+			return "", hookError(hook, err)
+		}
+	}
+	return text, nil
+}
+
+// runPostExtract passes invoice through the PostExtract hooks
+func runPostExtract(ctx context.Context, hooks []Hook, invoice *Invoice, stats Stats) error {
+	for _, hook := range hooks {
+		h, ok := hook.(PostExtractHook)
+		if !ok {
+			continue
+		}
+		ctx, span := tracing.Start(ctx, "hook.post_extract", attribute.String("hook.name", hook.Name()))
+		err := h.PostExtract(ctx, invoice, stats)
+		tracing.End(span, err)
+		if err != nil {
+			return hookError(hook, err)
+		}
+	}
+	return nil
+}
+
+// hookError wraps the error of a hook in a StageError
+func hookError(hook Hook, err error) error {
+	return &StageError{StageHook, fmt.Errorf("hook %s: %w", hook.Name(), err)}
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+)
+
+// defaultPageParallelism is how many pages of a document are OCR'd at once
+// when Options.PageParallelism is not set
+const defaultPageParallelism = 4
+
+// multiPage reports whether image is of a format that can hold several
+// pages, PDF or TIFF
+func multiPage(image []byte) bool {
+	switch imagedata.DetectMIMEType(image) {
+	case "application/pdf", "image/tiff":
+		return true
+	}
+	return false
+}
+
+// ocrPages preprocesses and OCRs the page images of a document, up to
+// opts.PageParallelism at once, and returns them in page order. The first
+// failure stops pages not started yet and is the error returned, unless ctx
+// was cancelled. Progress is left to the caller, which reports it for the
+// whole document.
+func ocrPages(ctx context.Context, images [][]byte, opts Options) ([]page, error) {
+	workers := opts.PageParallelism
+	if workers <= 0 {
+		workers = defaultPageParallelism
+	}
+	workers = min(workers, len(images))
+	opts.Progress = nil
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		pages    = make([]page, len(images))
+		next     = make(chan int)
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				p, err := ocrPage(runCtx, i+1, images[i], opts)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				pages[i] = p
+			}
+		}()
+	}
+
+feed:
+	for i := range images {
+		select {
+		case next <- i:
+		case <-runCtx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, &StageError{StageOCR, err}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return pages, nil
+}
+
+// ocrPage runs the pre-OCR hooks, preprocessing and OCR on one page
+func ocrPage(ctx context.Context, number int, image []byte, opts Options) (page, error) {
+	image, err := runPreOCR(ctx, opts.Hooks, image)
+	if err != nil {
+		return page{}, err
+	}
+	var stats Stats
+	// A page may be a document's terms or annex, so whole documents are
+	// classified once all their pages are read
+	processed, err := scan(ctx, image, opts, true, false, &stats)
+	if err != nil {
+		var se *StageError
+		if errors.As(err, &se) {
+			return page{}, &StageError{se.Stage, fmt.Errorf("page %d: %w", number, se.Err)}
+		}
+		return page{}, err
+	}
+	return page{
+		image:      processed,
+		text:       stats.RawText,
+		duration:   stats.OCRDuration,
+		language:   stats.Language,
+		confidence: stats.OCRConfidence,
+		attempts:   stats.OCRAttempts,
+		strategy:   stats.OCRStrategy,
+
+		preprocess:    stats.PreprocessDuration,
+		size:          stats.ImageSize,
+		processedSize: stats.ProcessedSize,
+	}, nil
+}
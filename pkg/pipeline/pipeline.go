@@ -0,0 +1,674 @@
+// Package pipeline runs the invoice extraction pipeline (image preprocessing,
+// OCR and AI extraction) in-process, for programs that embed it instead of
+// calling the HTTP service. Tesseract and ImageMagick must be installed, as
+// for the server.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/ai"
+	"github.com/facturaIA/invoice-ocr-service/internal/catalog"
+	"github.com/facturaIA/invoice-ocr-service/internal/classify"
+	"github.com/facturaIA/invoice-ocr-service/internal/consistency"
+	"github.com/facturaIA/invoice-ocr-service/internal/correct"
+	"github.com/facturaIA/invoice-ocr-service/internal/exif"
+	"github.com/facturaIA/invoice-ocr-service/internal/imagedata"
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/ocr"
+	"github.com/facturaIA/invoice-ocr-service/internal/residency"
+	"github.com/facturaIA/invoice-ocr-service/internal/rules"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"github.com/facturaIA/invoice-ocr-service/internal/warranty"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Types shared with the service
+type (
+	Invoice        = models.Invoice
+	InvoiceItem    = models.InvoiceItem
+	Usage          = models.Usage
+	AIConfig       = models.AIConfig
+	OpenAIConfig   = models.OpenAIConfig
+	GeminiConfig   = models.GeminiConfig
+	OllamaConfig   = models.OllamaConfig
+	ExternalConfig = models.ExternalConfig
+	Recording      = models.RecordingConfig
+	OCRRetry       = models.OCRRetryConfig
+	Handwriting    = models.HandwritingConfig
+	ImageSize      = models.ImageSize
+	Generation     = models.GenerationParams
+	Provider       = ai.Provider
+	ParseError     = ai.ParseError
+	LanguageError  = ocr.LanguageError
+	Rules          = rules.Set
+	Corrector      = correct.Corrector
+	Residency      = residency.Policy
+	Classifier     = classify.Classifier
+	Profiles       = classify.Profiles
+	Profile        = classify.Profile
+	Catalog        = catalog.Catalog
+)
+
+// Pipeline stages reported by StageError
+const (
+	StagePreprocess = "preprocess"
+	StageOCR        = "ocr"
+	StageAI         = "ai"
+	StageHook       = "hook"
+	StageClassify   = "classify"
+)
+
+// Progress events, in the order a run emits them
+const (
+	EventPreprocessing = "preprocessing"
+	EventOCRStarted    = "ocr_started" // Skipped with UseVisionModel
+	EventOCRDone       = "ocr_done"
+	EventAIStarted     = "ai_started"
+)
+
+// Event reports the progress of a run
+type Event struct {
+	Stage string // One of the Event* constants
+	Text  string // OCR text, with EventOCRDone
+}
+
+var (
+	// ErrUnsupportedProvider is returned for an unknown provider name
+	ErrUnsupportedProvider = errors.New("unsupported AI provider")
+
+	// ErrParseResponse is returned when the AI response is not valid invoice JSON
+	ErrParseResponse = ai.ErrParseResponse
+
+	// ErrNoRecording is returned in replay mode for a request without a fixture
+	ErrNoRecording = ai.ErrNoRecording
+
+	// ErrProviderNotAllowed is returned when the residency policy forbids
+	// sending the document to the provider
+	ErrProviderNotAllowed = residency.ErrNotAllowed
+
+	// ErrNotAnInvoice is returned when the classifier rejects a document
+	// that is neither an invoice nor a receipt
+	ErrNotAnInvoice = classify.ErrNotAnInvoice
+
+	// ErrUnknownProfile is returned when Options.Profile names no profile
+	ErrUnknownProfile = classify.ErrUnknownProfile
+)
+
+// Options configures one run. Empty fields fall back to the defaults noted.
+type Options struct {
+	AI             AIConfig      // Provider credentials and default models
+	Provider       string        // "openai", "gemini", "ollama" or "external" (default: AI.DefaultProvider)
+	Model          string        // Overrides the provider's model from AI
+	Language       string        // Tesseract language (default: "eng")
+	UseVisionModel bool          // Send the image to a vision model instead of OCR text
+	OCREngine      string        // "tesseract" (default) or "easyocr"
+	Categories     []string      // Categories the model may assign
+	Prompt         string        // Prompt template; empty uses the built-in one
+	AITimeout      time.Duration // Bounds the AI stage alone, 0 = no timeout
+	Generation     Generation    // Sampling overrides, e.g. temperature; zero keeps provider defaults
+	Progress       func(Event)   // Called as each stage starts or ends, on the goroutine calling Process
+	Rules          *Rules        // Vendor rules tried on the OCR text, see rules.Compile; nil = none
+	Correction     *Corrector    // Fixes OCR confusions before rules and the AI, see correct.Compile; nil = none
+	Residency      *Residency    // Providers documents may be sent to, see residency.Compile; nil = any
+	Classifier     *Classifier   // Classifies OCR text before the AI and picks its prompt, see classify.Compile; nil = none
+	Profiles       *Profiles     // Prompt profiles, see classify.CompileProfiles; nil = none
+	Profile        string        // Profile to extract with; empty lets the classifier select one from Profiles
+	Catalog        *Catalog      // Products line items are matched to, see catalog.Load; nil = none
+	OCRRetry       OCRRetry      // OCR settings tried when the text's confidence is low; zero Below = no retries
+	Handwriting    Handwriting   // Vision model reading of totals OCR may have missed as handwritten; zero Below = none
+	CapturePhoto   bool          // Read the capture time and position of a photo from its EXIF data into Invoice.Photo
+	StripMetadata  bool          // Remove EXIF and other metadata from images sent to vision models, see ocr.StripMetadata
+	Hooks          []Hook        // Run around the OCR and AI stages, see Hook
+
+	PageParallelism  int  // Pages of a multi-page document OCR'd at once (default: 4)
+	LanguageFallback bool // Use "eng" when Language is not installed instead of failing
+}
+
+// Stats describes a run. It is filled in as far as the run got, so a failed
+// run still reports the OCR text, durations and tokens consumed.
+type Stats struct {
+	RawText     string  // OCR text (empty with UseVisionModel)
+	OCRDuration float64 // Seconds
+	AIDuration  float64 // Seconds
+	Provider    string  // Provider used
+	Model       string  // Model used, with defaults from AI applied
+	Usage       Usage   // Pages and tokens; EstimatedCost is left to the caller
+	Language    string  // Tesseract language used, "eng" after a fallback (empty with UseVisionModel)
+
+	OCRConfidence float64 // Mean word confidence of the OCR text, from 0 to 1
+	OCRAttempts   int     // OCR passes run, retries included (0 with UseVisionModel)
+	OCRStrategy   string  // Retry strategy whose text was kept, empty for the first pass
+
+	PreprocessDuration float64   // Seconds
+	ImageSize          ImageSize // Of the upload, or its first page; zero when it could not be read
+	ProcessedSize      ImageSize // After preprocessing
+
+	DocumentType string // "invoice", "receipt" or "other" when the classifier ran
+	Profile      string // Prompt profile extracted with, if any
+
+	Rule         string   // Vendor rule that matched the OCR text, if any
+	RuleBypass   bool     // The rule supplied the fields and the AI was not called
+	RuleMismatch []string // Fields on which the AI disagreed with the rule
+
+	Handwriting bool // A vision model read the document again for a handwritten total
+}
+
+// StageError records the pipeline stage an error occurred in
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string { return e.Err.Error() }
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Process extracts the invoice data of an image. The pages of a multi-page
+// PDF or TIFF are OCR'd in parallel and their text is extracted as one
+// invoice; with UseVisionModel, the upload is sent as it is. Errors are
+// *StageError values; ctx cancellation and AI timeouts can be detected with
+// errors.Is.
+func Process(ctx context.Context, image []byte, opts Options) (*Invoice, Stats, error) {
+	if !opts.UseVisionModel && multiPage(image) {
+		pages, err := scanPages(ctx, image, opts)
+		if err != nil {
+			return nil, newStats(opts), err
+		}
+		numbers := make([]int, len(pages))
+		for i := range numbers {
+			numbers[i] = i + 1
+		}
+		return extractPages(ctx, opts, pages, numbers)
+	}
+
+	stats := newStats(opts)
+	original := image
+
+	image, err := runPreOCR(ctx, opts.Hooks, image)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	// Step 1 and 2: Preprocess, then OCR or prepare the image for a vision model
+	processedImage, err := scan(ctx, image, opts, !opts.UseVisionModel, true, &stats)
+	if err != nil {
+		return nil, stats, err
+	}
+	var imageBase64 string
+	if opts.UseVisionModel {
+		imageBase64, err = visionImage(processedImage, opts)
+		if err != nil {
+			return nil, stats, err
+		}
+	}
+
+	var upload []byte
+	if !opts.UseVisionModel {
+		upload = image
+	}
+	invoice, err := extract(ctx, opts, &stats, imageBase64, upload)
+	if err == nil && opts.CapturePhoto {
+		invoice.Photo = photoMetadata(original)
+	}
+	return invoice, stats, err
+}
+
+// visionImage returns an image encoded for a vision model
+func visionImage(image []byte, opts Options) (string, error) {
+	if opts.StripMetadata {
+		stripped, err := ocr.StripMetadata(image)
+		if err != nil {
+			return "", &StageError{StagePreprocess, fmt.Errorf("failed to strip image metadata: %w", err)}
+		}
+		image = stripped
+	}
+	return imagedata.Encode(image, ""), nil
+}
+
+// photoMetadata returns the capture time and position recorded in the EXIF
+// data of an upload, nil when there are none or they cannot be read
+func photoMetadata(image []byte) *models.PhotoMetadata {
+	metadata, err := exif.Read(image)
+	if err != nil {
+		return nil
+	}
+	return metadata
+}
+
+// scan preprocesses image and, with ocr set, reads its text into stats. It
+// returns the preprocessed image. With rejectEarly set, the text of the first
+// OCR pass is classified, and a document opts.Classifier rejects fails before
+// the OCR retries and the AI stage are paid for.
+func scan(ctx context.Context, image []byte, opts Options, ocrText, rejectEarly bool, stats *Stats) ([]byte, error) {
+	progress := progressFunc(opts)
+	var language string
+	if ocrText {
+		var err error
+		language, err = ocrLanguage(opts)
+		if err != nil {
+			return nil, &StageError{StageOCR, err}
+		}
+		stats.Language = language
+	}
+
+	progress(Event{Stage: EventPreprocessing})
+	_, span := tracing.Start(ctx, "ocr.preprocess", attribute.Int("image.bytes", len(image)))
+	start := time.Now()
+	preprocessor := ocr.NewPreprocessor(opts.OCREngine == "easyocr")
+	processedImage, err := preprocessor.PreprocessImageFromBytes(image)
+	stats.PreprocessDuration = time.Since(start).Seconds()
+	tracing.End(span, err)
+	if err != nil {
+		return nil, &StageError{StagePreprocess, fmt.Errorf("image preprocessing failed: %w", err)}
+	}
+	stats.ImageSize = imageSize(image)
+	stats.ProcessedSize = imageSize(processedImage)
+	if !ocrText {
+		return processedImage, nil
+	}
+
+	progress(Event{Stage: EventOCRStarted})
+	_, span = tracing.Start(ctx, "ocr.tesseract", attribute.String("ocr.language", language))
+	tesseract := ocr.NewTesseractOCR(language)
+	result, err := tesseract.ExtractText(processedImage)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, &StageError{StageOCR, fmt.Errorf("OCR failed: %w", err)}
+	}
+	stats.OCRAttempts = 1
+	stats.OCRDuration = result.Duration
+	if rejectEarly && strings.TrimSpace(result.Text) != "" {
+		first := opts.Classifier.Classify(result.Text)
+		if err := opts.Classifier.Check(first); err != nil {
+			stats.RawText = result.Text
+			stats.OCRConfidence = result.Confidence
+			stats.DocumentType = first.Type
+			return nil, &StageError{StageClassify, err}
+		}
+	}
+	if result.Confidence < opts.OCRRetry.Below {
+		result = retryOCR(ctx, tesseract, image, processedImage, opts.OCRRetry, result, stats)
+	}
+	stats.RawText = result.Text
+	stats.OCRConfidence = result.Confidence
+	progress(Event{Stage: EventOCRDone, Text: result.Text})
+	return processedImage, nil
+}
+
+// OCR retry strategies
+const (
+	RetrySingleBlock  = "single_block"  // Read the page as one uniform block of text
+	RetrySingleColumn = "single_column" // Read the page as one column of text of varying sizes
+	RetryInverted     = "inverted"      // Negate the preprocessed image, for light text on a dark background
+	RetryUnprocessed  = "unprocessed"   // Read the image as uploaded, without preprocessing
+)
+
+// defaultRetries are the strategies tried when OCRRetry.Strategies is empty
+var defaultRetries = []string{RetrySingleBlock, RetrySingleColumn, RetryInverted, RetryUnprocessed}
+
+// retryOCR runs OCR again with each strategy of config until the confidence
+// reaches config.Below, and returns the result with the highest confidence,
+// best being that of the first run. Failed attempts are skipped. Attempts
+// and their duration are added to stats.
+func retryOCR(ctx context.Context, tesseract *ocr.TesseractOCR, image, processed []byte, config OCRRetry, best ocr.Result, stats *Stats) ocr.Result {
+	strategies := config.Strategies
+	if len(strategies) == 0 {
+		strategies = defaultRetries
+	}
+	for _, strategy := range strategies {
+		if ctx.Err() != nil {
+			break
+		}
+		_, span := tracing.Start(ctx, "ocr.retry", attribute.String("ocr.strategy", strategy))
+		result, err := retryWith(tesseract, strategy, image, processed)
+		tracing.End(span, err)
+		stats.OCRAttempts++
+		stats.OCRDuration += result.Duration
+		if err != nil {
+			continue // Recorded on the span
+		}
+		if result.Confidence > best.Confidence {
+			best = result
+			stats.OCRStrategy = strategy
+		}
+		if best.Confidence >= config.Below {
+			break
+		}
+	}
+	return best
+}
+
+// retryWith runs OCR with one retry strategy
+func retryWith(tesseract *ocr.TesseractOCR, strategy string, image, processed []byte) (ocr.Result, error) {
+	switch strategy {
+	case RetrySingleBlock:
+		return tesseract.WithPageSegMode(ocr.SegmentSingleBlock).ExtractText(processed)
+	case RetrySingleColumn:
+		return tesseract.WithPageSegMode(ocr.SegmentSingleColumn).ExtractText(processed)
+	case RetryInverted:
+		inverted, err := ocr.Invert(processed)
+		if err != nil {
+			return ocr.Result{}, err
+		}
+		return tesseract.ExtractText(inverted)
+	case RetryUnprocessed:
+		return tesseract.ExtractText(image)
+	}
+	return ocr.Result{}, fmt.Errorf("unknown OCR retry strategy %q", strategy)
+}
+
+// imageSize returns the size of an image, zero when it cannot be read
+func imageSize(image []byte) ImageSize {
+	width, height, err := ocr.Dimensions(image)
+	if err != nil {
+		return ImageSize{}
+	}
+	return ImageSize{Width: int(width), Height: int(height)}
+}
+
+// fallbackLanguage is used with LanguageFallback when Language is not installed
+const fallbackLanguage = "eng"
+
+// ocrLanguage returns the Tesseract language of a run. A language without
+// installed data fails with a *LanguageError before the image is touched,
+// unless LanguageFallback is set and fallbackLanguage is installed.
+func ocrLanguage(opts Options) (string, error) {
+	language := opts.Language
+	if language == "" {
+		language = "eng"
+	}
+	if err := ocr.CheckLanguage(language); err != nil {
+		if opts.LanguageFallback && ocr.CheckLanguage(fallbackLanguage) == nil {
+			return fallbackLanguage, nil
+		}
+		return "", err
+	}
+	return language, nil
+}
+
+// ExtractText runs only the AI extraction stage on text that was OCR'd
+// elsewhere, e.g. by scanner software, or on the body of an email. Language,
+// UseVisionModel and OCREngine are ignored.
+func ExtractText(ctx context.Context, text string, opts Options) (*Invoice, Stats, error) {
+	stats := newStats(opts)
+	stats.RawText = text
+	invoice, err := extract(ctx, opts, &stats, "", nil)
+	return invoice, stats, err
+}
+
+// newStats returns the stats of a run that has not started yet
+func newStats(opts Options) Stats {
+	stats := Stats{
+		Provider: opts.Provider,
+		Usage:    Usage{Pages: 1},
+	}
+	if stats.Provider == "" {
+		stats.Provider = opts.AI.DefaultProvider
+	}
+	stats.Model = ResolveModel(opts.AI, stats.Provider, opts.Model)
+	return stats
+}
+
+// progressFunc returns the progress callback of opts, or a no-op
+func progressFunc(opts Options) func(Event) {
+	if opts.Progress == nil {
+		return func(Event) {}
+	}
+	return opts.Progress
+}
+
+// extract corrects and classifies the OCR text, then runs the AI stage and the
+// hooks around it. upload, when not nil, is read again by a vision model if
+// the total may be handwritten.
+func extract(ctx context.Context, opts Options, stats *Stats, imageBase64 string, upload []byte) (*Invoice, error) {
+	if stats.RawText != "" {
+		text, err := runPostOCR(ctx, opts.Hooks, opts.Correction.Text(stats.RawText))
+		if err != nil {
+			return nil, err
+		}
+		stats.RawText = text
+	}
+
+	// Documents are classified by their text before the AI stage. Those
+	// without, vision runs and scans OCR found no text on, are classified by
+	// what the AI reads from them instead.
+	textless := imageBase64 != "" || strings.TrimSpace(stats.RawText) == ""
+	if !textless {
+		result := opts.Classifier.Classify(stats.RawText)
+		stats.DocumentType = result.Type
+		if err := opts.Classifier.Check(result); err != nil {
+			return nil, &StageError{StageClassify, err}
+		}
+	}
+
+	profile, err := opts.Profiles.Get(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		profile = opts.Profiles.Select(stats.RawText, stats.DocumentType)
+	}
+	if profile != nil {
+		stats.Profile = profile.Name
+	}
+
+	invoice, err := extractInvoice(ctx, opts, stats, profile, imageBase64)
+	if err != nil {
+		return nil, err
+	}
+	if upload != nil && handwritten(invoice, stats, opts.Handwriting) {
+		readHandwriting(ctx, opts, stats, profile, upload, invoice)
+	}
+	if textless {
+		result := opts.Classifier.ClassifyExtraction(invoice)
+		stats.DocumentType = result.Type
+		if err := opts.Classifier.Check(result); err != nil {
+			return nil, &StageError{StageClassify, err}
+		}
+	}
+	invoice.DocumentType = stats.DocumentType
+	invoice.DocumentSubtype = classify.Subtype(stats.RawText)
+	invoice.Profile = stats.Profile
+	consistency.RepairItems(invoice.Items)
+	consistency.CheckTotal(invoice)
+	opts.Catalog.Apply(invoice.Items)
+	invoice.WarrantyCandidates = warranty.Candidates(invoice.Items)
+	if err := runPostExtract(ctx, opts.Hooks, invoice, *stats); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// extractInvoice runs the AI stage on stats.RawText or, for vision models, on
+// imageBase64, with the prompt and extra fields of profile when it is not nil
+func extractInvoice(ctx context.Context, opts Options, stats *Stats, profile *Profile, imageBase64 string) (*Invoice, error) {
+	// Known vendors may be read by a rule instead of, or as a check on, the AI
+	var ruled *rules.Result
+	if imageBase64 == "" && stats.RawText != "" {
+		ruled = opts.Rules.Apply(stats.RawText)
+	}
+	if ruled != nil {
+		stats.Rule = ruled.Rule
+		if ruled.Mode == rules.Bypass && ruled.Complete() {
+			stats.RuleBypass = true
+			ruled.Invoice.SetProvenance(models.Provenance{Source: models.SourceTemplateRule, Rule: ruled.Rule}, models.ProvenanceFields...)
+			setConfidence(ruled.Invoice, stats, ruled.Invoice.Confidence, opts.AI)
+			return ruled.Invoice, nil
+		}
+	}
+
+	// Step 3: Create AI provider
+	if err := opts.Residency.Check(opts.AI, stats.Provider); err != nil {
+		return nil, &StageError{StageAI, err}
+	}
+	provider, err := NewProvider(opts.AI, stats.Provider, opts.Model)
+	if err != nil {
+		return nil, &StageError{StageAI, err}
+	}
+	params := generationDefaults(opts.AI, stats.Provider, opts.Generation)
+	if err := ai.ValidateGeneration(stats.Provider, params); err != nil {
+		return nil, &StageError{StageAI, fmt.Errorf("invalid generation parameters: %w", err)}
+	}
+
+	// Step 4: Extract data with AI
+	progressFunc(opts)(Event{Stage: EventAIStarted})
+	aiCtx, span := tracing.Start(ctx, "ai.extract",
+		attribute.String("ai.provider", stats.Provider),
+		attribute.String("ai.model", stats.Model),
+		attribute.Bool("ai.vision", imageBase64 != ""),
+	)
+	defer span.End()
+	if opts.AITimeout > 0 {
+		var cancel context.CancelFunc
+		aiCtx, cancel = context.WithTimeout(aiCtx, opts.AITimeout)
+		defer cancel()
+	}
+
+	prompt := opts.Prompt
+	if typed := opts.Classifier.Prompt(stats.DocumentType); typed != "" {
+		prompt = typed
+	}
+	var fields []models.ProfileField
+	var kind string
+	if profile != nil {
+		if profile.Prompt != "" {
+			prompt = profile.Prompt
+		}
+		fields = profile.Fields
+		kind = profile.Kind
+	}
+	extractor := ai.NewExtractor(provider, opts.Categories, prompt).WithFields(fields).WithKind(kind)
+	invoice, aiDuration, err := extractor.Extract(aiCtx, stats.RawText, imageBase64, params)
+	if reporter, ok := provider.(ai.UsageReporter); ok {
+		u := reporter.LastUsage()
+		stats.Usage.PromptTokens += u.PromptTokens
+		stats.Usage.CompletionTokens += u.CompletionTokens
+	}
+	span.SetAttributes(
+		attribute.Int("ai.prompt_tokens", stats.Usage.PromptTokens),
+		attribute.Int("ai.completion_tokens", stats.Usage.CompletionTokens),
+	)
+	if err != nil {
+		// Providers do not always wrap the context error, so report it explicitly
+		if ctxErr := aiCtx.Err(); ctxErr != nil && !errors.Is(err, ctxErr) {
+			err = fmt.Errorf("%w: %v", ctxErr, err)
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &StageError{StageAI, fmt.Errorf("AI extraction failed: %w", err)}
+	}
+	stats.AIDuration = aiDuration
+	source := models.SourceOCRLLM
+	if imageBase64 != "" {
+		source = models.SourceVision
+	}
+	invoice.SetProvenance(models.Provenance{Source: source, Provider: stats.Provider, Model: stats.Model}, models.ProvenanceFields...)
+	setConfidence(invoice, stats, invoice.ModelConfidence, opts.AI)
+
+	if ruled != nil {
+		stats.RuleMismatch = opts.Rules.CrossCheck(ruled, invoice)
+	}
+	return invoice, nil
+}
+
+// defaultUnknownConfidence is the confidence of an invoice when neither OCR
+// nor the extractor gave one and AIConfig.UnknownConfidence is not set
+const defaultUnknownConfidence = 0.85
+
+// setConfidence sets the confidence of an extraction: the lower of the OCR
+// text's confidence, when the text was OCR'd here, and own, the extractor's
+// confidence in its reading (0 when it gave none), as the fields can be no
+// better than either. With neither, e.g. a vision run with a prompt that does
+// not ask for it, config's unknown confidence is used.
+func setConfidence(invoice *Invoice, stats *Stats, own float64, config AIConfig) {
+	ocrRun := stats.OCRAttempts > 0
+	if ocrRun {
+		invoice.OCRConfidence = stats.OCRConfidence
+	}
+	switch {
+	case ocrRun && own > 0:
+		invoice.Confidence = min(stats.OCRConfidence, own)
+	case ocrRun:
+		invoice.Confidence = stats.OCRConfidence
+	case own > 0:
+		invoice.Confidence = own
+	case config.UnknownConfidence > 0:
+		invoice.Confidence = config.UnknownConfidence
+	default:
+		invoice.Confidence = defaultUnknownConfidence
+	}
+}
+
+// NewProvider creates an AI provider from config. model overrides the
+// provider's configured model when set. With AI.Recording set, its requests
+// go through a cassette that records or replays them.
+func NewProvider(config AIConfig, name, model string) (Provider, error) {
+	model = ResolveModel(config, name, model)
+	var provider Provider
+	switch name {
+	case "openai":
+		provider = ai.NewOpenAIProvider(config.OpenAI.APIKey, config.OpenAI.BaseURL, model)
+	case "gemini":
+		provider = ai.NewGeminiProvider(config.Gemini.APIKey, model)
+	case "ollama":
+		provider = ai.NewOllamaProvider(config.Ollama.BaseURL, model, config.Ollama.KeepAlive)
+	case "external":
+		if len(config.External.Command) == 0 && config.External.URL == "" {
+			return nil, fmt.Errorf("external provider: no command or url configured")
+		}
+		provider = ai.NewExternalProvider(config.External, model)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, name)
+	}
+
+	if config.Recording.Mode != "" {
+		cassette, err := ai.NewCassette(config.Recording.Mode, config.Recording.Dir, nil)
+		if err != nil {
+			return nil, err
+		}
+		if setter, ok := provider.(ai.TransportSetter); ok {
+			setter.SetTransport(cassette)
+		}
+	}
+	return provider, nil
+}
+
+// generationDefaults fills the vision settings of params the request left
+// unset from the provider's config
+func generationDefaults(config AIConfig, name string, params Generation) Generation {
+	if name != "openai" {
+		return params
+	}
+	if params.ImageDetail == "" {
+		params.ImageDetail = config.OpenAI.ImageDetail
+	}
+	if params.MaxImageTokens == nil && config.OpenAI.MaxImageTokens > 0 {
+		maxImageTokens := config.OpenAI.MaxImageTokens
+		params.MaxImageTokens = &maxImageTokens
+	}
+	return params
+}
+
+// ResolveModel returns the model a provider call uses, applying config defaults
+func ResolveModel(config AIConfig, name, model string) string {
+	if model != "" {
+		return model
+	}
+	switch name {
+	case "openai":
+		return config.OpenAI.Model
+	case "gemini":
+		return config.Gemini.Model
+	case "ollama":
+		return config.Ollama.Model
+	case "external":
+		return config.External.Model
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/ocr"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProcessReceipts extracts every receipt of a photo showing several, e.g.
+// expense receipts photographed together on a table. Each receipt found by
+// ocr.FindReceipts is cropped and processed like a single invoice; a photo in
+// which no separate receipts are found is processed whole, as one document
+// without a region. The error is set only when the photo cannot be read.
+func ProcessReceipts(ctx context.Context, data []byte, opts Options) ([]Document, error) {
+	_, span := tracing.Start(ctx, "ocr.segment", attribute.Int("image.bytes", len(data)))
+	regions, err := ocr.FindReceipts(data)
+	if err == nil {
+		span.SetAttributes(attribute.Int("ocr.receipts", len(regions)))
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, &StageError{StagePreprocess, fmt.Errorf("failed to find receipts: %w", err)}
+	}
+
+	if len(regions) == 0 {
+		invoice, stats, err := Process(ctx, data, opts)
+		return []Document{{Invoice: invoice, Stats: stats, Err: err}}, nil
+	}
+
+	documents := make([]Document, len(regions))
+	for i := range regions {
+		region := regions[i]
+		invoice, stats, err := ProcessRegion(ctx, data, region, opts)
+		documents[i] = Document{Region: &region, Invoice: invoice, Stats: stats, Err: err}
+	}
+	return documents, nil
+}
+
+// ProcessRegion extracts one invoice from an area of a photo, e.g. to
+// reprocess a receipt found by ProcessReceipts
+func ProcessRegion(ctx context.Context, data []byte, region models.Region, opts Options) (*Invoice, Stats, error) {
+	image, err := ocr.Crop(data, region)
+	if err != nil {
+		return nil, newStats(opts), &StageError{StagePreprocess, fmt.Errorf("failed to crop receipt: %w", err)}
+	}
+	return Process(ctx, image, opts)
+}
@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/facturaIA/invoice-ocr-service/internal/models"
+	"github.com/facturaIA/invoice-ocr-service/internal/ocr"
+	"github.com/facturaIA/invoice-ocr-service/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// headerLines is how many non-empty lines at the top of a page are searched
+// for an invoice header
+const headerLines = 15
+
+var (
+	// pageMarker matches page numbering such as "Page 1 of 3" or "Página 2/3"
+	pageMarker = regexp.MustCompile(`(?i)\b(?:page|p[áa]gina|pag\.?|p[áa]g\.?|seite|hoja)\s*(\d+)\s*(?:of|de|von|/)\s*\d+`)
+
+	// invoiceHeader matches the title of an invoice or receipt
+	invoiceHeader = regexp.MustCompile(`(?i)\b(?:factura|invoice|facture|rechnung|fattura|fatura|receipt|recibo|ticket)\b`)
+)
+
+// Document is one invoice found in an upload by ProcessDocuments or ProcessReceipts
+type Document struct {
+	Pages   []int          // 1-based page numbers in the upload
+	Region  *models.Region // Area of the photo, set by ProcessReceipts
+	Invoice *Invoice       // nil when Err is set
+	Stats   Stats
+	Err     error // Failure of this document alone; the others are still extracted
+}
+
+// Original returns the part of an upload a document was found in, to archive
+// instead of the whole upload: a document of its pages for a split upload, or
+// a PNG crop of its area for a segmented photo. The content type is empty when
+// the upload's format is kept.
+func (d Document) Original(data []byte) ([]byte, string, error) {
+	switch {
+	case d.Region != nil:
+		image, err := ocr.Crop(data, *d.Region)
+		return image, "image/png", err
+	case len(d.Pages) > 0:
+		part, err := ocr.SelectPages(data, d.Pages)
+		return part, "", err
+	}
+	return data, "", nil
+}
+
+// page is an OCR'd page of an upload
+type page struct {
+	image    []byte // Preprocessed
+	text     string
+	duration float64 // OCR seconds
+	language string  // Tesseract language used
+
+	confidence float64 // Mean OCR word confidence (0-1)
+	attempts   int     // OCR runs, see Stats.OCRAttempts
+	strategy   string  // OCRRetry strategy whose text was kept
+
+	preprocess    float64 // Preprocessing seconds
+	size          ImageSize
+	processedSize ImageSize
+}
+
+// ProcessDocuments extracts every invoice of an upload batching several, e.g.
+// a supplier's PDF of the month's invoices. Pages are OCR'd in parallel and
+// grouped at invoice boundaries, see startsInvoice; each group is then
+// extracted like a single invoice. With UseVisionModel, the first page of
+// each group is sent to the model. The error is set only when the upload
+// cannot be split or OCR'd.
+func ProcessDocuments(ctx context.Context, data []byte, opts Options) ([]Document, error) {
+	pages, err := scanPages(ctx, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []Document
+	for _, group := range groupPages(pages) {
+		invoice, stats, err := extractPages(ctx, opts, pages, group)
+		documents = append(documents, Document{Pages: group, Invoice: invoice, Stats: stats, Err: err})
+	}
+	return documents, nil
+}
+
+// ProcessPages extracts one invoice from the given 1-based pages of an
+// upload, e.g. to reprocess a document found by ProcessDocuments
+func ProcessPages(ctx context.Context, data []byte, numbers []int, opts Options) (*Invoice, Stats, error) {
+	if len(numbers) == 0 {
+		return nil, newStats(opts), &StageError{StagePreprocess, errors.New("no pages given")}
+	}
+	pages, err := scanPages(ctx, data, opts)
+	if err != nil {
+		return nil, newStats(opts), err
+	}
+	for _, n := range numbers {
+		if n < 1 || n > len(pages) {
+			return nil, newStats(opts), &StageError{StagePreprocess, fmt.Errorf("page %d out of range: the document has %d pages", n, len(pages))}
+		}
+	}
+	return extractPages(ctx, opts, pages, numbers)
+}
+
+// scanPages splits an upload into pages and OCRs them, see ocrPages.
+// Progress is reported once for the whole upload.
+func scanPages(ctx context.Context, data []byte, opts Options) ([]page, error) {
+	progress := progressFunc(opts)
+	progress(Event{Stage: EventPreprocessing})
+
+	_, span := tracing.Start(ctx, "ocr.split", attribute.Int("image.bytes", len(data)))
+	images, err := ocr.SplitPages(data)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, &StageError{StagePreprocess, fmt.Errorf("failed to split pages: %w", err)}
+	}
+
+	progress(Event{Stage: EventOCRStarted})
+	pages, err := ocrPages(ctx, images, opts)
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(pages))
+	for i, p := range pages {
+		texts[i] = p.text
+	}
+	progress(Event{Stage: EventOCRDone, Text: strings.Join(texts, "\n\n")})
+	return pages, nil
+}
+
+// extractPages runs the AI stage on the text of the given 1-based pages
+func extractPages(ctx context.Context, opts Options, pages []page, numbers []int) (*Invoice, Stats, error) {
+	stats := newStats(opts)
+	stats.Usage.Pages = len(numbers)
+	first := pages[numbers[0]-1]
+	stats.Language = first.language
+	stats.ImageSize, stats.ProcessedSize = first.size, first.processedSize
+	texts := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		texts = append(texts, pages[n-1].text)
+		stats.OCRDuration += pages[n-1].duration
+		stats.OCRConfidence += pages[n-1].confidence / float64(len(numbers))
+		stats.OCRAttempts += pages[n-1].attempts
+		stats.PreprocessDuration += pages[n-1].preprocess
+	}
+	if len(numbers) == 1 {
+		stats.OCRStrategy = first.strategy
+	}
+
+	var imageBase64 string
+	if opts.UseVisionModel {
+		var err error
+		imageBase64, err = visionImage(first.image, opts)
+		if err != nil {
+			return nil, stats, err
+		}
+	} else {
+		stats.RawText = strings.Join(texts, "\n\n")
+	}
+	invoice, err := extract(ctx, opts, &stats, imageBase64, nil)
+	return invoice, stats, err
+}
+
+// groupPages returns the 1-based page numbers of each invoice, in order.
+// The first page always starts an invoice.
+func groupPages(pages []page) [][]int {
+	var groups [][]int
+	for i, p := range pages {
+		if i == 0 || startsInvoice(p.text) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], i+1)
+	}
+	return groups
+}
+
+// startsInvoice reports whether a page is the first of an invoice. Page
+// numbering decides when present: "Page 1 of 2" starts one, "Page 2 of 2"
+// continues the previous one. Otherwise a page starts an invoice when a title
+// such as "Factura" or "Invoice" appears in its first lines.
+func startsInvoice(text string) bool {
+	if match := pageMarker.FindStringSubmatch(text); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		return n == 1
+	}
+
+	lines := 0
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if invoiceHeader.MatchString(line) {
+			return true
+		}
+		lines++
+		if lines == headerLines {
+			break
+		}
+	}
+	return false
+}